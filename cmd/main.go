@@ -4,47 +4,86 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/atlassian/escalator/pkg/audit"
 	"github.com/atlassian/escalator/pkg/cloudprovider"
 	"github.com/atlassian/escalator/pkg/cloudprovider/aws"
+	"github.com/atlassian/escalator/pkg/cloudprovider/nodeclaim"
 	"github.com/atlassian/escalator/pkg/controller"
+	"github.com/atlassian/escalator/pkg/eventstream"
 	"github.com/atlassian/escalator/pkg/k8s"
 	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/tracing"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/alecthomas/kingpin.v2"
 	coreV1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	clientcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/record"
 )
 
 var (
-	loglevel                   = kingpin.Flag("loglevel", "Logging level passed into logrus. 4 for info, 5 for debug.").Short('v').Default(fmt.Sprintf("%d", log.InfoLevel)).Int()
+	loglevel                   = kingpin.Flag("loglevel", "Logging level passed into logrus. 4 for info, 5 for debug. Can also be set with ESCALATOR_LOG_LEVEL").Short('v').Default(fmt.Sprintf("%d", log.InfoLevel)).Envar("ESCALATOR_LOG_LEVEL").Int()
 	logfmt                     = kingpin.Flag("logfmt", "Set the format of logging output. (json, ascii)").Default("ascii").Enum("ascii", "json")
-	addr                       = kingpin.Flag("address", "Address to listen to for /metrics").Default(":8080").String()
-	scanInterval               = kingpin.Flag("scaninterval", "How often cluster is reevaluated for scale up or down").Default("60s").Duration()
+	addr                       = kingpin.Flag("address", "Address to listen to for /metrics, /pause, /resume, /scan, /drains, /recommendations and /config").Default(":8080").String()
+	tlsCertFile                = kingpin.Flag("tls-cert-file", "PEM file of the certificate to serve --address over HTTPS with. Served over HTTP if empty").String()
+	tlsKeyFile                 = kingpin.Flag("tls-key-file", "PEM file of the key of --tls-cert-file").String()
+	tlsCAFile                  = kingpin.Flag("tls-ca-file", "PEM file of the certificate authorities client certificates must be signed by. Client certificates are not required if empty").String()
+	pushgatewayURL             = kingpin.Flag("pushgateway-url", "Prometheus Pushgateway URL to push metrics to. Disabled if empty").String()
+	pushgatewayJob             = kingpin.Flag("pushgateway-job", "Job label to push metrics to the Prometheus Pushgateway with").Default("escalator").String()
+	pushInterval               = kingpin.Flag("push-interval", "How often metrics are pushed to the Prometheus Pushgateway").Default("30s").Duration()
+	scanInterval               = kingpin.Flag("scaninterval", "How often cluster is reevaluated for scale up or down. Can also be set with ESCALATOR_SCAN_INTERVAL").Default("60s").Envar("ESCALATOR_SCAN_INTERVAL").Duration()
+	minScanInterval            = kingpin.Flag("min-scan-interval", "Minimum time between the start of two scans, regardless of how they are triggered").Default("10s").Duration()
+	maxScanBackoff             = kingpin.Flag("max-scan-backoff", "Longest time a node group that keeps taking no action can go between scans. Disabled if 0").Default("0s").Duration()
+	scanTimeout                = kingpin.Flag("scan-timeout", "Longest time a scan can take before the rest of it is aborted until the next scan. Disabled if 0").Default("0s").Duration()
 	kubeConfigFile             = kingpin.Flag("kubeconfig", "Kubeconfig file location").String()
 	nodegroupConfigFile        = kingpin.Flag("nodegroups", "Config file for nodegroups").Required().String()
-	drymode                    = kingpin.Flag("drymode", "master drymode argument. If true, forces drymode on all nodegroups").Bool()
-	cloudProviderID            = kingpin.Flag("cloud-provider", "Cloud provider to use. Available options: (aws)").Default("aws").Enum("aws")
+	drymode                    = kingpin.Flag("drymode", "master drymode argument. If true, forces drymode on all nodegroups. Can also be set with ESCALATOR_DRYMODE").Envar("ESCALATOR_DRYMODE").Bool()
+	cloudProviderID            = kingpin.Flag("cloud-provider", "Cloud provider to use. Available options: (aws, nodeclaim)").Default("aws").Enum(aws.ProviderName, nodeclaim.ProviderName)
 	awsAssumeRoleARN           = kingpin.Flag("aws-assume-role-arn", "AWS role arn to assume. Only usable when using the aws cloud provider. Example: arn:aws:iam::111111111111:role/escalator").String()
+	awsCABundle                = kingpin.Flag("aws-ca-bundle", "Path to a PEM file of the certificate authorities trusted by the AWS clients, e.g. for a TLS intercepting proxy. Only usable when using the aws cloud provider").String()
+	awsRegion                  = kingpin.Flag("aws-region", "AWS region of the AWS clients, e.g. us-west-2. Defaults to the region of the AWS SDK configuration, such as the AWS_REGION environment variable. Only usable when using the aws cloud provider").String()
+	awsEndpoint                = kingpin.Flag("aws-endpoint", "URL the AWS clients send requests to in place of the AWS endpoints, e.g. http://localhost:4566 for localstack. Only usable when using the aws cloud provider").String()
+	awsScaleInProtection       = kingpin.Flag("aws-scale-in-protection", "Protect the instances of the auto scaling groups from scale in, only clearing it from the instances Escalator terminates. Only usable when using the aws cloud provider").Bool()
+	nodeClaimAPIURL            = kingpin.Flag("nodeclaim-api-url", "Base URL of the node claim API. Required when using the nodeclaim cloud provider").String()
+	nodeClaimAPIToken          = kingpin.Flag("nodeclaim-api-token", "Bearer token sent to the node claim API. Can also be set with ESCALATOR_NODECLAIM_API_TOKEN. Only usable when using the nodeclaim cloud provider").Envar("ESCALATOR_NODECLAIM_API_TOKEN").String()
 	leaderElect                = kingpin.Flag("leader-elect", "Enable leader election").Default("false").Bool()
 	leaderElectLeaseDuration   = kingpin.Flag("leader-elect-lease-duration", "Leader election lease duration").Default("15s").Duration()
 	leaderElectRenewDeadline   = kingpin.Flag("leader-elect-renew-deadline", "Leader election renew deadline").Default("10s").Duration()
 	leaderElectRetryPeriod     = kingpin.Flag("leader-elect-retry-period", "Leader election retry period").Default("2s").Duration()
 	leaderElectConfigNamespace = kingpin.Flag("leader-elect-config-namespace", "Leader election config map namespace").Default("kube-system").String()
 	leaderElectConfigName      = kingpin.Flag("leader-elect-config-name", "Leader election config map name").Default("escalator-leader-elect").String()
+	reconcileOnStartup         = kingpin.Flag("reconcile-on-startup", "Bring each nodegroup within its min and max nodes once on startup, ignoring cooldowns").Bool()
+	paused                     = kingpin.Flag("paused", "Start with all scaling paused. Use POST /resume to start scaling").Bool()
+	adminToken                 = kingpin.Flag("admin-token", "Bearer token required by the /pause, /resume, /scan and /config endpoints. Can also be set with ESCALATOR_ADMIN_TOKEN. Unauthenticated if empty").Envar("ESCALATOR_ADMIN_TOKEN").String()
+	strictStartup              = kingpin.Flag("strict-startup", "Exit at startup if the cloud provider credentials are missing permissions, rather than logging an error").Bool()
+	strictValidation           = kingpin.Flag("strict-validation", "Fail validating the nodegroups on warnings, such as nodegroups selecting the same nodes, rather than logging them").Bool()
+	compareNodegroups          = kingpin.Flag("compare-nodegroups", "Config file for nodegroups to compare against --nodegroups. Prints the node groups that would scale differently and exits without changing anything").String()
+	simulateNodes              = kingpin.Flag("simulate-nodes", "File of a recorded node list, e.g. from kubectl get nodes -o yaml. With --simulate-pods, prints the scale decision of every nodegroup in the recorded state and exits without connecting to the cluster or cloud provider").String()
+	simulatePods               = kingpin.Flag("simulate-pods", "File of a recorded pod list, e.g. from kubectl get pods --all-namespaces -o yaml. Used with --simulate-nodes").String()
+	maxDeletionsPerMinute      = kingpin.Flag("max-deletions-per-minute", "Maximum number of nodes deleted a minute across all nodegroups. Deletions over the limit are deferred to the next scan. Unlimited if 0").Default("0").Int()
+	metricsGranularity         = kingpin.Flag("metrics-granularity", "Granularity of the metrics exposed. nodegroup only exposes node group level metrics, node also exposes a series for every node. (nodegroup, node)").Default(metrics.GranularityNodeGroup).Enum(metrics.GranularityNodeGroup, metrics.GranularityNode)
+	metricsSinks               = kingpin.Flag("metrics-sink", "Where scale decisions and utilization are reported. Prometheus metrics are always served on /metrics. Can be repeated. (prometheus, cloudwatch)").Default(metrics.SinkPrometheus).Enums(metrics.SinkPrometheus, metrics.SinkCloudWatch)
+	cloudWatchNamespace        = kingpin.Flag("cloudwatch-namespace", "CloudWatch namespace to publish metrics to with the cloudwatch metrics sink").Default("Escalator").String()
+	auditLogPath               = kingpin.Flag("audit-log", "File to append a JSON audit entry to for every node created or destroyed in the cloud provider. Written to stdout if -. Disabled if empty").String()
+	eventStream                = kingpin.Flag("event-stream", "Write a newline delimited JSON event to stdout for every scale up, scale down, taint, drain, delete and scan error, separate from the logs written to stderr").Bool()
+	nodegroupStatus            = kingpin.Flag("nodegroup-status", "Update the status of the NodeGroup custom resource named after each nodegroup every scan. Nodegroups without one are skipped").Bool()
+	enableTracing              = kingpin.Flag("enable-tracing", "Export OpenTelemetry traces of scans over OTLP/HTTP with JSON bodies (http/json only). Configured with the standard OTEL_EXPORTER_OTLP_* environment variables").Bool()
 )
 
 // cloudProviderBuilder builds the requested cloud provider. aws, gce, etc
 type cloudProviderBuilder struct {
 	ProviderOpts cloudprovider.BuildOpts
+	NodeGroups   []controller.NodeGroupOptions
 }
 
 // Build builds the requested CloudProvider
@@ -53,8 +92,14 @@ func (b cloudProviderBuilder) Build() (cloudprovider.CloudProvider, error) {
 	case aws.ProviderName:
 		return aws.Builder{
 			ProviderOpts: b.ProviderOpts,
-			Opts: aws.Opts{
-				AssumeRoleARN: *awsAssumeRoleARN,
+			Opts:         awsOpts(b.NodeGroups),
+		}.Build()
+	case nodeclaim.ProviderName:
+		return nodeclaim.Builder{
+			ProviderOpts: b.ProviderOpts,
+			Opts: nodeclaim.Opts{
+				APIURL:   *nodeClaimAPIURL,
+				APIToken: *nodeClaimAPIToken,
 			},
 		}.Build()
 	default:
@@ -62,32 +107,85 @@ func (b cloudProviderBuilder) Build() (cloudprovider.CloudProvider, error) {
 	}
 }
 
+// awsOpts returns the aws cloud provider options from the flags and the region and endpoint overrides of the nodegroups
+func awsOpts(nodegroups []controller.NodeGroupOptions) aws.Opts {
+	nodeGroupEndpoints := make(map[string]aws.Endpoint)
+	for _, n := range nodegroups {
+		if len(n.AWSRegion) == 0 && len(n.AWSEndpoint) == 0 {
+			continue
+		}
+		for _, id := range n.CloudProviderGroupNameList() {
+			nodeGroupEndpoints[id] = aws.Endpoint{Region: n.AWSRegion, Endpoint: n.AWSEndpoint}
+		}
+	}
+	return aws.Opts{
+		AssumeRoleARN:      *awsAssumeRoleARN,
+		CABundle:           *awsCABundle,
+		ScaleInProtection:  *awsScaleInProtection,
+		Region:             *awsRegion,
+		Endpoint:           *awsEndpoint,
+		NodeGroupEndpoints: nodeGroupEndpoints,
+	}
+}
+
+// setupMetricsSinks creates the metrics sinks scale decisions are reported to
+// prometheus metrics are always served, so they don't need a sink
+func setupMetricsSinks(sinks []string) ([]metrics.Sink, error) {
+	var result []metrics.Sink
+	for _, sink := range sinks {
+		switch sink {
+		case metrics.SinkCloudWatch:
+			if *cloudProviderID != aws.ProviderName {
+				return nil, errors.Errorf("the %v metrics sink is only usable with the %v cloud provider", sink, aws.ProviderName)
+			}
+			client, err := aws.Builder{Opts: awsOpts(nil)}.BuildCloudWatch()
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to create cloudwatch client")
+			}
+			log.Infof("Publishing metrics to CloudWatch namespace %v", *cloudWatchNamespace)
+			result = append(result, metrics.NewCloudWatchSink(client, *cloudWatchNamespace))
+		}
+	}
+	return result, nil
+}
+
 // setupCloudProvider creates the cloudprovider builder with the nodegroup opts
 func setupCloudProvider(nodegroups []controller.NodeGroupOptions) cloudprovider.Builder {
 	var nodegroupIDs []string
 	for _, n := range nodegroups {
-		nodegroupIDs = append(nodegroupIDs, n.CloudProviderGroupName)
+		nodegroupIDs = append(nodegroupIDs, n.CloudProviderGroupNameList()...)
 	}
 	cloudBuilder := cloudProviderBuilder{
 		ProviderOpts: cloudprovider.BuildOpts{
 			ProviderID:   *cloudProviderID,
 			NodeGroupIDs: nodegroupIDs,
 		},
+		NodeGroups: nodegroups,
 	}
 	return cloudBuilder
 }
 
-// setupNodeGroups reads and validates the nodegroupoptions
-func setupNodeGroups() ([]controller.NodeGroupOptions, error) {
-	// nodegroupConfigFile is required by kingpin. Won't get to here if it's not defined
-	configFile, err := os.Open(*nodegroupConfigFile)
+// setupNodeGroups reads and validates the nodegroupoptions from the file
+func setupNodeGroups(file string) ([]controller.NodeGroupOptions, error) {
+	configFile, err := os.Open(file)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to open configFile")
 	}
+	defer configFile.Close()
 	nodegroups, err := controller.UnmarshalNodeGroupOptions(configFile)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to decode configFile")
 	}
+	// an empty file, e.g. read part way through a ConfigMap update, must not replace the running node groups
+	if len(nodegroups) == 0 {
+		return nil, errors.Errorf("no node groups are configured in %v", file)
+	}
+
+	// environment variable overrides take precedence over the file, and are validated along with the rest of the options
+	nodegroups, err = controller.ApplyNodeGroupEnvOverrides(nodegroups, os.LookupEnv)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to apply the nodegroup environment variable overrides")
+	}
 
 	// Validate each nodegroup options
 	for _, nodegroup := range nodegroups {
@@ -97,10 +195,28 @@ func setupNodeGroups() ([]controller.NodeGroupOptions, error) {
 			for _, err := range errs {
 				log.WithError(err).Error("failed check")
 			}
-			log.WithField("nodegroup", nodegroup.Name).Fatalf("There are %v problems when validating the options. Please check %v", len(errs), *nodegroupConfigFile)
+			return nil, errors.Errorf("there are %v problems when validating the options of node group %v. Please check %v", len(errs), nodegroup.Name, file)
 		}
 		log.WithField("nodegroup", nodegroup.Name).Info("Validating options: [PASS]")
-		log.WithField("nodegroup", nodegroup.Name).Infof("Registered with drymode %v", nodegroup.DryMode || *drymode)
+		log.WithField("nodegroup", nodegroup.Name).Infof("Registered with drymode %v and mode %v", nodegroup.DryMode || *drymode, nodegroup.ModeOrDefault())
+	}
+
+	// node groups scaling the same cloud provider group would conflict with each other
+	if errs := controller.ValidateCloudProviderGroupNames(nodegroups); len(errs) > 0 {
+		for _, err := range errs {
+			log.WithError(err).Error("failed check")
+		}
+		return nil, errors.Errorf("there are %v cloud provider groups referenced by more than one node group. Please check %v", len(errs), file)
+	}
+
+	// node groups selecting the same nodes are only a warning, as the nodes are managed by the first node group
+	if warnings := controller.ValidateNodeGroupOverlaps(nodegroups); len(warnings) > 0 {
+		for _, warning := range warnings {
+			log.WithError(warning).Warning("Overlapping node groups")
+		}
+		if *strictValidation {
+			return nil, errors.Errorf("there are %v node groups selecting the same nodes, which fails validation with --strict-validation. Please check %v", len(warnings), file)
+		}
 	}
 
 	return nodegroups, nil
@@ -131,6 +247,122 @@ func awaitStopSignal(stopChan chan struct{}) {
 	close(stopChan)
 }
 
+// awaitReloadSignal reloads the node group options from the config file each time SIGHUP is received
+// the running options are kept if the config file can't be read or is invalid, e.g. while a mounted ConfigMap is
+// being updated, and the reload is tried again on the next SIGHUP
+func awaitReloadSignal(c *controller.Controller) {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGHUP)
+	for range signalChan {
+		log.Infof("Reload signal received. Reloading node groups from %v", *nodegroupConfigFile)
+		nodegroups, err := setupNodeGroups(*nodegroupConfigFile)
+		if err != nil {
+			log.WithError(err).Warning("Failed to reload node groups. Keeping the existing options until the next reload")
+			metrics.ConfigReloadFailures.Inc()
+			continue
+		}
+		interval, err := setupScanInterval(*nodegroupConfigFile)
+		if err != nil {
+			log.WithError(err).Warning("Failed to reload the scan interval. Keeping the existing options until the next reload")
+			metrics.ConfigReloadFailures.Inc()
+			continue
+		}
+		c.ReloadNodeGroups(nodegroups)
+		c.ReloadScanInterval(interval)
+	}
+}
+
+// setupScanInterval returns the scan_interval of the config file, or --scaninterval if the file doesn't set one
+func setupScanInterval(file string) (time.Duration, error) {
+	configFile, err := os.Open(file)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to open configFile")
+	}
+	defer configFile.Close()
+	interval, err := controller.UnmarshalScanInterval(configFile)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to decode the scan_interval of configFile")
+	}
+	if interval == 0 {
+		return *scanInterval, nil
+	}
+	return interval, nil
+}
+
+// compareNodeGroups prints the node groups that would scale differently with the proposed config file
+// both configs are planned against the live cluster and cloud provider in a read only capacity
+func compareNodeGroups(k8sClient kubernetes.Interface, current []controller.NodeGroupOptions, proposedFile string) error {
+	proposed, err := setupNodeGroups(proposedFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load the nodegroups to compare")
+	}
+
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	plan := func(nodegroups []controller.NodeGroupOptions) ([]controller.NodeGroupPlan, error) {
+		return controller.Plan(controller.Opts{
+			K8SClient:            k8sClient,
+			NodeGroups:           nodegroups,
+			CloudProviderBuilder: setupCloudProvider(nodegroups),
+		}, stopChan)
+	}
+
+	currentPlans, err := plan(current)
+	if err != nil {
+		return errors.Wrap(err, "failed to plan the current nodegroups")
+	}
+	proposedPlans, err := plan(proposed)
+	if err != nil {
+		return errors.Wrap(err, "failed to plan the nodegroups to compare")
+	}
+
+	differences := controller.DiffPlans(currentPlans, proposedPlans)
+	if len(differences) == 0 {
+		fmt.Println("No differences. All node groups would scale the same")
+		return nil
+	}
+	describe := func(plan *controller.NodeGroupPlan) string {
+		if plan == nil {
+			return "not configured"
+		}
+		return plan.String()
+	}
+	for _, difference := range differences {
+		fmt.Printf("%v: %v -> %v\n", difference.NodeGroup, describe(difference.Current), describe(difference.Proposed))
+	}
+	return nil
+}
+
+// simulateNodeGroups prints the scale decision of every node group in the recorded node and pod lists
+func simulateNodeGroups(nodegroups []controller.NodeGroupOptions, nodesFile string, podsFile string) error {
+	if len(nodesFile) == 0 || len(podsFile) == 0 {
+		return errors.New("--simulate-nodes and --simulate-pods must be set together")
+	}
+	nodes, err := os.Open(nodesFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to open the recorded nodes")
+	}
+	defer nodes.Close()
+	pods, err := os.Open(podsFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to open the recorded pods")
+	}
+	defer pods.Close()
+
+	state, err := controller.LoadSimulationState(nodes, pods)
+	if err != nil {
+		return errors.Wrap(err, "failed to load the recorded state")
+	}
+	plans, err := controller.Simulate(state, nodegroups)
+	if err != nil {
+		return errors.Wrap(err, "failed to simulate the nodegroups")
+	}
+	for _, plan := range plans {
+		fmt.Printf("%v: %v\n", plan.NodeGroup, plan.String())
+	}
+	return nil
+}
+
 func awaitLeaderDeposed(leaderContext context.Context) {
 	// If the leader Context is finished, that's because we stopped leading.
 	// so we will crash.
@@ -140,8 +372,8 @@ func awaitLeaderDeposed(leaderContext context.Context) {
 
 }
 
-// startLeaderElection creates and starts the leader election
-func startLeaderElection(client kubernetes.Interface, resourceLockID string, config k8s.LeaderElectConfig) (context.Context, error) {
+// setupEventRecorder creates the recorder of the kubernetes events of leader election and the node groups
+func setupEventRecorder(client kubernetes.Interface) (record.EventRecorder, error) {
 	eventsScheme := runtime.NewScheme()
 	if err := coreV1.AddToScheme(eventsScheme); err != nil {
 		return nil, err
@@ -151,8 +383,26 @@ func startLeaderElection(client kubernetes.Interface, resourceLockID string, con
 	eventBroadcaster := record.NewBroadcaster()
 	eventBroadcaster.StartLogging(log.Infof)
 	eventBroadcaster.StartRecordingToSink(&clientcorev1.EventSinkImpl{Interface: clientcorev1.New(client.CoreV1().RESTClient()).Events("")})
-	recorder := eventBroadcaster.NewRecorder(eventsScheme, coreV1.EventSource{Component: "escalator"})
+	return eventBroadcaster.NewRecorder(eventsScheme, coreV1.EventSource{Component: "escalator"}), nil
+}
+
+// eventObject returns the reference to escalator's pod that node group events are recorded against
+// returns nil if the POD_NAME and POD_NAMESPACE environment variables aren't set
+func eventObject() *coreV1.ObjectReference {
+	name, namespace := os.Getenv("POD_NAME"), os.Getenv("POD_NAMESPACE")
+	if len(name) == 0 || len(namespace) == 0 {
+		return nil
+	}
+	return &coreV1.ObjectReference{
+		Kind:       "Pod",
+		APIVersion: "v1",
+		Name:       name,
+		Namespace:  namespace,
+	}
+}
 
+// startLeaderElection creates and starts the leader election
+func startLeaderElection(client kubernetes.Interface, recorder record.EventRecorder, resourceLockID string, config k8s.LeaderElectConfig) (context.Context, error) {
 	// Create leader elector
 	leaderElector, ctx, startedLeading, err := k8s.GetLeaderElector(context.Background(), config, client.CoreV1(), recorder, resourceLockID)
 	if err != nil {
@@ -185,10 +435,24 @@ func main() {
 
 	log.Info("Starting with log level", log.GetLevel())
 
-	nodegroups, err := setupNodeGroups()
+	// nodegroupConfigFile is required by kingpin. Won't get to here if it's not defined
+	nodegroups, err := setupNodeGroups(*nodegroupConfigFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	interval, err := setupScanInterval(*nodegroupConfigFile)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	// simulate the scale decisions of the recorded state and exit, without connecting to the cluster or cloud provider
+	if len(*simulateNodes) > 0 || len(*simulatePods) > 0 {
+		if err := simulateNodeGroups(nodegroups, *simulateNodes, *simulatePods); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	k8sClient, err := setupK8SClient(kubeConfigFile, leaderElect)
 	if err != nil {
 		log.Fatal(err)
@@ -206,8 +470,45 @@ func main() {
 	flag.Parse()
 	os.Args = tempArgs
 
+	// compare the scale decisions of the two configs and exit, without serving or scaling anything
+	if len(*compareNodegroups) > 0 {
+		if err := compareNodeGroups(k8sClient, nodegroups, *compareNodegroups); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// node level metrics are only registered when opted in, as there is a series for every node
+	if *metricsGranularity == metrics.GranularityNode {
+		metrics.RegisterNodeMetrics()
+	}
+
 	// start serving metrics endpoint
-	metrics.Start(*addr)
+	tlsOpts := metrics.TLSOpts{CertFile: *tlsCertFile, KeyFile: *tlsKeyFile, CAFile: *tlsCAFile}
+	if len(*tlsCAFile) > 0 && !tlsOpts.Enabled() {
+		log.Fatal("--tls-ca-file requires --tls-cert-file and --tls-key-file")
+	}
+	if err := metrics.Start(*addr, tlsOpts); err != nil {
+		log.WithError(err).Fatal("Failed to start serving the metrics endpoint")
+	}
+	if tlsOpts.Enabled() {
+		log.Infof("Serving over HTTPS on %v", *addr)
+	}
+
+	// start exporting traces if enabled, otherwise all spans are no-ops
+	shutdownTracing := func(context.Context) error { return nil }
+	if *enableTracing {
+		shutdownTracing, err = tracing.Start(context.Background())
+		if err != nil {
+			log.WithError(err).Fatal("Failed to start tracing")
+		}
+		log.Info("Exporting traces over OTLP")
+	}
+
+	recorder, err := setupEventRecorder(k8sClient)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create the event recorder")
+	}
 
 	// If leader election is enabled, do leader election or die
 	if *leaderElect {
@@ -219,7 +520,7 @@ func main() {
 			resourceLockID = uuid.New().String()
 		}
 
-		leaderContext, err := startLeaderElection(k8sClient, resourceLockID, k8s.LeaderElectConfig{
+		leaderContext, err := startLeaderElection(k8sClient, recorder, resourceLockID, k8s.LeaderElectConfig{
 			LeaseDuration: *leaderElectLeaseDuration,
 			RenewDeadline: *leaderElectRenewDeadline,
 			RetryPeriod:   *leaderElectRetryPeriod,
@@ -236,17 +537,99 @@ func main() {
 	stopChan := make(chan struct{}, 1)
 	go awaitStopSignal(stopChan)
 
+	// push metrics to the pushgateway as well as serving them, if configured
+	stopPush := func() {}
+	if len(*pushgatewayURL) > 0 {
+		if *pushInterval <= 0 {
+			log.Fatalf("Invalid push interval %v provided. Must be larger than 0", *pushInterval)
+		}
+		log.Infof("Pushing metrics to pushgateway %v every %v", *pushgatewayURL, *pushInterval)
+		stopPush = metrics.StartPush(*pushgatewayURL, *pushgatewayJob, *pushInterval, stopChan)
+	}
+
+	if *maxDeletionsPerMinute < 0 {
+		log.Fatalf("Invalid max deletions per minute %v provided. Must be 0 or larger", *maxDeletionsPerMinute)
+	}
+	if *maxDeletionsPerMinute > 0 {
+		log.Infof("Deleting a maximum of %v nodes a minute across all node groups", *maxDeletionsPerMinute)
+	}
+
+	sinks, err := setupMetricsSinks(*metricsSinks)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var auditLog *audit.Logger
+	if len(*auditLogPath) > 0 {
+		auditLog, err = audit.Open(*auditLogPath)
+		if err != nil {
+			log.WithError(err).Fatalf("Failed to open audit log %v", *auditLogPath)
+		}
+		log.Infof("Writing the node audit log to %v", *auditLogPath)
+	}
+
+	var events *eventstream.Stream
+	if *eventStream {
+		if *auditLogPath == audit.Stdout {
+			log.Fatal("--event-stream and --audit-log - can't both write to stdout")
+		}
+		events = eventstream.New(os.Stdout)
+		log.Info("Writing the event stream to stdout")
+	}
+
+	var statusClient dynamic.Interface
+	if *nodegroupStatus {
+		statusClient, err = k8s.NewDynamicClient(*kubeConfigFile)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to create the nodegroup status client")
+		}
+		log.Infof("Updating the status of the %v custom resources of the nodegroups", controller.NodeGroupResource.GroupResource())
+	}
+
 	// create the controller and run in a loop until the stop signal
 	opts := controller.Opts{
-		ScanInterval:         *scanInterval,
-		K8SClient:            k8sClient,
-		NodeGroups:           nodegroups,
-		DryMode:              *drymode,
-		CloudProviderBuilder: cloudBuilder,
+		ScanInterval:          interval,
+		MinScanInterval:       *minScanInterval,
+		MaxScanBackoff:        *maxScanBackoff,
+		ScanTimeout:           *scanTimeout,
+		K8SClient:             k8sClient,
+		NodeGroups:            nodegroups,
+		DryMode:               *drymode,
+		CloudProviderBuilder:  cloudBuilder,
+		ReconcileOnStartup:    *reconcileOnStartup,
+		Paused:                *paused,
+		AdminToken:            *adminToken,
+		NodeMetrics:           *metricsGranularity == metrics.GranularityNode,
+		MaxDeletionsPerMinute: *maxDeletionsPerMinute,
+		MetricsSinks:          sinks,
+		AuditLog:              auditLog,
+		EventStream:           events,
+		EventRecorder:         recorder,
+		EventObject:           eventObject(),
+		StatusClient:          statusClient,
 	}
 	c, err := controller.NewController(opts, stopChan)
 	if err != nil {
 		log.Fatal(err)
 	}
-	log.Fatal(c.RunForever(true))
+	if err := c.CheckCloudProvider(); err != nil {
+		if *strictStartup {
+			log.WithError(err).Fatal("Cloud provider credentials failed the startup permission check")
+		}
+		log.WithError(err).Error("Cloud provider credentials failed the startup permission check. Scale actions will fail until the permissions are fixed")
+	}
+	go awaitReloadSignal(c)
+	// serve the /pause, /resume, /scan and /drains endpoints alongside /metrics
+	if len(*adminToken) == 0 {
+		log.Warn("No admin token is set. The /pause, /resume, /scan and /config endpoints are unauthenticated")
+	}
+	c.RegisterHandlers(http.DefaultServeMux)
+	err = c.RunForever(true)
+
+	// push the metrics of the last scan and flush any remaining spans before exiting
+	stopPush()
+	if shutdownErr := shutdownTracing(context.Background()); shutdownErr != nil {
+		log.WithError(shutdownErr).Warn("Failed to shutdown tracing")
+	}
+	log.Fatal(err)
 }
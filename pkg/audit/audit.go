@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+)
+
+// Stdout is the audit log path that writes the entries to stdout
+const Stdout = "-"
+
+const (
+	// EventNodesCreated is logged when nodes are requested from the cloud provider
+	EventNodesCreated = "nodes_created"
+	// EventNodesDeleted is logged when nodes are terminated in the cloud provider
+	EventNodesDeleted = "nodes_deleted"
+	// EventTargetSizeDecreased is logged when requested nodes that weren't created are removed from the target size
+	EventTargetSizeDecreased = "target_size_decreased"
+)
+
+// Logger writes a structured JSON entry for every node escalator creates or destroys
+// it has its own logrus logger, so entries are written whatever the level or format of the debug logging.
+// A nil Logger discards every entry
+type Logger struct {
+	logger *log.Logger
+	closer io.Closer
+}
+
+// New creates an audit logger writing to w
+func New(w io.Writer) *Logger {
+	logger := log.New()
+	logger.Out = w
+	logger.Formatter = &log.JSONFormatter{}
+	logger.Level = log.InfoLevel
+	return &Logger{logger: logger}
+}
+
+// Open creates an audit logger appending to the file at path, or writing to stdout if the path is Stdout
+func Open(path string) (*Logger, error) {
+	if path == Stdout {
+		return New(os.Stdout), nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	logger := New(file)
+	logger.closer = file
+	return logger, nil
+}
+
+// Close closes the audit log file, if there is one
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// NodesCreated records that count nodes were requested from the cloud provider node group
+// the instance ids aren't known until the cloud provider launches the instances
+func (l *Logger) NodesCreated(nodegroup string, cloudProviderNodeGroup string, count int64, targetSize int64, reason string) {
+	if l == nil {
+		return
+	}
+	l.logger.WithFields(log.Fields{
+		"event":                     EventNodesCreated,
+		"nodegroup":                 nodegroup,
+		"cloud_provider_node_group": cloudProviderNodeGroup,
+		"count":                     count,
+		"target_size":               targetSize,
+		"reason":                    reason,
+	}).Info("Nodes created")
+}
+
+// TargetSizeDecreased records that count nodes that were requested but never created were removed from the target size
+// of the cloud provider node group
+func (l *Logger) TargetSizeDecreased(nodegroup string, cloudProviderNodeGroup string, count int64, targetSize int64, reason string) {
+	if l == nil {
+		return
+	}
+	l.logger.WithFields(log.Fields{
+		"event":                     EventTargetSizeDecreased,
+		"nodegroup":                 nodegroup,
+		"cloud_provider_node_group": cloudProviderNodeGroup,
+		"count":                     count,
+		"target_size":               targetSize,
+		"reason":                    reason,
+	}).Info("Target size decreased")
+}
+
+// NodesDeleted records that the nodes were terminated in the cloud provider node group
+func (l *Logger) NodesDeleted(nodegroup string, cloudProviderNodeGroup string, nodes []*v1.Node, reason string) {
+	if l == nil {
+		return
+	}
+	names := make([]string, 0, len(nodes))
+	instanceIDs := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+		if id := InstanceID(node.Spec.ProviderID); len(id) > 0 {
+			instanceIDs = append(instanceIDs, id)
+		}
+	}
+	l.logger.WithFields(log.Fields{
+		"event":                     EventNodesDeleted,
+		"nodegroup":                 nodegroup,
+		"cloud_provider_node_group": cloudProviderNodeGroup,
+		"count":                     len(nodes),
+		"nodes":                     names,
+		"instance_ids":              instanceIDs,
+		"reason":                    reason,
+	}).Info("Nodes deleted")
+}
+
+// InstanceID returns the cloud instance id from the provider id of a node, e.g. i-123 from aws:///us-east-1a/i-123
+// returns an empty string if the node has no provider id
+func InstanceID(providerID string) string {
+	return providerID[strings.LastIndex(providerID, "/")+1:]
+}
@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+)
+
+func decodeEntries(t *testing.T, data []byte) []map[string]interface{} {
+	var entries []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var entry map[string]interface{}
+		require.NoError(t, decoder.Decode(&entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf)
+
+	logger.NodesCreated("shared", "shared-asg", 2, 5, "cpu utilization 90.00%, memory utilization 10.00%")
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "n1"}),
+		test.BuildTestNode(test.NodeOpts{Name: "n2"}),
+	}
+	nodes[0].Spec.ProviderID = "aws:///us-east-1a/i-1"
+	nodes[1].Spec.ProviderID = ""
+	logger.NodesDeleted("shared", "shared-asg", nodes, "tainted node passed hard_delete_grace_period")
+	logger.TargetSizeDecreased("shared", "shared-asg", 1, 4, "cloud provider only created 4 of the target size of 5 nodes")
+
+	entries := decodeEntries(t, buf.Bytes())
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, EventNodesCreated, entries[0]["event"])
+	assert.Equal(t, "shared", entries[0]["nodegroup"])
+	assert.Equal(t, "shared-asg", entries[0]["cloud_provider_node_group"])
+	assert.Equal(t, float64(2), entries[0]["count"])
+	assert.Equal(t, float64(5), entries[0]["target_size"])
+	assert.Equal(t, "cpu utilization 90.00%, memory utilization 10.00%", entries[0]["reason"])
+	assert.NotEmpty(t, entries[0]["time"])
+
+	assert.Equal(t, EventNodesDeleted, entries[1]["event"])
+	assert.Equal(t, float64(2), entries[1]["count"])
+	assert.Equal(t, []interface{}{"n1", "n2"}, entries[1]["nodes"])
+	// nodes without a provider id have no instance id
+	assert.Equal(t, []interface{}{"i-1"}, entries[1]["instance_ids"])
+	assert.Equal(t, "tainted node passed hard_delete_grace_period", entries[1]["reason"])
+
+	assert.Equal(t, EventTargetSizeDecreased, entries[2]["event"])
+	assert.Equal(t, float64(1), entries[2]["count"])
+	assert.Equal(t, float64(4), entries[2]["target_size"])
+	assert.Equal(t, "cloud provider only created 4 of the target size of 5 nodes", entries[2]["reason"])
+}
+
+func TestLoggerNil(t *testing.T) {
+	var logger *Logger
+	logger.NodesCreated("shared", "shared-asg", 2, 5, "")
+	logger.NodesDeleted("shared", "shared-asg", nil, "")
+	logger.TargetSizeDecreased("shared", "shared-asg", 1, 4, "")
+	assert.NoError(t, logger.Close())
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	// entries are appended to the existing file
+	for i := 0; i < 2; i++ {
+		logger, err := Open(path)
+		require.NoError(t, err)
+		logger.NodesCreated("shared", "shared-asg", 1, 1, "")
+		require.NoError(t, logger.Close())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, decodeEntries(t, data), 2)
+
+	_, err = Open(filepath.Join(dir, "missing", "audit.log"))
+	assert.Error(t, err)
+}
+
+func TestInstanceID(t *testing.T) {
+	assert.Equal(t, "i-123", InstanceID("aws:///us-east-1a/i-123"))
+	assert.Equal(t, "claim-1", InstanceID("claim-1"))
+	assert.Equal(t, "", InstanceID(""))
+}
@@ -3,16 +3,20 @@ package aws
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/atlassian/escalator/pkg/cloudprovider"
 	"github.com/atlassian/escalator/pkg/metrics"
 	awsapi "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
 	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 )
@@ -20,6 +24,16 @@ import (
 // ProviderName identifies this module as aws
 const ProviderName = "aws"
 
+const (
+	// labelInstanceType is the well known label of the instance type of a node
+	labelInstanceType = "node.kubernetes.io/instance-type"
+	// labelInstanceTypeBeta is the deprecated label of the instance type set by older kubelets
+	labelInstanceTypeBeta = "beta.kubernetes.io/instance-type"
+)
+
+// dryRunOperationErrorCode is the error code of an ec2 dry run request that would have succeeded
+const dryRunOperationErrorCode = "DryRunOperation"
+
 func instanceToProviderId(instance *autoscaling.Instance) string {
 	return fmt.Sprintf("aws:///%s/%s", *instance.AvailabilityZone, *instance.InstanceId)
 }
@@ -32,7 +46,53 @@ func providerIdToInstanceId(providerId string) string {
 type CloudProvider struct {
 	service     autoscalingiface.AutoScalingAPI
 	ec2_service ec2iface.EC2API
+	sqs_service sqsiface.SQSAPI
 	nodeGroups  map[string]*NodeGroup
+
+	// nodeGroupEndpoints are the endpoints of the asgs that don't use service and ec2_service, see
+	// Opts.NodeGroupEndpoints
+	nodeGroupEndpoints map[string]Endpoint
+	// endpointServices are the clients of each endpoint in nodeGroupEndpoints
+	endpointServices map[Endpoint]endpointServices
+
+	// scaleInProtection is whether the instances of the asgs are protected from scale in, see Opts.ScaleInProtection
+	scaleInProtection bool
+}
+
+// endpointServices are the clients of an endpoint other than the one of the cloud provider's own clients
+type endpointServices struct {
+	service     autoscalingiface.AutoScalingAPI
+	ec2_service ec2iface.EC2API
+}
+
+// autoscalingService returns the autoscaling client of the endpoint, the cloud provider's own for the empty endpoint
+func (c *CloudProvider) autoscalingService(endpoint Endpoint) autoscalingiface.AutoScalingAPI {
+	if services, ok := c.endpointServices[endpoint]; ok {
+		return services.service
+	}
+	return c.service
+}
+
+// ec2Service returns the ec2 client of the endpoint, the cloud provider's own for the empty endpoint
+func (c *CloudProvider) ec2Service(endpoint Endpoint) ec2iface.EC2API {
+	if services, ok := c.endpointServices[endpoint]; ok {
+		return services.ec2_service
+	}
+	return c.ec2_service
+}
+
+// asgEndpoints groups the asgs by the endpoint they're described with, the empty endpoint for the cloud provider's
+// own clients. An empty list of asgs is grouped under the empty endpoint, so it's still described
+func (c *CloudProvider) asgEndpoints(ids []string) map[Endpoint][]string {
+	endpoints := make(map[Endpoint][]string)
+	for _, id := range ids {
+		endpoint := c.nodeGroupEndpoints[id]
+		endpoints[endpoint] = append(endpoints[endpoint], id)
+	}
+	if len(endpoints) == 0 {
+		endpoints[Endpoint{}] = nil
+	}
+	return endpoints
 }
 
 // Name returns name of the cloud provider.
@@ -58,22 +118,21 @@ func (c *CloudProvider) GetNodeGroup(id string) (cloudprovider.NodeGroup, bool)
 
 // RegisterNodeGroups adds the nodegroup to the list of nodes groups
 func (c *CloudProvider) RegisterNodeGroups(ids ...string) error {
-	strs := make([]*string, len(ids))
-	for i, s := range ids {
-		strs[i] = awsapi.String(s)
-	}
-
-	input := &autoscaling.DescribeAutoScalingGroupsInput{
-		AutoScalingGroupNames: strs,
-	}
+	var groups []*autoscaling.Group
+	for endpoint, endpointIDs := range c.asgEndpoints(ids) {
+		input := &autoscaling.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: awsapi.StringSlice(endpointIDs),
+		}
 
-	result, err := c.service.DescribeAutoScalingGroups(input)
-	if err != nil {
-		log.Errorf("failed to describe asgs %v. err: %v", ids, err)
-		return err
+		result, err := c.autoscalingService(endpoint).DescribeAutoScalingGroups(input)
+		if err != nil {
+			log.Errorf("failed to describe asgs %v. err: %v", endpointIDs, err)
+			return err
+		}
+		groups = append(groups, result.AutoScalingGroups...)
 	}
 
-	for _, group := range result.AutoScalingGroups {
+	for _, group := range groups {
 		id := awsapi.StringValue(group.AutoScalingGroupName)
 		if ng, ok := c.nodeGroups[id]; ok {
 			// just update the group if it already exists
@@ -88,15 +147,58 @@ func (c *CloudProvider) RegisterNodeGroups(ids ...string) error {
 		)
 	}
 
-	// Update metrics for each node group
+	c.updateMetrics()
+	return nil
+}
+
+// DiscoverNodeGroups registers and returns all asgs that have every one of the tags
+// a tag with an empty value matches any value
+func (c *CloudProvider) DiscoverNodeGroups(tags map[string]string) ([]cloudprovider.DiscoveredNodeGroup, error) {
+	var discovered []cloudprovider.DiscoveredNodeGroup
+	input := &autoscaling.DescribeAutoScalingGroupsInput{}
+	for {
+		result, err := c.service.DescribeAutoScalingGroups(input)
+		if err != nil {
+			log.Errorf("failed to describe asgs for auto discovery. err: %v", err)
+			return nil, err
+		}
+
+		for _, group := range result.AutoScalingGroups {
+			groupTags := make(map[string]string, len(group.Tags))
+			for _, tag := range group.Tags {
+				groupTags[awsapi.StringValue(tag.Key)] = awsapi.StringValue(tag.Value)
+			}
+			if !cloudprovider.HasTags(groupTags, tags) {
+				continue
+			}
+
+			id := awsapi.StringValue(group.AutoScalingGroupName)
+			if ng, ok := c.nodeGroups[id]; ok {
+				ng.asg = group
+			} else {
+				c.nodeGroups[id] = NewNodeGroup(id, group, c)
+			}
+			discovered = append(discovered, cloudprovider.DiscoveredNodeGroup{ID: id, Tags: groupTags})
+		}
+
+		if result.NextToken == nil {
+			break
+		}
+		input.NextToken = result.NextToken
+	}
+
+	c.updateMetrics()
+	return discovered, nil
+}
+
+// updateMetrics updates the metrics for each node group
+func (c *CloudProvider) updateMetrics() {
 	for _, nodeGroup := range c.nodeGroups {
 		metrics.CloudProviderMinSize.WithLabelValues(c.Name(), nodeGroup.ID()).Set(float64(nodeGroup.MinSize()))
 		metrics.CloudProviderMaxSize.WithLabelValues(c.Name(), nodeGroup.ID()).Set(float64(nodeGroup.MaxSize()))
 		metrics.CloudProviderTargetSize.WithLabelValues(c.Name(), nodeGroup.ID()).Set(float64(nodeGroup.TargetSize()))
 		metrics.CloudProviderSize.WithLabelValues(c.Name(), nodeGroup.ID()).Set(float64(nodeGroup.Size()))
 	}
-
-	return nil
 }
 
 // Refresh is called before every main loop and can be used to dynamically update cloud provider state.
@@ -106,7 +208,98 @@ func (c *CloudProvider) Refresh() error {
 		ids = append(ids, id)
 	}
 
-	return c.RegisterNodeGroups(ids...)
+	if err := c.RegisterNodeGroups(ids...); err != nil {
+		return err
+	}
+	if c.scaleInProtection {
+		c.protectInstances()
+	}
+	return nil
+}
+
+// maxSetInstanceProtectionInstances is the most instances SetInstanceProtection accepts in a single call
+const maxSetInstanceProtectionInstances = 50
+
+// protectInstances sets scale in protection on the InService instances of every node group that aren't protected yet,
+// so an asg never chooses an instance to terminate itself when its desired capacity is decreased. Instances that fail
+// to be protected are logged and tried again on the next refresh
+func (c *CloudProvider) protectInstances() {
+	for _, nodeGroup := range c.nodeGroups {
+		var unprotected []*autoscaling.Instance
+		for _, instance := range nodeGroup.asg.Instances {
+			if !awsapi.BoolValue(instance.ProtectedFromScaleIn) && awsapi.StringValue(instance.LifecycleState) == autoscaling.LifecycleStateInService {
+				unprotected = append(unprotected, instance)
+			}
+		}
+
+		for len(unprotected) > 0 {
+			batch := unprotected
+			if len(batch) > maxSetInstanceProtectionInstances {
+				batch = batch[:maxSetInstanceProtectionInstances]
+			}
+			unprotected = unprotected[len(batch):]
+			if err := nodeGroup.setInstanceProtection(batch, true); err != nil {
+				log.WithField("asg", nodeGroup.id).WithError(err).Warningf("failed to protect %v instances from scale in, retrying on the next refresh", len(batch))
+				continue
+			}
+			log.WithField("asg", nodeGroup.id).Debugf("protected %v instances from scale in", len(batch))
+		}
+	}
+}
+
+// CheckPermissions checks the credentials can describe the registered asgs and their instances at every endpoint. The
+// ec2 permission is checked with a dry run. The permissions to resize the asgs and terminate their instances can't be
+// checked without making changes, so aren't checked
+func (c *CloudProvider) CheckPermissions() error {
+	ids := make([]string, 0, len(c.nodeGroups))
+	for id := range c.nodeGroups {
+		ids = append(ids, id)
+	}
+	for endpoint, endpointIDs := range c.asgEndpoints(ids) {
+		_, err := c.autoscalingService(endpoint).DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: awsapi.StringSlice(endpointIDs),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to describe asgs: %v", err)
+		}
+
+		// a dry run that would have succeeded fails with the DryRunOperation error code
+		_, err = c.ec2Service(endpoint).DescribeInstances(&ec2.DescribeInstancesInput{DryRun: awsapi.Bool(true)})
+		if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != dryRunOperationErrorCode {
+			return fmt.Errorf("failed to describe instances: %v", err)
+		}
+	}
+	return nil
+}
+
+// queueLengthAttributes are the SQS queue attributes summed for the length of the queue
+// messages that are in flight are counted as they are still being processed
+var queueLengthAttributes = []string{
+	sqs.QueueAttributeNameApproximateNumberOfMessages,
+	sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+}
+
+// QueueLength returns the approximate number of messages in the SQS queue, including messages that are in flight
+func (c *CloudProvider) QueueLength(queueURL string) (int64, error) {
+	input := &sqs.GetQueueAttributesInput{
+		QueueUrl:       awsapi.String(queueURL),
+		AttributeNames: awsapi.StringSlice(queueLengthAttributes),
+	}
+
+	result, err := c.sqs_service.GetQueueAttributes(input)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get attributes of queue %v: %v", queueURL, err)
+	}
+
+	var length int64
+	for _, name := range queueLengthAttributes {
+		value, err := strconv.ParseInt(awsapi.StringValue(result.Attributes[name]), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse %v of queue %v: %v", name, queueURL, err)
+		}
+		length += value
+	}
+	return length, nil
 }
 
 type Instance struct {
@@ -123,7 +316,7 @@ func (c *CloudProvider) GetInstance(node *v1.Node) (cloudprovider.Instance, erro
 		InstanceIds: []*string{&id},
 	}
 
-	result, err := c.ec2_service.DescribeInstances(input)
+	result, err := c.ec2Service(c.nodeEndpoint(node)).DescribeInstances(input)
 
 	if err != nil {
 		log.Error("Error describing instance - ", err)
@@ -142,6 +335,17 @@ func (c *CloudProvider) GetInstance(node *v1.Node) (cloudprovider.Instance, erro
 	return instance, err
 }
 
+// nodeEndpoint returns the endpoint of the asg the node belongs to, the empty endpoint if it uses the cloud provider's
+// own clients or belongs to no asg
+func (c *CloudProvider) nodeEndpoint(node *v1.Node) Endpoint {
+	for id, endpoint := range c.nodeGroupEndpoints {
+		if nodeGroup, ok := c.nodeGroups[id]; ok && nodeGroup.Belongs(node) {
+			return endpoint
+		}
+	}
+	return Endpoint{}
+}
+
 func (i *Instance) InstantiationTime() time.Time {
 	return *i.ec2Instance.LaunchTime
 }
@@ -167,6 +371,11 @@ func NewNodeGroup(id string, asg *autoscaling.Group, provider *CloudProvider) *N
 	}
 }
 
+// service returns the autoscaling client of the asg's endpoint
+func (n *NodeGroup) service() autoscalingiface.AutoScalingAPI {
+	return n.provider.autoscalingService(n.provider.nodeGroupEndpoints[n.id])
+}
+
 func (n *NodeGroup) String() string {
 	return fmt.Sprint(n.asg)
 }
@@ -218,6 +427,8 @@ func (n *NodeGroup) IncreaseSize(delta int64) error {
 // DeleteNodes deletes nodes from this node group. Error is returned either on
 // failure or if the given node doesn't belong to this node group. This function
 // should wait until node group size is updated.
+// Every instance is terminated even if terminating another fails, e.g. because it is protected by a scale in lifecycle
+// hook. A *cloudprovider.PartialDeletionError is returned if only some of the instances were terminated
 func (n *NodeGroup) DeleteNodes(nodes ...*v1.Node) error {
 	if n.TargetSize() <= n.MinSize() {
 		return fmt.Errorf("min sized reached, nodes will not be deleted")
@@ -232,12 +443,17 @@ func (n *NodeGroup) DeleteNodes(nodes ...*v1.Node) error {
 			log.Debugf("instances in ASG: %v", n.Nodes())
 			return &cloudprovider.NodeNotInNodeGroup{NodeName: node.Name, ProviderID: node.Spec.ProviderID, NodeGroup: n.ID()}
 		}
+	}
 
+	var deleted, failed []*v1.Node
+	var terminateErr error
+	for _, node := range nodes {
 		// find which instance this is
 		var instanceID *string
 		for _, instance := range n.asg.Instances {
 			if node.Spec.ProviderID == instanceToProviderId(instance) {
 				instanceID = instance.InstanceId
+				n.clearInstanceProtection(instance, node)
 				break
 			}
 		}
@@ -247,13 +463,55 @@ func (n *NodeGroup) DeleteNodes(nodes ...*v1.Node) error {
 			ShouldDecrementDesiredCapacity: awsapi.Bool(true),
 		}
 
-		result, err := n.provider.service.TerminateInstanceInAutoScalingGroup(input)
+		result, err := n.service().TerminateInstanceInAutoScalingGroup(input)
 		if err != nil {
-			return fmt.Errorf("failed to terminate instance. err: %v", err)
+			log.WithError(err).Warningf("failed to terminate instance %v of node %v", awsapi.StringValue(instanceID), node.Name)
+			failed = append(failed, node)
+			if terminateErr == nil {
+				terminateErr = fmt.Errorf("failed to terminate instance. err: %v", err)
+			}
+			continue
 		}
+		deleted = append(deleted, node)
 		log.Debug(*result.Activity.Description)
 	}
 
+	if terminateErr != nil && len(deleted) > 0 {
+		return &cloudprovider.PartialDeletionError{Deleted: deleted, Failed: failed, Err: terminateErr}
+	}
+	return terminateErr
+}
+
+// clearInstanceProtection clears the scale in protection of an instance chosen to be terminated
+// terminating an instance isn't blocked by its protection, so a failure is only logged and the instance is still
+// terminated
+func (n *NodeGroup) clearInstanceProtection(instance *autoscaling.Instance, node *v1.Node) {
+	if !n.provider.scaleInProtection || !awsapi.BoolValue(instance.ProtectedFromScaleIn) {
+		return
+	}
+	if err := n.setInstanceProtection([]*autoscaling.Instance{instance}, false); err != nil {
+		log.WithField("asg", n.id).WithError(err).Warningf("failed to clear the scale in protection of instance %v of node %v, terminating it anyway", awsapi.StringValue(instance.InstanceId), node.Name)
+	}
+}
+
+// setInstanceProtection sets or clears the scale in protection of the instances, updating the cached instances of the
+// asg on success
+func (n *NodeGroup) setInstanceProtection(instances []*autoscaling.Instance, protected bool) error {
+	ids := make([]*string, 0, len(instances))
+	for _, instance := range instances {
+		ids = append(ids, instance.InstanceId)
+	}
+	_, err := n.service().SetInstanceProtection(&autoscaling.SetInstanceProtectionInput{
+		AutoScalingGroupName: awsapi.String(n.id),
+		InstanceIds:          ids,
+		ProtectedFromScaleIn: awsapi.Bool(protected),
+	})
+	if err != nil {
+		return err
+	}
+	for _, instance := range instances {
+		instance.ProtectedFromScaleIn = awsapi.Bool(protected)
+	}
 	return nil
 }
 
@@ -270,6 +528,27 @@ func (n *NodeGroup) Belongs(node *v1.Node) bool {
 	return false
 }
 
+// InstanceMetadata returns the metadata of the instance backing the node. The availability zone and lifecycle state
+// are taken from the instances of the auto scaling group, which doesn't include the instance type, so the instance type
+// is taken from the node's well known label set by the kubelet. Returns false if the node isn't in the node group
+func (n *NodeGroup) InstanceMetadata(node *v1.Node) (cloudprovider.InstanceMetadata, bool) {
+	for _, instance := range n.asg.Instances {
+		if node.Spec.ProviderID != instanceToProviderId(instance) {
+			continue
+		}
+		instanceType, ok := node.Labels[labelInstanceType]
+		if !ok {
+			instanceType = node.Labels[labelInstanceTypeBeta]
+		}
+		return cloudprovider.InstanceMetadata{
+			InstanceType:     instanceType,
+			AvailabilityZone: awsapi.StringValue(instance.AvailabilityZone),
+			LifecycleState:   awsapi.StringValue(instance.LifecycleState),
+		}, true
+	}
+	return cloudprovider.InstanceMetadata{}, false
+}
+
 // DecreaseTargetSize decreases the target size of the node group. This function
 // doesn't permit to delete any existing node and can be used only to reduce the
 // request for new nodes that have not been yet fulfilled. Delta should be negative.
@@ -310,6 +589,6 @@ func (n *NodeGroup) setASGDesiredSize(newSize int64) error {
 	log.WithField("asg", n.id).Debugf("SetDesiredCapacity: %v", newSize)
 	log.WithField("asg", n.id).Debugf("CurrentSize: %v", n.Size())
 	log.WithField("asg", n.id).Debugf("CurrentTargetSize: %v", n.TargetSize())
-	_, err := n.provider.service.SetDesiredCapacity(input)
+	_, err := n.service().SetDesiredCapacity(input)
 	return err
 }
@@ -2,6 +2,11 @@ package aws
 
 import (
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
 	"time"
 
 	"github.com/atlassian/escalator/pkg/cloudprovider"
@@ -10,10 +15,16 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sqs"
 	log "github.com/sirupsen/logrus"
 )
 
+// regionPattern matches the names of the AWS regions, e.g. us-west-2 and us-gov-east-1
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
 // Builder builds the aws cloud provider
 type Builder struct {
 	ProviderOpts cloudprovider.BuildOpts
@@ -22,18 +33,11 @@ type Builder struct {
 
 // Build the cloud provider
 func (b Builder) Build() (cloudprovider.CloudProvider, error) {
-	sess, err := session.NewSession()
+	sess, creds, err := b.newSession()
 	if err != nil {
 		return nil, err
 	}
 
-	var creds *credentials.Credentials
-
-	// If assume role is enabled, create credentials with the ARN
-	if b.assumeRoleEnabled() {
-		creds = stscreds.NewCredentials(sess, b.Opts.AssumeRoleARN, setAssumeRoleName)
-	}
-
 	// Create the autoscaling service
 	service := autoscaling.New(sess, &aws.Config{
 		Credentials: creds,
@@ -41,10 +45,31 @@ func (b Builder) Build() (cloudprovider.CloudProvider, error) {
 	ec2_service := ec2.New(sess, &aws.Config{
 		Credentials: creds,
 	})
+	sqs_service := sqs.New(sess, &aws.Config{
+		Credentials: creds,
+	})
 	cloud := &CloudProvider{
 		service:     service,
 		ec2_service: ec2_service,
+		sqs_service: sqs_service,
 		nodeGroups:  make(map[string]*NodeGroup, len(b.ProviderOpts.NodeGroupIDs)),
+
+		nodeGroupEndpoints: b.nodeGroupEndpoints(),
+		endpointServices:   make(map[Endpoint]endpointServices),
+
+		scaleInProtection: b.Opts.ScaleInProtection,
+	}
+
+	// Create the clients of the asgs at other endpoints, shared by the asgs at the same endpoint
+	for _, endpoint := range cloud.nodeGroupEndpoints {
+		if _, ok := cloud.endpointServices[endpoint]; ok {
+			continue
+		}
+		config := endpointConfig(creds, endpoint)
+		cloud.endpointServices[endpoint] = endpointServices{
+			service:     autoscaling.New(sess, config),
+			ec2_service: ec2.New(sess, config),
+		}
 	}
 
 	// Register the node groups
@@ -63,11 +88,149 @@ func (b Builder) Build() (cloudprovider.CloudProvider, error) {
 	return cloud, nil
 }
 
+// BuildCloudWatch creates a CloudWatch client with the same session and credentials as the cloud provider
+func (b Builder) BuildCloudWatch() (cloudwatchiface.CloudWatchAPI, error) {
+	sess, creds, err := b.newSession()
+	if err != nil {
+		return nil, err
+	}
+	return cloudwatch.New(sess, &aws.Config{
+		Credentials: creds,
+	}), nil
+}
+
+// newSession creates the session for the AWS clients
+// the credentials are nil, i.e. the session's default credentials, unless assume role is enabled
+func (b Builder) newSession() (*session.Session, *credentials.Credentials, error) {
+	if err := b.validateEndpoints(); err != nil {
+		return nil, nil, err
+	}
+
+	sessionOpts := session.Options{
+		Config: aws.Config{
+			HTTPClient: newHTTPClient(),
+		},
+	}
+	if len(b.Opts.Region) > 0 {
+		sessionOpts.Config.Region = aws.String(b.Opts.Region)
+	}
+	if len(b.Opts.Endpoint) > 0 {
+		sessionOpts.Config.Endpoint = aws.String(b.Opts.Endpoint)
+	}
+	if b.customCABundleEnabled() {
+		bundle, err := os.Open(b.Opts.CABundle)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open ca bundle: %v", err)
+		}
+		defer bundle.Close()
+		sessionOpts.CustomCABundle = bundle
+	}
+
+	sess, err := session.NewSessionWithOptions(sessionOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var creds *credentials.Credentials
+
+	// If assume role is enabled, create credentials with the ARN
+	if b.assumeRoleEnabled() {
+		creds = stscreds.NewCredentials(sess, b.Opts.AssumeRoleARN, setAssumeRoleName)
+	}
+	return sess, creds, nil
+}
+
+// validateEndpoints checks the region and endpoint of the clients and of every asg override are well formed
+func (b Builder) validateEndpoints() error {
+	if err := validateEndpoint(Endpoint{Region: b.Opts.Region, Endpoint: b.Opts.Endpoint}); err != nil {
+		return err
+	}
+	for id, endpoint := range b.Opts.NodeGroupEndpoints {
+		if err := validateEndpoint(endpoint); err != nil {
+			return fmt.Errorf("asg %v: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// validateEndpoint checks the region is the name of a region and the endpoint is an http or https url, the empty
+// fields aren't checked
+func validateEndpoint(endpoint Endpoint) error {
+	if len(endpoint.Region) > 0 && !regionPattern.MatchString(endpoint.Region) {
+		return fmt.Errorf("invalid aws region %q, expected a region such as us-west-2", endpoint.Region)
+	}
+	if len(endpoint.Endpoint) > 0 {
+		u, err := url.Parse(endpoint.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return fmt.Errorf("invalid aws endpoint %q, expected an http or https url such as http://localhost:4566", endpoint.Endpoint)
+		}
+	}
+	return nil
+}
+
+// nodeGroupEndpoints returns the endpoints of the asgs whose override differs from the region and endpoint of the
+// cloud provider's own clients, the empty fields of an override filled in from them
+func (b Builder) nodeGroupEndpoints() map[string]Endpoint {
+	defaultEndpoint := Endpoint{Region: b.Opts.Region, Endpoint: b.Opts.Endpoint}
+	endpoints := make(map[string]Endpoint)
+	for id, endpoint := range b.Opts.NodeGroupEndpoints {
+		if len(endpoint.Region) == 0 {
+			endpoint.Region = defaultEndpoint.Region
+		}
+		if len(endpoint.Endpoint) == 0 {
+			endpoint.Endpoint = defaultEndpoint.Endpoint
+		}
+		if endpoint != defaultEndpoint {
+			endpoints[id] = endpoint
+		}
+	}
+	return endpoints
+}
+
+// endpointConfig returns the config of the clients of the endpoint, the region and endpoint of the session are kept
+// where the endpoint's are empty
+func endpointConfig(creds *credentials.Credentials, endpoint Endpoint) *aws.Config {
+	config := &aws.Config{
+		Credentials: creds,
+	}
+	if len(endpoint.Region) > 0 {
+		config.Region = aws.String(endpoint.Region)
+	}
+	if len(endpoint.Endpoint) > 0 {
+		config.Endpoint = aws.String(endpoint.Endpoint)
+	}
+	return config
+}
+
 // assumeRoleEnabled returns whether assume role is enabled
 func (b Builder) assumeRoleEnabled() bool {
 	return len(b.Opts.AssumeRoleARN) > 0
 }
 
+// customCABundleEnabled returns whether a custom ca bundle is set
+func (b Builder) customCABundleEnabled() bool {
+	return len(b.Opts.CABundle) > 0
+}
+
+// newHTTPClient creates the http client used by the AWS clients
+// the proxy is always taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, including when the
+// session replaces the transport's certificate authorities with a custom ca bundle
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+}
+
 // setAssumeRoleName allows setting of a custom RoleSessionName for assume role
 func setAssumeRoleName(provider *stscreds.AssumeRoleProvider) {
 	provider.RoleSessionName = fmt.Sprintf("%v-%d", AssumeRoleNamePrefix, time.Now().UTC().UnixNano())
@@ -1,8 +1,11 @@
 package aws
 
 import (
-	"github.com/stretchr/testify/assert"
+	"net/http"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBuilder_assumeRoleEnabled(t *testing.T) {
@@ -26,3 +29,108 @@ func TestBuilder_assumeRoleEnabled(t *testing.T) {
 	builder = &Builder{}
 	assert.False(t, builder.assumeRoleEnabled())
 }
+
+func TestBuilder_customCABundleEnabled(t *testing.T) {
+	builder := &Builder{
+		Opts: Opts{
+			CABundle: "/etc/ssl/certs/proxy-ca.pem",
+		},
+	}
+	assert.True(t, builder.customCABundleEnabled())
+
+	builder = &Builder{}
+	assert.False(t, builder.customCABundleEnabled())
+}
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	// the proxy is read from the environment by http.ProxyFromEnvironment
+	transport, ok := newHTTPClient().Transport.(*http.Transport)
+	require.True(t, ok)
+	assert.NotNil(t, transport.Proxy)
+}
+
+func TestBuilder_BuildMissingCABundle(t *testing.T) {
+	builder := Builder{
+		Opts: Opts{
+			CABundle: "/does/not/exist.pem",
+		},
+	}
+	_, err := builder.Build()
+	assert.Error(t, err)
+}
+
+func TestBuilder_BuildCloudWatchMissingCABundle(t *testing.T) {
+	builder := Builder{
+		Opts: Opts{
+			CABundle: "/does/not/exist.pem",
+		},
+	}
+	_, err := builder.BuildCloudWatch()
+	assert.Error(t, err)
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		wantErr  bool
+	}{
+		{"empty", Endpoint{}, false},
+		{"region", Endpoint{Region: "us-west-2"}, false},
+		{"gov cloud region", Endpoint{Region: "us-gov-east-1"}, false},
+		{"availability zone", Endpoint{Region: "us-west-2a"}, true},
+		{"upper case region", Endpoint{Region: "US-WEST-2"}, true},
+		{"http endpoint", Endpoint{Endpoint: "http://localhost:4566"}, false},
+		{"https endpoint", Endpoint{Region: "us-east-1", Endpoint: "https://autoscaling.example.com"}, false},
+		{"endpoint without scheme", Endpoint{Endpoint: "localhost:4566"}, true},
+		{"endpoint without host", Endpoint{Endpoint: "http://"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEndpoint(tt.endpoint)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBuilder_BuildInvalidEndpoint(t *testing.T) {
+	_, err := Builder{Opts: Opts{Region: "west"}}.Build()
+	assert.Error(t, err)
+
+	_, err = Builder{Opts: Opts{NodeGroupEndpoints: map[string]Endpoint{"asg": {Endpoint: "localhost"}}}}.BuildCloudWatch()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "asg")
+}
+
+func TestBuilder_nodeGroupEndpoints(t *testing.T) {
+	builder := Builder{
+		Opts: Opts{
+			Region:   "us-west-2",
+			Endpoint: "http://localhost:4566",
+			NodeGroupEndpoints: map[string]Endpoint{
+				"same":     {Region: "us-west-2"},
+				"empty":    {},
+				"region":   {Region: "us-east-1"},
+				"endpoint": {Endpoint: "http://localhost:4567"},
+			},
+		},
+	}
+	assert.Equal(t, map[string]Endpoint{
+		"region":   {Region: "us-east-1", Endpoint: "http://localhost:4566"},
+		"endpoint": {Region: "us-west-2", Endpoint: "http://localhost:4567"},
+	}, builder.nodeGroupEndpoints())
+}
+
+func TestEndpointConfig(t *testing.T) {
+	config := endpointConfig(nil, Endpoint{Region: "us-east-1"})
+	assert.Equal(t, "us-east-1", *config.Region)
+	assert.Nil(t, config.Endpoint)
+
+	config = endpointConfig(nil, Endpoint{Endpoint: "http://localhost:4566"})
+	assert.Nil(t, config.Region)
+	assert.Equal(t, "http://localhost:4566", *config.Endpoint)
+}
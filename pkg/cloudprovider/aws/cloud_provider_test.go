@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"github.com/atlassian/escalator/pkg/test"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/api/core/v1"
 	"testing"
@@ -172,6 +174,63 @@ func TestCloudProvider_RegisterNodeGroups(t *testing.T) {
 	}
 }
 
+func TestCloudProvider_NodeGroupEndpoints(t *testing.T) {
+	disasterRecovery := Endpoint{Region: "us-east-2"}
+	service := &test.MockAutoscalingService{
+		DescribeAutoScalingGroupsOutput: &autoscaling.DescribeAutoScalingGroupsOutput{
+			AutoScalingGroups: []*autoscaling.Group{{AutoScalingGroupName: aws.String("primary")}},
+		},
+		SetDesiredCapacityErr: fmt.Errorf("wrong region"),
+	}
+	ec2_service := &test.MockEc2Service{DescribeInstancesErr: fmt.Errorf("wrong region")}
+	drService := &test.MockAutoscalingService{
+		DescribeAutoScalingGroupsOutput: &autoscaling.DescribeAutoScalingGroupsOutput{
+			AutoScalingGroups: []*autoscaling.Group{{
+				AutoScalingGroupName: aws.String("dr"),
+				DesiredCapacity:      aws.Int64(1),
+				MaxSize:              aws.Int64(3),
+				Instances: []*autoscaling.Instance{
+					{AvailabilityZone: aws.String("us-east-2a"), InstanceId: aws.String("i-dr")},
+				},
+			}},
+		},
+		SetDesiredCapacityOutput: &autoscaling.SetDesiredCapacityOutput{},
+	}
+	drEC2Service := &test.MockEc2Service{
+		DescribeInstancesOutput: &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{{}}}}},
+	}
+
+	awsCloudProvider := &CloudProvider{
+		service:            service,
+		ec2_service:        ec2_service,
+		nodeGroups:         make(map[string]*NodeGroup),
+		nodeGroupEndpoints: map[string]Endpoint{"dr": disasterRecovery},
+		endpointServices: map[Endpoint]endpointServices{
+			disasterRecovery: {service: drService, ec2_service: drEC2Service},
+		},
+	}
+	assert.NoError(t, awsCloudProvider.RegisterNodeGroups("primary", "dr"))
+
+	// each asg is described at its own endpoint
+	_, ok := awsCloudProvider.GetNodeGroup("primary")
+	assert.True(t, ok)
+	nodeGroup, ok := awsCloudProvider.GetNodeGroup("dr")
+	assert.True(t, ok)
+
+	// the asg is resized and its instances described at its endpoint
+	assert.NoError(t, nodeGroup.IncreaseSize(1))
+	_, err := awsCloudProvider.GetInstance(&v1.Node{Spec: v1.NodeSpec{ProviderID: "aws:///us-east-2a/i-dr"}})
+	assert.NoError(t, err)
+
+	// nodes of no asg at another endpoint are described with the cloud provider's own clients
+	_, err = awsCloudProvider.GetInstance(&v1.Node{Spec: v1.NodeSpec{ProviderID: "aws:///us-west-2a/i-primary"}})
+	assert.Error(t, err)
+
+	// a failure at any endpoint fails the permission check
+	drService.DescribeAutoScalingGroupsErr = awserr.New("AccessDenied", "not authorized", nil)
+	assert.Error(t, awsCloudProvider.CheckPermissions())
+}
+
 func TestCloudProvider_Refresh(t *testing.T) {
 	nodeGroups := []string{"1"}
 	initialDesiredCapacity := int64(1)
@@ -222,6 +281,127 @@ func TestCloudProvider_Refresh(t *testing.T) {
 	}
 }
 
+func TestCloudProvider_RefreshScaleInProtection(t *testing.T) {
+	instances := []*autoscaling.Instance{
+		{InstanceId: aws.String("instance-1"), LifecycleState: aws.String(autoscaling.LifecycleStateInService)},
+		{InstanceId: aws.String("instance-2"), LifecycleState: aws.String(autoscaling.LifecycleStateInService), ProtectedFromScaleIn: aws.Bool(true)},
+		{InstanceId: aws.String("instance-3"), LifecycleState: aws.String(autoscaling.LifecycleStatePending)},
+	}
+	for i := 4; i <= 55; i++ {
+		instances = append(instances, &autoscaling.Instance{
+			InstanceId:     aws.String(fmt.Sprintf("instance-%v", i)),
+			LifecycleState: aws.String(autoscaling.LifecycleStateInService),
+		})
+	}
+	service := &test.MockAutoscalingService{
+		DescribeAutoScalingGroupsOutput: &autoscaling.DescribeAutoScalingGroupsOutput{
+			AutoScalingGroups: []*autoscaling.Group{{AutoScalingGroupName: aws.String("asg-1"), Instances: instances}},
+		},
+		SetInstanceProtectionErr: fmt.Errorf("throttled"),
+	}
+	awsCloudProvider, err := newMockCloudProvider([]string{"asg-1"}, service, nil)
+	assert.NoError(t, err)
+
+	// protection is opt in
+	assert.NoError(t, awsCloudProvider.Refresh())
+	assert.Empty(t, service.SetInstanceProtectionInputs)
+
+	// failing to protect the instances doesn't fail the refresh, and they are tried again
+	awsCloudProvider.scaleInProtection = true
+	assert.NoError(t, awsCloudProvider.Refresh())
+	assert.Len(t, service.SetInstanceProtectionInputs, 2)
+	assert.False(t, aws.BoolValue(instances[0].ProtectedFromScaleIn))
+
+	// only the unprotected InService instances are protected, at most 50 at a time
+	service.SetInstanceProtectionErr = nil
+	service.SetInstanceProtectionInputs = nil
+	assert.NoError(t, awsCloudProvider.Refresh())
+	assert.Len(t, service.SetInstanceProtectionInputs, 2)
+	first := service.SetInstanceProtectionInputs[0]
+	assert.Equal(t, "asg-1", aws.StringValue(first.AutoScalingGroupName))
+	assert.True(t, aws.BoolValue(first.ProtectedFromScaleIn))
+	assert.Len(t, first.InstanceIds, 50)
+	assert.Equal(t, "instance-1", aws.StringValue(first.InstanceIds[0]))
+	assert.Equal(t, "instance-4", aws.StringValue(first.InstanceIds[1]))
+	assert.Len(t, service.SetInstanceProtectionInputs[1].InstanceIds, 3)
+	assert.True(t, aws.BoolValue(instances[0].ProtectedFromScaleIn))
+	assert.False(t, aws.BoolValue(instances[2].ProtectedFromScaleIn))
+
+	// protected instances aren't protected again
+	service.SetInstanceProtectionInputs = nil
+	assert.NoError(t, awsCloudProvider.Refresh())
+	assert.Empty(t, service.SetInstanceProtectionInputs)
+}
+
+func TestCloudProvider_DiscoverNodeGroups(t *testing.T) {
+	tag := func(key, value string) *autoscaling.TagDescription {
+		return &autoscaling.TagDescription{Key: aws.String(key), Value: aws.String(value)}
+	}
+	resp := &autoscaling.DescribeAutoScalingGroupsOutput{
+		AutoScalingGroups: []*autoscaling.Group{
+			{
+				AutoScalingGroupName: aws.String("1"),
+				Tags:                 []*autoscaling.TagDescription{tag("escalator", "enabled"), tag("cluster", "a")},
+			},
+			{
+				AutoScalingGroupName: aws.String("2"),
+				Tags:                 []*autoscaling.TagDescription{tag("escalator", "enabled"), tag("cluster", "b")},
+			},
+			{
+				AutoScalingGroupName: aws.String("3"),
+				Tags:                 []*autoscaling.TagDescription{tag("cluster", "a")},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		tags map[string]string
+		ids  []string
+	}{
+		{
+			"tag with any value",
+			map[string]string{"escalator": ""},
+			[]string{"1", "2"},
+		},
+		{
+			"tags with values",
+			map[string]string{"escalator": "enabled", "cluster": "a"},
+			[]string{"1"},
+		},
+		{
+			"no matching node groups",
+			map[string]string{"cluster": "c"},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			awsCloudProvider, err := newMockCloudProvider(nil, nil, nil)
+			assert.Nil(t, err)
+			awsCloudProvider.service = &test.MockAutoscalingService{DescribeAutoScalingGroupsOutput: resp}
+
+			discovered, err := awsCloudProvider.DiscoverNodeGroups(tt.tags)
+			assert.Nil(t, err)
+
+			var ids []string
+			for _, nodeGroup := range discovered {
+				ids = append(ids, nodeGroup.ID)
+				assert.Equal(t, "enabled", nodeGroup.Tags["escalator"])
+			}
+			assert.Equal(t, tt.ids, ids)
+
+			// the discovered node groups are registered
+			assert.Len(t, awsCloudProvider.NodeGroups(), len(tt.ids))
+			for _, id := range tt.ids {
+				_, ok := awsCloudProvider.GetNodeGroup(id)
+				assert.True(t, ok)
+			}
+		})
+	}
+}
+
 func TestCloudProvider_GetInstance(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -279,3 +459,94 @@ func TestCloudProvider_GetInstance(t *testing.T) {
 		})
 	}
 }
+
+func TestCloudProvider_CheckPermissions(t *testing.T) {
+	tests := []struct {
+		name        string
+		asgErr      error
+		instanceErr error
+		wantErr     bool
+	}{
+		{"permitted", nil, awserr.New(dryRunOperationErrorCode, "Request would have succeeded", nil), false},
+		{"can't describe asgs", awserr.New("AccessDenied", "not authorized", nil), nil, true},
+		{"can't describe instances", nil, awserr.New("UnauthorizedOperation", "not authorized", nil), true},
+		{"dry run not performed", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &test.MockAutoscalingService{
+				DescribeAutoScalingGroupsOutput: &autoscaling.DescribeAutoScalingGroupsOutput{
+					AutoScalingGroups: []*autoscaling.Group{{AutoScalingGroupName: aws.String("1")}},
+				},
+			}
+			ec2_service := &test.MockEc2Service{DescribeInstancesErr: tt.instanceErr}
+			awsCloudProvider, err := newMockCloudProvider([]string{"1"}, service, ec2_service)
+			assert.NoError(t, err)
+
+			service.DescribeAutoScalingGroupsErr = tt.asgErr
+			err = awsCloudProvider.CheckPermissions()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCloudProvider_QueueLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		response *sqs.GetQueueAttributesOutput
+		err      error
+		length   int64
+		wantErr  bool
+	}{
+		{
+			"error getting queue attributes",
+			nil,
+			fmt.Errorf("queue does not exist"),
+			0,
+			true,
+		},
+		{
+			"missing attribute",
+			&sqs.GetQueueAttributesOutput{Attributes: map[string]*string{
+				sqs.QueueAttributeNameApproximateNumberOfMessages: aws.String("10"),
+			}},
+			nil,
+			0,
+			true,
+		},
+		{
+			"visible and in flight messages",
+			&sqs.GetQueueAttributesOutput{Attributes: map[string]*string{
+				sqs.QueueAttributeNameApproximateNumberOfMessages:           aws.String("10"),
+				sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible: aws.String("5"),
+			}},
+			nil,
+			15,
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			awsCloudProvider := &CloudProvider{
+				sqs_service: &test.MockSQSService{
+					GetQueueAttributesOutput: tt.response,
+					GetQueueAttributesErr:    tt.err,
+				},
+			}
+
+			length, err := awsCloudProvider.QueueLength("https://sqs.us-east-1.amazonaws.com/123456789012/jobs")
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.length, length)
+		})
+	}
+}
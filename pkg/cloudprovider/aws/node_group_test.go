@@ -395,6 +395,106 @@ func TestNodeGroup_DeleteNodes(t *testing.T) {
 	}
 }
 
+func TestNodeGroup_DeleteNodesPartialFailure(t *testing.T) {
+	asg := &autoscaling.Group{
+		AutoScalingGroupName: aws.String("asg-1"),
+		MinSize:              aws.Int64(int64(0)),
+		MaxSize:              aws.Int64(int64(10)),
+		DesiredCapacity:      aws.Int64(int64(4)),
+		Instances: []*autoscaling.Instance{
+			{InstanceId: aws.String("instance-1"), AvailabilityZone: aws.String("us-east-1a")},
+			{InstanceId: aws.String("instance-2"), AvailabilityZone: aws.String("us-east-1a")},
+			{InstanceId: aws.String("instance-3"), AvailabilityZone: aws.String("us-east-1a")},
+			{InstanceId: aws.String("instance-4"), AvailabilityZone: aws.String("us-east-1a")},
+		},
+	}
+	buildNode := func(instance string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metaV1.ObjectMeta{Name: instance},
+			Spec:       v1.NodeSpec{ProviderID: "aws:///us-east-1a/" + instance},
+		}
+	}
+	mockAutoScalingService := test.MockAutoscalingService{
+		DescribeAutoScalingGroupsOutput: &autoscaling.DescribeAutoScalingGroupsOutput{
+			AutoScalingGroups: []*autoscaling.Group{asg},
+		},
+		TerminateInstanceInAutoScalingGroupOutput: &autoscaling.TerminateInstanceInAutoScalingGroupOutput{
+			Activity: &autoscaling.Activity{
+				Description: aws.String("successfully terminated instance"),
+			},
+		},
+		TerminateInstanceInAutoScalingGroupErrs: map[string]error{
+			"instance-2": errors.New("instance is protected from scale in"),
+			"instance-3": errors.New("instance is protected from scale in"),
+		},
+	}
+	awsCloudProvider, err := newMockCloudProvider([]string{"asg-1"}, &mockAutoScalingService, nil)
+	require.NoError(t, err)
+	nodeGroup, ok := awsCloudProvider.GetNodeGroup("asg-1")
+	require.True(t, ok)
+
+	// the instances after a failed termination are still terminated
+	err = nodeGroup.DeleteNodes(buildNode("instance-1"), buildNode("instance-2"), buildNode("instance-3"), buildNode("instance-4"))
+	require.Error(t, err)
+	partial, ok := err.(*cloudprovider.PartialDeletionError)
+	require.True(t, ok)
+	assert.Equal(t, []*v1.Node{buildNode("instance-1"), buildNode("instance-4")}, partial.Deleted)
+	assert.Equal(t, []*v1.Node{buildNode("instance-2"), buildNode("instance-3")}, partial.Failed)
+	assert.EqualError(t, err, "only deleted 2 of 4 nodes: failed to terminate instance. err: instance is protected from scale in")
+
+	// every termination failing isn't partial
+	err = nodeGroup.DeleteNodes(buildNode("instance-2"), buildNode("instance-3"))
+	assert.EqualError(t, err, "failed to terminate instance. err: instance is protected from scale in")
+}
+
+func TestNodeGroup_DeleteNodesScaleInProtection(t *testing.T) {
+	asg := &autoscaling.Group{
+		AutoScalingGroupName: aws.String("asg-1"),
+		MinSize:              aws.Int64(int64(0)),
+		MaxSize:              aws.Int64(int64(10)),
+		DesiredCapacity:      aws.Int64(int64(3)),
+		Instances: []*autoscaling.Instance{
+			{InstanceId: aws.String("instance-1"), AvailabilityZone: aws.String("us-east-1a"), ProtectedFromScaleIn: aws.Bool(true)},
+			{InstanceId: aws.String("instance-2"), AvailabilityZone: aws.String("us-east-1a"), ProtectedFromScaleIn: aws.Bool(true)},
+			{InstanceId: aws.String("instance-3"), AvailabilityZone: aws.String("us-east-1a")},
+		},
+	}
+	buildNode := func(instance string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metaV1.ObjectMeta{Name: instance},
+			Spec:       v1.NodeSpec{ProviderID: "aws:///us-east-1a/" + instance},
+		}
+	}
+	mockAutoScalingService := test.MockAutoscalingService{
+		DescribeAutoScalingGroupsOutput: &autoscaling.DescribeAutoScalingGroupsOutput{
+			AutoScalingGroups: []*autoscaling.Group{asg},
+		},
+		TerminateInstanceInAutoScalingGroupOutput: &autoscaling.TerminateInstanceInAutoScalingGroupOutput{
+			Activity: &autoscaling.Activity{
+				Description: aws.String("successfully terminated instance"),
+			},
+		},
+	}
+	awsCloudProvider, err := newMockCloudProvider([]string{"asg-1"}, &mockAutoScalingService, nil)
+	require.NoError(t, err)
+	awsCloudProvider.scaleInProtection = true
+	nodeGroup, ok := awsCloudProvider.GetNodeGroup("asg-1")
+	require.True(t, ok)
+
+	// only the protection of the chosen protected instances is cleared
+	require.NoError(t, nodeGroup.DeleteNodes(buildNode("instance-1"), buildNode("instance-3")))
+	require.Len(t, mockAutoScalingService.SetInstanceProtectionInputs, 1)
+	input := mockAutoScalingService.SetInstanceProtectionInputs[0]
+	assert.Equal(t, []*string{aws.String("instance-1")}, input.InstanceIds)
+	assert.False(t, aws.BoolValue(input.ProtectedFromScaleIn))
+	assert.True(t, aws.BoolValue(asg.Instances[1].ProtectedFromScaleIn))
+
+	// the instance is still terminated when clearing its protection fails
+	mockAutoScalingService.SetInstanceProtectionErr = errors.New("throttled")
+	assert.NoError(t, nodeGroup.DeleteNodes(buildNode("instance-2")))
+	assert.Len(t, mockAutoScalingService.SetInstanceProtectionInputs, 2)
+}
+
 func TestNodeGroup_DecreaseSize(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -478,3 +578,68 @@ func TestNodeGroup_DecreaseSize(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeGroup_InstanceMetadata(t *testing.T) {
+	asg := &autoscaling.Group{
+		Instances: []*autoscaling.Instance{
+			{
+				InstanceId:       aws.String("i-1"),
+				AvailabilityZone: aws.String("us-east-1a"),
+				LifecycleState:   aws.String(autoscaling.LifecycleStateInService),
+			},
+			{
+				InstanceId:       aws.String("i-2"),
+				AvailabilityZone: aws.String("us-east-1b"),
+				LifecycleState:   aws.String(autoscaling.LifecycleStateTerminatingWait),
+			},
+		},
+	}
+	nodeGroup := NewNodeGroup("nodegroup", asg, &CloudProvider{})
+
+	buildNode := func(providerID string, labels map[string]string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metaV1.ObjectMeta{Labels: labels},
+			Spec:       v1.NodeSpec{ProviderID: providerID},
+		}
+	}
+
+	tests := []struct {
+		name string
+		node *v1.Node
+		want cloudprovider.InstanceMetadata
+		ok   bool
+	}{
+		{
+			"instance type label",
+			buildNode("aws:///us-east-1a/i-1", map[string]string{labelInstanceType: "m5.large", labelInstanceTypeBeta: "m4.large"}),
+			cloudprovider.InstanceMetadata{InstanceType: "m5.large", AvailabilityZone: "us-east-1a", LifecycleState: "InService"},
+			true,
+		},
+		{
+			"beta instance type label",
+			buildNode("aws:///us-east-1b/i-2", map[string]string{labelInstanceTypeBeta: "m4.large"}),
+			cloudprovider.InstanceMetadata{InstanceType: "m4.large", AvailabilityZone: "us-east-1b", LifecycleState: "Terminating:Wait"},
+			true,
+		},
+		{
+			"no instance type label",
+			buildNode("aws:///us-east-1a/i-1", nil),
+			cloudprovider.InstanceMetadata{AvailabilityZone: "us-east-1a", LifecycleState: "InService"},
+			true,
+		},
+		{
+			"not in node group",
+			buildNode("aws:///us-east-1a/i-3", map[string]string{labelInstanceType: "m5.large"}),
+			cloudprovider.InstanceMetadata{},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := nodeGroup.InstanceMetadata(tt.node)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
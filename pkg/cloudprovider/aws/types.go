@@ -6,4 +6,25 @@ const AssumeRoleNamePrefix = "atlassian-escalator"
 // Opts includes options for AWS cloud provider
 type Opts struct {
 	AssumeRoleARN string
+	// CABundle is the path to a PEM file of the certificate authorities trusted by the AWS clients
+	// The system certificate authorities are trusted if empty
+	CABundle string
+	// ScaleInProtection sets scale in protection on the instances of the asgs, only clearing it from the instances
+	// chosen to be terminated, so the asgs never choose which instance to terminate themselves
+	ScaleInProtection bool
+	// Region is the region of the AWS clients, e.g. us-west-2
+	// The region of the AWS SDK default configuration, such as the AWS_REGION environment variable, is used if empty
+	Region string
+	// Endpoint is the URL the AWS clients send requests to in place of the AWS endpoints, e.g. a mock such as localstack
+	// The AWS endpoints of the region are used if empty
+	Endpoint string
+	// NodeGroupEndpoints override the region and endpoint of the clients of the asgs by name, e.g. for node groups in
+	// another region. The empty fields of an override, and asgs without one, use Region and Endpoint
+	NodeGroupEndpoints map[string]Endpoint
+}
+
+// Endpoint is the region and endpoint the AWS clients of some asgs send requests to
+type Endpoint struct {
+	Region   string
+	Endpoint string
 }
@@ -26,9 +26,35 @@ type CloudProvider interface {
 	// In particular the list of node groups returned by NodeGroups can change as a result of CloudProvider.Refresh().
 	Refresh() error
 
+	// DiscoverNodeGroups registers and returns all node groups that have every one of the tags
+	// a tag with an empty value matches any value
+	DiscoverNodeGroups(tags map[string]string) ([]DiscoveredNodeGroup, error)
+
 	GetInstance(node *v1.Node) (Instance, error)
 }
 
+// QueueLengthProvider is optionally implemented by cloud providers that can report the length of a message queue
+// it is used by node groups that scale on the length of a queue
+type QueueLengthProvider interface {
+	// QueueLength returns the approximate number of messages in the queue, including messages being processed
+	QueueLength(queueURL string) (int64, error)
+}
+
+// PermissionChecker is optionally implemented by cloud providers that can check their credentials are valid and have
+// the permissions escalator needs without changing anything. It is used to surface credential problems at startup
+// rather than on the first scale action
+type PermissionChecker interface {
+	// CheckPermissions returns an error describing the first missing credential or permission found
+	CheckPermissions() error
+}
+
+// InstanceMetadataProvider is optionally implemented by node groups that know the metadata of the instances backing
+// their nodes. It is used to add the metadata to the logs of scale actions and the node level metrics
+type InstanceMetadataProvider interface {
+	// InstanceMetadata returns the metadata of the instance backing the node, false if it isn't known
+	InstanceMetadata(node *v1.Node) (InstanceMetadata, bool)
+}
+
 // Instance contains convenience functions for extracting common information from CP instances
 type Instance interface {
 	// InstantiationTime gets the time the resource was instantiated
@@ -62,9 +88,10 @@ type NodeGroup interface {
 	// Size is the number of instances in the nodegroup at the current time
 	Size() int64
 
-	// IncreaseSize increases the size of the node group. To delete a node you need
-	// to explicitly name it and use DeleteNode. This function should wait until
-	// node group size is updated.
+	// IncreaseSize requests delta more nodes for the node group. Node groups backed by a fixed size group
+	// increase its target size, just in time provisioners create delta individual nodes. To delete a node
+	// you need to explicitly name it and use DeleteNode. This function should wait until node group size
+	// is updated. A *PartialIncreaseError is returned if only some of the nodes were added.
 	IncreaseSize(delta int64) error
 
 	// Belongs determines if the node belongs in the current node group
@@ -72,7 +99,8 @@ type NodeGroup interface {
 
 	// DeleteNodes deletes nodes from this node group. Error is returned either on
 	// failure or if the given node doesn't belong to this node group. This function
-	// should wait until node group size is updated.
+	// should wait until node group size is updated. A *PartialDeletionError is returned
+	// if only some of the nodes were deleted.
 	DeleteNodes(...*v1.Node) error
 
 	// DecreaseTargetSize decreases the target size of the node group. This function
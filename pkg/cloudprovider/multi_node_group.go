@@ -0,0 +1,255 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/api/core/v1"
+)
+
+// MultiNodeGroup combines several cloud provider node groups into a single logical node group
+// sizes are aggregated across the member groups, scale up is balanced across them and
+// node deletion is routed to the member group each node belongs to
+type MultiNodeGroup struct {
+	id      string
+	members []NodeGroup
+}
+
+// NewMultiNodeGroup creates a logical node group with the given id from the member node groups
+func NewMultiNodeGroup(id string, members ...NodeGroup) *MultiNodeGroup {
+	return &MultiNodeGroup{
+		id:      id,
+		members: members,
+	}
+}
+
+// String returns a string containing the id and members of the node group
+func (m *MultiNodeGroup) String() string {
+	members := make([]string, 0, len(m.members))
+	for _, member := range m.members {
+		members = append(members, member.String())
+	}
+	return fmt.Sprintf("%v: [%v]", m.id, strings.Join(members, ", "))
+}
+
+// ID returns the logical id of the node group
+func (m *MultiNodeGroup) ID() string {
+	return m.id
+}
+
+// Members returns the member node groups
+func (m *MultiNodeGroup) Members() []NodeGroup {
+	return m.members
+}
+
+// MinSize returns the sum of the member groups minimum sizes
+func (m *MultiNodeGroup) MinSize() int64 {
+	var size int64
+	for _, member := range m.members {
+		size += member.MinSize()
+	}
+	return size
+}
+
+// MaxSize returns the sum of the member groups maximum sizes
+func (m *MultiNodeGroup) MaxSize() int64 {
+	var size int64
+	for _, member := range m.members {
+		size += member.MaxSize()
+	}
+	return size
+}
+
+// TargetSize returns the sum of the member groups target sizes
+func (m *MultiNodeGroup) TargetSize() int64 {
+	var size int64
+	for _, member := range m.members {
+		size += member.TargetSize()
+	}
+	return size
+}
+
+// Size returns the sum of the member groups sizes
+func (m *MultiNodeGroup) Size() int64 {
+	var size int64
+	for _, member := range m.members {
+		size += member.Size()
+	}
+	return size
+}
+
+// IncreaseSize balances the increase across the member groups
+// each node is given to the member group with the smallest target size that is not at its maximum. The member groups
+// after the first to fail aren't increased, and a *PartialIncreaseError is returned if any nodes were added
+func (m *MultiNodeGroup) IncreaseSize(delta int64) error {
+	if delta <= 0 {
+		return fmt.Errorf("size increase must be positive")
+	}
+
+	increases := make([]int64, len(m.members))
+	for i := int64(0); i < delta; i++ {
+		smallest := -1
+		for j, member := range m.members {
+			size := member.TargetSize() + increases[j]
+			if size >= member.MaxSize() {
+				continue
+			}
+			if smallest == -1 || size < m.members[smallest].TargetSize()+increases[smallest] {
+				smallest = j
+			}
+		}
+		if smallest == -1 {
+			return fmt.Errorf("increasing size by %v would breach the maximum size (%v) of node group %v", delta, m.MaxSize(), m.id)
+		}
+		increases[smallest]++
+	}
+
+	var added int64
+	for i, member := range m.members {
+		if increases[i] == 0 {
+			continue
+		}
+		if err := member.IncreaseSize(increases[i]); err != nil {
+			if partial, ok := err.(*PartialIncreaseError); ok {
+				added += partial.Added
+			}
+			err = fmt.Errorf("failed to increase size of member node group %v: %v", member.ID(), err)
+			if added == 0 {
+				return err
+			}
+			return &PartialIncreaseError{Added: added, Requested: delta, Err: err}
+		}
+		added += increases[i]
+	}
+	return nil
+}
+
+// Belongs determines if the node belongs to any of the member groups
+func (m *MultiNodeGroup) Belongs(node *v1.Node) bool {
+	_, ok := m.memberFor(node)
+	return ok
+}
+
+// DeleteNodes deletes each node from the member group it belongs to
+// an error is returned, without deleting any nodes, if a node doesn't belong to any member group. The member groups
+// after the first to fail aren't deleted from, and a *PartialDeletionError is returned if any nodes were deleted
+func (m *MultiNodeGroup) DeleteNodes(nodes ...*v1.Node) error {
+	nodesByMember := make(map[int][]*v1.Node, len(m.members))
+	for _, node := range nodes {
+		member, ok := m.memberFor(node)
+		if !ok {
+			return &NodeNotInNodeGroup{NodeName: node.Name, ProviderID: node.Spec.ProviderID, NodeGroup: m.id}
+		}
+		nodesByMember[member] = append(nodesByMember[member], node)
+	}
+
+	var deleted []*v1.Node
+	for i, member := range m.members {
+		if len(nodesByMember[i]) == 0 {
+			continue
+		}
+		err := member.DeleteNodes(nodesByMember[i]...)
+		if err == nil {
+			deleted = append(deleted, nodesByMember[i]...)
+			continue
+		}
+
+		failed := nodesByMember[i]
+		if partial, ok := err.(*PartialDeletionError); ok {
+			deleted = append(deleted, partial.Deleted...)
+			failed = partial.Failed
+			err = partial.Err
+		}
+		if len(deleted) == 0 {
+			return err
+		}
+		for j := i + 1; j < len(m.members); j++ {
+			failed = append(failed, nodesByMember[j]...)
+		}
+		return &PartialDeletionError{Deleted: deleted, Failed: failed, Err: err}
+	}
+	return nil
+}
+
+// DecreaseTargetSize balances the decrease across the member groups, delta should be negative
+// each node is taken from the member group with the most unfulfilled requests for nodes
+func (m *MultiNodeGroup) DecreaseTargetSize(delta int64) error {
+	if delta >= 0 {
+		return fmt.Errorf("size decrease must be negative")
+	}
+
+	decreases := make([]int64, len(m.members))
+	for i := delta; i < 0; i++ {
+		largest := -1
+		for j, member := range m.members {
+			unfulfilled := member.TargetSize() - member.Size() - decreases[j]
+			if unfulfilled <= 0 {
+				continue
+			}
+			if largest == -1 || unfulfilled > m.members[largest].TargetSize()-m.members[largest].Size()-decreases[largest] {
+				largest = j
+			}
+		}
+		if largest == -1 {
+			return fmt.Errorf("decreasing target size by %v would delete existing nodes in node group %v", delta, m.id)
+		}
+		decreases[largest]++
+	}
+
+	for i, member := range m.members {
+		if decreases[i] == 0 {
+			continue
+		}
+		if err := member.DecreaseTargetSize(-decreases[i]); err != nil {
+			return fmt.Errorf("failed to decrease target size of member node group %v: %v", member.ID(), err)
+		}
+	}
+	return nil
+}
+
+// Nodes returns all the nodes of the member groups
+func (m *MultiNodeGroup) Nodes() []string {
+	var nodes []string
+	for _, member := range m.members {
+		nodes = append(nodes, member.Nodes()...)
+	}
+	return nodes
+}
+
+// InstanceMetadata returns the metadata of the instance backing the node from the member group the node belongs to
+func (m *MultiNodeGroup) InstanceMetadata(node *v1.Node) (InstanceMetadata, bool) {
+	i, ok := m.memberFor(node)
+	if !ok {
+		return InstanceMetadata{}, false
+	}
+	return GetInstanceMetadata(m.members[i], node)
+}
+
+// memberFor returns the index of the member group the node belongs to
+func (m *MultiNodeGroup) memberFor(node *v1.Node) (int, bool) {
+	for i, member := range m.members {
+		if member.Belongs(node) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// GetMultiNodeGroup gets the node groups with the member ids from the cloud provider
+// a single member is returned as is, multiple members are combined into a MultiNodeGroup with the given id
+// returns false if any of the members do not exist
+func GetMultiNodeGroup(cloud CloudProvider, id string, memberIDs ...string) (NodeGroup, bool) {
+	members := make([]NodeGroup, 0, len(memberIDs))
+	for _, memberID := range memberIDs {
+		member, ok := cloud.GetNodeGroup(memberID)
+		if !ok {
+			return nil, false
+		}
+		members = append(members, member)
+	}
+
+	if len(members) == 1 {
+		return members[0], true
+	}
+	return NewMultiNodeGroup(id, members...), true
+}
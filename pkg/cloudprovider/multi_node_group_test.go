@@ -0,0 +1,194 @@
+package cloudprovider_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+)
+
+// memberNodeGroup is a test node group that owns the nodes with its id as the provider id prefix
+type memberNodeGroup struct {
+	*test.NodeGroup
+	deleted []string
+}
+
+func (m *memberNodeGroup) Belongs(node *v1.Node) bool {
+	return strings.HasPrefix(node.Spec.ProviderID, m.ID())
+}
+
+func (m *memberNodeGroup) DeleteNodes(nodes ...*v1.Node) error {
+	for _, node := range nodes {
+		m.deleted = append(m.deleted, node.Name)
+	}
+	return m.NodeGroup.DeleteNodes(nodes...)
+}
+
+func (m *memberNodeGroup) InstanceMetadata(node *v1.Node) (cloudprovider.InstanceMetadata, bool) {
+	if !m.Belongs(node) {
+		return cloudprovider.InstanceMetadata{}, false
+	}
+	return cloudprovider.InstanceMetadata{InstanceType: "m5.large", AvailabilityZone: m.ID()}, true
+}
+
+func newMemberNodeGroup(id string, minSize int64, maxSize int64, targetSize int64) *memberNodeGroup {
+	return &memberNodeGroup{NodeGroup: test.NewNodeGroup(id, minSize, maxSize, targetSize)}
+}
+
+func buildMemberNode(name string, member string) *v1.Node {
+	node := test.BuildTestNode(test.NodeOpts{Name: name})
+	node.Spec.ProviderID = member + "/" + name
+	return node
+}
+
+func TestMultiNodeGroupSizes(t *testing.T) {
+	a := newMemberNodeGroup("a", 1, 10, 3)
+	b := newMemberNodeGroup("b", 2, 20, 5)
+	multi := cloudprovider.NewMultiNodeGroup("pool", a, b)
+
+	assert.Equal(t, "pool", multi.ID())
+	assert.Equal(t, int64(3), multi.MinSize())
+	assert.Equal(t, int64(30), multi.MaxSize())
+	assert.Equal(t, int64(8), multi.TargetSize())
+	assert.Equal(t, int64(8), multi.Size())
+}
+
+func TestMultiNodeGroupIncreaseSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		sizes   []int64
+		maxes   []int64
+		delta   int64
+		want    []int64
+		wantErr bool
+	}{
+		{"balanced from equal sizes", []int64{2, 2}, []int64{10, 10}, 4, []int64{4, 4}, false},
+		{"smallest group is filled first", []int64{1, 5}, []int64{10, 10}, 6, []int64{6, 6}, false},
+		{"group at max is skipped", []int64{3, 2}, []int64{3, 10}, 3, []int64{3, 5}, false},
+		{"breaching max of all groups", []int64{3, 3}, []int64{4, 4}, 3, []int64{3, 3}, true},
+		{"non positive delta", []int64{3, 3}, []int64{4, 4}, 0, []int64{3, 3}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newMemberNodeGroup("a", 0, tt.maxes[0], tt.sizes[0])
+			b := newMemberNodeGroup("b", 0, tt.maxes[1], tt.sizes[1])
+			multi := cloudprovider.NewMultiNodeGroup("pool", a, b)
+
+			err := multi.IncreaseSize(tt.delta)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, []int64{a.TargetSize(), b.TargetSize()})
+		})
+	}
+}
+
+func TestMultiNodeGroupIncreaseSizePartialFailure(t *testing.T) {
+	a := newMemberNodeGroup("a", 0, 10, 2)
+	b := newMemberNodeGroup("b", 0, 10, 2)
+	c := newMemberNodeGroup("c", 0, 10, 2)
+	b.SetIncreaseFailure(errors.New("insufficient capacity"))
+	multi := cloudprovider.NewMultiNodeGroup("pool", a, b, c)
+
+	// the member groups after the failing member group aren't increased
+	err := multi.IncreaseSize(6)
+	require.Error(t, err)
+	partial, ok := err.(*cloudprovider.PartialIncreaseError)
+	require.True(t, ok)
+	assert.Equal(t, int64(2), partial.Added)
+	assert.Equal(t, int64(6), partial.Requested)
+	assert.EqualError(t, partial.Err, "failed to increase size of member node group b: insufficient capacity")
+	assert.Equal(t, []int64{4, 2, 2}, []int64{a.TargetSize(), b.TargetSize(), c.TargetSize()})
+
+	// a failure without any nodes added isn't partial, the node goes to the smallest member group b
+	err = multi.IncreaseSize(1)
+	assert.EqualError(t, err, "failed to increase size of member node group b: insufficient capacity")
+}
+
+func TestMultiNodeGroupDeleteNodes(t *testing.T) {
+	a := newMemberNodeGroup("a", 0, 10, 3)
+	b := newMemberNodeGroup("b", 0, 10, 3)
+	multi := cloudprovider.NewMultiNodeGroup("pool", a, b)
+
+	err := multi.DeleteNodes(buildMemberNode("n1", "a"), buildMemberNode("n2", "b"), buildMemberNode("n3", "a"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"n1", "n3"}, a.deleted)
+	assert.Equal(t, []string{"n2"}, b.deleted)
+	assert.Equal(t, int64(3), multi.TargetSize())
+
+	// a node that doesn't belong to any member group should not delete anything
+	err = multi.DeleteNodes(buildMemberNode("n4", "a"), buildMemberNode("n5", "c"))
+	require.Error(t, err)
+	assert.IsType(t, &cloudprovider.NodeNotInNodeGroup{}, err)
+	assert.Equal(t, []string{"n1", "n3"}, a.deleted)
+}
+
+func TestMultiNodeGroupDeleteNodesPartialFailure(t *testing.T) {
+	nodeNames := func(nodes []*v1.Node) []string {
+		var names []string
+		for _, node := range nodes {
+			names = append(names, node.Name)
+		}
+		return names
+	}
+
+	a := newMemberNodeGroup("a", 0, 10, 3)
+	b := newMemberNodeGroup("b", 0, 10, 3)
+	c := newMemberNodeGroup("c", 0, 10, 3)
+	b.SetDeleteFailure("n3", errors.New("instance is protected from scale in"))
+	multi := cloudprovider.NewMultiNodeGroup("pool", a, b, c)
+
+	// the member groups after the failing member group aren't deleted from
+	err := multi.DeleteNodes(buildMemberNode("n1", "a"), buildMemberNode("n2", "b"), buildMemberNode("n3", "b"), buildMemberNode("n4", "c"))
+	require.Error(t, err)
+	partial, ok := err.(*cloudprovider.PartialDeletionError)
+	require.True(t, ok)
+	assert.Equal(t, []string{"n1", "n2"}, nodeNames(partial.Deleted))
+	assert.Equal(t, []string{"n3", "n4"}, nodeNames(partial.Failed))
+	assert.EqualError(t, partial.Err, "instance is protected from scale in")
+	assert.Empty(t, c.deleted)
+	assert.Equal(t, int64(7), multi.TargetSize())
+
+	// a failure without any nodes deleted isn't partial
+	err = multi.DeleteNodes(buildMemberNode("n3", "b"))
+	assert.EqualError(t, err, "instance is protected from scale in")
+}
+
+func TestMultiNodeGroupInstanceMetadata(t *testing.T) {
+	multi := cloudprovider.NewMultiNodeGroup("pool", newMemberNodeGroup("a", 0, 10, 1), newMemberNodeGroup("b", 0, 10, 1))
+
+	metadata, ok := cloudprovider.GetInstanceMetadata(multi, buildMemberNode("n1", "b"))
+	require.True(t, ok)
+	assert.Equal(t, cloudprovider.InstanceMetadata{InstanceType: "m5.large", AvailabilityZone: "b"}, metadata)
+
+	// a node that doesn't belong to any member group has no metadata
+	_, ok = cloudprovider.GetInstanceMetadata(multi, buildMemberNode("n2", "c"))
+	assert.False(t, ok)
+}
+
+func TestGetMultiNodeGroup(t *testing.T) {
+	cloud := test.NewCloudProvider(2)
+	cloud.RegisterNodeGroup(test.NewNodeGroup("a", 0, 10, 1))
+	cloud.RegisterNodeGroup(test.NewNodeGroup("b", 0, 10, 2))
+
+	single, ok := cloudprovider.GetMultiNodeGroup(cloud, "a", "a")
+	require.True(t, ok)
+	assert.Equal(t, "a", single.ID())
+	assert.IsType(t, &test.NodeGroup{}, single)
+
+	multi, ok := cloudprovider.GetMultiNodeGroup(cloud, "a,b", "a", "b")
+	require.True(t, ok)
+	assert.Equal(t, "a,b", multi.ID())
+	assert.Equal(t, int64(3), multi.TargetSize())
+
+	_, ok = cloudprovider.GetMultiNodeGroup(cloud, "a,c", "a", "c")
+	assert.False(t, ok)
+}
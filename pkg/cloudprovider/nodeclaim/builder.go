@@ -0,0 +1,34 @@
+package nodeclaim
+
+import (
+	"fmt"
+
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	log "github.com/sirupsen/logrus"
+)
+
+// Builder builds the nodeclaim cloud provider
+type Builder struct {
+	ProviderOpts cloudprovider.BuildOpts
+	Opts         Opts
+}
+
+// Build the cloud provider
+func (b Builder) Build() (cloudprovider.CloudProvider, error) {
+	if len(b.Opts.APIURL) == 0 {
+		return nil, fmt.Errorf("the node claim api url must be set")
+	}
+
+	cloud := &CloudProvider{
+		client:     newClient(b.Opts.APIURL, b.Opts.APIToken),
+		nodeGroups: make(map[string]*NodeGroup, len(b.ProviderOpts.NodeGroupIDs)),
+	}
+
+	// Register the node groups
+	if err := cloud.RegisterNodeGroups(b.ProviderOpts.NodeGroupIDs...); err != nil {
+		return nil, err
+	}
+
+	log.Infof("node claim api %v connected successfully", b.Opts.APIURL)
+	return cloud, nil
+}
@@ -0,0 +1,99 @@
+package nodeclaim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// client calls the node claim API
+//
+//	GET    /nodegroups                      lists every node group, without their claims
+//	GET    /nodegroups/{id}                 gets a node group and its claims
+//	POST   /nodegroups/{id}/claims          creates {"count": n} node claims
+//	DELETE /nodegroups/{id}/claims/{name}   deletes a node claim and its node
+type client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// newClient creates a client for the node claim API at baseURL
+func newClient(baseURL string, token string) *client {
+	return &client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// listNodeGroups returns every node group
+func (c *client) listNodeGroups() ([]nodeGroup, error) {
+	var groups []nodeGroup
+	err := c.do(http.MethodGet, "/nodegroups", nil, &groups)
+	return groups, err
+}
+
+// getNodeGroup returns the node group and its claims
+func (c *client) getNodeGroup(id string) (*nodeGroup, error) {
+	group := &nodeGroup{}
+	if err := c.do(http.MethodGet, "/nodegroups/"+url.PathEscape(id), nil, group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// createClaims creates count node claims in the node group
+func (c *client) createClaims(id string, count int64) error {
+	return c.do(http.MethodPost, "/nodegroups/"+url.PathEscape(id)+"/claims", createClaimsRequest{Count: count}, nil)
+}
+
+// deleteClaim deletes the node claim, and its node if it has been launched
+func (c *client) deleteClaim(id string, name string) error {
+	return c.do(http.MethodDelete, "/nodegroups/"+url.PathEscape(id)+"/claims/"+url.PathEscape(name), nil, nil)
+}
+
+// do sends the request with the JSON encoded body and decodes the JSON response into out, if not nil
+func (c *client) do(method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request to %v %v: %v", method, path, err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(c.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %v %v: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%v %v returned %v", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response of %v %v: %v", method, path, err)
+	}
+	return nil
+}
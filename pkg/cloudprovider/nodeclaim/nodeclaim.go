@@ -0,0 +1,298 @@
+package nodeclaim
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+)
+
+// ProviderName identifies this module as nodeclaim
+const ProviderName = "nodeclaim"
+
+// CloudProvider provides a cloud provider for just in time provisioners, where each node is created and deleted
+// individually by a node claim rather than by resizing a fixed size group
+type CloudProvider struct {
+	client     *client
+	nodeGroups map[string]*NodeGroup
+}
+
+// Name returns name of the cloud provider.
+func (c *CloudProvider) Name() string {
+	return ProviderName
+}
+
+// NodeGroups returns all node groups configured for this cloud provider.
+func (c *CloudProvider) NodeGroups() []cloudprovider.NodeGroup {
+	ngs := make([]cloudprovider.NodeGroup, 0, len(c.nodeGroups))
+	for _, ng := range c.nodeGroups {
+		ngs = append(ngs, ng)
+	}
+	return ngs
+}
+
+// GetNodeGroup gets the node group from the cloud provider. Returns if it exists or not
+func (c *CloudProvider) GetNodeGroup(id string) (cloudprovider.NodeGroup, bool) {
+	ng, ok := c.nodeGroups[id]
+	return ng, ok
+}
+
+// RegisterNodeGroups adds the nodegroup to the list of nodes groups
+func (c *CloudProvider) RegisterNodeGroups(ids ...string) error {
+	for _, id := range ids {
+		group, err := c.client.getNodeGroup(id)
+		if err != nil {
+			log.Errorf("failed to get node group %v. err: %v", id, err)
+			return err
+		}
+		if ng, ok := c.nodeGroups[id]; ok {
+			// just update the group if it already exists
+			ng.group = group
+			continue
+		}
+		c.nodeGroups[id] = &NodeGroup{id: id, group: group, provider: c}
+	}
+
+	c.updateMetrics()
+	return nil
+}
+
+// DiscoverNodeGroups registers and returns all node groups that have every one of the tags
+// a tag with an empty value matches any value
+func (c *CloudProvider) DiscoverNodeGroups(tags map[string]string) ([]cloudprovider.DiscoveredNodeGroup, error) {
+	groups, err := c.client.listNodeGroups()
+	if err != nil {
+		log.Errorf("failed to list node groups for auto discovery. err: %v", err)
+		return nil, err
+	}
+
+	var discovered []cloudprovider.DiscoveredNodeGroup
+	for _, group := range groups {
+		if !cloudprovider.HasTags(group.Tags, tags) {
+			continue
+		}
+		// the list doesn't include the claims, so get each discovered node group
+		if err := c.RegisterNodeGroups(group.ID); err != nil {
+			return nil, err
+		}
+		discovered = append(discovered, cloudprovider.DiscoveredNodeGroup{ID: group.ID, Tags: group.Tags})
+	}
+	return discovered, nil
+}
+
+// updateMetrics updates the metrics for each node group
+func (c *CloudProvider) updateMetrics() {
+	for _, nodeGroup := range c.nodeGroups {
+		metrics.CloudProviderMinSize.WithLabelValues(c.Name(), nodeGroup.ID()).Set(float64(nodeGroup.MinSize()))
+		metrics.CloudProviderMaxSize.WithLabelValues(c.Name(), nodeGroup.ID()).Set(float64(nodeGroup.MaxSize()))
+		metrics.CloudProviderTargetSize.WithLabelValues(c.Name(), nodeGroup.ID()).Set(float64(nodeGroup.TargetSize()))
+		metrics.CloudProviderSize.WithLabelValues(c.Name(), nodeGroup.ID()).Set(float64(nodeGroup.Size()))
+	}
+}
+
+// Refresh is called before every main loop and can be used to dynamically update cloud provider state.
+func (c *CloudProvider) Refresh() error {
+	ids := make([]string, 0, len(c.nodeGroups))
+	for id := range c.nodeGroups {
+		ids = append(ids, id)
+	}
+	return c.RegisterNodeGroups(ids...)
+}
+
+// CheckPermissions checks the api token can list the node groups. Creating and deleting node claims can't be checked
+// without making changes, so isn't checked
+func (c *CloudProvider) CheckPermissions() error {
+	if _, err := c.client.listNodeGroups(); err != nil {
+		return fmt.Errorf("failed to list node groups: %v", err)
+	}
+	return nil
+}
+
+// GetInstance returns the node claim of the node
+func (c *CloudProvider) GetInstance(node *v1.Node) (cloudprovider.Instance, error) {
+	for _, ng := range c.nodeGroups {
+		if claim, ok := ng.claimFor(node); ok {
+			return &Instance{claim: claim}, nil
+		}
+	}
+	return nil, fmt.Errorf("no node claim found for node %v, %v", node.Name, node.Spec.ProviderID)
+}
+
+// Instance is the node claim of a node
+type Instance struct {
+	claim claim
+}
+
+// InstantiationTime gets the time the node claim was created
+func (i *Instance) InstantiationTime() time.Time {
+	return i.claim.Created
+}
+
+// Id gets the provider id of the node
+func (i *Instance) Id() string {
+	return i.claim.ProviderID
+}
+
+// NodeGroup implements a node group made of node claims
+// the target size is the number of claims and the size is the number of claims that have been launched
+type NodeGroup struct {
+	id    string
+	group *nodeGroup
+
+	provider *CloudProvider
+}
+
+func (n *NodeGroup) String() string {
+	return fmt.Sprintf("%v (%v claims)", n.id, len(n.group.Claims))
+}
+
+// ID returns an unique identifier of the node group.
+func (n *NodeGroup) ID() string {
+	return n.id
+}
+
+// MinSize returns minimum size of the node group.
+func (n *NodeGroup) MinSize() int64 {
+	return n.group.MinSize
+}
+
+// MaxSize returns maximum size of the node group.
+func (n *NodeGroup) MaxSize() int64 {
+	return n.group.MaxSize
+}
+
+// TargetSize returns the number of node claims, launched or not
+func (n *NodeGroup) TargetSize() int64 {
+	return int64(len(n.group.Claims))
+}
+
+// Size returns the number of node claims that have been launched
+func (n *NodeGroup) Size() int64 {
+	var size int64
+	for _, claim := range n.group.Claims {
+		if len(claim.ProviderID) > 0 {
+			size++
+		}
+	}
+	return size
+}
+
+// IncreaseSize creates delta node claims
+func (n *NodeGroup) IncreaseSize(delta int64) error {
+	if delta <= 0 {
+		return fmt.Errorf("size increase must be positive")
+	}
+	if n.TargetSize()+delta > n.MaxSize() {
+		return fmt.Errorf("increasing size will breach maximum node size")
+	}
+	if err := n.provider.client.createClaims(n.id, delta); err != nil {
+		return fmt.Errorf("failed to create node claims. err: %v", err)
+	}
+	// the claims are created whether or not the node group can be read back, it is read again on the next refresh
+	if err := n.provider.RegisterNodeGroups(n.id); err != nil {
+		log.WithError(err).Warningf("failed to refresh node group %v after creating node claims", n.id)
+	}
+	return nil
+}
+
+// Belongs determines if the node belongs in the current node group
+func (n *NodeGroup) Belongs(node *v1.Node) bool {
+	_, ok := n.claimFor(node)
+	return ok
+}
+
+// DeleteNodes deletes the node claims of the nodes, which deletes the nodes
+// Every claim is deleted even if deleting another fails. A *cloudprovider.PartialDeletionError is returned if only some
+// of the claims were deleted
+func (n *NodeGroup) DeleteNodes(nodes ...*v1.Node) error {
+	if n.TargetSize()-int64(len(nodes)) < n.MinSize() {
+		return fmt.Errorf("deleting nodes will breach minimum node size")
+	}
+
+	claims := make([]claim, 0, len(nodes))
+	for _, node := range nodes {
+		claim, ok := n.claimFor(node)
+		if !ok {
+			log.Debugf("node claims in node group: %v", n.Nodes())
+			return &cloudprovider.NodeNotInNodeGroup{NodeName: node.Name, ProviderID: node.Spec.ProviderID, NodeGroup: n.ID()}
+		}
+		claims = append(claims, claim)
+	}
+
+	var deleted, failed []*v1.Node
+	var deleteErr error
+	for i, node := range nodes {
+		if err := n.provider.client.deleteClaim(n.id, claims[i].Name); err != nil {
+			log.WithError(err).Warningf("failed to delete node claim %v of node %v", claims[i].Name, node.Name)
+			failed = append(failed, node)
+			if deleteErr == nil {
+				deleteErr = fmt.Errorf("failed to delete node claim %v. err: %v", claims[i].Name, err)
+			}
+			continue
+		}
+		deleted = append(deleted, node)
+	}
+
+	if len(deleted) == 0 {
+		return deleteErr
+	}
+	// the claims are gone whether or not the node group can be read back, it is read again on the next refresh
+	if err := n.provider.RegisterNodeGroups(n.id); err != nil {
+		log.WithError(err).Warningf("failed to refresh node group %v after deleting node claims", n.id)
+	}
+	if deleteErr != nil {
+		return &cloudprovider.PartialDeletionError{Deleted: deleted, Failed: failed, Err: deleteErr}
+	}
+	return nil
+}
+
+// DecreaseTargetSize deletes node claims that haven't been launched yet, delta should be negative
+func (n *NodeGroup) DecreaseTargetSize(delta int64) error {
+	if delta >= 0 {
+		return fmt.Errorf("size decrease delta must be negative")
+	}
+
+	var pending []claim
+	for _, claim := range n.group.Claims {
+		if len(claim.ProviderID) == 0 {
+			pending = append(pending, claim)
+		}
+	}
+	if int64(len(pending)) < -delta {
+		return fmt.Errorf("decreasing target size by %v would delete existing nodes, only %v node claims are pending", delta, len(pending))
+	}
+
+	for _, claim := range pending[:-delta] {
+		if err := n.provider.client.deleteClaim(n.id, claim.Name); err != nil {
+			return fmt.Errorf("failed to delete node claim %v. err: %v", claim.Name, err)
+		}
+	}
+	if err := n.provider.RegisterNodeGroups(n.id); err != nil {
+		log.WithError(err).Warningf("failed to refresh node group %v after deleting pending node claims", n.id)
+	}
+	return nil
+}
+
+// Nodes returns the provider ids of the launched node claims
+func (n *NodeGroup) Nodes() []string {
+	result := make([]string, 0, len(n.group.Claims))
+	for _, claim := range n.group.Claims {
+		if len(claim.ProviderID) > 0 {
+			result = append(result, claim.ProviderID)
+		}
+	}
+	return result
+}
+
+// claimFor returns the node claim the node was launched for
+func (n *NodeGroup) claimFor(node *v1.Node) (claim, bool) {
+	for _, claim := range n.group.Claims {
+		if len(claim.ProviderID) > 0 && claim.ProviderID == node.Spec.ProviderID {
+			return claim, true
+		}
+	}
+	return claim{}, false
+}
@@ -0,0 +1,314 @@
+package nodeclaim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+)
+
+// fakeAPI is an in memory node claim API
+type fakeAPI struct {
+	sync.Mutex
+	groups map[string]*nodeGroup
+	token  string
+	next   int
+	// failDelete are the names of the claims that fail to be deleted
+	failDelete map[string]bool
+	// failGet is whether reading a single node group fails
+	failGet bool
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	if len(f.token) > 0 && r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1:
+		var groups []nodeGroup
+		for _, group := range f.groups {
+			groups = append(groups, nodeGroup{ID: group.ID, MinSize: group.MinSize, MaxSize: group.MaxSize, Tags: group.Tags})
+		}
+		json.NewEncoder(w).Encode(groups)
+	case r.Method == http.MethodGet && len(parts) == 2:
+		if f.failGet {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		group, ok := f.groups[parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(group)
+	case r.Method == http.MethodPost && len(parts) == 3:
+		var req createClaimsRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		group := f.groups[parts[1]]
+		for i := int64(0); i < req.Count; i++ {
+			f.next++
+			group.Claims = append(group.Claims, claim{Name: fmt.Sprintf("claim-%d", f.next), Created: time.Now()})
+		}
+	case r.Method == http.MethodDelete && len(parts) == 4:
+		if f.failDelete[parts[3]] {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		group := f.groups[parts[1]]
+		for i, claim := range group.Claims {
+			if claim.Name == parts[3] {
+				group.Claims = append(group.Claims[:i], group.Claims[i+1:]...)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// launch gives the first n pending claims of the node group a provider id
+func (f *fakeAPI) launch(id string, n int) {
+	f.Lock()
+	defer f.Unlock()
+	for i := range f.groups[id].Claims {
+		if n == 0 {
+			return
+		}
+		if len(f.groups[id].Claims[i].ProviderID) == 0 {
+			f.groups[id].Claims[i].ProviderID = "test:///" + f.groups[id].Claims[i].Name
+			n--
+		}
+	}
+}
+
+func newFakeAPI(token string) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{
+		groups: map[string]*nodeGroup{
+			"shared": {ID: "shared", MinSize: 1, MaxSize: 5, Tags: map[string]string{"team": "shared"}, Claims: []claim{
+				{Name: "claim-0", ProviderID: "test:///claim-0", Created: time.Now()},
+			}},
+			"gpu": {ID: "gpu", MinSize: 0, MaxSize: 5, Tags: map[string]string{"team": "ml"}},
+		},
+		token: token,
+	}
+	return api, httptest.NewServer(api)
+}
+
+func TestNodeGroupScale(t *testing.T) {
+	api, server := newFakeAPI("secret")
+	defer server.Close()
+
+	cloud, err := Builder{
+		ProviderOpts: cloudprovider.BuildOpts{ProviderID: ProviderName, NodeGroupIDs: []string{"shared"}},
+		Opts:         Opts{APIURL: server.URL + "/", APIToken: "secret"},
+	}.Build()
+	require.NoError(t, err)
+	assert.Equal(t, ProviderName, cloud.Name())
+
+	ng, ok := cloud.GetNodeGroup("shared")
+	require.True(t, ok)
+	assert.Equal(t, int64(1), ng.TargetSize())
+	assert.Equal(t, int64(1), ng.Size())
+
+	// scaling up creates a node claim for every node, the nodes only count towards the size once launched
+	require.NoError(t, ng.IncreaseSize(3))
+	assert.Equal(t, int64(4), ng.TargetSize())
+	assert.Equal(t, int64(1), ng.Size())
+	assert.Error(t, ng.IncreaseSize(2), "max size breached")
+
+	api.launch("shared", 1)
+	require.NoError(t, cloud.Refresh())
+	assert.Equal(t, int64(2), ng.Size())
+	assert.Equal(t, []string{"test:///claim-0", "test:///claim-1"}, ng.Nodes())
+
+	// only the claims that haven't launched are removed by decreasing the target size
+	assert.Error(t, ng.DecreaseTargetSize(-3))
+	require.NoError(t, ng.DecreaseTargetSize(-2))
+	assert.Equal(t, int64(2), ng.TargetSize())
+	assert.Equal(t, int64(2), ng.Size())
+
+	// deleting a node deletes its claim
+	node := test.BuildTestNode(test.NodeOpts{Name: "node"})
+	node.Spec.ProviderID = "test:///claim-1"
+	assert.True(t, ng.Belongs(node))
+	instance, err := cloud.GetInstance(node)
+	require.NoError(t, err)
+	assert.Equal(t, "test:///claim-1", instance.Id())
+
+	require.NoError(t, ng.DeleteNodes(node))
+	assert.Equal(t, int64(1), ng.TargetSize())
+	assert.False(t, ng.Belongs(node))
+
+	// the last node is kept for the min size
+	node.Spec.ProviderID = "test:///claim-0"
+	assert.Error(t, ng.DeleteNodes(node))
+
+	other := test.BuildTestNode(test.NodeOpts{Name: "other"})
+	other.Spec.ProviderID = "test:///other"
+	_, err = cloud.GetInstance(other)
+	assert.Error(t, err)
+}
+
+func TestNodeGroupDeleteNodesNotInNodeGroup(t *testing.T) {
+	_, server := newFakeAPI("")
+	defer server.Close()
+
+	cloud, err := Builder{
+		ProviderOpts: cloudprovider.BuildOpts{ProviderID: ProviderName, NodeGroupIDs: []string{"gpu"}},
+		Opts:         Opts{APIURL: server.URL},
+	}.Build()
+	require.NoError(t, err)
+	ng, _ := cloud.GetNodeGroup("gpu")
+	require.NoError(t, ng.IncreaseSize(1))
+
+	node := test.BuildTestNode(test.NodeOpts{Name: "node"})
+	node.Spec.ProviderID = "test:///claim-0"
+	err = ng.DeleteNodes(node)
+	assert.IsType(t, &cloudprovider.NodeNotInNodeGroup{}, err)
+}
+
+func TestCloudProviderDiscoverNodeGroups(t *testing.T) {
+	_, server := newFakeAPI("")
+	defer server.Close()
+
+	cloud, err := Builder{Opts: Opts{APIURL: server.URL}}.Build()
+	require.NoError(t, err)
+
+	discovered, err := cloud.DiscoverNodeGroups(map[string]string{"team": "ml"})
+	require.NoError(t, err)
+	assert.Equal(t, []cloudprovider.DiscoveredNodeGroup{{ID: "gpu", Tags: map[string]string{"team": "ml"}}}, discovered)
+	_, ok := cloud.GetNodeGroup("gpu")
+	assert.True(t, ok)
+	_, ok = cloud.GetNodeGroup("shared")
+	assert.False(t, ok)
+}
+
+func TestBuilderErrors(t *testing.T) {
+	_, err := Builder{}.Build()
+	assert.Error(t, err, "no api url")
+
+	_, server := newFakeAPI("secret")
+	defer server.Close()
+
+	_, err = Builder{
+		ProviderOpts: cloudprovider.BuildOpts{NodeGroupIDs: []string{"shared"}},
+		Opts:         Opts{APIURL: server.URL},
+	}.Build()
+	assert.Error(t, err, "missing token")
+
+	_, err = Builder{
+		ProviderOpts: cloudprovider.BuildOpts{NodeGroupIDs: []string{"missing"}},
+		Opts:         Opts{APIURL: server.URL, APIToken: "secret"},
+	}.Build()
+	assert.Error(t, err, "node group doesn't exist")
+}
+
+func TestCloudProviderCheckPermissions(t *testing.T) {
+	api, server := newFakeAPI("secret")
+	defer server.Close()
+
+	cloud, err := Builder{Opts: Opts{APIURL: server.URL, APIToken: "secret"}}.Build()
+	require.NoError(t, err)
+	checker, ok := cloud.(cloudprovider.PermissionChecker)
+	require.True(t, ok)
+	assert.NoError(t, checker.CheckPermissions())
+
+	// the token is rotated
+	api.Lock()
+	api.token = "rotated"
+	api.Unlock()
+	assert.Error(t, checker.CheckPermissions())
+}
+
+func TestNodeGroupDeleteNodesPartial(t *testing.T) {
+	api, server := newFakeAPI("")
+	defer server.Close()
+
+	cloud, err := Builder{
+		ProviderOpts: cloudprovider.BuildOpts{ProviderID: ProviderName, NodeGroupIDs: []string{"gpu"}},
+		Opts:         Opts{APIURL: server.URL},
+	}.Build()
+	require.NoError(t, err)
+	ng, _ := cloud.GetNodeGroup("gpu")
+	require.NoError(t, ng.IncreaseSize(3))
+	api.launch("gpu", 3)
+	require.NoError(t, cloud.Refresh())
+
+	var nodes []*v1.Node
+	for _, providerID := range ng.Nodes() {
+		node := test.BuildTestNode(test.NodeOpts{Name: providerID})
+		node.Spec.ProviderID = providerID
+		nodes = append(nodes, node)
+	}
+	require.Len(t, nodes, 3)
+	api.Lock()
+	api.failDelete = map[string]bool{"claim-2": true}
+	api.Unlock()
+
+	// the claims after the one that fails are still deleted
+	err = ng.DeleteNodes(nodes...)
+	partial, ok := err.(*cloudprovider.PartialDeletionError)
+	require.True(t, ok, "expected a partial deletion error, got %v", err)
+	assert.Equal(t, []*v1.Node{nodes[0], nodes[2]}, partial.Deleted)
+	assert.Equal(t, []*v1.Node{nodes[1]}, partial.Failed)
+	assert.Equal(t, int64(1), ng.TargetSize())
+	assert.True(t, ng.Belongs(nodes[1]))
+
+	// nothing deleted is a plain error
+	err = ng.DeleteNodes(nodes[1])
+	require.Error(t, err)
+	_, ok = err.(*cloudprovider.PartialDeletionError)
+	assert.False(t, ok)
+}
+
+func TestNodeGroupScaleRefreshFailure(t *testing.T) {
+	api, server := newFakeAPI("")
+	defer server.Close()
+
+	cloud, err := Builder{
+		ProviderOpts: cloudprovider.BuildOpts{ProviderID: ProviderName, NodeGroupIDs: []string{"gpu"}},
+		Opts:         Opts{APIURL: server.URL},
+	}.Build()
+	require.NoError(t, err)
+	ng, _ := cloud.GetNodeGroup("gpu")
+	api.Lock()
+	api.failGet = true
+	api.Unlock()
+
+	// the claims are created even though the node group can't be read back
+	assert.NoError(t, ng.IncreaseSize(2))
+	api.Lock()
+	assert.Len(t, api.groups["gpu"].Claims, 2)
+	api.failGet = false
+	api.Unlock()
+	require.NoError(t, cloud.Refresh())
+	assert.Equal(t, int64(2), ng.TargetSize())
+
+	api.Lock()
+	api.failGet = true
+	api.Unlock()
+	assert.NoError(t, ng.DecreaseTargetSize(-1))
+	api.Lock()
+	assert.Len(t, api.groups["gpu"].Claims, 1)
+	api.failGet = false
+	api.Unlock()
+
+	require.NoError(t, cloud.Refresh())
+	assert.Equal(t, int64(1), ng.TargetSize())
+}
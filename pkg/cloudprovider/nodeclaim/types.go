@@ -0,0 +1,32 @@
+package nodeclaim
+
+import "time"
+
+// Opts includes options for the nodeclaim cloud provider
+type Opts struct {
+	// APIURL is the base URL of the node claim API
+	APIURL string
+	// APIToken is the bearer token sent with every request to the node claim API. No token is sent if empty
+	APIToken string
+}
+
+// nodeGroup is a node group returned by the node claim API
+type nodeGroup struct {
+	ID      string            `json:"id"`
+	MinSize int64             `json:"min_size"`
+	MaxSize int64             `json:"max_size"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Claims  []claim           `json:"claims"`
+}
+
+// claim is a request for a single node. The provider ID is empty until the node has been launched
+type claim struct {
+	Name       string    `json:"name"`
+	ProviderID string    `json:"provider_id,omitempty"`
+	Created    time.Time `json:"created"`
+}
+
+// createClaimsRequest is the body of a request to create count node claims
+type createClaimsRequest struct {
+	Count int64 `json:"count"`
+}
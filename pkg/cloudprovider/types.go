@@ -1,6 +1,10 @@
 package cloudprovider
 
-import "fmt"
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+)
 
 // NodeNotInNodeGroup is a special error type
 // this happens when a node is not inside a expected node group
@@ -13,3 +17,65 @@ type NodeNotInNodeGroup struct {
 func (ne *NodeNotInNodeGroup) Error() string {
 	return fmt.Sprintf("node %v, %v belongs in a different node group than %v", ne.NodeName, ne.ProviderID, ne.NodeGroup)
 }
+
+// PartialDeletionError is returned by DeleteNodes when only some of the nodes were deleted, e.g. when an instance is
+// protected from scale in. The nodes that were deleted have been removed from the target size of the node group
+type PartialDeletionError struct {
+	Deleted []*v1.Node
+	Failed  []*v1.Node
+	Err     error
+}
+
+func (pe *PartialDeletionError) Error() string {
+	return fmt.Sprintf("only deleted %v of %v nodes: %v", len(pe.Deleted), len(pe.Deleted)+len(pe.Failed), pe.Err)
+}
+
+// PartialIncreaseError is returned by IncreaseSize when only some of the nodes were added, e.g. when a member group of a
+// MultiNodeGroup fails after the member groups before it were increased. The added nodes are in the target size of the
+// node group
+type PartialIncreaseError struct {
+	Added     int64
+	Requested int64
+	Err       error
+}
+
+func (pe *PartialIncreaseError) Error() string {
+	return fmt.Sprintf("only added %v of %v nodes: %v", pe.Added, pe.Requested, pe.Err)
+}
+
+// DiscoveredNodeGroup is a node group found by its tags on the cloud provider
+type DiscoveredNodeGroup struct {
+	ID   string
+	Tags map[string]string
+}
+
+// HasTags returns whether the tags contain every one of the wanted tags
+// a wanted tag with an empty value matches any value
+func HasTags(tags map[string]string, wanted map[string]string) bool {
+	for key, value := range wanted {
+		actual, ok := tags[key]
+		if !ok || (len(value) > 0 && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// InstanceMetadata describes the cloud provider instance backing a node
+// fields that aren't known are empty
+type InstanceMetadata struct {
+	InstanceType     string
+	AvailabilityZone string
+	// LifecycleState is the state of the instance in its cloud provider node group, e.g. InService
+	LifecycleState string
+}
+
+// GetInstanceMetadata returns the metadata of the instance backing the node if the node group implements
+// InstanceMetadataProvider, false if the metadata isn't known
+func GetInstanceMetadata(nodeGroup NodeGroup, node *v1.Node) (InstanceMetadata, bool) {
+	provider, ok := nodeGroup.(InstanceMetadataProvider)
+	if !ok {
+		return InstanceMetadata{}, false
+	}
+	return provider.InstanceMetadata(node)
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// checkAPIHealth checks the kubernetes API server is reachable before scanning, returning whether the node groups
+// can be scanned. Whilst the API server is unreachable the informer caches stop being updated, so acting on them could
+// scale on stale data, e.g. tainting and deleting nodes that have since had pods scheduled onto them. The scan after
+// the API server becomes reachable again is also skipped, giving the informers time to relist and resync their caches
+func (c *Controller) checkAPIHealth() bool {
+	_, err := c.Client.CoreV1().Nodes().List(metav1.ListOptions{Limit: 1})
+	if err != nil {
+		log.WithError(err).Error("Kubernetes API server is unreachable. Skipping scale actions until it is reachable and the caches have resynced")
+		c.apiUnreachable = true
+		metrics.APIHealthy.Set(0)
+		return false
+	}
+
+	metrics.APIHealthy.Set(1)
+	if c.apiUnreachable {
+		log.Warn("Kubernetes API server is reachable again. Skipping this scan to let the caches resync")
+		c.apiUnreachable = false
+		return false
+	}
+	return true
+}
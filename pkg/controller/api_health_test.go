@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+func TestControllerRunOnceAPIUnreachable(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		ScaleUpCoolDownPeriod:              "1m",
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(10, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+	unreachable := true
+	opts.K8SClient.(*fake.Clientset).PrependReactor("list", "nodes", func(action core.Action) (bool, runtime.Object, error) {
+		if unreachable {
+			return true, nil, errors.New("connection refused")
+		}
+		return false, nil, nil
+	})
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	controller := &Controller{
+		Client: client,
+		Opts:   opts,
+		nodeGroups: BuildNodeGroupsState(nodeGroupsStateOpts{
+			nodeGroups: nodeGroups,
+			client:     *client,
+		}),
+		cloudProvider: testCloudProvider,
+	}
+
+	// nothing is scaled whilst the API server is unreachable
+	require.NoError(t, controller.RunOnce())
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.APIHealthy))
+	assert.Equal(t, int64(2), testNodeGroup.TargetSize())
+
+	// or on the first scan after it is reachable again, whilst the caches resync
+	unreachable = false
+	require.NoError(t, controller.RunOnce())
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.APIHealthy))
+	assert.Equal(t, int64(2), testNodeGroup.TargetSize())
+
+	require.NoError(t, controller.RunOnce())
+	assert.True(t, testNodeGroup.TargetSize() > 2)
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"sort"
+
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// AutoDiscoveryLabelTagPrefix is the prefix of the cloud provider node group tag that sets the label_value of an auto
+// discovered node group. The prefix is followed by the label_key, the same convention used by cluster-autoscaler
+const AutoDiscoveryLabelTagPrefix = "k8s.io/cluster-autoscaler/node-template/label/"
+
+// discoveredNodeGroupOptions creates the options of a node group discovered by the template
+// the node group is named after the cloud provider node group. The label_value is taken from the
+// AutoDiscoveryLabelTagPrefix tag of the cloud provider node group, or is the name if there is no tag
+func discoveredNodeGroupOptions(template NodeGroupOptions, discovered cloudprovider.DiscoveredNodeGroup) NodeGroupOptions {
+	opts := template
+	opts.Name = discovered.ID
+	opts.CloudProviderGroupName = discovered.ID
+	opts.CloudProviderGroupNames = nil
+	opts.AutoDiscoveryTags = nil
+	opts.LabelValue = discovered.ID
+	if value := discovered.Tags[AutoDiscoveryLabelTagPrefix+template.LabelKey]; len(value) > 0 {
+		opts.LabelValue = value
+	}
+	return opts
+}
+
+// discoverNodeGroups finds the cloud provider node groups matching the tags of each auto discovery node group
+// node groups are created for newly discovered cloud provider node groups and removed for ones no longer discovered.
+// Cloud provider node groups that are already configured, or discovered by an earlier template, are skipped
+func (c *Controller) discoverNodeGroups() error {
+	configured := make(map[string]bool, len(c.Opts.NodeGroups))
+	claimed := make(map[string]bool, len(c.Opts.NodeGroups))
+	for _, nodeGroupOpts := range c.Opts.NodeGroups {
+		if nodeGroupOpts.AutoDiscoveryEnabled() {
+			continue
+		}
+		configured[nodeGroupOpts.Name] = true
+		for _, id := range nodeGroupOpts.CloudProviderGroupNameList() {
+			claimed[id] = true
+		}
+	}
+
+	discovered := make(map[string]NodeGroupOptions)
+	for _, template := range c.Opts.NodeGroups {
+		if !template.AutoDiscoveryEnabled() {
+			continue
+		}
+		groups, err := c.cloudProvider.DiscoverNodeGroups(template.AutoDiscoveryTags)
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			if claimed[group.ID] {
+				continue
+			}
+			if configured[group.ID] {
+				log.WithField("nodegroup", template.Name).Warningf("Discovered cloud provider node group %v has the same name as a configured node group. Skipping", group.ID)
+				continue
+			}
+			claimed[group.ID] = true
+			discovered[group.ID] = discoveredNodeGroupOptions(template, group)
+		}
+	}
+
+	names := make([]string, 0, len(discovered))
+	for name, nodeGroupOpts := range discovered {
+		cloudProviderNodeGroup, ok := getCloudProviderNodeGroup(c.cloudProvider, nodeGroupOpts)
+		if !ok {
+			log.WithField("nodegroup", name).Warning("Discovered cloud provider node group does not exist. Skipping")
+			delete(discovered, name)
+			continue
+		}
+		if nodeGroupOpts.autoDiscoverMinMaxNodeOptions() {
+			nodeGroupOpts.MinNodes = int(cloudProviderNodeGroup.MinSize())
+			nodeGroupOpts.MaxNodes = int(cloudProviderNodeGroup.MaxSize())
+		}
+		names = append(names, name)
+
+		// keep the runtime state of node groups discovered in an earlier scan, applying the latest template options
+		if state, ok := c.nodeGroups[name]; ok {
+			state.Opts = nodeGroupOpts
+			state.scaleUpLock.minimumLockDuration = nodeGroupOpts.ScaleUpCoolDownPeriodDuration()
+			continue
+		}
+
+		log.WithField("nodegroup", name).Infof("Discovered cloud provider node group with label %v=%v. Adding node group", nodeGroupOpts.LabelKey, nodeGroupOpts.LabelValue)
+		// nodes also selected by a configured node group are left to it
+		lister := NewNodeGroupLister(c.Client.allPodLister, c.Client.allNodeLister, nodeGroupOpts, c.Opts.NodeGroups...)
+		c.Client.Listers[name] = lister
+		c.nodeGroups[name] = newNodeGroupState(nodeGroupOpts, lister)
+	}
+
+	// stop managing the node groups that are no longer discovered
+	for _, name := range c.discoveredNodeGroups {
+		if _, ok := discovered[name]; !ok {
+			log.WithField("nodegroup", name).Info("Cloud provider node group is no longer discovered. Removing node group")
+			if state, ok := c.nodeGroups[name]; ok {
+				for node := range state.metricNodes {
+					metrics.DeleteNodeMetrics(name, node)
+				}
+				for node, metadata := range state.metricInstances {
+					metrics.DeleteNodeInstanceInfo(name, node, metadata.InstanceType, metadata.AvailabilityZone)
+				}
+				for node := range state.drainingSince {
+					metrics.NodeDrainPodsRemaining.DeleteLabelValues(name, node)
+				}
+			}
+			c.drains.set(name, nil)
+			c.utilization.remove(name)
+			delete(c.nodeGroups, name)
+			delete(c.Client.Listers, name)
+		}
+	}
+
+	sort.Strings(names)
+	c.discoveredNodeGroups = names
+	c.publishConfig()
+	c.applyNodeGroupLogLevels()
+	return nil
+}
+
+// nodeGroupNames returns the names of all the node groups to scan
+// the configured node groups in order followed by the auto discovered node groups
+func (c *Controller) nodeGroupNames() []string {
+	names := make([]string, 0, len(c.nodeGroups))
+	for _, nodeGroupOpts := range c.Opts.NodeGroups {
+		if !nodeGroupOpts.AutoDiscoveryEnabled() {
+			names = append(names, nodeGroupOpts.Name)
+		}
+	}
+	return append(names, c.discoveredNodeGroups...)
+}
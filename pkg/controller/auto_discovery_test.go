@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverNodeGroups(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{
+		{
+			Name:                               "shared",
+			LabelKey:                           "customer",
+			LabelValue:                         "shared",
+			CloudProviderGroupName:             "shared",
+			MinNodes:                           1,
+			MaxNodes:                           10,
+			ScaleUpThresholdPercent:            70,
+			TaintLowerCapacityThresholdPercent: 40,
+			TaintUpperCapacityThresholdPercent: 60,
+			ScaleUpCoolDownPeriod:              "1m",
+		},
+		{
+			Name:                               "discovered",
+			LabelKey:                           "customer",
+			AutoDiscoveryTags:                  map[string]string{"escalator": ""},
+			ScaleUpThresholdPercent:            80,
+			TaintLowerCapacityThresholdPercent: 40,
+			TaintUpperCapacityThresholdPercent: 60,
+			ScaleUpCoolDownPeriod:              "2m",
+		},
+	}
+	nodes := test.BuildTestNodes(2, test.NodeOpts{
+		CPU:        1000,
+		Mem:        1000,
+		LabelKey:   "customer",
+		LabelValue: "ci",
+	})
+	client, opts := buildTestClient(nodes, nil, nodeGroups[:1], ListerOptions{})
+	opts.NodeGroups = nodeGroups
+
+	testCloudProvider := test.NewCloudProvider(3)
+	testCloudProvider.RegisterNodeGroupWithTags(test.NewNodeGroup("shared", 1, 10, 1), map[string]string{"escalator": "true"})
+	testCloudProvider.RegisterNodeGroupWithTags(test.NewNodeGroup("ci-asg", 2, 20, 2), map[string]string{
+		"escalator":                              "true",
+		AutoDiscoveryLabelTagPrefix + "customer": "ci",
+	})
+	testCloudProvider.RegisterNodeGroupWithTags(test.NewNodeGroup("other", 1, 5, 1), map[string]string{"team": "other"})
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups[:1],
+		client:     *client,
+	})
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// the configured shared node group is not discovered again, and the untagged node group is ignored
+	require.NoError(t, controller.discoverNodeGroups())
+	assert.Equal(t, []string{"shared", "ci-asg"}, controller.nodeGroupNames())
+
+	state, ok := controller.nodeGroups["ci-asg"]
+	require.True(t, ok)
+	assert.Equal(t, "ci-asg", state.Opts.CloudProviderGroupName)
+	assert.Equal(t, "customer", state.Opts.LabelKey)
+	assert.Equal(t, "ci", state.Opts.LabelValue)
+	assert.Equal(t, 80, state.Opts.ScaleUpThresholdPercent)
+	assert.Equal(t, 2, state.Opts.MinNodes)
+	assert.Equal(t, 20, state.Opts.MaxNodes)
+
+	discoveredNodes, err := state.Nodes.List()
+	require.NoError(t, err)
+	assert.Len(t, discoveredNodes, 2)
+
+	// the runtime state is kept when discovered again
+	state.scaleDelta = 3
+	require.NoError(t, controller.discoverNodeGroups())
+	assert.Equal(t, 3, controller.nodeGroups["ci-asg"].scaleDelta)
+
+	// the node group is removed once the cloud provider node group is gone
+	testCloudProvider.UnregisterNodeGroup("ci-asg")
+	require.NoError(t, controller.discoverNodeGroups())
+	assert.Equal(t, []string{"shared"}, controller.nodeGroupNames())
+	_, ok = controller.nodeGroups["ci-asg"]
+	assert.False(t, ok)
+	_, ok = controller.Client.Listers["ci-asg"]
+	assert.False(t, ok)
+}
+
+func TestDiscoveredNodeGroupOptionsLabelValue(t *testing.T) {
+	template := NodeGroupOptions{
+		Name:              "discovered",
+		LabelKey:          "customer",
+		AutoDiscoveryTags: map[string]string{"escalator": ""},
+	}
+
+	// without the label tag the label value is the name of the cloud provider node group
+	opts := discoveredNodeGroupOptions(template, cloudprovider.DiscoveredNodeGroup{ID: "asg-1"})
+	assert.Equal(t, "asg-1", opts.Name)
+	assert.Equal(t, "asg-1", opts.LabelValue)
+	assert.False(t, opts.AutoDiscoveryEnabled())
+
+	opts = discoveredNodeGroupOptions(template, cloudprovider.DiscoveredNodeGroup{
+		ID:   "asg-1",
+		Tags: map[string]string{AutoDiscoveryLabelTagPrefix + "customer": "shared"},
+	})
+	assert.Equal(t, "shared", opts.LabelValue)
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// checkScaleUpCapacity compares the size of the cloud provider node group with its target size once the scale lock of
+// a scale up has been released. If the cloud provider couldn't create all of the requested nodes, the shortfall is
+// removed from the target size so the next scale up requests the nodes again, instead of waiting on them forever
+func (c *Controller) checkScaleUpCapacity(nodegroup string, nodeGroup *NodeGroupState) {
+	if !nodeGroup.awaitingCapacity {
+		return
+	}
+	nodeGroup.awaitingCapacity = false
+
+	cloudProviderNodeGroup, ok := getCloudProviderNodeGroup(c.cloudProvider, nodeGroup.Opts)
+	if !ok {
+		return
+	}
+
+	targetSize := cloudProviderNodeGroup.TargetSize()
+	size := cloudProviderNodeGroup.Size()
+	shortfall := targetSize - size
+	if shortfall <= 0 {
+		metrics.NodeGroupCapacityUnavailable.WithLabelValues(nodegroup).Set(0)
+		return
+	}
+	metrics.NodeGroupCapacityUnavailable.WithLabelValues(nodegroup).Set(float64(shortfall))
+	log.WithField("nodegroup", nodegroup).Warningf(
+		"Cloud provider node group has %v of its target size of %v nodes after scaling up. Capacity is unavailable for %v nodes",
+		size,
+		targetSize,
+		shortfall,
+	)
+
+	// the shortfall is checked again once scaling is resumed or the node group is unfrozen
+	if c.scalingPaused(nodeGroup) {
+		nodeGroup.awaitingCapacity = true
+		log.WithField("nodegroup", nodegroup).Infof("Scaling is paused or the node group is frozen. Not decreasing the target size by %v", shortfall)
+		return
+	}
+	if c.dryMode(nodeGroup) {
+		log.WithField("nodegroup", nodegroup).WithField("drymode", "on").Infof("Decreasing the target size by %v", shortfall)
+		return
+	}
+	if nodeGroup.Opts.ModeOrDefault() == NodeGroupModeTaintOnly {
+		log.WithField("nodegroup", nodegroup).Infof("Mode is %v. Would decrease the target size by %v", NodeGroupModeTaintOnly, shortfall)
+		return
+	}
+
+	if err := cloudProviderNodeGroup.DecreaseTargetSize(-shortfall); err != nil {
+		log.WithField("nodegroup", nodegroup).WithError(err).Warning("Failed to decrease the target size to the nodes created")
+		return
+	}
+	log.WithField("nodegroup", nodegroup).Infof("Decreased the target size by %v. The nodes will be requested again by the next scale up", shortfall)
+	c.Opts.AuditLog.TargetSizeDecreased(nodegroup, cloudProviderNodeGroup.ID(), shortfall, cloudProviderNodeGroup.TargetSize(),
+		fmt.Sprintf("cloud provider only created %v of the target size of %v nodes", size, targetSize))
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/audit"
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControllerCheckScaleUpCapacity(t *testing.T) {
+	tests := []struct {
+		name             string
+		awaitingCapacity bool
+		size             int64
+		paused           bool
+		frozen           bool
+		mode             string
+		wantTargetSize   int64
+		wantUnavailable  float64
+		wantAwaiting     bool
+		wantAudit        bool
+	}{
+		{"all nodes created", true, 5, false, false, "", 5, 0, false, false},
+		{"partial scale up", true, 3, false, false, "", 3, 2, false, true},
+		{"no scale up to check", false, 3, false, false, "", 5, 0, false, false},
+		// checked again once resumed or unfrozen
+		{"paused", true, 3, true, false, "", 5, 2, true, false},
+		{"frozen", true, 3, false, true, "", 5, 2, true, false},
+		{"observe", true, 3, false, false, NodeGroupModeObserve, 5, 2, false, false},
+		{"taint only", true, 3, false, false, NodeGroupModeTaintOnly, 5, 2, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                   "capacity",
+				CloudProviderGroupName: "capacity",
+				MinNodes:               1,
+				MaxNodes:               10,
+				Frozen:                 tt.frozen,
+				Mode:                   tt.mode,
+			}}
+			client, opts := buildTestClient(nil, nil, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("capacity", 1, 10, 5)
+			testNodeGroup.SetActualSize(tt.size)
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+			nodeGroupsState["capacity"].awaitingCapacity = tt.awaitingCapacity
+			metrics.NodeGroupCapacityUnavailable.WithLabelValues("capacity").Set(0)
+
+			var auditLog bytes.Buffer
+			opts.AuditLog = audit.New(&auditLog)
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+			if tt.paused {
+				controller.Pause()
+				defer controller.Resume()
+			}
+			controller.checkScaleUpCapacity("capacity", nodeGroupsState["capacity"])
+
+			assert.Equal(t, tt.wantTargetSize, testNodeGroup.TargetSize())
+			assert.Equal(t, tt.wantUnavailable, testutil.ToFloat64(metrics.NodeGroupCapacityUnavailable.WithLabelValues("capacity")))
+			// the shortfall is only checked once per scale up that could act on it
+			require.Equal(t, tt.wantAwaiting, nodeGroupsState["capacity"].awaitingCapacity)
+			if tt.wantAudit {
+				var entry map[string]interface{}
+				require.NoError(t, json.Unmarshal(auditLog.Bytes(), &entry))
+				assert.Equal(t, audit.EventTargetSizeDecreased, entry["event"])
+				assert.Equal(t, float64(2), entry["count"])
+				assert.Equal(t, float64(3), entry["target_size"])
+			} else {
+				assert.Empty(t, auditLog.String())
+			}
+		})
+	}
+}
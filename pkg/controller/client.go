@@ -53,15 +53,7 @@ func NewClient(k8sClient kubernetes.Interface, nodegroups []NodeGroupOptions, st
 	log.Infof("Cache took %v to sync", endTime.Sub(startTime))
 
 	// load in all our node group listers from our nodegroups
-	nodegroupMap := make(map[string]*NodeGroupLister)
-
-	for _, opts := range nodegroups {
-		if opts.Name == DefaultNodeGroup {
-			nodegroupMap[opts.Name] = NewDefaultNodeGroupLister(allPodLister, allNodeLister, opts)
-		} else {
-			nodegroupMap[opts.Name] = NewNodeGroupLister(allPodLister, allNodeLister, opts)
-		}
-	}
+	nodegroupMap := BuildNodeGroupListers(allPodLister, allNodeLister, nodegroups)
 	client := Client{
 		k8sClient,
 		nodegroupMap,
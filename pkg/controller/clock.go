@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of the controller, used for the cool downs, grace periods, scan interval and other timers
+// It is set by Opts.Clock so tests and simulations can move time deterministically, and defaults to the real clock
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// Sleep pauses the current goroutine for at least the duration
+	Sleep(d time.Duration)
+	// After sends the time on the returned channel once the duration has passed
+	After(d time.Duration) <-chan time.Time
+	// NewTicker returns a ticker that sends the time on its channel every period
+	NewTicker(period time.Duration) Ticker
+	// NewTimer returns a timer that sends the time on its channel once the duration has passed
+	NewTimer(d time.Duration) Timer
+}
+
+// Ticker sends the time of its clock every period until it is stopped
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer sends the time of its clock once, unless it is stopped first
+type Timer interface {
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, returning false if it has already fired or been stopped
+	Stop() bool
+}
+
+// clock returns the clock of the controller, the real clock unless Opts.Clock is set
+func (c *Controller) clock() Clock {
+	if c.Opts.Clock == nil {
+		return realClock{}
+	}
+	return c.Opts.Clock
+}
+
+// realClock is the clock of the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTicker(period time.Duration) Ticker {
+	return realTicker{ticker: time.NewTicker(period)}
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{timer: time.NewTimer(d)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// manualClock is a clock that only moves when it is moved by Add or Set, which fire the tickers, timers and After
+// channels that have come due. Sleep moves the clock instead of blocking
+// It freezes the time of a simulation and lets tests drive the cool downs, grace periods and scan loop
+type manualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*manualWaiter
+}
+
+// manualWaiter is a ticker, timer or After channel of a manual clock waiting to fire at next
+type manualWaiter struct {
+	clock *manualClock
+	c     chan time.Time
+	next  time.Time
+	// period is the period of a ticker, zero for a timer
+	period time.Duration
+}
+
+// newManualClock creates a manual clock stopped at now
+func newManualClock(now time.Time) *manualClock {
+	return &manualClock{now: now}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Sleep(d time.Duration) {
+	c.Add(d)
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+func (c *manualClock) NewTicker(period time.Duration) Ticker {
+	if period <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return manualTicker{waiter: c.wait(period, period)}
+}
+
+func (c *manualClock) NewTimer(d time.Duration) Timer {
+	return manualTimer{waiter: c.wait(d, 0)}
+}
+
+// wait adds a waiter firing once d has passed and then every period, if it has one
+func (c *manualClock) wait(d time.Duration, period time.Duration) *manualWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &manualWaiter{clock: c, c: make(chan time.Time, 1), next: c.now.Add(d), period: period}
+	if d <= 0 {
+		// a timer that is already due fires straight away, like the timers of the time package
+		w.c <- c.now
+		if period == 0 {
+			return w
+		}
+		w.next = c.now.Add(period)
+	}
+	c.waiters = append(c.waiters, w)
+	return w
+}
+
+// Add moves the clock forward by the duration
+func (c *manualClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(c.now.Add(d))
+}
+
+// Set moves the clock to the time
+func (c *manualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(t)
+}
+
+// set moves the clock to the time and fires the waiters that have come due. Like the tickers of the time package, a
+// tick is dropped if the last one hasn't been received yet. Must be called with the lock held
+func (c *manualClock) set(t time.Time) {
+	c.now = t
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if !w.next.After(t) {
+			select {
+			case w.c <- t:
+			default:
+			}
+			if w.period == 0 {
+				continue
+			}
+			for !w.next.After(t) {
+				w.next = w.next.Add(w.period)
+			}
+		}
+		waiting = append(waiting, w)
+	}
+	c.waiters = waiting
+}
+
+// stop removes the waiter from its clock, returning false if it wasn't waiting
+func (w *manualWaiter) stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	for i, waiting := range w.clock.waiters {
+		if waiting == w {
+			w.clock.waiters = append(w.clock.waiters[:i], w.clock.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type manualTicker struct {
+	waiter *manualWaiter
+}
+
+func (t manualTicker) C() <-chan time.Time {
+	return t.waiter.c
+}
+
+func (t manualTicker) Stop() {
+	t.waiter.stop()
+}
+
+type manualTimer struct {
+	waiter *manualWaiter
+}
+
+func (t manualTimer) C() <-chan time.Time {
+	return t.waiter.c
+}
+
+func (t manualTimer) Stop() bool {
+	return t.waiter.stop()
+}
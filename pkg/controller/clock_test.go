@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// advanceWhileWaiting moves the clock forward by d whenever something is waiting on it, until the returned func is
+// called. It lets a test run code that blocks on the clock without knowing how long it will wait
+func advanceWhileWaiting(c *manualClock, d time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+			}
+			c.mu.Lock()
+			if len(c.waiters) > 0 {
+				c.set(c.now.Add(d))
+			}
+			c.mu.Unlock()
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func TestManualClockTimer(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := newManualClock(start)
+
+	timer := clock.NewTimer(time.Minute)
+	clock.Add(59 * time.Second)
+	assert.Len(t, timer.C(), 0)
+	assert.Equal(t, start.Add(59*time.Second), clock.Now())
+
+	clock.Add(time.Second)
+	assert.Equal(t, start.Add(time.Minute), <-timer.C())
+	assert.False(t, timer.Stop(), "a fired timer can't be stopped")
+
+	// stopped timers never fire
+	timer = clock.NewTimer(time.Minute)
+	assert.True(t, timer.Stop())
+	clock.Add(time.Hour)
+	assert.Len(t, timer.C(), 0)
+
+	// due timers fire straight away
+	assert.Equal(t, start.Add(time.Hour+time.Minute), <-clock.After(0))
+}
+
+func TestManualClockTicker(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := newManualClock(start)
+
+	ticker := clock.NewTicker(time.Minute)
+	clock.Add(time.Minute)
+	assert.Equal(t, start.Add(time.Minute), <-ticker.C())
+
+	// ticks that aren't received are dropped
+	clock.Add(time.Minute)
+	clock.Add(time.Minute)
+	assert.Equal(t, start.Add(2*time.Minute), <-ticker.C())
+	assert.Len(t, ticker.C(), 0)
+
+	clock.Set(start.Add(10 * time.Minute))
+	assert.Equal(t, start.Add(10*time.Minute), <-ticker.C())
+
+	ticker.Stop()
+	clock.Add(time.Minute)
+	assert.Len(t, ticker.C(), 0)
+}
+
+func TestManualClockSleep(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := newManualClock(start)
+
+	after := clock.After(time.Second)
+	clock.Sleep(5 * time.Second)
+	assert.Equal(t, start.Add(5*time.Second), clock.Now())
+	assert.Equal(t, start.Add(5*time.Second), <-after)
+}
+
+func TestControllerClockDefaultsToRealClock(t *testing.T) {
+	controller := &Controller{}
+	assert.Equal(t, realClock{}, controller.clock())
+
+	clock := newManualClock(time.Now())
+	controller.Opts.Clock = clock
+	assert.Equal(t, clock, controller.clock())
+}
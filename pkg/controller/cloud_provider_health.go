@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// CheckCloudProvider checks the cloud provider credentials have the permissions escalator needs, if the cloud provider
+// implements cloudprovider.PermissionChecker. Called at startup so missing credentials or permissions are surfaced
+// straight away rather than on the first scale action. Returns why the check failed
+func (c *Controller) CheckCloudProvider() error {
+	checker, ok := c.cloudProvider.(cloudprovider.PermissionChecker)
+	if !ok {
+		metrics.CloudProviderHealthy.Set(1)
+		return nil
+	}
+	c.cloudProviderPermissionErr = checker.CheckPermissions()
+	setCloudProviderHealthy(c.cloudProviderPermissionErr == nil)
+	return c.cloudProviderPermissionErr
+}
+
+// updateCloudProviderHealth updates the cloud provider health after the cloud provider is refreshed at the start of a
+// scan. A failed permission check is retried once a refresh succeeds, so fixing the permissions doesn't need a restart
+func (c *Controller) updateCloudProviderHealth(refreshErr error) {
+	if refreshErr != nil {
+		setCloudProviderHealthy(false)
+		return
+	}
+	if c.cloudProviderPermissionErr == nil {
+		setCloudProviderHealthy(true)
+		return
+	}
+	if err := c.CheckCloudProvider(); err != nil {
+		log.WithError(err).Error("Cloud provider credentials are still missing permissions. Scale actions may fail")
+		return
+	}
+	log.Info("Cloud provider credentials passed the permission check")
+}
+
+// setCloudProviderHealthy sets the cloud provider healthy metric
+func setCloudProviderHealthy(healthy bool) {
+	if healthy {
+		metrics.CloudProviderHealthy.Set(1)
+	} else {
+		metrics.CloudProviderHealthy.Set(0)
+	}
+}
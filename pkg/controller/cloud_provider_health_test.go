@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// permissionCheckingCloudProvider is a test cloud provider whose permission check returns err
+type permissionCheckingCloudProvider struct {
+	*test.CloudProvider
+	err    error
+	checks int
+}
+
+func (p *permissionCheckingCloudProvider) CheckPermissions() error {
+	p.checks++
+	return p.err
+}
+
+func TestControllerCheckCloudProvider(t *testing.T) {
+	// cloud providers that can't check their permissions are assumed to be healthy
+	controller := &Controller{cloudProvider: test.NewCloudProvider(1)}
+	assert.NoError(t, controller.CheckCloudProvider())
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.CloudProviderHealthy))
+
+	cloudProvider := &permissionCheckingCloudProvider{
+		CloudProvider: test.NewCloudProvider(1),
+		err:           errors.New("not authorized"),
+	}
+	controller = &Controller{cloudProvider: cloudProvider}
+	assert.EqualError(t, controller.CheckCloudProvider(), "not authorized")
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.CloudProviderHealthy))
+
+	// the failed check is retried after every successful refresh until it passes
+	controller.updateCloudProviderHealth(errors.New("refresh failed"))
+	assert.Equal(t, 1, cloudProvider.checks)
+	controller.updateCloudProviderHealth(nil)
+	assert.Equal(t, 2, cloudProvider.checks)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.CloudProviderHealthy))
+
+	cloudProvider.err = nil
+	controller.updateCloudProviderHealth(nil)
+	assert.Equal(t, 3, cloudProvider.checks)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.CloudProviderHealthy))
+
+	// once passed, only the refreshes count
+	controller.updateCloudProviderHealth(nil)
+	assert.Equal(t, 3, cloudProvider.checks)
+	controller.updateCloudProviderHealth(errors.New("refresh failed"))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.CloudProviderHealthy))
+}
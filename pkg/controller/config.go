@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"sync"
+)
+
+// effectiveConfig holds the options of every node group being scanned with their defaults applied
+// it is updated by the scans and read by the /config endpoint
+type effectiveConfig struct {
+	sync.Mutex
+	nodeGroups []NodeGroupOptions
+}
+
+// set replaces the effective options
+func (e *effectiveConfig) set(nodeGroups []NodeGroupOptions) {
+	e.Lock()
+	defer e.Unlock()
+	e.nodeGroups = nodeGroups
+}
+
+// get returns the effective options, in the order the node groups are scanned
+func (e *effectiveConfig) get() []NodeGroupOptions {
+	e.Lock()
+	defer e.Unlock()
+	nodeGroups := make([]NodeGroupOptions, len(e.nodeGroups))
+	copy(nodeGroups, e.nodeGroups)
+	return nodeGroups
+}
+
+// publishConfig updates the effective options served by the /config endpoint from the node groups being scanned
+// it is called whenever the options of the node groups can change: reloads and auto discovery
+func (c *Controller) publishConfig() {
+	names := c.nodeGroupNames()
+	nodeGroups := make([]NodeGroupOptions, 0, len(names))
+	for _, name := range names {
+		if state, ok := c.nodeGroups[name]; ok {
+			nodeGroups = append(nodeGroups, state.Opts.withDefaults())
+		}
+	}
+	c.config.set(nodeGroups)
+}
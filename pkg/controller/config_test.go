@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeGroupOptionsWithDefaults(t *testing.T) {
+	disabled := false
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                  "default",
+		CPUOvercommitRatio:    1.5,
+		RespectExternalCordon: &disabled,
+		NodeSelectionMethod:   NodeSelectionMethodStable,
+	}
+
+	effective := nodeGroupOpts.withDefaults()
+	assert.Equal(t, DefaultScaleUpPodPhases, effective.ScaleUpPodPhases)
+	assert.False(t, *effective.RespectExternalCordon)
+	assert.Equal(t, 1.5, effective.CPUOvercommitRatio)
+	assert.Equal(t, float64(1), effective.MemoryOvercommitRatio)
+	assert.Equal(t, DefaultMaxScaleDownFraction, effective.MaxScaleDownFraction)
+	assert.Equal(t, 1, effective.ScaleDownNodeDeleteBatchSize)
+	assert.Equal(t, UtilizationMethodAggregate, effective.UtilizationMethod)
+	assert.Equal(t, NodeSelectionMethodStable, effective.NodeSelectionMethod)
+	assert.Equal(t, "5m0s", effective.SaturationGracePeriod)
+	assert.Equal(t, LabelMismatchActionIgnore, effective.LabelMismatchAction)
+	assert.Equal(t, NodeGroupModeActive, effective.Mode)
+
+	// the options themselves are left unchanged
+	assert.Empty(t, nodeGroupOpts.ScaleUpPodPhases)
+	assert.Empty(t, nodeGroupOpts.UtilizationMethod)
+
+	// the effective options have the same behaviour as the options
+	assert.Equal(t, nodeGroupOpts.SaturationGracePeriodDuration(), effective.SaturationGracePeriodDuration())
+}
+
+func TestConfigHandler(t *testing.T) {
+	nodeGroupOptions := NodeGroupOptions{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		ScaleUpCoolDownPeriod:              "1m",
+	}
+	nodeGroups := []NodeGroupOptions{nodeGroupOptions}
+	nodes := buildTestNodes(2, 1000, 1000)
+	client, opts := buildTestClient(nodes, nil, nodeGroups, ListerOptions{})
+	opts.AdminToken = "secret"
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testCloudProvider.RegisterNodeGroup(test.NewNodeGroup("default", 1, 10, int64(len(nodes))))
+
+	controller := &Controller{
+		Client: client,
+		Opts:   opts,
+		nodeGroups: BuildNodeGroupsState(nodeGroupsStateOpts{
+			nodeGroups: nodeGroups,
+			client:     *client,
+		}),
+		cloudProvider: testCloudProvider,
+	}
+	mux := http.NewServeMux()
+	controller.RegisterHandlers(mux)
+
+	getConfig := func(authorization string) (int, []NodeGroupOptions) {
+		request := httptest.NewRequest(http.MethodGet, "/config", nil)
+		if len(authorization) > 0 {
+			request.Header.Set("Authorization", authorization)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK {
+			return recorder.Code, nil
+		}
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		var config []NodeGroupOptions
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &config))
+		return recorder.Code, config
+	}
+
+	// the config can contain sensitive options so requires the admin token
+	code, _ := getConfig("")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	require.NoError(t, controller.RunOnce())
+	code, config := getConfig("Bearer secret")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, config, 1)
+	assert.Equal(t, 70, config[0].ScaleUpThresholdPercent)
+	assert.Equal(t, UtilizationMethodAggregate, config[0].UtilizationMethod)
+	assert.Equal(t, DefaultScaleUpPodPhases, config[0].ScaleUpPodPhases)
+
+	// reloaded options are served once they are applied
+	reloaded := nodeGroupOptions
+	reloaded.ScaleUpThresholdPercent = 80
+	controller.ReloadNodeGroups([]NodeGroupOptions{reloaded})
+	_, config = getConfig("Bearer secret")
+	assert.Equal(t, 70, config[0].ScaleUpThresholdPercent)
+	require.NoError(t, controller.RunOnce())
+	_, config = getConfig("Bearer secret")
+	assert.Equal(t, 80, config[0].ScaleUpThresholdPercent)
+}
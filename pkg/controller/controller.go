@@ -1,16 +1,23 @@
 package controller
 
 import (
-	"math"
+	"context"
+	"fmt"
 	"time"
 
+	"github.com/atlassian/escalator/pkg/audit"
 	"github.com/atlassian/escalator/pkg/cloudprovider"
+	"github.com/atlassian/escalator/pkg/eventstream"
 	"github.com/atlassian/escalator/pkg/k8s"
 	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/tracing"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/kubernetes/pkg/scheduler/cache"
 )
 
@@ -21,6 +28,36 @@ type Controller struct {
 	stopChan      <-chan struct{}
 	cloudProvider cloudprovider.CloudProvider
 	nodeGroups    map[string]*NodeGroupState
+	pause         pauseState
+
+	// scanTrigger holds at most one pending manual scan request
+	scanTrigger chan struct{}
+	// lastScan is when the last scan was started
+	lastScan time.Time
+	// scanDeadline is when the current scan passes the scan timeout. Zero if there is no scan timeout
+	scanDeadline time.Time
+	// reload holds reloaded node group options until the next scan
+	reload reloadState
+	// discoveredNodeGroups are the names of the node groups created by auto discovery, sorted
+	discoveredNodeGroups []string
+	// summaries are the scale actions of each node group since starting, logged on shutdown
+	summaries map[string]*nodeGroupSummary
+	// statuses are what was last seen and done for each node group, written to their custom resources every scan
+	statuses map[string]*nodeGroupStatus
+	// drains is the progress of the nodes being drained, served by the /drains endpoint
+	drains drainReports
+	// utilization is the recent utilization of each node group, served by the /recommendations endpoint
+	utilization utilizationHistories
+	// config is the effective options of the node groups, served by the /config endpoint
+	config effectiveConfig
+	// deletionLimiter limits the rate of node deletions across all node groups, nil if there is no limit
+	deletionLimiter *deletionLimiter
+	// apiUnreachable is whether the kubernetes API server was unreachable at the start of the last scan
+	apiUnreachable bool
+	// cloudProviderPermissionErr is why the last permission check of the cloud provider failed, nil if it passed
+	cloudProviderPermissionErr error
+	// listers are the listers of the resources only some node group options read, started when first needed
+	listers resourceListers
 }
 
 // NodeGroupState contains everything about a node group in the current state of the application
@@ -36,15 +73,115 @@ type NodeGroupState struct {
 	// used for tracking scale delta across runs, useful for reducing hysteresis
 	scaleDelta   int
 	lastScaleOut time.Time
+	// scaleUpTrigger is the last scale up that added nodes whilst they are being annotated with it
+	// only set with annotate_scale_up_trigger
+	scaleUpTrigger *scaleUpTrigger
+
+	// awaitingCapacity is whether nodes were requested from the cloud provider by the last scale up and haven't been
+	// checked for a shortfall yet
+	awaitingCapacity bool
+
+	// scaleHistory are the scale ups and scale downs within the flap_detection_window, oldest first
+	scaleHistory []scaleEvent
+	// flapping is whether the node group was flapping when last checked
+	flapping bool
+
+	// reconcilingAboveMax is whether the startup reconcile tainted the node group down towards max_nodes. Its expired
+	// tainted nodes are deleted whilst it is above max_nodes only until it is back within max_nodes once
+	reconcilingAboveMax bool
+
+	// lastScaleUp is when nodes were last added to or untainted in the node group, used for scale_down_delay_after_add
+	lastScaleUp time.Time
+	// lastEmergencyScaleUp is when the node group was last scaled up for pods pending longer than
+	// emergency_pending_timeout, used for emergency_scale_up_cool_down_period
+	lastEmergencyScaleUp time.Time
+
+	// saturatedSince is when a scale up was first blocked by max_nodes, zero if the last scale up wasn't blocked
+	saturatedSince time.Time
+	// saturated is whether the node group has been blocked by max_nodes for longer than saturation_grace_period
+	saturated bool
+
+	// minNodesWastefulSince is when the demand first needed fewer nodes than min_nodes, zero if the last scan needed at
+	// least min_nodes
+	minNodesWastefulSince time.Time
+	// minNodesWasteful is whether the demand has needed fewer nodes than min_nodes for longer than
+	// min_nodes_waste_grace_period
+	minNodesWasteful bool
+
+	// pendingSince tracks when each pending pod was first seen, used for scale_up_confirmation_delay and
+	// emergency_pending_timeout
+	pendingSince map[types.UID]time.Time
+
+	// orphanedSince tracks when each orphaned node was first seen, used for cleanup_orphan_nodes
+	orphanedSince nodeTimes
+
+	// drainingSince tracks when pods were evicted from each node being drained, used for drain_timeout
+	drainingSince nodeTimes
+	// drainingPods tracks the pods remaining on each node being drained, reported by the /drains endpoint
+	drainingPods map[string]int
+	// evictionsBlocked tracks the nodes being drained whose evictions were refused by a pod disruption budget, and
+	// when they are retried
+	evictionsBlocked map[string]evictionRetry
+
+	// metricSourceUnhealthy is whether a metric source the node group scales on, e.g. the queue length, couldn't be
+	// read in the last scan. Scale downs are suppressed whilst it is unhealthy
+	metricSourceUnhealthy bool
+
+	// scanBackoff tracks how often the node group is scanned whilst it takes no action, used for --max-scan-backoff
+	scanBackoff scanBackoff
+
+	// smoothedUtilization is the utilization smoothed across scans, used for utilization_smoothing_factor
+	smoothedUtilization smoothedUtilization
+
+	// metricNodes are the nodes node level metrics were last set for, so the metrics of removed nodes can be deleted
+	metricNodes map[string]bool
+	// metricInstances are the instance metadata the node instance info metric was last set with for each node
+	metricInstances map[string]cloudprovider.InstanceMetadata
+
+	// instanceMetadata is the metadata of the instances backing the nodes, looked up every scan from the cloud provider
+	// node group and added to the logs of scale actions on the nodes
+	instanceMetadata map[string]cloudprovider.InstanceMetadata
 }
 
+// nodeTimes maps node names to a time
+type nodeTimes map[string]time.Time
+
 // Opts provide the Controller with config for runtime
 type Opts struct {
 	K8SClient            kubernetes.Interface
 	NodeGroups           []NodeGroupOptions
 	CloudProviderBuilder cloudprovider.Builder
 	ScanInterval         time.Duration
+	MinScanInterval      time.Duration
 	DryMode              bool
+	ReconcileOnStartup   bool
+	Paused               bool
+	// AdminToken is the bearer token required by the admin endpoints. The endpoints are unauthenticated if empty
+	AdminToken string
+	// NodeMetrics enables setting the node level metrics, which must be registered with metrics.RegisterNodeMetrics
+	NodeMetrics bool
+	// MaxDeletionsPerMinute is the maximum number of nodes deleted a minute across all node groups. Unlimited if 0
+	MaxDeletionsPerMinute int
+	// MetricsSinks receive the scale decisions and utilization of every node group, flushed at the end of every scan
+	MetricsSinks []metrics.Sink
+	// AuditLog records every node created or destroyed in the cloud provider. Disabled if nil
+	AuditLog *audit.Logger
+	// EventStream receives an event for every scale decision and action of the node groups. Disabled if nil
+	EventStream *eventstream.Stream
+	// EventRecorder records kubernetes events about the node groups against EventObject, normally escalator's pod
+	// Events are not recorded if either is nil
+	EventRecorder record.EventRecorder
+	EventObject   *v1.ObjectReference
+	// MaxScanBackoff is the longest a node group that keeps taking no action can go between scans. Disabled if 0
+	MaxScanBackoff time.Duration
+	// ScanTimeout is the longest a scan can take before it is aborted. Disabled if 0
+	ScanTimeout time.Duration
+	// StatusClient updates the status of the NodeGroupResource of each node group at the end of every scan
+	// Statuses are not updated if nil
+	StatusClient dynamic.Interface
+	// Clock is the time of the cool downs, grace periods, scan interval and other timers. Defaults to the real clock if
+	// nil
+	Clock Clock
 }
 
 // scaleOpts provides options for a scale function
@@ -55,15 +192,40 @@ type scaleOpts struct {
 	untaintedNodes []*v1.Node
 	nodeGroup      *NodeGroupState
 	nodesDelta     int
+	// ctx carries the tracing span of the current scan, may be nil
+	ctx context.Context
+	// reason is why nodes are being added, recorded in the audit log
+	reason string
+	// pods are the pods of the node group, the pending pods of which are recorded as the trigger of a scale up
+	pods []*v1.Pod
+	// shuttingDownNodes are the tainted nodes waiting for node_shutdown_grace_period, left out of the other nodes
+	shuttingDownNodes []*v1.Node
 }
 
 // NewController creates a new controller with the specified options
 func NewController(opts Opts, stopChan <-chan struct{}) (*Controller, error) {
-	client, err := NewClient(opts.K8SClient, opts.NodeGroups, stopChan)
+	client, err := NewClient(opts.K8SClient, configuredNodeGroups(opts.NodeGroups), stopChan)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create controller client")
 	}
+	return newControllerWithClient(opts, client, stopChan)
+}
+
+// configuredNodeGroups returns the node groups that aren't auto discovery templates
+// auto discovery node groups are templates, the node groups they discover are added once the cloud provider is built
+func configuredNodeGroups(nodeGroups []NodeGroupOptions) []NodeGroupOptions {
+	configured := make([]NodeGroupOptions, 0, len(nodeGroups))
+	for _, nodeGroupOpts := range nodeGroups {
+		if !nodeGroupOpts.AutoDiscoveryEnabled() {
+			configured = append(configured, nodeGroupOpts)
+		}
+	}
+	return configured
+}
 
+// newControllerWithClient creates a new controller with the specified options that lists pods and nodes through the
+// client, which must have the listers of the configured node groups
+func newControllerWithClient(opts Opts, client *Client, stopChan <-chan struct{}) (*Controller, error) {
 	cloud, err := opts.CloudProviderBuilder.Build()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create cloudprovider")
@@ -71,8 +233,8 @@ func NewController(opts Opts, stopChan <-chan struct{}) (*Controller, error) {
 
 	// turn it into a map of name and nodegroupstate for O(1) lookup and data bundling
 	nodegroupMap := make(map[string]*NodeGroupState)
-	for _, nodeGroupOpts := range opts.NodeGroups {
-		cloudProviderNodeGroup, ok := cloud.GetNodeGroup(nodeGroupOpts.CloudProviderGroupName)
+	for _, nodeGroupOpts := range configuredNodeGroups(opts.NodeGroups) {
+		cloudProviderNodeGroup, ok := getCloudProviderNodeGroup(cloud, nodeGroupOpts)
 		if !ok {
 			return nil, errors.Errorf("could not find node group \"%v\" on cloud provider", nodeGroupOpts.CloudProviderGroupName)
 		}
@@ -85,30 +247,50 @@ func NewController(opts Opts, stopChan <-chan struct{}) (*Controller, error) {
 			log.Debugf("auto discovered max_nodes = %v for node group %v", nodeGroupOpts.MaxNodes, nodeGroupOpts.Name)
 		}
 
-		nodegroupMap[nodeGroupOpts.Name] = &NodeGroupState{
-			Opts:            nodeGroupOpts,
-			NodeGroupLister: client.Listers[nodeGroupOpts.Name],
-			// Setup the scaleLock timeouts for this nodegroup
-			scaleUpLock: scaleLock{
-				minimumLockDuration: nodeGroupOpts.ScaleUpCoolDownPeriodDuration(),
-				nodegroup:           nodeGroupOpts.Name,
-			},
-			scaleDelta: 0,
-		}
+		nodegroupMap[nodeGroupOpts.Name] = newNodeGroupState(nodeGroupOpts, client.Listers[nodeGroupOpts.Name])
 	}
 
-	return &Controller{
+	controller := &Controller{
 		Client:        client,
 		Opts:          opts,
 		stopChan:      stopChan,
 		cloudProvider: cloud,
 		nodeGroups:    nodegroupMap,
-	}, nil
+		scanTrigger:   make(chan struct{}, 1),
+	}
+	controller.pause.set(opts.Paused)
+	if opts.MaxDeletionsPerMinute > 0 {
+		controller.deletionLimiter = newDeletionLimiter(opts.MaxDeletionsPerMinute, controller.clock().Now())
+	}
+	if err := controller.discoverNodeGroups(); err != nil {
+		return nil, errors.Wrap(err, "failed to auto discover node groups")
+	}
+	return controller, nil
+}
+
+// newNodeGroupState creates the state of a node group with its scale lock
+func newNodeGroupState(nodeGroupOpts NodeGroupOptions, lister *NodeGroupLister) *NodeGroupState {
+	return &NodeGroupState{
+		Opts:            nodeGroupOpts,
+		NodeGroupLister: lister,
+		// Setup the scaleLock timeouts for this nodegroup
+		scaleUpLock: scaleLock{
+			minimumLockDuration: nodeGroupOpts.ScaleUpCoolDownPeriodDuration(),
+			nodegroup:           nodeGroupOpts.Name,
+		},
+		scaleDelta: 0,
+	}
+}
+
+// getCloudProviderNodeGroup returns the cloud provider node group for the node group
+// node groups made up of multiple cloud provider node groups are combined into a single logical node group
+func getCloudProviderNodeGroup(cloud cloudprovider.CloudProvider, opts NodeGroupOptions) (cloudprovider.NodeGroup, bool) {
+	return cloudprovider.GetMultiNodeGroup(cloud, opts.CloudProviderGroupName, opts.CloudProviderGroupNameList()...)
 }
 
 // dryMode is a helper that returns the overall drymode result of the controller and nodegroup
 func (c *Controller) dryMode(nodeGroup *NodeGroupState) bool {
-	return c.Opts.DryMode || nodeGroup.Opts.DryMode
+	return c.Opts.DryMode || nodeGroup.Opts.ModeOrDefault() == NodeGroupModeObserve
 }
 
 // filterNodes separates nodes between tainted and untainted nodes
@@ -133,11 +315,14 @@ func (c *Controller) filterNodes(nodeGroup *NodeGroupState, allNodes []*v1.Node)
 			}
 		} else {
 			// If the node is Unschedulable (cordoned), separate it out from the tainted/untainted
-			if node.Spec.Unschedulable {
+			// unless respect_external_cordon is disabled, when cordoned nodes are still part of the capacity
+			// Tainted nodes cordoned by cordon_before_drain are still being removed, so stay tainted
+			_, tainted := k8s.GetToBeRemovedTaint(node)
+			if node.Spec.Unschedulable && nodeGroup.Opts.RespectExternalCordonEnabled() && !(tainted && nodeGroup.Opts.CordonBeforeDrain) {
 				cordonedNodes = append(cordonedNodes, node)
 				continue
 			}
-			if _, tainted := k8s.GetToBeRemovedTaint(node); !tainted {
+			if !tainted {
 				untaintedNodes = append(untaintedNodes, node)
 			} else {
 				taintedNodes = append(taintedNodes, node)
@@ -184,7 +369,23 @@ func (c *Controller) calculateNewNodeMetrics(nodegroup string, nodeGroup *NodeGr
 }
 
 // scaleNodeGroup performs the core logic of calculating util and selecting a scaling action for a node group
-func (c *Controller) scaleNodeGroup(nodegroup string, nodeGroup *NodeGroupState) (int, error) {
+func (c *Controller) scaleNodeGroup(nodegroup string, nodeGroup *NodeGroupState) (_ int, err error) {
+	ctx, span := tracing.StartSpan(context.Background(), "ScaleNodeGroup", tracing.String("nodegroup", nodegroup))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	// frozen node groups are still scanned so their metrics are published, but take no scale actions
+	if nodeGroup.Opts.Frozen {
+		log.WithField("nodegroup", nodegroup).Info("Node group is frozen. No scale actions will be performed until it is unfrozen")
+		metrics.NodeGroupFrozen.WithLabelValues(nodegroup).Set(1)
+	} else {
+		metrics.NodeGroupFrozen.WithLabelValues(nodegroup).Set(0)
+	}
+
+	// the nodes protected from being tainted are counted by the scale down, so there are none in a scan without one
+	metrics.NodeGroupLocalStorageProtectedNodes.WithLabelValues(nodegroup).Set(0)
+	metrics.NodeGroupRolloutDeferredNodes.WithLabelValues(nodegroup).Set(0)
+	metrics.NodeGroupReplicaSpreadProtectedNodes.WithLabelValues(nodegroup).Set(0)
+
 	// list all pods
 	pods, err := nodeGroup.Pods.List()
 	if err != nil {
@@ -199,9 +400,82 @@ func (c *Controller) scaleNodeGroup(nodegroup string, nodeGroup *NodeGroupState)
 		return 0, err
 	}
 
+	// A bogus cloud provider read would make every node look orphaned or mislabelled, so nothing acts on the nodes
+	// until the cloud provider node group size agrees with them again
+	if c.cloudProviderSizeDiverged(nodegroup, nodeGroup, len(allNodes)) {
+		return 0, errors.New("cloud provider node group size diverges from the node count")
+	}
+
+	// Nodes another autoscaler or tool is deleting are left to it, they aren't capacity and are never picked, cleaned
+	// up or deleted by escalator
+	allNodes, externalDeletionNodes := filterExternalDeletionNodes(allNodes, nodeGroup.Opts.ExternalDeletionTaints)
+	if len(externalDeletionNodes) > 0 {
+		log.WithField("nodegroup", nodegroup).Infof("Ignoring %v nodes marked for deletion by another tool with one of the external_deletion_taints", len(externalDeletionNodes))
+	}
+	metrics.NodeGroupNodesExternalDeletion.WithLabelValues(nodegroup).Set(float64(len(externalDeletionNodes)))
+
+	// Nodes waiting for node_shutdown_grace_period are only terminated once it has passed, they aren't counted or
+	// cleaned up in the meantime
+	allNodes, shuttingDownNodes := filterShuttingDownNodes(allNodes)
+	if len(shuttingDownNodes) > 0 {
+		log.WithField("nodegroup", nodegroup).Infof("%v nodes are waiting for node_shutdown_grace_period before being terminated", len(shuttingDownNodes))
+	}
+
+	// Delete nodes whose cloud provider instance no longer exists so they don't skew the node counts
+	if nodeGroup.Opts.CleanupOrphanNodes {
+		allNodes = c.cleanupOrphanNodes(nodegroup, nodeGroup, allNodes)
+	}
+
+	// Handle nodes that use capacity in the cloud provider node group but aren't labelled as part of the node group
+	c.reconcileLabelMismatchNodes(nodegroup, nodeGroup)
+
+	// Record which scale up added the nodes that have registered since the last scan
+	c.annotateScaleUpNodes(nodeGroup, allNodes)
+
+	// Look up the instance metadata of the nodes so it can be added to the logs and node level metrics
+	c.updateInstanceMetadata(nodeGroup, allNodes)
+
 	// Filter into untainted and tainted nodes
 	untaintedNodes, taintedNodes, cordonedNodes := c.filterNodes(nodeGroup, allNodes)
 
+	// Only the unscheduled pods in the scale_up_pod_phases demand capacity
+	pods, ignoredPods := filterPodsDemandingCapacity(pods, nodeGroup.Opts.ScaleUpPodPhasesOrDefault())
+	if ignoredPods > 0 {
+		log.WithField("nodegroup", nodegroup).Infof("Ignoring %v unscheduled pods that aren't in the scale_up_pod_phases %v", ignoredPods, nodeGroup.Opts.ScaleUpPodPhasesOrDefault())
+	}
+
+	// Pending pods that can't be scheduled onto the node group's nodes shouldn't cause it to scale up
+	pods, unmatchedPods := filterPodsMatchingNodes(pods, allNodes)
+	if unmatchedPods > 0 {
+		log.WithField("nodegroup", nodegroup).Infof("Ignoring %v pending pods whose node selector, affinity or extended resources don't match the node group's nodes", unmatchedPods)
+	}
+
+	// Pending pods that already fit on one of the nodes are waiting for something other than capacity, e.g. a volume
+	// attaching, so can optionally be kept from triggering a scale up. They are still scheduled onto the existing nodes,
+	// so their requests are kept in the utilization
+	var fittingPods []*v1.Pod
+	if nodeGroup.Opts.IgnorePendingPodsThatFit {
+		memReserved, cpuReserved := nodeGroup.Opts.NodeResourceReservation.Quantities()
+		pods, fittingPods = filterPendingPodsFittingNodes(pods, untaintedNodes, memReserved, cpuReserved)
+		if len(fittingPods) > 0 {
+			log.WithField("nodegroup", nodegroup).Infof("Not triggering a scale up for %v pending pods that fit in the free capacity of the existing nodes", len(fittingPods))
+		}
+	}
+
+	// Pending pods only count towards a scale up once they've been pending for scale_up_confirmation_delay
+	pods, unconfirmedPods, emergencyPods := filterUnconfirmedPendingPods(nodegroup, nodeGroup, pods, c.clock().Now())
+	if unconfirmedPods > 0 {
+		log.WithField("nodegroup", nodegroup).Infof("Ignoring %v pending pods that haven't been pending for scale_up_confirmation_delay yet", unconfirmedPods)
+	}
+	if emergencyPods > 0 {
+		log.WithField("nodegroup", nodegroup).Warningf("%v pods have been pending for longer than emergency_pending_timeout", emergencyPods)
+		// within the emergency cool down the pods only count towards a normal scale up
+		if coolDown := nodeGroup.Opts.EmergencyScaleUpCoolDownPeriodDuration(); coolDown > 0 && c.clock().Now().Sub(nodeGroup.lastEmergencyScaleUp) < coolDown {
+			log.WithField("nodegroup", nodegroup).Infof("Waiting for emergency_scale_up_cool_down_period of %v since the last emergency scale up", coolDown)
+			emergencyPods = 0
+		}
+	}
+
 	// Metrics and Logs
 	log.WithField("nodegroup", nodegroup).Infof("pods total: %v", len(pods))
 	log.WithField("nodegroup", nodegroup).Infof("nodes remaining total: %v", len(allNodes))
@@ -217,6 +491,12 @@ func (c *Controller) scaleNodeGroup(nodegroup string, nodeGroup *NodeGroupState)
 	// We want to be really simple right now so we don't do anything if we are outside the range of allowed nodes
 	// We assume it is a config error or something bad has gone wrong in the cluster
 	if len(allNodes) == 0 {
+		// the utilization can't be calculated without nodes, but a node group scaled to zero can still be scaled up
+		// from zero on demand that doesn't depend on its nodes, such as the length of its queue or a CronJob about to
+		// be scheduled
+		if nodesDelta, reason := c.calcScaleFromZeroDelta(nodegroup, nodeGroup); nodesDelta > 0 {
+			return c.scaleUpFromZero(ctx, span, nodegroup, nodeGroup, nodesDelta, reason, pods)
+		}
 		err = errors.New("no nodes remaining")
 		log.WithField("nodegroup", nodegroup).Warning(err.Error())
 		return 0, err
@@ -237,47 +517,137 @@ func (c *Controller) scaleNodeGroup(nodegroup string, nodeGroup *NodeGroupState)
 			len(allNodes),
 			nodeGroup.Opts.MaxNodes,
 		)
+		// only the nodes tainted by the startup reconcile are deleted whilst a node group is above the maximum,
+		// otherwise nodes are left for whatever changed the size of the node group to correct
+		if c.scalingPaused(nodeGroup) || !nodeGroup.reconcilingAboveMax {
+			return 0, err
+		}
+		// Still reap expired tainted nodes so a node group tainted back towards the maximum can recover
+		nodeGroup.NodeInfoMap = k8s.CreateNodeNameToInfoMap(pods, append(shuttingDownNodes, allNodes...))
+		removed, reapErr := c.TryRemoveTaintedNodes(scaleOpts{
+			nodes:             allNodes,
+			taintedNodes:      taintedNodes,
+			untaintedNodes:    untaintedNodes,
+			shuttingDownNodes: shuttingDownNodes,
+			nodeGroup:         nodeGroup,
+			ctx:               ctx,
+		})
+		if reapErr != nil {
+			log.WithField("nodegroup", nodegroup).WithError(reapErr).Warning("Reaping nodes failed")
+		}
+		log.WithField("nodegroup", nodegroup).Infof("Reaper: There were %v empty nodes deleted this round", removed)
 		return 0, err
 	}
+	// the startup reconcile is done once the node group is within the maximum, it isn't repeated if it goes above again
+	nodeGroup.reconcilingAboveMax = false
 
 	// update the map of node to nodeinfo
 	// for working out which pods are on which nodes
-	nodeGroup.NodeInfoMap = k8s.CreateNodeNameToInfoMap(pods, allNodes)
+	nodeGroup.NodeInfoMap = k8s.CreateNodeNameToInfoMap(pods, append(shuttingDownNodes, allNodes...))
+	if c.Opts.NodeMetrics {
+		c.updateNodeMetrics(nodegroup, nodeGroup, allNodes)
+	}
+
+	// Nodes tainted by something other than escalator can optionally be left out of the usable capacity
+	capacityNodes, capacityPods := untaintedNodes, pods
+	if nodeGroup.Opts.ExcludeExternallyTaintedNodes {
+		capacityNodes, capacityPods = filterExternallyTaintedNodes(untaintedNodes, pods)
+		if excluded := len(untaintedNodes) - len(capacityNodes); excluded > 0 {
+			log.WithField("nodegroup", nodegroup).Infof("Excluding %v nodes with taints not applied by escalator from capacity", excluded)
+		}
+	}
+	metrics.NodeGroupNodesExternallyTainted.WithLabelValues(nodegroup).Set(float64(len(untaintedNodes) - len(capacityNodes)))
+
+	// Nodes under memory pressure have no room for more pods, so can optionally be left out of the usable capacity
+	// nudging the node group to scale up
+	_, memoryPressureNodes := filterMemoryPressureNodes(untaintedNodes)
+	metrics.NodeGroupNodesMemoryPressure.WithLabelValues(nodegroup).Set(float64(memoryPressureNodes))
+	if nodeGroup.Opts.ReactToMemoryPressure && memoryPressureNodes > 0 {
+		if filtered, excluded := filterMemoryPressureNodes(capacityNodes); len(filtered) > 0 {
+			log.WithField("nodegroup", nodegroup).Infof("Excluding %v nodes with memory pressure from capacity", excluded)
+			capacityNodes = filtered
+		} else {
+			log.WithField("nodegroup", nodegroup).Warning("Every node has memory pressure. Keeping them in the capacity")
+		}
+	}
+
+	// Pods crash looping for longer than discount_crash_looping_pods_after can optionally be left out of the requests
+	// so the nodes they hold can be reclaimed
+	var crashLoopingPods int
+	if after := nodeGroup.Opts.DiscountCrashLoopingPodsAfterDuration(); after > 0 {
+		capacityPods, crashLoopingPods = filterCrashLoopingPods(capacityPods, after, c.clock().Now())
+		if crashLoopingPods > 0 {
+			log.WithField("nodegroup", nodegroup).Infof("Discounting the requests of %v pods crash looping for longer than discount_crash_looping_pods_after of %v", crashLoopingPods, after)
+		}
+	}
+	metrics.NodeGroupPodsCrashLoopingDiscounted.WithLabelValues(nodegroup).Set(float64(crashLoopingPods))
+
+	// the requests of the pending pods that fit on the existing nodes still use their capacity
+	requestPods := capacityPods
+	if len(fittingPods) > 0 {
+		requestPods = make([]*v1.Pod, 0, len(capacityPods)+len(fittingPods))
+		requestPods = append(append(requestPods, capacityPods...), fittingPods...)
+	}
 
 	// Calc capacity for untainted nodes
-	memRequest, cpuRequest, err := k8s.CalculatePodsRequestsTotal(pods)
+	memDefault, cpuDefault := nodeGroup.Opts.DefaultPodRequest.Quantities()
+	memRequest, cpuRequest, err := k8s.CalculatePodsRequestsTotalOrDefault(requestPods, memDefault, cpuDefault)
 	if err != nil {
 		log.Errorf("Failed to calculate requests: %v", err)
 		return 0, err
 	}
-	memCapacity, cpuCapacity, err := k8s.CalculateNodesCapacityTotal(untaintedNodes)
+	memReserved, cpuReserved := nodeGroup.Opts.NodeResourceReservation.Quantities()
+	memCapacity, cpuCapacity, err := k8s.CalculateNodesCapacityTotalLessReserved(capacityNodes, memReserved, cpuReserved)
 	if err != nil {
 		log.Errorf("Failed to calculate capacity: %v", err)
 		return 0, err
 	}
 
+	// the utilization is calculated from the overcommitted capacity
+	memRatio, cpuRatio := nodeGroup.Opts.OvercommitRatios()
+	memCapacityEffective, cpuCapacityEffective := overcommit(memCapacity, memRatio), overcommit(cpuCapacity, cpuRatio)
+
 	// Metrics
 	metrics.NodeGroupCPURequest.WithLabelValues(nodegroup).Set(float64(cpuRequest.MilliValue()))
 	metrics.NodeGroupCPUCapacity.WithLabelValues(nodegroup).Set(float64(cpuCapacity.MilliValue()))
 	metrics.NodeGroupMemCapacity.WithLabelValues(nodegroup).Set(float64(memCapacity.MilliValue() / 1000))
 	metrics.NodeGroupMemRequest.WithLabelValues(nodegroup).Set(float64(memRequest.MilliValue() / 1000))
+	metrics.NodeGroupCPUCapacityEffective.WithLabelValues(nodegroup).Set(float64(cpuCapacityEffective.MilliValue()))
+	metrics.NodeGroupMemCapacityEffective.WithLabelValues(nodegroup).Set(float64(memCapacityEffective.MilliValue() / 1000))
 
 	// If we ever get into a state where we have less nodes than the minimum
 	if len(untaintedNodes) < nodeGroup.Opts.MinNodes {
 		log.WithField("nodegroup", nodegroup).Warn("There are less untainted nodes than the minimum")
+		if c.scalingPaused(nodeGroup) {
+			span.SetAttributes(tracing.String("decision", "paused"))
+			log.WithField("nodegroup", nodegroup).Info("Scaling is paused or the node group is frozen. Not scaling up to the minimum")
+			return nodeGroup.Opts.MinNodes - len(untaintedNodes), nil
+		}
+		span.SetAttributes(tracing.String("decision", "scale_up"))
 		result, err := c.ScaleUp(scaleOpts{
 			nodes:      allNodes,
 			nodesDelta: nodeGroup.Opts.MinNodes - len(untaintedNodes),
 			nodeGroup:  nodeGroup,
+			ctx:        ctx,
+			reason:     fmt.Sprintf("%v untainted nodes is less than min_nodes of %v", len(untaintedNodes), nodeGroup.Opts.MinNodes),
+			pods:       pods,
 		})
 		if err != nil {
 			log.WithField("nodegroup", nodegroup).Error(err)
+		} else {
+			recordScaleAction(nodegroup, result, scaleReasonMinNodes)
 		}
 		return result, err
 	}
 
 	// Calc %
-	cpuPercent, memPercent, err := calcPercentUsage(cpuRequest, memRequest, cpuCapacity, memCapacity)
+	var cpuPercent, memPercent float64
+	switch nodeGroup.Opts.UtilizationMethod {
+	case UtilizationMethodBinPack:
+		cpuPercent, memPercent, err = calcBinPackPercentUsage(requestPods, capacityNodes, memDefault, cpuDefault, memReserved, cpuReserved, memRatio, cpuRatio)
+	default:
+		cpuPercent, memPercent, err = calcPercentUsage(cpuRequest, memRequest, cpuCapacityEffective, memCapacityEffective)
+	}
 	if err != nil {
 		log.Errorf("Failed to calculate percentages: %v", err)
 		return 0, err
@@ -287,20 +657,56 @@ func (c *Controller) scaleNodeGroup(nodegroup string, nodeGroup *NodeGroupState)
 	log.WithField("nodegroup", nodegroup).Infof("cpu: %v, memory: %v", cpuPercent, memPercent)
 	metrics.NodeGroupsCPUPercent.WithLabelValues(nodegroup).Set(cpuPercent)
 	metrics.NodeGroupsMemPercent.WithLabelValues(nodegroup).Set(memPercent)
+	for _, sink := range c.Opts.MetricsSinks {
+		sink.Utilization(nodegroup, cpuPercent, memPercent)
+	}
+	c.recordStatusUtilization(nodegroup, cpuPercent, memPercent)
 
-	locked := nodeGroup.scaleUpLock.locked()
-	if locked {
+	// Make the scaling decision on the smoothed utilization if enabled
+	if nodeGroup.Opts.UtilizationSmoothingFactor > 0 {
+		cpuPercent, memPercent = nodeGroup.smoothedUtilization.update(nodeGroup.Opts.UtilizationSmoothingFactor, cpuPercent, memPercent)
+		log.WithField("nodegroup", nodegroup).Infof("smoothed cpu: %v, smoothed memory: %v", cpuPercent, memPercent)
+		metrics.NodeGroupsCPUPercentSmoothed.WithLabelValues(nodegroup).Set(cpuPercent)
+		metrics.NodeGroupsMemPercentSmoothed.WithLabelValues(nodegroup).Set(memPercent)
+	} else {
+		nodeGroup.smoothedUtilization = smoothedUtilization{}
+	}
+
+	// the utilization the scaling decision is made on
+	maxPercent := calcUtilizationPercent(cpuPercent, memPercent, nodeGroup.Opts)
+	metrics.NodeGroupHeadroomPercent.WithLabelValues(nodegroup).Set(calcHeadroomPercent(maxPercent, nodeGroup.Opts))
+	c.updateMinNodesWaste(nodegroup, nodeGroup, calcDemandNodes(len(capacityNodes), maxPercent, nodeGroup.Opts))
+
+	now := c.clock().Now()
+	locked := nodeGroup.scaleUpLock.locked(now)
+	sample := utilizationSample{
+		percent:     maxPercent,
+		pendingPods: countPendingPods(capacityPods),
+		locked:      locked,
+		atMinNodes:  len(untaintedNodes) <= nodeGroup.Opts.MinNodes,
+	}
+	if locked && emergencyPods == 0 {
+		c.utilization.record(nodeGroup.Opts, sample)
 		// don't do anything else until we're unlocked again
-		log.WithField("nodegroup", nodegroup).Info(nodeGroup.scaleUpLock)
+		span.SetAttributes(tracing.String("decision", "locked"))
+		log.WithField("nodegroup", nodegroup).Info(nodeGroup.scaleUpLock.describe(now))
 		log.WithField("nodegroup", nodegroup).Info("Waiting for scale to finish")
 		return nodeGroup.scaleUpLock.requestedNodes, nil
 	}
 
-	c.calculateNewNodeMetrics(nodegroup, nodeGroup)
+	// pods pending for longer than emergency_pending_timeout can scale up during the scale up cool down, the new node
+	// metrics and capacity are still checked once the scale lock is released
+	if locked {
+		log.WithField("nodegroup", nodegroup).Warning("Bypassing the scale up cool down for pods pending longer than emergency_pending_timeout")
+	} else {
+		c.calculateNewNodeMetrics(nodegroup, nodeGroup)
+		c.checkScaleUpCapacity(nodegroup, nodeGroup)
+	}
 
 	// Perform the scaling decision
-	maxPercent := math.Max(cpuPercent, memPercent)
 	nodesDelta := 0
+	// reason is the dominant trigger of the decision, updated by whichever step below last increased the delta
+	reason := thresholdReason(cpuPercent, memPercent)
 
 	// Determine if we want to scale up or down. Selects the first condition that is true
 	switch {
@@ -317,37 +723,159 @@ func (c *Controller) scaleNodeGroup(nodegroup string, nodeGroup *NodeGroupState)
 		// if ScaleUpThresholdPercent is our "max target" or "slack capacity"
 		// we want to add enough nodes such that the maxPercentage cluster util
 		// drops back below ScaleUpThresholdPercent
-		nodesDelta, err = calcScaleUpDelta(untaintedNodes, cpuPercent, memPercent, nodeGroup)
+		nodesDelta, err = calcScaleUpDelta(capacityNodes, cpuPercent, memPercent, nodeGroup)
 		if err != nil {
 			log.Errorf("Failed to calculate node delta: %v", err)
 			return nodesDelta, err
 		}
+		// pending pods with required anti-affinity against each other need a node each, on top of the nodes the
+		// utilization needs
+		if antiAffinityNodes := calcAntiAffinityNodesNeeded(capacityPods); antiAffinityNodes > 0 {
+			log.WithField("nodegroup", nodegroup).Infof("%v pending pods need their own node because of pod anti-affinity. Increasing delta from %v to %v", antiAffinityNodes, nodesDelta, nodesDelta+antiAffinityNodes)
+			if antiAffinityNodes > nodesDelta {
+				reason = scaleReasonPodAntiAffinity
+			}
+			nodesDelta += antiAffinityNodes
+		}
+	}
+
+	// Scale on the length of the queue if configured, using whichever of the queue and utilization needs more nodes
+	// if the queue length can't be read the node group falls back to scaling up on utilization, but doesn't scale down
+	nodeGroup.metricSourceUnhealthy = false
+	if nodeGroup.Opts.QueueScalingEnabled() {
+		queueDelta, err := c.calcQueueScaleDelta(nodegroup, nodeGroup, len(capacityNodes))
+		if err != nil {
+			log.WithField("nodegroup", nodegroup).WithError(err).Warning("Failed to calculate queue delta. Scaling up on utilization only")
+		} else {
+			log.WithField("nodegroup", nodegroup).Infof("queue delta: %v, utilization delta: %v", queueDelta, nodesDelta)
+			if queueDelta > nodesDelta {
+				nodesDelta = queueDelta
+				reason = scaleReasonQueueLength
+			}
+		}
+	}
+
+	// Pre-warm the node group ahead of its CronJobs if configured, scaling up to cron_job_pre_warm_nodes untainted nodes
+	// and not scaling down below them until the CronJob is scheduled
+	if nodeGroup.Opts.CronJobPreWarmEnabled() {
+		if preWarmNodes := c.calcCronJobPreWarmNodes(nodegroup, nodeGroup); preWarmNodes > 0 {
+			if preWarmDelta := preWarmNodes - len(untaintedNodes); preWarmDelta > nodesDelta {
+				log.WithField("nodegroup", nodegroup).Infof("cron job pre-warm delta: %v, utilization delta: %v", preWarmDelta, nodesDelta)
+				nodesDelta = preWarmDelta
+				if nodesDelta > 0 {
+					reason = scaleReasonCronJobPreWarm
+				}
+			}
+		}
+	}
+
+	// Only add scale_up_ramp of the nodes needed each scan so a surge is provisioned over several scans, unless pods
+	// have been pending for longer than emergency_pending_timeout
+	if nodesDelta > 0 && emergencyPods == 0 {
+		if ramped := calcScaleUpRamp(nodesDelta, nodeGroup.Opts.ScaleUpRamp); ramped < nodesDelta {
+			log.WithField("nodegroup", nodegroup).Infof("Ramping scale up with scale_up_ramp of %v. Adding %v of the %v nodes needed this scan", nodeGroup.Opts.ScaleUpRamp, ramped, nodesDelta)
+			nodesDelta = ramped
+		}
+	}
+
+	// Scale up by at least scale_up_min_cpu and scale_up_min_memory if configured
+	if nodesDelta > 0 {
+		minMem, minCPU := nodeGroup.Opts.ScaleUpMinQuantities()
+		if minNodes := calcScaleUpMinNodes(len(capacityNodes), cpuCapacity, memCapacity, minCPU, minMem); minNodes > nodesDelta {
+			log.WithField("nodegroup", nodegroup).Infof("%v nodes are needed to add scale_up_min_cpu and scale_up_min_memory. Increasing delta from %v", minNodes, nodesDelta)
+			nodesDelta = minNodes
+			reason = scaleReasonScaleUpMinResources
+		}
+	}
+
+	// Slow the scale up once the node group is above scale_up_soft_cap_percent of max_nodes, unless pods have been
+	// pending for longer than emergency_pending_timeout
+	if nodesDelta > 0 && emergencyPods == 0 {
+		// the target size includes the nodes of earlier scale ups that are still launching
+		targetSize := len(untaintedNodes)
+		if cloudProviderNodeGroup, ok := getCloudProviderNodeGroup(c.cloudProvider, nodeGroup.Opts); ok {
+			targetSize = int(cloudProviderNodeGroup.TargetSize())
+		}
+		if capped := calcScaleUpSoftCap(nodesDelta, targetSize, nodeGroup.Opts.MaxNodes, nodeGroup.Opts.ScaleUpSoftCapPercent); capped < nodesDelta {
+			log.WithField("nodegroup", nodegroup).Infof("Scaling up from the target size of %v goes above the scale_up_soft_cap_percent of %v%% of max_nodes. Adding %v of the %v nodes needed this scan",
+				targetSize, nodeGroup.Opts.ScaleUpSoftCapPercent, capped, nodesDelta)
+			nodesDelta = capped
+		}
+	}
+
+	// suppress scale down for a while after a scale up to let the new capacity absorb load, and until enough nodes
+	// are Ready so a node group recovering from an outage isn't reclaimed whilst its nodes come back
+	var blockedReasons []string
+	if nodesDelta < 0 {
+		if blockedReasons = scaleDownBlocked(nodeGroup, allNodes, c.clock().Now()); len(blockedReasons) > 0 {
+			nodesDelta = 0
+		}
+	}
+	setScaleDownBlockedMetric(nodegroup, blockedReasons)
+
+	// during an emergency scale up only add the nodes that aren't already on their way from the locked scale up
+	if locked {
+		nodesDelta -= nodeGroup.scaleUpLock.requestedNodes
+		if nodesDelta <= 0 {
+			span.SetAttributes(tracing.String("decision", "locked"))
+			log.WithField("nodegroup", nodegroup).Infof("The %v nodes already requested cover the pods pending longer than emergency_pending_timeout. Waiting for scale to finish", nodeGroup.scaleUpLock.requestedNodes)
+			return nodeGroup.scaleUpLock.requestedNodes, nil
+		}
+		reason = scaleReasonPendingPods
 	}
 
 	log.WithField("nodegroup", nodegroup).Debugf("Delta: %v", nodesDelta)
+	sample.delta = nodesDelta
+	c.utilization.record(nodeGroup.Opts, sample)
 
 	scaleOptions := scaleOpts{
-		nodes:          allNodes,
-		taintedNodes:   taintedNodes,
-		untaintedNodes: untaintedNodes,
-		nodeGroup:      nodeGroup,
+		nodes:             allNodes,
+		taintedNodes:      taintedNodes,
+		untaintedNodes:    untaintedNodes,
+		shuttingDownNodes: shuttingDownNodes,
+		nodeGroup:         nodeGroup,
+		ctx:               ctx,
+		pods:              capacityPods,
+	}
+	if c.scalingPaused(nodeGroup) {
+		span.SetAttributes(tracing.String("decision", "paused"))
+		log.WithField("nodegroup", nodegroup).Infof("Scaling is paused or the node group is frozen. Not acting on delta of %v", nodesDelta)
+		return nodesDelta, nil
 	}
+	span.SetAttributes(tracing.String("decision", scaleDecision(nodesDelta)))
 
 	// Perform a scale up, do nothing or scale down based on the nodes delta
 	var nodesDeltaResult int
 	// actionErr keeps the error of any action below and checked after action
 	// make sure shadowing variable won't be created for it
 	var actionErr error
+	if nodesDelta <= 0 {
+		c.updateSaturation(nodegroup, nodeGroup, false)
+	}
 	switch {
 	case nodesDelta < 0:
 		// Try to scale down
 		scaleOptions.nodesDelta = -nodesDelta
 		nodesDeltaResult, actionErr = c.ScaleDown(scaleOptions)
+		if actionErr == nil {
+			recordScaleAction(nodegroup, -nodesDeltaResult, reason)
+		}
 	case nodesDelta > 0:
 		// Try to scale up
 		scaleOptions.nodesDelta = nodesDelta
+		scaleOptions.reason = fmt.Sprintf("cpu utilization %.2f%%, memory utilization %.2f%%", cpuPercent, memPercent)
 		nodesDeltaResult, actionErr = c.ScaleUp(scaleOptions)
-		nodeGroup.lastScaleOut = time.Now()
+		nodeGroup.lastScaleOut = c.clock().Now()
+		if actionErr == nil {
+			recordScaleAction(nodegroup, nodesDeltaResult, reason)
+		}
+		if emergencyPods > 0 && actionErr == nil {
+			log.WithField("nodegroup", nodegroup).Warningf("Emergency scale up of %v nodes for %v pods pending longer than emergency_pending_timeout", nodesDeltaResult, emergencyPods)
+			metrics.NodeGroupEmergencyScaleUps.WithLabelValues(nodegroup).Add(1)
+			nodeGroup.lastEmergencyScaleUp = c.clock().Now()
+		}
+		_, maxNodesReached := actionErr.(*maxNodesReachedError)
+		c.updateSaturation(nodegroup, nodeGroup, maxNodesReached)
 	default:
 		log.WithField("nodegroup", nodegroup).Info("No need to scale")
 		// reap any expired nodes
@@ -370,28 +898,171 @@ func (c *Controller) scaleNodeGroup(nodegroup string, nodeGroup *NodeGroupState)
 	return nodesDelta, err
 }
 
+// calcScaleFromZeroDelta returns the number of nodes a node group without any nodes needs, and the reason, from the
+// scaling signals that don't depend on its nodes
+func (c *Controller) calcScaleFromZeroDelta(nodegroup string, nodeGroup *NodeGroupState) (int, string) {
+	nodesDelta, reason := 0, ""
+	nodeGroup.metricSourceUnhealthy = false
+	if nodeGroup.Opts.QueueScalingEnabled() {
+		queueDelta, err := c.calcQueueScaleDelta(nodegroup, nodeGroup, 0)
+		if err != nil {
+			log.WithField("nodegroup", nodegroup).WithError(err).Warning("Failed to calculate queue delta. Not scaling up from zero")
+		} else if queueDelta > nodesDelta {
+			log.WithField("nodegroup", nodegroup).Infof("queue delta: %v", queueDelta)
+			nodesDelta, reason = queueDelta, scaleReasonQueueLength
+		}
+	}
+	if nodeGroup.Opts.CronJobPreWarmEnabled() {
+		if preWarmNodes := c.calcCronJobPreWarmNodes(nodegroup, nodeGroup); preWarmNodes > nodesDelta {
+			log.WithField("nodegroup", nodegroup).Infof("cron job pre-warm delta: %v", preWarmNodes)
+			nodesDelta, reason = preWarmNodes, scaleReasonCronJobPreWarm
+		}
+	}
+	return nodesDelta, reason
+}
+
+// scaleUpFromZero scales up a node group without any nodes by the nodes delta, unless it is waiting for an earlier
+// scale up or scaling is paused
+func (c *Controller) scaleUpFromZero(ctx context.Context, span *tracing.Span, nodegroup string, nodeGroup *NodeGroupState, nodesDelta int, reason string, pods []*v1.Pod) (int, error) {
+	if now := c.clock().Now(); nodeGroup.scaleUpLock.locked(now) {
+		span.SetAttributes(tracing.String("decision", "locked"))
+		log.WithField("nodegroup", nodegroup).Info(nodeGroup.scaleUpLock.describe(now))
+		log.WithField("nodegroup", nodegroup).Info("Waiting for scale to finish")
+		return nodeGroup.scaleUpLock.requestedNodes, nil
+	}
+	if c.scalingPaused(nodeGroup) {
+		span.SetAttributes(tracing.String("decision", "paused"))
+		log.WithField("nodegroup", nodegroup).Infof("Scaling is paused or the node group is frozen. Not scaling up from zero nodes by %v", nodesDelta)
+		return nodesDelta, nil
+	}
+
+	span.SetAttributes(tracing.String("decision", "scale_up"))
+	log.WithField("nodegroup", nodegroup).Infof("Scaling up from zero nodes by %v on %v", nodesDelta, reason)
+	result, err := c.ScaleUp(scaleOpts{
+		nodesDelta: nodesDelta,
+		nodeGroup:  nodeGroup,
+		ctx:        ctx,
+		reason:     fmt.Sprintf("scaling up from zero nodes on %v", reason),
+		pods:       pods,
+	})
+	nodeGroup.lastScaleOut = c.clock().Now()
+	if err != nil {
+		log.WithField("nodegroup", nodegroup).Error(err)
+		return result, err
+	}
+	recordScaleAction(nodegroup, result, reason)
+	return result, nil
+}
+
+// scaleDecision describes a nodes delta for span attributes
+func scaleDecision(nodesDelta int) string {
+	switch {
+	case nodesDelta < 0:
+		return "scale_down"
+	case nodesDelta > 0:
+		return "scale_up"
+	default:
+		return "none"
+	}
+}
+
+// The reasons of the scale actions counted by the scale action metric
+const (
+	// scaleReasonMinNodes there were less untainted nodes than min_nodes
+	scaleReasonMinNodes = "min_nodes"
+	// scaleReasonCPUThreshold the cpu utilization crossed a threshold
+	scaleReasonCPUThreshold = "cpu_threshold"
+	// scaleReasonMemThreshold the memory utilization crossed a threshold
+	scaleReasonMemThreshold = "mem_threshold"
+	// scaleReasonPodAntiAffinity pending pods with required pod anti-affinity needed more nodes than the utilization
+	scaleReasonPodAntiAffinity = "pod_anti_affinity"
+	// scaleReasonQueueLength the queue length needed more nodes than the utilization
+	scaleReasonQueueLength = "queue_length"
+	// scaleReasonCronJobPreWarm a CronJob scheduled within cron_job_pre_warm_lead_time needed more nodes than the
+	// utilization
+	scaleReasonCronJobPreWarm = "cron_job_pre_warm"
+	// scaleReasonScaleUpMinResources scale_up_min_cpu or scale_up_min_memory needed more nodes than the utilization
+	scaleReasonScaleUpMinResources = "scale_up_min_resources"
+	// scaleReasonPendingPods pods pending longer than emergency_pending_timeout bypassed the scale up cool down
+	scaleReasonPendingPods = "pending_pods"
+)
+
+// thresholdReason returns the reason of a scale action decided by the utilization thresholds
+// the larger of the cpu and memory utilization is the one the decision was made on
+func thresholdReason(cpuPercent float64, memPercent float64) string {
+	if memPercent > cpuPercent {
+		return scaleReasonMemThreshold
+	}
+	return scaleReasonCPUThreshold
+}
+
+// recordScaleAction counts a scale action that changed the number of untainted nodes by nodesDelta
+// nothing is counted if no nodes were changed
+func recordScaleAction(nodegroup string, nodesDelta int, reason string) {
+	switch {
+	case nodesDelta > 0:
+		metrics.ScaleActions.WithLabelValues(nodegroup, "up", reason).Add(1)
+	case nodesDelta < 0:
+		metrics.ScaleActions.WithLabelValues(nodegroup, "down", reason).Add(1)
+	}
+}
+
 // RunOnce performs the main autoscaler logic once
 func (c *Controller) RunOnce() error {
-	startTime := time.Now()
+	startTime := c.clock().Now()
+	c.lastScan = startTime
+	c.scanDeadline = time.Time{}
+	if c.Opts.ScanTimeout > 0 {
+		c.scanDeadline = startTime.Add(c.Opts.ScanTimeout)
+	}
+
+	// pick up any reloaded node group options before scanning
+	c.applyPendingReload()
+
+	// don't act on stale caches whilst the kubernetes API server is unreachable
+	if !c.checkAPIHealth() {
+		metrics.RunCount.Add(1)
+		return nil
+	}
 
 	// try refresh cred a few times if they go stale
 	// rebuild will create a new session from the metadata on the box
+	_, span := tracing.StartSpan(context.Background(), "CloudProviderRefresh")
 	err := c.cloudProvider.Refresh()
 	for i := 0; i < 2 && err != nil; i++ {
 		log.Warnf("cloud provider failed to refresh. trying to re-fetch credentials. tries = %v", i+1)
-		time.Sleep(5 * time.Second) // sleep to allow kube2iam to fill node with metadata
+		c.clock().Sleep(5 * time.Second) // sleep to allow kube2iam to fill node with metadata
 		c.cloudProvider, err = c.Opts.CloudProviderBuilder.Build()
 		if err != nil {
+			tracing.EndSpan(span, err)
 			return err
 		}
 		err = c.cloudProvider.Refresh()
 	}
+	tracing.EndSpan(span, err)
+	c.updateCloudProviderHealth(err)
+
+	// pick up added and removed cloud provider node groups, keeping the existing node groups if discovery fails
+	if err := c.discoverNodeGroups(); err != nil {
+		log.WithError(err).Warning("Failed to auto discover node groups")
+	}
+
 	// Perform the ScaleUp/Taint logic
-	for _, nodeGroupOpts := range c.Opts.NodeGroups {
-		log.Debugf("**********[START NODEGROUP %v]**********", nodeGroupOpts.Name)
-		state := c.nodeGroups[nodeGroupOpts.Name]
-		delta, err := c.scaleNodeGroup(nodeGroupOpts.Name, state)
-		metrics.NodeGroupScaleDelta.WithLabelValues(nodeGroupOpts.Name).Set(float64(delta))
+	for _, nodegroup := range c.nodeGroupNames() {
+		// the node groups not scanned yet are scanned in the next scan
+		if c.scanTimedOut() {
+			break
+		}
+		log.Debugf("**********[START NODEGROUP %v]**********", nodegroup)
+		state := c.nodeGroups[nodegroup]
+		if !c.shouldScanNodeGroup(nodegroup, state) {
+			continue
+		}
+		delta, err := c.scaleNodeGroup(nodegroup, state)
+		c.recordNodeGroupScan(nodegroup, state, delta)
+		c.recordStatusScan(nodegroup, err)
+		c.updateFlapping(nodegroup, state)
+		metrics.NodeGroupScaleDelta.WithLabelValues(nodegroup).Set(float64(delta))
 		state.scaleDelta = delta
 		if err != nil {
 			switch err.(type) {
@@ -399,21 +1070,71 @@ func (c *Controller) RunOnce() error {
 			case *cloudprovider.NodeNotInNodeGroup:
 				return err
 			default:
+				c.Opts.EventStream.Error(nodegroup, err)
 				log.Warn(err)
 			}
 
 		}
 	}
 
+	if c.scanTimedOut() {
+		log.Warningf("Scan passed the scan timeout of %v. Aborted the rest of the scan until the next scan", c.Opts.ScanTimeout)
+		metrics.ScanTimeouts.Inc()
+	}
+
+	c.reportUnsatisfiablePendingPods()
+	c.updateNodeGroupStatuses()
+	c.flushMetricsSinks()
 	metrics.RunCount.Add(1)
-	endTime := time.Now()
+	endTime := c.clock().Now()
 	log.Debugf("Scaling took a total of %v", endTime.Sub(startTime))
 	return nil
 }
 
+// scanTimedOut returns whether the current scan has passed the scan timeout
+// the scan is aborted at the next point it can stop without leaving a scale action half done, such as between node
+// groups or between the batches of nodes being deleted
+func (c *Controller) scanTimedOut() bool {
+	return !c.scanDeadline.IsZero() && !c.clock().Now().Before(c.scanDeadline)
+}
+
+// scanTimeout returns a channel that receives when the current scan passes the scan timeout, for waiting during a scan
+// the channel never receives if there is no scan timeout
+func (c *Controller) scanTimeout() <-chan time.Time {
+	if c.scanDeadline.IsZero() {
+		return nil
+	}
+	return c.clock().After(c.scanDeadline.Sub(c.clock().Now()))
+}
+
+// scanContext returns a context of the parent that is done once the current scan passes the scan timeout, bounding
+// the calls made during the scan. The context is never done because of the scan timeout if there isn't one
+func (c *Controller) scanContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if c.scanDeadline.IsZero() {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, c.scanDeadline.Sub(c.clock().Now()))
+}
+
+// flushMetricsSinks publishes the values recorded by the metrics sinks during the scan, logging any failure
+func (c *Controller) flushMetricsSinks() {
+	for _, sink := range c.Opts.MetricsSinks {
+		if err := sink.Flush(); err != nil {
+			log.WithError(err).Warn("Failed to flush metrics sink")
+		}
+	}
+}
+
 // RunForever starts the autoscaler process and runs once every ScanInterval. blocks thread
 // it always returns a non-nil error
 func (c *Controller) RunForever(runImmediately bool) error {
+	if c.Opts.ReconcileOnStartup && c.Paused() {
+		log.Info("Scaling is paused. Skipping startup reconcile")
+	} else if c.Opts.ReconcileOnStartup {
+		log.Debug("**********[AUTOSCALER STARTUP RECONCILE]**********")
+		c.reconcileNodeGroups()
+	}
+
 	if runImmediately {
 		log.Debug("**********[AUTOSCALER FIRST LOOP]**********")
 		err := c.RunOnce()
@@ -423,19 +1144,40 @@ func (c *Controller) RunForever(runImmediately bool) error {
 	}
 
 	// Start the main loop
-	ticker := time.NewTicker(c.Opts.ScanInterval)
+	interval := c.Opts.ScanInterval
+	ticker := c.clock().NewTicker(interval)
+	defer func() { ticker.Stop() }()
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			log.Debug("**********[AUTOSCALER MAIN LOOP]**********")
-			err := c.RunOnce()
-			if err != nil {
-				return err
-			}
+		case <-c.scanTrigger:
+			log.Debug("**********[AUTOSCALER TRIGGERED LOOP]**********")
 		case <-c.stopChan:
 			log.Debugf("Stopping main loop")
-			ticker.Stop()
+			c.logSummary()
 			return errors.New("main loop stopped")
 		}
+
+		// enforce a minimum gap between scans regardless of how they were triggered
+		if !c.waitMinScanInterval() {
+			log.Debugf("Stopping main loop")
+			c.logSummary()
+			return errors.New("main loop stopped")
+		}
+		// any triggers received until now are satisfied by this scan
+		c.drainScanTriggers()
+
+		err := c.RunOnce()
+		if err != nil {
+			return err
+		}
+
+		// the scan interval can be changed by a reload, which is applied by the scan
+		if c.Opts.ScanInterval != interval {
+			interval = c.Opts.ScanInterval
+			ticker.Stop()
+			ticker = c.clock().NewTicker(interval)
+		}
 	}
 }
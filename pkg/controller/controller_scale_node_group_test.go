@@ -1,16 +1,23 @@
 package controller
 
 import (
+	"fmt"
 	"testing"
-	duration "time"
+	"time"
 
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/metrics"
 	"github.com/atlassian/escalator/pkg/test"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	log "github.com/sirupsen/logrus"
-	time "github.com/stephanos/clock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
 )
 
 type ListerOptions struct {
@@ -32,25 +39,33 @@ func buildTestPods(amount int, CPU int64, Mem int64) []*v1.Pod {
 	})
 }
 
+// buildTestCompletedPods builds a completed pod on each node that requests the given resources
+func buildTestCompletedPods(nodes []*v1.Node, CPU int64, Mem int64) []*v1.Pod {
+	pods := make([]*v1.Pod, 0, len(nodes))
+	for i, node := range nodes {
+		pods = append(pods, test.BuildTestPod(test.PodOpts{
+			Name:     fmt.Sprintf("completed-%d", i),
+			CPU:      []int64{CPU},
+			Mem:      []int64{Mem},
+			NodeName: node.Name,
+			Phase:    v1.PodSucceeded,
+		}))
+	}
+	return pods
+}
+
 func buildTestClient(nodes []*v1.Node, pods []*v1.Pod, nodeGroups []NodeGroupOptions, listerOptions ListerOptions) (*Client, Opts) {
 	fakeClient, _ := test.BuildFakeClient(nodes, pods)
 	opts := Opts{
 		K8SClient:    fakeClient,
 		NodeGroups:   nodeGroups,
-		ScanInterval: 1 * duration.Minute,
+		ScanInterval: 1 * time.Minute,
 		DryMode:      false,
 	}
 	allPodLister := test.NewTestPodWatcher(pods, listerOptions.podListerOptions)
 	allNodeLister := test.NewTestNodeWatcher(nodes, listerOptions.nodeListerOptions)
 
-	nodeGroupListerMap := make(map[string]*NodeGroupLister)
-	for _, ng := range nodeGroups {
-		if ng.Name == DefaultNodeGroup {
-			nodeGroupListerMap[ng.Name] = NewDefaultNodeGroupLister(allPodLister, allNodeLister, ng)
-		} else {
-			nodeGroupListerMap[ng.Name] = NewNodeGroupLister(allPodLister, allNodeLister, ng)
-		}
-	}
+	nodeGroupListerMap := BuildNodeGroupListers(allPodLister, allNodeLister, nodeGroups)
 
 	client := &Client{
 		fakeClient,
@@ -151,7 +166,7 @@ func TestScaleNodeGroup(t *testing.T) {
 				nodeArgs{10, 2000, 8000},
 				buildTestPods(40, 500, 1000),
 				NodeGroupOptions{
-					Name: "default",
+					Name:                    "default",
 					CloudProviderGroupName:  "default",
 					MinNodes:                5,
 					MaxNodes:                100,
@@ -167,7 +182,7 @@ func TestScaleNodeGroup(t *testing.T) {
 				nodeArgs{10, 2000, 8000},
 				buildTestPods(40, 100, 2000),
 				NodeGroupOptions{
-					Name: "default",
+					Name:                    "default",
 					CloudProviderGroupName:  "default",
 					MinNodes:                5,
 					MaxNodes:                100,
@@ -183,7 +198,7 @@ func TestScaleNodeGroup(t *testing.T) {
 				nodeArgs{10, 2000, 8000},
 				buildTestPods(40, 500, 1000),
 				NodeGroupOptions{
-					Name: "default",
+					Name:                    "default",
 					CloudProviderGroupName:  "default",
 					MinNodes:                5,
 					MaxNodes:                100,
@@ -199,7 +214,7 @@ func TestScaleNodeGroup(t *testing.T) {
 				nodeArgs{10, 2000, 8000},
 				buildTestPods(60, 500, 1000),
 				NodeGroupOptions{
-					Name: "default",
+					Name:                    "default",
 					CloudProviderGroupName:  "default",
 					MinNodes:                5,
 					MaxNodes:                100,
@@ -346,7 +361,7 @@ func TestScaleNodeGroup(t *testing.T) {
 				nodeArgs{10, 1500, 5000},
 				buildTestPods(100, 500, 600),
 				NodeGroupOptions{
-					Name: "default",
+					Name:                    "default",
 					CloudProviderGroupName:  "default",
 					MinNodes:                5,
 					MaxNodes:                100,
@@ -435,11 +450,13 @@ func TestScaleNodeGroup_MultipleRuns(t *testing.T) {
 		listerOptions    ListerOptions
 	}
 
+	completedNodes := buildTestNodes(10, 2000, 8000)
+
 	tests := []struct {
 		name        string
 		args        args
 		runs        int
-		runInterval duration.Duration
+		runInterval time.Duration
 		want        int
 		err         error
 	}{
@@ -449,7 +466,7 @@ func TestScaleNodeGroup_MultipleRuns(t *testing.T) {
 				buildTestNodes(10, 2000, 8000),
 				buildTestPods(0, 0, 0),
 				NodeGroupOptions{
-					Name: "default",
+					Name:                               "default",
 					CloudProviderGroupName:             "default",
 					MinNodes:                           5,
 					MaxNodes:                           100,
@@ -463,7 +480,7 @@ func TestScaleNodeGroup_MultipleRuns(t *testing.T) {
 				ListerOptions{},
 			},
 			1,
-			duration.Minute,
+			time.Minute,
 			-4,
 			nil,
 		},
@@ -473,7 +490,7 @@ func TestScaleNodeGroup_MultipleRuns(t *testing.T) {
 				buildTestNodes(10, 2000, 8000),
 				buildTestPods(10, 1000, 1000),
 				NodeGroupOptions{
-					Name: "default",
+					Name:                               "default",
 					CloudProviderGroupName:             "default",
 					MinNodes:                           5,
 					MaxNodes:                           100,
@@ -487,16 +504,45 @@ func TestScaleNodeGroup_MultipleRuns(t *testing.T) {
 				ListerOptions{},
 			},
 			5,
-			duration.Minute,
+			time.Minute,
 			-2,
 			nil,
 		},
+		{
+			// nodes full of completed pods are idle so are tainted and then deleted after the soft grace period
+			"10 nodes, full of completed pods, fast node removal",
+			args{
+				completedNodes,
+				buildTestCompletedPods(completedNodes, 2000, 8000),
+				NodeGroupOptions{
+					Name:                               "default",
+					CloudProviderGroupName:             "default",
+					MinNodes:                           5,
+					MaxNodes:                           100,
+					ScaleUpThresholdPercent:            70,
+					TaintLowerCapacityThresholdPercent: 40,
+					TaintUpperCapacityThresholdPercent: 60,
+					FastNodeRemovalRate:                4,
+					SlowNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "1m",
+					HardDeleteGracePeriod:              "1h",
+				},
+				ListerOptions{},
+			},
+			1,
+			time.Minute,
+			-4,
+			nil,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			nodeGroups := []NodeGroupOptions{tt.args.nodeGroupOptions}
 			client, opts := buildTestClient(tt.args.nodes, tt.args.pods, nodeGroups, tt.args.listerOptions)
+			// Create a new mock clock
+			mockClock := newManualClock(time.Now())
+			opts.Clock = mockClock
 
 			// For these test cases we only use 1 node group/cloud provider node group
 			nodeGroupSize := 1
@@ -525,10 +571,6 @@ func TestScaleNodeGroup_MultipleRuns(t *testing.T) {
 				cloudProvider: testCloudProvider,
 			}
 
-			// Create a new mock clock
-			mockClock := time.NewMock()
-			time.Work = mockClock
-
 			// Run the initial run of the scale
 			nodesDelta, err := controller.scaleNodeGroup(tt.args.nodeGroupOptions.Name, nodeGroupsState[tt.args.nodeGroupOptions.Name])
 
@@ -552,3 +594,735 @@ func TestScaleNodeGroup_MultipleRuns(t *testing.T) {
 		})
 	}
 }
+
+func TestScaleNodeGroup_ScaleDownDelayAfterAdd(t *testing.T) {
+	nodeGroupOptions := NodeGroupOptions{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           5,
+		MaxNodes:                           100,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		FastNodeRemovalRate:                4,
+		SlowNodeRemovalRate:                2,
+		SoftDeleteGracePeriod:              "1m",
+		HardDeleteGracePeriod:              "10m",
+		ScaleUpCoolDownPeriod:              "1m",
+		ScaleDownDelayAfterAdd:             "10m",
+	}
+	nodeGroups := []NodeGroupOptions{nodeGroupOptions}
+	nodes := buildTestNodes(10, 2000, 8000)
+	client, opts := buildTestClient(nodes, buildTestPods(0, 0, 0), nodeGroups, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 5, 100, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      nil,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// a scale up has just happened, scale down should be suppressed
+	nodeGroupsState["default"].lastScaleUp = mockClock.Now()
+	nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+	require.NoError(t, err)
+	assert.Equal(t, 0, nodesDelta)
+
+	// still within the delay
+	mockClock.Add(9 * time.Minute)
+	nodesDelta, err = controller.scaleNodeGroup("default", nodeGroupsState["default"])
+	require.NoError(t, err)
+	assert.Equal(t, 0, nodesDelta)
+
+	// the delay has passed, scale down is allowed
+	mockClock.Add(2 * time.Minute)
+	nodesDelta, err = controller.scaleNodeGroup("default", nodeGroupsState["default"])
+	require.NoError(t, err)
+	assert.Equal(t, -4, nodesDelta)
+}
+
+func TestScaleNodeGroup_PodAffinity(t *testing.T) {
+	nodeGroupOptions := NodeGroupOptions{
+		Name:                               "shared",
+		LabelKey:                           "customer",
+		LabelValue:                         "shared",
+		CloudProviderGroupName:             "shared",
+		MinNodes:                           1,
+		MaxNodes:                           100,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		FastNodeRemovalRate:                4,
+		SlowNodeRemovalRate:                2,
+		SoftDeleteGracePeriod:              "1m",
+		HardDeleteGracePeriod:              "10m",
+		ScaleUpCoolDownPeriod:              "1m",
+	}
+
+	tests := []struct {
+		name          string
+		instanceType  string
+		expectedDelta int
+	}{
+		// 125% utilisation
+		{"pods with matching affinity scale up the node group", "m5.large", 2},
+		// the pods are not counted, 0% utilisation
+		{"pods with affinity not matching the node group's nodes are ignored", "p3.2xlarge", -4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{nodeGroupOptions}
+			nodes := test.BuildTestNodes(2, test.NodeOpts{
+				CPU:        1000,
+				Mem:        1000,
+				LabelKey:   "customer",
+				LabelValue: "shared",
+			})
+			for _, node := range nodes {
+				node.Labels["instance-type"] = "m5.large"
+			}
+			pods := test.BuildTestPods(5, test.PodOpts{
+				CPU:               []int64{500},
+				Mem:               []int64{500},
+				NodeSelectorKey:   "customer",
+				NodeSelectorValue: "shared",
+				NodeAffinityKey:   "instance-type",
+				NodeAffinityValue: tt.instanceType,
+			})
+			client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("shared", 1, 100, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			nodesDelta, err := controller.scaleNodeGroup("shared", nodeGroupsState["shared"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDelta, nodesDelta)
+		})
+	}
+}
+
+func TestScaleNodeGroup_UtilizationSmoothing(t *testing.T) {
+	tests := []struct {
+		name            string
+		smoothingFactor float64
+		expectedDelta   int
+	}{
+		// 62.5% utilisation is between the taint upper threshold and the scale up threshold
+		{"unsmoothed utilisation", 0, 0},
+		// smoothed with the previous 50% gives 52.5%, below the taint upper threshold
+		{"smoothed utilisation", 0.2, -2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           1,
+				MaxNodes:                           100,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 60,
+				FastNodeRemovalRate:                4,
+				SlowNodeRemovalRate:                2,
+				SoftDeleteGracePeriod:              "1m",
+				HardDeleteGracePeriod:              "10m",
+				ScaleUpCoolDownPeriod:              "1m",
+				UtilizationSmoothingFactor:         tt.smoothingFactor,
+			}}
+			nodes := buildTestNodes(4, 1000, 1000)
+			pods := buildTestPods(10, 250, 250)
+			client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 1, 100, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+			nodeGroupsState["default"].smoothedUtilization.update(1, 50, 50)
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDelta, nodesDelta)
+		})
+	}
+}
+
+func TestScaleNodeGroup_ExcludeExternallyTaintedNodes(t *testing.T) {
+	tests := []struct {
+		name          string
+		exclude       bool
+		expectedDelta int
+	}{
+		// 50% utilisation of all the nodes is between the taint lower and upper thresholds
+		{"externally tainted nodes included", false, -2},
+		// 100% utilisation of the nodes that aren't externally tainted is above the scale up threshold
+		{"externally tainted nodes excluded", true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           1,
+				MaxNodes:                           100,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 60,
+				FastNodeRemovalRate:                4,
+				SlowNodeRemovalRate:                2,
+				SoftDeleteGracePeriod:              "1m",
+				HardDeleteGracePeriod:              "10m",
+				ScaleUpCoolDownPeriod:              "1m",
+				ExcludeExternallyTaintedNodes:      tt.exclude,
+			}}
+			nodes := buildTestNodes(4, 1000, 1000)
+			for _, node := range nodes[:2] {
+				node.Spec.Taints = []v1.Taint{{Key: "node.kubernetes.io/unreachable", Effect: v1.TaintEffectNoExecute}}
+			}
+			pods := buildTestPods(10, 200, 200)
+			client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 1, 100, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDelta, nodesDelta)
+		})
+	}
+}
+
+func TestScaleNodeGroup_ExternalDeletionTaints(t *testing.T) {
+	tests := []struct {
+		name            string
+		taints          []string
+		pods            int
+		expectedDelta   int
+		expectedNodes   float64
+		expectedTainted int
+	}{
+		// 50% utilisation of all the nodes is between the taint lower and upper thresholds
+		{"no external deletion taints", nil, 10, -2, 0, 2},
+		// 100% utilisation of the nodes that aren't marked for deletion is above the scale up threshold
+		{"marked nodes excluded", []string{"ToBeDeletedByClusterAutoscaler"}, 10, 1, 2, 0},
+		// 0% utilisation scales down, but only one of the nodes that aren't marked for deletion is tainted to keep
+		// min_nodes
+		{"marked nodes never tainted", []string{"ToBeDeletedByClusterAutoscaler"}, 0, -4, 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           1,
+				MaxNodes:                           100,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 60,
+				FastNodeRemovalRate:                4,
+				SlowNodeRemovalRate:                2,
+				SoftDeleteGracePeriod:              "1m",
+				HardDeleteGracePeriod:              "10m",
+				ScaleUpCoolDownPeriod:              "1m",
+				ExternalDeletionTaints:             tt.taints,
+			}}
+			nodes := buildTestNodes(4, 1000, 1000)
+			for _, node := range nodes[:2] {
+				node.Spec.Taints = []v1.Taint{{Key: "ToBeDeletedByClusterAutoscaler", Value: "1700000000", Effect: v1.TaintEffectNoSchedule}}
+			}
+			pods := buildTestPods(tt.pods, 200, 200)
+			client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 1, 100, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDelta, nodesDelta)
+			assert.Equal(t, tt.expectedNodes, testutil.ToFloat64(metrics.NodeGroupNodesExternalDeletion.WithLabelValues("default")))
+
+			var tainted []string
+			for _, action := range opts.K8SClient.(*fake.Clientset).Actions() {
+				if update, ok := action.(core.UpdateAction); ok {
+					tainted = append(tainted, update.GetObject().(*v1.Node).Name)
+				}
+			}
+			assert.Len(t, tainted, tt.expectedTainted)
+			if len(tt.taints) > 0 {
+				assert.NotContains(t, tainted, nodes[0].Name)
+				assert.NotContains(t, tainted, nodes[1].Name)
+			}
+		})
+	}
+}
+
+func TestScaleNodeGroup_DiscountCrashLoopingPods(t *testing.T) {
+	tests := []struct {
+		name          string
+		after         string
+		expectedDelta int
+	}{
+		// 60% utilisation of both nodes is between the taint lower and upper thresholds
+		{"crash looping pods counted", "", -1},
+		// 20% utilisation without the crash looping pods is below the taint lower threshold
+		{"crash looping pods discounted", "30m", -2},
+		// the pods haven't been crash looping for long enough to be discounted
+		{"crash looping pods not discounted yet", "2h", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           0,
+				MaxNodes:                           100,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 65,
+				FastNodeRemovalRate:                2,
+				SlowNodeRemovalRate:                1,
+				SoftDeleteGracePeriod:              "1m",
+				HardDeleteGracePeriod:              "10m",
+				ScaleUpCoolDownPeriod:              "1m",
+				DiscountCrashLoopingPodsAfter:      tt.after,
+			}}
+			nodes := buildTestNodes(2, 1000, 1000)
+			pods := buildTestPods(6, 200, 200)
+			for i, pod := range pods {
+				pod.Spec.NodeName = nodes[i%2].Name
+			}
+			for _, pod := range pods[2:] {
+				crashLooping(pod, time.Now().Add(-time.Hour))
+			}
+			client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 0, 100, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDelta, nodesDelta)
+		})
+	}
+}
+
+func TestScaleNodeGroup_IgnorePendingPodsThatFit(t *testing.T) {
+	tests := []struct {
+		name          string
+		ignore        bool
+		pendingCPU    int64
+		expectedDelta int
+		expectedCPU   float64
+	}{
+		// the pod pending longer than emergency_pending_timeout bypasses the scale up cool down
+		{"pending pod that fits counted", false, 300, 1, 75},
+		// the pending pod that fits the 400m left on either node doesn't, but its requests are still used
+		{"pending pod that fits ignored", true, 300, 0, 75},
+		{"pending pod that doesn't fit counted", true, 500, 1, 85},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           0,
+				MaxNodes:                           100,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 65,
+				FastNodeRemovalRate:                2,
+				SlowNodeRemovalRate:                1,
+				SoftDeleteGracePeriod:              "1m",
+				HardDeleteGracePeriod:              "10m",
+				ScaleUpCoolDownPeriod:              "1m",
+				EmergencyPendingTimeout:            "1m",
+				IgnorePendingPodsThatFit:           tt.ignore,
+			}}
+			nodes := buildTestNodes(2, 1000, 1000)
+			pods := buildTestPods(2, 600, 600)
+			for i, pod := range pods {
+				pod.Spec.NodeName = nodes[i].Name
+			}
+			pending := test.BuildTestPod(test.PodOpts{Name: "pending", CPU: []int64{tt.pendingCPU}, Mem: []int64{tt.pendingCPU}})
+			pods = append(pods, pending)
+			client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 0, 100, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+			// the node group is in its scale up cool down and the pod has been pending for longer than the emergency timeout
+			nodeGroupsState["default"].scaleUpLock.lock(0, time.Now())
+			nodeGroupsState["default"].pendingSince = map[types.UID]time.Time{pending.UID: time.Now().Add(-2 * time.Minute)}
+
+			nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDelta, nodesDelta)
+			assert.Equal(t, tt.expectedCPU, testutil.ToFloat64(metrics.NodeGroupsCPUPercent.WithLabelValues("default")))
+		})
+	}
+}
+
+func TestScaleNodeGroup_ScaleUpMinResources(t *testing.T) {
+	tests := []struct {
+		name          string
+		minCPU        string
+		minMemory     string
+		expectedDelta int
+	}{
+		// 100% utilisation of 2 nodes needs 1 more node to drop below the scale up threshold
+		{"no minimum", "", "", 1},
+		{"minimum cpu of 3 nodes", "3", "", 3},
+		{"minimum memory of 4 nodes", "1", "4000", 4},
+		{"minimum below the utilisation delta", "500m", "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           1,
+				MaxNodes:                           100,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 60,
+				ScaleUpCoolDownPeriod:              "1m",
+				ScaleUpMinCPU:                      tt.minCPU,
+				ScaleUpMinMemory:                   tt.minMemory,
+			}}
+			nodes := buildTestNodes(2, 1000, 1000)
+			pods := buildTestPods(10, 200, 200)
+			client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 1, 100, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDelta, nodesDelta)
+			assert.Equal(t, int64(len(nodes)+tt.expectedDelta), testNodeGroup.TargetSize())
+		})
+	}
+}
+
+func TestScaleNodeGroup_PodAntiAffinity(t *testing.T) {
+	antiAffinity := func(name string) *v1.Pod {
+		pod := test.BuildTestPod(test.PodOpts{
+			Name:              name,
+			CPU:               []int64{200},
+			Mem:               []int64{200},
+			NodeSelectorKey:   "customer",
+			NodeSelectorValue: "shared",
+		})
+		pod.Labels = map[string]string{"app": "db"}
+		pod.Spec.Affinity = &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+				TopologyKey:   k8s.HostnameTopologyKey,
+			}},
+		}}
+		return pod
+	}
+
+	tests := []struct {
+		name             string
+		antiAffinityPods int
+		expectedDelta    int
+	}{
+		// 100% utilisation of 2 nodes needs 1 more node to drop below the scale up threshold
+		{"no anti-affinity", 0, 1},
+		// the same utilisation, with 3 of the pods needing their own node on top of it
+		{"anti-affinity nodes are added to the utilisation delta", 3, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "shared",
+				LabelKey:                           "customer",
+				LabelValue:                         "shared",
+				CloudProviderGroupName:             "shared",
+				MinNodes:                           1,
+				MaxNodes:                           100,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 60,
+				ScaleUpCoolDownPeriod:              "1m",
+			}}
+			nodes := test.BuildTestNodes(2, test.NodeOpts{
+				CPU:        1000,
+				Mem:        1000,
+				LabelKey:   "customer",
+				LabelValue: "shared",
+			})
+			pods := test.BuildTestPods(10-tt.antiAffinityPods, test.PodOpts{
+				CPU:               []int64{200},
+				Mem:               []int64{200},
+				NodeSelectorKey:   "customer",
+				NodeSelectorValue: "shared",
+			})
+			for i := 0; i < tt.antiAffinityPods; i++ {
+				pods = append(pods, antiAffinity(fmt.Sprintf("db-%d", i)))
+			}
+			client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("shared", 1, 100, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			nodesDelta, err := controller.scaleNodeGroup("shared", nodeGroupsState["shared"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDelta, nodesDelta)
+			assert.Equal(t, int64(len(nodes)+tt.expectedDelta), testNodeGroup.TargetSize())
+		})
+	}
+}
+
+func TestScaleNodeGroup_ReactToMemoryPressure(t *testing.T) {
+	tests := []struct {
+		name           string
+		react          bool
+		pressuredNodes int
+		expectedDelta  int
+	}{
+		// 50% utilisation of all the nodes needs no scale up or down
+		{"memory pressure ignored", false, 1, 0},
+		// 66% utilisation of the nodes without memory pressure is below the scale up threshold
+		{"one node with memory pressure", true, 1, 0},
+		// 100% utilisation of the nodes without memory pressure is above the scale up threshold
+		{"two nodes with memory pressure", true, 2, 1},
+		// no capacity would be left, so the nodes are kept
+		{"every node with memory pressure", true, 4, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           1,
+				MaxNodes:                           100,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 50,
+				FastNodeRemovalRate:                4,
+				SlowNodeRemovalRate:                2,
+				SoftDeleteGracePeriod:              "1m",
+				HardDeleteGracePeriod:              "10m",
+				ScaleUpCoolDownPeriod:              "1m",
+				ReactToMemoryPressure:              tt.react,
+			}}
+			nodes := buildTestNodes(4, 1000, 1000)
+			for _, node := range nodes[:tt.pressuredNodes] {
+				node.Status.Conditions = append(node.Status.Conditions, v1.NodeCondition{Type: v1.NodeMemoryPressure, Status: v1.ConditionTrue})
+			}
+			pods := buildTestPods(10, 200, 200)
+			client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 1, 100, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDelta, nodesDelta)
+			assert.Equal(t, float64(tt.pressuredNodes), testutil.ToFloat64(metrics.NodeGroupNodesMemoryPressure.WithLabelValues("default")))
+		})
+	}
+}
+
+func TestScaleNodeGroup_ScaleActionReasons(t *testing.T) {
+	tests := []struct {
+		name      string
+		pods      []*v1.Pod
+		direction string
+		reason    string
+	}{
+		{"cpu above the scale up threshold", buildTestPods(10, 400, 100), "up", scaleReasonCPUThreshold},
+		{"memory above the scale up threshold", buildTestPods(10, 100, 400), "up", scaleReasonMemThreshold},
+		{"cpu and memory below the taint threshold", buildTestPods(2, 100, 100), "down", scaleReasonCPUThreshold},
+		{"memory below the taint threshold", buildTestPods(2, 100, 200), "down", scaleReasonMemThreshold},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           1,
+				MaxNodes:                           100,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 50,
+				FastNodeRemovalRate:                2,
+				SlowNodeRemovalRate:                1,
+				SoftDeleteGracePeriod:              "1m",
+				HardDeleteGracePeriod:              "10m",
+				ScaleUpCoolDownPeriod:              "1m",
+			}}
+			nodes := buildTestNodes(4, 1000, 1000)
+			client, opts := buildTestClient(nodes, tt.pods, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 1, 100, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			counter := metrics.ScaleActions.WithLabelValues("default", tt.direction, tt.reason)
+			before := testutil.ToFloat64(counter)
+			_, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			require.NoError(t, err)
+			assert.Equal(t, before+1, testutil.ToFloat64(counter))
+		})
+	}
+}
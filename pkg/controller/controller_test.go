@@ -2,10 +2,17 @@ package controller
 
 import (
 	"testing"
+	"time"
 
+	"github.com/atlassian/escalator/pkg/metrics"
 	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
 )
 
 func TestControllerDryMode(t *testing.T) {
@@ -165,3 +172,91 @@ func TestControllerFilterNodes(t *testing.T) {
 		})
 	}
 }
+
+func TestControllerFilterNodesRespectExternalCordon(t *testing.T) {
+	nodes := []*v1.Node{
+		0: test.BuildTestNode(test.NodeOpts{Name: "untainted"}),
+		1: test.BuildTestNode(test.NodeOpts{Name: "tainted", Tainted: true}),
+		2: test.BuildTestNode(test.NodeOpts{Name: "cordoned"}),
+		3: test.BuildTestNode(test.NodeOpts{Name: "cordoned-tainted", Tainted: true}),
+	}
+	nodes[2].Spec.Unschedulable = true
+	nodes[3].Spec.Unschedulable = true
+
+	enabled, disabled := true, false
+	tests := []struct {
+		name                  string
+		respectExternalCordon *bool
+		wantUntaintedNodes    []*v1.Node
+		wantTaintedNodes      []*v1.Node
+		wantCordonedNodes     []*v1.Node
+	}{
+		{"default", nil, []*v1.Node{nodes[0]}, []*v1.Node{nodes[1]}, []*v1.Node{nodes[2], nodes[3]}},
+		{"enabled", &enabled, []*v1.Node{nodes[0]}, []*v1.Node{nodes[1]}, []*v1.Node{nodes[2], nodes[3]}},
+		{"disabled", &disabled, []*v1.Node{nodes[0], nodes[2]}, []*v1.Node{nodes[1], nodes[3]}, []*v1.Node{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Controller{}
+			nodeGroup := &NodeGroupState{Opts: NodeGroupOptions{RespectExternalCordon: tt.respectExternalCordon}}
+			gotUntaintedNodes, gotTaintedNodes, gotCordonedNodes := c.filterNodes(nodeGroup, nodes)
+			assert.Equal(t, tt.wantUntaintedNodes, gotUntaintedNodes)
+			assert.Equal(t, tt.wantTaintedNodes, gotTaintedNodes)
+			assert.Equal(t, tt.wantCordonedNodes, gotCordonedNodes)
+		})
+	}
+}
+
+func TestControllerRunOnceScanTimeout(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		ScaleUpCoolDownPeriod:              "1m",
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(10, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+	opts.ScanTimeout = time.Minute
+
+	// the API health check at the start of the scan takes longer than the scan timeout
+	slow := true
+	opts.K8SClient.(*fake.Clientset).PrependReactor("list", "nodes", func(action core.Action) (bool, runtime.Object, error) {
+		if slow {
+			mockClock.Add(2 * time.Minute)
+		}
+		return false, nil, nil
+	})
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	controller := &Controller{
+		Client: client,
+		Opts:   opts,
+		nodeGroups: BuildNodeGroupsState(nodeGroupsStateOpts{
+			nodeGroups: nodeGroups,
+			client:     *client,
+		}),
+		cloudProvider: testCloudProvider,
+	}
+
+	// the node group isn't scanned in the aborted scan
+	timeouts := testutil.ToFloat64(metrics.ScanTimeouts)
+	require.NoError(t, controller.RunOnce())
+	assert.Equal(t, timeouts+1, testutil.ToFloat64(metrics.ScanTimeouts))
+	assert.Equal(t, int64(2), testNodeGroup.TargetSize())
+
+	// and is scanned in the next scan that finishes in time
+	slow = false
+	require.NoError(t, controller.RunOnce())
+	assert.Equal(t, timeouts+1, testutil.ToFloat64(metrics.ScanTimeouts))
+	assert.True(t, testNodeGroup.TargetSize() > 2)
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// calcCronJobPreWarmNodes returns the number of untainted nodes the node group is pre-warmed to ahead of its
+// cron_job_pre_warm CronJobs, cron_job_pre_warm_nodes if any of them is scheduled within cron_job_pre_warm_lead_time,
+// otherwise 0. Pre-warming is advisory, a CronJob that can't be read or whose schedule can't be parsed is skipped
+func (c *Controller) calcCronJobPreWarmNodes(nodegroup string, nodeGroup *NodeGroupState) int {
+	lister, err := c.cronJobLister()
+	if err != nil {
+		log.WithField("nodegroup", nodegroup).WithError(err).Warning("Failed to list CronJobs. Not pre-warming")
+		metrics.NodeGroupCronJobPreWarmNodes.WithLabelValues(nodegroup).Set(0)
+		return 0
+	}
+
+	now := c.clock().Now()
+	leadTime := nodeGroup.Opts.CronJobPreWarmLeadTimeDuration()
+	preWarmNodes := 0
+	for _, cronJob := range nodeGroup.Opts.CronJobPreWarm {
+		namespace, name := splitCronJobPreWarm(cronJob)
+		next, err := k8s.CronJobNextSchedule(lister, namespace, name, now)
+		if err != nil {
+			log.WithField("nodegroup", nodegroup).WithError(err).Warningf("Failed to get the next schedule of CronJob %v. Not pre-warming for it", cronJob)
+			continue
+		}
+		if next.IsZero() || next.Sub(now) > leadTime {
+			continue
+		}
+		log.WithField("nodegroup", nodegroup).Infof("CronJob %v is scheduled at %v, within cron_job_pre_warm_lead_time of %v. Pre-warming to %v nodes",
+			cronJob, next, leadTime, nodeGroup.Opts.CronJobPreWarmNodes)
+		preWarmNodes = nodeGroup.Opts.CronJobPreWarmNodes
+		break
+	}
+	metrics.NodeGroupCronJobPreWarmNodes.WithLabelValues(nodegroup).Set(float64(preWarmNodes))
+	return preWarmNodes
+}
+
+// nextCronJobPreWarmDeadline returns the earliest time after now at which a cron_job_pre_warm_lead_time window of the
+// node group's CronJobs starts or ends, so a node group whose scans are backed off is still pre-warmed in time. Returns
+// the zero time if there is none or the CronJobs can't be read
+func (c *Controller) nextCronJobPreWarmDeadline(nodeGroup *NodeGroupState, now time.Time) time.Time {
+	if !nodeGroup.Opts.CronJobPreWarmEnabled() {
+		return time.Time{}
+	}
+	lister, err := c.cronJobLister()
+	if err != nil {
+		return time.Time{}
+	}
+
+	var deadline time.Time
+	add := func(t time.Time) {
+		if t.After(now) && (deadline.IsZero() || t.Before(deadline)) {
+			deadline = t
+		}
+	}
+	leadTime := nodeGroup.Opts.CronJobPreWarmLeadTimeDuration()
+	for _, cronJob := range nodeGroup.Opts.CronJobPreWarm {
+		namespace, name := splitCronJobPreWarm(cronJob)
+		next, err := k8s.CronJobNextSchedule(lister, namespace, name, now)
+		if err != nil || next.IsZero() {
+			continue
+		}
+		add(next.Add(-leadTime))
+		add(next)
+	}
+	return deadline
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"testing"
+	duration "time"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestScaleNodeGroup_CronJobPreWarm(t *testing.T) {
+	tests := []struct {
+		name          string
+		now           duration.Time
+		nodes         int
+		pods          int
+		expectedDelta int
+		preWarmNodes  int
+	}{
+		// 50% utilisation is between the taint thresholds, the hourly CronJob is scheduled in 5 minutes
+		{"within lead time", duration.Date(2019, duration.January, 2, 10, 55, 0, 0, duration.UTC), 4, 10, 6, 10},
+		// the CronJob is scheduled in 30 minutes, so the node group scales down on utilisation
+		{"before lead time", duration.Date(2019, duration.January, 2, 10, 30, 0, 0, duration.UTC), 4, 10, -2, 0},
+		// utilisation needs more nodes than the pre-warm
+		{"utilisation needs more nodes", duration.Date(2019, duration.January, 2, 10, 55, 0, 0, duration.UTC), 4, 40, 8, 10},
+		// 3% utilisation removes nodes quickly, but not below the pre-warm
+		{"scale down stops at pre-warm", duration.Date(2019, duration.January, 2, 10, 55, 0, 0, duration.UTC), 12, 2, -2, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClock := newManualClock(tt.now)
+
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           1,
+				MaxNodes:                           100,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 60,
+				FastNodeRemovalRate:                4,
+				SlowNodeRemovalRate:                2,
+				SoftDeleteGracePeriod:              "1m",
+				HardDeleteGracePeriod:              "10m",
+				ScaleUpCoolDownPeriod:              "1m",
+				CronJobPreWarm:                     []string{"batch/missing", "batch/broken", "batch/hourly"},
+				CronJobPreWarmLeadTime:             "10m",
+				CronJobPreWarmNodes:                10,
+			}}
+			nodes := buildTestNodes(tt.nodes, 1000, 1000)
+			pods := buildTestPods(tt.pods, 200, 200)
+			client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+			opts.Clock = mockClock
+			cronJobLister := test.NewTestCronJobLister(
+				&batchv1beta1.CronJob{
+					ObjectMeta: metav1.ObjectMeta{Name: "hourly", Namespace: "batch"},
+					Spec:       batchv1beta1.CronJobSpec{Schedule: "0 * * * *"},
+				},
+				&batchv1beta1.CronJob{
+					ObjectMeta: metav1.ObjectMeta{Name: "broken", Namespace: "batch"},
+					Spec:       batchv1beta1.CronJobSpec{Schedule: "every hour"},
+				},
+			)
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 1, 100, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+				listers:       resourceListers{cronJobs: cronJobLister},
+			}
+
+			nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDelta, nodesDelta)
+			assert.Equal(t, float64(tt.preWarmNodes), testutil.ToFloat64(metrics.NodeGroupCronJobPreWarmNodes.WithLabelValues("default")))
+		})
+	}
+}
+
+func TestScaleNodeGroup_CronJobPreWarmFromZero(t *testing.T) {
+	tests := []struct {
+		name          string
+		now           duration.Time
+		expectedDelta int
+		expectErr     bool
+	}{
+		// the hourly CronJob is scheduled in 5 minutes, so the node group is scaled up from zero
+		{"within lead time", duration.Date(2019, duration.January, 2, 10, 55, 0, 0, duration.UTC), 10, false},
+		// there is nothing to scale up for, so the node group is left without nodes
+		{"before lead time", duration.Date(2019, duration.January, 2, 10, 30, 0, 0, duration.UTC), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClock := newManualClock(tt.now)
+
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           0,
+				MaxNodes:                           100,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 60,
+				FastNodeRemovalRate:                4,
+				SlowNodeRemovalRate:                2,
+				SoftDeleteGracePeriod:              "1m",
+				HardDeleteGracePeriod:              "10m",
+				ScaleUpCoolDownPeriod:              "1m",
+				CronJobPreWarm:                     []string{"batch/hourly"},
+				CronJobPreWarmLeadTime:             "10m",
+				CronJobPreWarmNodes:                10,
+			}}
+			client, opts := buildTestClient(nil, nil, nodeGroups, ListerOptions{})
+			opts.Clock = mockClock
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 0, 100, 0)
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+				listers: resourceListers{cronJobs: test.NewTestCronJobLister(&batchv1beta1.CronJob{
+					ObjectMeta: metav1.ObjectMeta{Name: "hourly", Namespace: "batch"},
+					Spec:       batchv1beta1.CronJobSpec{Schedule: "0 * * * *"},
+				})},
+			}
+
+			nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			if tt.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedDelta, nodesDelta)
+			assert.Equal(t, int64(tt.expectedDelta), testNodeGroup.TargetSize())
+		})
+	}
+}
+
+func TestScanBackoff_CronJobPreWarm(t *testing.T) {
+	mockClock := newManualClock(duration.Date(2019, duration.January, 2, 10, 30, 0, 0, duration.UTC))
+
+	nodeGroups := []NodeGroupOptions{{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MinNodes:               1,
+		MaxNodes:               100,
+		CronJobPreWarm:         []string{"batch/hourly"},
+		CronJobPreWarmLeadTime: "10m",
+		CronJobPreWarmNodes:    10,
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	client, opts := buildTestClient(nodes, nil, nodeGroups, ListerOptions{})
+	opts.Clock = mockClock
+	opts.MaxScanBackoff = 5 * duration.Minute
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testCloudProvider.RegisterNodeGroup(test.NewNodeGroup("default", 1, 100, int64(len(nodes))))
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	nodeGroup := nodeGroupsState["default"]
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+		listers: resourceListers{cronJobs: test.NewTestCronJobLister(&batchv1beta1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "hourly", Namespace: "batch"},
+			Spec:       batchv1beta1.CronJobSpec{Schedule: "0 * * * *"},
+		})},
+	}
+	scans := func(n int) []bool {
+		scanned := make([]bool, 0, n)
+		for i := 0; i < n; i++ {
+			ok := controller.shouldScanNodeGroup("default", nodeGroup)
+			if ok {
+				controller.recordNodeGroupScan("default", nodeGroup, 0)
+			}
+			scanned = append(scanned, ok)
+		}
+		return scanned
+	}
+
+	// the lead time before the CronJob at 11:00 starts at 10:50, and ends when it is scheduled
+	assert.Equal(t, duration.Date(2019, duration.January, 2, 10, 50, 0, 0, duration.UTC), controller.nextCronJobPreWarmDeadline(nodeGroup, mockClock.Now()))
+	assert.Equal(t, []bool{true, true, true, true, false, true, false}, scans(7))
+
+	// the idle node group is scanned straight away once the lead time starts, so it is pre-warmed in time
+	mockClock.Set(duration.Date(2019, duration.January, 2, 10, 50, 0, 0, duration.UTC))
+	assert.Equal(t, []bool{true}, scans(1))
+	assert.Equal(t, 0, nodeGroup.scanBackoff.skip)
+	assert.Equal(t, duration.Date(2019, duration.January, 2, 11, 0, 0, 0, duration.UTC), controller.nextCronJobPreWarmDeadline(nodeGroup, mockClock.Now()))
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"math"
+	"time"
+)
+
+// deletionLimiter is a token bucket limiting the rate nodes are deleted across every node group
+// the bucket holds up to a minute of deletions and refills continuously
+type deletionLimiter struct {
+	perMinute int
+	tokens    float64
+	last      time.Time
+}
+
+// newDeletionLimiter creates a deletion limiter allowing perMinute node deletions a minute, starting full at now
+func newDeletionLimiter(perMinute int, now time.Time) *deletionLimiter {
+	return &deletionLimiter{
+		perMinute: perMinute,
+		tokens:    float64(perMinute),
+		last:      now,
+	}
+}
+
+// available returns how many of n nodes can be deleted at now, without taking any tokens
+// a nil limiter allows every deletion
+func (l *deletionLimiter) available(n int, now time.Time) int {
+	if l == nil {
+		return n
+	}
+	l.tokens = math.Min(float64(l.perMinute), l.tokens+now.Sub(l.last).Minutes()*float64(l.perMinute))
+	l.last = now
+
+	allowed := int(l.tokens)
+	if allowed > n {
+		allowed = n
+	}
+	return allowed
+}
+
+// take removes up to n tokens from the bucket at now and returns how many nodes can be deleted
+// a nil limiter allows every deletion
+func (l *deletionLimiter) take(n int, now time.Time) int {
+	allowed := l.available(n, now)
+	if l != nil {
+		l.tokens -= float64(allowed)
+	}
+	return allowed
+}
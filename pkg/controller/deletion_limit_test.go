@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeletionLimiterTake(t *testing.T) {
+	now := time.Now()
+
+	limiter := newDeletionLimiter(4, now)
+	// the limiter starts with a minute of deletions
+	assert.Equal(t, 3, limiter.take(3, now))
+	assert.Equal(t, 1, limiter.take(3, now))
+	assert.Equal(t, 0, limiter.take(1, now))
+
+	// tokens are refilled continuously
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, 2, limiter.take(3, now))
+
+	// up to a minute of deletions are kept
+	now = now.Add(10 * time.Minute)
+	assert.Equal(t, 4, limiter.take(10, now))
+
+	// checking the tokens available doesn't take them
+	assert.Equal(t, 0, limiter.available(1, now))
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, 2, limiter.available(3, now))
+	assert.Equal(t, 2, limiter.take(3, now))
+
+	// a nil limiter doesn't limit deletions
+	var unlimited *deletionLimiter
+	assert.Equal(t, 10, unlimited.available(10, now))
+	assert.Equal(t, 10, unlimited.take(10, now))
+}
@@ -0,0 +1,259 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/tracing"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// evictionRetryBackoff is how long a drain waits before evicting pods again after a pod disruption budget refused
+	// an eviction, doubled for every refusal up to maxEvictionRetryBackoff
+	evictionRetryBackoff    = 10 * time.Second
+	maxEvictionRetryBackoff = 5 * time.Minute
+)
+
+// evictionRetry is when the pods of a node whose evictions were refused by a pod disruption budget are evicted again
+type evictionRetry struct {
+	attempts int
+	next     time.Time
+}
+
+// drainNode evicts the remaining pods from a node that is about to be terminated and returns whether it can be
+// terminated yet. The node can be terminated once it is empty, or once the longest termination grace period of its
+// pods, capped by drain_timeout, has passed since they were evicted. The time the drain started is kept in draining
+// and the number of pods still on the node in podsRemaining
+// An eviction refused by a pod disruption budget is retried with a backoff, and the node isn't terminated whilst its
+// evictions are refused, however long the drain has taken, as terminating it would disrupt the pods the budget protects
+func (c *Controller) drainNode(ctx context.Context, nodeGroup *NodeGroupState, node *v1.Node, draining nodeTimes, podsRemaining map[string]int) (drained bool) {
+	pods, ok := k8s.NodePodsToDrain(node, nodeGroup.NodeInfoMap)
+	if !ok || len(pods) == 0 {
+		return true
+	}
+
+	_, span := tracing.StartSpan(ctx, "DrainNode",
+		tracing.String("nodegroup", nodeGroup.Opts.Name),
+		tracing.String("node", node.Name),
+		tracing.Int("pods", len(pods)),
+	)
+	defer func() {
+		span.SetAttributes(tracing.Bool("drained", drained))
+		tracing.EndSpan(span, nil)
+	}()
+
+	now := c.clock().Now()
+	since, ok := nodeGroup.drainingSince[node.Name]
+	if !ok {
+		if limit := nodeGroup.Opts.MaxConcurrentDrains; limit > 0 && drainsInFlight(nodeGroup, draining) >= limit {
+			log.WithField("nodegroup", nodeGroup.Opts.Name).Infof("Reached the maximum of %v concurrent drains. Draining node %v in a later scan", limit, node.Name)
+			return false
+		}
+		since = now
+		nodeGroup.nodeLog(node).Infof("Draining %v pods from node %v", len(pods), node.Name)
+		c.Opts.EventStream.Drain(nodeGroup.Opts.Name, node.Name, len(pods))
+		c.evictNodePods(nodeGroup, node, pods, now)
+	} else if retry, ok := nodeGroup.evictionsBlocked[node.Name]; ok && !now.Before(retry.next) {
+		nodeGroup.nodeLog(node).Infof("Evicting the pods of node %v again, attempt %v", node.Name, retry.attempts+1)
+		c.evictNodePods(nodeGroup, node, pods, now)
+	}
+	draining[node.Name] = since
+	podsRemaining[node.Name] = len(pods)
+
+	if retry, ok := nodeGroup.evictionsBlocked[node.Name]; ok {
+		nodeGroup.nodeLog(node).Warningf("Evicting pods from node %v is blocked by a pod disruption budget. Not terminating it until they can be evicted, retrying in %v",
+			node.Name, retry.next.Sub(now))
+		return false
+	}
+
+	wait := time.Duration(k8s.PodsTerminationGracePeriodSeconds(pods)) * time.Second
+	if timeout := nodeGroup.Opts.DrainTimeoutDuration(); wait > timeout {
+		wait = timeout
+	}
+	if now.Sub(since) < wait {
+		log.WithField("nodegroup", nodeGroup.Opts.Name).Debugf("Node %v still draining (%d pods remaining). Time remaining %v",
+			node.Name,
+			len(pods),
+			wait-now.Sub(since),
+		)
+		return false
+	}
+	return true
+}
+
+// evictNodePods evicts the pods of the node that aren't already terminating. If a pod disruption budget refuses any of
+// the evictions the node is tracked in evictionsBlocked, so they are retried after a backoff
+func (c *Controller) evictNodePods(nodeGroup *NodeGroupState, node *v1.Node, pods []*v1.Pod, now time.Time) {
+	blocked := false
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		err := k8s.EvictPod(pod, c.Client)
+		if apierrors.IsTooManyRequests(err) {
+			blocked = true
+			log.WithField("nodegroup", nodeGroup.Opts.Name).WithError(err).Warningf("pod disruption budget blocked evicting pod %v/%v from node %v", pod.Namespace, pod.Name, node.Name)
+		} else if err != nil {
+			log.WithField("nodegroup", nodeGroup.Opts.Name).WithError(err).Warningf("failed to evict pod %v/%v from node %v", pod.Namespace, pod.Name, node.Name)
+		}
+	}
+
+	if !blocked {
+		delete(nodeGroup.evictionsBlocked, node.Name)
+		return
+	}
+	if nodeGroup.evictionsBlocked == nil {
+		nodeGroup.evictionsBlocked = make(map[string]evictionRetry)
+	}
+	retry := nodeGroup.evictionsBlocked[node.Name]
+	backoff := evictionRetryBackoff << uint(retry.attempts)
+	if backoff > maxEvictionRetryBackoff || backoff <= 0 {
+		backoff = maxEvictionRetryBackoff
+	}
+	nodeGroup.evictionsBlocked[node.Name] = evictionRetry{attempts: retry.attempts + 1, next: now.Add(backoff)}
+}
+
+// cordonNodes cordons the nodes that are about to be drained and returns the nodes that weren't already cordoned
+func (c *Controller) cordonNodes(nodeGroup *NodeGroupState, nodes []*v1.Node) []*v1.Node {
+	cordoned := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		if _, err := k8s.CordonNode(node, c.Client); err != nil {
+			log.WithField("nodegroup", nodeGroup.Opts.Name).WithError(err).Warningf("failed to cordon node %v before draining", node.Name)
+			continue
+		}
+		cordoned = append(cordoned, node)
+	}
+	if len(cordoned) > 0 {
+		log.WithField("nodegroup", nodeGroup.Opts.Name).Infof("Cordoned %v nodes before draining", len(cordoned))
+	}
+	return cordoned
+}
+
+// revertCordons uncordons the cordoned nodes that weren't deleted, for when the removal of the nodes is aborted
+func (c *Controller) revertCordons(nodeGroup *NodeGroupState, cordoned []*v1.Node, deleted map[string]bool) {
+	for _, node := range cordoned {
+		if deleted[node.Name] {
+			continue
+		}
+		if _, err := k8s.UncordonNode(node, c.Client); err != nil {
+			log.WithField("nodegroup", nodeGroup.Opts.Name).WithError(err).Warningf("failed to revert the cordon of node %v", node.Name)
+		}
+	}
+}
+
+// drainsInFlight returns the number of nodes being drained in the node group. This is the drains continued or started
+// this scan so far, plus the drains started in earlier scans that haven't been checked yet this scan, as they are still
+// in progress until they are seen to have finished
+func drainsInFlight(nodeGroup *NodeGroupState, draining nodeTimes) int {
+	inFlight := len(draining)
+	for node := range nodeGroup.drainingSince {
+		if _, ok := draining[node]; !ok {
+			inFlight++
+		}
+	}
+	return inFlight
+}
+
+// drainReport is the progress of draining a node, served by the /drains endpoint
+type drainReport struct {
+	NodeGroup     string    `json:"node_group"`
+	Node          string    `json:"node"`
+	PodsRemaining int       `json:"pods_remaining"`
+	Since         time.Time `json:"since"`
+	Elapsed       string    `json:"elapsed"`
+}
+
+// drainReports holds the progress of the nodes being drained in each node group
+// it is updated by the scans and read by the /drains endpoint
+type drainReports struct {
+	sync.Mutex
+	nodeGroups map[string][]drainReport
+}
+
+// set replaces the drain progress of the node group
+func (d *drainReports) set(nodegroup string, reports []drainReport) {
+	d.Lock()
+	defer d.Unlock()
+	if d.nodeGroups == nil {
+		d.nodeGroups = make(map[string][]drainReport)
+	}
+	if len(reports) == 0 {
+		delete(d.nodeGroups, nodegroup)
+		return
+	}
+	d.nodeGroups[nodegroup] = reports
+}
+
+// list returns the drain progress of every node group sorted by node group and node, with the time elapsed since now
+func (d *drainReports) list(now time.Time) []drainReport {
+	d.Lock()
+	defer d.Unlock()
+	reports := make([]drainReport, 0)
+	for _, nodeGroupReports := range d.nodeGroups {
+		for _, report := range nodeGroupReports {
+			report.Elapsed = now.Sub(report.Since).Round(time.Second).String()
+			reports = append(reports, report)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].NodeGroup != reports[j].NodeGroup {
+			return reports[i].NodeGroup < reports[j].NodeGroup
+		}
+		return reports[i].Node < reports[j].Node
+	})
+	return reports
+}
+
+// setDraining replaces the nodes being drained in the node group and updates their drain progress
+func (c *Controller) setDraining(nodeGroup *NodeGroupState, draining nodeTimes, podsRemaining map[string]int) {
+	for node := range nodeGroup.drainingSince {
+		if _, ok := draining[node]; !ok {
+			metrics.NodeDrainPodsRemaining.DeleteLabelValues(nodeGroup.Opts.Name, node)
+		}
+	}
+	for node := range nodeGroup.evictionsBlocked {
+		if _, ok := draining[node]; !ok {
+			delete(nodeGroup.evictionsBlocked, node)
+		}
+	}
+	nodeGroup.drainingSince = draining
+	nodeGroup.drainingPods = podsRemaining
+	c.reportDrains(nodeGroup)
+}
+
+// drainFinished stops tracking the drain of a node that has been terminated
+func (c *Controller) drainFinished(nodeGroup *NodeGroupState, node string) {
+	if _, ok := nodeGroup.drainingSince[node]; !ok {
+		return
+	}
+	delete(nodeGroup.drainingSince, node)
+	delete(nodeGroup.drainingPods, node)
+	delete(nodeGroup.evictionsBlocked, node)
+	metrics.NodeDrainPodsRemaining.DeleteLabelValues(nodeGroup.Opts.Name, node)
+}
+
+// reportDrains publishes the drain progress of the node group to the pods remaining metric and the /drains endpoint
+func (c *Controller) reportDrains(nodeGroup *NodeGroupState) {
+	reports := make([]drainReport, 0, len(nodeGroup.drainingSince))
+	for node, since := range nodeGroup.drainingSince {
+		podsRemaining := nodeGroup.drainingPods[node]
+		metrics.NodeDrainPodsRemaining.WithLabelValues(nodeGroup.Opts.Name, node).Set(float64(podsRemaining))
+		reports = append(reports, drainReport{
+			NodeGroup:     nodeGroup.Opts.Name,
+			Node:          node,
+			PodsRemaining: podsRemaining,
+			Since:         since,
+		})
+	}
+	c.drains.set(nodeGroup.Opts.Name, reports)
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NodeGroupEnvPrefix is the prefix of the environment variables overriding the options of a node group, followed by the
+// node group name and the option, see NodeGroupEnvVar
+const NodeGroupEnvPrefix = "ESCALATOR_NODEGROUP_"
+
+// envOverride is a node group option that can be overridden by an environment variable
+type envOverride struct {
+	option string
+	field  func(*NodeGroupOptions) *int
+}
+
+// envOverrides are the node group options that can be overridden by environment variables
+var envOverrides = []envOverride{
+	{"scale_up_threshold_percent", func(n *NodeGroupOptions) *int { return &n.ScaleUpThresholdPercent }},
+	{"taint_lower_capacity_threshold_percent", func(n *NodeGroupOptions) *int { return &n.TaintLowerCapacityThresholdPercent }},
+	{"taint_upper_capacity_threshold_percent", func(n *NodeGroupOptions) *int { return &n.TaintUpperCapacityThresholdPercent }},
+}
+
+// NodeGroupEnvVar returns the environment variable overriding the option of the node group. The node group name and
+// option are upper cased with every character other than a letter or digit replaced by an underscore, e.g. the
+// scale_up_threshold_percent of the node group "shared-nodes" is ESCALATOR_NODEGROUP_SHARED_NODES_SCALE_UP_THRESHOLD_PERCENT
+func NodeGroupEnvVar(nodeGroup string, option string) string {
+	return NodeGroupEnvPrefix + envVarName(nodeGroup) + "_" + envVarName(option)
+}
+
+// envVarName upper cases the name and replaces every character other than a letter or digit with an underscore
+func envVarName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// ApplyNodeGroupEnvOverrides returns the node groups with the thresholds overridden by the environment variables found
+// with lookupEnv, such as os.LookupEnv. An environment variable set to an empty string doesn't override the option.
+// The overrides take precedence over the options read from the config file, so they must be applied before the node
+// groups are validated. An error is returned if an environment variable isn't an integer
+func ApplyNodeGroupEnvOverrides(nodeGroups []NodeGroupOptions, lookupEnv func(string) (string, bool)) ([]NodeGroupOptions, error) {
+	overridden := make([]NodeGroupOptions, len(nodeGroups))
+	copy(overridden, nodeGroups)
+	for i := range overridden {
+		nodeGroup := &overridden[i]
+		for _, override := range envOverrides {
+			name := NodeGroupEnvVar(nodeGroup.Name, override.option)
+			value, ok := lookupEnv(name)
+			if !ok || len(value) == 0 {
+				continue
+			}
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%v must be an integer to override %v of node group %v: %v", name, override.option, nodeGroup.Name, err)
+			}
+			field := override.field(nodeGroup)
+			log.WithField("nodegroup", nodeGroup.Name).Infof("Overriding %v of %v with %v from %v", override.option, *field, parsed, name)
+			*field = parsed
+		}
+	}
+	return overridden, nil
+}
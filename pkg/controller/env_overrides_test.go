@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeGroupEnvVar(t *testing.T) {
+	assert.Equal(t, "ESCALATOR_NODEGROUP_DEFAULT_SCALE_UP_THRESHOLD_PERCENT", NodeGroupEnvVar("default", "scale_up_threshold_percent"))
+	assert.Equal(t, "ESCALATOR_NODEGROUP_SHARED_NODES_2_SCALE_UP_THRESHOLD_PERCENT", NodeGroupEnvVar("shared-nodes.2", "scale_up_threshold_percent"))
+}
+
+func TestApplyNodeGroupEnvOverrides(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{
+		{Name: "shared-nodes", ScaleUpThresholdPercent: 70, TaintLowerCapacityThresholdPercent: 40, TaintUpperCapacityThresholdPercent: 60},
+		{Name: "buildeng", ScaleUpThresholdPercent: 70, TaintLowerCapacityThresholdPercent: 40, TaintUpperCapacityThresholdPercent: 60},
+	}
+	lookup := func(env map[string]string) func(string) (string, bool) {
+		return func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		}
+	}
+
+	t.Run("overrides", func(t *testing.T) {
+		overridden, err := ApplyNodeGroupEnvOverrides(nodeGroups, lookup(map[string]string{
+			"ESCALATOR_NODEGROUP_SHARED_NODES_SCALE_UP_THRESHOLD_PERCENT":             "80",
+			"ESCALATOR_NODEGROUP_SHARED_NODES_TAINT_LOWER_CAPACITY_THRESHOLD_PERCENT": "30",
+			"ESCALATOR_NODEGROUP_BUILDENG_TAINT_UPPER_CAPACITY_THRESHOLD_PERCENT":     "50",
+			"ESCALATOR_NODEGROUP_BUILDENG_SCALE_UP_THRESHOLD_PERCENT":                 "",
+			"ESCALATOR_NODEGROUP_OTHER_SCALE_UP_THRESHOLD_PERCENT":                    "90",
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, []NodeGroupOptions{
+			{Name: "shared-nodes", ScaleUpThresholdPercent: 80, TaintLowerCapacityThresholdPercent: 30, TaintUpperCapacityThresholdPercent: 60},
+			{Name: "buildeng", ScaleUpThresholdPercent: 70, TaintLowerCapacityThresholdPercent: 40, TaintUpperCapacityThresholdPercent: 50},
+		}, overridden)
+		// the node groups read from the file are left as they were
+		assert.Equal(t, 70, nodeGroups[0].ScaleUpThresholdPercent)
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		_, err := ApplyNodeGroupEnvOverrides(nodeGroups, lookup(map[string]string{
+			"ESCALATOR_NODEGROUP_BUILDENG_SCALE_UP_THRESHOLD_PERCENT": "eighty",
+		}))
+		assert.Error(t, err)
+	})
+
+	t.Run("overridden options are validated", func(t *testing.T) {
+		overridden, err := ApplyNodeGroupEnvOverrides(nodeGroups, lookup(map[string]string{
+			"ESCALATOR_NODEGROUP_BUILDENG_SCALE_UP_THRESHOLD_PERCENT": "0",
+		}))
+		require.NoError(t, err)
+		var problems []string
+		for _, problem := range ValidateNodeGroup(overridden[1]) {
+			problems = append(problems, problem.Error())
+		}
+		assert.Contains(t, problems, "scale_up_threshold_percent must be larger than 0")
+	})
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// scaleEvent is a scale up or scale down of a node group, kept to detect the node group flapping between them
+type scaleEvent struct {
+	at     time.Time
+	action string
+	nodes  int
+}
+
+// String returns the scale event as it is logged in the recent action history
+func (e scaleEvent) String() string {
+	return fmt.Sprintf("%v of %v nodes at %v", e.action, e.nodes, e.at.UTC().Format(time.RFC3339))
+}
+
+// recordScaleEvent adds a scale up or scale down to the history of the node group, if flap_detection_window is set
+func (c *Controller) recordScaleEvent(nodegroup string, action string, nodes int) {
+	nodeGroup, ok := c.nodeGroups[nodegroup]
+	if !ok || nodeGroup.Opts.FlapDetectionWindowDuration() == 0 {
+		return
+	}
+	nodeGroup.scaleHistory = append(nodeGroup.scaleHistory, scaleEvent{at: c.clock().Now(), action: action, nodes: nodes})
+}
+
+// updateFlapping forgets the scale events older than the flap_detection_window and sets whether the node group is
+// flapping, i.e. has changed between scaling up and scaling down at least flap_detection_threshold times within the
+// window. A warning with the recent action history is logged when the node group starts flapping
+func (c *Controller) updateFlapping(nodegroup string, nodeGroup *NodeGroupState) {
+	window := nodeGroup.Opts.FlapDetectionWindowDuration()
+	if window == 0 {
+		nodeGroup.scaleHistory = nil
+		nodeGroup.flapping = false
+		metrics.NodeGroupFlapping.WithLabelValues(nodegroup).Set(0)
+		return
+	}
+
+	since := c.clock().Now().Add(-window)
+	recent := nodeGroup.scaleHistory[:0]
+	for _, event := range nodeGroup.scaleHistory {
+		if event.at.After(since) {
+			recent = append(recent, event)
+		}
+	}
+	nodeGroup.scaleHistory = recent
+
+	changes := countScaleDirectionChanges(recent)
+	flapping := changes >= nodeGroup.Opts.FlapDetectionThresholdOrDefault()
+	switch {
+	case flapping && !nodeGroup.flapping:
+		history := make([]string, 0, len(recent))
+		for _, event := range recent {
+			history = append(history, event.String())
+		}
+		log.WithField("nodegroup", nodegroup).Warningf("Node group is flapping. It changed between scaling up and scaling down %v times in the last %v: %v. Consider widening the gap between the thresholds or increasing the cool down periods",
+			changes, window, strings.Join(history, ", "))
+	case !flapping && nodeGroup.flapping:
+		log.WithField("nodegroup", nodegroup).Infof("Node group is no longer flapping")
+	}
+	nodeGroup.flapping = flapping
+	if flapping {
+		metrics.NodeGroupFlapping.WithLabelValues(nodegroup).Set(1)
+	} else {
+		metrics.NodeGroupFlapping.WithLabelValues(nodegroup).Set(0)
+	}
+}
+
+// countScaleDirectionChanges returns the number of times consecutive scale events went in opposite directions
+func countScaleDirectionChanges(events []scaleEvent) int {
+	changes := 0
+	for i := 1; i < len(events); i++ {
+		if events[i].action != events[i-1].action {
+			changes++
+		}
+	}
+	return changes
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControllerUpdateFlapping(t *testing.T) {
+	mockClock := newManualClock(time.Now())
+
+	flapping := &NodeGroupState{Opts: NodeGroupOptions{Name: "flapping", FlapDetectionWindow: "1h", FlapDetectionThreshold: 2}}
+	disabled := &NodeGroupState{Opts: NodeGroupOptions{Name: "disabled"}}
+	controller := &Controller{
+		Opts:       Opts{Clock: mockClock},
+		nodeGroups: map[string]*NodeGroupState{"flapping": flapping, "disabled": disabled},
+	}
+	flappingMetric := func(nodegroup string) float64 {
+		return testutil.ToFloat64(metrics.NodeGroupFlapping.WithLabelValues(nodegroup))
+	}
+
+	// scaling in the same direction isn't flapping
+	controller.recordScaleUp("flapping", 0, 2)
+	mockClock.Add(10 * time.Minute)
+	controller.recordScaleUp("flapping", 1, 0)
+	controller.updateFlapping("flapping", flapping)
+	assert.Equal(t, float64(0), flappingMetric("flapping"))
+
+	// changing direction flap_detection_threshold times within the window is
+	mockClock.Add(10 * time.Minute)
+	controller.recordScaleDown("flapping", 2)
+	controller.updateFlapping("flapping", flapping)
+	assert.Equal(t, float64(0), flappingMetric("flapping"))
+	mockClock.Add(10 * time.Minute)
+	controller.recordScaleUp("flapping", 0, 1)
+	controller.updateFlapping("flapping", flapping)
+	assert.Equal(t, float64(1), flappingMetric("flapping"))
+	assert.True(t, flapping.flapping)
+	assert.Len(t, flapping.scaleHistory, 4)
+
+	// until the changes are older than the window
+	mockClock.Add(45 * time.Minute)
+	controller.updateFlapping("flapping", flapping)
+	assert.Equal(t, float64(0), flappingMetric("flapping"))
+	assert.False(t, flapping.flapping)
+	assert.Len(t, flapping.scaleHistory, 2)
+
+	// the scale events aren't kept without flap_detection_window
+	for i := 0; i < 4; i++ {
+		controller.recordScaleUp("disabled", 0, 1)
+		controller.recordScaleDown("disabled", 1)
+	}
+	controller.updateFlapping("disabled", disabled)
+	assert.Equal(t, float64(0), flappingMetric("disabled"))
+	assert.Empty(t, disabled.scaleHistory)
+}
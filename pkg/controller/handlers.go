@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RegisterHandlers registers the controller admin endpoints, POST /pause, /resume and /scan and GET /config, on the mux
+// If Opts.AdminToken is set, the endpoints require it as a bearer token
+// The read only GET /drains and /recommendations endpoints are also registered, and don't require the admin token
+func (c *Controller) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/pause", c.adminHandler(postHandler(c.Pause)))
+	mux.HandleFunc("/resume", c.adminHandler(postHandler(c.Resume)))
+	mux.HandleFunc("/scan", c.adminHandler(postHandler(c.TriggerScan)))
+	mux.HandleFunc("/config", c.adminHandler(c.configHandler))
+	mux.HandleFunc("/drains", c.drainsHandler)
+	mux.HandleFunc("/recommendations", c.recommendationsHandler)
+}
+
+// drainsHandler serves the progress of the nodes being drained in every node group as JSON
+func (c *Controller) drainsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(c.drains.list(c.clock().Now())); err != nil {
+		log.WithError(err).Warning("Failed to write the drain progress")
+	}
+}
+
+// recommendationsHandler serves the utilization statistics and advisory option changes of every node group as JSON
+func (c *Controller) recommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(c.utilization.recommend()); err != nil {
+		log.WithError(err).Warning("Failed to write the recommendations")
+	}
+}
+
+// configHandler serves the effective options of every node group being scanned, with their defaults, as JSON
+func (c *Controller) configHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(c.config.get()); err != nil {
+		log.WithError(err).Warning("Failed to write the effective config")
+	}
+}
+
+// adminHandler wraps a mutating or sensitive handler so it is only called with the admin bearer token
+// the handler is returned as is if no admin token is configured
+func (c *Controller) adminHandler(handler http.HandlerFunc) http.HandlerFunc {
+	if len(c.Opts.AdminToken) == 0 {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		if token == authorization || subtle.ConstantTimeCompare([]byte(token), []byte(c.Opts.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// postHandler returns a handler that only accepts POST requests and calls action
+func postHandler(action func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		action()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers(t *testing.T) {
+	controller := &Controller{}
+	mux := http.NewServeMux()
+	controller.RegisterHandlers(mux)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantPaused bool
+	}{
+		{"pause", http.MethodPost, "/pause", http.StatusNoContent, true},
+		{"get is not allowed", http.MethodGet, "/resume", http.StatusMethodNotAllowed, true},
+		{"resume", http.MethodPost, "/resume", http.StatusNoContent, false},
+		{"scan", http.MethodPost, "/scan", http.StatusNoContent, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, nil))
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+			assert.Equal(t, tt.wantPaused, controller.Paused())
+		})
+	}
+}
+
+func TestHandlersAdminToken(t *testing.T) {
+	controller := &Controller{Opts: Opts{AdminToken: "secret"}}
+	mux := http.NewServeMux()
+	controller.RegisterHandlers(mux)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantPaused    bool
+	}{
+		{"no token", "", http.StatusUnauthorized, false},
+		{"wrong token", "Bearer wrong", http.StatusUnauthorized, false},
+		{"token without bearer scheme", "secret", http.StatusUnauthorized, false},
+		{"valid token", "Bearer secret", http.StatusNoContent, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/pause", nil)
+			if len(tt.authorization) > 0 {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, request)
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+			assert.Equal(t, tt.wantPaused, controller.Paused())
+		})
+	}
+}
+
+func TestDrainsHandler(t *testing.T) {
+	mockClock := newManualClock(time.Now())
+	since := mockClock.Now()
+
+	controller := &Controller{Opts: Opts{AdminToken: "secret", Clock: mockClock}}
+	controller.drains.set("default", []drainReport{
+		{NodeGroup: "default", Node: "node-b", PodsRemaining: 1, Since: since},
+		{NodeGroup: "default", Node: "node-a", PodsRemaining: 3, Since: since},
+	})
+	mux := http.NewServeMux()
+	controller.RegisterHandlers(mux)
+	mockClock.Add(90 * time.Second)
+
+	// the drain progress is read only and doesn't need the admin token
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/drains", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var reports []drainReport
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &reports))
+	require.Len(t, reports, 2)
+	assert.Equal(t, "node-a", reports[0].Node)
+	assert.Equal(t, 3, reports[0].PodsRemaining)
+	assert.Equal(t, "1m30s", reports[0].Elapsed)
+	assert.Equal(t, "node-b", reports[1].Node)
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/drains", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
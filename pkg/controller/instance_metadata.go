@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+)
+
+// updateInstanceMetadata looks up the metadata of the instances backing the nodes, if the cloud provider node group
+// implements cloudprovider.InstanceMetadataProvider. Nodes whose metadata isn't known are left out
+func (c *Controller) updateInstanceMetadata(nodeGroup *NodeGroupState, nodes []*v1.Node) {
+	cloudProviderNodeGroup, ok := getCloudProviderNodeGroup(c.cloudProvider, nodeGroup.Opts)
+	if !ok {
+		nodeGroup.instanceMetadata = nil
+		return
+	}
+	if _, ok := cloudProviderNodeGroup.(cloudprovider.InstanceMetadataProvider); !ok {
+		nodeGroup.instanceMetadata = nil
+		return
+	}
+
+	instanceMetadata := make(map[string]cloudprovider.InstanceMetadata, len(nodes))
+	for _, node := range nodes {
+		if metadata, ok := cloudprovider.GetInstanceMetadata(cloudProviderNodeGroup, node); ok {
+			instanceMetadata[node.Name] = metadata
+		}
+	}
+	nodeGroup.instanceMetadata = instanceMetadata
+}
+
+// nodeLog returns a log entry for a scale action on the node, with the metadata of the instance backing the node as
+// fields so the actions can be correlated with the instance types and availability zones
+func (n *NodeGroupState) nodeLog(node *v1.Node) *log.Entry {
+	fields := log.Fields{"nodegroup": n.Opts.Name}
+	metadata := n.instanceMetadata[node.Name]
+	if len(metadata.InstanceType) > 0 {
+		fields["instance_type"] = metadata.InstanceType
+	}
+	if len(metadata.AvailabilityZone) > 0 {
+		fields["availability_zone"] = metadata.AvailabilityZone
+	}
+	if len(metadata.LifecycleState) > 0 {
+		fields["lifecycle_state"] = metadata.LifecycleState
+	}
+	return log.WithFields(fields)
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// LabelMismatchActionIgnore does nothing with nodes missing the node group label
+	LabelMismatchActionIgnore = "ignore"
+	// LabelMismatchActionWarn logs a warning for each node missing the node group label
+	LabelMismatchActionWarn = "warn"
+	// LabelMismatchActionCordon cordons each node missing the node group label
+	LabelMismatchActionCordon = "cordon"
+)
+
+// reconcileLabelMismatchNodes finds the nodes in the cloud provider node group that are missing the node group label
+// and applies the label_mismatch_action to them. These nodes are not managed by Escalator but use capacity in the
+// cloud provider node group. They are counted whatever the action, so the metric is set every scan. Returns the number of
+// nodes found
+func (c *Controller) reconcileLabelMismatchNodes(nodegroup string, nodeGroup *NodeGroupState) (mismatched int) {
+	defer func() {
+		metrics.NodeGroupLabelMismatchNodes.WithLabelValues(nodegroup).Set(float64(mismatched))
+	}()
+	action := nodeGroup.Opts.LabelMismatchAction
+
+	cloudProviderNodeGroup, ok := getCloudProviderNodeGroup(c.cloudProvider, nodeGroup.Opts)
+	if !ok {
+		log.WithField("nodegroup", nodegroup).Warningf("cloud provider node group does not exist: %s. Skipping label mismatch check", nodeGroup.Opts.CloudProviderGroupName)
+		return 0
+	}
+
+	nodes, err := c.Client.allNodeLister.List(labels.Everything())
+	if err != nil {
+		log.WithField("nodegroup", nodegroup).WithError(err).Error("Failed to list nodes for label mismatch check")
+		return 0
+	}
+
+	hasLabel := NewNodeLabelFilterFunc(nodeGroup.Opts.LabelKey, nodeGroup.Opts.LabelValue)
+	mismatches := func(node *v1.Node) bool {
+		// nodes another tool is deleting are left to it
+		return !hasLabel(node) && cloudProviderNodeGroup.Belongs(node) && !k8s.HasAnyTaintKey(node, nodeGroup.Opts.ExternalDeletionTaints)
+	}
+	for _, node := range nodes {
+		if !mismatches(node) {
+			continue
+		}
+		mismatched++
+		if len(action) == 0 || action == LabelMismatchActionIgnore {
+			continue
+		}
+
+		log.WithField("nodegroup", nodegroup).Warningf("Node %v, %v is in the cloud provider node group but is missing the label %v=%v",
+			node.Name,
+			node.Spec.ProviderID,
+			nodeGroup.Opts.LabelKey,
+			nodeGroup.Opts.LabelValue,
+		)
+
+		if action != LabelMismatchActionCordon || node.Spec.Unschedulable {
+			continue
+		}
+		drymode := c.dryMode(nodeGroup)
+		if drymode || c.scalingPaused(nodeGroup) {
+			log.WithField("nodegroup", nodegroup).WithField("drymode", drymode).Infof("Node %v missing the node group label would be cordoned", node.Name)
+			continue
+		}
+
+		// the lister may be behind a node that was still joining, so check the latest version of the node is still
+		// missing the label before cordoning it
+		latest, err := c.Client.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+		if err != nil {
+			log.WithField("nodegroup", nodegroup).WithError(err).Errorf("failed to get node %v missing the node group label", node.Name)
+			continue
+		}
+		if !mismatches(latest) || latest.Spec.Unschedulable {
+			log.WithField("nodegroup", nodegroup).Infof("Node %v has been labelled or cordoned since it was listed. Not cordoning it", node.Name)
+			continue
+		}
+		if _, err := k8s.CordonNode(latest, c.Client); err != nil {
+			log.WithField("nodegroup", nodegroup).WithError(err).Errorf("failed to cordon node %v missing the node group label", node.Name)
+		}
+	}
+	return mismatched
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+func TestReconcileLabelMismatchNodes(t *testing.T) {
+	tests := []struct {
+		name         string
+		action       string
+		wantCount    int
+		wantCordoned []string
+	}{
+		{"ignore", LabelMismatchActionIgnore, 1, nil},
+		{"warn", LabelMismatchActionWarn, 1, nil},
+		{"cordon", LabelMismatchActionCordon, 1, []string{"unlabelled-in-group"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := []*v1.Node{
+				test.BuildTestNode(test.NodeOpts{Name: "labelled-in-group", LabelKey: "customer", LabelValue: "shared"}),
+				test.BuildTestNode(test.NodeOpts{Name: "unlabelled-in-group"}),
+				test.BuildTestNode(test.NodeOpts{Name: "unlabelled-other-group"}),
+			}
+
+			nodeGroups := []NodeGroupOptions{{
+				Name:                   "shared",
+				LabelKey:               "customer",
+				LabelValue:             "shared",
+				CloudProviderGroupName: "shared",
+				MinNodes:               1,
+				MaxNodes:               10,
+				LabelMismatchAction:    tt.action,
+			}}
+			client, opts := buildTestClient(nodes, nil, nodeGroups, ListerOptions{})
+
+			testCloudProvider := &orphanTestCloudProvider{
+				CloudProvider: test.NewCloudProvider(1),
+				nodeGroup: &orphanTestNodeGroup{
+					NodeGroup: test.NewNodeGroup("shared", 1, 10, 2),
+					instances: map[string]bool{"labelled-in-group": true, "unlabelled-in-group": true},
+				},
+			}
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			count := controller.reconcileLabelMismatchNodes("shared", nodeGroupsState["shared"])
+			assert.Equal(t, tt.wantCount, count)
+			assert.Equal(t, float64(tt.wantCount), testutil.ToFloat64(metrics.NodeGroupLabelMismatchNodes.WithLabelValues("shared")))
+
+			var cordoned []string
+			for _, action := range opts.K8SClient.(*fake.Clientset).Actions() {
+				if action.Matches("update", "nodes") {
+					node := action.(core.UpdateAction).GetObject().(*v1.Node)
+					assert.True(t, node.Spec.Unschedulable)
+					cordoned = append(cordoned, node.Name)
+				}
+			}
+			assert.Equal(t, tt.wantCordoned, cordoned)
+		})
+	}
+}
+
+func TestReconcileLabelMismatchNodesLabelledSinceListed(t *testing.T) {
+	nodes := []*v1.Node{test.BuildTestNode(test.NodeOpts{Name: "joining"})}
+	nodeGroups := []NodeGroupOptions{{
+		Name:                   "shared",
+		LabelKey:               "customer",
+		LabelValue:             "shared",
+		CloudProviderGroupName: "shared",
+		MinNodes:               1,
+		MaxNodes:               10,
+		LabelMismatchAction:    LabelMismatchActionCordon,
+	}}
+	client, opts := buildTestClient(nodes, nil, nodeGroups, ListerOptions{})
+
+	// the node has been labelled since the lister last saw it
+	labelled := test.BuildTestNode(test.NodeOpts{Name: "joining", LabelKey: "customer", LabelValue: "shared"})
+	opts.K8SClient.(*fake.Clientset).PrependReactor("get", "nodes", func(action core.Action) (bool, runtime.Object, error) {
+		return true, labelled, nil
+	})
+
+	testCloudProvider := &orphanTestCloudProvider{
+		CloudProvider: test.NewCloudProvider(1),
+		nodeGroup: &orphanTestNodeGroup{
+			NodeGroup: test.NewNodeGroup("shared", 1, 10, 1),
+			instances: map[string]bool{"joining": true},
+		},
+	}
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      nil,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	controller.reconcileLabelMismatchNodes("shared", nodeGroupsState["shared"])
+	for _, action := range opts.K8SClient.(*fake.Clientset).Actions() {
+		assert.False(t, action.Matches("update", "nodes"), "the node should not be cordoned")
+	}
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"sync"
+	duration "time"
+
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/pkg/errors"
+	appsv1lister "k8s.io/client-go/listers/apps/v1"
+	batchv1beta1lister "k8s.io/client-go/listers/batch/v1beta1"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// listerSyncTimeout is how long a scan waits for a lister started by it to sync
+const listerSyncTimeout = 30 * duration.Second
+
+// resourceListers are the cached listers of the resources only some node group options read. Each is started the
+// first time an option needs it, so the resources are read from the cache rather than the API every scan, and
+// escalator only needs the RBAC permissions to list and watch them when the options are used
+type resourceListers struct {
+	sync.Mutex
+	cronJobs       batchv1beta1lister.CronJobLister
+	cronJobsSynced cache.InformerSynced
+
+	claims                  v1lister.PersistentVolumeClaimLister
+	claimsSynced            cache.InformerSynced
+	persistentVolumes       v1lister.PersistentVolumeLister
+	persistentVolumesSynced cache.InformerSynced
+
+	replicaSets        appsv1lister.ReplicaSetLister
+	replicaSetsSynced  cache.InformerSynced
+	deployments        appsv1lister.DeploymentLister
+	deploymentsSynced  cache.InformerSynced
+	statefulSets       appsv1lister.StatefulSetLister
+	statefulSetsSynced cache.InformerSynced
+}
+
+// cronJobLister returns the CronJob lister, starting it the first time it is needed
+func (c *Controller) cronJobLister() (batchv1beta1lister.CronJobLister, error) {
+	c.listers.Lock()
+	defer c.listers.Unlock()
+	if c.listers.cronJobs == nil {
+		c.listers.cronJobs, c.listers.cronJobsSynced = k8s.NewCacheCronJobWatcher(c.Client.Interface, c.stopChan)
+	}
+	if err := waitForListerSync("CronJob", c.listers.cronJobsSynced); err != nil {
+		return nil, err
+	}
+	return c.listers.cronJobs, nil
+}
+
+// persistentVolumeListers returns the persistent volume claim and persistent volume listers, starting them the first
+// time they are needed
+func (c *Controller) persistentVolumeListers() (v1lister.PersistentVolumeClaimLister, v1lister.PersistentVolumeLister, error) {
+	c.listers.Lock()
+	defer c.listers.Unlock()
+	if c.listers.claims == nil {
+		c.listers.claims, c.listers.claimsSynced = k8s.NewCachePersistentVolumeClaimWatcher(c.Client.Interface, c.stopChan)
+	}
+	if c.listers.persistentVolumes == nil {
+		c.listers.persistentVolumes, c.listers.persistentVolumesSynced = k8s.NewCachePersistentVolumeWatcher(c.Client.Interface, c.stopChan)
+	}
+	if err := waitForListerSync("PersistentVolumeClaim", c.listers.claimsSynced); err != nil {
+		return nil, nil, err
+	}
+	if err := waitForListerSync("PersistentVolume", c.listers.persistentVolumesSynced); err != nil {
+		return nil, nil, err
+	}
+	return c.listers.claims, c.listers.persistentVolumes, nil
+}
+
+// workloadListers returns the ReplicaSet, Deployment and StatefulSet listers, starting them the first time they are
+// needed
+func (c *Controller) workloadListers() (appsv1lister.ReplicaSetLister, appsv1lister.DeploymentLister, appsv1lister.StatefulSetLister, error) {
+	c.listers.Lock()
+	defer c.listers.Unlock()
+	if c.listers.replicaSets == nil {
+		c.listers.replicaSets, c.listers.replicaSetsSynced = k8s.NewCacheReplicaSetWatcher(c.Client.Interface, c.stopChan)
+	}
+	if c.listers.deployments == nil {
+		c.listers.deployments, c.listers.deploymentsSynced = k8s.NewCacheDeploymentWatcher(c.Client.Interface, c.stopChan)
+	}
+	if c.listers.statefulSets == nil {
+		c.listers.statefulSets, c.listers.statefulSetsSynced = k8s.NewCacheStatefulSetWatcher(c.Client.Interface, c.stopChan)
+	}
+	if err := waitForListerSync("ReplicaSet", c.listers.replicaSetsSynced); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := waitForListerSync("Deployment", c.listers.deploymentsSynced); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := waitForListerSync("StatefulSet", c.listers.statefulSetsSynced); err != nil {
+		return nil, nil, nil, err
+	}
+	return c.listers.replicaSets, c.listers.deployments, c.listers.statefulSets, nil
+}
+
+// waitForListerSync waits up to listerSyncTimeout for a lister to sync, e.g. when it was just started. A lister
+// without a synced func is always synced
+func waitForListerSync(resource string, synced cache.InformerSynced) error {
+	if synced == nil || synced() {
+		return nil
+	}
+	stop := make(chan struct{})
+	timer := duration.AfterFunc(listerSyncTimeout, func() { close(stop) })
+	defer timer.Stop()
+	if !cache.WaitForCacheSync(stop, synced) {
+		return errors.Errorf("the %v cache didn't sync within %v", resource, listerSyncTimeout)
+	}
+	return nil
+}
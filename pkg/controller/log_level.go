@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// nodeGroupLogFormatter wraps the formatter of the standard logger, dropping the entries logged for a node group that
+// are less severe than the log_level of the node group. Entries of node groups without a log_level, and entries not
+// logged for a node group, are dropped if they are less severe than the global level
+type nodeGroupLogFormatter struct {
+	log.Formatter
+	// level is the global level the standard logger had before the formatter was installed
+	level log.Level
+
+	sync.RWMutex
+	levels map[string]log.Level
+}
+
+// Format formats the entry with the wrapped formatter, or returns nothing if the entry is dropped
+func (f *nodeGroupLogFormatter) Format(entry *log.Entry) ([]byte, error) {
+	level := f.level
+	if nodegroup, ok := entry.Data["nodegroup"].(string); ok {
+		f.RLock()
+		if nodeGroupLevel, ok := f.levels[nodegroup]; ok {
+			level = nodeGroupLevel
+		}
+		f.RUnlock()
+	}
+	if entry.Level > level {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
+
+// applyNodeGroupLogLevels applies the log_level of every node group to the standard logger
+// the global level is raised to the most verbose node group level so its entries reach the formatter, which drops
+// the entries of the other node groups. The standard logger is left alone until a node group sets a log_level
+func (c *Controller) applyNodeGroupLogLevels() {
+	levels := make(map[string]log.Level)
+	for name, state := range c.nodeGroups {
+		if level, ok := state.Opts.ParseLogLevel(); ok {
+			levels[name] = level
+		}
+	}
+
+	formatter, installed := log.StandardLogger().Formatter.(*nodeGroupLogFormatter)
+	if !installed {
+		if len(levels) == 0 {
+			return
+		}
+		formatter = &nodeGroupLogFormatter{Formatter: log.StandardLogger().Formatter, level: log.GetLevel()}
+		log.SetFormatter(formatter)
+	}
+
+	formatter.Lock()
+	formatter.levels = levels
+	formatter.Unlock()
+
+	level := formatter.level
+	for _, nodeGroupLevel := range levels {
+		if nodeGroupLevel > level {
+			level = nodeGroupLevel
+		}
+	}
+	log.SetLevel(level)
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeGroupLogFormatter(t *testing.T) {
+	formatter := &nodeGroupLogFormatter{
+		Formatter: &log.TextFormatter{DisableColors: true, DisableTimestamp: true},
+		level:     log.InfoLevel,
+		levels:    map[string]log.Level{"debugged": log.DebugLevel, "quiet": log.ErrorLevel},
+	}
+	format := func(level log.Level, fields log.Fields) string {
+		entry := log.NewEntry(log.New()).WithFields(fields)
+		entry.Level = level
+		entry.Message = "message"
+		got, err := formatter.Format(entry)
+		require.NoError(t, err)
+		return string(got)
+	}
+
+	tests := []struct {
+		name    string
+		level   log.Level
+		fields  log.Fields
+		dropped bool
+	}{
+		{"debug without node group", log.DebugLevel, nil, true},
+		{"info without node group", log.InfoLevel, nil, false},
+		{"debug of node group without log level", log.DebugLevel, log.Fields{"nodegroup": "default"}, true},
+		{"debug of debugged node group", log.DebugLevel, log.Fields{"nodegroup": "debugged"}, false},
+		{"info of quiet node group", log.InfoLevel, log.Fields{"nodegroup": "quiet"}, true},
+		{"error of quiet node group", log.ErrorLevel, log.Fields{"nodegroup": "quiet"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := format(tt.level, tt.fields)
+			if tt.dropped {
+				assert.Empty(t, got)
+			} else {
+				assert.Contains(t, got, "msg=message")
+			}
+		})
+	}
+}
+
+func TestControllerApplyNodeGroupLogLevels(t *testing.T) {
+	previousFormatter, previousLevel := log.StandardLogger().Formatter, log.GetLevel()
+	defer func() {
+		log.SetFormatter(previousFormatter)
+		log.SetLevel(previousLevel)
+	}()
+	log.SetLevel(log.InfoLevel)
+
+	controller := &Controller{nodeGroups: map[string]*NodeGroupState{
+		"default": {Opts: NodeGroupOptions{Name: "default"}},
+	}}
+
+	// the standard logger is left alone until a node group sets a log level
+	controller.applyNodeGroupLogLevels()
+	assert.Equal(t, previousFormatter, log.StandardLogger().Formatter)
+	assert.Equal(t, log.InfoLevel, log.GetLevel())
+
+	controller.nodeGroups["debugged"] = &NodeGroupState{Opts: NodeGroupOptions{Name: "debugged", LogLevel: "debug"}}
+	controller.applyNodeGroupLogLevels()
+	formatter, ok := log.StandardLogger().Formatter.(*nodeGroupLogFormatter)
+	require.True(t, ok)
+	assert.Equal(t, log.InfoLevel, formatter.level)
+	assert.Equal(t, map[string]log.Level{"debugged": log.DebugLevel}, formatter.levels)
+	assert.Equal(t, log.DebugLevel, log.GetLevel())
+
+	// reloading the options without the log level returns to the global level, keeping the formatter
+	controller.nodeGroups["debugged"].Opts.LogLevel = ""
+	controller.applyNodeGroupLogLevels()
+	assert.Equal(t, formatter, log.StandardLogger().Formatter)
+	assert.Empty(t, formatter.levels)
+	assert.Equal(t, log.InfoLevel, log.GetLevel())
+}
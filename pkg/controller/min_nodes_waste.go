@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+)
+
+// EventReasonNodeGroupMinNodesWasteful is the reason of the kubernetes event recorded when min_nodes keeps idle nodes
+const EventReasonNodeGroupMinNodesWasteful = "NodeGroupMinNodesWasteful"
+
+// calcDemandNodes estimates the fewest nodes that keep the utilization of the node group at or below
+// scale_up_threshold_percent, assuming each node has the average capacity of the existing nodes
+func calcDemandNodes(nodeCount int, percent float64, opts NodeGroupOptions) int {
+	if opts.ScaleUpThresholdPercent <= 0 {
+		return nodeCount
+	}
+	return int(math.Ceil(float64(nodeCount) * percent / float64(opts.ScaleUpThresholdPercent)))
+}
+
+// updateMinNodesWaste tracks how long the demand of the node group has needed fewer nodes than min_nodes
+// once it has for longer than min_nodes_waste_grace_period the node group is wasteful. A warning is logged with the
+// estimated idle nodes, a kubernetes event is recorded and the wasteful metric is set to the idle nodes. The node group
+// is no longer wasteful after the first scan whose demand needs at least min_nodes
+func (c *Controller) updateMinNodesWaste(nodegroup string, nodeGroup *NodeGroupState, demandNodes int) {
+	idleNodes := nodeGroup.Opts.MinNodes - demandNodes
+	if idleNodes <= 0 {
+		if nodeGroup.minNodesWasteful {
+			log.WithField("nodegroup", nodegroup).Info("Node group demand needs min_nodes again")
+		}
+		nodeGroup.minNodesWastefulSince = time.Time{}
+		nodeGroup.minNodesWasteful = false
+		metrics.NodeGroupMinNodesWasteful.WithLabelValues(nodegroup).Set(0)
+		return
+	}
+
+	now := c.clock().Now()
+	if nodeGroup.minNodesWastefulSince.IsZero() {
+		nodeGroup.minNodesWastefulSince = now
+	}
+	if now.Sub(nodeGroup.minNodesWastefulSince) < nodeGroup.Opts.MinNodesWasteGracePeriodDuration() {
+		return
+	}
+
+	metrics.NodeGroupMinNodesWasteful.WithLabelValues(nodegroup).Set(float64(idleNodes))
+	if nodeGroup.minNodesWasteful {
+		return
+	}
+	nodeGroup.minNodesWasteful = true
+	message := fmt.Sprintf(
+		"Node group %v has needed only %v nodes for %v but min_nodes of %v keeps an estimated %v idle nodes. Consider lowering min_nodes",
+		nodegroup,
+		demandNodes,
+		now.Sub(nodeGroup.minNodesWastefulSince),
+		nodeGroup.Opts.MinNodes,
+		idleNodes,
+	)
+	log.WithField("nodegroup", nodegroup).WithField("idle_nodes", idleNodes).Warning(message)
+	if c.Opts.EventRecorder != nil && c.Opts.EventObject != nil {
+		c.Opts.EventRecorder.Event(c.Opts.EventObject, v1.EventTypeWarning, EventReasonNodeGroupMinNodesWasteful, message)
+	}
+}
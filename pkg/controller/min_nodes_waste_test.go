@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	duration "time"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestCalcDemandNodes(t *testing.T) {
+	opts := NodeGroupOptions{ScaleUpThresholdPercent: 70}
+	assert.Equal(t, 0, calcDemandNodes(4, 0, opts))
+	assert.Equal(t, 1, calcDemandNodes(4, 10, opts))
+	assert.Equal(t, 2, calcDemandNodes(4, 35, opts))
+	assert.Equal(t, 4, calcDemandNodes(4, 70, opts))
+	assert.Equal(t, 5, calcDemandNodes(4, 80, opts))
+}
+
+func TestControllerMinNodesWaste(t *testing.T) {
+	mockClock := newManualClock(duration.Now())
+
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           3,
+		MaxNodes:                           5,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		SlowNodeRemovalRate:                1,
+		FastNodeRemovalRate:                1,
+		ScaleUpCoolDownPeriod:              "1m",
+		SoftDeleteGracePeriod:              "1m",
+		HardDeleteGracePeriod:              "10m",
+		MinNodesWasteGracePeriod:           "30m",
+	}}
+	// 200m of the 3000m cpu only needs a single node
+	nodes := buildTestNodes(3, 1000, 1000)
+	pods := buildTestPods(2, 100, 100)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+	opts.Clock = mockClock
+
+	recorder := record.NewFakeRecorder(10)
+	opts.EventRecorder = recorder
+	opts.EventObject = &v1.ObjectReference{Kind: "Pod", Namespace: "kube-system", Name: "escalator"}
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testCloudProvider.RegisterNodeGroup(test.NewNodeGroup("default", 3, 5, int64(len(nodes))))
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	nodeGroup := nodeGroupsState["default"]
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// the node group isn't wasteful until the grace period has passed
+	_, err := controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.False(t, nodeGroup.minNodesWasteful)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.NodeGroupMinNodesWasteful.WithLabelValues("default")))
+	assert.Len(t, recorder.Events, 0)
+
+	mockClock.Add(31 * duration.Minute)
+	_, err = controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.True(t, nodeGroup.minNodesWasteful)
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.NodeGroupMinNodesWasteful.WithLabelValues("default")))
+	require.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	assert.True(t, strings.HasPrefix(event, "Warning "+EventReasonNodeGroupMinNodesWasteful+" "), event)
+
+	// the event is only recorded once whilst the node group stays wasteful
+	mockClock.Add(duration.Minute)
+	_, err = controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.True(t, nodeGroup.minNodesWasteful)
+	assert.Len(t, recorder.Events, 0)
+
+	// a scan whose demand needs min_nodes clears it
+	controller.updateMinNodesWaste("default", nodeGroup, 3)
+	assert.False(t, nodeGroup.minNodesWasteful)
+	assert.True(t, nodeGroup.minNodesWastefulSince.IsZero())
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.NodeGroupMinNodesWasteful.WithLabelValues("default")))
+}
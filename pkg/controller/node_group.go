@@ -1,19 +1,89 @@
 package controller
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/atlassian/escalator/pkg/k8s"
+	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	v1lister "k8s.io/client-go/listers/core/v1"
+	sigsyaml "sigs.k8s.io/yaml"
 )
 
 // DefaultNodeGroup is used for any pods that don't have a node selector defined
 const DefaultNodeGroup = "default"
 
+// DefaultSaturationGracePeriod is how long scale ups are blocked by max_nodes before the node group is saturated
+// when saturation_grace_period is not set
+const DefaultSaturationGracePeriod = 5 * time.Minute
+
+// DefaultFlapDetectionThreshold is the number of changes between scaling up and scaling down within the
+// flap_detection_window at which a node group is flapping when flap_detection_threshold is not set
+const DefaultFlapDetectionThreshold = 4
+
+// DefaultMinNodesWasteGracePeriod is how long the demand must need fewer nodes than min_nodes before the node group is
+// reported as wasteful when min_nodes_waste_grace_period is not set
+const DefaultMinNodesWasteGracePeriod = time.Hour
+
+// DefaultPreTerminationWebhookTimeout is how long to wait for the pre_termination_webhook to respond
+// when pre_termination_webhook_timeout is not set
+const DefaultPreTerminationWebhookTimeout = 10 * time.Second
+
+// DefaultMaxScaleDownFraction is the largest fraction of a node group's Ready nodes tainted in a single scan
+// when max_scale_down_fraction is not set
+const DefaultMaxScaleDownFraction = 0.5
+
+// DefaultProtectReplicaSpreadMinReplicas is the fewest replicas of a workload protect_replica_spread leaves in the
+// node group when protect_replica_spread_min_replicas is not set
+const DefaultProtectReplicaSpreadMinReplicas = 1
+
+// utilizationWeightTolerance is how far cpu_weight and memory_weight may add up to from 1, as decimal weights such as
+// 0.7 and 0.3 can't be represented exactly
+const utilizationWeightTolerance = 1e-9
+
+const (
+	// UtilizationMethodAggregate calculates utilization as the sum of requests over the sum of allocatable capacity
+	UtilizationMethodAggregate = "aggregate"
+	// UtilizationMethodBinPack calculates utilization from how densely the pods pack onto the nodes
+	UtilizationMethodBinPack = "binpack"
+)
+
+const (
+	// NodeSelectionMethodOldest taints the oldest nodes first when scaling down
+	NodeSelectionMethodOldest = "oldest"
+	// NodeSelectionMethodStable taints the nodes with the lowest hash of their name first when scaling down, so the
+	// same nodes are chosen every scan whilst the nodes in the node group don't change
+	NodeSelectionMethodStable = "stable"
+)
+
+const (
+	// NodeGroupModeObserve only logs the actions that would be taken, the same as dry_mode
+	NodeGroupModeObserve = "observe"
+	// NodeGroupModeTaintOnly scales up and taints nodes when scaling down, but never deletes the tainted nodes
+	NodeGroupModeTaintOnly = "taint_only"
+	// NodeGroupModeActive scales up, taints and deletes nodes
+	NodeGroupModeActive = "active"
+)
+
+const (
+	// ScaleUpPodPhasePending counts unscheduled pods in the Pending phase towards the utilization
+	ScaleUpPodPhasePending = "Pending"
+	// ScaleUpPodPhaseUnschedulable counts unscheduled pods the scheduler has marked unschedulable towards the utilization
+	ScaleUpPodPhaseUnschedulable = "Unschedulable"
+)
+
+// DefaultScaleUpPodPhases are the phases of the unscheduled pods that demand capacity when scale_up_pod_phases is not set
+var DefaultScaleUpPodPhases = []string{ScaleUpPodPhasePending, ScaleUpPodPhaseUnschedulable}
+
 // NodeGroupOptions represents a nodegroup running on our cluster
 // We differentiate nodegroups by their node label
 type NodeGroupOptions struct {
@@ -21,42 +91,480 @@ type NodeGroupOptions struct {
 	LabelKey               string `json:"label_key,omitempty" yaml:"label_key,omitempty"`
 	LabelValue             string `json:"label_value,omitempty" yaml:"label_value,omitempty"`
 	CloudProviderGroupName string `json:"cloud_provider_group_name,omitempty" yaml:"cloud_provider_group_name,omitempty"`
+	// CloudProviderGroupNames is set when cloud_provider_group_name is a list of cloud provider node groups
+	// that are treated as a single logical pool. CloudProviderGroupName is then the comma separated list of names
+	CloudProviderGroupNames []string `json:"cloud_provider_group_names,omitempty" yaml:"cloud_provider_group_names,omitempty"`
+
+	// AutoDiscoveryTags makes the node group a template for every cloud provider node group with all of the tags
+	// A tag with an empty value matches any value. Optional, cloud_provider_group_name and label_value must be empty
+	AutoDiscoveryTags map[string]string `json:"auto_discovery_tags,omitempty" yaml:"auto_discovery_tags,omitempty"`
 
 	MinNodes int `json:"min_nodes,omitempty" yaml:"min_nodes,omitempty"`
 	MaxNodes int `json:"max_nodes,omitempty" yaml:"max_nodes,omitempty"`
 
 	DryMode bool `json:"dry_mode,omitempty" yaml:"dry_mode,omitempty"`
 
+	// Mode is how much of the scaling the node group acts on, for rolling escalator out to a node group in stages
+	// Optional, one of observe, taint_only or active. Defaults to observe if dry_mode is set, otherwise active
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+
+	// Frozen stops all scale actions of the node group until it is unfrozen, whilst it is still scanned and its
+	// metrics published. Optional
+	Frozen bool `json:"frozen,omitempty" yaml:"frozen,omitempty"`
+
+	// LogLevel overrides the global log level for the logs of the node group, e.g. debug to debug a single node group
+	// Optional, one of debug, info, warning, error, fatal or panic
+	LogLevel string `json:"log_level,omitempty" yaml:"log_level,omitempty"`
+
 	TaintUpperCapacityThresholdPercent int `json:"taint_upper_capacity_threshold_percent,omitempty" yaml:"taint_upper_capacity_threshold_percent,omitempty"`
 	TaintLowerCapacityThresholdPercent int `json:"taint_lower_capacity_threshold_percent,omitempty" yaml:"taint_lower_capacity_threshold_percent,omitempty"`
 
 	ScaleUpThresholdPercent int `json:"scale_up_threshold_percent,omitempty" yaml:"scale_up_threshold_percent,omitempty"`
 
+	// ScaleUpMinCPU and ScaleUpMinMemory are the least cpu and memory each scale up adds, translated into nodes using
+	// the capacity of the existing nodes. The values are Kubernetes resource quantities. Optional
+	ScaleUpMinCPU    string `json:"scale_up_min_cpu,omitempty" yaml:"scale_up_min_cpu,omitempty"`
+	ScaleUpMinMemory string `json:"scale_up_min_memory,omitempty" yaml:"scale_up_min_memory,omitempty"`
+
+	// ScaleUpRamp is the fraction of the nodes needed that are added in a single scan, ramping a large scale up over
+	// several scans. Not applied to emergency scale ups. Optional, between 0 and 1. Disabled if 0
+	ScaleUpRamp float64 `json:"scale_up_ramp,omitempty" yaml:"scale_up_ramp,omitempty"`
+
+	// ScaleUpSoftCapPercent is the percentage of max_nodes above which each scale up is reduced in proportion to the
+	// room left before max_nodes. Not applied to emergency scale ups. Optional, between 0 and 100. Disabled if 0
+	ScaleUpSoftCapPercent float64 `json:"scale_up_soft_cap_percent,omitempty" yaml:"scale_up_soft_cap_percent,omitempty"`
+
+	// NodeResourceReservation is subtracted from the allocatable resources of each node when calculating utilization
+	NodeResourceReservation NodeResourceReservation `json:"node_resource_reservation,omitempty" yaml:"node_resource_reservation,omitempty"`
+	// DefaultPodRequest is the cpu and memory counted towards utilization for pods that don't request the resource
+	// Optional, pods without requests count as 0
+	DefaultPodRequest NodeResourceReservation `json:"default_pod_request,omitempty" yaml:"default_pod_request,omitempty"`
+
+	// CPUOvercommitRatio and MemoryOvercommitRatio multiply the allocatable cpu and memory of the nodes when calculating
+	// utilization, e.g. above 1 packs more requests onto the nodes before scaling up. Optional, defaults to 1
+	CPUOvercommitRatio    float64 `json:"cpu_overcommit_ratio,omitempty" yaml:"cpu_overcommit_ratio,omitempty"`
+	MemoryOvercommitRatio float64 `json:"memory_overcommit_ratio,omitempty" yaml:"memory_overcommit_ratio,omitempty"`
+
+	// ExcludeExternallyTaintedNodes leaves nodes with a NoSchedule or NoExecute taint not applied by escalator, and not
+	// tolerated by any pending pods, out of the capacity the utilization is calculated from. Optional
+	ExcludeExternallyTaintedNodes bool `json:"exclude_externally_tainted_nodes,omitempty" yaml:"exclude_externally_tainted_nodes,omitempty"`
+
+	// ExternalDeletionTaints are the keys of the taints another autoscaler or tool marks the nodes it is deleting with,
+	// such as ToBeDeletedByClusterAutoscaler. Nodes with any of them are left to the other tool, they aren't usable
+	// capacity and escalator never taints, untaints, drains or deletes them. Optional
+	ExternalDeletionTaints []string `json:"external_deletion_taints,omitempty" yaml:"external_deletion_taints,omitempty"`
+
+	// ReactToMemoryPressure leaves nodes with the MemoryPressure condition out of the capacity the utilization is
+	// calculated from, whilst still counting the requests of their pods. Optional
+	ReactToMemoryPressure bool `json:"react_to_memory_pressure,omitempty" yaml:"react_to_memory_pressure,omitempty"`
+
+	// RespectExternalCordon leaves cordoned nodes out of the capacity the utilization is calculated from
+	// Optional, defaults to true
+	RespectExternalCordon *bool `json:"respect_external_cordon,omitempty" yaml:"respect_external_cordon,omitempty"`
+
+	// ScaleUpPodPhases are the phases or conditions an unscheduled pod must be in to count towards the utilization
+	// Optional, defaults to DefaultScaleUpPodPhases
+	ScaleUpPodPhases []string `json:"scale_up_pod_phases,omitempty" yaml:"scale_up_pod_phases,omitempty"`
+
+	// IgnorePendingPodsThatFit stops unscheduled pods that fit in the free capacity of one of the existing nodes from
+	// triggering a scale up, as they're pending for something other than capacity. Their requests are still counted in
+	// the utilization. Optional, disabled by default
+	IgnorePendingPodsThatFit bool `json:"ignore_pending_pods_that_fit,omitempty" yaml:"ignore_pending_pods_that_fit,omitempty"`
+
+	// AnnotateScaleUpTrigger annotates the nodes added by a scale up with the reason for the scale up and the pending
+	// pods that triggered it. Optional, disabled by default
+	AnnotateScaleUpTrigger bool `json:"annotate_scale_up_trigger,omitempty" yaml:"annotate_scale_up_trigger,omitempty"`
+
+	// UtilizationMethod is how the cpu and memory utilization is calculated. Optional, defaults to aggregate
+	UtilizationMethod string `json:"utilization_method,omitempty" yaml:"utilization_method,omitempty"`
+
+	// UtilizationSmoothingFactor is the weight given to the latest utilization when smoothing it across scans
+	// Optional, between 0 and 1. Smoothing is disabled if 0
+	UtilizationSmoothingFactor float64 `json:"utilization_smoothing_factor,omitempty" yaml:"utilization_smoothing_factor,omitempty"`
+
+	// DiscountCrashLoopingPodsAfter leaves the requests of pods that have had a container in CrashLoopBackOff for
+	// longer than the duration out of the utilization, as they hold capacity without doing any work. Optional,
+	// disabled if empty
+	DiscountCrashLoopingPodsAfter string `json:"discount_crash_looping_pods_after,omitempty" yaml:"discount_crash_looping_pods_after,omitempty"`
+
+	// CPUWeight and MemoryWeight blend the cpu and memory utilization into the utilization the node group scales on
+	// Optional, both must add up to 1 if either is set. The higher of the two is used if neither is set
+	CPUWeight    float64 `json:"cpu_weight,omitempty" yaml:"cpu_weight,omitempty"`
+	MemoryWeight float64 `json:"memory_weight,omitempty" yaml:"memory_weight,omitempty"`
+
+	// SQSQueueURL scales the node group on the length of the SQS queue as well as utilization, keeping
+	// SQSTargetMessagesPerNode messages per node. Optional, only supported by the aws cloud provider
+	SQSQueueURL              string `json:"sqs_queue_url,omitempty" yaml:"sqs_queue_url,omitempty"`
+	SQSTargetMessagesPerNode int    `json:"sqs_target_messages_per_node,omitempty" yaml:"sqs_target_messages_per_node,omitempty"`
+
+	// CronJobPreWarm are CronJobs, as namespace/name, the node group is pre-warmed ahead of. For
+	// cron_job_pre_warm_lead_time before any of them is next scheduled the node group scales up to at least
+	// cron_job_pre_warm_nodes untainted nodes, on top of scaling on utilization. Optional
+	CronJobPreWarm         []string `json:"cron_job_pre_warm,omitempty" yaml:"cron_job_pre_warm,omitempty"`
+	CronJobPreWarmLeadTime string   `json:"cron_job_pre_warm_lead_time,omitempty" yaml:"cron_job_pre_warm_lead_time,omitempty"`
+	CronJobPreWarmNodes    int      `json:"cron_job_pre_warm_nodes,omitempty" yaml:"cron_job_pre_warm_nodes,omitempty"`
+
+	// AWSRegion and AWSEndpoint override the region and endpoint of the clients of the node group's asgs, e.g. for a
+	// node group in another region. Optional, only supported by the aws cloud provider
+	AWSRegion   string `json:"aws_region,omitempty" yaml:"aws_region,omitempty"`
+	AWSEndpoint string `json:"aws_endpoint,omitempty" yaml:"aws_endpoint,omitempty"`
+
 	SlowNodeRemovalRate int `json:"slow_node_removal_rate,omitempty" yaml:"slow_node_removal_rate,omitempty"`
 	FastNodeRemovalRate int `json:"fast_node_removal_rate,omitempty" yaml:"fast_node_removal_rate,omitempty"`
 
+	// MaxScaleDownFraction is the largest fraction of the Ready nodes that can be tainted in a single scan
+	// Optional, between 0 and 1. Defaults to DefaultMaxScaleDownFraction
+	MaxScaleDownFraction float64 `json:"max_scale_down_fraction,omitempty" yaml:"max_scale_down_fraction,omitempty"`
+
 	SoftDeleteGracePeriod string `json:"soft_delete_grace_period,omitempty" yaml:"soft_delete_grace_period,omitempty"`
 	HardDeleteGracePeriod string `json:"hard_delete_grace_period,omitempty" yaml:"soft_delete_grace_period,omitempty"`
 
 	ScaleUpCoolDownPeriod string `json:"scale_up_cool_down_period,omitempty" yaml:"scale_up_cool_down_period,omitempty"`
 
+	// EmergencyPendingTimeout is how long a pod can be pending before the node group scales up for it straight away,
+	// bypassing the scale up cool down and scale_up_confirmation_delay. Optional, disabled if empty
+	EmergencyPendingTimeout string `json:"emergency_pending_timeout,omitempty" yaml:"emergency_pending_timeout,omitempty"`
+
+	// EmergencyScaleUpCoolDownPeriod is how long after an emergency scale up before the next emergency scale up can
+	// happen. Normal scale ups are unaffected. Optional, emergency scale ups can happen every scan if empty
+	EmergencyScaleUpCoolDownPeriod string `json:"emergency_scale_up_cool_down_period,omitempty" yaml:"emergency_scale_up_cool_down_period,omitempty"`
+
+	// SaturationGracePeriod is how long scale ups must be blocked by max_nodes before the node group is reported as
+	// saturated. Optional, defaults to DefaultSaturationGracePeriod
+	SaturationGracePeriod string `json:"saturation_grace_period,omitempty" yaml:"saturation_grace_period,omitempty"`
+
+	// MinNodesWasteGracePeriod is how long the demand must need fewer nodes than min_nodes before the node group is
+	// reported as keeping idle nodes. Optional, defaults to DefaultMinNodesWasteGracePeriod
+	MinNodesWasteGracePeriod string `json:"min_nodes_waste_grace_period,omitempty" yaml:"min_nodes_waste_grace_period,omitempty"`
+
+	// ScaleUpConfirmationDelay is how long a pod must be pending before it counts towards the utilization
+	// Optional, pending pods count straight away if empty
+	ScaleUpConfirmationDelay string `json:"scale_up_confirmation_delay,omitempty" yaml:"scale_up_confirmation_delay,omitempty"`
+
+	// ScaleDownDelayAfterAdd is how long scale down is suppressed for after a scale up. Optional, disabled if empty
+	ScaleDownDelayAfterAdd string `json:"scale_down_delay_after_add,omitempty" yaml:"scale_down_delay_after_add,omitempty"`
+
+	// FlapDetectionWindow is how far back the scale ups and scale downs are looked at to detect the node group flapping
+	// between them. Optional, disabled if empty
+	FlapDetectionWindow string `json:"flap_detection_window,omitempty" yaml:"flap_detection_window,omitempty"`
+	// FlapDetectionThreshold is the number of changes between scaling up and scaling down within the
+	// flap_detection_window at which the node group is flapping. Optional, defaults to DefaultFlapDetectionThreshold
+	FlapDetectionThreshold int `json:"flap_detection_threshold,omitempty" yaml:"flap_detection_threshold,omitempty"`
+
+	// NodeSelectionMethod is how the nodes to taint are chosen when scaling down. Optional, defaults to oldest
+	NodeSelectionMethod string `json:"node_selection_method,omitempty" yaml:"node_selection_method,omitempty"`
+	// ScaleDownOrderByPodReadiness taints the nodes running the fewest Ready pods first when scaling down, ahead of the
+	// node selection method. Optional
+	ScaleDownOrderByPodReadiness bool `json:"scale_down_order_by_pod_readiness,omitempty" yaml:"scale_down_order_by_pod_readiness,omitempty"`
+	// ProtectLocalStorage never taints nodes hosting pods with local storage when scaling down, unless the node has the
+	// k8s.ForceScaleDownAnnotation. Optional
+	ProtectLocalStorage bool `json:"protect_local_storage,omitempty" yaml:"protect_local_storage,omitempty"`
+	// DeferScaleDownDuringRollout never taints nodes hosting pods of a Deployment or StatefulSet part way through a
+	// rollout when scaling down, until the rollout has finished. Optional
+	DeferScaleDownDuringRollout bool `json:"defer_scale_down_during_rollout,omitempty" yaml:"defer_scale_down_during_rollout,omitempty"`
+	// ProtectReplicaSpread never taints nodes when scaling down if it would leave a ReplicaSet or StatefulSet with fewer
+	// than protect_replica_spread_min_replicas replicas in the node group, or without replicas in a zone it has
+	// replicas in, unless the node has the k8s.ForceScaleDownAnnotation. Best effort. Optional
+	ProtectReplicaSpread bool `json:"protect_replica_spread,omitempty" yaml:"protect_replica_spread,omitempty"`
+	// ProtectReplicaSpreadMinReplicas is the fewest replicas of a workload protect_replica_spread leaves in the node
+	// group. Optional, defaults to DefaultProtectReplicaSpreadMinReplicas
+	ProtectReplicaSpreadMinReplicas int `json:"protect_replica_spread_min_replicas,omitempty" yaml:"protect_replica_spread_min_replicas,omitempty"`
+
+	// MinReadyNodesForScaleDown suppresses scale down until at least this many nodes in the node group are Ready
+	// Optional, scale down is never suppressed if 0
+	MinReadyNodesForScaleDown int `json:"min_ready_nodes_for_scale_down,omitempty" yaml:"min_ready_nodes_for_scale_down,omitempty"`
+
+	// ScaleDownNodeDeleteInterval spaces out deleting the nodes removed in a scan into batches. Optional, all nodes
+	// are deleted at once if empty. ScaleDownNodeDeleteBatchSize is the number of nodes in each batch, defaults to 1
+	ScaleDownNodeDeleteInterval  string `json:"scale_down_node_delete_interval,omitempty" yaml:"scale_down_node_delete_interval,omitempty"`
+	ScaleDownNodeDeleteBatchSize int    `json:"scale_down_node_delete_batch_size,omitempty" yaml:"scale_down_node_delete_batch_size,omitempty"`
+
+	// DrainTimeout enables evicting the pods from a node before it is terminated, waiting up to the timeout for the
+	// pods' termination grace periods. Optional, nodes are terminated without draining if empty
+	DrainTimeout string `json:"drain_timeout,omitempty" yaml:"drain_timeout,omitempty"`
+	// MaxConcurrentDrains is the maximum number of nodes drained at once, further drains wait for a later scan
+	// Optional, unlimited if 0
+	MaxConcurrentDrains int `json:"max_concurrent_drains,omitempty" yaml:"max_concurrent_drains,omitempty"`
+	// CordonBeforeDrain cordons every node ready to be terminated in a scan before draining any of them, so the evicted
+	// pods aren't scheduled onto the other nodes about to be drained. Optional, requires drain_timeout
+	CordonBeforeDrain bool `json:"cordon_before_drain,omitempty" yaml:"cordon_before_drain,omitempty"`
+	// RequireEmptyBeforeDelete deletes a tainted node as soon as it has no pods other than daemonsets, rather than
+	// after soft_delete_grace_period. Nodes that don't empty are deleted after hard_delete_grace_period. Optional
+	RequireEmptyBeforeDelete bool `json:"require_empty_before_delete,omitempty" yaml:"require_empty_before_delete,omitempty"`
+	// FastDeleteCompletedJobs deletes a tainted node before soft_delete_grace_period if the only pods that ran on it,
+	// other than daemonsets, are jobs that have completed or failed. Optional
+	FastDeleteCompletedJobs bool `json:"fast_delete_completed_jobs,omitempty" yaml:"fast_delete_completed_jobs,omitempty"`
+	// NodeShutdownGracePeriod is how long the kubelet takes to gracefully shut down a node, its shutdownGracePeriod.
+	// Nodes ready to be deleted are cordoned and their pods evicted, then only terminated once it has passed, so the
+	// pods get their shutdown window. Optional, nodes are terminated as soon as they are ready to be deleted if not set
+	NodeShutdownGracePeriod string `json:"node_shutdown_grace_period,omitempty" yaml:"node_shutdown_grace_period,omitempty"`
+	// PreTerminationWebhook is a http or https URL sent the details of each node immediately before it is terminated
+	// The node is only terminated once the webhook responds with a 2xx status. Optional
+	PreTerminationWebhook string `json:"pre_termination_webhook,omitempty" yaml:"pre_termination_webhook,omitempty"`
+	// PreTerminationWebhookTimeout is how long to wait for the webhook to respond. Optional, defaults to
+	// DefaultPreTerminationWebhookTimeout
+	PreTerminationWebhookTimeout string `json:"pre_termination_webhook_timeout,omitempty" yaml:"pre_termination_webhook_timeout,omitempty"`
+	// PreTerminationWebhookFailurePolicy is what to do with the node when the webhook fails or times out
+	// Optional, one of fail or ignore. Defaults to fail
+	PreTerminationWebhookFailurePolicy string `json:"pre_termination_webhook_failure_policy,omitempty" yaml:"pre_termination_webhook_failure_policy,omitempty"`
+
+	// CloudProviderSizeTolerance is the largest fraction of the node group's nodes the cloud provider node group can
+	// report fewer instances than before the scan is skipped as an inconsistent read. Optional, between 0 and 1
+	// The size isn't checked if 0
+	CloudProviderSizeTolerance float64 `json:"cloud_provider_size_tolerance,omitempty" yaml:"cloud_provider_size_tolerance,omitempty"`
+
+	// CleanupOrphanNodes enables deleting nodes from Kubernetes whose cloud provider instance no longer exists
+	CleanupOrphanNodes    bool   `json:"cleanup_orphan_nodes,omitempty" yaml:"cleanup_orphan_nodes,omitempty"`
+	OrphanNodeGracePeriod string `json:"orphan_node_grace_period,omitempty" yaml:"orphan_node_grace_period,omitempty"`
+
+	// LabelMismatchAction is what to do with nodes in the cloud provider node group missing the node group label
+	// Optional, one of ignore, warn or cordon. Defaults to ignore
+	LabelMismatchAction string `json:"label_mismatch_action,omitempty" yaml:"label_mismatch_action,omitempty"`
+
 	// Private variables for storing the parsed duration from the string
-	softDeleteGracePeriodDuration time.Duration
-	hardDeleteGracePeriodDuration time.Duration
-	scaleUpCoolDownPeriodDuration time.Duration
+	softDeleteGracePeriodDuration          time.Duration
+	hardDeleteGracePeriodDuration          time.Duration
+	scaleUpCoolDownPeriodDuration          time.Duration
+	scaleDownDelayAfterAddDuration         time.Duration
+	flapDetectionWindowDuration            time.Duration
+	scaleUpConfirmationDelayDuration       time.Duration
+	saturationGracePeriodDuration          time.Duration
+	emergencyPendingTimeoutDuration        time.Duration
+	emergencyScaleUpCoolDownPeriodDuration time.Duration
+	scaleDownNodeDeleteIntervalDuration    time.Duration
+	drainTimeoutDuration                   time.Duration
+	cronJobPreWarmLeadTimeDuration         time.Duration
+	nodeShutdownGracePeriodDuration        time.Duration
+	preTerminationWebhookTimeoutDuration   time.Duration
+	orphanNodeGracePeriodDuration          time.Duration
+	minNodesWasteGracePeriodDuration       time.Duration
+	discountCrashLoopingPodsAfterDuration  time.Duration
+}
+
+// NodeResourceReservation is an amount of cpu and memory reserved on each node for consumers that aren't pods
+// The values are Kubernetes resource quantities, e.g. 500m or 1Gi. Both are optional
+type NodeResourceReservation struct {
+	CPU    string `json:"cpu,omitempty" yaml:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty" yaml:"memory,omitempty"`
+}
+
+// Quantities parses the reserved memory and cpu, an empty or invalid value is zero
+func (r NodeResourceReservation) Quantities() (resource.Quantity, resource.Quantity) {
+	var memory, cpu resource.Quantity
+	if len(r.Memory) > 0 {
+		if quantity, err := resource.ParseQuantity(r.Memory); err == nil {
+			memory = quantity
+		}
+	}
+	if len(r.CPU) > 0 {
+		if quantity, err := resource.ParseQuantity(r.CPU); err == nil {
+			cpu = quantity
+		}
+	}
+	return memory, cpu
 }
 
 // UnmarshalNodeGroupOptions decodes the yaml or json reader into a struct
 func UnmarshalNodeGroupOptions(reader io.Reader) ([]NodeGroupOptions, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return []NodeGroupOptions{}, err
+	}
+	data, cloudProviderGroupNames, err := flattenCloudProviderGroupNames(data)
+	if err != nil {
+		return []NodeGroupOptions{}, err
+	}
+
 	var wrapper struct {
 		NodeGroups []NodeGroupOptions `json:"node_groups" yaml:"node_groups"`
 	}
-	if err := yaml.NewYAMLOrJSONDecoder(reader, 4096).Decode(&wrapper); err != nil {
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096).Decode(&wrapper); err != nil {
 		return []NodeGroupOptions{}, err
 	}
+	for i, names := range cloudProviderGroupNames {
+		wrapper.NodeGroups[i].CloudProviderGroupNames = names
+	}
+	// options marshalled by escalator, e.g. from /config, have both the comma separated name and the list
+	for i := range wrapper.NodeGroups {
+		if len(wrapper.NodeGroups[i].CloudProviderGroupNames) > 0 && len(wrapper.NodeGroups[i].CloudProviderGroupName) == 0 {
+			wrapper.NodeGroups[i].CloudProviderGroupName = strings.Join(wrapper.NodeGroups[i].CloudProviderGroupNames, ",")
+		}
+	}
 	return wrapper.NodeGroups, nil
 }
 
+// UnmarshalScanInterval decodes the optional scan_interval at the top level of the yaml or json reader. When set it
+// overrides --scaninterval and, unlike the command line options, is picked up by a reload. Returns 0 if it isn't set
+func UnmarshalScanInterval(reader io.Reader) (time.Duration, error) {
+	var wrapper struct {
+		ScanInterval string `json:"scan_interval" yaml:"scan_interval"`
+	}
+	if err := yaml.NewYAMLOrJSONDecoder(reader, 4096).Decode(&wrapper); err != nil {
+		return 0, err
+	}
+	if len(wrapper.ScanInterval) == 0 {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(wrapper.ScanInterval)
+	if err != nil {
+		return 0, fmt.Errorf("scan_interval failed to parse into a time.Duration: %v", err)
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("scan_interval must be greater than 0, got %v", interval)
+	}
+	return interval, nil
+}
+
+// flattenCloudProviderGroupNames rewrites any cloud_provider_group_name lists into a comma separated name
+// so the options can be decoded as before. Returns the list of names by node group index
+// The data is returned unchanged if there are no lists
+func flattenCloudProviderGroupNames(data []byte) ([]byte, map[int][]string, error) {
+	var document map[string]interface{}
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096).Decode(&document); err != nil {
+		return nil, nil, err
+	}
+	nodeGroups, ok := document["node_groups"].([]interface{})
+	if !ok {
+		return data, nil, nil
+	}
+
+	cloudProviderGroupNames := make(map[int][]string)
+	for i, nodeGroup := range nodeGroups {
+		options, ok := nodeGroup.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		list, ok := options["cloud_provider_group_name"].([]interface{})
+		if !ok {
+			continue
+		}
+		names := make([]string, 0, len(list))
+		for _, item := range list {
+			name, ok := item.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("cloud_provider_group_name must be a name or a list of names, got %v", item)
+			}
+			names = append(names, name)
+		}
+		options["cloud_provider_group_name"] = strings.Join(names, ",")
+		cloudProviderGroupNames[i] = names
+	}
+
+	if len(cloudProviderGroupNames) == 0 {
+		return data, nil, nil
+	}
+	flattened, err := sigsyaml.Marshal(document)
+	return flattened, cloudProviderGroupNames, err
+}
+
+// CloudProviderGroupNameList returns the names of all the cloud provider node groups that make up the node group
+// auto discovery node groups return none, their cloud provider node groups are discovered at runtime
+func (n *NodeGroupOptions) CloudProviderGroupNameList() []string {
+	if n.AutoDiscoveryEnabled() {
+		return nil
+	}
+	if len(n.CloudProviderGroupNames) > 0 {
+		return n.CloudProviderGroupNames
+	}
+	return []string{n.CloudProviderGroupName}
+}
+
+// AutoDiscoveryEnabled returns whether the node group is a template for auto discovered node groups
+func (n *NodeGroupOptions) AutoDiscoveryEnabled() bool {
+	return len(n.AutoDiscoveryTags) > 0
+}
+
+// ScaleUpPodPhasesOrDefault returns the scale_up_pod_phases, or DefaultScaleUpPodPhases if not set
+func (n *NodeGroupOptions) ScaleUpPodPhasesOrDefault() []string {
+	if len(n.ScaleUpPodPhases) == 0 {
+		return DefaultScaleUpPodPhases
+	}
+	return n.ScaleUpPodPhases
+}
+
+// RespectExternalCordonEnabled returns whether cordoned nodes are left out of the capacity, true unless disabled
+func (n *NodeGroupOptions) RespectExternalCordonEnabled() bool {
+	return n.RespectExternalCordon == nil || *n.RespectExternalCordon
+}
+
+// withDefaults returns a copy of the options with the default of every option that isn't set filled in
+// the private parsed durations are left to be parsed again
+func (n NodeGroupOptions) withDefaults() NodeGroupOptions {
+	effective := n
+	effective.ScaleUpPodPhases = append([]string(nil), n.ScaleUpPodPhasesOrDefault()...)
+	respectExternalCordon := n.RespectExternalCordonEnabled()
+	effective.RespectExternalCordon = &respectExternalCordon
+	effective.MemoryOvercommitRatio, effective.CPUOvercommitRatio = n.OvercommitRatios()
+	effective.MaxScaleDownFraction = n.MaxScaleDownFractionOrDefault()
+	effective.ScaleDownNodeDeleteBatchSize = n.ScaleDownNodeDeleteBatchSizeOrDefault()
+	if len(n.UtilizationMethod) == 0 {
+		effective.UtilizationMethod = UtilizationMethodAggregate
+	}
+	if len(n.NodeSelectionMethod) == 0 {
+		effective.NodeSelectionMethod = NodeSelectionMethodOldest
+	}
+	if len(n.SaturationGracePeriod) == 0 {
+		effective.SaturationGracePeriod = DefaultSaturationGracePeriod.String()
+	}
+	if len(n.LabelMismatchAction) == 0 {
+		effective.LabelMismatchAction = LabelMismatchActionIgnore
+	}
+	if len(n.FlapDetectionWindow) > 0 {
+		effective.FlapDetectionThreshold = n.FlapDetectionThresholdOrDefault()
+	}
+	if n.ProtectReplicaSpread {
+		effective.ProtectReplicaSpreadMinReplicas = n.ProtectReplicaSpreadMinReplicasOrDefault()
+	}
+	if len(n.PreTerminationWebhook) > 0 {
+		effective.PreTerminationWebhookTimeout = n.PreTerminationWebhookTimeoutDuration().String()
+		effective.PreTerminationWebhookFailurePolicy = n.PreTerminationWebhookFailurePolicyOrDefault()
+	}
+	effective.Mode = n.ModeOrDefault()
+	return effective
+}
+
+// ValidateNodeGroupOverlaps returns a warning for every pair of node groups selecting the same nodes
+// the nodes are only managed by the first of the node groups, so the later node group doesn't manage any nodes
+func ValidateNodeGroupOverlaps(nodeGroups []NodeGroupOptions) []error {
+	var warnings []error
+	for i, nodeGroup := range nodeGroups {
+		if nodeGroup.AutoDiscoveryEnabled() {
+			continue
+		}
+		for _, earlier := range nodeGroups[:i] {
+			if earlier.AutoDiscoveryEnabled() {
+				continue
+			}
+			if earlier.LabelKey == nodeGroup.LabelKey && earlier.LabelValue == nodeGroup.LabelValue {
+				warnings = append(warnings, fmt.Errorf("node groups %v and %v both select the nodes labelled %v=%v. the nodes are managed by %v, the first in the config",
+					earlier.Name, nodeGroup.Name, nodeGroup.LabelKey, nodeGroup.LabelValue, earlier.Name))
+			}
+		}
+	}
+	return warnings
+}
+
+// ValidateCloudProviderGroupNames returns an error for every cloud provider group referenced by more than one node
+// group. The node groups would both scale the same cloud provider group, each undoing the other's accounting
+func ValidateCloudProviderGroupNames(nodeGroups []NodeGroupOptions) []error {
+	var problems []error
+	referencedBy := make(map[string]string)
+	for _, nodeGroup := range nodeGroups {
+		// auto discovery node groups have no cloud provider group names, their node groups are discovered at runtime
+		for _, name := range nodeGroup.CloudProviderGroupNameList() {
+			if earlier, ok := referencedBy[name]; ok {
+				if earlier != nodeGroup.Name {
+					problems = append(problems, fmt.Errorf("cloud provider group %v is referenced by node groups %v and %v. a cloud provider group can only be referenced by one node group",
+						name, earlier, nodeGroup.Name))
+				}
+				continue
+			}
+			referencedBy[name] = nodeGroup.Name
+		}
+	}
+	return problems
+}
+
 // ValidateNodeGroup is a safety check to validate that a nodegroup has valid options
 func ValidateNodeGroup(nodegroup NodeGroupOptions) []error {
 	var problems []error
@@ -69,13 +577,99 @@ func ValidateNodeGroup(nodegroup NodeGroupOptions) []error {
 
 	checkThat(len(nodegroup.Name) > 0, "name cannot be empty")
 	checkThat(len(nodegroup.LabelKey) > 0, "label_key cannot be empty")
-	checkThat(len(nodegroup.LabelValue) > 0, "label_value cannot be empty")
-	checkThat(len(nodegroup.CloudProviderGroupName) > 0, "cloud_provider_group_name cannot be empty")
+	if nodegroup.AutoDiscoveryEnabled() {
+		checkThat(len(nodegroup.LabelValue) == 0, "label_value must be empty when auto_discovery_tags is set")
+		checkThat(len(nodegroup.CloudProviderGroupName) == 0, "cloud_provider_group_name must be empty when auto_discovery_tags is set")
+		for key := range nodegroup.AutoDiscoveryTags {
+			checkThat(len(key) > 0, "auto_discovery_tags cannot contain an empty key")
+		}
+		checkThat(len(nodegroup.AWSRegion) == 0 && len(nodegroup.AWSEndpoint) == 0,
+			"aws_region and aws_endpoint must be empty when auto_discovery_tags is set")
+	} else {
+		checkThat(len(nodegroup.LabelValue) > 0, "label_value cannot be empty")
+		checkThat(len(nodegroup.CloudProviderGroupName) > 0, "cloud_provider_group_name cannot be empty")
+	}
+
+	seenCloudProviderGroupNames := make(map[string]bool, len(nodegroup.CloudProviderGroupNames))
+	for _, name := range nodegroup.CloudProviderGroupNames {
+		checkThat(len(name) > 0, "cloud_provider_group_name cannot contain an empty name")
+		checkThat(!seenCloudProviderGroupNames[name], "cloud_provider_group_name contains duplicate name %v", name)
+		seenCloudProviderGroupNames[name] = true
+	}
 
 	checkThat(nodegroup.TaintUpperCapacityThresholdPercent > 0, "taint_upper_capacity_threshold_percent must be larger than 0")
 	checkThat(nodegroup.TaintLowerCapacityThresholdPercent > 0, "taint_lower_capacity_threshold_percent must be larger than 0")
 	checkThat(nodegroup.ScaleUpThresholdPercent > 0, "scale_up_threshold_percent must be larger than 0")
 
+	reservations := []struct{ option, name, value string }{
+		{"node_resource_reservation", "cpu", nodegroup.NodeResourceReservation.CPU},
+		{"node_resource_reservation", "memory", nodegroup.NodeResourceReservation.Memory},
+		{"default_pod_request", "cpu", nodegroup.DefaultPodRequest.CPU},
+		{"default_pod_request", "memory", nodegroup.DefaultPodRequest.Memory},
+	}
+	for _, reservation := range reservations {
+		if len(reservation.value) == 0 {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(reservation.value)
+		checkThat(err == nil, "%v %v failed to parse into a resource quantity. check your formatting.", reservation.option, reservation.name)
+		checkThat(err != nil || quantity.Sign() >= 0, "%v %v must not be negative", reservation.option, reservation.name)
+	}
+
+	scaleUpMins := []struct{ name, value string }{
+		{"scale_up_min_cpu", nodegroup.ScaleUpMinCPU},
+		{"scale_up_min_memory", nodegroup.ScaleUpMinMemory},
+	}
+	for _, scaleUpMin := range scaleUpMins {
+		if len(scaleUpMin.value) == 0 {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(scaleUpMin.value)
+		checkThat(err == nil, "%v failed to parse into a resource quantity. check your formatting.", scaleUpMin.name)
+		checkThat(err != nil || quantity.Sign() >= 0, "%v must not be negative", scaleUpMin.name)
+	}
+
+	checkThat(nodegroup.CPUOvercommitRatio >= 0, "cpu_overcommit_ratio must not be negative")
+	checkThat(nodegroup.MemoryOvercommitRatio >= 0, "memory_overcommit_ratio must not be negative")
+
+	for _, phase := range nodegroup.ScaleUpPodPhases {
+		checkThat(phase == ScaleUpPodPhasePending || phase == ScaleUpPodPhaseUnschedulable,
+			"scale_up_pod_phases must only contain %v or %v, not %v", ScaleUpPodPhasePending, ScaleUpPodPhaseUnschedulable, phase)
+	}
+
+	for _, key := range nodegroup.ExternalDeletionTaints {
+		checkThat(len(key) > 0, "external_deletion_taints must not contain an empty taint key")
+		checkThat(key != k8s.ToBeRemovedByAutoscalerKey, "external_deletion_taints must not contain %v, the taint escalator applies itself", k8s.ToBeRemovedByAutoscalerKey)
+	}
+
+	checkThat(nodegroup.UtilizationMethod == "" ||
+		nodegroup.UtilizationMethod == UtilizationMethodAggregate ||
+		nodegroup.UtilizationMethod == UtilizationMethodBinPack,
+		"utilization_method must be one of %v or %v", UtilizationMethodAggregate, UtilizationMethodBinPack)
+	checkThat(nodegroup.UtilizationSmoothingFactor >= 0 && nodegroup.UtilizationSmoothingFactor <= 1,
+		"utilization_smoothing_factor must be between 0 and 1")
+	checkThat(nodegroup.CPUWeight >= 0 && nodegroup.MemoryWeight >= 0, "cpu_weight and memory_weight must not be negative")
+	checkThat(!nodegroup.UtilizationWeighted() || math.Abs(nodegroup.CPUWeight+nodegroup.MemoryWeight-1) < utilizationWeightTolerance,
+		"cpu_weight and memory_weight must add up to 1 when either is set")
+
+	if nodegroup.QueueScalingEnabled() {
+		checkThat(nodegroup.SQSTargetMessagesPerNode > 0, "sqs_target_messages_per_node must be larger than 0 when sqs_queue_url is set")
+	} else {
+		checkThat(nodegroup.SQSTargetMessagesPerNode == 0, "sqs_target_messages_per_node must not be set without sqs_queue_url")
+	}
+
+	if nodegroup.CronJobPreWarmEnabled() {
+		for _, cronJob := range nodegroup.CronJobPreWarm {
+			namespace, name := splitCronJobPreWarm(cronJob)
+			checkThat(len(namespace) > 0 && len(name) > 0, "cron_job_pre_warm must be a list of namespace/name, %q isn't", cronJob)
+		}
+		checkThat(nodegroup.CronJobPreWarmLeadTimeDuration() > 0, "cron_job_pre_warm_lead_time must be set to a positive time.Duration when cron_job_pre_warm is set")
+		checkThat(nodegroup.CronJobPreWarmNodes > 0, "cron_job_pre_warm_nodes must be larger than 0 when cron_job_pre_warm is set")
+	} else {
+		checkThat(len(nodegroup.CronJobPreWarmLeadTime) == 0 && nodegroup.CronJobPreWarmNodes == 0,
+			"cron_job_pre_warm_lead_time and cron_job_pre_warm_nodes must not be set without cron_job_pre_warm")
+	}
+
 	checkThat(nodegroup.TaintLowerCapacityThresholdPercent < nodegroup.TaintUpperCapacityThresholdPercent,
 		"taint_lower_capacity_threshold_percent must be less than taint_upper_capacity_threshold_percent")
 	checkThat(nodegroup.TaintUpperCapacityThresholdPercent < nodegroup.ScaleUpThresholdPercent,
@@ -86,6 +680,8 @@ func ValidateNodeGroup(nodegroup NodeGroupOptions) []error {
 		checkThat(nodegroup.MinNodes < nodegroup.MaxNodes, "min_nodes must be less than max_nodes")
 		checkThat(nodegroup.MaxNodes > 0, "max_nodes must be larger than 0")
 		checkThat(nodegroup.MinNodes > 0, "min_nodes must be larger than 0")
+		checkThat(nodegroup.MinReadyNodesForScaleDown <= nodegroup.MaxNodes,
+			"min_ready_nodes_for_scale_down must not be larger than max_nodes, otherwise the node group never scales down")
 	}
 
 	checkThat(nodegroup.SlowNodeRemovalRate <= nodegroup.FastNodeRemovalRate, "slow_node_removal_rate must be less than fast_node_removal_rate")
@@ -98,7 +694,111 @@ func ValidateNodeGroup(nodegroup NodeGroupOptions) []error {
 	checkThat(nodegroup.SoftDeleteGracePeriodDuration() < nodegroup.HardDeleteGracePeriodDuration(), "soft_delete_grace_period must be less than hard_delete_grace_period")
 
 	checkThat(len(nodegroup.ScaleUpCoolDownPeriod) > 0, "scale_up_cool_down_period must not be empty")
-	checkThat(nodegroup.ScaleUpCoolDownPeriodDuration() > 0, "soft_delete_grace_period failed to parse into a time.Duration. check your formatting.")
+	checkThat(nodegroup.ScaleUpCoolDownPeriodDuration() > 0, "scale_up_cool_down_period failed to parse into a time.Duration. check your formatting.")
+
+	if len(nodegroup.EmergencyPendingTimeout) > 0 {
+		checkThat(nodegroup.EmergencyPendingTimeoutDuration() > 0, "emergency_pending_timeout failed to parse into a time.Duration. check your formatting.")
+	}
+	if len(nodegroup.SaturationGracePeriod) > 0 {
+		checkThat(nodegroup.SaturationGracePeriodDuration() > 0, "saturation_grace_period failed to parse into a time.Duration. check your formatting.")
+	}
+	if len(nodegroup.MinNodesWasteGracePeriod) > 0 {
+		checkThat(nodegroup.MinNodesWasteGracePeriodDuration() > 0, "min_nodes_waste_grace_period failed to parse into a time.Duration. check your formatting.")
+	}
+	if len(nodegroup.ScaleUpConfirmationDelay) > 0 {
+		checkThat(nodegroup.ScaleUpConfirmationDelayDuration() > 0, "scale_up_confirmation_delay failed to parse into a time.Duration. check your formatting.")
+	}
+	if nodegroup.EmergencyPendingTimeoutDuration() > 0 && nodegroup.ScaleUpConfirmationDelayDuration() > 0 {
+		checkThat(nodegroup.ScaleUpConfirmationDelayDuration() < nodegroup.EmergencyPendingTimeoutDuration(),
+			"scale_up_confirmation_delay must be less than emergency_pending_timeout")
+	}
+	if len(nodegroup.EmergencyScaleUpCoolDownPeriod) > 0 {
+		checkThat(nodegroup.EmergencyScaleUpCoolDownPeriodDuration() > 0, "emergency_scale_up_cool_down_period failed to parse into a time.Duration. check your formatting.")
+		checkThat(len(nodegroup.EmergencyPendingTimeout) > 0, "emergency_scale_up_cool_down_period must not be set without emergency_pending_timeout")
+	}
+	if len(nodegroup.FlapDetectionWindow) > 0 {
+		checkThat(nodegroup.FlapDetectionWindowDuration() > 0, "flap_detection_window failed to parse into a time.Duration. check your formatting.")
+	}
+	checkThat(nodegroup.FlapDetectionThreshold >= 0, "flap_detection_threshold must not be negative")
+	checkThat(nodegroup.FlapDetectionThreshold == 0 || len(nodegroup.FlapDetectionWindow) > 0, "flap_detection_threshold must not be set without flap_detection_window")
+	if len(nodegroup.ScaleDownDelayAfterAdd) > 0 {
+		checkThat(nodegroup.ScaleDownDelayAfterAddDuration() > 0, "scale_down_delay_after_add failed to parse into a time.Duration. check your formatting.")
+	}
+
+	if len(nodegroup.DiscountCrashLoopingPodsAfter) > 0 {
+		checkThat(nodegroup.DiscountCrashLoopingPodsAfterDuration() > 0, "discount_crash_looping_pods_after failed to parse into a time.Duration. check your formatting.")
+	}
+
+	if len(nodegroup.ScaleDownNodeDeleteInterval) > 0 {
+		checkThat(nodegroup.ScaleDownNodeDeleteIntervalDuration() > 0, "scale_down_node_delete_interval failed to parse into a time.Duration. check your formatting.")
+	}
+	checkThat(nodegroup.ScaleDownNodeDeleteBatchSize >= 0, "scale_down_node_delete_batch_size must not be negative")
+	checkThat(nodegroup.MinReadyNodesForScaleDown >= 0, "min_ready_nodes_for_scale_down must not be negative")
+	checkThat(nodegroup.ProtectReplicaSpreadMinReplicas >= 0, "protect_replica_spread_min_replicas must not be negative")
+	checkThat(nodegroup.ProtectReplicaSpreadMinReplicas == 0 || nodegroup.ProtectReplicaSpread,
+		"protect_replica_spread_min_replicas must not be set without protect_replica_spread")
+	checkThat(nodegroup.MaxScaleDownFraction >= 0 && nodegroup.MaxScaleDownFraction <= 1,
+		"max_scale_down_fraction must be between 0 and 1")
+	checkThat(nodegroup.ScaleUpRamp >= 0 && nodegroup.ScaleUpRamp <= 1, "scale_up_ramp must be between 0 and 1")
+	checkThat(nodegroup.ScaleUpSoftCapPercent >= 0 && nodegroup.ScaleUpSoftCapPercent <= 100, "scale_up_soft_cap_percent must be between 0 and 100")
+	checkThat(nodegroup.CloudProviderSizeTolerance >= 0 && nodegroup.CloudProviderSizeTolerance <= 1,
+		"cloud_provider_size_tolerance must be between 0 and 1")
+
+	checkThat(nodegroup.NodeSelectionMethod == "" ||
+		nodegroup.NodeSelectionMethod == NodeSelectionMethodOldest ||
+		nodegroup.NodeSelectionMethod == NodeSelectionMethodStable,
+		"node_selection_method must be one of %v or %v", NodeSelectionMethodOldest, NodeSelectionMethodStable)
+
+	if len(nodegroup.DrainTimeout) > 0 {
+		checkThat(nodegroup.DrainTimeoutDuration() > 0, "drain_timeout failed to parse into a time.Duration. check your formatting.")
+	}
+	checkThat(nodegroup.MaxConcurrentDrains >= 0, "max_concurrent_drains must not be negative")
+	checkThat(nodegroup.MaxConcurrentDrains == 0 || nodegroup.DrainTimeoutDuration() > 0,
+		"max_concurrent_drains must not be set without drain_timeout")
+	checkThat(!nodegroup.CordonBeforeDrain || nodegroup.DrainTimeoutDuration() > 0,
+		"cordon_before_drain must not be enabled without drain_timeout")
+	if len(nodegroup.NodeShutdownGracePeriod) > 0 {
+		checkThat(nodegroup.NodeShutdownGracePeriodDuration() > 0, "node_shutdown_grace_period failed to parse into a time.Duration. check your formatting.")
+	}
+
+	if len(nodegroup.PreTerminationWebhook) > 0 {
+		webhook, err := url.Parse(nodegroup.PreTerminationWebhook)
+		checkThat(err == nil && (webhook.Scheme == "http" || webhook.Scheme == "https") && len(webhook.Host) > 0,
+			"pre_termination_webhook must be a http or https URL")
+	}
+	if len(nodegroup.PreTerminationWebhookTimeout) > 0 {
+		duration, err := time.ParseDuration(nodegroup.PreTerminationWebhookTimeout)
+		checkThat(err == nil && duration > 0, "pre_termination_webhook_timeout failed to parse into a positive time.Duration. check your formatting.")
+	}
+	checkThat(nodegroup.PreTerminationWebhookFailurePolicy == "" ||
+		nodegroup.PreTerminationWebhookFailurePolicy == PreTerminationFailurePolicyFail ||
+		nodegroup.PreTerminationWebhookFailurePolicy == PreTerminationFailurePolicyIgnore,
+		"pre_termination_webhook_failure_policy must be one of %v or %v", PreTerminationFailurePolicyFail, PreTerminationFailurePolicyIgnore)
+	checkThat(len(nodegroup.PreTerminationWebhook) > 0 ||
+		(len(nodegroup.PreTerminationWebhookTimeout) == 0 && len(nodegroup.PreTerminationWebhookFailurePolicy) == 0),
+		"pre_termination_webhook_timeout and pre_termination_webhook_failure_policy must not be set without pre_termination_webhook")
+
+	checkThat(nodegroup.Mode == "" ||
+		nodegroup.Mode == NodeGroupModeObserve ||
+		nodegroup.Mode == NodeGroupModeTaintOnly ||
+		nodegroup.Mode == NodeGroupModeActive,
+		"mode must be one of %v, %v or %v", NodeGroupModeObserve, NodeGroupModeTaintOnly, NodeGroupModeActive)
+	checkThat(!nodegroup.DryMode || nodegroup.Mode == "" || nodegroup.Mode == NodeGroupModeObserve,
+		"mode must be empty or %v when dry_mode is enabled", NodeGroupModeObserve)
+	if len(nodegroup.LogLevel) > 0 {
+		_, ok := nodegroup.ParseLogLevel()
+		checkThat(ok, "log_level must be one of debug, info, warning, error, fatal or panic")
+	}
+	checkThat(nodegroup.LabelMismatchAction == "" ||
+		nodegroup.LabelMismatchAction == LabelMismatchActionIgnore ||
+		nodegroup.LabelMismatchAction == LabelMismatchActionWarn ||
+		nodegroup.LabelMismatchAction == LabelMismatchActionCordon,
+		"label_mismatch_action must be one of %v, %v or %v", LabelMismatchActionIgnore, LabelMismatchActionWarn, LabelMismatchActionCordon)
+
+	if nodegroup.CleanupOrphanNodes {
+		checkThat(len(nodegroup.OrphanNodeGracePeriod) > 0, "orphan_node_grace_period must not be empty when cleanup_orphan_nodes is enabled")
+		checkThat(nodegroup.OrphanNodeGracePeriodDuration() > 0, "orphan_node_grace_period failed to parse into a time.Duration. check your formatting.")
+	}
 
 	return problems
 }
@@ -142,6 +842,317 @@ func (n *NodeGroupOptions) ScaleUpCoolDownPeriodDuration() time.Duration {
 	return n.scaleUpCoolDownPeriodDuration
 }
 
+// ScaleDownDelayAfterAddDuration lazily returns/parses the scaleDownDelayAfterAdd string into a duration
+// returns 0 if the option is not set, which disables the delay
+func (n *NodeGroupOptions) ScaleDownDelayAfterAddDuration() time.Duration {
+	if n.scaleDownDelayAfterAddDuration == 0 && len(n.ScaleDownDelayAfterAdd) > 0 {
+		duration, err := time.ParseDuration(n.ScaleDownDelayAfterAdd)
+		if err != nil {
+			return 0
+		}
+		n.scaleDownDelayAfterAddDuration = duration
+	}
+
+	return n.scaleDownDelayAfterAddDuration
+}
+
+// FlapDetectionWindowDuration lazily returns/parses the flapDetectionWindow string into a duration
+// returns 0 if the option is not set, which disables flap detection
+func (n *NodeGroupOptions) FlapDetectionWindowDuration() time.Duration {
+	if n.flapDetectionWindowDuration == 0 && len(n.FlapDetectionWindow) > 0 {
+		duration, err := time.ParseDuration(n.FlapDetectionWindow)
+		if err != nil {
+			return 0
+		}
+		n.flapDetectionWindowDuration = duration
+	}
+
+	return n.flapDetectionWindowDuration
+}
+
+// FlapDetectionThresholdOrDefault returns the flap_detection_threshold, or DefaultFlapDetectionThreshold if not set
+func (n *NodeGroupOptions) FlapDetectionThresholdOrDefault() int {
+	if n.FlapDetectionThreshold <= 0 {
+		return DefaultFlapDetectionThreshold
+	}
+	return n.FlapDetectionThreshold
+}
+
+// ProtectReplicaSpreadMinReplicasOrDefault returns the protect_replica_spread_min_replicas, or
+// DefaultProtectReplicaSpreadMinReplicas if not set
+func (n *NodeGroupOptions) ProtectReplicaSpreadMinReplicasOrDefault() int {
+	if n.ProtectReplicaSpreadMinReplicas <= 0 {
+		return DefaultProtectReplicaSpreadMinReplicas
+	}
+	return n.ProtectReplicaSpreadMinReplicas
+}
+
+// EmergencyPendingTimeoutDuration lazily returns/parses the emergencyPendingTimeout string into a duration
+// returns 0 if the option is not set, which disables emergency scale ups
+func (n *NodeGroupOptions) EmergencyPendingTimeoutDuration() time.Duration {
+	if n.emergencyPendingTimeoutDuration == 0 && len(n.EmergencyPendingTimeout) > 0 {
+		duration, err := time.ParseDuration(n.EmergencyPendingTimeout)
+		if err != nil {
+			return 0
+		}
+		n.emergencyPendingTimeoutDuration = duration
+	}
+
+	return n.emergencyPendingTimeoutDuration
+}
+
+// EmergencyScaleUpCoolDownPeriodDuration lazily returns/parses the emergencyScaleUpCoolDownPeriod string into a duration
+// returns 0 if the option is not set, which lets emergency scale ups happen every scan
+func (n *NodeGroupOptions) EmergencyScaleUpCoolDownPeriodDuration() time.Duration {
+	if n.emergencyScaleUpCoolDownPeriodDuration == 0 && len(n.EmergencyScaleUpCoolDownPeriod) > 0 {
+		duration, err := time.ParseDuration(n.EmergencyScaleUpCoolDownPeriod)
+		if err != nil {
+			return 0
+		}
+		n.emergencyScaleUpCoolDownPeriodDuration = duration
+	}
+
+	return n.emergencyScaleUpCoolDownPeriodDuration
+}
+
+// SaturationGracePeriodDuration lazily returns/parses the saturationGracePeriod string into a duration
+// returns DefaultSaturationGracePeriod if the option is not set
+func (n *NodeGroupOptions) SaturationGracePeriodDuration() time.Duration {
+	if len(n.SaturationGracePeriod) == 0 {
+		return DefaultSaturationGracePeriod
+	}
+	if n.saturationGracePeriodDuration == 0 {
+		duration, err := time.ParseDuration(n.SaturationGracePeriod)
+		if err != nil {
+			return 0
+		}
+		n.saturationGracePeriodDuration = duration
+	}
+
+	return n.saturationGracePeriodDuration
+}
+
+// MinNodesWasteGracePeriodDuration lazily returns/parses the minNodesWasteGracePeriod string into a duration
+// returns DefaultMinNodesWasteGracePeriod if the option is not set
+func (n *NodeGroupOptions) MinNodesWasteGracePeriodDuration() time.Duration {
+	if len(n.MinNodesWasteGracePeriod) == 0 {
+		return DefaultMinNodesWasteGracePeriod
+	}
+	if n.minNodesWasteGracePeriodDuration == 0 {
+		duration, err := time.ParseDuration(n.MinNodesWasteGracePeriod)
+		if err != nil {
+			return 0
+		}
+		n.minNodesWasteGracePeriodDuration = duration
+	}
+
+	return n.minNodesWasteGracePeriodDuration
+}
+
+// DiscountCrashLoopingPodsAfterDuration lazily returns/parses the discountCrashLoopingPodsAfter string into a duration
+// returns 0 if the option is not set, which counts the requests of crash looping pods
+func (n *NodeGroupOptions) DiscountCrashLoopingPodsAfterDuration() time.Duration {
+	if n.discountCrashLoopingPodsAfterDuration == 0 && len(n.DiscountCrashLoopingPodsAfter) > 0 {
+		duration, err := time.ParseDuration(n.DiscountCrashLoopingPodsAfter)
+		if err != nil {
+			return 0
+		}
+		n.discountCrashLoopingPodsAfterDuration = duration
+	}
+
+	return n.discountCrashLoopingPodsAfterDuration
+}
+
+// ScaleUpConfirmationDelayDuration lazily returns/parses the scaleUpConfirmationDelay string into a duration
+// returns 0 if the option is not set, which counts pending pods straight away
+func (n *NodeGroupOptions) ScaleUpConfirmationDelayDuration() time.Duration {
+	if n.scaleUpConfirmationDelayDuration == 0 && len(n.ScaleUpConfirmationDelay) > 0 {
+		duration, err := time.ParseDuration(n.ScaleUpConfirmationDelay)
+		if err != nil {
+			return 0
+		}
+		n.scaleUpConfirmationDelayDuration = duration
+	}
+
+	return n.scaleUpConfirmationDelayDuration
+}
+
+// ScaleDownNodeDeleteIntervalDuration lazily returns/parses the scaleDownNodeDeleteInterval string into a duration
+// returns 0 if the option is not set, which deletes all nodes at once
+func (n *NodeGroupOptions) ScaleDownNodeDeleteIntervalDuration() time.Duration {
+	if n.scaleDownNodeDeleteIntervalDuration == 0 && len(n.ScaleDownNodeDeleteInterval) > 0 {
+		duration, err := time.ParseDuration(n.ScaleDownNodeDeleteInterval)
+		if err != nil {
+			return 0
+		}
+		n.scaleDownNodeDeleteIntervalDuration = duration
+	}
+
+	return n.scaleDownNodeDeleteIntervalDuration
+}
+
+// ScaleDownNodeDeleteBatchSizeOrDefault returns the number of nodes deleted in each batch, defaulting to 1
+func (n *NodeGroupOptions) ScaleDownNodeDeleteBatchSizeOrDefault() int {
+	if n.ScaleDownNodeDeleteBatchSize <= 0 {
+		return 1
+	}
+	return n.ScaleDownNodeDeleteBatchSize
+}
+
+// ScaleUpMinQuantities parses the least memory and cpu each scale up adds, an empty or invalid value is zero
+func (n *NodeGroupOptions) ScaleUpMinQuantities() (resource.Quantity, resource.Quantity) {
+	return NodeResourceReservation{CPU: n.ScaleUpMinCPU, Memory: n.ScaleUpMinMemory}.Quantities()
+}
+
+// OvercommitRatios returns the memory and cpu overcommit ratios, defaulting to 1 if not set
+func (n *NodeGroupOptions) OvercommitRatios() (float64, float64) {
+	memRatio, cpuRatio := n.MemoryOvercommitRatio, n.CPUOvercommitRatio
+	if memRatio <= 0 {
+		memRatio = 1
+	}
+	if cpuRatio <= 0 {
+		cpuRatio = 1
+	}
+	return memRatio, cpuRatio
+}
+
+// UtilizationWeighted returns whether the node group scales on a weighted blend of the cpu and memory utilization
+// instead of the higher of the two
+func (n *NodeGroupOptions) UtilizationWeighted() bool {
+	return n.CPUWeight != 0 || n.MemoryWeight != 0
+}
+
+// QueueScalingEnabled returns whether the node group scales on the length of a queue
+func (n *NodeGroupOptions) QueueScalingEnabled() bool {
+	return len(n.SQSQueueURL) > 0
+}
+
+// CronJobPreWarmEnabled returns whether the node group is pre-warmed ahead of CronJobs
+func (n *NodeGroupOptions) CronJobPreWarmEnabled() bool {
+	return len(n.CronJobPreWarm) > 0
+}
+
+// splitCronJobPreWarm splits a CronJob of cron_job_pre_warm into its namespace and name, both empty if it isn't
+// namespace/name
+func splitCronJobPreWarm(cronJob string) (string, string) {
+	parts := strings.Split(cronJob, "/")
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// ModeOrDefault returns the mode of the node group, defaulting to observe if dry_mode is enabled, otherwise active
+func (n *NodeGroupOptions) ModeOrDefault() string {
+	switch {
+	case len(n.Mode) > 0:
+		return n.Mode
+	case n.DryMode:
+		return NodeGroupModeObserve
+	default:
+		return NodeGroupModeActive
+	}
+}
+
+// ParseLogLevel returns the log level of the node group
+// returns false if log_level is not set or isn't a valid level, in which case the global log level is used
+func (n *NodeGroupOptions) ParseLogLevel() (log.Level, bool) {
+	if len(n.LogLevel) == 0 {
+		return 0, false
+	}
+	level, err := log.ParseLevel(n.LogLevel)
+	if err != nil {
+		return 0, false
+	}
+	return level, true
+}
+
+// MaxScaleDownFractionOrDefault returns the largest fraction of the Ready nodes that can be tainted in a single scan
+// defaulting to DefaultMaxScaleDownFraction
+func (n *NodeGroupOptions) MaxScaleDownFractionOrDefault() float64 {
+	if n.MaxScaleDownFraction <= 0 {
+		return DefaultMaxScaleDownFraction
+	}
+	return n.MaxScaleDownFraction
+}
+
+// DrainTimeoutDuration lazily returns/parses the drainTimeout string into a duration
+// returns 0 if the option is not set, which disables draining
+func (n *NodeGroupOptions) DrainTimeoutDuration() time.Duration {
+	if n.drainTimeoutDuration == 0 && len(n.DrainTimeout) > 0 {
+		duration, err := time.ParseDuration(n.DrainTimeout)
+		if err != nil {
+			return 0
+		}
+		n.drainTimeoutDuration = duration
+	}
+
+	return n.drainTimeoutDuration
+}
+
+// CronJobPreWarmLeadTimeDuration lazily returns/parses the cronJobPreWarmLeadTime string into a duration
+// returns 0 if the option is not set or invalid
+func (n *NodeGroupOptions) CronJobPreWarmLeadTimeDuration() time.Duration {
+	if n.cronJobPreWarmLeadTimeDuration == 0 && len(n.CronJobPreWarmLeadTime) > 0 {
+		duration, err := time.ParseDuration(n.CronJobPreWarmLeadTime)
+		if err != nil {
+			return 0
+		}
+		n.cronJobPreWarmLeadTimeDuration = duration
+	}
+
+	return n.cronJobPreWarmLeadTimeDuration
+}
+
+// NodeShutdownGracePeriodDuration lazily returns/parses the nodeShutdownGracePeriod string into a duration
+// returns 0 if the option is not set, which deletes terminated nodes from kubernetes straight away
+func (n *NodeGroupOptions) NodeShutdownGracePeriodDuration() time.Duration {
+	if n.nodeShutdownGracePeriodDuration == 0 && len(n.NodeShutdownGracePeriod) > 0 {
+		duration, err := time.ParseDuration(n.NodeShutdownGracePeriod)
+		if err != nil {
+			return 0
+		}
+		n.nodeShutdownGracePeriodDuration = duration
+	}
+
+	return n.nodeShutdownGracePeriodDuration
+}
+
+// PreTerminationWebhookTimeoutDuration lazily returns/parses the preTerminationWebhookTimeout string into a duration
+// defaulting to DefaultPreTerminationWebhookTimeout if the option is not set or invalid
+func (n *NodeGroupOptions) PreTerminationWebhookTimeoutDuration() time.Duration {
+	if n.preTerminationWebhookTimeoutDuration == 0 {
+		duration, err := time.ParseDuration(n.PreTerminationWebhookTimeout)
+		if err != nil || duration <= 0 {
+			return DefaultPreTerminationWebhookTimeout
+		}
+		n.preTerminationWebhookTimeoutDuration = duration
+	}
+
+	return n.preTerminationWebhookTimeoutDuration
+}
+
+// PreTerminationWebhookFailurePolicyOrDefault returns the pre_termination_webhook_failure_policy, defaulting to fail
+func (n *NodeGroupOptions) PreTerminationWebhookFailurePolicyOrDefault() string {
+	if len(n.PreTerminationWebhookFailurePolicy) == 0 {
+		return PreTerminationFailurePolicyFail
+	}
+	return n.PreTerminationWebhookFailurePolicy
+}
+
+// OrphanNodeGracePeriodDuration lazily returns/parses the orphanNodeGracePeriod string into a duration
+func (n *NodeGroupOptions) OrphanNodeGracePeriodDuration() time.Duration {
+	if n.orphanNodeGracePeriodDuration == 0 {
+		duration, err := time.ParseDuration(n.OrphanNodeGracePeriod)
+		if err != nil {
+			return 0
+		}
+		n.orphanNodeGracePeriodDuration = duration
+	}
+
+	return n.orphanNodeGracePeriodDuration
+}
+
 // autoDiscoverMinMaxNodeOptions returns whether the min_nodes and max_nodes options should be "auto-discovered" from the cloud provider
 func (n *NodeGroupOptions) autoDiscoverMinMaxNodeOptions() bool {
 	return n.MinNodes == 0 && n.MaxNodes == 0
@@ -224,22 +1235,63 @@ func NewNodeLabelFilterFunc(labelKey, labelValue string) k8s.NodeFilterFunc {
 	}
 }
 
+// NewOwnedNodeFilterFunc creates a new NodeFilterFunc matching the nodes labelled for the node group, leaving out the
+// nodes also labelled for any of the higherPriority node groups so every node is managed by a single node group
+func NewOwnedNodeFilterFunc(nodeGroup NodeGroupOptions, higherPriority []NodeGroupOptions) k8s.NodeFilterFunc {
+	owned := NewNodeLabelFilterFunc(nodeGroup.LabelKey, nodeGroup.LabelValue)
+	var others []k8s.NodeFilterFunc
+	for _, other := range higherPriority {
+		// auto discovery node groups are templates, the discovered node groups are the ones that select nodes
+		if other.AutoDiscoveryEnabled() {
+			continue
+		}
+		others = append(others, NewNodeLabelFilterFunc(other.LabelKey, other.LabelValue))
+	}
+	return func(node *v1.Node) bool {
+		if !owned(node) {
+			return false
+		}
+		for _, other := range others {
+			if other(node) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
 // NewNodeGroupLister creates a new group from the backing lister and nodegroup filter
-func NewNodeGroupLister(allPodsLister v1lister.PodLister, allNodesLister v1lister.NodeLister, nodeGroup NodeGroupOptions) *NodeGroupLister {
+// nodes also selected by any of the higherPriority node groups are left to them
+func NewNodeGroupLister(allPodsLister v1lister.PodLister, allNodesLister v1lister.NodeLister, nodeGroup NodeGroupOptions, higherPriority ...NodeGroupOptions) *NodeGroupLister {
 	return &NodeGroupLister{
 		k8s.NewFilteredPodsLister(allPodsLister, NewPodAffinityFilterFunc(nodeGroup.LabelKey, nodeGroup.LabelValue)),
-		k8s.NewFilteredNodesLister(allNodesLister, NewNodeLabelFilterFunc(nodeGroup.LabelKey, nodeGroup.LabelValue)),
+		k8s.NewFilteredNodesLister(allNodesLister, NewOwnedNodeFilterFunc(nodeGroup, higherPriority)),
 	}
 }
 
 // NewDefaultNodeGroupLister creates a new group from the backing lister and nodegroup filter with the default filter
-func NewDefaultNodeGroupLister(allPodsLister v1lister.PodLister, allNodesLister v1lister.NodeLister, nodeGroup NodeGroupOptions) *NodeGroupLister {
+// nodes also selected by any of the higherPriority node groups are left to them
+func NewDefaultNodeGroupLister(allPodsLister v1lister.PodLister, allNodesLister v1lister.NodeLister, nodeGroup NodeGroupOptions, higherPriority ...NodeGroupOptions) *NodeGroupLister {
 	return &NodeGroupLister{
 		k8s.NewFilteredPodsLister(allPodsLister, NewPodDefaultFilterFunc()),
-		k8s.NewFilteredNodesLister(allNodesLister, NewNodeLabelFilterFunc(nodeGroup.LabelKey, nodeGroup.LabelValue)),
+		k8s.NewFilteredNodesLister(allNodesLister, NewOwnedNodeFilterFunc(nodeGroup, higherPriority)),
 	}
 }
 
+// BuildNodeGroupListers creates the listers of the node groups from the backing listers
+// a node selected by more than one node group is managed by the first of them in the order they are configured
+func BuildNodeGroupListers(allPodsLister v1lister.PodLister, allNodesLister v1lister.NodeLister, nodeGroups []NodeGroupOptions) map[string]*NodeGroupLister {
+	listers := make(map[string]*NodeGroupLister, len(nodeGroups))
+	for i, opts := range nodeGroups {
+		if opts.Name == DefaultNodeGroup {
+			listers[opts.Name] = NewDefaultNodeGroupLister(allPodsLister, allNodesLister, opts, nodeGroups[:i]...)
+		} else {
+			listers[opts.Name] = NewNodeGroupLister(allPodsLister, allNodesLister, opts, nodeGroups[:i]...)
+		}
+	}
+	return listers
+}
+
 type nodeGroupsStateOpts struct {
 	nodeGroups []NodeGroupOptions
 	client     Client
@@ -249,15 +1301,7 @@ type nodeGroupsStateOpts struct {
 func BuildNodeGroupsState(opts nodeGroupsStateOpts) map[string]*NodeGroupState {
 	nodeGroupsState := make(map[string]*NodeGroupState)
 	for _, ng := range opts.nodeGroups {
-		nodeGroupsState[ng.Name] = &NodeGroupState{
-			Opts:            ng,
-			NodeGroupLister: opts.client.Listers[ng.Name],
-			// Setup the scaleLock timeouts for this nodegroup
-			scaleUpLock: scaleLock{
-				minimumLockDuration: ng.ScaleUpCoolDownPeriodDuration(),
-				nodegroup:           ng.Name,
-			},
-		}
+		nodeGroupsState[ng.Name] = newNodeGroupState(ng, opts.client.Listers[ng.Name])
 	}
 	return nodeGroupsState
 }
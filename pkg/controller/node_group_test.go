@@ -1,9 +1,12 @@
 package controller
 
 import (
+	"bytes"
 	"github.com/atlassian/escalator/pkg/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"k8s.io/api/core/v1"
+	sigsyaml "sigs.k8s.io/yaml"
 	"strings"
 	"testing"
 	"time"
@@ -302,6 +305,143 @@ func TestNewNodeLabelFilterFunc(t *testing.T) {
 	}
 }
 
+func TestNewOwnedNodeFilterFunc(t *testing.T) {
+	buildeng := NodeGroupOptions{Name: "buildeng", LabelKey: "customer", LabelValue: "buildeng"}
+	gpu := NodeGroupOptions{Name: "gpu", LabelKey: "accelerator", LabelValue: "gpu"}
+	template := NodeGroupOptions{Name: "template", LabelKey: "customer", LabelValue: "buildeng", AutoDiscoveryTags: map[string]string{"team": "buildeng"}}
+
+	buildengNode := test.BuildTestNode(test.NodeOpts{LabelKey: "customer", LabelValue: "buildeng"})
+	gpuNode := test.BuildTestNode(test.NodeOpts{LabelKey: "accelerator", LabelValue: "gpu"})
+	bothNode := test.BuildTestNode(test.NodeOpts{LabelKey: "customer", LabelValue: "buildeng"})
+	bothNode.Labels["accelerator"] = "gpu"
+
+	tests := []struct {
+		name           string
+		nodeGroup      NodeGroupOptions
+		higherPriority []NodeGroupOptions
+		node           *v1.Node
+		want           bool
+	}{
+		{"no higher priority node groups", gpu, nil, bothNode, true},
+		{"node only labelled for the node group", gpu, []NodeGroupOptions{buildeng}, gpuNode, true},
+		{"node also labelled for a higher priority node group", gpu, []NodeGroupOptions{buildeng}, bothNode, false},
+		{"node not labelled for the node group", gpu, []NodeGroupOptions{buildeng}, buildengNode, false},
+		{"first node group keeps the node", buildeng, nil, bothNode, true},
+		{"auto discovery templates don't select nodes", gpu, []NodeGroupOptions{template}, bothNode, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewOwnedNodeFilterFunc(tt.nodeGroup, tt.higherPriority)
+			assert.Equal(t, tt.want, f(tt.node))
+		})
+	}
+}
+
+func TestBuildNodeGroupListers(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{
+		{Name: "buildeng", LabelKey: "customer", LabelValue: "buildeng"},
+		{Name: "gpu", LabelKey: "accelerator", LabelValue: "gpu"},
+	}
+	bothNode := test.BuildTestNode(test.NodeOpts{Name: "both", LabelKey: "customer", LabelValue: "buildeng"})
+	bothNode.Labels["accelerator"] = "gpu"
+	gpuNode := test.BuildTestNode(test.NodeOpts{Name: "gpu", LabelKey: "accelerator", LabelValue: "gpu"})
+	nodes := []*v1.Node{bothNode, gpuNode}
+
+	nodeNames := func(nodes []*v1.Node) []string {
+		var names []string
+		for _, node := range nodes {
+			names = append(names, node.Name)
+		}
+		return names
+	}
+
+	// the node labelled for both node groups is always managed by the first node group
+	for i := 0; i < 10; i++ {
+		listers := BuildNodeGroupListers(test.NewTestPodWatcher(nil, test.PodListerOptions{}), test.NewTestNodeWatcher(nodes, test.NodeListerOptions{}), nodeGroups)
+		buildengNodes, err := listers["buildeng"].Nodes.List()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"both"}, nodeNames(buildengNodes))
+		gpuNodes, err := listers["gpu"].Nodes.List()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"gpu"}, nodeNames(gpuNodes))
+	}
+}
+
+func TestValidateNodeGroupOverlaps(t *testing.T) {
+	buildeng := NodeGroupOptions{Name: "buildeng", LabelKey: "customer", LabelValue: "buildeng"}
+	buildengCopy := NodeGroupOptions{Name: "buildeng-copy", LabelKey: "customer", LabelValue: "buildeng"}
+	shared := NodeGroupOptions{Name: "shared", LabelKey: "customer", LabelValue: "shared"}
+	template := NodeGroupOptions{Name: "template", LabelKey: "customer", LabelValue: "buildeng", AutoDiscoveryTags: map[string]string{"team": "buildeng"}}
+
+	tests := []struct {
+		name       string
+		nodeGroups []NodeGroupOptions
+		want       []string
+	}{
+		{"no overlaps", []NodeGroupOptions{buildeng, shared}, nil},
+		{"same label", []NodeGroupOptions{buildeng, shared, buildengCopy}, []string{
+			"node groups buildeng and buildeng-copy both select the nodes labelled customer=buildeng. the nodes are managed by buildeng, the first in the config",
+		}},
+		{"auto discovery templates are skipped", []NodeGroupOptions{buildeng, template}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, warning := range ValidateNodeGroupOverlaps(tt.nodeGroups) {
+				got = append(got, warning.Error())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateCloudProviderGroupNames(t *testing.T) {
+	buildeng := NodeGroupOptions{Name: "buildeng", CloudProviderGroupName: "buildeng-asg"}
+	shared := NodeGroupOptions{Name: "shared", CloudProviderGroupName: "shared-asg"}
+	sharedCopy := NodeGroupOptions{Name: "shared-copy", CloudProviderGroupName: "shared-asg"}
+	multi := NodeGroupOptions{Name: "multi", CloudProviderGroupNames: []string{"multi-a", "buildeng-asg"}}
+	template := NodeGroupOptions{Name: "template", AutoDiscoveryTags: map[string]string{"team": "buildeng"}}
+
+	tests := []struct {
+		name       string
+		nodeGroups []NodeGroupOptions
+		want       []string
+	}{
+		{"no duplicates", []NodeGroupOptions{buildeng, shared, template, template}, nil},
+		{"same cloud provider group name", []NodeGroupOptions{buildeng, shared, sharedCopy}, []string{
+			"cloud provider group shared-asg is referenced by node groups shared and shared-copy. a cloud provider group can only be referenced by one node group",
+		}},
+		{"cloud provider group names of a multi node group", []NodeGroupOptions{buildeng, multi}, []string{
+			"cloud provider group buildeng-asg is referenced by node groups buildeng and multi. a cloud provider group can only be referenced by one node group",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, err := range ValidateCloudProviderGroupNames(tt.nodeGroups) {
+				got = append(got, err.Error())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestUnmarshalScanInterval(t *testing.T) {
+	interval, err := UnmarshalScanInterval(strings.NewReader(yamlValid))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), interval)
+
+	interval, err = UnmarshalScanInterval(strings.NewReader("scan_interval: 30s\n" + yamlValid))
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, interval)
+
+	_, err = UnmarshalScanInterval(strings.NewReader("scan_interval: soon\n" + yamlValid))
+	assert.Error(t, err)
+
+	_, err = UnmarshalScanInterval(strings.NewReader("scan_interval: 0s\n" + yamlValid))
+	assert.Error(t, err)
+}
+
 func TestUnmarshalNodeGroupOptions(t *testing.T) {
 	t.Run("test yaml unmarshal good", func(t *testing.T) {
 		yamlReader := strings.NewReader(yamlValid)
@@ -319,6 +459,7 @@ func TestUnmarshalNodeGroupOptions(t *testing.T) {
 		assert.Equal(t, "10m", opts[0].SoftDeleteGracePeriod)
 		assert.Equal(t, time.Minute*10, opts[0].SoftDeleteGracePeriodDuration())
 		assert.Equal(t, time.Duration(0), opts[0].HardDeleteGracePeriodDuration())
+		assert.Equal(t, time.Minute*15, opts[0].ScaleDownDelayAfterAddDuration())
 
 		assert.NotNil(t, opts[1])
 		assert.Equal(t, "default", opts[1].Name)
@@ -327,6 +468,45 @@ func TestUnmarshalNodeGroupOptions(t *testing.T) {
 		assert.Equal(t, 1, opts[1].MinNodes)
 		assert.Equal(t, 10, opts[1].MaxNodes)
 		assert.Equal(t, true, opts[1].DryMode)
+		assert.Equal(t, time.Duration(0), opts[1].ScaleDownDelayAfterAddDuration())
+	})
+
+	t.Run("test yaml unmarshal cloud provider group name list", func(t *testing.T) {
+		yamlReader := strings.NewReader(yamlCloudProviderGroupNames)
+		opts, err := UnmarshalNodeGroupOptions(yamlReader)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(opts))
+		assert.Equal(t, "asg-a,asg-b", opts[0].CloudProviderGroupName)
+		assert.Equal(t, []string{"asg-a", "asg-b"}, opts[0].CloudProviderGroupNameList())
+		assert.Equal(t, 5, opts[0].MinNodes)
+		assert.Equal(t, "asg-c", opts[1].CloudProviderGroupName)
+		assert.Equal(t, []string{"asg-c"}, opts[1].CloudProviderGroupNameList())
+	})
+
+	t.Run("test cloud provider group name list round trip", func(t *testing.T) {
+		opts, err := UnmarshalNodeGroupOptions(strings.NewReader(yamlCloudProviderGroupNames))
+		require.NoError(t, err)
+
+		marshalled, err := sigsyaml.Marshal(map[string]interface{}{"node_groups": opts})
+		require.NoError(t, err)
+		assert.Contains(t, string(marshalled), "cloud_provider_group_names")
+		roundTripped, err := UnmarshalNodeGroupOptions(bytes.NewReader(marshalled))
+		require.NoError(t, err)
+		assert.Equal(t, opts, roundTripped)
+
+		// the list on its own is enough
+		roundTripped, err = UnmarshalNodeGroupOptions(strings.NewReader(`{"node_groups": [{"name": "buildeng", "cloud_provider_group_names": ["asg-a", "asg-b"]}]}`))
+		require.NoError(t, err)
+		assert.Equal(t, "asg-a,asg-b", roundTripped[0].CloudProviderGroupName)
+		assert.Equal(t, []string{"asg-a", "asg-b"}, roundTripped[0].CloudProviderGroupNameList())
+	})
+
+	t.Run("test yaml unmarshal bad cloud provider group name", func(t *testing.T) {
+		yamlReader := strings.NewReader(yamlCloudProviderGroupNameErr)
+		_, err := UnmarshalNodeGroupOptions(yamlReader)
+
+		assert.Error(t, err)
 	})
 
 	t.Run("test yaml unmarshal bad", func(t *testing.T) {
@@ -358,6 +538,24 @@ var yamlErr = `
 node_groups:
 `
 
+var yamlCloudProviderGroupNames = `
+node_groups:
+  - name: "buildeng"
+    cloud_provider_group_name:
+      - asg-a
+      - asg-b
+    min_nodes: 5
+  - name: "default"
+    cloud_provider_group_name: asg-c
+`
+
+var yamlCloudProviderGroupNameErr = `
+node_groups:
+  - name: "buildeng"
+    cloud_provider_group_name:
+      - name: asg-a
+`
+
 var yamlValid = `
 node_groups:
   - name: "buildeng"
@@ -375,6 +573,7 @@ node_groups:
     soft_delete_grace_period: 10m
     hard_delete_grace_period: 42
     scale_up_cooldown_period: 1h2m30s
+    scale_down_delay_after_add: 15m
   - name: "default"
     label_key: "customer"
     label_value: "shared"
@@ -431,6 +630,30 @@ func TestValidateNodeGroup(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			"valid utilization weights",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+					CPUWeight:                          0.7,
+					MemoryWeight:                       0.3,
+				},
+			},
+			nil,
+		},
 		{
 			"invalid nodegroup",
 			args{
@@ -449,14 +672,458 @@ func TestValidateNodeGroup(t *testing.T) {
 					SoftDeleteGracePeriod:              "10",
 					HardDeleteGracePeriod:              "1h10m",
 					ScaleUpCoolDownPeriod:              "21h21m21s",
+					EmergencyScaleUpCoolDownPeriod:     "10",
+					MinNodesWasteGracePeriod:           "10",
+					ScaleDownDelayAfterAdd:             "10",
+					DiscountCrashLoopingPodsAfter:      "10",
+					UtilizationMethod:                  "firstfit",
+					UtilizationSmoothingFactor:         1.5,
+					CPUWeight:                          -0.5,
+					MaxScaleDownFraction:               -0.5,
+					ProtectReplicaSpreadMinReplicas:    -1,
+					ScaleUpRamp:                        1.5,
+					ScaleUpSoftCapPercent:              150,
+					FlapDetectionWindow:                "1 hour",
+					FlapDetectionThreshold:             -1,
+					CloudProviderSizeTolerance:         2,
+					NodeShutdownGracePeriod:            "30",
+					LabelMismatchAction:                "delete",
+					PreTerminationWebhook:              "ftp://hooks.example.com",
+					PreTerminationWebhookTimeout:       "-1s",
+					PreTerminationWebhookFailurePolicy: "retry",
+					DryMode:                            true,
+					Mode:                               "live",
+					LogLevel:                           "verbose",
 				},
 			},
 			[]string{
 				"name cannot be empty",
+				"utilization_method must be one of aggregate or binpack",
+				"utilization_smoothing_factor must be between 0 and 1",
+				"cpu_weight and memory_weight must not be negative",
+				"cpu_weight and memory_weight must add up to 1 when either is set",
 				"taint_lower_capacity_threshold_percent must be less than taint_upper_capacity_threshold_percent",
 				"min_nodes must be less than max_nodes",
 				"max_nodes must be larger than 0",
 				"soft_delete_grace_period failed to parse into a time.Duration. check your formatting.",
+				"min_nodes_waste_grace_period failed to parse into a time.Duration. check your formatting.",
+				"emergency_scale_up_cool_down_period failed to parse into a time.Duration. check your formatting.",
+				"emergency_scale_up_cool_down_period must not be set without emergency_pending_timeout",
+				"flap_detection_window failed to parse into a time.Duration. check your formatting.",
+				"flap_detection_threshold must not be negative",
+				"scale_down_delay_after_add failed to parse into a time.Duration. check your formatting.",
+				"discount_crash_looping_pods_after failed to parse into a time.Duration. check your formatting.",
+				"protect_replica_spread_min_replicas must not be negative",
+				"protect_replica_spread_min_replicas must not be set without protect_replica_spread",
+				"max_scale_down_fraction must be between 0 and 1",
+				"scale_up_ramp must be between 0 and 1",
+				"scale_up_soft_cap_percent must be between 0 and 100",
+				"cloud_provider_size_tolerance must be between 0 and 1",
+				"node_shutdown_grace_period failed to parse into a time.Duration. check your formatting.",
+				"pre_termination_webhook must be a http or https URL",
+				"pre_termination_webhook_timeout failed to parse into a positive time.Duration. check your formatting.",
+				"pre_termination_webhook_failure_policy must be one of fail or ignore",
+				"mode must be one of observe, taint_only or active",
+				"mode must be empty or observe when dry_mode is enabled",
+				"log_level must be one of debug, info, warning, error, fatal or panic",
+				"label_mismatch_action must be one of ignore, warn or cordon",
+			},
+		},
+		{
+			"invalid relationships between options",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					TaintUpperCapacityThresholdPercent: 80,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            70,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+					ScaleUpConfirmationDelay:           "5m",
+					EmergencyPendingTimeout:            "2m",
+					MinReadyNodesForScaleDown:          4,
+					MaxConcurrentDrains:                2,
+					CordonBeforeDrain:                  true,
+					PreTerminationWebhookFailurePolicy: "ignore",
+				},
+			},
+			[]string{
+				"taint_upper_capacity_threshold_percent must be less than scale_up_threshold_percent",
+				"min_ready_nodes_for_scale_down must not be larger than max_nodes, otherwise the node group never scales down",
+				"scale_up_confirmation_delay must be less than emergency_pending_timeout",
+				"max_concurrent_drains must not be set without drain_timeout",
+				"cordon_before_drain must not be enabled without drain_timeout",
+				"pre_termination_webhook_timeout and pre_termination_webhook_failure_policy must not be set without pre_termination_webhook",
+			},
+		},
+		{
+			"invalid cloud provider group name list",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "a,a,",
+					CloudProviderGroupNames:            []string{"a", "a", ""},
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+				},
+			},
+			[]string{
+				"cloud_provider_group_name contains duplicate name a",
+				"cloud_provider_group_name cannot contain an empty name",
+			},
+		},
+		{
+			"sqs queue without target messages per node",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+					SQSQueueURL:                        "https://sqs.us-east-1.amazonaws.com/123456789012/jobs",
+				},
+			},
+			[]string{
+				"sqs_target_messages_per_node must be larger than 0 when sqs_queue_url is set",
+			},
+		},
+		{
+			"sqs target messages per node without queue",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+					SQSTargetMessagesPerNode:           10,
+				},
+			},
+			[]string{
+				"sqs_target_messages_per_node must not be set without sqs_queue_url",
+			},
+		},
+		{
+			"invalid cron job pre warm",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+					CronJobPreWarm:                     []string{"batch/hourly", "nightly"},
+					CronJobPreWarmLeadTime:             "5",
+				},
+			},
+			[]string{
+				"cron_job_pre_warm must be a list of namespace/name, \"nightly\" isn't",
+				"cron_job_pre_warm_lead_time must be set to a positive time.Duration when cron_job_pre_warm is set",
+				"cron_job_pre_warm_nodes must be larger than 0 when cron_job_pre_warm is set",
+			},
+		},
+		{
+			"cron job pre warm options without cron jobs",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+					CronJobPreWarmNodes:                10,
+				},
+			},
+			[]string{
+				"cron_job_pre_warm_lead_time and cron_job_pre_warm_nodes must not be set without cron_job_pre_warm",
+			},
+		},
+		{
+			"valid auto discovery nodegroup",
+			args{
+				NodeGroupOptions{
+					Name:                               "discovered",
+					LabelKey:                           "customer",
+					AutoDiscoveryTags:                  map[string]string{"k8s.io/cluster-autoscaler/enabled": ""},
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+				},
+			},
+			nil,
+		},
+		{
+			"invalid auto discovery nodegroup",
+			args{
+				NodeGroupOptions{
+					Name:                               "discovered",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					AutoDiscoveryTags:                  map[string]string{"": "enabled"},
+					AWSRegion:                          "us-west-2",
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+				},
+			},
+			[]string{
+				"label_value must be empty when auto_discovery_tags is set",
+				"cloud_provider_group_name must be empty when auto_discovery_tags is set",
+				"auto_discovery_tags cannot contain an empty key",
+				"aws_region and aws_endpoint must be empty when auto_discovery_tags is set",
+			},
+		},
+		{
+			"invalid node resource reservation",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+					NodeResourceReservation: NodeResourceReservation{
+						CPU:    "-100m",
+						Memory: "lots",
+					},
+				},
+			},
+			[]string{
+				"node_resource_reservation cpu must not be negative",
+				"node_resource_reservation memory failed to parse into a resource quantity. check your formatting.",
+			},
+		},
+		{
+			"invalid default pod request",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+					DefaultPodRequest: NodeResourceReservation{
+						CPU:    "some",
+						Memory: "-1Gi",
+					},
+				},
+			},
+			[]string{
+				"default_pod_request cpu failed to parse into a resource quantity. check your formatting.",
+				"default_pod_request memory must not be negative",
+			},
+		},
+		{
+			"invalid scale up min resources",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+					ScaleUpMinCPU:                      "lots",
+					ScaleUpMinMemory:                   "-64Gi",
+				},
+			},
+			[]string{
+				"scale_up_min_cpu failed to parse into a resource quantity. check your formatting.",
+				"scale_up_min_memory must not be negative",
+			},
+		},
+		{
+			"zero overcommit ratios use the default",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+					CPUOvercommitRatio:                 0,
+					MemoryOvercommitRatio:              0,
+				},
+			},
+			nil,
+		},
+		{
+			"invalid overcommit ratios",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+					CPUOvercommitRatio:                 -1.5,
+					MemoryOvercommitRatio:              -1,
+				},
+			},
+			[]string{
+				"cpu_overcommit_ratio must not be negative",
+				"memory_overcommit_ratio must not be negative",
+			},
+		},
+		{
+			"invalid scale up pod phases",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+					ScaleUpPodPhases:                   []string{"Unschedulable", "Running"},
+				},
+			},
+			[]string{
+				"scale_up_pod_phases must only contain Pending or Unschedulable, not Running",
+			},
+		},
+		{
+			"invalid external deletion taints",
+			args{
+				NodeGroupOptions{
+					Name:                               "test",
+					LabelKey:                           "customer",
+					LabelValue:                         "buileng",
+					CloudProviderGroupName:             "somegroup",
+					TaintUpperCapacityThresholdPercent: 70,
+					TaintLowerCapacityThresholdPercent: 60,
+					ScaleUpThresholdPercent:            100,
+					MinNodes:                           1,
+					MaxNodes:                           3,
+					SlowNodeRemovalRate:                1,
+					FastNodeRemovalRate:                2,
+					SoftDeleteGracePeriod:              "10m",
+					HardDeleteGracePeriod:              "1h10m",
+					ScaleUpCoolDownPeriod:              "55m",
+					ExternalDeletionTaints:             []string{"ToBeDeletedByClusterAutoscaler", "", "atlassian.com/escalator"},
+				},
+			},
+			[]string{
+				"external_deletion_taints must not contain an empty taint key",
+				"external_deletion_taints must not contain atlassian.com/escalator, the taint escalator applies itself",
 			},
 		},
 	}
@@ -480,3 +1147,26 @@ func TestNodeGroupOptions_autoDiscoverMinMaxNodeOptions(t *testing.T) {
 	optionsAutoDiscover := NodeGroupOptions{MinNodes: 0, MaxNodes: 0}
 	assert.True(t, optionsAutoDiscover.autoDiscoverMinMaxNodeOptions())
 }
+
+func TestNodeGroupOptions_OvercommitRatios(t *testing.T) {
+	options := NodeGroupOptions{}
+	memRatio, cpuRatio := options.OvercommitRatios()
+	assert.Equal(t, 1.0, memRatio)
+	assert.Equal(t, 1.0, cpuRatio)
+
+	options = NodeGroupOptions{CPUOvercommitRatio: 1.5, MemoryOvercommitRatio: 0.8}
+	memRatio, cpuRatio = options.OvercommitRatios()
+	assert.Equal(t, 0.8, memRatio)
+	assert.Equal(t, 1.5, cpuRatio)
+}
+
+func TestNodeGroupOptions_ModeOrDefault(t *testing.T) {
+	options := NodeGroupOptions{}
+	assert.Equal(t, NodeGroupModeActive, options.ModeOrDefault())
+
+	options = NodeGroupOptions{DryMode: true}
+	assert.Equal(t, NodeGroupModeObserve, options.ModeOrDefault())
+
+	options = NodeGroupOptions{Mode: NodeGroupModeTaintOnly}
+	assert.Equal(t, NodeGroupModeTaintOnly, options.ModeOrDefault())
+}
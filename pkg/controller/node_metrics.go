@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/metrics"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// updateNodeMetrics sets the node level metrics of every node in the node group from the NodeInfoMap and deletes the
+// metrics of the nodes that have left the node group since the last scan
+func (c *Controller) updateNodeMetrics(nodegroup string, nodeGroup *NodeGroupState, nodes []*v1.Node) {
+	memReserved, cpuReserved := nodeGroup.Opts.NodeResourceReservation.Quantities()
+	memDefault, cpuDefault := nodeGroup.Opts.DefaultPodRequest.Quantities()
+	current := make(map[string]bool, len(nodes))
+	instances := make(map[string]cloudprovider.InstanceMetadata, len(nodeGroup.instanceMetadata))
+	for _, node := range nodes {
+		current[node.Name] = true
+
+		if metadata, ok := nodeGroup.instanceMetadata[node.Name]; ok {
+			instances[node.Name] = metadata
+			metrics.NodeInstanceInfo.WithLabelValues(nodegroup, node.Name, metadata.InstanceType, metadata.AvailabilityZone).Set(1)
+		}
+
+		var memRequest, cpuRequest resource.Quantity
+		var pods int
+		if nodeInfo, ok := nodeGroup.NodeInfoMap[node.Name]; ok {
+			for _, pod := range nodeInfo.Pods() {
+				if k8s.PodIsTerminated(pod) {
+					continue
+				}
+				podMemRequest, podCPURequest := k8s.CalculatePodRequestsOrDefault(pod, memDefault, cpuDefault)
+				memRequest.Add(podMemRequest)
+				cpuRequest.Add(podCPURequest)
+				pods++
+			}
+		}
+
+		// the percentages of a node without any allocatable are left unset rather than dividing by zero
+		memAllocatable, cpuAllocatable := k8s.NodeAllocatableLessReserved(node, memReserved, cpuReserved)
+		if cpuPercent, memPercent, err := calcPercentUsage(cpuRequest, memRequest, cpuAllocatable, memAllocatable); err == nil {
+			metrics.NodeCPUPercent.WithLabelValues(nodegroup, node.Name).Set(cpuPercent)
+			metrics.NodeMemPercent.WithLabelValues(nodegroup, node.Name).Set(memPercent)
+		}
+		metrics.NodePods.WithLabelValues(nodegroup, node.Name).Set(float64(pods))
+	}
+
+	for name := range nodeGroup.metricNodes {
+		if !current[name] {
+			metrics.DeleteNodeMetrics(nodegroup, name)
+		}
+	}
+	nodeGroup.metricNodes = current
+
+	// the lifecycle state isn't a label so only a change of the instance type or availability zone needs a new series
+	for name, previous := range nodeGroup.metricInstances {
+		metadata, ok := instances[name]
+		if !ok || metadata.InstanceType != previous.InstanceType || metadata.AvailabilityZone != previous.AvailabilityZone {
+			metrics.DeleteNodeInstanceInfo(nodegroup, name, previous.InstanceType, previous.AvailabilityZone)
+		}
+	}
+	nodeGroup.metricInstances = instances
+}
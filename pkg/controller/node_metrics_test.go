@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+)
+
+func TestUpdateNodeMetrics(t *testing.T) {
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "node-1", CPU: 1000, Mem: 1000}),
+		test.BuildTestNode(test.NodeOpts{Name: "node-2", CPU: 1000, Mem: 2000}),
+	}
+	pods := []*v1.Pod{
+		test.BuildTestPod(test.PodOpts{Name: "pod-1", CPU: []int64{250}, Mem: []int64{500}, NodeName: "node-1"}),
+		test.BuildTestPod(test.PodOpts{Name: "pod-2", CPU: []int64{250}, Mem: []int64{500}, NodeName: "node-1"}),
+		test.BuildTestPod(test.PodOpts{Name: "completed", CPU: []int64{500}, Mem: []int64{500}, NodeName: "node-2", Phase: v1.PodSucceeded}),
+	}
+	nodeGroup := &NodeGroupState{
+		Opts:        NodeGroupOptions{Name: "metrics"},
+		NodeInfoMap: k8s.CreateNodeNameToInfoMap(pods, nodes),
+	}
+	controller := &Controller{}
+
+	controller.updateNodeMetrics("metrics", nodeGroup, nodes)
+	assert.Equal(t, float64(50), testutil.ToFloat64(metrics.NodeCPUPercent.WithLabelValues("metrics", "node-1")))
+	assert.Equal(t, float64(100), testutil.ToFloat64(metrics.NodeMemPercent.WithLabelValues("metrics", "node-1")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.NodePods.WithLabelValues("metrics", "node-1")))
+	// terminated pods aren't counted
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.NodeCPUPercent.WithLabelValues("metrics", "node-2")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.NodePods.WithLabelValues("metrics", "node-2")))
+	assert.Equal(t, map[string]bool{"node-1": true, "node-2": true}, nodeGroup.metricNodes)
+
+	// the metrics of nodes that have left the node group are deleted
+	metrics.NodePods.WithLabelValues("metrics", "node-2").Set(5)
+	controller.updateNodeMetrics("metrics", nodeGroup, nodes[:1])
+	assert.Equal(t, map[string]bool{"node-1": true}, nodeGroup.metricNodes)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.NodePods.WithLabelValues("metrics", "node-2")))
+}
+
+func TestUpdateNodeMetricsInstanceInfo(t *testing.T) {
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "node-1", CPU: 1000, Mem: 1000}),
+		test.BuildTestNode(test.NodeOpts{Name: "node-2", CPU: 1000, Mem: 1000}),
+		test.BuildTestNode(test.NodeOpts{Name: "node-3", CPU: 1000, Mem: 1000}),
+	}
+	nodeGroup := &NodeGroupState{
+		Opts:        NodeGroupOptions{Name: "instances"},
+		NodeInfoMap: k8s.CreateNodeNameToInfoMap(nil, nodes),
+		instanceMetadata: map[string]cloudprovider.InstanceMetadata{
+			"node-1": {InstanceType: "m5.large", AvailabilityZone: "us-east-1a", LifecycleState: "InService"},
+			"node-2": {InstanceType: "m5.large", AvailabilityZone: "us-east-1b"},
+		},
+	}
+	controller := &Controller{}
+
+	controller.updateNodeMetrics("instances", nodeGroup, nodes)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.NodeInstanceInfo.WithLabelValues("instances", "node-1", "m5.large", "us-east-1a")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.NodeInstanceInfo.WithLabelValues("instances", "node-2", "m5.large", "us-east-1b")))
+	// nodes without instance metadata don't have the metric
+	assert.Len(t, nodeGroup.metricInstances, 2)
+
+	// the series of nodes that left the node group, or whose metadata changed, are deleted
+	nodeGroup.instanceMetadata = map[string]cloudprovider.InstanceMetadata{
+		"node-1": {InstanceType: "m5.xlarge", AvailabilityZone: "us-east-1a"},
+	}
+	controller.updateNodeMetrics("instances", nodeGroup, nodes[:1])
+	assert.Equal(t, map[string]cloudprovider.InstanceMetadata{
+		"node-1": {InstanceType: "m5.xlarge", AvailabilityZone: "us-east-1a"},
+	}, nodeGroup.metricInstances)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.NodeInstanceInfo.WithLabelValues("instances", "node-1", "m5.xlarge", "us-east-1a")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.NodeInstanceInfo.WithLabelValues("instances", "node-1", "m5.large", "us-east-1a")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.NodeInstanceInfo.WithLabelValues("instances", "node-2", "m5.large", "us-east-1b")))
+}
+
+func TestControllerUpdateInstanceMetadata(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+	}}
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "node-1"}),
+		test.BuildTestNode(test.NodeOpts{Name: "node-2"}),
+	}
+	client, opts := buildTestClient(nodes, nil, nodeGroups, ListerOptions{})
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testNodeGroup.SetInstanceMetadata("node-1", cloudprovider.InstanceMetadata{InstanceType: "m5.large", AvailabilityZone: "us-east-1a"})
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	nodeGroup := nodeGroupsState["default"]
+	controller.updateInstanceMetadata(nodeGroup, nodes)
+	assert.Equal(t, map[string]cloudprovider.InstanceMetadata{
+		"node-1": {InstanceType: "m5.large", AvailabilityZone: "us-east-1a"},
+	}, nodeGroup.instanceMetadata)
+
+	// the metadata is added to the logs of scale actions on the node
+	assert.Equal(t, log.Fields{
+		"nodegroup":         "default",
+		"instance_type":     "m5.large",
+		"availability_zone": "us-east-1a",
+	}, nodeGroup.nodeLog(nodes[0]).Data)
+	assert.Equal(t, log.Fields{"nodegroup": "default"}, nodeGroup.nodeLog(nodes[1]).Data)
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/atlassian/escalator/pkg/k8s"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+)
+
+// awaitNodeShutdown gives a node that is ready to be terminated node_shutdown_grace_period for its pods to shut down
+// gracefully and returns whether it has passed. The first time it is called for a node the node is cordoned, its pods are
+// evicted and the time is recorded in the ShutdownStartedAnnotation of the node, so the wait isn't lost if escalator
+// restarts. From then on the node is left out of the node counts and only terminated once the grace period has passed
+func (c *Controller) awaitNodeShutdown(nodeGroup *NodeGroupState, node *v1.Node) bool {
+	since, err := k8s.GetShutdownStartedTime(node)
+	if err != nil {
+		nodeGroup.nodeLog(node).WithError(err).Warningf("Failed to read when node %v started shutting down. Starting again", node.Name)
+		since = nil
+	}
+
+	// the cordon may have been reverted, e.g. by an aborted removal, so check the node is still cordoned every scan
+	if !node.Spec.Unschedulable {
+		if _, err := k8s.CordonNode(node, c.Client); err != nil {
+			nodeGroup.nodeLog(node).WithError(err).Warningf("failed to cordon node %v before shutting it down", node.Name)
+			return false
+		}
+	}
+
+	now := c.clock().Now()
+	if since == nil {
+		if pods, ok := k8s.NodePodsToDrain(node, nodeGroup.NodeInfoMap); ok {
+			for _, pod := range pods {
+				if err := k8s.EvictPod(pod, c.Client); err != nil {
+					log.WithField("nodegroup", nodeGroup.Opts.Name).WithError(err).Warningf("failed to evict pod %v/%v from node %v", pod.Namespace, pod.Name, node.Name)
+				}
+			}
+		}
+		if _, err := k8s.AnnotateNode(node, k8s.ShutdownStartedAnnotation, strconv.FormatInt(now.Unix(), 10), c.Client); err != nil {
+			nodeGroup.nodeLog(node).WithError(err).Warningf("Failed to record that node %v started shutting down", node.Name)
+			return false
+		}
+		nodeGroup.nodeLog(node).Infof("Waiting node_shutdown_grace_period of %v for node %v to shut down before terminating it",
+			nodeGroup.Opts.NodeShutdownGracePeriodDuration(), node.Name)
+		return false
+	}
+
+	if remaining := nodeGroup.Opts.NodeShutdownGracePeriodDuration() - now.Sub(*since); remaining > 0 {
+		log.Debugf("node %v shutting down. Time remaining %v", node.Name, remaining)
+		return false
+	}
+	return true
+}
+
+// filterShuttingDownNodes separates the nodes waiting for node_shutdown_grace_period before they are terminated from the
+// rest of the nodes. They are on their way out, so they aren't capacity and aren't untainted or acted on by anything
+// other than the removal of tainted nodes
+func filterShuttingDownNodes(nodes []*v1.Node) (remaining []*v1.Node, shuttingDown []*v1.Node) {
+	remaining = make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if _, ok := node.ObjectMeta.Annotations[k8s.ShutdownStartedAnnotation]; ok {
+			shuttingDown = append(shuttingDown, node)
+		} else {
+			remaining = append(remaining, node)
+		}
+	}
+	return remaining, shuttingDown
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+func TestControllerNodeShutdownGracePeriod(t *testing.T) {
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                    "default",
+		CloudProviderGroupName:  "default",
+		MinNodes:                0,
+		MaxNodes:                10,
+		SoftDeleteGracePeriod:   "1m",
+		HardDeleteGracePeriod:   "10m",
+		NodeShutdownGracePeriod: "2m",
+	}
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "node", CPU: 1000, Mem: 1000, Tainted: true}),
+		test.BuildTestNode(test.NodeOpts{Name: "other", CPU: 1000, Mem: 1000, Tainted: true}),
+	}
+	client, opts := buildTestClient(nodes, nil, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 0, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+		client:     *client,
+	})
+	nodeGroup := nodeGroupsState["default"]
+	nodeGroup.NodeInfoMap = k8s.CreateNodeNameToInfoMap(nil, nodes)
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	mockClock.Add(5 * time.Minute)
+
+	tryRemove := func(tainted []*v1.Node, shuttingDown []*v1.Node) int {
+		removed, err := controller.TryRemoveTaintedNodes(scaleOpts{
+			nodes:             nodes,
+			taintedNodes:      tainted,
+			shuttingDownNodes: shuttingDown,
+			nodeGroup:         nodeGroup,
+		})
+		require.NoError(t, err)
+		return removed
+	}
+	deleted := func() []string {
+		var deleted []string
+		for _, action := range opts.K8SClient.(*fake.Clientset).Actions() {
+			if action.Matches("delete", "nodes") {
+				deleted = append(deleted, action.(core.DeleteAction).GetName())
+			}
+		}
+		return deleted
+	}
+
+	// the nodes are cordoned and start shutting down rather than being terminated
+	assert.Equal(t, 0, tryRemove(nodes, nil))
+	assert.Equal(t, int64(2), testNodeGroup.TargetSize())
+	assert.Empty(t, deleted())
+	for _, node := range nodes {
+		assert.True(t, node.Spec.Unschedulable)
+		since, err := k8s.GetShutdownStartedTime(node)
+		require.NoError(t, err)
+		require.NotNil(t, since)
+	}
+
+	// from then on they are left out of the other nodes
+	remaining, shuttingDown := filterShuttingDownNodes(nodes)
+	assert.Empty(t, remaining)
+	assert.Len(t, shuttingDown, 2)
+
+	// they aren't terminated until the grace period has passed
+	mockClock.Add(time.Minute)
+	assert.Equal(t, 0, tryRemove(nil, shuttingDown))
+	assert.Equal(t, int64(2), testNodeGroup.TargetSize())
+	assert.Empty(t, deleted())
+
+	mockClock.Add(time.Minute)
+	assert.Equal(t, -2, tryRemove(nil, shuttingDown))
+	assert.Equal(t, int64(0), testNodeGroup.TargetSize())
+	assert.ElementsMatch(t, []string{"node", "other"}, deleted())
+}
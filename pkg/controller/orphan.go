@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+)
+
+// cleanupOrphanNodes deletes nodes from Kubernetes whose cloud provider instance no longer exists
+// A node is orphaned when it is not ready and does not belong to the cloud provider node group. It is only deleted
+// once it has been orphaned for longer than orphan_node_grace_period. Returns the nodes that were not deleted
+func (c *Controller) cleanupOrphanNodes(nodegroup string, nodeGroup *NodeGroupState, nodes []*v1.Node) []*v1.Node {
+	cloudProviderNodeGroup, ok := getCloudProviderNodeGroup(c.cloudProvider, nodeGroup.Opts)
+	if !ok {
+		log.WithField("nodegroup", nodegroup).Warningf("cloud provider node group does not exist: %s. Skipping orphan node cleanup", nodeGroup.Opts.CloudProviderGroupName)
+		return nodes
+	}
+
+	now := c.clock().Now()
+	orphanedSince := make(nodeTimes)
+	remaining := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if k8s.NodeIsReady(node) || cloudProviderNodeGroup.Belongs(node) {
+			remaining = append(remaining, node)
+			continue
+		}
+
+		// keep the time the node was first seen orphaned across runs
+		since, ok := nodeGroup.orphanedSince[node.Name]
+		if !ok {
+			since = now
+			log.WithField("nodegroup", nodegroup).Infof("Node %v, %v is not ready and its instance is not in the cloud provider node group", node.Name, node.Spec.ProviderID)
+		}
+		orphanedSince[node.Name] = since
+
+		if now.Sub(since) <= nodeGroup.Opts.OrphanNodeGracePeriodDuration() {
+			log.WithField("nodegroup", nodegroup).Debugf("Orphaned node %v not ready for deletion yet. Time remaining %v",
+				node.Name,
+				nodeGroup.Opts.OrphanNodeGracePeriodDuration()-now.Sub(since),
+			)
+			remaining = append(remaining, node)
+			continue
+		}
+
+		drymode := c.dryMode(nodeGroup)
+		if drymode || c.scalingPaused(nodeGroup) {
+			log.WithField("nodegroup", nodegroup).WithField("drymode", drymode).Infof("Orphaned node %v ready to be deleted", node.Name)
+			remaining = append(remaining, node)
+			continue
+		}
+
+		log.WithField("nodegroup", nodegroup).Infof("Deleting orphaned node %v", node.Name)
+		if err := k8s.DeleteNode(node, c.Client); err != nil {
+			log.WithField("nodegroup", nodegroup).WithError(err).Errorf("failed to delete orphaned node %v from kubernetes", node.Name)
+			remaining = append(remaining, node)
+			continue
+		}
+		delete(orphanedSince, node.Name)
+		metrics.NodeGroupOrphanNodesDeleted.WithLabelValues(nodegroup).Add(1.0)
+	}
+
+	nodeGroup.orphanedSince = orphanedSince
+	return remaining
+}
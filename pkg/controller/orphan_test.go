@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"testing"
+	duration "time"
+
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+// orphanTestCloudProvider is a test cloud provider whose node group only owns the given instances
+type orphanTestCloudProvider struct {
+	*test.CloudProvider
+	nodeGroup *orphanTestNodeGroup
+}
+
+func (c *orphanTestCloudProvider) GetNodeGroup(id string) (cloudprovider.NodeGroup, bool) {
+	return c.nodeGroup, c.nodeGroup.ID() == id
+}
+
+type orphanTestNodeGroup struct {
+	*test.NodeGroup
+	instances map[string]bool
+}
+
+func (n *orphanTestNodeGroup) Belongs(node *v1.Node) bool {
+	return n.instances[node.Spec.ProviderID]
+}
+
+func setNodeReady(node *v1.Node, ready bool) {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: status}}
+}
+
+func TestCleanupOrphanNodes(t *testing.T) {
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "ready-in-group"}),
+		test.BuildTestNode(test.NodeOpts{Name: "not-ready-in-group"}),
+		test.BuildTestNode(test.NodeOpts{Name: "ready-orphan"}),
+		test.BuildTestNode(test.NodeOpts{Name: "not-ready-orphan"}),
+	}
+	setNodeReady(nodes[0], true)
+	setNodeReady(nodes[1], false)
+	setNodeReady(nodes[2], true)
+	setNodeReady(nodes[3], false)
+
+	nodeGroups := []NodeGroupOptions{{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MinNodes:               1,
+		MaxNodes:               10,
+		CleanupOrphanNodes:     true,
+		OrphanNodeGracePeriod:  "10m",
+	}}
+	client, opts := buildTestClient(nodes, nil, nodeGroups, ListerOptions{})
+	mockClock := newManualClock(duration.Now())
+	opts.Clock = mockClock
+
+	testCloudProvider := &orphanTestCloudProvider{
+		CloudProvider: test.NewCloudProvider(1),
+		nodeGroup: &orphanTestNodeGroup{
+			NodeGroup: test.NewNodeGroup("default", 1, 10, 2),
+			instances: map[string]bool{"ready-in-group": true, "not-ready-in-group": true},
+		},
+	}
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      nil,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// the orphan is detected but kept within the grace period
+	remaining := controller.cleanupOrphanNodes("default", nodeGroupsState["default"], nodes)
+	assert.Len(t, remaining, 4)
+	assert.Contains(t, nodeGroupsState["default"].orphanedSince, "not-ready-orphan")
+	assert.Len(t, nodeGroupsState["default"].orphanedSince, 1)
+
+	mockClock.Add(5 * duration.Minute)
+	remaining = controller.cleanupOrphanNodes("default", nodeGroupsState["default"], nodes)
+	assert.Len(t, remaining, 4)
+
+	// the grace period has passed, only the not ready orphan is deleted
+	mockClock.Add(6 * duration.Minute)
+	remaining = controller.cleanupOrphanNodes("default", nodeGroupsState["default"], nodes)
+	assert.Len(t, remaining, 3)
+	for _, node := range remaining {
+		assert.NotEqual(t, "not-ready-orphan", node.Name)
+	}
+	assert.Empty(t, nodeGroupsState["default"].orphanedSince)
+
+	var deleted []string
+	for _, action := range opts.K8SClient.(*fake.Clientset).Actions() {
+		if action.Matches("delete", "nodes") {
+			deleted = append(deleted, action.(core.DeleteAction).GetName())
+		}
+	}
+	assert.Equal(t, []string{"not-ready-orphan"}, deleted)
+}
+
+func TestScaleNodeGroupExternalDeletionNodesNotOrphaned(t *testing.T) {
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "in-group", CPU: 1000, Mem: 1000}),
+		test.BuildTestNode(test.NodeOpts{Name: "orphan", CPU: 1000, Mem: 1000}),
+		test.BuildTestNode(test.NodeOpts{Name: "deleted-by-cluster-autoscaler", CPU: 1000, Mem: 1000}),
+	}
+	setNodeReady(nodes[0], true)
+	setNodeReady(nodes[1], false)
+	setNodeReady(nodes[2], false)
+	nodes[2].Spec.Taints = []v1.Taint{{Key: "ToBeDeletedByClusterAutoscaler", Value: "1700000000", Effect: v1.TaintEffectNoSchedule}}
+
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		ScaleUpCoolDownPeriod:              "1m",
+		CleanupOrphanNodes:                 true,
+		OrphanNodeGracePeriod:              "10m",
+		ExternalDeletionTaints:             []string{"ToBeDeletedByClusterAutoscaler"},
+	}}
+	client, opts := buildTestClient(nodes, nil, nodeGroups, ListerOptions{})
+
+	testCloudProvider := &orphanTestCloudProvider{
+		CloudProvider: test.NewCloudProvider(1),
+		nodeGroup: &orphanTestNodeGroup{
+			NodeGroup: test.NewNodeGroup("default", 1, 10, 3),
+			instances: map[string]bool{"in-group": true},
+		},
+	}
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// the node another tool is deleting is left to it, so isn't tracked as an orphan
+	controller.scaleNodeGroup("default", nodeGroupsState["default"])
+	assert.Contains(t, nodeGroupsState["default"].orphanedSince, "orphan")
+	assert.NotContains(t, nodeGroupsState["default"].orphanedSince, "deleted-by-cluster-autoscaler")
+}
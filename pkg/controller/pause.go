@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"sync/atomic"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// pauseState is a runtime togglable switch that gates all scale actions across every node group
+// calculations and metrics are still performed whilst paused
+type pauseState struct {
+	paused int32
+}
+
+// set updates the paused state and the paused metric
+func (p *pauseState) set(paused bool) {
+	var value int32
+	if paused {
+		value = 1
+	}
+	atomic.StoreInt32(&p.paused, value)
+	metrics.Paused.Set(float64(value))
+}
+
+// get returns whether scaling is currently paused
+func (p *pauseState) get() bool {
+	return atomic.LoadInt32(&p.paused) == 1
+}
+
+// Pause stops the controller from performing any scale actions until Resume is called
+func (c *Controller) Pause() {
+	c.pause.set(true)
+	log.Info("Scaling paused. No scale actions will be performed until resumed")
+}
+
+// Resume allows the controller to perform scale actions again after a Pause
+func (c *Controller) Resume() {
+	c.pause.set(false)
+	log.Info("Scaling resumed")
+}
+
+// Paused returns whether the controller is currently paused
+func (c *Controller) Paused() bool {
+	return c.pause.get()
+}
+
+// scalingPaused returns whether scale actions of the node group are paused, either by the global pause or by freezing
+// the node group
+func (c *Controller) scalingPaused(nodeGroup *NodeGroupState) bool {
+	return c.Paused() || nodeGroup.Opts.Frozen
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPauseScaleNodeGroup(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                    "default",
+		CloudProviderGroupName:  "default",
+		MinNodes:                1,
+		MaxNodes:                10,
+		ScaleUpThresholdPercent: 70,
+		ScaleUpCoolDownPeriod:   "1m",
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(10, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      nil,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// paused, the delta is still calculated but no action is taken
+	controller.Pause()
+	require.True(t, controller.Paused())
+	delta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+	require.NoError(t, err)
+	assert.True(t, delta > 0)
+	assert.Equal(t, int64(len(nodes)), testNodeGroup.TargetSize())
+
+	// resumed, the scale up is performed
+	controller.Resume()
+	require.False(t, controller.Paused())
+	_, err = controller.scaleNodeGroup("default", nodeGroupsState["default"])
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(nodes)+delta), testNodeGroup.TargetSize())
+}
+
+func TestFrozenNodeGroup(t *testing.T) {
+	nodeGroupOptions := NodeGroupOptions{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		ScaleUpCoolDownPeriod:              "1m",
+		Frozen:                             true,
+	}
+	nodeGroups := []NodeGroupOptions{nodeGroupOptions}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(10, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      nil,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// frozen, the delta and metrics are still calculated but no action is taken
+	require.NoError(t, controller.RunOnce())
+	delta := nodeGroupsState["default"].scaleDelta
+	assert.True(t, delta > 0)
+	assert.Equal(t, int64(len(nodes)), testNodeGroup.TargetSize())
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.NodeGroupFrozen.WithLabelValues("default")))
+	assert.Equal(t, float64(100), testutil.ToFloat64(metrics.NodeGroupsCPUPercent.WithLabelValues("default")))
+
+	// stays frozen across scans until unfrozen by a reload
+	require.NoError(t, controller.RunOnce())
+	assert.Equal(t, int64(len(nodes)), testNodeGroup.TargetSize())
+
+	unfrozen := nodeGroupOptions
+	unfrozen.Frozen = false
+	controller.ReloadNodeGroups([]NodeGroupOptions{unfrozen})
+	require.NoError(t, controller.RunOnce())
+	assert.Equal(t, int64(len(nodes)+delta), testNodeGroup.TargetSize())
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.NodeGroupFrozen.WithLabelValues("default")))
+}
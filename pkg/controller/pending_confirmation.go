@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// filterUnconfirmedPendingPods removes unscheduled pods that haven't been pending for scale_up_confirmation_delay yet
+// so short lived bursts of pending pods that the scheduler places on its own don't cause a scale up
+// Pods pending for longer than emergency_pending_timeout are always kept. The time each pod was first seen pending is
+// kept across runs. Returns the kept pods, the number of pods removed and the number of emergency pods
+func filterUnconfirmedPendingPods(nodegroup string, nodeGroup *NodeGroupState, pods []*v1.Pod, now time.Time) ([]*v1.Pod, int, int) {
+	delay := nodeGroup.Opts.ScaleUpConfirmationDelayDuration()
+	emergencyTimeout := nodeGroup.Opts.EmergencyPendingTimeoutDuration()
+	if delay <= 0 && emergencyTimeout <= 0 {
+		nodeGroup.pendingSince = nil
+		return pods, 0, 0
+	}
+
+	pendingSince := make(map[types.UID]time.Time)
+	filtered := make([]*v1.Pod, 0, len(pods))
+	emergency := 0
+	for _, pod := range pods {
+		if len(pod.Spec.NodeName) > 0 {
+			filtered = append(filtered, pod)
+			continue
+		}
+
+		// keep the time the pod was first seen pending across runs
+		since, ok := nodeGroup.pendingSince[pod.UID]
+		if !ok {
+			since = now
+		}
+		pendingSince[pod.UID] = since
+
+		if emergencyTimeout > 0 && now.Sub(since) >= emergencyTimeout {
+			emergency++
+			filtered = append(filtered, pod)
+			continue
+		}
+		if now.Sub(since) < delay {
+			log.WithField("nodegroup", nodegroup).Debugf("Pending pod %v/%v not confirmed yet. Time remaining %v", pod.Namespace, pod.Name, delay-now.Sub(since))
+			continue
+		}
+		filtered = append(filtered, pod)
+	}
+	nodeGroup.pendingSince = pendingSince
+	return filtered, len(pods) - len(filtered), emergency
+}
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"testing"
+	duration "time"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+)
+
+func TestFilterUnconfirmedPendingPods(t *testing.T) {
+	mockClock := newManualClock(duration.Now())
+
+	nodeGroup := &NodeGroupState{
+		Opts: NodeGroupOptions{
+			Name:                     "default",
+			ScaleUpConfirmationDelay: "30s",
+		},
+	}
+
+	scheduled := test.BuildTestPod(test.PodOpts{Name: "scheduled", NodeName: "n1"})
+	first := test.BuildTestPod(test.PodOpts{Name: "first"})
+	second := test.BuildTestPod(test.PodOpts{Name: "second"})
+
+	// scheduled pods are always kept, newly pending pods aren't counted yet
+	pods, removed, _ := filterUnconfirmedPendingPods("default", nodeGroup, []*v1.Pod{scheduled, first}, mockClock.Now())
+	assert.Equal(t, []*v1.Pod{scheduled}, pods)
+	assert.Equal(t, 1, removed)
+
+	mockClock.Add(20 * duration.Second)
+	pods, removed, _ = filterUnconfirmedPendingPods("default", nodeGroup, []*v1.Pod{scheduled, first, second}, mockClock.Now())
+	assert.Equal(t, []*v1.Pod{scheduled}, pods)
+	assert.Equal(t, 2, removed)
+
+	// the first pod has been pending for longer than the delay
+	mockClock.Add(11 * duration.Second)
+	pods, removed, _ = filterUnconfirmedPendingPods("default", nodeGroup, []*v1.Pod{scheduled, first, second}, mockClock.Now())
+	assert.Equal(t, []*v1.Pod{scheduled, first}, pods)
+	assert.Equal(t, 1, removed)
+
+	// pods that are no longer pending are forgotten
+	pods, removed, _ = filterUnconfirmedPendingPods("default", nodeGroup, []*v1.Pod{scheduled}, mockClock.Now())
+	assert.Equal(t, []*v1.Pod{scheduled}, pods)
+	assert.Equal(t, 0, removed)
+	assert.Empty(t, nodeGroup.pendingSince)
+}
+
+func TestFilterUnconfirmedPendingPodsDisabled(t *testing.T) {
+	nodeGroup := &NodeGroupState{
+		Opts: NodeGroupOptions{
+			Name: "default",
+		},
+	}
+
+	pending := buildTestPods(3, 100, 100)
+	pods, removed, _ := filterUnconfirmedPendingPods("default", nodeGroup, pending, duration.Now())
+	assert.Equal(t, pending, pods)
+	assert.Equal(t, 0, removed)
+}
+
+func TestFilterUnconfirmedPendingPodsEmergency(t *testing.T) {
+	mockClock := newManualClock(duration.Now())
+
+	nodeGroup := &NodeGroupState{
+		Opts: NodeGroupOptions{
+			Name:                     "default",
+			ScaleUpConfirmationDelay: "10m",
+			EmergencyPendingTimeout:  "2m",
+		},
+	}
+	pending := test.BuildTestPod(test.PodOpts{Name: "pending"})
+
+	pods, removed, emergency := filterUnconfirmedPendingPods("default", nodeGroup, []*v1.Pod{pending}, mockClock.Now())
+	assert.Empty(t, pods)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, 0, emergency)
+
+	// pods pending for longer than the emergency timeout count before the confirmation delay has passed
+	mockClock.Add(2 * duration.Minute)
+	pods, removed, emergency = filterUnconfirmedPendingPods("default", nodeGroup, []*v1.Pod{pending}, mockClock.Now())
+	assert.Equal(t, []*v1.Pod{pending}, pods)
+	assert.Equal(t, 0, removed)
+	assert.Equal(t, 1, emergency)
+}
+
+func TestControllerEmergencyScaleUp(t *testing.T) {
+	mockClock := newManualClock(duration.Now())
+
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		ScaleUpCoolDownPeriod:              "10m",
+		EmergencyPendingTimeout:            "2m",
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(20, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+	opts.Clock = mockClock
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	nodeGroup := nodeGroupsState["default"]
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// a scale up that is still on its way had requested a single node
+	nodeGroup.scaleUpLock.lock(1, mockClock.Now())
+	delta, err := controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delta)
+	assert.Equal(t, int64(2), testNodeGroup.TargetSize())
+
+	// once the pods have been pending for the emergency timeout the cool down is bypassed, less the requested node
+	mockClock.Add(2 * duration.Minute)
+	before := testutil.ToFloat64(metrics.NodeGroupEmergencyScaleUps.WithLabelValues("default"))
+	delta, err = controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.Equal(t, 3, delta)
+	assert.Equal(t, int64(5), testNodeGroup.TargetSize())
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.NodeGroupEmergencyScaleUps.WithLabelValues("default")))
+	assert.Equal(t, 4, nodeGroup.scaleUpLock.requestedNodes)
+
+	// the nodes already requested cover the pending pods
+	delta, err = controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.Equal(t, 4, delta)
+	assert.Equal(t, int64(5), testNodeGroup.TargetSize())
+}
+
+func TestControllerEmergencyScaleUpCoolDown(t *testing.T) {
+	mockClock := newManualClock(duration.Now())
+
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		ScaleUpCoolDownPeriod:              "10m",
+		EmergencyPendingTimeout:            "2m",
+		EmergencyScaleUpCoolDownPeriod:     "5m",
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(20, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+	opts.Clock = mockClock
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	nodeGroup := nodeGroupsState["default"]
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// a scale up that is still on its way had requested a single node
+	nodeGroup.scaleUpLock.lock(1, mockClock.Now())
+	_, err := controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+
+	before := testutil.ToFloat64(metrics.NodeGroupEmergencyScaleUps.WithLabelValues("default"))
+	mockClock.Add(2 * duration.Minute)
+	delta, err := controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.Equal(t, 3, delta)
+	assert.Equal(t, int64(5), testNodeGroup.TargetSize())
+
+	// only one of the requested nodes is still on its way, but the emergency cool down leaves the normal scale lock
+	// in charge
+	nodeGroup.scaleUpLock.unlock(mockClock.Now())
+	nodeGroup.scaleUpLock.lock(1, mockClock.Now())
+	mockClock.Add(duration.Minute)
+	delta, err = controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delta)
+	assert.Equal(t, int64(5), testNodeGroup.TargetSize())
+
+	// once the emergency cool down has passed the normal scale lock is bypassed again
+	mockClock.Add(4 * duration.Minute)
+	delta, err = controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.Equal(t, 3, delta)
+	assert.Equal(t, int64(8), testNodeGroup.TargetSize())
+	assert.Equal(t, before+2, testutil.ToFloat64(metrics.NodeGroupEmergencyScaleUps.WithLabelValues("default")))
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// NodeGroupPlan is the scale decision a scan would make for a node group
+type NodeGroupPlan struct {
+	NodeGroup string
+	Delta     int
+	Decision  string
+	Error     string
+}
+
+// String returns a human readable description of the plan
+func (p NodeGroupPlan) String() string {
+	if len(p.Error) > 0 {
+		return fmt.Sprintf("%v (delta %v, error: %v)", p.Decision, p.Delta, p.Error)
+	}
+	return fmt.Sprintf("%v (delta %v)", p.Decision, p.Delta)
+}
+
+// NodeGroupPlanDifference is a node group that would act differently between two plans
+// Current or Proposed is nil if the node group only exists in one of the plans
+type NodeGroupPlanDifference struct {
+	NodeGroup string
+	Current   *NodeGroupPlan
+	Proposed  *NodeGroupPlan
+}
+
+// Plan calculates the scale decision each node group would make in a scan, without performing any scale actions
+// The controller is created paused and in dry mode, so nothing in the cluster or cloud provider is changed
+func Plan(opts Opts, stopChan <-chan struct{}) ([]NodeGroupPlan, error) {
+	opts.DryMode = true
+	opts.Paused = true
+	opts.ReconcileOnStartup = false
+
+	c, err := NewController(opts, stopChan)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.cloudProvider.Refresh(); err != nil {
+		return nil, errors.Wrap(err, "failed to refresh cloud provider")
+	}
+	return c.plan(), nil
+}
+
+// plan calculates the scale decision of each node group. The controller must be paused so no actions are performed
+func (c *Controller) plan() []NodeGroupPlan {
+	names := c.nodeGroupNames()
+	plans := make([]NodeGroupPlan, 0, len(names))
+	for _, nodegroup := range names {
+		delta, err := c.scaleNodeGroup(nodegroup, c.nodeGroups[nodegroup])
+		plan := NodeGroupPlan{
+			NodeGroup: nodegroup,
+			Delta:     delta,
+			Decision:  scaleDecision(delta),
+		}
+		if err != nil {
+			plan.Error = err.Error()
+		}
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
+// DiffPlans returns the node groups that would act differently between the current and proposed plans
+// in the order of the current plan followed by any node groups only in the proposed plan
+func DiffPlans(current, proposed []NodeGroupPlan) []NodeGroupPlanDifference {
+	proposedByName := make(map[string]*NodeGroupPlan, len(proposed))
+	for i := range proposed {
+		proposedByName[proposed[i].NodeGroup] = &proposed[i]
+	}
+
+	var differences []NodeGroupPlanDifference
+	seen := make(map[string]bool, len(current))
+	for i := range current {
+		currentPlan := &current[i]
+		seen[currentPlan.NodeGroup] = true
+		proposedPlan, ok := proposedByName[currentPlan.NodeGroup]
+		if ok && *proposedPlan == *currentPlan {
+			continue
+		}
+		differences = append(differences, NodeGroupPlanDifference{
+			NodeGroup: currentPlan.NodeGroup,
+			Current:   currentPlan,
+			Proposed:  proposedPlan,
+		})
+	}
+	for i := range proposed {
+		if !seen[proposed[i].NodeGroup] {
+			differences = append(differences, NodeGroupPlanDifference{
+				NodeGroup: proposed[i].NodeGroup,
+				Proposed:  &proposed[i],
+			})
+		}
+	}
+	return differences
+}
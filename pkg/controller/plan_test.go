@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestControllerPlan(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		FastNodeRemovalRate:                2,
+		SlowNodeRemovalRate:                1,
+		SoftDeleteGracePeriod:              "1m",
+		HardDeleteGracePeriod:              "10m",
+		ScaleUpCoolDownPeriod:              "1m",
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	// 150% utilisation
+	pods := buildTestPods(6, 500, 500)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      nil,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+	controller.Pause()
+	defer controller.Resume()
+
+	plans := controller.plan()
+	assert.Equal(t, []NodeGroupPlan{{NodeGroup: "default", Delta: 3, Decision: "scale_up"}}, plans)
+
+	// nothing was changed
+	assert.Equal(t, int64(len(nodes)), testNodeGroup.TargetSize())
+	for _, action := range opts.K8SClient.(*fake.Clientset).Actions() {
+		assert.Contains(t, []string{"get", "list"}, action.GetVerb())
+	}
+}
+
+func TestDiffPlans(t *testing.T) {
+	current := []NodeGroupPlan{
+		{NodeGroup: "same", Delta: 1, Decision: "scale_up"},
+		{NodeGroup: "different", Delta: 0, Decision: "none"},
+		{NodeGroup: "removed", Delta: -1, Decision: "scale_down"},
+	}
+	proposed := []NodeGroupPlan{
+		{NodeGroup: "added", Delta: 2, Decision: "scale_up"},
+		{NodeGroup: "different", Delta: -2, Decision: "scale_down"},
+		{NodeGroup: "same", Delta: 1, Decision: "scale_up"},
+	}
+
+	differences := DiffPlans(current, proposed)
+	assert.Equal(t, []NodeGroupPlanDifference{
+		{NodeGroup: "different", Current: &current[1], Proposed: &proposed[1]},
+		{NodeGroup: "removed", Current: &current[2]},
+		{NodeGroup: "added", Proposed: &proposed[0]},
+	}, differences)
+
+	assert.Empty(t, DiffPlans(current, current))
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	// PreTerminationFailurePolicyFail doesn't terminate a node until the pre-termination webhook succeeds for it
+	PreTerminationFailurePolicyFail = "fail"
+	// PreTerminationFailurePolicyIgnore terminates a node even if the pre-termination webhook fails for it
+	PreTerminationFailurePolicyIgnore = "ignore"
+)
+
+// preTerminationRequest is the body POSTed to the pre-termination webhook for a node about to be terminated
+type preTerminationRequest struct {
+	NodeGroup        string `json:"node_group"`
+	Node             string `json:"node"`
+	ProviderID       string `json:"provider_id"`
+	InstanceType     string `json:"instance_type,omitempty"`
+	AvailabilityZone string `json:"availability_zone,omitempty"`
+}
+
+// runPreTerminationWebhook calls the pre_termination_webhook of the node group for all of the nodes at once, each call
+// bounded by pre_termination_webhook_timeout and the scan timeout. Returns the nodes that can be terminated. Nodes the
+// webhook fails for are left out with the fail policy, staying tainted so the webhook is called again in a later scan.
+// Nodes whose call is cut short by the scan timeout are always left out, whatever the policy
+func (c *Controller) runPreTerminationWebhook(ctx context.Context, nodeGroup *NodeGroupState, nodes []*v1.Node) []*v1.Node {
+	if len(nodeGroup.Opts.PreTerminationWebhook) == 0 {
+		return nodes
+	}
+
+	ctx, cancel := c.scanContext(ctx)
+	defer cancel()
+	client := &http.Client{Timeout: nodeGroup.Opts.PreTerminationWebhookTimeoutDuration()}
+	errs := make([]error, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *v1.Node) {
+			defer wg.Done()
+			errs[i] = callPreTerminationWebhook(ctx, client, nodeGroup.Opts.PreTerminationWebhook, nodeGroup.preTerminationRequest(node))
+		}(i, node)
+	}
+	wg.Wait()
+
+	policy := nodeGroup.Opts.PreTerminationWebhookFailurePolicyOrDefault()
+	approved := make([]*v1.Node, 0, len(nodes))
+	for i, node := range nodes {
+		err := errs[i]
+		if err == nil {
+			approved = append(approved, node)
+			continue
+		}
+		if ctx.Err() != nil {
+			nodeGroup.nodeLog(node).WithError(err).Warningf("Pre-termination webhook for node %v cut short by the scan timeout. Not terminating it until the next scan", node.Name)
+			continue
+		}
+
+		metrics.NodeGroupPreTerminationWebhookFailures.WithLabelValues(nodeGroup.Opts.Name, policy).Inc()
+		if policy == PreTerminationFailurePolicyIgnore {
+			nodeGroup.nodeLog(node).WithError(err).Warningf("Pre-termination webhook failed for node %v. Terminating it anyway as the failure policy is %v", node.Name, policy)
+			approved = append(approved, node)
+			continue
+		}
+		nodeGroup.nodeLog(node).WithError(err).Warningf("Pre-termination webhook failed for node %v. Not terminating it until the webhook succeeds", node.Name)
+	}
+	return approved
+}
+
+// preTerminationRequest creates the webhook request of the node, including the metadata of its instance if known
+func (n *NodeGroupState) preTerminationRequest(node *v1.Node) preTerminationRequest {
+	metadata := n.instanceMetadata[node.Name]
+	return preTerminationRequest{
+		NodeGroup:        n.Opts.Name,
+		Node:             node.Name,
+		ProviderID:       node.Spec.ProviderID,
+		InstanceType:     metadata.InstanceType,
+		AvailabilityZone: metadata.AvailabilityZone,
+	}
+}
+
+// callPreTerminationWebhook POSTs the JSON encoded request to the webhook
+// returns an error if the webhook can't be reached, times out, the context is done or it responds without a 2xx status
+func callPreTerminationWebhook(ctx context.Context, client *http.Client, webhook string, request preTerminationRequest) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode pre-termination webhook request: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create pre-termination webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to call pre-termination webhook: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("pre-termination webhook returned %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+)
+
+func TestRunPreTerminationWebhook(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		delay         time.Duration
+		failurePolicy string
+		wantApproved  int
+	}{
+		{"webhook succeeds", http.StatusOK, 0, "", 2},
+		{"webhook fails with the default fail policy", http.StatusInternalServerError, 0, "", 0},
+		{"webhook fails with the ignore policy", http.StatusInternalServerError, 0, PreTerminationFailurePolicyIgnore, 2},
+		{"webhook times out with the fail policy", http.StatusOK, 200 * time.Millisecond, PreTerminationFailurePolicyFail, 0},
+		{"webhook times out with the ignore policy", http.StatusOK, 200 * time.Millisecond, PreTerminationFailurePolicyIgnore, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lock sync.Mutex
+			var requests []preTerminationRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var request preTerminationRequest
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+				lock.Lock()
+				requests = append(requests, request)
+				lock.Unlock()
+				time.Sleep(tt.delay)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			nodes := []*v1.Node{
+				test.BuildTestNode(test.NodeOpts{Name: "node-1"}),
+				test.BuildTestNode(test.NodeOpts{Name: "node-2"}),
+			}
+			nodes[0].Spec.ProviderID = "aws:///us-east-1a/i-1"
+			nodeGroup := &NodeGroupState{
+				Opts: NodeGroupOptions{
+					Name:                               "default",
+					PreTerminationWebhook:              server.URL,
+					PreTerminationWebhookTimeout:       "50ms",
+					PreTerminationWebhookFailurePolicy: tt.failurePolicy,
+				},
+				instanceMetadata: map[string]cloudprovider.InstanceMetadata{
+					"node-1": {InstanceType: "m5.large", AvailabilityZone: "us-east-1a"},
+				},
+			}
+
+			controller := &Controller{}
+			approved := controller.runPreTerminationWebhook(context.Background(), nodeGroup, nodes)
+			assert.Len(t, approved, tt.wantApproved)
+			// wait for the handlers of any timed out requests to return
+			server.Close()
+
+			// the webhook is called for every node at once, with the details of its instance
+			require.Len(t, requests, 2)
+			sort.Slice(requests, func(i, j int) bool { return requests[i].Node < requests[j].Node })
+			assert.Equal(t, preTerminationRequest{
+				NodeGroup:        "default",
+				Node:             "node-1",
+				ProviderID:       "aws:///us-east-1a/i-1",
+				InstanceType:     "m5.large",
+				AvailabilityZone: "us-east-1a",
+			}, requests[0])
+			assert.Equal(t, preTerminationRequest{NodeGroup: "default", Node: "node-2", ProviderID: "node-2"}, requests[1])
+		})
+	}
+}
+
+func TestRunPreTerminationWebhookNotConfigured(t *testing.T) {
+	nodes := []*v1.Node{test.BuildTestNode(test.NodeOpts{Name: "node"})}
+	controller := &Controller{}
+	assert.Equal(t, nodes, controller.runPreTerminationWebhook(context.Background(), &NodeGroupState{Opts: NodeGroupOptions{Name: "default"}}, nodes))
+}
+
+func TestRunPreTerminationWebhookScanTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	nodes := []*v1.Node{test.BuildTestNode(test.NodeOpts{Name: "node"})}
+	nodeGroup := &NodeGroupState{Opts: NodeGroupOptions{
+		Name:                               "default",
+		PreTerminationWebhook:              server.URL,
+		PreTerminationWebhookTimeout:       "10s",
+		PreTerminationWebhookFailurePolicy: PreTerminationFailurePolicyIgnore,
+	}}
+
+	// a call cut short by the scan timeout doesn't terminate the node, even with the ignore policy
+	controller := &Controller{scanDeadline: time.Now().Add(50 * time.Millisecond)}
+	start := time.Now()
+	assert.Empty(t, controller.runPreTerminationWebhook(context.Background(), nodeGroup, nodes))
+	assert.True(t, time.Since(start) < 10*time.Second)
+}
+
+func TestControllerTryRemoveTaintedNodesPreTerminationWebhook(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		wantRemoved int
+	}{
+		{"node is deleted once the webhook succeeds", http.StatusOK, -1},
+		{"node is not deleted while the webhook fails", http.StatusServiceUnavailable, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			nodeGroupOpts := NodeGroupOptions{
+				Name:                   "default",
+				CloudProviderGroupName: "default",
+				MinNodes:               0,
+				MaxNodes:               10,
+				SoftDeleteGracePeriod:  "1m",
+				HardDeleteGracePeriod:  "10m",
+				PreTerminationWebhook:  server.URL,
+			}
+			nodes := []*v1.Node{test.BuildTestNode(test.NodeOpts{
+				Name:    "node",
+				CPU:     1000,
+				Mem:     1000,
+				Tainted: true,
+			})}
+			client, opts := buildTestClient(nodes, nil, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+			mockClock := newManualClock(time.Now())
+			opts.Clock = mockClock
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 0, 10, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+				client:     *client,
+			})
+			nodeGroupsState["default"].NodeInfoMap = k8s.CreateNodeNameToInfoMap(nil, nodes)
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			mockClock.Add(5 * time.Minute)
+
+			removed, err := controller.TryRemoveTaintedNodes(scaleOpts{
+				nodes:        nodes,
+				taintedNodes: nodes,
+				nodeGroup:    nodeGroupsState["default"],
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRemoved, removed)
+			assert.Equal(t, int64(len(nodes)+tt.wantRemoved), testNodeGroup.TargetSize())
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	"github.com/atlassian/escalator/pkg/metrics"
+)
+
+// metricSourceSQS is the source label of the metric source healthy metric for the length of the node group's queue
+const metricSourceSQS = "sqs"
+
+// calcQueueScaleDelta returns the change in the number of nodes needed to keep the length of the node group's queue at
+// sqs_target_messages_per_node messages per node. Whether the queue length could be read is kept in
+// metricSourceUnhealthy so the node group doesn't scale down whilst it doesn't know how many messages are left
+func (c *Controller) calcQueueScaleDelta(nodegroup string, nodeGroup *NodeGroupState, nodeCount int) (int, error) {
+	queueLength, err := c.queueLength(nodeGroup)
+	if err != nil {
+		nodeGroup.metricSourceUnhealthy = true
+		metrics.MetricSourceHealthy.WithLabelValues(nodegroup, metricSourceSQS).Set(0)
+		return 0, err
+	}
+	metrics.MetricSourceHealthy.WithLabelValues(nodegroup, metricSourceSQS).Set(1)
+	metrics.NodeGroupQueueLength.WithLabelValues(nodegroup).Set(float64(queueLength))
+
+	return calcQueueNodesNeeded(queueLength, nodeGroup.Opts.SQSTargetMessagesPerNode) - nodeCount, nil
+}
+
+// queueLength reads the length of the node group's queue from the cloud provider
+func (c *Controller) queueLength(nodeGroup *NodeGroupState) (int64, error) {
+	provider, ok := c.cloudProvider.(cloudprovider.QueueLengthProvider)
+	if !ok {
+		return 0, fmt.Errorf("cloud provider %v does not support scaling on queue length", c.cloudProvider.Name())
+	}
+	return provider.QueueLength(nodeGroup.Opts.SQSQueueURL)
+}
+
+// calcQueueNodesNeeded returns the number of nodes needed for the queue to have at most targetMessagesPerNode
+// messages per node
+func calcQueueNodesNeeded(queueLength int64, targetMessagesPerNode int) int {
+	return int(math.Ceil(float64(queueLength) / float64(targetMessagesPerNode)))
+}
@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalcQueueNodesNeeded(t *testing.T) {
+	tests := []struct {
+		name                  string
+		queueLength           int64
+		targetMessagesPerNode int
+		want                  int
+	}{
+		{"empty queue", 0, 10, 0},
+		{"exact multiple", 40, 10, 4},
+		{"rounds up", 41, 10, 5},
+		{"less than one node", 3, 10, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, calcQueueNodesNeeded(tt.queueLength, tt.targetMessagesPerNode))
+		})
+	}
+}
+
+func TestScaleNodeGroup_QueueScaling(t *testing.T) {
+	queueURL := "https://sqs.us-east-1.amazonaws.com/123456789012/jobs"
+	tests := []struct {
+		name          string
+		queueLength   int64
+		queueExists   bool
+		pods          int
+		expectedDelta int
+	}{
+		// 50% utilisation is between the taint thresholds, the queue needs 10 nodes
+		{"queue needs more nodes", 100, true, 10, 6},
+		// the queue needs fewer nodes than utilisation, so the utilisation delta of the slow removal rate is used
+		{"queue needs fewer nodes", 10, true, 10, -2},
+		// the queue length can't be read, so the node group doesn't scale down on utilisation alone
+		{"queue length unavailable", 0, false, 10, 0},
+		// the queue length can't be read, so the node group scales up on utilisation alone
+		{"queue length unavailable scales up on utilisation", 0, false, 20, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           1,
+				MaxNodes:                           100,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 60,
+				FastNodeRemovalRate:                4,
+				SlowNodeRemovalRate:                2,
+				SoftDeleteGracePeriod:              "1m",
+				HardDeleteGracePeriod:              "10m",
+				ScaleUpCoolDownPeriod:              "1m",
+				SQSQueueURL:                        queueURL,
+				SQSTargetMessagesPerNode:           10,
+			}}
+			nodes := buildTestNodes(4, 1000, 1000)
+			pods := buildTestPods(tt.pods, 200, 200)
+			client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 1, 100, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+			if tt.queueExists {
+				testCloudProvider.SetQueueLength(queueURL, tt.queueLength)
+			}
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDelta, nodesDelta)
+
+			healthy := float64(0)
+			if tt.queueExists {
+				healthy = 1
+			}
+			assert.Equal(t, healthy, testutil.ToFloat64(metrics.MetricSourceHealthy.WithLabelValues("default", metricSourceSQS)))
+			assert.Equal(t, !tt.queueExists, nodeGroupsState["default"].metricSourceUnhealthy)
+		})
+	}
+}
+
+func TestScaleNodeGroup_QueueSourceRecovers(t *testing.T) {
+	queueURL := "https://sqs.us-east-1.amazonaws.com/123456789012/jobs"
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           100,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		FastNodeRemovalRate:                4,
+		SlowNodeRemovalRate:                2,
+		SoftDeleteGracePeriod:              "1m",
+		HardDeleteGracePeriod:              "10m",
+		ScaleUpCoolDownPeriod:              "1m",
+		SQSQueueURL:                        queueURL,
+		SQSTargetMessagesPerNode:           10,
+	}}
+	nodes := buildTestNodes(4, 1000, 1000)
+	pods := buildTestPods(10, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 100, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// the scale down is suppressed whilst the queue length can't be read
+	nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+	require.NoError(t, err)
+	assert.Equal(t, 0, nodesDelta)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.NodeGroupScaleDownBlocked.WithLabelValues("default", scaleDownBlockedMetricSourceUnhealthy)))
+
+	// the node group scales down on utilisation again once the queue is readable and doesn't need more nodes
+	testCloudProvider.SetQueueLength(queueURL, 0)
+	nodesDelta, err = controller.scaleNodeGroup("default", nodeGroupsState["default"])
+	require.NoError(t, err)
+	assert.Equal(t, -2, nodesDelta)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.MetricSourceHealthy.WithLabelValues("default", metricSourceSQS)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.NodeGroupScaleDownBlocked.WithLabelValues("default", scaleDownBlockedMetricSourceUnhealthy)))
+}
+
+func TestScaleNodeGroup_QueueScalingFromZero(t *testing.T) {
+	queueURL := "https://sqs.us-east-1.amazonaws.com/123456789012/jobs"
+	tests := []struct {
+		name          string
+		queueLength   int64
+		queueExists   bool
+		expectedDelta int
+		expectErr     bool
+	}{
+		{"queue needs nodes", 25, true, 3, false},
+		// there is nothing to scale up for, so the node group is left without nodes
+		{"empty queue", 0, true, 0, true},
+		{"queue length unavailable", 0, false, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           0,
+				MaxNodes:                           100,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 60,
+				FastNodeRemovalRate:                4,
+				SlowNodeRemovalRate:                2,
+				SoftDeleteGracePeriod:              "1m",
+				HardDeleteGracePeriod:              "10m",
+				ScaleUpCoolDownPeriod:              "1m",
+				SQSQueueURL:                        queueURL,
+				SQSTargetMessagesPerNode:           10,
+			}}
+			client, opts := buildTestClient(nil, nil, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 0, 100, 0)
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+			if tt.queueExists {
+				testCloudProvider.SetQueueLength(queueURL, tt.queueLength)
+			}
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			if tt.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedDelta, nodesDelta)
+			assert.Equal(t, int64(tt.expectedDelta), testNodeGroup.TargetSize())
+
+			// the scale up lock holds the node group until the new nodes have registered
+			if tt.expectedDelta > 0 {
+				nodesDelta, err = controller.scaleNodeGroup("default", nodeGroupsState["default"])
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedDelta, nodesDelta)
+				assert.Equal(t, int64(tt.expectedDelta), testNodeGroup.TargetSize())
+			}
+		})
+	}
+}
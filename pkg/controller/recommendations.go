@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	duration "time"
+
+	"github.com/atlassian/escalator/pkg/k8s"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	// recommendationWindow is the number of scans of each node group the recommendations are based on
+	// 12 hours at the default scan interval
+	recommendationWindow = 720
+	// recommendationMinSamples is the number of scans needed before a node group gets any recommendations
+	recommendationMinSamples = 30
+	// recommendationPendingPercent is the percentage of scans with pending pods above which the node group is
+	// considered to be scaling up too late
+	recommendationPendingPercent = 25
+	// recommendationFlapPercent is the percentage of scans both scaling up and scaling down above which the node group
+	// is considered to be flapping
+	recommendationFlapPercent = 10
+	// recommendationThresholdStep is how many percent the thresholds are suggested to be moved by
+	recommendationThresholdStep = 10
+)
+
+// utilizationSample is the state of a node group when its scale decision was made in a scan
+type utilizationSample struct {
+	// percent is the larger of the cpu and memory utilization the decision was made on
+	percent float64
+	// pendingPods is the number of pods counted towards the utilization that weren't scheduled onto a node
+	pendingPods int
+	// locked is whether the scan waited for the scale up cool down
+	locked bool
+	// delta is the number of nodes the node group needed to scale by
+	delta int
+	// atMinNodes is whether the node group had no more untainted nodes than min_nodes
+	atMinNodes bool
+}
+
+// countPendingPods returns the number of pods that aren't scheduled onto a node
+func countPendingPods(pods []*v1.Pod) int {
+	pending := 0
+	for _, pod := range pods {
+		if len(pod.Spec.NodeName) == 0 && !k8s.PodIsTerminated(pod) {
+			pending++
+		}
+	}
+	return pending
+}
+
+// utilizationHistory is the most recent samples of a node group, with the options they were taken with
+type utilizationHistory struct {
+	opts    NodeGroupOptions
+	samples []utilizationSample
+}
+
+// utilizationHistories holds the utilization history of each node group
+// it is updated by the scans and read by the /recommendations endpoint
+type utilizationHistories struct {
+	sync.Mutex
+	nodeGroups map[string]*utilizationHistory
+}
+
+// record adds a sample to the history of the node group, dropping the oldest sample once the window is full
+func (h *utilizationHistories) record(opts NodeGroupOptions, sample utilizationSample) {
+	h.Lock()
+	defer h.Unlock()
+	if h.nodeGroups == nil {
+		h.nodeGroups = make(map[string]*utilizationHistory)
+	}
+	history, ok := h.nodeGroups[opts.Name]
+	if !ok {
+		history = &utilizationHistory{}
+		h.nodeGroups[opts.Name] = history
+	}
+	history.opts = opts
+	history.samples = append(history.samples, sample)
+	if len(history.samples) > recommendationWindow {
+		history.samples = append(history.samples[:0], history.samples[len(history.samples)-recommendationWindow:]...)
+	}
+}
+
+// remove forgets the history of a node group that is no longer scanned
+func (h *utilizationHistories) remove(nodegroup string) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.nodeGroups, nodegroup)
+}
+
+// recommend returns the statistics and recommendations of every node group sorted by node group
+func (h *utilizationHistories) recommend() []nodeGroupRecommendations {
+	h.Lock()
+	defer h.Unlock()
+	recommendations := make([]nodeGroupRecommendations, 0, len(h.nodeGroups))
+	for name, history := range h.nodeGroups {
+		recommendations = append(recommendations, history.recommend(name))
+	}
+	sort.Slice(recommendations, func(i, j int) bool {
+		return recommendations[i].NodeGroup < recommendations[j].NodeGroup
+	})
+	return recommendations
+}
+
+// utilizationStats are the statistics of a node group over the recommendation window
+type utilizationStats struct {
+	Samples        int     `json:"samples"`
+	MinUtilization float64 `json:"min_utilization_percent"`
+	MaxUtilization float64 `json:"max_utilization_percent"`
+	AvgUtilization float64 `json:"avg_utilization_percent"`
+	// PendingScans is the percentage of scans with pending pods
+	PendingScans float64 `json:"pending_scans_percent"`
+	// LockedPendingScans is the percentage of scans with pending pods that waited for the scale up cool down
+	LockedPendingScans float64 `json:"locked_pending_scans_percent"`
+	ScaleUpScans       float64 `json:"scale_up_scans_percent"`
+	ScaleDownScans     float64 `json:"scale_down_scans_percent"`
+}
+
+// recommendation is an advisory change to a node group option
+type recommendation struct {
+	Option    string `json:"option"`
+	Current   string `json:"current"`
+	Suggested string `json:"suggested,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// nodeGroupRecommendations are the recommendations of a node group, served by the /recommendations endpoint
+type nodeGroupRecommendations struct {
+	NodeGroup       string           `json:"node_group"`
+	Stats           utilizationStats `json:"stats"`
+	Recommendations []recommendation `json:"recommendations"`
+}
+
+// stats calculates the statistics of the samples in the history
+func (h *utilizationHistory) stats() utilizationStats {
+	stats := utilizationStats{Samples: len(h.samples)}
+	if len(h.samples) == 0 {
+		return stats
+	}
+	stats.MinUtilization = h.samples[0].percent
+	var sum float64
+	var pending, lockedPending, scaleUps, scaleDowns int
+	for _, sample := range h.samples {
+		if sample.percent < stats.MinUtilization {
+			stats.MinUtilization = sample.percent
+		}
+		if sample.percent > stats.MaxUtilization {
+			stats.MaxUtilization = sample.percent
+		}
+		sum += sample.percent
+		if sample.pendingPods > 0 {
+			pending++
+			if sample.locked {
+				lockedPending++
+			}
+		}
+		switch {
+		case sample.locked:
+		case sample.delta > 0:
+			scaleUps++
+		case sample.delta < 0:
+			scaleDowns++
+		}
+	}
+	percentOfSamples := func(count int) float64 {
+		return float64(count) / float64(len(h.samples)) * 100
+	}
+	stats.AvgUtilization = sum / float64(len(h.samples))
+	stats.PendingScans = percentOfSamples(pending)
+	stats.LockedPendingScans = percentOfSamples(lockedPending)
+	stats.ScaleUpScans = percentOfSamples(scaleUps)
+	stats.ScaleDownScans = percentOfSamples(scaleDowns)
+	return stats
+}
+
+// recommend suggests changes to the options of the node group from the statistics of its history
+// no recommendations are made until there are recommendationMinSamples samples
+func (h *utilizationHistory) recommend(nodegroup string) nodeGroupRecommendations {
+	stats := h.stats()
+	result := nodeGroupRecommendations{
+		NodeGroup:       nodegroup,
+		Stats:           stats,
+		Recommendations: make([]recommendation, 0),
+	}
+	if stats.Samples < recommendationMinSamples {
+		return result
+	}
+	opts := h.opts
+
+	// pods are often pending before the node group scales up, leave more slack
+	if stats.PendingScans > recommendationPendingPercent {
+		rec := recommendation{
+			Option:  "scale_up_threshold_percent",
+			Current: fmt.Sprint(opts.ScaleUpThresholdPercent),
+			Reason:  fmt.Sprintf("pods were pending on %.0f%% of scans, a lower threshold leaves more slack capacity", stats.PendingScans),
+		}
+		if suggested := opts.ScaleUpThresholdPercent - recommendationThresholdStep; suggested > opts.TaintUpperCapacityThresholdPercent {
+			rec.Suggested = fmt.Sprint(suggested)
+		}
+		result.Recommendations = append(result.Recommendations, rec)
+	}
+
+	// pods are often pending whilst the node group waits for the cool down
+	if stats.LockedPendingScans > recommendationPendingPercent {
+		rec := recommendation{
+			Option:  "scale_up_cool_down_period",
+			Current: opts.ScaleUpCoolDownPeriod,
+			Reason:  fmt.Sprintf("pods were pending whilst waiting for the scale up cool down on %.0f%% of scans", stats.LockedPendingScans),
+		}
+		if coolDown := opts.ScaleUpCoolDownPeriodDuration(); coolDown > 0 {
+			rec.Suggested = (coolDown / 2).Round(duration.Second).String()
+		}
+		result.Recommendations = append(result.Recommendations, rec)
+	}
+
+	// the node group keeps scaling up and down, widen the gap between the thresholds
+	if stats.ScaleUpScans > recommendationFlapPercent && stats.ScaleDownScans > recommendationFlapPercent {
+		rec := recommendation{
+			Option:  "taint_upper_capacity_threshold_percent",
+			Current: fmt.Sprint(opts.TaintUpperCapacityThresholdPercent),
+			Reason: fmt.Sprintf("the node group scaled up on %.0f%% and down on %.0f%% of scans, a larger gap below scale_up_threshold_percent reduces flapping",
+				stats.ScaleUpScans, stats.ScaleDownScans),
+		}
+		if suggested := opts.TaintUpperCapacityThresholdPercent - recommendationThresholdStep; suggested > opts.TaintLowerCapacityThresholdPercent {
+			rec.Suggested = fmt.Sprint(suggested)
+		}
+		result.Recommendations = append(result.Recommendations, rec)
+	}
+
+	// the node group never needs all of its minimum nodes
+	atMinNodes := true
+	for _, sample := range h.samples {
+		atMinNodes = atMinNodes && sample.atMinNodes
+	}
+	if atMinNodes && opts.MinNodes > 0 && stats.MaxUtilization < float64(opts.TaintLowerCapacityThresholdPercent) {
+		result.Recommendations = append(result.Recommendations, recommendation{
+			Option:  "min_nodes",
+			Current: fmt.Sprint(opts.MinNodes),
+			Reason:  fmt.Sprintf("the utilization stayed below taint_lower_capacity_threshold_percent at min_nodes, peaking at %.0f%%", stats.MaxUtilization),
+		})
+	}
+	return result
+}
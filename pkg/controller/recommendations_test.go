@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUtilizationHistoriesRecord(t *testing.T) {
+	var histories utilizationHistories
+	opts := NodeGroupOptions{Name: "default"}
+	for i := 0; i < recommendationWindow+10; i++ {
+		histories.record(opts, utilizationSample{percent: float64(i)})
+	}
+
+	// only the most recent samples are kept
+	stats := histories.nodeGroups["default"].stats()
+	assert.Equal(t, recommendationWindow, stats.Samples)
+	assert.Equal(t, float64(10), stats.MinUtilization)
+	assert.Equal(t, float64(recommendationWindow+9), stats.MaxUtilization)
+
+	histories.remove("default")
+	assert.Empty(t, histories.recommend())
+}
+
+func TestUtilizationHistoryRecommend(t *testing.T) {
+	opts := NodeGroupOptions{
+		Name:                               "default",
+		MinNodes:                           3,
+		ScaleUpThresholdPercent:            70,
+		TaintUpperCapacityThresholdPercent: 50,
+		TaintLowerCapacityThresholdPercent: 30,
+		ScaleUpCoolDownPeriod:              "10m",
+	}
+	repeat := func(sample utilizationSample, count int) []utilizationSample {
+		samples := make([]utilizationSample, count)
+		for i := range samples {
+			samples[i] = sample
+		}
+		return samples
+	}
+
+	tests := []struct {
+		name    string
+		samples []utilizationSample
+		want    []recommendation
+	}{
+		{
+			"too few samples",
+			repeat(utilizationSample{percent: 90, pendingPods: 5, delta: 2}, recommendationMinSamples-1),
+			[]recommendation{},
+		},
+		{
+			"steady utilization",
+			repeat(utilizationSample{percent: 60}, 100),
+			[]recommendation{},
+		},
+		{
+			"frequently pending",
+			append(repeat(utilizationSample{percent: 90, pendingPods: 5, delta: 2}, 30), repeat(utilizationSample{percent: 60}, 70)...),
+			[]recommendation{{
+				Option:    "scale_up_threshold_percent",
+				Current:   "70",
+				Suggested: "60",
+				Reason:    "pods were pending on 30% of scans, a lower threshold leaves more slack capacity",
+			}},
+		},
+		{
+			"pending during the cool down",
+			append(repeat(utilizationSample{percent: 90, pendingPods: 5, locked: true}, 30), repeat(utilizationSample{percent: 60}, 70)...),
+			[]recommendation{
+				{
+					Option:    "scale_up_threshold_percent",
+					Current:   "70",
+					Suggested: "60",
+					Reason:    "pods were pending on 30% of scans, a lower threshold leaves more slack capacity",
+				},
+				{
+					Option:    "scale_up_cool_down_period",
+					Current:   "10m",
+					Suggested: "5m0s",
+					Reason:    "pods were pending whilst waiting for the scale up cool down on 30% of scans",
+				},
+			},
+		},
+		{
+			"flapping",
+			append(repeat(utilizationSample{percent: 75, delta: 1}, 20), repeat(utilizationSample{percent: 45, delta: -1}, 20)...),
+			[]recommendation{{
+				Option:    "taint_upper_capacity_threshold_percent",
+				Current:   "50",
+				Suggested: "40",
+				Reason:    "the node group scaled up on 50% and down on 50% of scans, a larger gap below scale_up_threshold_percent reduces flapping",
+			}},
+		},
+		{
+			"idle at min nodes",
+			repeat(utilizationSample{percent: 10, atMinNodes: true}, 50),
+			[]recommendation{{
+				Option:  "min_nodes",
+				Current: "3",
+				Reason:  "the utilization stayed below taint_lower_capacity_threshold_percent at min_nodes, peaking at 10%",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := &utilizationHistory{opts: opts, samples: tt.samples}
+			got := history.recommend("default")
+			assert.Equal(t, "default", got.NodeGroup)
+			assert.Equal(t, len(tt.samples), got.Stats.Samples)
+			assert.Equal(t, tt.want, got.Recommendations)
+		})
+	}
+}
+
+func TestControllerRecordsUtilization(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		ScaleUpCoolDownPeriod:              "1m",
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(10, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// the first scan scales up for the unscheduled pods, the second waits for the scale up cool down
+	for i := 0; i < 2; i++ {
+		_, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+		require.NoError(t, err)
+	}
+
+	mux := http.NewServeMux()
+	controller.RegisterHandlers(mux)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/recommendations", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var recommendations []nodeGroupRecommendations
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &recommendations))
+	require.Len(t, recommendations, 1)
+	assert.Equal(t, "default", recommendations[0].NodeGroup)
+	assert.Equal(t, utilizationStats{
+		Samples:            2,
+		MinUtilization:     100,
+		MaxUtilization:     100,
+		AvgUtilization:     100,
+		PendingScans:       100,
+		LockedPendingScans: 50,
+		ScaleUpScans:       50,
+	}, recommendations[0].Stats)
+	assert.Empty(t, recommendations[0].Recommendations)
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/recommendations", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// reconcileNodeGroups performs a one-time correction of every node group so that its node count is within
+// min_nodes and max_nodes. It is intended to be run once on startup to recover from manual drift.
+// The scale lock is not checked during this pass, so cooldowns are effectively disabled.
+func (c *Controller) reconcileNodeGroups() {
+	for _, nodegroup := range c.nodeGroupNames() {
+		state := c.nodeGroups[nodegroup]
+		if state.Opts.Frozen {
+			log.WithField("nodegroup", nodegroup).Info("Node group is frozen. Skipping startup reconcile")
+			continue
+		}
+		if err := c.reconcileNodeGroup(nodegroup, state); err != nil {
+			log.WithField("nodegroup", nodegroup).WithError(err).Warning("Startup reconcile failed")
+		}
+	}
+}
+
+// reconcileNodeGroup brings a single node group within its min_nodes and max_nodes
+func (c *Controller) reconcileNodeGroup(nodegroup string, nodeGroup *NodeGroupState) error {
+	allNodes, err := nodeGroup.Nodes.List()
+	if err != nil {
+		log.Errorf("Failed to list nodes: %v", err)
+		return err
+	}
+
+	// nodes another tool is deleting are left to it
+	allNodes, _ = filterExternalDeletionNodes(allNodes, nodeGroup.Opts.ExternalDeletionTaints)
+
+	untaintedNodes, taintedNodes, _ := c.filterNodes(nodeGroup, allNodes)
+	opts := scaleOpts{
+		nodes:          allNodes,
+		taintedNodes:   taintedNodes,
+		untaintedNodes: untaintedNodes,
+		nodeGroup:      nodeGroup,
+	}
+
+	switch {
+	case len(allNodes) < nodeGroup.Opts.MinNodes:
+		opts.nodesDelta = nodeGroup.Opts.MinNodes - len(allNodes)
+		opts.reason = fmt.Sprintf("startup reconcile: node count of %v is less than min_nodes of %v", len(allNodes), nodeGroup.Opts.MinNodes)
+		log.WithField("nodegroup", nodegroup).Infof(
+			"Startup reconcile: node count of %v less than minimum of %v. Scaling up by %v",
+			len(allNodes),
+			nodeGroup.Opts.MinNodes,
+			opts.nodesDelta,
+		)
+		added, err := c.ScaleUp(opts)
+		if err != nil {
+			return err
+		}
+		log.WithField("nodegroup", nodegroup).Infof("Startup reconcile: added %v nodes", added)
+	case len(allNodes) > nodeGroup.Opts.MaxNodes:
+		// nodes that are already tainted will be removed by the reaper, so only taint the remainder
+		nodeGroup.reconcilingAboveMax = true
+		opts.nodesDelta = len(allNodes) - nodeGroup.Opts.MaxNodes - len(taintedNodes)
+		if opts.nodesDelta <= 0 {
+			log.WithField("nodegroup", nodegroup).Info("Startup reconcile: enough nodes already tainted to reach maximum. No action needed")
+			return nil
+		}
+		log.WithField("nodegroup", nodegroup).Infof(
+			"Startup reconcile: node count of %v larger than maximum of %v. Scaling down by %v",
+			len(allNodes),
+			nodeGroup.Opts.MaxNodes,
+			opts.nodesDelta,
+		)
+		tainted, err := c.scaleDownTaint(opts)
+		if err != nil {
+			return err
+		}
+		log.WithField("nodegroup", nodegroup).Infof("Startup reconcile: tainted %v nodes", tainted)
+	default:
+		log.WithField("nodegroup", nodegroup).Info("Startup reconcile: node count within min and max. No action needed")
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	duration "time"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileNodeGroup(t *testing.T) {
+	tests := []struct {
+		name            string
+		initialNodes    int
+		minNodes        int
+		maxNodes        int
+		wantTargetSize  int64
+		wantTaintedSize int
+	}{
+		{
+			"less than min nodes. scale up to min",
+			2,
+			5,
+			10,
+			5,
+			0,
+		},
+		{
+			"more than max nodes. taint down to max",
+			8,
+			1,
+			5,
+			8,
+			3,
+		},
+		{
+			"within min and max. do nothing",
+			5,
+			1,
+			10,
+			5,
+			0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                   "default",
+				CloudProviderGroupName: "default",
+				MinNodes:               tt.minNodes,
+				MaxNodes:               tt.maxNodes,
+				ScaleUpCoolDownPeriod:  "1h",
+			}}
+			nodes := buildTestNodes(tt.initialNodes, 1000, 1000)
+			client, opts := buildTestClient(nodes, buildTestPods(0, 0, 0), nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup(
+				"default",
+				int64(tt.minNodes),
+				int64(tt.maxNodes),
+				int64(len(nodes)),
+			)
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			err := controller.reconcileNodeGroup("default", nodeGroupsState["default"])
+			require.NoError(t, err)
+
+			_, tainted, _ := controller.filterNodes(nodeGroupsState["default"], nodes)
+			assert.Equal(t, tt.wantTargetSize, testNodeGroup.TargetSize())
+			assert.Equal(t, tt.wantTaintedSize, len(tainted))
+		})
+	}
+}
+
+func TestScaleNodeGroupAboveMaxNodes(t *testing.T) {
+	tests := []struct {
+		name      string
+		reconcile bool
+		// withinMaxFirst is whether a scan sees the node group within max_nodes before it goes above it again
+		withinMaxFirst bool
+		want           int64
+	}{
+		{"without the startup reconcile nothing is deleted", false, false, 8},
+		// the empty tainted nodes are deleted
+		{"the nodes tainted by the startup reconcile are deleted", true, false, 5},
+		{"the startup reconcile isn't repeated once the node group is within the maximum", true, true, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClock := newManualClock(duration.Now())
+
+			nodeGroups := []NodeGroupOptions{{
+				Name:                   "default",
+				CloudProviderGroupName: "default",
+				MinNodes:               1,
+				MaxNodes:               5,
+				SoftDeleteGracePeriod:  "1m",
+				HardDeleteGracePeriod:  "10m",
+			}}
+			// three of the nodes above the maximum are tainted
+			nodes := append(buildTestNodes(5, 1000, 1000), test.BuildTestNodes(3, test.NodeOpts{CPU: 1000, Mem: 1000, Tainted: true})...)
+			for i, node := range nodes {
+				node.Name = fmt.Sprintf("node-%v", i)
+			}
+			client, opts := buildTestClient(nodes, buildTestPods(0, 0, 0), nodeGroups, ListerOptions{})
+			opts.Clock = mockClock
+			opts.ReconcileOnStartup = tt.reconcile
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 1, 5, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			if tt.reconcile {
+				// enough nodes are already tainted, so the startup reconcile leaves them to the reaper
+				require.NoError(t, controller.reconcileNodeGroup("default", nodeGroupsState["default"]))
+				assert.Equal(t, int64(8), testNodeGroup.TargetSize())
+			}
+			if tt.withinMaxFirst {
+				// the maximum is raised for a scan, before the tainted nodes pass their grace periods
+				nodeGroupsState["default"].Opts.MaxNodes = 10
+				_, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+				require.NoError(t, err)
+				nodeGroupsState["default"].Opts.MaxNodes = 5
+			}
+
+			mockClock.Add(5 * duration.Minute)
+			_, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			assert.EqualError(t, err, "node count larger than the maximum")
+			assert.Equal(t, tt.want, testNodeGroup.TargetSize())
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// reloadState holds node group options waiting to be applied before the next scan
+type reloadState struct {
+	sync.Mutex
+	pending []NodeGroupOptions
+	// scanInterval is the reloaded scan interval, 0 if it hasn't been reloaded since the last scan
+	scanInterval time.Duration
+}
+
+// ReloadNodeGroups queues new node group options to be applied at the start of the next scan
+// the options should already be validated. Only the latest options are kept if called more than once between scans
+// It is safe to call whilst a scan is running, the scan finishes with the options it started with. The options are
+// copied, so the caller can keep using the slice
+func (c *Controller) ReloadNodeGroups(nodeGroups []NodeGroupOptions) {
+	pending := make([]NodeGroupOptions, len(nodeGroups))
+	copy(pending, nodeGroups)
+
+	c.reload.Lock()
+	defer c.reload.Unlock()
+	c.reload.pending = pending
+	log.Info("Node group options reloaded. They will be applied on the next scan")
+}
+
+// ReloadScanInterval queues a new scan interval to be used from the start of the next scan
+func (c *Controller) ReloadScanInterval(interval time.Duration) {
+	c.reload.Lock()
+	defer c.reload.Unlock()
+	c.reload.scanInterval = interval
+}
+
+// applyPendingReload applies any node group options queued by ReloadNodeGroups and scan interval queued by
+// ReloadScanInterval
+// the existing options are kept if the new options can't be applied without a restart. Only called by the scan
+// goroutine between scans, so the options are never swapped part way through a scan
+func (c *Controller) applyPendingReload() {
+	c.reload.Lock()
+	nodeGroups := c.reload.pending
+	c.reload.pending = nil
+	scanInterval := c.reload.scanInterval
+	c.reload.scanInterval = 0
+	c.reload.Unlock()
+
+	if scanInterval > 0 && scanInterval != c.Opts.ScanInterval {
+		log.Infof("Scan interval changed from %v to %v", c.Opts.ScanInterval, scanInterval)
+		c.Opts.ScanInterval = scanInterval
+	}
+	if nodeGroups == nil {
+		return
+	}
+	if err := c.applyNodeGroupOptions(nodeGroups); err != nil {
+		log.WithError(err).Error("Failed to apply reloaded node group options. Keeping the existing options")
+		metrics.ConfigReloadFailures.Inc()
+		return
+	}
+	c.publishConfig()
+	c.applyNodeGroupLogLevels()
+	log.Info("Applied reloaded node group options")
+}
+
+// applyNodeGroupOptions swaps the options of the existing node groups for the new options, keeping their runtime state
+// such as the scale lock, scale up times and drain timers. Adding, removing or renaming node groups, or changing the
+// options used to find their pods, nodes and cloud provider node groups, requires a restart
+func (c *Controller) applyNodeGroupOptions(nodeGroups []NodeGroupOptions) error {
+	if len(nodeGroups) != len(c.Opts.NodeGroups) {
+		return errors.Errorf("the number of node groups changed from %v to %v. adding or removing node groups requires a restart", len(c.Opts.NodeGroups), len(nodeGroups))
+	}
+	templates := make(map[string]bool)
+	for _, nodeGroupOpts := range c.Opts.NodeGroups {
+		if nodeGroupOpts.AutoDiscoveryEnabled() {
+			templates[nodeGroupOpts.Name] = true
+		}
+	}
+	for _, nodeGroupOpts := range nodeGroups {
+		// auto discovery node groups only need to exist, their options are applied to the discovered node groups
+		// by the next discovery
+		if nodeGroupOpts.AutoDiscoveryEnabled() != templates[nodeGroupOpts.Name] {
+			return errors.Errorf("adding, removing or renaming auto discovery node group %v requires a restart", nodeGroupOpts.Name)
+		}
+		if nodeGroupOpts.AutoDiscoveryEnabled() {
+			continue
+		}
+
+		state, ok := c.nodeGroups[nodeGroupOpts.Name]
+		if !ok {
+			return errors.Errorf("node group %v does not exist. adding or renaming node groups requires a restart", nodeGroupOpts.Name)
+		}
+		if nodeGroupOpts.LabelKey != state.Opts.LabelKey ||
+			nodeGroupOpts.LabelValue != state.Opts.LabelValue ||
+			nodeGroupOpts.CloudProviderGroupName != state.Opts.CloudProviderGroupName {
+			return errors.Errorf("changing label_key, label_value or cloud_provider_group_name of node group %v requires a restart", nodeGroupOpts.Name)
+		}
+	}
+
+	for i := range nodeGroups {
+		nodeGroupOpts := &nodeGroups[i]
+		if nodeGroupOpts.AutoDiscoveryEnabled() {
+			continue
+		}
+		state := c.nodeGroups[nodeGroupOpts.Name]
+
+		// keep the min_nodes and max_nodes discovered from the cloud provider on startup
+		if nodeGroupOpts.autoDiscoverMinMaxNodeOptions() {
+			nodeGroupOpts.MinNodes = state.Opts.MinNodes
+			nodeGroupOpts.MaxNodes = state.Opts.MaxNodes
+		}
+
+		state.Opts = *nodeGroupOpts
+		state.scaleUpLock.minimumLockDuration = nodeGroupOpts.ScaleUpCoolDownPeriodDuration()
+	}
+	c.Opts.NodeGroups = nodeGroups
+	return nil
+}
@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadNodeGroups(t *testing.T) {
+	nodeGroupOptions := NodeGroupOptions{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		FastNodeRemovalRate:                2,
+		SlowNodeRemovalRate:                1,
+		SoftDeleteGracePeriod:              "1m",
+		HardDeleteGracePeriod:              "10m",
+		ScaleUpCoolDownPeriod:              "1m",
+	}
+	nodeGroups := []NodeGroupOptions{nodeGroupOptions}
+	nodes := buildTestNodes(2, 1000, 1000)
+	// 75% utilisation
+	pods := buildTestPods(3, 500, 500)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      nil,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// raise the scale up threshold above the utilisation, the next scan should no longer scale up
+	lastScaleUp := time.Now()
+	nodeGroupsState["default"].lastScaleUp = lastScaleUp
+	reloaded := nodeGroupOptions
+	reloaded.ScaleUpThresholdPercent = 80
+	reloaded.ScaleUpCoolDownPeriod = "5m"
+	controller.ReloadNodeGroups([]NodeGroupOptions{reloaded})
+
+	// not applied until the next scan
+	assert.Equal(t, 70, nodeGroupsState["default"].Opts.ScaleUpThresholdPercent)
+
+	require.NoError(t, controller.RunOnce())
+	assert.Equal(t, 80, nodeGroupsState["default"].Opts.ScaleUpThresholdPercent)
+	assert.Equal(t, 80, controller.Opts.NodeGroups[0].ScaleUpThresholdPercent)
+	assert.Equal(t, 0, nodeGroupsState["default"].scaleDelta)
+	assert.Equal(t, int64(len(nodes)), testNodeGroup.TargetSize())
+	assert.Equal(t, reloaded.ScaleUpCoolDownPeriodDuration(), nodeGroupsState["default"].scaleUpLock.minimumLockDuration)
+	// runtime state is kept
+	assert.Equal(t, lastScaleUp, nodeGroupsState["default"].lastScaleUp)
+
+	// lower it back below the utilisation, the next scan should scale up again
+	controller.ReloadNodeGroups([]NodeGroupOptions{nodeGroupOptions})
+	require.NoError(t, controller.RunOnce())
+	assert.Equal(t, 1, nodeGroupsState["default"].scaleDelta)
+	assert.Equal(t, int64(len(nodes)+1), testNodeGroup.TargetSize())
+}
+
+func TestReloadScanInterval(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MinNodes:               1,
+		MaxNodes:               10,
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	client, opts := buildTestClient(nodes, nil, nodeGroups, ListerOptions{})
+	opts.ScanInterval = time.Minute
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testCloudProvider.RegisterNodeGroup(test.NewNodeGroup("default", 1, 10, int64(len(nodes))))
+
+	controller := &Controller{
+		Client:   client,
+		Opts:     opts,
+		stopChan: nil,
+		nodeGroups: BuildNodeGroupsState(nodeGroupsStateOpts{
+			nodeGroups: nodeGroups,
+			client:     *client,
+		}),
+		cloudProvider: testCloudProvider,
+	}
+
+	controller.ReloadScanInterval(30 * time.Second)
+
+	// not applied until the next scan
+	assert.Equal(t, time.Minute, controller.Opts.ScanInterval)
+
+	require.NoError(t, controller.RunOnce())
+	assert.Equal(t, 30*time.Second, controller.Opts.ScanInterval)
+
+	// a scan without a reload keeps the reloaded interval
+	require.NoError(t, controller.RunOnce())
+	assert.Equal(t, 30*time.Second, controller.Opts.ScanInterval)
+}
+
+func TestReloadNodeGroupsRequiresRestart(t *testing.T) {
+	nodeGroupOptions := NodeGroupOptions{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MinNodes:               1,
+		MaxNodes:               10,
+	}
+	controller := &Controller{
+		Opts: Opts{NodeGroups: []NodeGroupOptions{nodeGroupOptions}},
+		nodeGroups: map[string]*NodeGroupState{
+			"default": {Opts: nodeGroupOptions},
+		},
+	}
+
+	renamed := nodeGroupOptions
+	renamed.Name = "renamed"
+	changedCloudProviderGroup := nodeGroupOptions
+	changedCloudProviderGroup.CloudProviderGroupName = "other"
+
+	tests := []struct {
+		name       string
+		nodeGroups []NodeGroupOptions
+	}{
+		{"node group added", []NodeGroupOptions{nodeGroupOptions, renamed}},
+		{"node group renamed", []NodeGroupOptions{renamed}},
+		{"cloud provider group changed", []NodeGroupOptions{changedCloudProviderGroup}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, controller.applyNodeGroupOptions(tt.nodeGroups))
+			assert.Equal(t, []NodeGroupOptions{nodeGroupOptions}, controller.Opts.NodeGroups)
+			assert.Equal(t, nodeGroupOptions, controller.nodeGroups["default"].Opts)
+		})
+	}
+}
+
+func TestApplyPendingReloadFailure(t *testing.T) {
+	nodeGroupOptions := NodeGroupOptions{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MinNodes:               1,
+		MaxNodes:               10,
+	}
+	controller := &Controller{
+		Opts: Opts{NodeGroups: []NodeGroupOptions{nodeGroupOptions}},
+		nodeGroups: map[string]*NodeGroupState{
+			"default": {Opts: nodeGroupOptions},
+		},
+	}
+
+	// a config read part way through an update is rejected as a whole and counted as a failure
+	failures := testutil.ToFloat64(metrics.ConfigReloadFailures)
+	changed := nodeGroupOptions
+	changed.MaxNodes = 20
+	renamed := nodeGroupOptions
+	renamed.Name = "renamed"
+	controller.ReloadNodeGroups([]NodeGroupOptions{changed, renamed})
+	controller.applyPendingReload()
+	assert.Equal(t, failures+1, testutil.ToFloat64(metrics.ConfigReloadFailures))
+	assert.Equal(t, nodeGroupOptions, controller.nodeGroups["default"].Opts)
+
+	// the next reload is still applied
+	controller.ReloadNodeGroups([]NodeGroupOptions{changed})
+	controller.applyPendingReload()
+	assert.Equal(t, failures+1, testutil.ToFloat64(metrics.ConfigReloadFailures))
+	assert.Equal(t, changed, controller.nodeGroups["default"].Opts)
+}
+
+func TestReloadNodeGroupsDuringScan(t *testing.T) {
+	nodeGroupOptions := NodeGroupOptions{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		FastNodeRemovalRate:                2,
+		SlowNodeRemovalRate:                1,
+		SoftDeleteGracePeriod:              "1m",
+		HardDeleteGracePeriod:              "10m",
+		ScaleUpCoolDownPeriod:              "1m",
+	}
+	nodeGroups := []NodeGroupOptions{nodeGroupOptions}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(3, 500, 500)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testCloudProvider.RegisterNodeGroup(test.NewNodeGroup("default", 1, 10, int64(len(nodes))))
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// reload from another goroutine the way the reload signal does, reusing the same slice every time
+	// run with -race to check the reloads don't race with the scans or the /config endpoint
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reloaded := []NodeGroupOptions{nodeGroupOptions}
+		for i := 0; i < 50; i++ {
+			reloaded[0].ScaleUpThresholdPercent = 71 + i%20
+			controller.ReloadNodeGroups(reloaded)
+			controller.config.get()
+		}
+		reloaded[0].ScaleUpThresholdPercent = 95
+		controller.ReloadNodeGroups(reloaded)
+		// changing the slice after reloading doesn't change the queued options
+		reloaded[0].ScaleUpThresholdPercent = 30
+	}()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, controller.RunOnce())
+	}
+	<-done
+
+	// the next scan picks up the latest reload
+	require.NoError(t, controller.RunOnce())
+	assert.Equal(t, 95, nodeGroupsState["default"].Opts.ScaleUpThresholdPercent)
+	assert.Equal(t, 95, controller.config.get()[0].ScaleUpThresholdPercent)
+}
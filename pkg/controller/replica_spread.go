@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"sort"
+
+	"github.com/atlassian/escalator/pkg/k8s"
+	"k8s.io/api/core/v1"
+)
+
+// replicaSpread is how the replicas of each ReplicaSet and StatefulSet are spread across the untainted nodes of a node
+// group and their zones, for protect_replica_spread to check that tainting a node leaves the replicas safely spread.
+// Only the pods in the node group are counted, so it is a best effort that complements pod disruption budgets
+type replicaSpread struct {
+	minReplicas int
+	// replicas of each workload
+	replicas map[string]int
+	// replicas of each workload in each zone, zones without replicas are left out
+	zoneReplicas map[string]map[string]int
+	// replicas of each workload on each node
+	nodeReplicas map[string]map[string]int
+}
+
+// newReplicaSpread counts the replicas on the nodes, leaving out daemonset, static and completed pods
+func newReplicaSpread(nodes []*v1.Node, nodeGroup *NodeGroupState) *replicaSpread {
+	spread := &replicaSpread{
+		minReplicas:  nodeGroup.Opts.ProtectReplicaSpreadMinReplicasOrDefault(),
+		replicas:     make(map[string]int),
+		zoneReplicas: make(map[string]map[string]int),
+		nodeReplicas: make(map[string]map[string]int),
+	}
+	for _, node := range nodes {
+		nodeInfo, ok := nodeGroup.NodeInfoMap[node.Name]
+		if !ok {
+			continue
+		}
+		zone := k8s.NodeZone(node)
+		for _, pod := range nodeInfo.Pods() {
+			if k8s.PodIsDaemonSet(pod) || k8s.PodIsStatic(pod) || k8s.PodIsTerminated(pod) {
+				continue
+			}
+			workload, ok := k8s.PodReplicaWorkload(pod)
+			if !ok {
+				continue
+			}
+			spread.replicas[workload]++
+			if len(zone) > 0 {
+				if spread.zoneReplicas[workload] == nil {
+					spread.zoneReplicas[workload] = make(map[string]int)
+				}
+				spread.zoneReplicas[workload][zone]++
+			}
+			if spread.nodeReplicas[node.Name] == nil {
+				spread.nodeReplicas[node.Name] = make(map[string]int)
+			}
+			spread.nodeReplicas[node.Name][workload]++
+		}
+	}
+	return spread
+}
+
+// unsafeWorkloads returns the workloads that tainting the node would leave with fewer than the min replicas, or
+// without replicas in the zone of the node when they have replicas in other zones
+func (s *replicaSpread) unsafeWorkloads(node *v1.Node) []string {
+	zone := k8s.NodeZone(node)
+	var workloads []string
+	for workload, onNode := range s.nodeReplicas[node.Name] {
+		if s.replicas[workload]-onNode < s.minReplicas {
+			workloads = append(workloads, workload)
+			continue
+		}
+		zones := s.zoneReplicas[workload]
+		if len(zone) > 0 && len(zones) > 1 && zones[zone]-onNode <= 0 {
+			workloads = append(workloads, workload)
+		}
+	}
+	sort.Strings(workloads)
+	return workloads
+}
+
+// remove stops counting the replicas on the node once it has been tainted
+func (s *replicaSpread) remove(node *v1.Node) {
+	zone := k8s.NodeZone(node)
+	for workload, onNode := range s.nodeReplicas[node.Name] {
+		s.replicas[workload] -= onNode
+		if zones := s.zoneReplicas[workload]; len(zone) > 0 && zones != nil {
+			zones[zone] -= onNode
+			if zones[zone] <= 0 {
+				delete(zones, zone)
+			}
+		}
+	}
+	delete(s.nodeReplicas, node.Name)
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReplicaSpreadUnsafeWorkloads(t *testing.T) {
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "node-1", LabelKey: k8s.ZoneLabel, LabelValue: "zone-a"}),
+		test.BuildTestNode(test.NodeOpts{Name: "node-2", LabelKey: k8s.ZoneLabel, LabelValue: "zone-a"}),
+		test.BuildTestNode(test.NodeOpts{Name: "node-3", LabelKey: k8s.ZoneLabelBeta, LabelValue: "zone-b"}),
+		test.BuildTestNode(test.NodeOpts{Name: "node-4"}),
+	}
+	controller := true
+	replicaOf := func(name string, node string, owner string) *v1.Pod {
+		pod := test.BuildTestPod(test.PodOpts{Name: name, Namespace: "default", NodeName: node})
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: owner, Controller: &controller}}
+		return pod
+	}
+	pods := []*v1.Pod{
+		replicaOf("web-1", "node-1", "web"),
+		replicaOf("web-2", "node-2", "web"),
+		replicaOf("web-3", "node-3", "web"),
+		replicaOf("worker-1", "node-1", "worker"),
+		replicaOf("worker-2", "node-4", "worker"),
+		test.BuildTestPod(test.PodOpts{Name: "unowned", NodeName: "node-4"}),
+	}
+	nodeGroup := &NodeGroupState{
+		Opts:        NodeGroupOptions{ProtectReplicaSpread: true},
+		NodeInfoMap: k8s.CreateNodeNameToInfoMap(pods, nodes),
+	}
+
+	spread := newReplicaSpread(nodes, nodeGroup)
+	assert.Empty(t, spread.unsafeWorkloads(nodes[0]))
+	assert.Equal(t, []string{"ReplicaSet/default/web"}, spread.unsafeWorkloads(nodes[2]))
+	// nodes without a zone only protect the min replicas
+	assert.Empty(t, spread.unsafeWorkloads(nodes[3]))
+
+	spread.remove(nodes[0])
+	assert.Equal(t, []string{"ReplicaSet/default/web"}, spread.unsafeWorkloads(nodes[1]))
+	assert.Equal(t, []string{"ReplicaSet/default/worker"}, spread.unsafeWorkloads(nodes[3]))
+
+	nodeGroup.Opts.ProtectReplicaSpreadMinReplicas = 3
+	spread = newReplicaSpread(nodes, nodeGroup)
+	assert.Equal(t, []string{"ReplicaSet/default/web", "ReplicaSet/default/worker"}, spread.unsafeWorkloads(nodes[0]))
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+)
+
+// EventReasonNodeGroupSaturated is the reason of the kubernetes event recorded when a node group is saturated
+const EventReasonNodeGroupSaturated = "NodeGroupSaturated"
+
+// maxNodesReachedError is returned when a scale up is refused because the cloud provider node group is at max_nodes
+type maxNodesReachedError struct {
+	targetSize int64
+	maxNodes   int
+}
+
+func (e *maxNodesReachedError) Error() string {
+	return fmt.Sprintf(
+		"refusing to scaleup up beyond the maximum size of the autoscaling group (TargetSize: %v; MaxNodes: %v). Taking no action",
+		e.targetSize,
+		e.maxNodes,
+	)
+}
+
+// updateSaturation tracks how long the scale ups of the node group have been blocked solely by max_nodes
+// once they have been blocked for longer than saturation_grace_period the node group is saturated. An error is logged,
+// a kubernetes event is recorded and the saturated metric is set, so it stands out from the scale ups that are only
+// clamped. The node group is no longer saturated after the first scan that doesn't need to scale up beyond max_nodes
+func (c *Controller) updateSaturation(nodegroup string, nodeGroup *NodeGroupState, blocked bool) {
+	if !blocked {
+		if nodeGroup.saturated {
+			log.WithField("nodegroup", nodegroup).Info("Node group is no longer saturated")
+		}
+		nodeGroup.saturatedSince = time.Time{}
+		nodeGroup.saturated = false
+		metrics.NodeGroupSaturated.WithLabelValues(nodegroup).Set(0)
+		return
+	}
+
+	now := c.clock().Now()
+	if nodeGroup.saturatedSince.IsZero() {
+		nodeGroup.saturatedSince = now
+	}
+	if nodeGroup.saturated || now.Sub(nodeGroup.saturatedSince) < nodeGroup.Opts.SaturationGracePeriodDuration() {
+		return
+	}
+
+	nodeGroup.saturated = true
+	metrics.NodeGroupSaturated.WithLabelValues(nodegroup).Set(1)
+	message := fmt.Sprintf(
+		"Node group %v needs more nodes but has been at max_nodes of %v for %v. Increase max_nodes or the cloud provider quota",
+		nodegroup,
+		nodeGroup.Opts.MaxNodes,
+		now.Sub(nodeGroup.saturatedSince),
+	)
+	log.WithField("nodegroup", nodegroup).WithField("saturated", true).Error(message)
+	if c.Opts.EventRecorder != nil && c.Opts.EventObject != nil {
+		c.Opts.EventRecorder.Event(c.Opts.EventObject, v1.EventTypeWarning, EventReasonNodeGroupSaturated, message)
+	}
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	duration "time"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestControllerSaturation(t *testing.T) {
+	mockClock := newManualClock(duration.Now())
+
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           2,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		SlowNodeRemovalRate:                1,
+		FastNodeRemovalRate:                1,
+		ScaleUpCoolDownPeriod:              "1m",
+		SoftDeleteGracePeriod:              "1m",
+		HardDeleteGracePeriod:              "10m",
+		SaturationGracePeriod:              "5m",
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(10, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+	opts.Clock = mockClock
+
+	recorder := record.NewFakeRecorder(10)
+	opts.EventRecorder = recorder
+	opts.EventObject = &v1.ObjectReference{Kind: "Pod", Namespace: "kube-system", Name: "escalator"}
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testCloudProvider.RegisterNodeGroup(test.NewNodeGroup("default", 1, 2, int64(len(nodes))))
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	nodeGroup := nodeGroupsState["default"]
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// scale ups blocked by max_nodes aren't saturated until the grace period has passed
+	_, err := controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.False(t, nodeGroup.saturated)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.NodeGroupSaturated.WithLabelValues("default")))
+	assert.Len(t, recorder.Events, 0)
+
+	mockClock.Add(6 * duration.Minute)
+	_, err = controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.True(t, nodeGroup.saturated)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.NodeGroupSaturated.WithLabelValues("default")))
+	require.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	assert.True(t, strings.HasPrefix(event, "Warning "+EventReasonNodeGroupSaturated+" "), event)
+
+	// the event is only recorded once whilst the node group stays saturated
+	mockClock.Add(duration.Minute)
+	_, err = controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.True(t, nodeGroup.saturated)
+	assert.Len(t, recorder.Events, 0)
+
+	// a scan that doesn't need to scale up beyond max_nodes clears it
+	controller.updateSaturation("default", nodeGroup, false)
+	assert.False(t, nodeGroup.saturated)
+	assert.True(t, nodeGroup.saturatedSince.IsZero())
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.NodeGroupSaturated.WithLabelValues("default")))
+}
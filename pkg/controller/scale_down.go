@@ -1,14 +1,18 @@
 package controller
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/atlassian/escalator/pkg/cloudprovider"
 	"github.com/atlassian/escalator/pkg/k8s"
 	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/tracing"
 	log "github.com/sirupsen/logrus"
-	time "github.com/stephanos/clock"
 	"k8s.io/api/core/v1"
 )
 
@@ -29,10 +33,70 @@ func (c *Controller) ScaleDown(opts scaleOpts) (int, error) {
 	return c.scaleDownTaint(opts)
 }
 
+// scaleDownDelayAfterAddRemaining returns how long scale down is still suppressed for after the last scale up
+// returns 0 or less if scale down is allowed
+func scaleDownDelayAfterAddRemaining(nodeGroup *NodeGroupState, now time.Time) time.Duration {
+	delay := nodeGroup.Opts.ScaleDownDelayAfterAddDuration()
+	if delay == 0 || nodeGroup.lastScaleUp.IsZero() {
+		return 0
+	}
+	return delay - now.Sub(nodeGroup.lastScaleUp)
+}
+
+// Reasons a scale down is suppressed, the reason label of the scale down blocked metric
+const (
+	scaleDownBlockedDelayAfterAdd = "scale_down_delay_after_add"
+	scaleDownBlockedMinReadyNodes = "min_ready_nodes_for_scale_down"
+	// scaleDownBlockedMetricSourceUnhealthy a metric source the node group scales on couldn't be read
+	scaleDownBlockedMetricSourceUnhealthy = "metric_source_unhealthy"
+)
+
+// scaleDownBlocked returns the reasons a scale down of the node group is suppressed
+// nodes are all of the nodes in the node group
+func scaleDownBlocked(nodeGroup *NodeGroupState, nodes []*v1.Node, now time.Time) []string {
+	var reasons []string
+	if remaining := scaleDownDelayAfterAddRemaining(nodeGroup, now); remaining > 0 {
+		log.WithField("nodegroup", nodeGroup.Opts.Name).Infof("Scale down delayed after scale up. Time remaining %v", remaining)
+		reasons = append(reasons, scaleDownBlockedDelayAfterAdd)
+	}
+	if ready := readyNodeCount(nodes); ready < nodeGroup.Opts.MinReadyNodesForScaleDown {
+		log.WithField("nodegroup", nodeGroup.Opts.Name).Infof("Scale down suppressed until %v nodes are Ready. %v nodes are Ready", nodeGroup.Opts.MinReadyNodesForScaleDown, ready)
+		reasons = append(reasons, scaleDownBlockedMinReadyNodes)
+	}
+	if nodeGroup.metricSourceUnhealthy {
+		log.WithField("nodegroup", nodeGroup.Opts.Name).Warning("Scale down suppressed until the metric sources the node group scales on can be read")
+		reasons = append(reasons, scaleDownBlockedMetricSourceUnhealthy)
+	}
+	return reasons
+}
+
+// setScaleDownBlockedMetric sets the scale down blocked metric of every reason, 1 if it is one of the reasons
+func setScaleDownBlockedMetric(nodegroup string, reasons []string) {
+	for _, reason := range []string{scaleDownBlockedDelayAfterAdd, scaleDownBlockedMinReadyNodes, scaleDownBlockedMetricSourceUnhealthy} {
+		value := 0.0
+		for _, blocked := range reasons {
+			if blocked == reason {
+				value = 1
+			}
+		}
+		metrics.NodeGroupScaleDownBlocked.WithLabelValues(nodegroup, reason).Set(value)
+	}
+}
+
 // TryRemoveTaintedNodes attempts to remove nodes are tainted and empty or have passed their grace period
-func (c *Controller) TryRemoveTaintedNodes(opts scaleOpts) (int, error) {
-	var toBeDeleted []*v1.Node
-	for _, candidate := range opts.taintedNodes {
+func (c *Controller) TryRemoveTaintedNodes(opts scaleOpts) (_ int, err error) {
+	ctx, span := tracing.StartSpan(opts.ctx, "TryRemoveTaintedNodes", tracing.String("nodegroup", opts.nodeGroup.Opts.Name))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	var readyToDelete, toBeDeleted []*v1.Node
+	// nodes being deleted only because they are empty, rather than having passed the hard grace period
+	deleteIfEmpty := make(map[string]bool)
+	draining := make(nodeTimes)
+	podsRemaining := make(map[string]int)
+	// the nodes waiting for node_shutdown_grace_period are tainted nodes already on their way to being deleted
+	candidates := make([]*v1.Node, 0, len(opts.taintedNodes)+len(opts.shuttingDownNodes))
+	candidates = append(append(candidates, opts.taintedNodes...), opts.shuttingDownNodes...)
+	for _, candidate := range candidates {
 		// if the time the node was tainted is larger than the hard period then it is deleted no matter what
 		// if the soft time is passed and the node is empty (excluding daemonsets) then it can be deleted
 		taintedTime, err := k8s.GetToBeRemovedTime(candidate)
@@ -41,13 +105,24 @@ func (c *Controller) TryRemoveTaintedNodes(opts scaleOpts) (int, error) {
 			continue
 		}
 
-		now := time.Now()
-		if now.Sub(*taintedTime) > opts.nodeGroup.Opts.SoftDeleteGracePeriodDuration() {
-			if k8s.NodeEmpty(candidate, opts.nodeGroup.NodeInfoMap) || now.Sub(*taintedTime) > opts.nodeGroup.Opts.HardDeleteGracePeriodDuration() {
+		// require_empty_before_delete nodes don't wait for the soft period, the node is deleted as soon as it is empty
+		// fast_delete_completed_jobs nodes don't wait for the soft period if every job that ran on them has completed
+		now := c.clock().Now()
+		if opts.nodeGroup.Opts.RequireEmptyBeforeDelete || now.Sub(*taintedTime) > opts.nodeGroup.Opts.SoftDeleteGracePeriodDuration() || c.nodeOnlyCompletedJobs(opts.nodeGroup, candidate) {
+			hardDeleteGracePeriodPassed := now.Sub(*taintedTime) > opts.nodeGroup.Opts.HardDeleteGracePeriodDuration()
+			if k8s.NodeEmpty(candidate, opts.nodeGroup.NodeInfoMap) || hardDeleteGracePeriodPassed {
 				drymode := c.dryMode(opts.nodeGroup)
-				log.WithField("drymode", drymode).Infof("Node %v, %v ready to be deleted", candidate.Name, candidate.Spec.ProviderID)
+				opts.nodeGroup.nodeLog(candidate).WithField("drymode", drymode).Infof("Node %v, %v ready to be deleted", candidate.Name, candidate.Spec.ProviderID)
 				if !drymode {
-					toBeDeleted = append(toBeDeleted, candidate)
+					// taint_only node groups leave the tainted nodes to be deleted once the node group is active
+					if opts.nodeGroup.Opts.ModeOrDefault() == NodeGroupModeTaintOnly {
+						opts.nodeGroup.nodeLog(candidate).Infof("Mode is %v. Would delete node %v, %v", NodeGroupModeTaintOnly, candidate.Name, candidate.Spec.ProviderID)
+						continue
+					}
+					readyToDelete = append(readyToDelete, candidate)
+					if !hardDeleteGracePeriodPassed {
+						deleteIfEmpty[candidate.Name] = true
+					}
 				}
 			} else {
 				nodePodsRemaining, ok := k8s.NodePodsRemaining(candidate, opts.nodeGroup.NodeInfoMap)
@@ -71,42 +146,272 @@ func (c *Controller) TryRemoveTaintedNodes(opts scaleOpts) (int, error) {
 		}
 	}
 
-	if len(toBeDeleted) > 0 {
-		podsRemaining := 0
-		for _, nodeToBeDeleted := range toBeDeleted {
-			nodePodsRemaining, ok := k8s.NodePodsRemaining(nodeToBeDeleted, opts.nodeGroup.NodeInfoMap)
-			if !ok {
-				continue
+	// cordon every node before draining any of them, so the evicted pods aren't scheduled onto the other nodes about to
+	// be drained. The cordons of the nodes that aren't deleted are reverted if the removal is aborted
+	var cordoned []*v1.Node
+	if opts.nodeGroup.Opts.CordonBeforeDrain {
+		cordoned = c.cordonNodes(opts.nodeGroup, readyToDelete)
+	}
+	deletedNodes := make(map[string]bool)
+	defer func() {
+		if err != nil {
+			c.revertCordons(opts.nodeGroup, cordoned, deletedNodes)
+		}
+	}()
+
+	for _, candidate := range readyToDelete {
+		// wait for the pods to terminate gracefully before terminating the node, if draining is enabled
+		if opts.nodeGroup.Opts.DrainTimeoutDuration() > 0 && !c.drainNode(ctx, opts.nodeGroup, candidate, draining, podsRemaining) {
+			continue
+		}
+		// give the pods the kubelet's graceful node shutdown window before terminating the node
+		if opts.nodeGroup.Opts.NodeShutdownGracePeriodDuration() > 0 && !c.awaitNodeShutdown(opts.nodeGroup, candidate) {
+			continue
+		}
+		toBeDeleted = append(toBeDeleted, candidate)
+	}
+
+	c.setDraining(opts.nodeGroup, draining, podsRemaining)
+
+	if len(toBeDeleted) == 0 {
+		return 0, nil
+	}
+	// the nodes stay tainted and are deleted in the next scan
+	if c.scanTimedOut() {
+		log.WithField("nodegroup", opts.nodeGroup.Opts.Name).Infof("Scan timed out. Not deleting %v nodes until the next scan", len(toBeDeleted))
+		c.revertCordons(opts.nodeGroup, cordoned, deletedNodes)
+		return 0, nil
+	}
+
+	// delete all the nodes at once unless the deletes are to be spaced out
+	interval := opts.nodeGroup.Opts.ScaleDownNodeDeleteIntervalDuration()
+	batchSize := len(toBeDeleted)
+	if interval > 0 {
+		batchSize = opts.nodeGroup.Opts.ScaleDownNodeDeleteBatchSizeOrDefault()
+	}
+
+	deleted := 0
+	for start := 0; start < len(toBeDeleted); start += batchSize {
+		if start > 0 {
+			log.WithField("nodegroup", opts.nodeGroup.Opts.Name).Infof("Waiting %v before deleting the next batch of nodes. %v nodes remaining", interval, len(toBeDeleted)-start)
+			select {
+			case <-c.clock().After(interval):
+			case <-c.scanTimeout():
+			case <-c.stopChan:
+				log.WithField("nodegroup", opts.nodeGroup.Opts.Name).Infof("Stopping. Not deleting the remaining %v nodes", len(toBeDeleted)-start)
+				c.revertCordons(opts.nodeGroup, cordoned, deletedNodes)
+				return -deleted, nil
+			}
+			if c.scanTimedOut() {
+				log.WithField("nodegroup", opts.nodeGroup.Opts.Name).Infof("Scan timed out. Not deleting the remaining %v nodes until the next scan", len(toBeDeleted)-start)
+				c.revertCordons(opts.nodeGroup, cordoned, deletedNodes)
+				return -deleted, nil
 			}
+			if c.scalingPaused(opts.nodeGroup) {
+				log.WithField("nodegroup", opts.nodeGroup.Opts.Name).Infof("Scaling is paused or the node group is frozen. Not deleting the remaining %v nodes", len(toBeDeleted)-start)
+				c.revertCordons(opts.nodeGroup, cordoned, deletedNodes)
+				return -deleted, nil
+			}
+		}
 
-			podsRemaining += nodePodsRemaining
+		end := start + batchSize
+		if end > len(toBeDeleted) {
+			end = len(toBeDeleted)
+		}
+		batch := c.removeNodesNoLongerEmpty(opts.nodeGroup, toBeDeleted[start:end], deleteIfEmpty)
+		if len(batch) == 0 {
+			continue
 		}
 
-		cloudProviderNodeGroup, ok := c.cloudProvider.GetNodeGroup(opts.nodeGroup.Opts.CloudProviderGroupName)
-		if !ok {
-			return 0, fmt.Errorf("cloud provider node group does not exist: %s", opts.nodeGroup.Opts.CloudProviderGroupName)
+		// the nodes over the global deletion rate stay tainted and are deleted in a later scan. A deletion is only taken
+		// from the rate for the nodes the pre-termination webhook approves
+		allowed := c.deletionLimiter.available(len(batch), c.clock().Now())
+		if allowed > 0 {
+			approved := c.runPreTerminationWebhook(ctx, opts.nodeGroup, batch[:allowed])
+			c.deletionLimiter.take(len(approved), c.clock().Now())
+			if len(approved) > 0 {
+				// only the nodes actually deleted are counted, the rest stay tainted and are retried in a later scan
+				removed, err := c.deleteNodes(ctx, opts.nodeGroup, approved, deleteIfEmpty)
+				for _, node := range removed {
+					c.drainFinished(opts.nodeGroup, node.Name)
+					deletedNodes[node.Name] = true
+				}
+				if len(removed) > 0 {
+					c.reportDrains(opts.nodeGroup)
+				}
+				deleted += len(removed)
+				if err != nil {
+					return -deleted, err
+				}
+			}
+		}
+		if allowed < len(batch) {
+			log.WithField("nodegroup", opts.nodeGroup.Opts.Name).Infof("Reached the maximum deletions per minute. Deferring the remaining %v nodes to the next scan", len(batch)-allowed+len(toBeDeleted)-end)
+			return -deleted, nil
 		}
+	}
 
-		// Terminate the nodes in the cloud provider
-		err := cloudProviderNodeGroup.DeleteNodes(toBeDeleted...)
-		if err != nil {
+	return -deleted, nil
+}
+
+// removeNodesNoLongerEmpty checks the nodes being deleted only because they are empty are still empty immediately
+// before deleting them, listing the pods again rather than using the snapshot taken at the start of the scan. This
+// stops a pod that was scheduled onto a node after the snapshot, e.g. just before the node was tainted, from being
+// evicted straight away. Returns the nodes that can still be deleted
+func (c *Controller) removeNodesNoLongerEmpty(nodeGroup *NodeGroupState, nodes []*v1.Node, deleteIfEmpty map[string]bool) []*v1.Node {
+	var recheck []*v1.Node
+	for _, node := range nodes {
+		if deleteIfEmpty[node.Name] {
+			recheck = append(recheck, node)
+		}
+	}
+	if len(recheck) == 0 {
+		return nodes
+	}
+
+	pods, err := nodeGroup.Pods.List()
+	if err != nil {
+		log.WithField("nodegroup", nodeGroup.Opts.Name).WithError(err).Warning("Failed to list pods to check nodes are still empty. Not deleting the empty nodes")
+	}
+	nodeInfoMap := k8s.CreateNodeNameToInfoMap(pods, recheck)
+
+	remaining := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if deleteIfEmpty[node.Name] {
+			if err != nil {
+				continue
+			}
+			if !k8s.NodeEmpty(node, nodeInfoMap) {
+				log.WithField("nodegroup", nodeGroup.Opts.Name).Infof("Node %v has had pods scheduled onto it since it was found empty. Not deleting", node.Name)
+				continue
+			}
+		}
+		remaining = append(remaining, node)
+	}
+	return remaining
+}
+
+// removeNodesNotOwned defensively leaves out the nodes that don't belong to the cloud provider node group, so a node
+// is only ever deleted from the cloud provider group it was launched in, and a node that doesn't belong doesn't fail the
+// deletion of the others. Returns the nodes that can still be deleted
+func removeNodesNotOwned(nodeGroup *NodeGroupState, cloudProviderNodeGroup cloudprovider.NodeGroup, nodes []*v1.Node) []*v1.Node {
+	remaining := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if !cloudProviderNodeGroup.Belongs(node) {
+			nodeGroup.nodeLog(node).Warningf("Node %v, %v doesn't belong to cloud provider node group %v. Not deleting", node.Name, node.Spec.ProviderID, cloudProviderNodeGroup.ID())
+			continue
+		}
+		remaining = append(remaining, node)
+	}
+	return remaining
+}
+
+// deleteNodes terminates the nodes in the cloud provider and then deletes them from kubernetes
+// deleteIfEmpty are the nodes being deleted only because they are empty, used for the reason in the audit log
+// returns the nodes that were deleted, which are only some of the nodes along with the error if the cloud provider
+// only terminated some of them
+func (c *Controller) deleteNodes(ctx context.Context, nodeGroup *NodeGroupState, toBeDeleted []*v1.Node, deleteIfEmpty map[string]bool) ([]*v1.Node, error) {
+	cloudProviderNodeGroup, ok := getCloudProviderNodeGroup(c.cloudProvider, nodeGroup.Opts)
+	if !ok {
+		return nil, fmt.Errorf("cloud provider node group does not exist: %s", nodeGroup.Opts.CloudProviderGroupName)
+	}
+
+	toBeDeleted = removeNodesNotOwned(nodeGroup, cloudProviderNodeGroup, toBeDeleted)
+	if len(toBeDeleted) == 0 {
+		return nil, nil
+	}
+
+	// Terminate the nodes in the cloud provider
+	_, deleteSpan := tracing.StartSpan(ctx, "CloudProviderDeleteNodes",
+		tracing.String("nodegroup", nodeGroup.Opts.Name),
+		tracing.Int("nodes", len(toBeDeleted)),
+	)
+	deleteErr := cloudProviderNodeGroup.DeleteNodes(toBeDeleted...)
+	tracing.EndSpan(deleteSpan, deleteErr)
+	if deleteErr != nil {
+		partial, ok := deleteErr.(*cloudprovider.PartialDeletionError)
+		if !ok {
 			for _, nodeToDelete := range toBeDeleted {
-				log.WithError(err).Errorf("failed to terminate node in cloud provider %v, %v", nodeToDelete.Name, nodeToDelete.Spec.ProviderID)
+				nodeGroup.nodeLog(nodeToDelete).WithError(deleteErr).Errorf("failed to terminate node in cloud provider %v, %v", nodeToDelete.Name, nodeToDelete.Spec.ProviderID)
 			}
-			return 0, err
+			return nil, deleteErr
 		}
+		// the nodes that weren't terminated stay tainted, so they are picked up again in a later scan
+		metrics.NodeGroupPartialDeletions.WithLabelValues(nodeGroup.Opts.Name).Inc()
+		for _, nodeToDelete := range partial.Failed {
+			nodeGroup.nodeLog(nodeToDelete).WithError(partial.Err).Errorf("failed to terminate node in cloud provider %v, %v. %v of the %v nodes were terminated",
+				nodeToDelete.Name, nodeToDelete.Spec.ProviderID, len(partial.Deleted), len(toBeDeleted))
+		}
+		toBeDeleted = partial.Deleted
+	}
+	c.auditNodesDeleted(nodeGroup, cloudProviderNodeGroup.ID(), toBeDeleted, deleteIfEmpty)
 
-		// Delete the nodes from kubernetes
-		err = k8s.DeleteNodes(toBeDeleted, c.Client)
-		if err != nil {
-			log.WithError(err).Errorf("failed to delete nodes from kubernetes")
-			return 0, err
+	podsRemaining := 0
+	for _, nodeToBeDeleted := range toBeDeleted {
+		nodePodsRemaining, ok := k8s.NodePodsRemaining(nodeToBeDeleted, nodeGroup.NodeInfoMap)
+		if !ok {
+			continue
 		}
-		log.Infof("Sent delete request to %v nodes", len(toBeDeleted))
-		metrics.NodeGroupPodsEvicted.WithLabelValues(opts.nodeGroup.Opts.Name).Add(float64(podsRemaining))
+
+		podsRemaining += nodePodsRemaining
 	}
 
-	return -len(toBeDeleted), nil
+	// Delete the nodes from kubernetes
+	if err := k8s.DeleteNodes(toBeDeleted, c.Client); err != nil {
+		log.WithError(err).Errorf("failed to delete nodes from kubernetes")
+		return nil, err
+	}
+	log.Infof("Sent delete request to %v nodes", len(toBeDeleted))
+	metrics.NodeGroupPodsEvicted.WithLabelValues(nodeGroup.Opts.Name).Add(float64(podsRemaining))
+	c.recordNodesRemoved(nodeGroup.Opts.Name, len(toBeDeleted))
+	return toBeDeleted, deleteErr
+}
+
+// nodeOnlyCompletedJobs returns if the node group fast deletes nodes whose jobs have completed and the only pods that
+// ran on the node, other than daemonsets, are completed jobs. The pods are listed from the api server, as the pod
+// watcher doesn't watch terminated pods, only for nodes that are empty of the pods it does watch
+func (c *Controller) nodeOnlyCompletedJobs(nodeGroup *NodeGroupState, node *v1.Node) bool {
+	if !nodeGroup.Opts.FastDeleteCompletedJobs || !k8s.NodeEmpty(node, nodeGroup.NodeInfoMap) {
+		return false
+	}
+	pods, err := k8s.ListNodePods(node, c.Client)
+	if err != nil {
+		nodeGroup.nodeLog(node).WithError(err).Warning("Failed to list the pods of the node to check for completed jobs")
+		return false
+	}
+	if !k8s.NodeOnlyCompletedJobs(node, pods) {
+		return false
+	}
+	nodeGroup.nodeLog(node).Infof("Node %v only ran jobs that have completed. Not waiting for soft_delete_grace_period", node.Name)
+	return true
+}
+
+// auditNodesDeleted records the nodes terminated in the cloud provider in the audit log and the event stream
+// separating the nodes deleted because they are empty from the nodes that passed the hard delete grace period
+func (c *Controller) auditNodesDeleted(nodeGroup *NodeGroupState, cloudProviderNodeGroup string, deleted []*v1.Node, deleteIfEmpty map[string]bool) {
+	var empty, hardDeleted []*v1.Node
+	for _, node := range deleted {
+		if deleteIfEmpty[node.Name] {
+			empty = append(empty, node)
+		} else {
+			hardDeleted = append(hardDeleted, node)
+		}
+	}
+	if len(empty) > 0 {
+		reason := "tainted node empty after soft_delete_grace_period"
+		if nodeGroup.Opts.RequireEmptyBeforeDelete {
+			reason = "tainted node empty with require_empty_before_delete"
+		} else if nodeGroup.Opts.FastDeleteCompletedJobs {
+			reason = "tainted node empty after soft_delete_grace_period or with only completed jobs with fast_delete_completed_jobs"
+		}
+		c.Opts.AuditLog.NodesDeleted(nodeGroup.Opts.Name, cloudProviderNodeGroup, empty, reason)
+		c.Opts.EventStream.Delete(nodeGroup.Opts.Name, nodeNames(empty), reason)
+	}
+	if len(hardDeleted) > 0 {
+		reason := "tainted node passed hard_delete_grace_period"
+		c.Opts.AuditLog.NodesDeleted(nodeGroup.Opts.Name, cloudProviderNodeGroup, hardDeleted, reason)
+		c.Opts.EventStream.Delete(nodeGroup.Opts.Name, nodeNames(hardDeleted), reason)
+	}
 }
 
 func (c *Controller) scaleDownTaint(opts scaleOpts) (int, error) {
@@ -130,6 +435,18 @@ func (c *Controller) scaleDownTaint(opts scaleOpts) (int, error) {
 		}
 	}
 
+	// Never taint more than the max scale down fraction of the Ready nodes in a single scan, whatever the delta
+	if maxTaints := maxScaleDownTaints(opts.nodes, opts.nodeGroup); nodesToRemove > maxTaints {
+		log.WithField("nodegroup", nodegroupName).Warningf(
+			"Scale down of %v nodes exceeds max_scale_down_fraction of %v Ready nodes. Clamping taint amount to %v",
+			nodesToRemove,
+			opts.nodeGroup.Opts.MaxScaleDownFractionOrDefault(),
+			maxTaints,
+		)
+		metrics.NodeGroupScaleDownClamped.WithLabelValues(nodegroupName).Add(1)
+		nodesToRemove = maxTaints
+	}
+
 	log.WithField("nodegroup", nodegroupName).Infof("Scaling Down: tainting %v nodes", nodesToRemove)
 	metrics.NodeGroupTaintEvent.WithLabelValues(nodegroupName).Add(float64(nodesToRemove))
 
@@ -148,44 +465,244 @@ func (c *Controller) scaleDownTaint(opts scaleOpts) (int, error) {
 	}
 
 	log.Infof("Tainted a total of %v nodes", len(tainted))
+	c.recordScaleDown(nodegroupName, len(tainted))
 	return len(tainted), nil
 }
 
-// taintOldestN sorts nodes by creation time and taints the oldest N. It will return an array of indices of the nodes it tainted
+// maxScaleDownTaints returns the most nodes that can be tainted in a single scan
+// the max scale down fraction of the Ready nodes, rounded down
+func maxScaleDownTaints(nodes []*v1.Node, nodeGroup *NodeGroupState) int {
+	return int(math.Floor(float64(readyNodeCount(nodes)) * nodeGroup.Opts.MaxScaleDownFractionOrDefault()))
+}
+
+// readyNodeCount returns the number of nodes with the Ready condition
+func readyNodeCount(nodes []*v1.Node) int {
+	var ready int
+	for _, node := range nodes {
+		if k8s.NodeIsReady(node) {
+			ready++
+		}
+	}
+	return ready
+}
+
+// taintOldestN sorts nodes by the node selection method, by default creation time, and taints the first N. It will return an array of indices of the nodes it tainted
 // indices are from the parameter nodes indexes, not the sorted index
 func (c *Controller) taintOldestN(nodes []*v1.Node, nodeGroup *NodeGroupState, n int) []int {
-	sorted := make(nodesByOldestCreationTime, 0, len(nodes))
-	for i, node := range nodes {
-		sorted = append(sorted, nodeIndexBundle{node, i})
+	sorted := sortNodesForTermination(nodes, nodeGroup.Opts.NodeSelectionMethod)
+
+	// prefer tainting the nodes that aren't running pods expected to outlast the hard delete grace period
+	now := c.clock().Now()
+	runsLongPods := make(map[string]bool, len(sorted))
+	for _, bundle := range sorted {
+		runsLongPods[bundle.node.Name] = nodeRunsLongPods(bundle.node, nodeGroup, now)
+	}
+	// then optionally the nodes running the fewest Ready pods, interrupting the least completed work
+	readyPods := make(map[string]int, len(sorted))
+	if nodeGroup.Opts.ScaleDownOrderByPodReadiness {
+		for _, bundle := range sorted {
+			readyPods[bundle.node.Name] = nodeReadyPodCount(bundle.node, nodeGroup)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		nodeI, nodeJ := sorted[i].node.Name, sorted[j].node.Name
+		if runsLongPods[nodeI] != runsLongPods[nodeJ] {
+			return !runsLongPods[nodeI]
+		}
+		return readyPods[nodeI] < readyPods[nodeJ]
+	})
+
+	// the replicas left on the nodes not yet tainted, so each taint is checked against the spread the earlier ones left
+	var spread *replicaSpread
+	if nodeGroup.Opts.ProtectReplicaSpread {
+		spread = newReplicaSpread(nodes, nodeGroup)
 	}
-	sort.Sort(sorted)
 
 	taintedIndices := make([]int, 0, n)
+	var taintedNames []string
+	// the nodes left untainted because they host pods with local storage or of workloads part way through a rollout, or
+	// because tainting them would leave replicas unsafely spread
+	var localStorageProtected, rolloutDeferred, replicaSpreadProtected int
 	for i, bundle := range sorted {
 		// stop at N (or when array is fully iterated)
 		if len(taintedIndices) >= n || i >= k8s.MaximumTaints {
 			break
 		}
 
+		// never choose a node cordoned by someone else, it's only terminated once escalator has tainted it
+		if bundle.node.Spec.Unschedulable {
+			log.WithField("nodegroup", nodeGroup.Opts.Name).Debugf("Not tainting cordoned node %v", bundle.node.Name)
+			continue
+		}
+
+		// churning the nodes under a rollout slows it down and risks the availability of the workload
+		if nodeGroup.Opts.DeferScaleDownDuringRollout {
+			if workloads := c.nodeRollingOutWorkloads(bundle.node, nodeGroup); len(workloads) > 0 {
+				nodeGroup.nodeLog(bundle.node).Infof("Deferring tainting node %v hosting pods of workloads part way through a rollout: %v", bundle.node.Name, strings.Join(workloads, ", "))
+				rolloutDeferred++
+				continue
+			}
+		}
+
+		// pods with local storage lose their data when the node is terminated
+		if nodeGroup.Opts.ProtectLocalStorage {
+			if volumes := c.nodeLocalStorageVolumes(bundle.node, nodeGroup); len(volumes) > 0 {
+				if !k8s.NodeIsForcedScaleDown(bundle.node) {
+					nodeGroup.nodeLog(bundle.node).Warningf("Not tainting node %v hosting pods with local storage: %v", bundle.node.Name, strings.Join(volumes, ", "))
+					localStorageProtected++
+					continue
+				}
+				nodeGroup.nodeLog(bundle.node).Warningf("Tainting node %v hosting pods with local storage as it is forced, their data will be lost when it is terminated: %v", bundle.node.Name, strings.Join(volumes, ", "))
+			}
+		}
+
+		// removing the last replicas of a workload, or of a workload in a zone, risks its availability
+		if spread != nil && !k8s.NodeIsForcedScaleDown(bundle.node) {
+			if workloads := spread.unsafeWorkloads(bundle.node); len(workloads) > 0 {
+				nodeGroup.nodeLog(bundle.node).Warningf("Not tainting node %v, it would leave too few replicas or replicas missing from its zone: %v", bundle.node.Name, strings.Join(workloads, ", "))
+				replicaSpreadProtected++
+				continue
+			}
+		}
+
 		// only actually taint in dry mode
 		if !c.dryMode(nodeGroup) {
-			log.WithField("drymode", "off").Infof("Tainting node %v", bundle.node.Name)
+			nodeGroup.nodeLog(bundle.node).WithField("drymode", "off").Infof("Tainting node %v", bundle.node.Name)
 
 			// Taint the node
-			updatedNode, err := k8s.AddToBeRemovedTaint(bundle.node, c.Client)
+			updatedNode, err := k8s.AddToBeRemovedTaint(bundle.node, c.Client, c.clock().Now())
 			if err != nil {
 				log.Errorf("While tainting %v: %v", bundle.node.Name, err)
 			} else {
 				bundle.node = updatedNode
 				taintedIndices = append(taintedIndices, bundle.index)
+				taintedNames = append(taintedNames, bundle.node.Name)
+				if spread != nil {
+					spread.remove(bundle.node)
+				}
 			}
 		} else {
 			nodeGroup.taintTracker = append(nodeGroup.taintTracker, bundle.node.Name)
 			k8s.IncrementTaintCount()
 			taintedIndices = append(taintedIndices, bundle.index)
-			log.WithField("drymode", "on").Infof("Tainting node %v", bundle.node.Name)
+			nodeGroup.nodeLog(bundle.node).WithField("drymode", "on").Infof("Tainting node %v", bundle.node.Name)
+			if spread != nil {
+				spread.remove(bundle.node)
+			}
 		}
 	}
 
+	if len(taintedNames) > 0 {
+		c.Opts.EventStream.Taint(nodeGroup.Opts.Name, taintedNames)
+	}
+	metrics.NodeGroupLocalStorageProtectedNodes.WithLabelValues(nodeGroup.Opts.Name).Set(float64(localStorageProtected))
+	metrics.NodeGroupRolloutDeferredNodes.WithLabelValues(nodeGroup.Opts.Name).Set(float64(rolloutDeferred))
+	metrics.NodeGroupReplicaSpreadProtectedNodes.WithLabelValues(nodeGroup.Opts.Name).Set(float64(replicaSpreadProtected))
 	return taintedIndices
 }
+
+// nodeReadyPodCount returns the number of Ready pods on the node, leaving out daemonset and static pods which run on
+// every node
+func nodeReadyPodCount(node *v1.Node, nodeGroup *NodeGroupState) int {
+	nodeInfo, ok := nodeGroup.NodeInfoMap[node.Name]
+	if !ok {
+		return 0
+	}
+	var ready int
+	for _, pod := range nodeInfo.Pods() {
+		if k8s.PodIsDaemonSet(pod) || k8s.PodIsStatic(pod) || k8s.PodIsTerminated(pod) {
+			continue
+		}
+		if k8s.PodIsReady(pod) {
+			ready++
+		}
+	}
+	return ready
+}
+
+// nodeLocalStorageVolumes returns the local storage volumes of the pods on the node as namespace/pod/volume, leaving
+// out daemonset and static pods which run on every node. The persistent volume claims are read from the cache. A pod
+// whose volumes can't be looked up is assumed to have local storage, so its data isn't lost because of an API error
+func (c *Controller) nodeLocalStorageVolumes(node *v1.Node, nodeGroup *NodeGroupState) []string {
+	nodeInfo, ok := nodeGroup.NodeInfoMap[node.Name]
+	if !ok {
+		return nil
+	}
+	claims, persistentVolumes, listerErr := c.persistentVolumeListers()
+	var volumes []string
+	for _, pod := range nodeInfo.Pods() {
+		if k8s.PodIsDaemonSet(pod) || k8s.PodIsStatic(pod) || k8s.PodIsTerminated(pod) {
+			continue
+		}
+		var podVolumes []string
+		err := listerErr
+		if err == nil {
+			podVolumes, err = k8s.PodLocalStorageVolumes(claims, persistentVolumes, pod)
+		}
+		if err != nil {
+			log.WithField("nodegroup", nodeGroup.Opts.Name).WithError(err).Warningf("Failed to look up the volumes of pod %v/%v, assuming it has local storage", pod.Namespace, pod.Name)
+			podVolumes = append(podVolumes, "unknown")
+		}
+		for _, volume := range podVolumes {
+			volumes = append(volumes, fmt.Sprintf("%v/%v/%v", pod.Namespace, pod.Name, volume))
+		}
+	}
+	return volumes
+}
+
+// nodeRollingOutWorkloads returns the Deployments and StatefulSets part way through a rollout with pods on the node,
+// leaving out daemonset and static pods. The workloads are read from the cache. A pod whose workload can't be looked up
+// is assumed to be rolling out, so the scale down is deferred rather than risk the availability of the workload because
+// of an API error
+func (c *Controller) nodeRollingOutWorkloads(node *v1.Node, nodeGroup *NodeGroupState) []string {
+	nodeInfo, ok := nodeGroup.NodeInfoMap[node.Name]
+	if !ok {
+		return nil
+	}
+	replicaSets, deployments, statefulSets, listerErr := c.workloadListers()
+	var workloads []string
+	seen := make(map[string]bool)
+	for _, pod := range nodeInfo.Pods() {
+		if k8s.PodIsDaemonSet(pod) || k8s.PodIsStatic(pod) || k8s.PodIsTerminated(pod) {
+			continue
+		}
+		var workload string
+		var rollingOut bool
+		err := listerErr
+		if err == nil {
+			workload, rollingOut, err = k8s.PodWorkloadRollingOut(replicaSets, deployments, statefulSets, pod)
+		}
+		if err != nil {
+			log.WithField("nodegroup", nodeGroup.Opts.Name).WithError(err).Warningf("Failed to look up the workload of pod %v/%v, assuming it is rolling out", pod.Namespace, pod.Name)
+			if len(workload) == 0 {
+				workload = fmt.Sprintf("%v/%v", pod.Namespace, pod.Name)
+			}
+			rollingOut = true
+		}
+		if rollingOut && !seen[workload] {
+			seen[workload] = true
+			workloads = append(workloads, workload)
+		}
+	}
+	return workloads
+}
+
+// nodeRunsLongPods returns whether any of the pods on the node are expected to still be running once the hard delete
+// grace period has passed, from their k8s.ExpectedDurationAnnotation. Tainting the node now would risk the pods being
+// killed part way through. Pods without the annotation are never considered long running
+func nodeRunsLongPods(node *v1.Node, nodeGroup *NodeGroupState, now time.Time) bool {
+	nodeInfo, ok := nodeGroup.NodeInfoMap[node.Name]
+	if !ok {
+		return false
+	}
+	deadline := now.Add(nodeGroup.Opts.HardDeleteGracePeriodDuration())
+	for _, pod := range nodeInfo.Pods() {
+		if k8s.PodIsTerminated(pod) {
+			continue
+		}
+		if expectedEnd, ok := k8s.PodExpectedEndTime(pod); ok && expectedEnd.After(deadline) {
+			return true
+		}
+	}
+	return false
+}
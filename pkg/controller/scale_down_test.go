@@ -1,14 +1,27 @@
 package controller
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/atlassian/escalator/pkg/audit"
+	"github.com/atlassian/escalator/pkg/eventstream"
 	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/metrics"
 	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
 )
 
 func TestControllerScaleDownTaint(t *testing.T) {
@@ -83,6 +96,10 @@ func TestControllerScaleDownTaint(t *testing.T) {
 					nodes,
 					nodeGroupsState["buildeng"],
 					2,
+					nil,
+					"",
+					nil,
+					nil,
 				},
 			},
 			2,
@@ -98,6 +115,10 @@ func TestControllerScaleDownTaint(t *testing.T) {
 					nodes,
 					nodeGroupsState["buildeng"],
 					4,
+					nil,
+					"",
+					nil,
+					nil,
 				},
 			},
 			3,
@@ -113,6 +134,10 @@ func TestControllerScaleDownTaint(t *testing.T) {
 					nodes[:2],
 					nodeGroupsState["buildeng"],
 					4,
+					nil,
+					"",
+					nil,
+					nil,
 				},
 			},
 			0,
@@ -149,6 +174,52 @@ func TestControllerScaleDownTaint(t *testing.T) {
 	}
 }
 
+func TestControllerScaleDownTaintMaxScaleDownFraction(t *testing.T) {
+	notReady := test.BuildTestNode(test.NodeOpts{Name: "not-ready"})
+	notReady.Status.Conditions[0].Status = v1.ConditionFalse
+
+	tests := []struct {
+		name     string
+		fraction float64
+		nodes    []*v1.Node
+		delta    int
+		want     int
+	}{
+		{"default fraction clamps to half", 0, test.BuildTestNodes(6, test.NodeOpts{}), 6, 3},
+		{"fraction rounds down", 0.4, test.BuildTestNodes(6, test.NodeOpts{}), 6, 2},
+		{"delta below the fraction is not clamped", 0.5, test.BuildTestNodes(6, test.NodeOpts{}), 2, 2},
+		{"fraction of 1 does not clamp", 1, test.BuildTestNodes(6, test.NodeOpts{}), 6, 6},
+		{"not ready nodes are not counted", 0.5, append(test.BuildTestNodes(2, test.NodeOpts{}), notReady), 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                 "buildeng",
+				MinNodes:             0,
+				MaxNodes:             10,
+				DryMode:              true,
+				MaxScaleDownFraction: tt.fraction,
+			}}
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+			})
+			c := &Controller{
+				Opts:       Opts{NodeGroups: nodeGroups},
+				nodeGroups: nodeGroupsState,
+			}
+
+			tainted, err := c.scaleDownTaint(scaleOpts{
+				nodes:          tt.nodes,
+				untaintedNodes: tt.nodes,
+				nodeGroup:      nodeGroupsState["buildeng"],
+				nodesDelta:     tt.delta,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, tainted)
+		})
+	}
+}
+
 func TestControllerTaintOldestN(t *testing.T) {
 
 	nodes := []*v1.Node{
@@ -333,3 +404,1623 @@ func TestControllerTaintOldestN(t *testing.T) {
 func TestControllerScaleDown(t *testing.T) {
 	t.Skip("test not implemented")
 }
+
+func TestControllerTryRemoveTaintedNodesInBatches(t *testing.T) {
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                         "default",
+		CloudProviderGroupName:       "default",
+		MinNodes:                     0,
+		MaxNodes:                     10,
+		SoftDeleteGracePeriod:        "1m",
+		HardDeleteGracePeriod:        "10m",
+		ScaleDownNodeDeleteInterval:  "20ms",
+		ScaleDownNodeDeleteBatchSize: 2,
+	}
+
+	tests := []struct {
+		name        string
+		stopped     bool
+		wantRemoved int
+	}{
+		{"all batches are deleted", false, -5},
+		{"stopping aborts the remaining batches", true, -2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := test.BuildTestNodes(5, test.NodeOpts{
+				CPU:     1000,
+				Mem:     1000,
+				Tainted: true,
+			})
+			client, opts := buildTestClient(nodes, nil, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+			mockClock := newManualClock(time.Now())
+			opts.Clock = mockClock
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 0, 10, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+				client:     *client,
+			})
+
+			stopChan := make(chan struct{})
+			if tt.stopped {
+				close(stopChan)
+			}
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      stopChan,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			// move past the hard delete grace period of the taints
+			mockClock.Add(time.Hour)
+
+			start := mockClock.Now()
+			stopAdvancing := advanceWhileWaiting(mockClock, 20*time.Millisecond)
+			removed, err := controller.TryRemoveTaintedNodes(scaleOpts{
+				nodes:        nodes,
+				taintedNodes: nodes,
+				nodeGroup:    nodeGroupsState["default"],
+			})
+			stopAdvancing()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRemoved, removed)
+			assert.Equal(t, int64(len(nodes)+tt.wantRemoved), testNodeGroup.TargetSize())
+			if !tt.stopped {
+				// two waits between the three batches
+				assert.Equal(t, 40*time.Millisecond, mockClock.Now().Sub(start))
+			}
+		})
+	}
+}
+
+func TestControllerTryRemoveTaintedNodesDrain(t *testing.T) {
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MinNodes:               0,
+		MaxNodes:               10,
+		SoftDeleteGracePeriod:  "1m",
+		HardDeleteGracePeriod:  "10m",
+		DrainTimeout:           "10m",
+	}
+
+	tests := []struct {
+		name        string
+		gracePeriod int64
+		wantWait    time.Duration
+	}{
+		{"waits for the pod's grace period", 300, 5 * time.Minute},
+		{"waits for at most the drain timeout", 3600, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := []*v1.Node{test.BuildTestNode(test.NodeOpts{
+				Name:    "node",
+				CPU:     1000,
+				Mem:     1000,
+				Tainted: true,
+			})}
+			pod := test.BuildTestPod(test.PodOpts{
+				Name:     "pod",
+				NodeName: "node",
+			})
+			pod.Spec.TerminationGracePeriodSeconds = &tt.gracePeriod
+			pods := []*v1.Pod{pod}
+			client, opts := buildTestClient(nodes, pods, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+			mockClock := newManualClock(time.Now())
+			opts.Clock = mockClock
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 0, 10, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+				client:     *client,
+			})
+			nodeGroupsState["default"].NodeInfoMap = k8s.CreateNodeNameToInfoMap(pods, nodes)
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			// move past the hard delete grace period of the taint
+			mockClock.Add(time.Hour)
+
+			scale := scaleOpts{
+				nodes:        nodes,
+				taintedNodes: nodes,
+				nodeGroup:    nodeGroupsState["default"],
+			}
+
+			// the pod is evicted but the node is not terminated straight away
+			removed, err := controller.TryRemoveTaintedNodes(scale)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, removed)
+			assert.Contains(t, nodeGroupsState["default"].drainingSince, "node")
+			assert.Equal(t, 1.0, testutil.ToFloat64(metrics.NodeDrainPodsRemaining.WithLabelValues("default", "node")))
+			assert.Equal(t, []drainReport{{
+				NodeGroup:     "default",
+				Node:          "node",
+				PodsRemaining: 1,
+				Since:         mockClock.Now(),
+				Elapsed:       "0s",
+			}}, controller.drains.list(mockClock.Now()))
+			evictions := 0
+			for _, action := range opts.K8SClient.(*fake.Clientset).Actions() {
+				if action.Matches("create", "pods") && action.GetSubresource() == "eviction" {
+					evictions++
+				}
+			}
+			assert.Equal(t, 1, evictions)
+
+			mockClock.Add(tt.wantWait - time.Second)
+			removed, err = controller.TryRemoveTaintedNodes(scale)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, removed)
+			assert.Equal(t, int64(1), testNodeGroup.TargetSize())
+
+			// the wait has passed, the node is terminated
+			mockClock.Add(time.Second)
+			removed, err = controller.TryRemoveTaintedNodes(scale)
+			assert.NoError(t, err)
+			assert.Equal(t, -1, removed)
+			assert.Equal(t, int64(0), testNodeGroup.TargetSize())
+			assert.Empty(t, nodeGroupsState["default"].drainingSince)
+			assert.Empty(t, controller.drains.list(mockClock.Now()))
+		})
+	}
+}
+
+func TestControllerTryRemoveTaintedNodesDrainEvictionBlocked(t *testing.T) {
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MinNodes:               0,
+		MaxNodes:               10,
+		SoftDeleteGracePeriod:  "1m",
+		HardDeleteGracePeriod:  "10m",
+		DrainTimeout:           "1m",
+	}
+
+	nodes := []*v1.Node{test.BuildTestNode(test.NodeOpts{
+		Name:    "node",
+		CPU:     1000,
+		Mem:     1000,
+		Tainted: true,
+	})}
+	pod := test.BuildTestPod(test.PodOpts{
+		Name:     "pod",
+		NodeName: "node",
+	})
+	pods := []*v1.Pod{pod}
+	client, opts := buildTestClient(nodes, pods, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+
+	// a pod disruption budget refuses the eviction until blocked is unset
+	blocked := true
+	evictions := 0
+	opts.K8SClient.(*fake.Clientset).PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		evictions++
+		if blocked {
+			return true, nil, apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+		}
+		return true, nil, nil
+	})
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 0, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+		client:     *client,
+	})
+	nodeGroupsState["default"].NodeInfoMap = k8s.CreateNodeNameToInfoMap(pods, nodes)
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      nil,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// move past the hard delete grace period of the taint
+	mockClock.Add(time.Hour)
+
+	scale := scaleOpts{
+		nodes:        nodes,
+		taintedNodes: nodes,
+		nodeGroup:    nodeGroupsState["default"],
+	}
+
+	removed, err := controller.TryRemoveTaintedNodes(scale)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	assert.Equal(t, 1, evictions)
+	assert.Contains(t, nodeGroupsState["default"].evictionsBlocked, "node")
+
+	// the drain timeout has passed but the eviction is still blocked, so the node isn't terminated
+	mockClock.Add(5 * time.Minute)
+	removed, err = controller.TryRemoveTaintedNodes(scale)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	assert.Equal(t, int64(1), testNodeGroup.TargetSize())
+	assert.Equal(t, 2, evictions)
+
+	// the retry backs off, so the pod isn't evicted again straight away
+	removed, err = controller.TryRemoveTaintedNodes(scale)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	assert.Equal(t, 2, evictions)
+
+	// once the budget allows the eviction the node is terminated
+	blocked = false
+	mockClock.Add(maxEvictionRetryBackoff)
+	removed, err = controller.TryRemoveTaintedNodes(scale)
+	assert.NoError(t, err)
+	assert.Equal(t, -1, removed)
+	assert.Equal(t, 3, evictions)
+	assert.Equal(t, int64(0), testNodeGroup.TargetSize())
+	assert.Empty(t, nodeGroupsState["default"].evictionsBlocked)
+}
+
+func TestControllerTryRemoveTaintedNodesMaxConcurrentDrains(t *testing.T) {
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MinNodes:               0,
+		MaxNodes:               10,
+		SoftDeleteGracePeriod:  "1m",
+		HardDeleteGracePeriod:  "10m",
+		DrainTimeout:           "10m",
+		MaxConcurrentDrains:    2,
+	}
+
+	gracePeriod := int64(300)
+	var nodes []*v1.Node
+	var pods []*v1.Pod
+	for _, name := range []string{"n1", "n2", "n3"} {
+		nodes = append(nodes, test.BuildTestNode(test.NodeOpts{
+			Name:    name,
+			CPU:     1000,
+			Mem:     1000,
+			Tainted: true,
+		}))
+		pod := test.BuildTestPod(test.PodOpts{
+			Name:     name + "-pod",
+			NodeName: name,
+		})
+		pod.Spec.TerminationGracePeriodSeconds = &gracePeriod
+		pods = append(pods, pod)
+	}
+	client, opts := buildTestClient(nodes, pods, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 0, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+		client:     *client,
+	})
+	nodeGroupsState["default"].NodeInfoMap = k8s.CreateNodeNameToInfoMap(pods, nodes)
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      nil,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// move past the hard delete grace period of the taints
+	mockClock.Add(time.Hour)
+
+	// only two of the nodes are drained at once
+	removed, err := controller.TryRemoveTaintedNodes(scaleOpts{nodes: nodes, taintedNodes: nodes, nodeGroup: nodeGroupsState["default"]})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	assert.Len(t, nodeGroupsState["default"].drainingSince, 2)
+	assert.NotContains(t, nodeGroupsState["default"].drainingSince, "n3")
+
+	// the limit still holds whilst the earlier drains are in progress
+	mockClock.Add(time.Minute)
+	removed, err = controller.TryRemoveTaintedNodes(scaleOpts{nodes: nodes, taintedNodes: []*v1.Node{nodes[2], nodes[0], nodes[1]}, nodeGroup: nodeGroupsState["default"]})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	assert.NotContains(t, nodeGroupsState["default"].drainingSince, "n3")
+
+	// the first two drains finish and their nodes are terminated, the third node is drained in the next scan
+	mockClock.Add(4 * time.Minute)
+	removed, err = controller.TryRemoveTaintedNodes(scaleOpts{nodes: nodes, taintedNodes: nodes, nodeGroup: nodeGroupsState["default"]})
+	assert.NoError(t, err)
+	assert.Equal(t, -2, removed)
+	assert.Empty(t, nodeGroupsState["default"].drainingSince)
+
+	removed, err = controller.TryRemoveTaintedNodes(scaleOpts{nodes: nodes[2:], taintedNodes: nodes[2:], nodeGroup: nodeGroupsState["default"]})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	assert.Contains(t, nodeGroupsState["default"].drainingSince, "n3")
+}
+
+func TestControllerTryRemoveTaintedNodesPodScheduledSinceSnapshot(t *testing.T) {
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MinNodes:               0,
+		MaxNodes:               10,
+		SoftDeleteGracePeriod:  "1m",
+		HardDeleteGracePeriod:  "10m",
+	}
+
+	tests := []struct {
+		name        string
+		podLanded   bool
+		wantRemoved int
+	}{
+		{"node still empty is deleted", false, -1},
+		{"node a pod landed on is not deleted", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := []*v1.Node{test.BuildTestNode(test.NodeOpts{
+				Name:    "node",
+				CPU:     1000,
+				Mem:     1000,
+				Tainted: true,
+			})}
+			var pods []*v1.Pod
+			if tt.podLanded {
+				pods = append(pods, test.BuildTestPod(test.PodOpts{
+					Name:     "pod",
+					NodeName: "node",
+				}))
+			}
+			client, opts := buildTestClient(nodes, pods, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+			mockClock := newManualClock(time.Now())
+			opts.Clock = mockClock
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 0, 10, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+				client:     *client,
+			})
+			// the snapshot of the scan was taken before the pod was scheduled onto the node
+			nodeGroupsState["default"].NodeInfoMap = k8s.CreateNodeNameToInfoMap(nil, nodes)
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			// move past the soft delete grace period but not the hard delete grace period of the taint
+			mockClock.Add(5 * time.Minute)
+
+			removed, err := controller.TryRemoveTaintedNodes(scaleOpts{
+				nodes:        nodes,
+				taintedNodes: nodes,
+				nodeGroup:    nodeGroupsState["default"],
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRemoved, removed)
+			assert.Equal(t, int64(len(nodes)+tt.wantRemoved), testNodeGroup.TargetSize())
+		})
+	}
+}
+
+func TestControllerTaintOldestNAvoidsLongRunningPods(t *testing.T) {
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "oldest", Creation: time.Date(2005, 3, 3, 13, 0, 0, 0, time.UTC)}),
+		test.BuildTestNode(test.NodeOpts{Name: "older", Creation: time.Date(2007, 3, 3, 13, 0, 0, 0, time.UTC)}),
+		test.BuildTestNode(test.NodeOpts{Name: "newest", Creation: time.Date(2009, 3, 3, 13, 0, 0, 0, time.UTC)}),
+	}
+	longPod := test.BuildTestPod(test.PodOpts{Name: "long", NodeName: "oldest"})
+	longPod.Annotations = map[string]string{k8s.ExpectedDurationAnnotation: "24h"}
+	shortPod := test.BuildTestPod(test.PodOpts{Name: "short", NodeName: "older"})
+	shortPod.Annotations = map[string]string{k8s.ExpectedDurationAnnotation: "5m"}
+	pods := []*v1.Pod{longPod, shortPod}
+	started := metav1.Now()
+	for _, pod := range pods {
+		pod.Status.StartTime = &started
+	}
+
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                  "default",
+		MinNodes:              1,
+		MaxNodes:              5,
+		SoftDeleteGracePeriod: "1m",
+		HardDeleteGracePeriod: "10m",
+	}
+	fakeClient, _ := test.BuildFakeClient(nodes, pods)
+	controller := &Controller{
+		Client: &Client{Interface: fakeClient},
+		Opts:   Opts{K8SClient: fakeClient, NodeGroups: []NodeGroupOptions{nodeGroupOpts}},
+	}
+	nodeGroup := &NodeGroupState{
+		Opts:        nodeGroupOpts,
+		NodeInfoMap: k8s.CreateNodeNameToInfoMap(pods, nodes),
+	}
+
+	// the node running the pod expected to outlast the hard delete grace period is only tainted as a last resort
+	assert.NoError(t, k8s.BeginTaintFailSafe(2))
+	got := controller.taintOldestN(nodes, nodeGroup, 2)
+	assert.NoError(t, k8s.EndTaintFailSafe(len(got)))
+	assert.Equal(t, []int{1, 2}, got)
+
+	assert.NoError(t, k8s.BeginTaintFailSafe(3))
+	got = controller.taintOldestN(nodes, nodeGroup, 3)
+	assert.NoError(t, k8s.EndTaintFailSafe(len(got)))
+	assert.Equal(t, []int{1, 2, 0}, got)
+}
+
+func TestControllerTaintOldestNOrderByPodReadiness(t *testing.T) {
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "oldest", Creation: time.Date(2005, 3, 3, 13, 0, 0, 0, time.UTC)}),
+		test.BuildTestNode(test.NodeOpts{Name: "older", Creation: time.Date(2007, 3, 3, 13, 0, 0, 0, time.UTC)}),
+		test.BuildTestNode(test.NodeOpts{Name: "newest", Creation: time.Date(2009, 3, 3, 13, 0, 0, 0, time.UTC)}),
+	}
+	ready := []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	pods := []*v1.Pod{
+		test.BuildTestPod(test.PodOpts{Name: "ready-1", NodeName: "oldest"}),
+		test.BuildTestPod(test.PodOpts{Name: "ready-2", NodeName: "oldest"}),
+		test.BuildTestPod(test.PodOpts{Name: "ready-3", NodeName: "older"}),
+		test.BuildTestPod(test.PodOpts{Name: "starting-1", NodeName: "newest"}),
+		test.BuildTestPod(test.PodOpts{Name: "starting-2", NodeName: "newest"}),
+		test.BuildTestPod(test.PodOpts{Name: "daemon", NodeName: "newest", Owner: "DaemonSet"}),
+	}
+	for _, pod := range pods[:3] {
+		pod.Status.Conditions = ready
+	}
+	pods[5].Status.Conditions = ready
+
+	tests := []struct {
+		name    string
+		enabled bool
+		want    []int
+	}{
+		{"oldest first", false, []int{0, 1}},
+		// the newest node only runs pods that aren't Ready yet, other than its daemonset pod
+		{"fewest ready pods first", true, []int{2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroupOpts := NodeGroupOptions{
+				Name:                         "default",
+				MinNodes:                     1,
+				MaxNodes:                     5,
+				ScaleDownOrderByPodReadiness: tt.enabled,
+			}
+			fakeClient, _ := test.BuildFakeClient(nodes, pods)
+			controller := &Controller{
+				Client: &Client{Interface: fakeClient},
+				Opts:   Opts{K8SClient: fakeClient, NodeGroups: []NodeGroupOptions{nodeGroupOpts}},
+			}
+			nodeGroup := &NodeGroupState{
+				Opts:        nodeGroupOpts,
+				NodeInfoMap: k8s.CreateNodeNameToInfoMap(pods, nodes),
+			}
+
+			assert.NoError(t, k8s.BeginTaintFailSafe(2))
+			got := controller.taintOldestN(nodes, nodeGroup, 2)
+			assert.NoError(t, k8s.EndTaintFailSafe(len(got)))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestControllerTaintOldestNSkipsCordonedNodes(t *testing.T) {
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "oldest", Creation: time.Date(2005, 3, 3, 13, 0, 0, 0, time.UTC)}),
+		test.BuildTestNode(test.NodeOpts{Name: "older", Creation: time.Date(2007, 3, 3, 13, 0, 0, 0, time.UTC)}),
+		test.BuildTestNode(test.NodeOpts{Name: "newest", Creation: time.Date(2009, 3, 3, 13, 0, 0, 0, time.UTC)}),
+	}
+	nodes[0].Spec.Unschedulable = true
+
+	disabled := false
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                  "default",
+		MinNodes:              1,
+		MaxNodes:              5,
+		RespectExternalCordon: &disabled,
+	}
+	fakeClient, _ := test.BuildFakeClient(nodes, nil)
+	controller := &Controller{
+		Client: &Client{Interface: fakeClient},
+		Opts:   Opts{K8SClient: fakeClient, NodeGroups: []NodeGroupOptions{nodeGroupOpts}},
+	}
+	nodeGroup := &NodeGroupState{
+		Opts:        nodeGroupOpts,
+		NodeInfoMap: k8s.CreateNodeNameToInfoMap(nil, nodes),
+	}
+
+	// the node cordoned by an operator is never chosen, even when it is the oldest
+	assert.NoError(t, k8s.BeginTaintFailSafe(3))
+	got := controller.taintOldestN(nodes, nodeGroup, 3)
+	assert.NoError(t, k8s.EndTaintFailSafe(len(got)))
+	assert.Equal(t, []int{1, 2}, got)
+}
+
+func TestControllerTaintOldestNProtectLocalStorage(t *testing.T) {
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "oldest", Creation: time.Date(2005, 3, 3, 13, 0, 0, 0, time.UTC)}),
+		test.BuildTestNode(test.NodeOpts{Name: "older", Creation: time.Date(2007, 3, 3, 13, 0, 0, 0, time.UTC)}),
+		test.BuildTestNode(test.NodeOpts{Name: "newest", Creation: time.Date(2009, 3, 3, 13, 0, 0, 0, time.UTC)}),
+	}
+	nodes[2].Annotations = map[string]string{k8s.ForceScaleDownAnnotation: "true"}
+	scratch := v1.Volume{Name: "scratch", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{Medium: v1.StorageMediumMemory}}}
+	logs := v1.Volume{Name: "logs", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/log"}}}
+	pods := []*v1.Pod{
+		test.BuildTestPod(test.PodOpts{Name: "cache", NodeName: "oldest"}),
+		test.BuildTestPod(test.PodOpts{Name: "daemon", NodeName: "older", Owner: "DaemonSet"}),
+		test.BuildTestPod(test.PodOpts{Name: "forced", NodeName: "newest"}),
+	}
+	pods[0].Spec.Volumes = []v1.Volume{scratch}
+	pods[1].Spec.Volumes = []v1.Volume{logs}
+	pods[2].Spec.Volumes = []v1.Volume{scratch}
+
+	tests := []struct {
+		name      string
+		protect   bool
+		want      []int
+		protected float64
+	}{
+		{"not protected", false, []int{0, 1, 2}, 0},
+		// daemonset pods run on every node so don't protect it, and the newest node is forced
+		{"protected", true, []int{1, 2}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroupOpts := NodeGroupOptions{
+				Name:                "default",
+				MinNodes:            1,
+				MaxNodes:            5,
+				ProtectLocalStorage: tt.protect,
+			}
+			fakeClient, _ := test.BuildFakeClient(nodes, pods)
+			controller := &Controller{
+				Client: &Client{Interface: fakeClient},
+				Opts:   Opts{K8SClient: fakeClient, NodeGroups: []NodeGroupOptions{nodeGroupOpts}},
+				listers: resourceListers{
+					claims:            test.NewTestPersistentVolumeClaimLister(),
+					persistentVolumes: test.NewTestPersistentVolumeLister(),
+				},
+			}
+			nodeGroup := &NodeGroupState{
+				Opts:        nodeGroupOpts,
+				NodeInfoMap: k8s.CreateNodeNameToInfoMap(pods, nodes),
+			}
+
+			assert.NoError(t, k8s.BeginTaintFailSafe(3))
+			got := controller.taintOldestN(nodes, nodeGroup, 3)
+			assert.NoError(t, k8s.EndTaintFailSafe(len(got)))
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.protected, testutil.ToFloat64(metrics.NodeGroupLocalStorageProtectedNodes.WithLabelValues("default")))
+		})
+	}
+}
+
+func TestControllerTaintOldestNDeferScaleDownDuringRollout(t *testing.T) {
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "oldest", Creation: time.Date(2005, 3, 3, 13, 0, 0, 0, time.UTC)}),
+		test.BuildTestNode(test.NodeOpts{Name: "older", Creation: time.Date(2007, 3, 3, 13, 0, 0, 0, time.UTC)}),
+		test.BuildTestNode(test.NodeOpts{Name: "newest", Creation: time.Date(2009, 3, 3, 13, 0, 0, 0, time.UTC)}),
+	}
+	controlledBy := func(kind string, name string) []metav1.OwnerReference {
+		controller := true
+		return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+	}
+	pods := []*v1.Pod{
+		test.BuildTestPod(test.PodOpts{Name: "rolling", Namespace: "default", NodeName: "oldest"}),
+		test.BuildTestPod(test.PodOpts{Name: "rolled-out", Namespace: "default", NodeName: "older"}),
+		test.BuildTestPod(test.PodOpts{Name: "daemon", NodeName: "newest", Owner: "DaemonSet"}),
+	}
+	pods[0].OwnerReferences = controlledBy("ReplicaSet", "rolling-1234")
+	pods[1].OwnerReferences = controlledBy("ReplicaSet", "rolled-out-1234")
+
+	namespace := "default"
+	replicaSets := test.NewTestReplicaSetLister(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "rolling-1234", Namespace: namespace, OwnerReferences: controlledBy("Deployment", "rolling")}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "rolled-out-1234", Namespace: namespace, OwnerReferences: controlledBy("Deployment", "rolled-out")}},
+	)
+	replicas := int32(2)
+	deployments := test.NewTestDeploymentLister(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "rolling", Namespace: namespace},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 1},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "rolled-out", Namespace: namespace},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+		},
+	)
+
+	tests := []struct {
+		name     string
+		deferred bool
+		want     []int
+	}{
+		{"not deferred", false, []int{0, 1, 2}},
+		// daemonset pods aren't part of a rollout
+		{"deferred", true, []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroupOpts := NodeGroupOptions{
+				Name:                        "default",
+				MinNodes:                    1,
+				MaxNodes:                    5,
+				DeferScaleDownDuringRollout: tt.deferred,
+			}
+			fakeClient, _ := test.BuildFakeClient(nodes, pods)
+			controller := &Controller{
+				Client:  &Client{Interface: fakeClient},
+				Opts:    Opts{K8SClient: fakeClient, NodeGroups: []NodeGroupOptions{nodeGroupOpts}},
+				listers: resourceListers{replicaSets: replicaSets, deployments: deployments, statefulSets: test.NewTestStatefulSetLister()},
+			}
+			nodeGroup := &NodeGroupState{
+				Opts:        nodeGroupOpts,
+				NodeInfoMap: k8s.CreateNodeNameToInfoMap(pods, nodes),
+			}
+
+			assert.NoError(t, k8s.BeginTaintFailSafe(3))
+			got := controller.taintOldestN(nodes, nodeGroup, 3)
+			assert.NoError(t, k8s.EndTaintFailSafe(len(got)))
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, float64(3-len(tt.want)), testutil.ToFloat64(metrics.NodeGroupRolloutDeferredNodes.WithLabelValues("default")))
+		})
+	}
+}
+
+func TestControllerTaintOldestNProtectReplicaSpread(t *testing.T) {
+	zone := func(name string, zone string, year int) *v1.Node {
+		return test.BuildTestNode(test.NodeOpts{Name: name, LabelKey: k8s.ZoneLabel, LabelValue: zone, Creation: time.Date(year, 3, 3, 13, 0, 0, 0, time.UTC)})
+	}
+	nodes := []*v1.Node{
+		zone("zone-a-1", "zone-a", 2005),
+		zone("zone-a-2", "zone-a", 2006),
+		zone("zone-b-1", "zone-b", 2007),
+		zone("singleton", "zone-b", 2008),
+		test.BuildTestNode(test.NodeOpts{Name: "empty", Creation: time.Date(2009, 3, 3, 13, 0, 0, 0, time.UTC)}),
+	}
+	controlledBy := func(kind string, name string) []metav1.OwnerReference {
+		controller := true
+		return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+	}
+	pods := []*v1.Pod{
+		test.BuildTestPod(test.PodOpts{Name: "web-1", NodeName: "zone-a-1"}),
+		test.BuildTestPod(test.PodOpts{Name: "web-2", NodeName: "zone-a-2"}),
+		test.BuildTestPod(test.PodOpts{Name: "web-3", NodeName: "zone-b-1"}),
+		test.BuildTestPod(test.PodOpts{Name: "singleton", NodeName: "singleton"}),
+		test.BuildTestPod(test.PodOpts{Name: "daemon", NodeName: "empty", Owner: "DaemonSet"}),
+	}
+	for _, pod := range pods[:3] {
+		pod.OwnerReferences = controlledBy("ReplicaSet", "web-1234")
+	}
+	pods[3].OwnerReferences = controlledBy("StatefulSet", "singleton")
+
+	tests := []struct {
+		name    string
+		protect bool
+		forced  bool
+		want    []int
+	}{
+		{"not protected", false, false, []int{0, 1, 2, 3, 4}},
+		// once zone-a-1 is tainted the other web replicas are the last of their zones, and the singleton is the last
+		// replica of its statefulset
+		{"protected", true, false, []int{0, 4}},
+		{"protected with a forced node", true, true, []int{0, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes[3].Annotations = nil
+			if tt.forced {
+				nodes[3].Annotations = map[string]string{k8s.ForceScaleDownAnnotation: "true"}
+			}
+			nodeGroupOpts := NodeGroupOptions{
+				Name:                 "default",
+				MinNodes:             1,
+				MaxNodes:             5,
+				ProtectReplicaSpread: tt.protect,
+			}
+			fakeClient, _ := test.BuildFakeClient(nodes, pods)
+			controller := &Controller{
+				Client: &Client{Interface: fakeClient},
+				Opts:   Opts{K8SClient: fakeClient, NodeGroups: []NodeGroupOptions{nodeGroupOpts}},
+			}
+			nodeGroup := &NodeGroupState{
+				Opts:        nodeGroupOpts,
+				NodeInfoMap: k8s.CreateNodeNameToInfoMap(pods, nodes),
+			}
+
+			assert.NoError(t, k8s.BeginTaintFailSafe(5))
+			got := controller.taintOldestN(nodes, nodeGroup, 5)
+			assert.NoError(t, k8s.EndTaintFailSafe(len(got)))
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, float64(5-len(tt.want)), testutil.ToFloat64(metrics.NodeGroupReplicaSpreadProtectedNodes.WithLabelValues("default")))
+		})
+	}
+}
+
+func TestControllerTryRemoveTaintedNodesDeletionLimit(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{
+		{
+			Name:                   "first",
+			CloudProviderGroupName: "first",
+			LabelKey:               "customer",
+			LabelValue:             "first",
+			MaxNodes:               10,
+			SoftDeleteGracePeriod:  "1m",
+			HardDeleteGracePeriod:  "10m",
+		},
+		{
+			Name:                   "second",
+			CloudProviderGroupName: "second",
+			LabelKey:               "customer",
+			LabelValue:             "second",
+			MaxNodes:               10,
+			SoftDeleteGracePeriod:  "1m",
+			HardDeleteGracePeriod:  "10m",
+		},
+	}
+	var nodes []*v1.Node
+	testCloudProvider := test.NewCloudProvider(2)
+	for _, nodeGroupOpts := range nodeGroups {
+		nodes = append(nodes, test.BuildTestNodes(2, test.NodeOpts{
+			CPU:        1000,
+			Mem:        1000,
+			LabelKey:   nodeGroupOpts.LabelKey,
+			LabelValue: nodeGroupOpts.LabelValue,
+			Tainted:    true,
+		})...)
+		testCloudProvider.RegisterNodeGroup(test.NewNodeGroup(nodeGroupOpts.Name, 0, 10, 2))
+	}
+	for i, node := range nodes {
+		node.Name = fmt.Sprintf("node-%v", i)
+	}
+	client, opts := buildTestClient(nodes, nil, nodeGroups, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+
+	// move past the soft delete grace period of the taints
+	mockClock.Add(5 * time.Minute)
+
+	controller := &Controller{
+		Client:          client,
+		Opts:            opts,
+		nodeGroups:      nodeGroupsState,
+		cloudProvider:   testCloudProvider,
+		deletionLimiter: newDeletionLimiter(3, mockClock.Now()),
+	}
+
+	tryRemove := func(name string, taintedNodes []*v1.Node) int {
+		nodeGroup := nodeGroupsState[name]
+		nodeGroup.NodeInfoMap = k8s.CreateNodeNameToInfoMap(nil, taintedNodes)
+		removed, err := controller.TryRemoveTaintedNodes(scaleOpts{
+			nodes:        taintedNodes,
+			taintedNodes: taintedNodes,
+			nodeGroup:    nodeGroup,
+		})
+		assert.NoError(t, err)
+		return removed
+	}
+
+	// the limit is shared by the node groups, the node over the limit is deferred
+	assert.Equal(t, -2, tryRemove("first", nodes[:2]))
+	assert.Equal(t, -1, tryRemove("second", nodes[2:]))
+	assert.Equal(t, 0, tryRemove("second", nodes[3:]))
+
+	// the deferred node is deleted once the limit has refilled
+	mockClock.Add(20 * time.Second)
+	assert.Equal(t, -1, tryRemove("second", nodes[3:]))
+}
+
+func TestScaleNodeGroupMinReadyNodesForScaleDown(t *testing.T) {
+	nodeGroupOptions := NodeGroupOptions{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           5,
+		MaxNodes:                           100,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		FastNodeRemovalRate:                4,
+		SlowNodeRemovalRate:                2,
+		SoftDeleteGracePeriod:              "1m",
+		HardDeleteGracePeriod:              "10m",
+		ScaleUpCoolDownPeriod:              "1m",
+		MinReadyNodesForScaleDown:          8,
+	}
+
+	tests := []struct {
+		name        string
+		notReady    int
+		wantDelta   int
+		wantBlocked float64
+	}{
+		{"scale down is suppressed with too few Ready nodes", 3, 0, 1},
+		{"scale down once enough nodes are Ready", 2, -4, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{nodeGroupOptions}
+			nodes := buildTestNodes(10, 2000, 8000)
+			for _, node := range nodes[:tt.notReady] {
+				node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+			}
+			client, opts := buildTestClient(nodes, buildTestPods(0, 0, 0), nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testCloudProvider.RegisterNodeGroup(test.NewNodeGroup("default", 5, 100, int64(len(nodes))))
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantDelta, nodesDelta)
+			assert.Equal(t, tt.wantBlocked, testutil.ToFloat64(metrics.NodeGroupScaleDownBlocked.WithLabelValues("default", scaleDownBlockedMinReadyNodes)))
+			assert.Equal(t, 0.0, testutil.ToFloat64(metrics.NodeGroupScaleDownBlocked.WithLabelValues("default", scaleDownBlockedDelayAfterAdd)))
+		})
+	}
+}
+
+func TestControllerTryRemoveTaintedNodesAuditLog(t *testing.T) {
+	nodeGroup := NodeGroupOptions{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MaxNodes:               10,
+		SoftDeleteGracePeriod:  "1m",
+		HardDeleteGracePeriod:  "10m",
+	}
+	nodes := test.BuildTestNodes(2, test.NodeOpts{
+		CPU:     1000,
+		Mem:     1000,
+		Tainted: true,
+	})
+	for i, node := range nodes {
+		node.Name = fmt.Sprintf("node-%v", i)
+		node.Spec.ProviderID = fmt.Sprintf("aws:///us-east-1a/i-%v", i)
+	}
+	// the second node isn't empty, so is only deleted once the hard delete grace period has passed
+	pods := []*v1.Pod{test.BuildTestPod(test.PodOpts{Name: "p0", CPU: []int64{100}, Mem: []int64{100}, NodeName: "node-1"})}
+	client, opts := buildTestClient(nodes, pods, []NodeGroupOptions{nodeGroup}, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+
+	var auditLog, events bytes.Buffer
+	opts.AuditLog = audit.New(&auditLog)
+	opts.EventStream = eventstream.New(&events)
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testCloudProvider.RegisterNodeGroup(test.NewNodeGroup("default", 0, 10, 2))
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: []NodeGroupOptions{nodeGroup},
+		client:     *client,
+	})
+	nodeGroupsState["default"].NodeInfoMap = k8s.CreateNodeNameToInfoMap(pods, nodes)
+
+	mockClock.Add(5 * time.Minute)
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	tryRemove := func(taintedNodes []*v1.Node) map[string]interface{} {
+		auditLog.Reset()
+		events.Reset()
+		_, err := controller.TryRemoveTaintedNodes(scaleOpts{
+			nodes:        taintedNodes,
+			taintedNodes: taintedNodes,
+			nodeGroup:    nodeGroupsState["default"],
+		})
+		require.NoError(t, err)
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(auditLog.Bytes(), &entry))
+		return entry
+	}
+
+	entry := tryRemove(nodes)
+	assert.Equal(t, audit.EventNodesDeleted, entry["event"])
+	assert.Equal(t, "default", entry["nodegroup"])
+	assert.Equal(t, []interface{}{"node-0"}, entry["nodes"])
+	assert.Equal(t, []interface{}{"i-0"}, entry["instance_ids"])
+	assert.Equal(t, "tainted node empty after soft_delete_grace_period", entry["reason"])
+	var event eventstream.Event
+	require.NoError(t, json.Unmarshal(events.Bytes(), &event))
+	assert.Equal(t, eventstream.EventDelete, event.Type)
+	assert.Equal(t, []string{"node-0"}, event.Nodes)
+	assert.Equal(t, "tainted node empty after soft_delete_grace_period", event.Reason)
+
+	mockClock.Add(10 * time.Minute)
+	entry = tryRemove(nodes[1:])
+	assert.Equal(t, []interface{}{"node-1"}, entry["nodes"])
+	assert.Equal(t, []interface{}{"i-1"}, entry["instance_ids"])
+	assert.Equal(t, "tainted node passed hard_delete_grace_period", entry["reason"])
+	require.NoError(t, json.Unmarshal(events.Bytes(), &event))
+	assert.Equal(t, []string{"node-1"}, event.Nodes)
+	assert.Equal(t, "tainted node passed hard_delete_grace_period", event.Reason)
+}
+
+func TestControllerTryRemoveTaintedNodesTaintOnly(t *testing.T) {
+	nodeGroup := NodeGroupOptions{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MaxNodes:               10,
+		SoftDeleteGracePeriod:  "1m",
+		HardDeleteGracePeriod:  "10m",
+		Mode:                   NodeGroupModeTaintOnly,
+	}
+	nodes := test.BuildTestNodes(2, test.NodeOpts{
+		CPU:     1000,
+		Mem:     1000,
+		Tainted: true,
+	})
+	client, opts := buildTestClient(nodes, nil, []NodeGroupOptions{nodeGroup}, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 0, 10, 2)
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: []NodeGroupOptions{nodeGroup},
+		client:     *client,
+	})
+	nodeGroupsState["default"].NodeInfoMap = k8s.CreateNodeNameToInfoMap(nil, nodes)
+
+	mockClock.Add(15 * time.Minute)
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+	tryRemove := func() int {
+		removed, err := controller.TryRemoveTaintedNodes(scaleOpts{
+			nodes:        nodes,
+			taintedNodes: nodes,
+			nodeGroup:    nodeGroupsState["default"],
+		})
+		require.NoError(t, err)
+		return removed
+	}
+
+	// the nodes are past their grace periods, but taint_only never deletes them
+	assert.Equal(t, 0, tryRemove())
+	assert.Equal(t, int64(2), testNodeGroup.TargetSize())
+
+	nodeGroupsState["default"].Opts.Mode = NodeGroupModeActive
+	assert.Equal(t, -2, tryRemove())
+	assert.Equal(t, int64(0), testNodeGroup.TargetSize())
+}
+
+// scale down being suppressed must never stop a node group scaling up when demand rises
+func TestScaleNodeGroupScaleUpWhilstScaleDownSuppressed(t *testing.T) {
+	nodeGroupOptions := NodeGroupOptions{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           5,
+		MaxNodes:                           100,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		FastNodeRemovalRate:                4,
+		SlowNodeRemovalRate:                2,
+		SoftDeleteGracePeriod:              "1m",
+		HardDeleteGracePeriod:              "10m",
+		ScaleUpCoolDownPeriod:              "1m",
+		ScaleDownDelayAfterAdd:             "10m",
+		MinReadyNodesForScaleDown:          10,
+	}
+
+	tests := []struct {
+		name        string
+		pods        []*v1.Pod
+		wantDelta   int
+		wantBlocked float64
+	}{
+		{"low demand is suppressed from scaling down", buildTestPods(10, 100, 100), 0, 1},
+		{"high demand scales up straight away", buildTestPods(100, 200, 200), 5, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{nodeGroupOptions}
+			nodes := buildTestNodes(10, 2000, 2000)
+			// one node isn't Ready, so min_ready_nodes_for_scale_down suppresses scale down as well
+			nodes[0].Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+			client, opts := buildTestClient(nodes, tt.pods, nodeGroups, ListerOptions{})
+			mockClock := newManualClock(time.Now())
+			opts.Clock = mockClock
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 5, 100, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			// the node group has just scaled up, so scale_down_delay_after_add is active
+			nodeGroupsState["default"].lastScaleUp = mockClock.Now()
+
+			nodesDelta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantDelta, nodesDelta)
+			assert.Equal(t, int64(len(nodes)+tt.wantDelta), testNodeGroup.TargetSize())
+			assert.Equal(t, tt.wantBlocked, testutil.ToFloat64(metrics.NodeGroupScaleDownBlocked.WithLabelValues("default", scaleDownBlockedDelayAfterAdd)))
+			assert.Equal(t, tt.wantBlocked, testutil.ToFloat64(metrics.NodeGroupScaleDownBlocked.WithLabelValues("default", scaleDownBlockedMinReadyNodes)))
+		})
+	}
+}
+
+func TestControllerTryRemoveTaintedNodesCordonBeforeDrain(t *testing.T) {
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MinNodes:               0,
+		MaxNodes:               10,
+		SoftDeleteGracePeriod:  "1m",
+		HardDeleteGracePeriod:  "10m",
+		DrainTimeout:           "10m",
+		MaxConcurrentDrains:    1,
+		CordonBeforeDrain:      true,
+	}
+	nodes := make([]*v1.Node, 0, 2)
+	pods := make([]*v1.Pod, 0, 2)
+	for i := 0; i < 2; i++ {
+		nodes = append(nodes, test.BuildTestNode(test.NodeOpts{
+			Name:    fmt.Sprintf("node-%v", i),
+			CPU:     1000,
+			Mem:     1000,
+			Tainted: true,
+		}))
+		pods = append(pods, test.BuildTestPod(test.PodOpts{
+			Name:     fmt.Sprintf("pod-%v", i),
+			NodeName: fmt.Sprintf("node-%v", i),
+		}))
+	}
+	client, opts := buildTestClient(nodes, pods, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testCloudProvider.RegisterNodeGroup(test.NewNodeGroup("default", 0, 10, int64(len(nodes))))
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+		client:     *client,
+	})
+	nodeGroupsState["default"].NodeInfoMap = k8s.CreateNodeNameToInfoMap(pods, nodes)
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// move past the hard delete grace period of the taints
+	mockClock.Add(time.Hour)
+
+	removed, err := controller.TryRemoveTaintedNodes(scaleOpts{
+		nodes:        nodes,
+		taintedNodes: nodes,
+		nodeGroup:    nodeGroupsState["default"],
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	// both nodes are cordoned, even though only one can be drained at a time
+	assert.Len(t, nodeGroupsState["default"].drainingSince, 1)
+	cordoned := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		updated, err := opts.K8SClient.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.True(t, updated.Spec.Unschedulable)
+		cordoned = append(cordoned, updated)
+	}
+
+	// the cordoned nodes are still tainted nodes being removed
+	untainted, tainted, cordonedNodes := controller.filterNodes(nodeGroupsState["default"], cordoned)
+	assert.Empty(t, untainted)
+	assert.Len(t, tainted, 2)
+	assert.Empty(t, cordonedNodes)
+
+	// untainting a node reverts its cordon so it can take pods again
+	assert.Len(t, controller.untaintNewestN(cordoned[:1], nodeGroupsState["default"], 1), 1)
+	updated, err := opts.K8SClient.CoreV1().Nodes().Get(cordoned[0].Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.False(t, updated.Spec.Unschedulable)
+}
+
+func TestControllerTryRemoveTaintedNodesCordonBeforeDrainAborted(t *testing.T) {
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                         "default",
+		CloudProviderGroupName:       "default",
+		MinNodes:                     0,
+		MaxNodes:                     10,
+		SoftDeleteGracePeriod:        "1m",
+		HardDeleteGracePeriod:        "10m",
+		DrainTimeout:                 "10m",
+		CordonBeforeDrain:            true,
+		ScaleDownNodeDeleteInterval:  "20ms",
+		ScaleDownNodeDeleteBatchSize: 1,
+	}
+	nodes := test.BuildTestNodes(3, test.NodeOpts{
+		CPU:     1000,
+		Mem:     1000,
+		Tainted: true,
+	})
+	client, opts := buildTestClient(nodes, nil, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 0, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+		client:     *client,
+	})
+
+	// stopping aborts the removal after the first batch
+	stopChan := make(chan struct{})
+	close(stopChan)
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      stopChan,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	mockClock.Add(time.Hour)
+
+	removed, err := controller.TryRemoveTaintedNodes(scaleOpts{
+		nodes:        nodes,
+		taintedNodes: nodes,
+		nodeGroup:    nodeGroupsState["default"],
+	})
+	require.NoError(t, err)
+	assert.Equal(t, -1, removed)
+	assert.Equal(t, int64(2), testNodeGroup.TargetSize())
+
+	// the nodes that weren't deleted are uncordoned again
+	uncordoned := 0
+	for _, node := range nodes {
+		updated, err := opts.K8SClient.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+		if err == nil && !updated.Spec.Unschedulable {
+			uncordoned++
+		}
+	}
+	assert.Equal(t, 2, uncordoned)
+}
+
+func TestControllerTryRemoveTaintedNodesRequireEmptyBeforeDelete(t *testing.T) {
+	tests := []struct {
+		name                     string
+		requireEmptyBeforeDelete bool
+		podRunning               bool
+		sinceTainted             time.Duration
+		wantRemoved              int
+	}{
+		{"empty node waits for the soft delete grace period by default", false, false, 10 * time.Second, 0},
+		{"empty node is deleted before the soft delete grace period", true, false, 10 * time.Second, -1},
+		{"node with pods is not deleted before the hard delete grace period", true, true, 5 * time.Minute, 0},
+		{"node with pods is deleted after the hard delete grace period", true, true, 11 * time.Minute, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroupOpts := NodeGroupOptions{
+				Name:                     "default",
+				CloudProviderGroupName:   "default",
+				MinNodes:                 0,
+				MaxNodes:                 10,
+				SoftDeleteGracePeriod:    "1m",
+				HardDeleteGracePeriod:    "10m",
+				RequireEmptyBeforeDelete: tt.requireEmptyBeforeDelete,
+			}
+			nodes := []*v1.Node{test.BuildTestNode(test.NodeOpts{
+				Name:    "node",
+				CPU:     1000,
+				Mem:     1000,
+				Tainted: true,
+			})}
+			var pods []*v1.Pod
+			if tt.podRunning {
+				pods = append(pods, test.BuildTestPod(test.PodOpts{
+					Name:     "pod",
+					NodeName: "node",
+				}))
+			}
+			client, opts := buildTestClient(nodes, pods, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+			mockClock := newManualClock(time.Now())
+			opts.Clock = mockClock
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 0, 10, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+				client:     *client,
+			})
+			nodeGroupsState["default"].NodeInfoMap = k8s.CreateNodeNameToInfoMap(pods, nodes)
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			mockClock.Add(tt.sinceTainted)
+
+			removed, err := controller.TryRemoveTaintedNodes(scaleOpts{
+				nodes:        nodes,
+				taintedNodes: nodes,
+				nodeGroup:    nodeGroupsState["default"],
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRemoved, removed)
+			assert.Equal(t, int64(len(nodes)+tt.wantRemoved), testNodeGroup.TargetSize())
+		})
+	}
+}
+
+func TestControllerTryRemoveTaintedNodesFastDeleteCompletedJobs(t *testing.T) {
+	tests := []struct {
+		name                    string
+		fastDeleteCompletedJobs bool
+		pods                    []*v1.Pod
+		wantRemoved             int
+	}{
+		{
+			"completed jobs wait for the soft delete grace period by default",
+			false,
+			[]*v1.Pod{test.BuildTestPod(test.PodOpts{Name: "job", NodeName: "node", Owner: "Job", Phase: v1.PodSucceeded})},
+			0,
+		},
+		{
+			"completed jobs are deleted before the soft delete grace period",
+			true,
+			[]*v1.Pod{
+				test.BuildTestPod(test.PodOpts{Name: "job", NodeName: "node", Owner: "Job", Phase: v1.PodSucceeded}),
+				test.BuildTestPod(test.PodOpts{Name: "failed-job", NodeName: "node", Owner: "Job", Phase: v1.PodFailed}),
+				test.BuildTestPod(test.PodOpts{Name: "daemonset", NodeName: "node", Owner: "DaemonSet", Phase: v1.PodRunning}),
+			},
+			-1,
+		},
+		{
+			"running job waits for the soft delete grace period",
+			true,
+			[]*v1.Pod{test.BuildTestPod(test.PodOpts{Name: "job", NodeName: "node", Owner: "Job", Phase: v1.PodRunning})},
+			0,
+		},
+		{
+			"completed pods not owned by jobs wait for the soft delete grace period",
+			true,
+			[]*v1.Pod{test.BuildTestPod(test.PodOpts{Name: "pod", NodeName: "node", Phase: v1.PodSucceeded})},
+			0,
+		},
+		{
+			"empty node waits for the soft delete grace period",
+			true,
+			nil,
+			0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroupOpts := NodeGroupOptions{
+				Name:                    "default",
+				CloudProviderGroupName:  "default",
+				MinNodes:                0,
+				MaxNodes:                10,
+				SoftDeleteGracePeriod:   "1m",
+				HardDeleteGracePeriod:   "10m",
+				FastDeleteCompletedJobs: tt.fastDeleteCompletedJobs,
+			}
+			nodes := []*v1.Node{test.BuildTestNode(test.NodeOpts{
+				Name:    "node",
+				CPU:     1000,
+				Mem:     1000,
+				Tainted: true,
+			})}
+			client, opts := buildTestClient(nodes, tt.pods, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+			mockClock := newManualClock(time.Now())
+			opts.Clock = mockClock
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 0, 10, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+				client:     *client,
+			})
+			// the pod watcher doesn't watch terminated pods
+			var watched []*v1.Pod
+			for _, pod := range tt.pods {
+				if !k8s.PodIsTerminated(pod) {
+					watched = append(watched, pod)
+				}
+			}
+			nodeGroupsState["default"].NodeInfoMap = k8s.CreateNodeNameToInfoMap(watched, nodes)
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				stopChan:      nil,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			mockClock.Add(10 * time.Second)
+
+			removed, err := controller.TryRemoveTaintedNodes(scaleOpts{
+				nodes:        nodes,
+				taintedNodes: nodes,
+				nodeGroup:    nodeGroupsState["default"],
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRemoved, removed)
+			assert.Equal(t, int64(len(nodes)+tt.wantRemoved), testNodeGroup.TargetSize())
+		})
+	}
+}
+
+func TestControllerTryRemoveTaintedNodesPartialDeletion(t *testing.T) {
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                   "partial",
+		CloudProviderGroupName: "partial",
+		MinNodes:               0,
+		MaxNodes:               10,
+		SoftDeleteGracePeriod:  "1m",
+		HardDeleteGracePeriod:  "10m",
+	}
+	nodes := test.BuildTestNodes(4, test.NodeOpts{
+		CPU:     1000,
+		Mem:     1000,
+		Tainted: true,
+	})
+	client, opts := buildTestClient(nodes, nil, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("partial", 0, 10, int64(len(nodes)))
+	testNodeGroup.SetDeleteFailure(nodes[1].Name, fmt.Errorf("instance is protected from scale in"))
+	testNodeGroup.SetDeleteFailure(nodes[2].Name, fmt.Errorf("instance is protected from scale in"))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+		client:     *client,
+	})
+	nodeGroup := nodeGroupsState["partial"]
+	nodeGroup.NodeInfoMap = k8s.CreateNodeNameToInfoMap(nil, nodes)
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      nil,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	mockClock.Add(5 * time.Minute)
+
+	// only the 2 nodes the cloud provider terminated are counted as removed
+	removed, err := controller.TryRemoveTaintedNodes(scaleOpts{
+		nodes:        nodes,
+		taintedNodes: nodes,
+		nodeGroup:    nodeGroup,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, -2, removed)
+	assert.Equal(t, int64(2), testNodeGroup.TargetSize())
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.NodeGroupPartialDeletions.WithLabelValues("partial")))
+
+	// the surviving nodes are still tainted and are removed by a later scan
+	survivors := []*v1.Node{nodes[1], nodes[2]}
+	for _, node := range survivors {
+		_, tainted := k8s.GetToBeRemovedTaint(node)
+		assert.True(t, tainted)
+		testNodeGroup.SetDeleteFailure(node.Name, nil)
+	}
+	removed, err = controller.TryRemoveTaintedNodes(scaleOpts{
+		nodes:        survivors,
+		taintedNodes: survivors,
+		nodeGroup:    nodeGroup,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, -2, removed)
+	assert.Equal(t, int64(0), testNodeGroup.TargetSize())
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.NodeGroupPartialDeletions.WithLabelValues("partial")))
+}
+
+func TestControllerTryRemoveTaintedNodesNotOwned(t *testing.T) {
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                   "buildeng",
+		LabelKey:               "customer",
+		LabelValue:             "buildeng",
+		CloudProviderGroupName: "buildeng",
+		MinNodes:               0,
+		MaxNodes:               10,
+		SoftDeleteGracePeriod:  "1m",
+		HardDeleteGracePeriod:  "10m",
+	}
+	nodes := test.BuildTestNodes(2, test.NodeOpts{
+		CPU:        1000,
+		Mem:        1000,
+		LabelKey:   "customer",
+		LabelValue: "buildeng",
+		Tainted:    true,
+	})
+	other := test.BuildTestNode(test.NodeOpts{
+		Name:       "other",
+		CPU:        1000,
+		Mem:        1000,
+		LabelKey:   "customer",
+		LabelValue: "other",
+		Tainted:    true,
+	})
+	allNodes := append([]*v1.Node{other}, nodes...)
+	client, opts := buildTestClient(allNodes, nil, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("buildeng", 0, 10, int64(len(allNodes)))
+	testNodeGroup.SetNotOwned(other.Name)
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+		client:     *client,
+	})
+	nodeGroup := nodeGroupsState["buildeng"]
+	nodeGroup.NodeInfoMap = k8s.CreateNodeNameToInfoMap(nil, allNodes)
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      nil,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	mockClock.Add(5 * time.Minute)
+
+	// the node of another cloud provider node group is never deleted, even when passed to the node group, and doesn't
+	// stop the others being deleted
+	removed, err := controller.TryRemoveTaintedNodes(scaleOpts{
+		nodes:        allNodes,
+		taintedNodes: allNodes,
+		nodeGroup:    nodeGroup,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, -2, removed)
+	assert.Equal(t, int64(1), testNodeGroup.TargetSize())
+	_, err = client.CoreV1().Nodes().Get(other.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestControllerTryRemoveTaintedNodesScanTimeout(t *testing.T) {
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                   "timeout",
+		CloudProviderGroupName: "timeout",
+		MinNodes:               0,
+		MaxNodes:               10,
+		SoftDeleteGracePeriod:  "1m",
+		HardDeleteGracePeriod:  "10m",
+		CordonBeforeDrain:      true,
+	}
+	nodes := test.BuildTestNodes(2, test.NodeOpts{
+		CPU:     1000,
+		Mem:     1000,
+		Tainted: true,
+	})
+	client, opts := buildTestClient(nodes, nil, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("timeout", 0, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+		client:     *client,
+	})
+	nodeGroup := nodeGroupsState["timeout"]
+	nodeGroup.NodeInfoMap = k8s.CreateNodeNameToInfoMap(nil, nodes)
+
+	mockClock.Add(5 * time.Minute)
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      nil,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+		scanDeadline:  mockClock.Now(),
+	}
+
+	// the nodes stay tainted and uncordoned to be deleted in the next scan
+	removed, err := controller.TryRemoveTaintedNodes(scaleOpts{
+		nodes:        nodes,
+		taintedNodes: nodes,
+		nodeGroup:    nodeGroup,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	assert.Equal(t, int64(2), testNodeGroup.TargetSize())
+	for _, node := range nodes {
+		updated, err := client.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		_, tainted := k8s.GetToBeRemovedTaint(updated)
+		assert.True(t, tainted)
+		assert.False(t, updated.Spec.Unschedulable)
+	}
+}
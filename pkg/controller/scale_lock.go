@@ -18,35 +18,37 @@ type scaleLock struct {
 	nodegroup string
 }
 
-// locked returns whether the scale lock is locked
-func (l *scaleLock) locked() bool {
-	if time.Now().Sub(l.lockTime) < l.minimumLockDuration {
+// locked returns whether the scale lock is locked at now
+func (l *scaleLock) locked(now time.Time) bool {
+	if now.Sub(l.lockTime) < l.minimumLockDuration {
 		metrics.NodeGroupScaleLockCheckWasLocked.WithLabelValues(l.nodegroup).Add(1.0)
 		return true
 	}
-	l.unlock()
+	l.unlock(now)
 	return l.isLocked
 }
 
-// lock locks the scale lock
-func (l *scaleLock) lock(nodes int) {
+// lock locks the scale lock at now
+func (l *scaleLock) lock(nodes int, now time.Time) {
 	// Using `Add` instead of `Set` to catch locking when already locked
 	metrics.NodeGroupScaleLock.WithLabelValues(l.nodegroup).Add(1.0)
+	// the nodes requested whilst already locked, e.g. by an emergency scale up, are added to the upcoming nodes
 	if l.isLocked {
 		log.Warn("Scale lock already locked")
+		nodes += l.requestedNodes
 	}
 	log.Debug("Locking scale lock")
 	l.isLocked = true
 	l.requestedNodes = nodes
-	l.lockTime = time.Now()
+	l.lockTime = now
 }
 
-// unlock unlocks the scale lock
-func (l *scaleLock) unlock() {
+// unlock unlocks the scale lock at now
+func (l *scaleLock) unlock(now time.Time) {
 	// Only if it's already locked, otherwise noop; handles frequent forced unlocking from the locked() call to avoid spurious metrics submission
 	if l.isLocked {
 		// Recording the lock duration in seconds, if $cloud provider could do scaling in nanosecond resolution; good problem to have.
-		lockDuration := time.Now().Sub(l.lockTime).Seconds()
+		lockDuration := now.Sub(l.lockTime).Seconds()
 		log.Debug(fmt.Sprintf("Unlocking scale lock. Lock Duration: %0.0f s Node Group: %s", lockDuration, l.nodegroup))
 		l.isLocked = false
 		l.requestedNodes = 0
@@ -55,16 +57,17 @@ func (l *scaleLock) unlock() {
 	}
 }
 
-// timeUntilMinimumUnlock returns the the time until the minimum unlock
-func (l *scaleLock) timeUntilMinimumUnlock() time.Duration {
-	return l.lockTime.Add(l.minimumLockDuration).Sub(time.Now())
+// timeUntilMinimumUnlock returns the the time from now until the minimum unlock
+func (l *scaleLock) timeUntilMinimumUnlock(now time.Time) time.Duration {
+	return l.lockTime.Add(l.minimumLockDuration).Sub(now)
 }
 
-func (l scaleLock) String() string {
+// describe returns the state of the scale lock at now for logging
+func (l *scaleLock) describe(now time.Time) string {
 	return fmt.Sprintf(
 		"lock(%v): there are %v upcoming nodes requested, %v before min cooldown.",
-		l.locked(),
+		l.locked(now),
 		l.requestedNodes,
-		l.timeUntilMinimumUnlock(),
+		l.timeUntilMinimumUnlock(now),
 	)
 }
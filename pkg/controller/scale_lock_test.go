@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScaleLock(t *testing.T) {
+	now := time.Now()
+
+	lock := scaleLock{
+		minimumLockDuration: time.Minute,
+		nodegroup:           "default",
+	}
+	assert.False(t, lock.locked(now))
+
+	lock.lock(3, now)
+	assert.True(t, lock.locked(now))
+	assert.Equal(t, 3, lock.requestedNodes)
+	assert.Equal(t, time.Minute, lock.timeUntilMinimumUnlock(now))
+
+	// the lock is held until the minimum lock duration has passed
+	now = now.Add(59 * time.Second)
+	assert.True(t, lock.locked(now))
+	assert.Equal(t, time.Second, lock.timeUntilMinimumUnlock(now))
+
+	now = now.Add(time.Second)
+	assert.False(t, lock.locked(now))
+	assert.Equal(t, 0, lock.requestedNodes)
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/atlassian/escalator/pkg/cloudprovider"
 	"github.com/atlassian/escalator/pkg/k8s"
 	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/tracing"
 	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 )
@@ -20,6 +22,10 @@ func (c *Controller) ScaleUp(opts scaleOpts) (int, error) {
 		return untainted, err
 	}
 
+	if untainted > 0 {
+		opts.nodeGroup.lastScaleUp = c.clock().Now()
+	}
+
 	// remove the number of nodes that were just untainted and the remaining is how much to increase the cloud provider node group by
 	opts.nodesDelta -= untainted
 
@@ -32,15 +38,22 @@ func (c *Controller) ScaleUp(opts scaleOpts) (int, error) {
 
 		if opts.nodesDelta > 0 {
 			added, err := c.scaleUpCloudProviderNodeGroup(opts)
-			if err != nil {
+			if err != nil && added == 0 {
 				log.Errorf("Failed to add nodes because of an error. Skipping cloud provider node group scaleup: %v", err)
+				c.recordScaleUp(opts.nodeGroup.Opts.Name, untainted, 0)
 				return 0, err
 			}
-			opts.nodeGroup.scaleUpLock.lock(added)
-			return untainted + added, nil
+			// a partial scale up is locked for the nodes that were added, so they aren't requested again next scan
+			opts.nodeGroup.scaleUpLock.lock(added, c.clock().Now())
+			opts.nodeGroup.awaitingCapacity = !c.dryMode(opts.nodeGroup)
+			opts.nodeGroup.lastScaleUp = c.clock().Now()
+			c.recordScaleUpTrigger(opts, added)
+			c.recordScaleUp(opts.nodeGroup.Opts.Name, untainted, added)
+			return untainted + added, err
 		}
 	}
 
+	c.recordScaleUp(opts.nodeGroup.Opts.Name, untainted, 0)
 	return untainted, nil
 }
 
@@ -57,7 +70,7 @@ func (c *Controller) calculateNodesToAdd(nodesToAdd int64, TargetSize int64, Max
 // scaleUpCloudProviderNodeGroup increases the size of the cloud provider node group by opts.nodesDelta
 func (c *Controller) scaleUpCloudProviderNodeGroup(opts scaleOpts) (int, error) {
 
-	cloudProviderNodeGroup, ok := c.cloudProvider.GetNodeGroup(opts.nodeGroup.Opts.CloudProviderGroupName)
+	cloudProviderNodeGroup, ok := getCloudProviderNodeGroup(c.cloudProvider, opts.nodeGroup.Opts)
 	if !ok {
 		return 0, fmt.Errorf("cloud provider node group does not exist: %s", opts.nodeGroup.Opts.CloudProviderGroupName)
 	}
@@ -65,11 +78,10 @@ func (c *Controller) scaleUpCloudProviderNodeGroup(opts scaleOpts) (int, error)
 	nodegroupName := opts.nodeGroup.Opts.Name
 	nodesToAdd := c.calculateNodesToAdd(int64(opts.nodesDelta), cloudProviderNodeGroup.TargetSize(), cloudProviderNodeGroup.MaxSize())
 	if nodesToAdd <= 0 {
-		err := fmt.Errorf(
-			"refusing to scaleup up beyond the maximum size of the autoscaling group (TargetSize: %v; MaxNodes: %v). Taking no action",
-			cloudProviderNodeGroup.TargetSize(),
-			opts.nodeGroup.Opts.MaxNodes,
-		)
+		err := &maxNodesReachedError{
+			targetSize: cloudProviderNodeGroup.TargetSize(),
+			maxNodes:   opts.nodeGroup.Opts.MaxNodes,
+		}
 		log.WithError(err).Error("Cancelling scaleup")
 		return 0, err
 	}
@@ -81,11 +93,23 @@ func (c *Controller) scaleUpCloudProviderNodeGroup(opts scaleOpts) (int, error)
 			Infof("increasing cloud provider node group by %v", nodesToAdd)
 
 		if !drymode {
+			_, span := tracing.StartSpan(opts.ctx, "CloudProviderIncreaseSize",
+				tracing.String("nodegroup", nodegroupName),
+				tracing.Int64("delta", nodesToAdd),
+			)
 			err := cloudProviderNodeGroup.IncreaseSize(nodesToAdd)
+			tracing.EndSpan(span, err)
+			if partial, ok := err.(*cloudprovider.PartialIncreaseError); ok {
+				// the nodes that were added are requested again if they are still needed once the scale lock is released
+				log.WithField("nodegroup", nodegroupName).Errorf("failed to set cloud provider node group size: %v", err)
+				c.Opts.AuditLog.NodesCreated(nodegroupName, cloudProviderNodeGroup.ID(), partial.Added, cloudProviderNodeGroup.TargetSize(), opts.reason)
+				return int(partial.Added), err
+			}
 			if err != nil {
 				log.Errorf("failed to set cloud provider node group size: %v", err)
 				return 0, err
 			}
+			c.Opts.AuditLog.NodesCreated(nodegroupName, cloudProviderNodeGroup.ID(), nodesToAdd, cloudProviderNodeGroup.TargetSize(), opts.reason)
 		}
 	} else {
 		return 0, fmt.Errorf("adding %v nodes would breach max cloud provider node group size (%v)", nodesToAdd, cloudProviderNodeGroup.MaxSize())
@@ -131,7 +155,7 @@ func (c *Controller) untaintNewestN(nodes []*v1.Node, nodeGroup *NodeGroupState,
 		// only actually taint in dry mode
 		if !c.dryMode(nodeGroup) {
 			if _, tainted := k8s.GetToBeRemovedTaint(bundle.node); tainted {
-				log.WithField("drymode", "off").Infof("Untainting node %v", bundle.node.Name)
+				nodeGroup.nodeLog(bundle.node).WithField("drymode", "off").Infof("Untainting node %v", bundle.node.Name)
 
 				// Remove the taint from the node
 				updatedNode, err := k8s.DeleteToBeRemovedTaint(bundle.node, c.Client)
@@ -140,6 +164,12 @@ func (c *Controller) untaintNewestN(nodes []*v1.Node, nodeGroup *NodeGroupState,
 				} else {
 					bundle.node = updatedNode
 					untaintedIndices = append(untaintedIndices, bundle.index)
+					// the node may have been cordoned by cordon_before_drain, it can take pods again now it isn't being removed
+					if nodeGroup.Opts.CordonBeforeDrain && updatedNode.Spec.Unschedulable {
+						if _, err := k8s.UncordonNode(updatedNode, c.Client); err != nil {
+							log.Errorf("Failed to uncordon node %v: %v", bundle.node.Name, err)
+						}
+					}
 				}
 			}
 		} else {
@@ -154,7 +184,7 @@ func (c *Controller) untaintNewestN(nodes []*v1.Node, nodeGroup *NodeGroupState,
 				// Delete from tracker
 				nodeGroup.taintTracker = append(nodeGroup.taintTracker[:deleteIndex], nodeGroup.taintTracker[deleteIndex+1:]...)
 				untaintedIndices = append(untaintedIndices, bundle.index)
-				log.WithField("drymode", "on").Infof("Untainting node %v", bundle.node.Name)
+				nodeGroup.nodeLog(bundle.node).WithField("drymode", "on").Infof("Untainting node %v", bundle.node.Name)
 			}
 		}
 	}
@@ -1,13 +1,18 @@
 package controller
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/atlassian/escalator/pkg/audit"
 	"github.com/atlassian/escalator/pkg/k8s"
 	"github.com/atlassian/escalator/pkg/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"k8s.io/api/core/v1"
 )
 
@@ -164,7 +169,7 @@ func TestControllerUntaintNewestN(t *testing.T) {
 			var tc int
 			for _, node := range nodes {
 				if _, tainted := k8s.GetToBeRemovedTaint(node); !tainted {
-					k8s.AddToBeRemovedTaint(node, client)
+					k8s.AddToBeRemovedTaint(node, client, time.Now())
 					nodeGroupsState["buildeng"].taintTracker = append(nodeGroupsState["buildeng"].taintTracker, node.Name)
 					<-updateChan
 					tc++
@@ -248,3 +253,230 @@ func TestCalculateNodesToAdd(t *testing.T) {
 		})
 	}
 }
+
+func TestControllerScaleUpAuditLog(t *testing.T) {
+	nodeGroup := NodeGroupOptions{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MinNodes:               1,
+		MaxNodes:               10,
+		ScaleUpCoolDownPeriod:  "1m",
+	}
+	nodes := buildTestNodes(2, 1000, 1000)
+	client, opts := buildTestClient(nodes, nil, []NodeGroupOptions{nodeGroup}, ListerOptions{})
+
+	var auditLog bytes.Buffer
+	opts.AuditLog = audit.New(&auditLog)
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testCloudProvider.RegisterNodeGroup(test.NewNodeGroup("default", 1, 10, int64(len(nodes))))
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: []NodeGroupOptions{nodeGroup},
+		client:     *client,
+	})
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	added, err := controller.ScaleUp(scaleOpts{
+		nodes:      nodes,
+		nodeGroup:  nodeGroupsState["default"],
+		nodesDelta: 3,
+		reason:     "test",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, added)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(auditLog.Bytes(), &entry))
+	assert.Equal(t, audit.EventNodesCreated, entry["event"])
+	assert.Equal(t, "default", entry["nodegroup"])
+	assert.Equal(t, float64(3), entry["count"])
+	assert.Equal(t, float64(5), entry["target_size"])
+	assert.Equal(t, "test", entry["reason"])
+
+	// nothing is created in dry mode
+	auditLog.Reset()
+	controller.Opts.DryMode = true
+	nodeGroupsState["default"].scaleUpLock.unlock(time.Now())
+	_, err = controller.ScaleUp(scaleOpts{
+		nodes:      nodes,
+		nodeGroup:  nodeGroupsState["default"],
+		nodesDelta: 1,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, auditLog.String())
+}
+
+func TestControllerScaleUpPartialIncrease(t *testing.T) {
+	nodeGroup := NodeGroupOptions{
+		Name:                    "default",
+		CloudProviderGroupName:  "default-a",
+		CloudProviderGroupNames: []string{"default-a", "default-b"},
+		MinNodes:                1,
+		MaxNodes:                20,
+		ScaleUpCoolDownPeriod:   "1m",
+	}
+	nodes := buildTestNodes(2, 1000, 1000)
+	client, opts := buildTestClient(nodes, nil, []NodeGroupOptions{nodeGroup}, ListerOptions{})
+	mockClock := newManualClock(time.Now())
+	opts.Clock = mockClock
+
+	var auditLog bytes.Buffer
+	opts.AuditLog = audit.New(&auditLog)
+
+	first := test.NewNodeGroup("default-a", 0, 10, 1)
+	second := test.NewNodeGroup("default-b", 0, 10, 1)
+	second.SetIncreaseFailure(errors.New("insufficient capacity"))
+	testCloudProvider := test.NewCloudProvider(1)
+	testCloudProvider.RegisterNodeGroup(first)
+	testCloudProvider.RegisterNodeGroup(second)
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: []NodeGroupOptions{nodeGroup},
+		client:     *client,
+	})
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// the 4 nodes are split between the member groups, only the first of which is increased
+	added, err := controller.ScaleUp(scaleOpts{
+		nodes:      nodes,
+		nodeGroup:  nodeGroupsState["default"],
+		nodesDelta: 4,
+		reason:     "test",
+	})
+	require.Error(t, err)
+	assert.Equal(t, 2, added)
+	assert.Equal(t, int64(3), first.TargetSize())
+	assert.Equal(t, int64(1), second.TargetSize())
+
+	// the scale up is locked for the nodes that were added, so they aren't requested again by the next scan
+	assert.True(t, nodeGroupsState["default"].scaleUpLock.locked(mockClock.Now()))
+	assert.Equal(t, 2, nodeGroupsState["default"].scaleUpLock.requestedNodes)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(auditLog.Bytes(), &entry))
+	assert.Equal(t, audit.EventNodesCreated, entry["event"])
+	assert.Equal(t, float64(2), entry["count"])
+	assert.Equal(t, float64(4), entry["target_size"])
+}
+
+func TestScaleNodeGroupScaleUpRamp(t *testing.T) {
+	mockClock := newManualClock(time.Now())
+
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		ScaleUpCoolDownPeriod:              "10m",
+		ScaleUpRamp:                        0.25,
+		EmergencyPendingTimeout:            "2m",
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(20, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+	opts.Clock = mockClock
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	nodeGroup := nodeGroupsState["default"]
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// 4 nodes are needed, only a quarter of them are added this scan
+	delta, err := controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delta)
+	assert.Equal(t, int64(3), testNodeGroup.TargetSize())
+
+	// the emergency scale up for pods pending longer than emergency_pending_timeout isn't ramped
+	mockClock.Add(2 * time.Minute)
+	delta, err = controller.scaleNodeGroup("default", nodeGroup)
+	require.NoError(t, err)
+	assert.Equal(t, 3, delta)
+	assert.Equal(t, int64(6), testNodeGroup.TargetSize())
+}
+
+func TestScaleNodeGroupDefaultPodRequest(t *testing.T) {
+	tests := []struct {
+		name              string
+		defaultPodRequest NodeResourceReservation
+		wantScaleUp       bool
+	}{
+		// pods without requests don't count towards the utilization, so the busy node group looks idle
+		{"pods without requests count as nothing", NodeResourceReservation{}, false},
+		{"pods without requests count as the default request", NodeResourceReservation{CPU: "200m", Memory: "200"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           1,
+				MaxNodes:                           10,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 60,
+				SlowNodeRemovalRate:                1,
+				FastNodeRemovalRate:                1,
+				ScaleUpCoolDownPeriod:              "10m",
+				SoftDeleteGracePeriod:              "1m",
+				HardDeleteGracePeriod:              "10m",
+				DefaultPodRequest:                  tt.defaultPodRequest,
+			}}
+			nodes := buildTestNodes(2, 1000, 1000)
+			var pods []*v1.Pod
+			for i := 0; i < 10; i++ {
+				pods = append(pods, test.BuildTestPod(test.PodOpts{
+					Name:     fmt.Sprintf("no-requests-%d", i),
+					NodeName: nodes[i%len(nodes)].Name,
+				}))
+			}
+			client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			delta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantScaleUp, delta > 0)
+			assert.Equal(t, !tt.wantScaleUp, delta < 0)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/k8s"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+)
+
+// ScaleUpTriggerAnnotation is the node annotation recording the scale up that added the node, see
+// annotate_scale_up_trigger
+const ScaleUpTriggerAnnotation = "escalator.atlassian.com/scale-up-trigger"
+
+// maxScaleUpTriggerPods is the most pending pods named in the annotation, to keep the annotation small
+const maxScaleUpTriggerPods = 10
+
+// scaleUpTrigger is a scale up that added nodes to the node group, as recorded in the ScaleUpTriggerAnnotation
+type scaleUpTrigger struct {
+	Time   string `json:"time"`
+	Reason string `json:"reason"`
+	// PendingPods is the number of pending pods when the scale up was made
+	PendingPods int `json:"pendingPods"`
+	// Pods are the namespace/name of up to maxScaleUpTriggerPods of the pending pods
+	Pods []string `json:"pods,omitempty"`
+
+	at    time.Time
+	nodes int
+	// annotated are the names of the nodes annotated with the scale up so far
+	annotated map[string]bool
+}
+
+// recordScaleUpTrigger logs the pending pods that triggered a scale up that added nodes and keeps them to annotate the
+// new nodes with once they register, if annotate_scale_up_trigger is enabled
+func (c *Controller) recordScaleUpTrigger(opts scaleOpts, added int) {
+	if !opts.nodeGroup.Opts.AnnotateScaleUpTrigger || added <= 0 || c.dryMode(opts.nodeGroup) {
+		return
+	}
+
+	now := c.clock().Now()
+	trigger := &scaleUpTrigger{
+		Time:      now.UTC().Format(time.RFC3339),
+		Reason:    opts.reason,
+		at:        now,
+		nodes:     added,
+		annotated: make(map[string]bool, added),
+	}
+	for _, pod := range opts.pods {
+		if len(pod.Spec.NodeName) > 0 || k8s.PodIsTerminated(pod) {
+			continue
+		}
+		trigger.PendingPods++
+		if len(trigger.Pods) < maxScaleUpTriggerPods {
+			trigger.Pods = append(trigger.Pods, fmt.Sprintf("%v/%v", pod.Namespace, pod.Name))
+		}
+	}
+	log.WithField("nodegroup", opts.nodeGroup.Opts.Name).Infof("Scale up of %v nodes triggered by %v (%v pending pods: %v)", added, trigger.Reason, trigger.PendingPods, trigger.Pods)
+	opts.nodeGroup.scaleUpTrigger = trigger
+}
+
+// annotateScaleUpNodes annotates the nodes registered since the last scale up with the ScaleUpTriggerAnnotation. The
+// annotation is best effort, a node that fails to be annotated is retried in the next scan. The scale up is forgotten
+// once all of its nodes are annotated or the scale_up_cool_down_period has passed, so nodes added later by something else, such
+// as the cloud provider replacing an unhealthy instance, aren't annotated with it
+func (c *Controller) annotateScaleUpNodes(nodeGroup *NodeGroupState, nodes []*v1.Node) {
+	trigger := nodeGroup.scaleUpTrigger
+	if trigger == nil {
+		return
+	}
+
+	value, err := json.Marshal(trigger)
+	if err != nil {
+		log.WithField("nodegroup", nodeGroup.Opts.Name).WithError(err).Warning("Failed to encode the scale up trigger annotation")
+		nodeGroup.scaleUpTrigger = nil
+		return
+	}
+	for _, node := range nodes {
+		if trigger.annotated[node.Name] || !node.CreationTimestamp.Time.After(trigger.at) {
+			continue
+		}
+		if _, err := k8s.AnnotateNode(node, ScaleUpTriggerAnnotation, string(value), c.Client); err != nil {
+			nodeGroup.nodeLog(node).WithError(err).Warningf("Failed to annotate node %v with the scale up that added it", node.Name)
+			continue
+		}
+		nodeGroup.nodeLog(node).Infof("Node %v was added by the scale up triggered by %v", node.Name, trigger.Reason)
+		trigger.annotated[node.Name] = true
+	}
+
+	if len(trigger.annotated) >= trigger.nodes || c.clock().Now().Sub(trigger.at) >= nodeGroup.Opts.ScaleUpCoolDownPeriodDuration() {
+		nodeGroup.scaleUpTrigger = nil
+	}
+}
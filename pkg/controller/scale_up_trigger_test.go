@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestControllerAnnotateScaleUpNodes(t *testing.T) {
+	mockClock := newManualClock(time.Now())
+
+	nodeGroupOpts := NodeGroupOptions{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		ScaleUpCoolDownPeriod:  "5m",
+		AnnotateScaleUpTrigger: true,
+	}
+	existing := test.BuildTestNode(test.NodeOpts{Name: "existing", Creation: mockClock.Now().Add(-time.Hour)})
+	first := test.BuildTestNode(test.NodeOpts{Name: "first", Creation: mockClock.Now().Add(time.Minute)})
+	second := test.BuildTestNode(test.NodeOpts{Name: "second", Creation: mockClock.Now().Add(2 * time.Minute)})
+	nodes := []*v1.Node{existing, first, second}
+	pods := []*v1.Pod{
+		test.BuildTestPod(test.PodOpts{Name: "pending", Namespace: "default", CPU: []int64{500}, Mem: []int64{500}}),
+		test.BuildTestPod(test.PodOpts{Name: "scheduled", Namespace: "default", CPU: []int64{500}, Mem: []int64{500}, NodeName: "existing"}),
+	}
+	client, opts := buildTestClient(nodes, pods, []NodeGroupOptions{nodeGroupOpts}, ListerOptions{})
+	opts.Clock = mockClock
+	nodeGroup := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: []NodeGroupOptions{nodeGroupOpts},
+		client:     *client,
+	})["default"]
+	controller := &Controller{
+		Client: client,
+		Opts:   opts,
+	}
+
+	controller.recordScaleUpTrigger(scaleOpts{nodeGroup: nodeGroup, reason: "cpu utilization 90.00%", pods: pods}, 2)
+	require.NotNil(t, nodeGroup.scaleUpTrigger)
+
+	annotation := func(name string) string {
+		node, err := client.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+		require.NoError(t, err)
+		return node.Annotations[ScaleUpTriggerAnnotation]
+	}
+	want := `{"time":"` + mockClock.Now().UTC().Format(time.RFC3339) + `","reason":"cpu utilization 90.00%","pendingPods":1,"pods":["default/pending"]}`
+
+	// only the node registered since the scale up is annotated, the scale up is kept for the node still to come
+	mockClock.Add(time.Minute)
+	controller.annotateScaleUpNodes(nodeGroup, []*v1.Node{existing, first})
+	assert.Equal(t, "", annotation("existing"))
+	assert.Equal(t, want, annotation("first"))
+	require.NotNil(t, nodeGroup.scaleUpTrigger)
+
+	// and is forgotten once all of its nodes are annotated
+	mockClock.Add(time.Minute)
+	controller.annotateScaleUpNodes(nodeGroup, nodes)
+	assert.Equal(t, "", annotation("existing"))
+	assert.Equal(t, want, annotation("second"))
+	assert.Nil(t, nodeGroup.scaleUpTrigger)
+
+	// a scale up whose nodes never register is forgotten after the scale up cool down
+	controller.recordScaleUpTrigger(scaleOpts{nodeGroup: nodeGroup, reason: "cpu utilization 90.00%", pods: pods}, 1)
+	controller.annotateScaleUpNodes(nodeGroup, nodes)
+	require.NotNil(t, nodeGroup.scaleUpTrigger)
+	mockClock.Add(5 * time.Minute)
+	controller.annotateScaleUpNodes(nodeGroup, nodes)
+	assert.Nil(t, nodeGroup.scaleUpTrigger)
+
+	// nothing is recorded unless annotate_scale_up_trigger is enabled
+	nodeGroup.Opts.AnnotateScaleUpTrigger = false
+	controller.recordScaleUpTrigger(scaleOpts{nodeGroup: nodeGroup, reason: "cpu utilization 90.00%", pods: pods}, 2)
+	assert.Nil(t, nodeGroup.scaleUpTrigger)
+}
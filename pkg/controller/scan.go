@@ -0,0 +1,43 @@
+package controller
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// TriggerScan requests a scan outside of the scan interval
+// triggers received whilst a scan is already pending are coalesced into the pending scan
+func (c *Controller) TriggerScan() {
+	select {
+	case c.scanTrigger <- struct{}{}:
+		log.Debug("Scan triggered")
+	default:
+		log.Debug("Scan already pending, coalescing trigger")
+	}
+}
+
+// drainScanTriggers discards any pending triggers, as they are satisfied by the scan about to start
+func (c *Controller) drainScanTriggers() {
+	select {
+	case <-c.scanTrigger:
+	default:
+	}
+}
+
+// waitMinScanInterval blocks until at least MinScanInterval has passed since the start of the last scan
+// returns false if the stop channel was closed whilst waiting
+func (c *Controller) waitMinScanInterval() bool {
+	wait := c.Opts.MinScanInterval - c.clock().Now().Sub(c.lastScan)
+	if c.lastScan.IsZero() || wait <= 0 {
+		return true
+	}
+
+	log.Debugf("Waiting %v to respect the minimum scan interval of %v", wait, c.Opts.MinScanInterval)
+	timer := c.clock().NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return true
+	case <-c.stopChan:
+		return false
+	}
+}
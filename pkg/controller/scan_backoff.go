@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+)
+
+// scanBackoffIdleScans is how many consecutive idle scans a node group must have before it is scanned less often
+const scanBackoffIdleScans = 3
+
+// scanFingerprint is a cheap summary of the state of a node group, read from the caches and the refreshed cloud
+// provider node group without any further API calls. A node group whose fingerprint changes must be scanned
+type scanFingerprint struct {
+	pods         int
+	pendingPods  int
+	nodes        int
+	taintedNodes int
+	cpuRequests  int64
+	memRequests  int64
+	targetSize   int64
+	// nextDeadline is the earliest time still to come, in unix nanoseconds, at which a scan can act differently
+	// without anything else changing, e.g. a tainted node passing its grace period. It changes when it is reached
+	nextDeadline int64
+}
+
+// scanBackoff tracks how often a node group that keeps taking no action is scanned, used for --max-scan-backoff
+type scanBackoff struct {
+	// fingerprint and delta are from the last scan of the node group
+	fingerprint scanFingerprint
+	delta       int
+	// changed is whether the fingerprint changed since the last scan, set when deciding whether to scan
+	changed bool
+	// idleScans is the number of consecutive scans in which the fingerprint and delta didn't change
+	idleScans int
+	// skip is how many scans are skipped between each scan of the node group, skipped is how many have been so far
+	skip    int
+	skipped int
+}
+
+// nodeGroupScanFingerprint returns the fingerprint of the node group
+// returns false if the pods or nodes can't be listed, in which case the node group should be scanned
+func (c *Controller) nodeGroupScanFingerprint(nodeGroup *NodeGroupState) (scanFingerprint, bool) {
+	pods, err := nodeGroup.Pods.List()
+	if err != nil {
+		return scanFingerprint{}, false
+	}
+	nodes, err := nodeGroup.Nodes.List()
+	if err != nil {
+		return scanFingerprint{}, false
+	}
+	memRequests, cpuRequests, err := k8s.CalculatePodsRequestsTotal(pods)
+	if err != nil {
+		return scanFingerprint{}, false
+	}
+
+	fingerprint := scanFingerprint{
+		pods:        len(pods),
+		pendingPods: countPendingPods(pods),
+		nodes:       len(nodes),
+		cpuRequests: cpuRequests.MilliValue(),
+		memRequests: memRequests.Value(),
+	}
+	for _, node := range nodes {
+		if _, tainted := k8s.GetToBeRemovedTaint(node); tainted {
+			fingerprint.taintedNodes++
+		}
+	}
+	now := c.clock().Now()
+	deadline := nextScanDeadline(nodeGroup, nodes, now)
+	if preWarm := c.nextCronJobPreWarmDeadline(nodeGroup, now); !preWarm.IsZero() && (deadline.IsZero() || preWarm.Before(deadline)) {
+		deadline = preWarm
+	}
+	if !deadline.IsZero() {
+		fingerprint.nextDeadline = deadline.UnixNano()
+	}
+	if cloudProviderNodeGroup, ok := getCloudProviderNodeGroup(c.cloudProvider, nodeGroup.Opts); ok {
+		fingerprint.targetSize = cloudProviderNodeGroup.TargetSize()
+	}
+	return fingerprint, true
+}
+
+// nextScanDeadline returns the earliest time after now at which the grace period of a tainted, shutting down, orphaned
+// or draining node, the scale lock, the scale down delay after add, the emergency scale up cool down or the
+// confirmation of a pending pod runs out. A scan can act differently from then on, so the node group isn't backed off past it. Returns the zero
+// time if there is none
+func nextScanDeadline(nodeGroup *NodeGroupState, nodes []*v1.Node, now time.Time) time.Time {
+	var next time.Time
+	add := func(deadline time.Time) {
+		if deadline.After(now) && (next.IsZero() || deadline.Before(next)) {
+			next = deadline
+		}
+	}
+
+	for _, node := range nodes {
+		if taintedTime, err := k8s.GetToBeRemovedTime(node); err == nil && taintedTime != nil {
+			add(taintedTime.Add(nodeGroup.Opts.SoftDeleteGracePeriodDuration()))
+			add(taintedTime.Add(nodeGroup.Opts.HardDeleteGracePeriodDuration()))
+		}
+		if since, err := k8s.GetShutdownStartedTime(node); err == nil && since != nil {
+			add(since.Add(nodeGroup.Opts.NodeShutdownGracePeriodDuration()))
+		}
+	}
+	for _, since := range nodeGroup.orphanedSince {
+		add(since.Add(nodeGroup.Opts.OrphanNodeGracePeriodDuration()))
+	}
+	for _, since := range nodeGroup.drainingSince {
+		add(since.Add(nodeGroup.Opts.DrainTimeoutDuration()))
+	}
+	for _, retry := range nodeGroup.evictionsBlocked {
+		add(retry.next)
+	}
+	if nodeGroup.scaleUpLock.isLocked {
+		add(nodeGroup.scaleUpLock.lockTime.Add(nodeGroup.scaleUpLock.minimumLockDuration))
+	}
+	if delay := nodeGroup.Opts.ScaleDownDelayAfterAddDuration(); delay > 0 && !nodeGroup.lastScaleUp.IsZero() {
+		add(nodeGroup.lastScaleUp.Add(delay))
+	}
+	if coolDown := nodeGroup.Opts.EmergencyScaleUpCoolDownPeriodDuration(); coolDown > 0 && !nodeGroup.lastEmergencyScaleUp.IsZero() {
+		add(nodeGroup.lastEmergencyScaleUp.Add(coolDown))
+	}
+	for _, since := range nodeGroup.pendingSince {
+		if delay := nodeGroup.Opts.ScaleUpConfirmationDelayDuration(); delay > 0 {
+			add(since.Add(delay))
+		}
+		if timeout := nodeGroup.Opts.EmergencyPendingTimeoutDuration(); timeout > 0 {
+			add(since.Add(timeout))
+		}
+	}
+	return next
+}
+
+// maxScanBackoffSkip returns the most scans that can be skipped between each scan of a node group, so it is scanned
+// at least every --max-scan-backoff. Returns 0 if the backoff is disabled
+func (c *Controller) maxScanBackoffSkip() int {
+	if c.Opts.MaxScanBackoff <= 0 || c.Opts.ScanInterval <= 0 {
+		return 0
+	}
+	skip := int(c.Opts.MaxScanBackoff/c.Opts.ScanInterval) - 1
+	if skip < 0 {
+		return 0
+	}
+	return skip
+}
+
+// backsOff returns whether the node group can be scanned less often whilst it is idle. Node groups scaling on the
+// length of a queue never are, as the queue isn't in the fingerprint and can grow without anything in the cluster
+// changing
+func (c *Controller) backsOff(nodeGroup *NodeGroupState) bool {
+	return c.maxScanBackoffSkip() > 0 && !nodeGroup.Opts.QueueScalingEnabled()
+}
+
+// shouldScanNodeGroup returns whether the node group should be scanned this scan
+// node groups are always scanned when their fingerprint has changed since the last scan, resetting the backoff
+func (c *Controller) shouldScanNodeGroup(nodegroup string, nodeGroup *NodeGroupState) bool {
+	if !c.backsOff(nodeGroup) {
+		return true
+	}
+	backoff := &nodeGroup.scanBackoff
+	fingerprint, ok := c.nodeGroupScanFingerprint(nodeGroup)
+	backoff.changed = !ok || fingerprint != backoff.fingerprint
+	backoff.fingerprint = fingerprint
+	if backoff.changed {
+		backoff.reset(nodegroup)
+		return true
+	}
+	if backoff.skipped < backoff.skip {
+		backoff.skipped++
+		log.WithField("nodegroup", nodegroup).Debugf("Skipping scan %v of %v of the idle node group", backoff.skipped, backoff.skip)
+		return false
+	}
+	return true
+}
+
+// recordNodeGroupScan records the result of scanning the node group, doubling the number of scans skipped between
+// each scan once the node group has been idle for scanBackoffIdleScans scans, up to the --max-scan-backoff
+func (c *Controller) recordNodeGroupScan(nodegroup string, nodeGroup *NodeGroupState, delta int) {
+	if !c.backsOff(nodeGroup) {
+		return
+	}
+	maxSkip := c.maxScanBackoffSkip()
+	backoff := &nodeGroup.scanBackoff
+	backoff.skipped = 0
+	if backoff.changed || delta != backoff.delta {
+		backoff.delta = delta
+		backoff.reset(nodegroup)
+		return
+	}
+
+	backoff.idleScans++
+	if backoff.idleScans < scanBackoffIdleScans || backoff.skip >= maxSkip {
+		return
+	}
+	skip := backoff.skip * 2
+	if skip == 0 {
+		skip = 1
+	}
+	if skip > maxSkip {
+		skip = maxSkip
+	}
+	backoff.skip = skip
+	log.WithField("nodegroup", nodegroup).Infof("Node group has been idle for %v scans. Scanning every %v scans", backoff.idleScans, skip+1)
+	metrics.NodeGroupScanBackoff.WithLabelValues(nodegroup).Set(float64(skip))
+}
+
+// reset scans the node group every scan again until it is idle for scanBackoffIdleScans scans
+func (b *scanBackoff) reset(nodegroup string) {
+	if b.skip > 0 {
+		log.WithField("nodegroup", nodegroup).Info("Node group changed. Scanning every scan again")
+	}
+	b.idleScans = 0
+	b.skip = 0
+	b.skipped = 0
+	metrics.NodeGroupScanBackoff.WithLabelValues(nodegroup).Set(0)
+}
@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+)
+
+func TestMaxScanBackoffSkip(t *testing.T) {
+	tests := []struct {
+		name           string
+		scanInterval   time.Duration
+		maxScanBackoff time.Duration
+		want           int
+	}{
+		{"disabled", time.Minute, 0, 0},
+		{"shorter than the scan interval", time.Minute, 30 * time.Second, 0},
+		{"same as the scan interval", time.Minute, time.Minute, 0},
+		{"multiple of the scan interval", time.Minute, 5 * time.Minute, 4},
+		{"rounded down", time.Minute, 150 * time.Second, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := &Controller{Opts: Opts{ScanInterval: tt.scanInterval, MaxScanBackoff: tt.maxScanBackoff}}
+			assert.Equal(t, tt.want, controller.maxScanBackoffSkip())
+		})
+	}
+}
+
+func TestControllerScanBackoff(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MinNodes:               1,
+		MaxNodes:               10,
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(4, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+	opts.MaxScanBackoff = 5 * time.Minute
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	nodeGroup := nodeGroupsState["default"]
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+	scans := func(n int, delta int) []bool {
+		scanned := make([]bool, 0, n)
+		for i := 0; i < n; i++ {
+			ok := controller.shouldScanNodeGroup("default", nodeGroup)
+			if ok {
+				controller.recordNodeGroupScan("default", nodeGroup, delta)
+			}
+			scanned = append(scanned, ok)
+		}
+		return scanned
+	}
+
+	// after 3 idle scans the scans skipped in between double up to the 4 that fit in the max scan backoff
+	assert.Equal(t, []bool{
+		true, true, true, true,
+		false, true,
+		false, false, true,
+		false, false, false, false, true,
+		false, false, false, false, true,
+	}, scans(19, 0))
+	assert.Equal(t, 4, nodeGroup.scanBackoff.skip)
+
+	// a change to the node group is scanned straight away and resets the backoff
+	assert.NoError(t, testNodeGroup.IncreaseSize(1))
+	assert.Equal(t, []bool{true, true, true, true, false, true}, scans(6, 0))
+
+	// a change in the decision of a scan also resets the backoff
+	assert.Equal(t, []bool{false, false, true}, scans(3, 1))
+	assert.Equal(t, 0, nodeGroup.scanBackoff.skip)
+	assert.Equal(t, []bool{true, true, true, false}, scans(4, 1))
+
+	// every scan scans the node group when the backoff is disabled
+	controller.Opts.MaxScanBackoff = 0
+	assert.Equal(t, []bool{true, true, true}, scans(3, 1))
+}
+
+func TestControllerScanBackoffDeadline(t *testing.T) {
+	mockClock := newManualClock(time.Now())
+
+	nodeGroups := []NodeGroupOptions{{
+		Name:                   "default",
+		CloudProviderGroupName: "default",
+		MinNodes:               1,
+		MaxNodes:               10,
+		SoftDeleteGracePeriod:  "10m",
+		HardDeleteGracePeriod:  "1h",
+	}}
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "node", CPU: 1000, Mem: 1000}),
+		test.BuildTestNode(test.NodeOpts{Name: "tainted", CPU: 1000, Mem: 1000, Tainted: true}),
+	}
+	client, opts := buildTestClient(nodes, nil, nodeGroups, ListerOptions{})
+	opts.Clock = mockClock
+	opts.MaxScanBackoff = 5 * time.Minute
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testCloudProvider.RegisterNodeGroup(test.NewNodeGroup("default", 1, 10, int64(len(nodes))))
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	nodeGroup := nodeGroupsState["default"]
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+	scans := func(n int) []bool {
+		scanned := make([]bool, 0, n)
+		for i := 0; i < n; i++ {
+			ok := controller.shouldScanNodeGroup("default", nodeGroup)
+			if ok {
+				controller.recordNodeGroupScan("default", nodeGroup, 0)
+			}
+			scanned = append(scanned, ok)
+		}
+		return scanned
+	}
+
+	assert.Equal(t, []bool{true, true, true, true, false, true, false}, scans(7))
+
+	// the tainted node passing its soft grace period is scanned straight away, so it can be deleted if it is empty
+	mockClock.Add(10*time.Minute + time.Second)
+	assert.Equal(t, []bool{true}, scans(1))
+	assert.Equal(t, 0, nodeGroup.scanBackoff.skip)
+}
+
+func TestControllerScanBackoffQueueScaling(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                     "default",
+		CloudProviderGroupName:   "default",
+		MinNodes:                 1,
+		MaxNodes:                 10,
+		SQSQueueURL:              "https://sqs.us-east-1.amazonaws.com/123456789012/jobs",
+		SQSTargetMessagesPerNode: 10,
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	client, opts := buildTestClient(nodes, nil, nodeGroups, ListerOptions{})
+	opts.MaxScanBackoff = 5 * time.Minute
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testCloudProvider.RegisterNodeGroup(test.NewNodeGroup("default", 1, 10, int64(len(nodes))))
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	nodeGroup := nodeGroupsState["default"]
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// the queue can grow without anything in the cluster changing, so the idle node group is scanned every scan
+	for i := 0; i < 10; i++ {
+		assert.True(t, controller.shouldScanNodeGroup("default", nodeGroup))
+		controller.recordNodeGroupScan("default", nodeGroup, 0)
+	}
+	assert.Equal(t, 0, nodeGroup.scanBackoff.skip)
+}
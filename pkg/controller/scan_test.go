@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriggerScanCoalesces(t *testing.T) {
+	controller := &Controller{scanTrigger: make(chan struct{}, 1)}
+
+	// multiple rapid triggers should only result in a single pending scan
+	controller.TriggerScan()
+	controller.TriggerScan()
+	controller.TriggerScan()
+	assert.Len(t, controller.scanTrigger, 1)
+
+	controller.drainScanTriggers()
+	assert.Len(t, controller.scanTrigger, 0)
+}
+
+func TestWaitMinScanInterval(t *testing.T) {
+	tests := []struct {
+		name            string
+		minScanInterval time.Duration
+		sinceLastScan   time.Duration
+		neverScanned    bool
+		stop            bool
+		want            bool
+	}{
+		{"never scanned", time.Hour, 0, true, false, true},
+		{"min scan interval passed", time.Minute, time.Hour, false, false, true},
+		{"waits for min scan interval", time.Hour, 0, false, false, true},
+		{"stopped whilst waiting", time.Hour, 0, false, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stopChan := make(chan struct{})
+			if tt.stop {
+				close(stopChan)
+			}
+			mockClock := newManualClock(time.Now())
+			controller := &Controller{
+				Opts:     Opts{MinScanInterval: tt.minScanInterval, Clock: mockClock},
+				stopChan: stopChan,
+			}
+			if !tt.neverScanned {
+				controller.lastScan = mockClock.Now().Add(-tt.sinceLastScan)
+			}
+
+			stopAdvancing := advanceWhileWaiting(mockClock, time.Minute)
+			assert.Equal(t, tt.want, controller.waitMinScanInterval())
+			stopAdvancing()
+			if tt.want && !tt.neverScanned {
+				assert.True(t, mockClock.Now().Sub(controller.lastScan) >= tt.minScanInterval)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package controller
+
+import (
+	"io"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/cloudprovider"
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	appsv1lister "k8s.io/client-go/listers/apps/v1"
+	batchv1beta1lister "k8s.io/client-go/listers/batch/v1beta1"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// simulationProviderName is the name of the in memory cloud provider simulations are run against
+const simulationProviderName = "simulation"
+
+// SimulationState is a recorded snapshot of the cluster that a scan is simulated against
+type SimulationState struct {
+	Nodes []v1.Node
+	Pods  []v1.Pod
+	// TargetSizes are the target sizes of the cloud provider node groups by name when the snapshot was recorded
+	// Optional, a cloud provider node group not listed has a target size of the number of nodes of its node group
+	TargetSizes map[string]int64
+	// Now is when the snapshot was recorded, which the simulated scan runs at. Optional, defaults to the latest time
+	// recorded in the nodes and pods
+	Now time.Time
+}
+
+// LoadSimulationState decodes a recorded snapshot from a node list and a pod list in JSON or YAML, such as the output
+// of kubectl get nodes -o yaml and kubectl get pods --all-namespaces -o yaml
+func LoadSimulationState(nodes io.Reader, pods io.Reader) (SimulationState, error) {
+	var nodeList v1.NodeList
+	if err := yaml.NewYAMLOrJSONDecoder(nodes, 4096).Decode(&nodeList); err != nil {
+		return SimulationState{}, errors.Wrap(err, "failed to decode nodes")
+	}
+	var podList v1.PodList
+	if err := yaml.NewYAMLOrJSONDecoder(pods, 4096).Decode(&podList); err != nil {
+		return SimulationState{}, errors.Wrap(err, "failed to decode pods")
+	}
+	state := SimulationState{Nodes: nodeList.Items, Pods: podList.Items}
+	state.Now = state.recordedTime()
+	return state, nil
+}
+
+// recordedTime is the latest time in the nodes and pods, such as the last heartbeat of a node, which is shortly before
+// the snapshot was recorded. The zero time if there are none
+func (s SimulationState) recordedTime() time.Time {
+	var latest time.Time
+	later := func(t time.Time) {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	for i := range s.Nodes {
+		later(s.Nodes[i].CreationTimestamp.Time)
+		if tainted, err := k8s.GetToBeRemovedTime(&s.Nodes[i]); err == nil && tainted != nil {
+			later(*tainted)
+		}
+		if shutdown, err := k8s.GetShutdownStartedTime(&s.Nodes[i]); err == nil && shutdown != nil {
+			later(*shutdown)
+		}
+		for _, condition := range s.Nodes[i].Status.Conditions {
+			later(condition.LastHeartbeatTime.Time)
+			later(condition.LastTransitionTime.Time)
+		}
+	}
+	for i := range s.Pods {
+		later(s.Pods[i].CreationTimestamp.Time)
+		for _, condition := range s.Pods[i].Status.Conditions {
+			later(condition.LastProbeTime.Time)
+			later(condition.LastTransitionTime.Time)
+		}
+	}
+	return latest
+}
+
+// Simulate calculates the scale decision each node group would make in a scan of the recorded state, offline and
+// without a cluster or cloud provider. The decisions are made by the same code as a real scan, by a paused controller
+// that lists the recorded nodes and pods and whose cloud provider is an in memory copy of the state. The controller is
+// new, so the decisions are those of the first scan after startup. The scan runs under a clock frozen at state.Now, so
+// options that depend on how long something has been happening, such as emergency_pending_timeout, are evaluated against
+// when the snapshot was recorded and the same state always makes the same decisions. If nothing in the state records a
+// time the current time is used. The controller has no kubernetes client, it only reads the listers of the recorded state
+func Simulate(state SimulationState, nodeGroups []NodeGroupOptions) ([]NodeGroupPlan, error) {
+	now := state.Now
+	if now.IsZero() {
+		now = state.recordedTime()
+	}
+	if now.IsZero() {
+		// nothing in the state says when it was recorded
+		now = time.Now()
+	}
+
+	podIndexer := newSimulationIndexer()
+	for i := range state.Pods {
+		// the same pods as the pod watcher of a real scan, which doesn't watch terminated pods
+		if k8s.PodIsTerminated(&state.Pods[i]) {
+			continue
+		}
+		if err := podIndexer.Add(&state.Pods[i]); err != nil {
+			return nil, errors.Wrap(err, "failed to add recorded pod")
+		}
+	}
+	nodeIndexer := newSimulationIndexer()
+	for i := range state.Nodes {
+		if err := nodeIndexer.Add(&state.Nodes[i]); err != nil {
+			return nil, errors.Wrap(err, "failed to add recorded node")
+		}
+	}
+	allPodLister := v1lister.NewPodLister(podIndexer)
+	allNodeLister := v1lister.NewNodeLister(nodeIndexer)
+
+	client := &Client{
+		nil,
+		BuildNodeGroupListers(allPodLister, allNodeLister, configuredNodeGroups(nodeGroups)),
+		allPodLister,
+		allNodeLister,
+	}
+
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	c, err := newControllerWithClient(Opts{
+		NodeGroups:           nodeGroups,
+		CloudProviderBuilder: simulationCloudProviderBuilder{state: state, nodeGroups: nodeGroups},
+		Paused:               true,
+		Clock:                newManualClock(now),
+	}, client, stopChan)
+	if err != nil {
+		return nil, err
+	}
+
+	// the recorded state has no CronJobs, volumes or workloads, so their listers are empty rather than started from
+	// the kubernetes API
+	c.listers.cronJobs = batchv1beta1lister.NewCronJobLister(newSimulationIndexer())
+	c.listers.claims = v1lister.NewPersistentVolumeClaimLister(newSimulationIndexer())
+	c.listers.persistentVolumes = v1lister.NewPersistentVolumeLister(newSimulationIndexer())
+	c.listers.replicaSets = appsv1lister.NewReplicaSetLister(newSimulationIndexer())
+	c.listers.deployments = appsv1lister.NewDeploymentLister(newSimulationIndexer())
+	c.listers.statefulSets = appsv1lister.NewStatefulSetLister(newSimulationIndexer())
+	return c.plan(), nil
+}
+
+// newSimulationIndexer creates an indexer of the recorded objects, indexed by namespace like the informer caches
+func newSimulationIndexer() cache.Indexer {
+	return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+// simulationCloudProviderBuilder builds the in memory cloud provider of a simulation
+type simulationCloudProviderBuilder struct {
+	state      SimulationState
+	nodeGroups []NodeGroupOptions
+}
+
+// Build creates a cloud provider node group for every cloud provider group name of the node groups. The nodes of a
+// node group made up of several cloud provider node groups all count towards the first of them
+func (b simulationCloudProviderBuilder) Build() (cloudprovider.CloudProvider, error) {
+	cloud := &simulationCloudProvider{nodeGroups: make(map[string]*simulationNodeGroup)}
+	for i, opts := range b.nodeGroups {
+		owned := NewOwnedNodeFilterFunc(opts, b.nodeGroups[:i])
+		var nodes []string
+		for j := range b.state.Nodes {
+			if owned(&b.state.Nodes[j]) {
+				nodes = append(nodes, b.state.Nodes[j].Name)
+			}
+		}
+		for k, id := range opts.CloudProviderGroupNameList() {
+			nodeGroup := &simulationNodeGroup{id: id}
+			if k == 0 {
+				nodeGroup.minSize = int64(opts.MinNodes)
+				nodeGroup.maxSize = int64(opts.MaxNodes)
+				nodeGroup.nodes = nodes
+				nodeGroup.targetSize = int64(len(nodes))
+			}
+			if targetSize, ok := b.state.TargetSizes[id]; ok {
+				nodeGroup.targetSize = targetSize
+			}
+			cloud.nodeGroups[id] = nodeGroup
+		}
+	}
+	return cloud, nil
+}
+
+// simulationCloudProvider is the in memory cloud provider of a simulation. It never changes, as the controller of a
+// simulation is paused
+type simulationCloudProvider struct {
+	nodeGroups map[string]*simulationNodeGroup
+}
+
+func (c *simulationCloudProvider) Name() string {
+	return simulationProviderName
+}
+
+func (c *simulationCloudProvider) NodeGroups() []cloudprovider.NodeGroup {
+	nodeGroups := make([]cloudprovider.NodeGroup, 0, len(c.nodeGroups))
+	for _, nodeGroup := range c.nodeGroups {
+		nodeGroups = append(nodeGroups, nodeGroup)
+	}
+	return nodeGroups
+}
+
+func (c *simulationCloudProvider) GetNodeGroup(id string) (cloudprovider.NodeGroup, bool) {
+	nodeGroup, ok := c.nodeGroups[id]
+	return nodeGroup, ok
+}
+
+func (c *simulationCloudProvider) RegisterNodeGroups(ids ...string) error {
+	return nil
+}
+
+func (c *simulationCloudProvider) Refresh() error {
+	return nil
+}
+
+// DiscoverNodeGroups discovers nothing, as the recorded state has no cloud provider tags
+func (c *simulationCloudProvider) DiscoverNodeGroups(tags map[string]string) ([]cloudprovider.DiscoveredNodeGroup, error) {
+	return nil, nil
+}
+
+// GetInstance returns an instance created with the node, as the recorded state has no instances
+func (c *simulationCloudProvider) GetInstance(node *v1.Node) (cloudprovider.Instance, error) {
+	return simulationInstance{id: node.Spec.ProviderID, created: node.CreationTimestamp.Time}, nil
+}
+
+// simulationInstance is the instance backing a node of the recorded state
+type simulationInstance struct {
+	id      string
+	created time.Time
+}
+
+func (i simulationInstance) InstantiationTime() time.Time {
+	return i.created
+}
+
+func (i simulationInstance) Id() string {
+	return i.id
+}
+
+// simulationNodeGroup is a cloud provider node group of a simulation
+type simulationNodeGroup struct {
+	id         string
+	minSize    int64
+	maxSize    int64
+	targetSize int64
+	nodes      []string
+}
+
+func (n *simulationNodeGroup) String() string {
+	return n.id
+}
+
+func (n *simulationNodeGroup) ID() string {
+	return n.id
+}
+
+func (n *simulationNodeGroup) MinSize() int64 {
+	return n.minSize
+}
+
+func (n *simulationNodeGroup) MaxSize() int64 {
+	return n.maxSize
+}
+
+func (n *simulationNodeGroup) TargetSize() int64 {
+	return n.targetSize
+}
+
+func (n *simulationNodeGroup) Size() int64 {
+	return n.targetSize
+}
+
+func (n *simulationNodeGroup) IncreaseSize(delta int64) error {
+	return errors.Errorf("node group %v can't be scaled in a simulation", n.id)
+}
+
+func (n *simulationNodeGroup) Belongs(node *v1.Node) bool {
+	for _, name := range n.nodes {
+		if node.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *simulationNodeGroup) DeleteNodes(nodes ...*v1.Node) error {
+	return errors.Errorf("node group %v can't be scaled in a simulation", n.id)
+}
+
+func (n *simulationNodeGroup) DecreaseTargetSize(delta int64) error {
+	return errors.Errorf("node group %v can't be scaled in a simulation", n.id)
+}
+
+func (n *simulationNodeGroup) Nodes() []string {
+	return n.nodes
+}
@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSimulate(t *testing.T) {
+	nodeGroup := func(name string, labelKey string, labelValue string) NodeGroupOptions {
+		return NodeGroupOptions{
+			Name:                               name,
+			LabelKey:                           labelKey,
+			LabelValue:                         labelValue,
+			CloudProviderGroupName:             name,
+			MinNodes:                           1,
+			MaxNodes:                           10,
+			ScaleUpThresholdPercent:            70,
+			TaintLowerCapacityThresholdPercent: 40,
+			TaintUpperCapacityThresholdPercent: 60,
+			FastNodeRemovalRate:                2,
+			SlowNodeRemovalRate:                1,
+			SoftDeleteGracePeriod:              "1m",
+			HardDeleteGracePeriod:              "10m",
+			ScaleUpCoolDownPeriod:              "1m",
+		}
+	}
+	nodeGroups := []NodeGroupOptions{nodeGroup("default", "", ""), nodeGroup("batch", "customer", "batch")}
+
+	var state SimulationState
+	for _, node := range buildTestNodes(2, 1000, 1000) {
+		state.Nodes = append(state.Nodes, *node)
+	}
+	for _, name := range []string{"batch-1", "batch-2", "batch-3"} {
+		state.Nodes = append(state.Nodes, *test.BuildTestNode(test.NodeOpts{Name: name, CPU: 1000, Mem: 1000, LabelKey: "customer", LabelValue: "batch"}))
+	}
+	// 150% utilisation of the default node group, the batch node group is empty
+	for _, pod := range buildTestPods(6, 500, 500) {
+		state.Pods = append(state.Pods, *pod)
+	}
+
+	plans, err := Simulate(state, nodeGroups)
+	require.NoError(t, err)
+	assert.Equal(t, []NodeGroupPlan{
+		{NodeGroup: "default", Delta: 3, Decision: "scale_up"},
+		{NodeGroup: "batch", Delta: -2, Decision: "scale_down"},
+	}, plans)
+
+	// the same state always makes the same decisions
+	again, err := Simulate(state, nodeGroups)
+	require.NoError(t, err)
+	assert.Equal(t, plans, again)
+}
+
+func TestSimulateRecordedTime(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		FastNodeRemovalRate:                2,
+		SlowNodeRemovalRate:                1,
+		SoftDeleteGracePeriod:              "1m",
+		HardDeleteGracePeriod:              "10m",
+		ScaleUpCoolDownPeriod:              "1m",
+		DiscountCrashLoopingPodsAfter:      "1h",
+	}}
+	recorded := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var state SimulationState
+	for _, node := range buildTestNodes(2, 1000, 1000) {
+		node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue, LastHeartbeatTime: metav1.NewTime(recorded)}}
+		state.Nodes = append(state.Nodes, *node)
+	}
+	// crash looping for half an hour when the snapshot was recorded
+	for _, pod := range buildTestPods(6, 500, 500) {
+		state.Pods = append(state.Pods, *crashLooping(pod, recorded.Add(-30*time.Minute)))
+	}
+	assert.Equal(t, recorded, state.recordedTime())
+
+	// the scan runs at the last heartbeat of the nodes, when the pods weren't discounted yet
+	plans, err := Simulate(state, nodeGroups)
+	require.NoError(t, err)
+	assert.Equal(t, []NodeGroupPlan{{NodeGroup: "default", Delta: 3, Decision: "scale_up"}}, plans)
+
+	// an hour later they are
+	state.Now = recorded.Add(time.Hour)
+	plans, err = Simulate(state, nodeGroups)
+	require.NoError(t, err)
+	assert.Equal(t, []NodeGroupPlan{{NodeGroup: "default", Delta: -2, Decision: "scale_down"}}, plans)
+}
+
+func TestSimulateWithoutKubernetesClient(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		FastNodeRemovalRate:                2,
+		SlowNodeRemovalRate:                1,
+		SoftDeleteGracePeriod:              "1m",
+		HardDeleteGracePeriod:              "10m",
+		ScaleUpCoolDownPeriod:              "1m",
+		CronJobPreWarm:                     []string{"default/nightly"},
+		CronJobPreWarmLeadTime:             "10m",
+		CronJobPreWarmNodes:                5,
+	}}
+
+	var state SimulationState
+	for _, node := range buildTestNodes(2, 1000, 1000) {
+		state.Nodes = append(state.Nodes, *node)
+	}
+	for _, pod := range buildTestPods(2, 500, 500) {
+		state.Pods = append(state.Pods, *pod)
+	}
+
+	// the CronJob isn't in the recorded state, so it is read from an empty lister and the node group scales down rather
+	// than being pre-warmed
+	plans, err := Simulate(state, nodeGroups)
+	require.NoError(t, err)
+	assert.Equal(t, []NodeGroupPlan{{NodeGroup: "default", Delta: -1, Decision: "scale_down"}}, plans)
+}
+
+func TestSimulateUnknownCloudProviderGroup(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{Name: "default", CloudProviderGroupName: "default", MinNodes: 1, MaxNodes: 10}}
+	cloud, err := simulationCloudProviderBuilder{nodeGroups: nodeGroups}.Build()
+	require.NoError(t, err)
+	_, ok := cloud.GetNodeGroup("other")
+	assert.False(t, ok)
+
+	nodeGroup, ok := cloud.GetNodeGroup("default")
+	require.True(t, ok)
+	assert.Equal(t, int64(0), nodeGroup.TargetSize())
+	assert.Error(t, nodeGroup.IncreaseSize(1))
+}
+
+func TestSimulationCloudProviderTargetSizes(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                    "shared",
+		LabelKey:                "customer",
+		LabelValue:              "shared",
+		CloudProviderGroupNames: []string{"shared-a", "shared-b"},
+		MinNodes:                1,
+		MaxNodes:                10,
+	}}
+	state := SimulationState{
+		Nodes: []v1.Node{
+			*test.BuildTestNode(test.NodeOpts{Name: "shared-1", LabelKey: "customer", LabelValue: "shared"}),
+			*test.BuildTestNode(test.NodeOpts{Name: "shared-2", LabelKey: "customer", LabelValue: "shared"}),
+			*test.BuildTestNode(test.NodeOpts{Name: "other", LabelKey: "customer", LabelValue: "other"}),
+		},
+		TargetSizes: map[string]int64{"shared-b": 3},
+	}
+	cloud, err := simulationCloudProviderBuilder{state: state, nodeGroups: nodeGroups}.Build()
+	require.NoError(t, err)
+
+	first, ok := cloud.GetNodeGroup("shared-a")
+	require.True(t, ok)
+	assert.Equal(t, int64(2), first.TargetSize())
+	assert.Equal(t, []string{"shared-1", "shared-2"}, first.Nodes())
+	second, ok := cloud.GetNodeGroup("shared-b")
+	require.True(t, ok)
+	assert.Equal(t, int64(3), second.TargetSize())
+}
+
+const simulationNodesYAML = `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Node
+  metadata:
+    name: node-1
+    labels:
+      customer: shared
+  status:
+    allocatable:
+      cpu: "4"
+      memory: 16Gi
+    conditions:
+    - type: Ready
+      status: "True"
+      lastHeartbeatTime: "2020-01-01T12:00:00Z"
+`
+
+const simulationPodsJSON = `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [
+    {"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "pod-1", "namespace": "default"}, "spec": {"nodeName": "node-1"}},
+    {"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "pod-2", "namespace": "default"}}
+  ]
+}`
+
+func TestLoadSimulationState(t *testing.T) {
+	state, err := LoadSimulationState(strings.NewReader(simulationNodesYAML), strings.NewReader(simulationPodsJSON))
+	require.NoError(t, err)
+	require.Len(t, state.Nodes, 1)
+	assert.Equal(t, "node-1", state.Nodes[0].Name)
+	assert.Equal(t, "shared", state.Nodes[0].Labels["customer"])
+	assert.Equal(t, int64(4), state.Nodes[0].Status.Allocatable.Cpu().Value())
+	require.Len(t, state.Pods, 2)
+	assert.Equal(t, "node-1", state.Pods[0].Spec.NodeName)
+	assert.Equal(t, "pod-2", state.Pods[1].Name)
+	// recorded at the last heartbeat of the node, the latest time in the snapshot
+	assert.True(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC).Equal(state.Now), "recorded at %v", state.Now)
+
+	_, err = LoadSimulationState(strings.NewReader("nodes: ["), strings.NewReader(simulationPodsJSON))
+	assert.Error(t, err)
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// cloudProviderSizeDiverged checks the size of the cloud provider node group against the number of nodes in the node
+// group. Cloud providers can briefly report far fewer instances than exist, e.g. an empty instance list whilst an auto
+// scaling group refreshes, and acting on that could scale the node group wrongly. Reporting more instances than nodes
+// is expected whilst new nodes register, so only a shortfall beyond cloud_provider_size_tolerance is treated as
+// divergent, in which case the scan of the node group should be skipped
+func (c *Controller) cloudProviderSizeDiverged(nodegroup string, nodeGroup *NodeGroupState, nodes int) bool {
+	if nodeGroup.Opts.CloudProviderSizeTolerance <= 0 || nodes == 0 {
+		return false
+	}
+	cloudProviderNodeGroup, ok := getCloudProviderNodeGroup(c.cloudProvider, nodeGroup.Opts)
+	if !ok {
+		return false
+	}
+
+	size := cloudProviderNodeGroup.Size()
+	shortfall := float64(int64(nodes)-size) / float64(nodes)
+	if shortfall <= nodeGroup.Opts.CloudProviderSizeTolerance {
+		return false
+	}
+	metrics.NodeGroupSizeDivergenceSkips.WithLabelValues(nodegroup).Inc()
+	log.WithField("nodegroup", nodegroup).Warningf(
+		"Cloud provider node group reports %v instances for %v nodes, more than cloud_provider_size_tolerance of %v fewer. Skipping scale actions this scan",
+		size,
+		nodes,
+		nodeGroup.Opts.CloudProviderSizeTolerance,
+	)
+	return true
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScaleNodeGroupCloudProviderSizeDiverged(t *testing.T) {
+	tests := []struct {
+		name          string
+		tolerance     float64
+		actualSize    int64
+		expectSkipped bool
+	}{
+		{"bogus zero read", 0.5, 0, true},
+		{"zero read without a tolerance", 0, 0, false},
+		{"shortfall within the tolerance", 0.5, 2, false},
+		{"more instances than nodes", 0.5, 10, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeGroups := []NodeGroupOptions{{
+				Name:                               "default",
+				CloudProviderGroupName:             "default",
+				MinNodes:                           1,
+				MaxNodes:                           10,
+				ScaleUpThresholdPercent:            70,
+				TaintLowerCapacityThresholdPercent: 40,
+				TaintUpperCapacityThresholdPercent: 60,
+				ScaleUpCoolDownPeriod:              "1m",
+				CloudProviderSizeTolerance:         tt.tolerance,
+				CleanupOrphanNodes:                 true,
+				OrphanNodeGracePeriod:              "10m",
+			}}
+			nodes := buildTestNodes(4, 1000, 1000)
+			// the test cloud provider owns no instances, so a node that isn't ready looks orphaned
+			setNodeReady(nodes[0], false)
+			pods := buildTestPods(20, 200, 200)
+			client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+			testCloudProvider := test.NewCloudProvider(1)
+			testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+			testNodeGroup.SetActualSize(tt.actualSize)
+			testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+			nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+				nodeGroups: nodeGroups,
+				client:     *client,
+			})
+
+			controller := &Controller{
+				Client:        client,
+				Opts:          opts,
+				nodeGroups:    nodeGroupsState,
+				cloudProvider: testCloudProvider,
+			}
+
+			delta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+			if tt.expectSkipped {
+				require.Error(t, err)
+				assert.Equal(t, 0, delta)
+				assert.Equal(t, int64(len(nodes)), testNodeGroup.TargetSize())
+				// the nodes aren't acted on, e.g. by the orphan cleanup, whilst the size diverges
+				assert.Empty(t, nodeGroupsState["default"].orphanedSince)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, delta > 0)
+			assert.Equal(t, int64(len(nodes)+delta), testNodeGroup.TargetSize())
+		})
+	}
+}
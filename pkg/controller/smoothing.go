@@ -0,0 +1,23 @@
+package controller
+
+// smoothedUtilization is an exponentially weighted moving average of the cpu and memory utilization of a node group
+type smoothedUtilization struct {
+	cpuPercent  float64
+	memPercent  float64
+	initialised bool
+}
+
+// update adds the latest utilization to the averages and returns the smoothed utilization
+// factor is the weight given to the latest utilization. The first utilization seeds the averages
+func (s *smoothedUtilization) update(factor float64, cpuPercent float64, memPercent float64) (float64, float64) {
+	if !s.initialised {
+		s.cpuPercent = cpuPercent
+		s.memPercent = memPercent
+		s.initialised = true
+		return s.cpuPercent, s.memPercent
+	}
+
+	s.cpuPercent = factor*cpuPercent + (1-factor)*s.cpuPercent
+	s.memPercent = factor*memPercent + (1-factor)*s.memPercent
+	return s.cpuPercent, s.memPercent
+}
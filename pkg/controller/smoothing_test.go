@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSmoothedUtilizationUpdate(t *testing.T) {
+	var smoothed smoothedUtilization
+
+	// the first utilization seeds the averages
+	cpu, mem := smoothed.update(0.5, 80, 40)
+	assert.Equal(t, 80.0, cpu)
+	assert.Equal(t, 40.0, mem)
+
+	cpu, mem = smoothed.update(0.5, 40, 80)
+	assert.Equal(t, 60.0, cpu)
+	assert.Equal(t, 60.0, mem)
+
+	cpu, mem = smoothed.update(0.25, 100, 20)
+	assert.Equal(t, 70.0, cpu)
+	assert.Equal(t, 50.0, mem)
+
+	// a factor of 1 disables smoothing
+	cpu, mem = smoothed.update(1, 10, 90)
+	assert.Equal(t, 10.0, cpu)
+	assert.Equal(t, 90.0, mem)
+}
@@ -1,6 +1,11 @@
 package controller
 
-import "k8s.io/api/core/v1"
+import (
+	"hash/fnv"
+	"sort"
+
+	"k8s.io/api/core/v1"
+)
 
 // nodeIndexBundle bundles an original index to a node so that it can be tracked during sorting
 type nodeIndexBundle struct {
@@ -16,6 +21,10 @@ func (n nodesByOldestCreationTime) Len() int {
 }
 
 func (n nodesByOldestCreationTime) Less(i, j int) bool {
+	// nodes created at the same time are ordered by name, so the same nodes are chosen every scan
+	if n[i].node.CreationTimestamp.Equal(&n[j].node.CreationTimestamp) {
+		return n[i].node.Name < n[j].node.Name
+	}
 	return n[i].node.CreationTimestamp.Before(&n[j].node.CreationTimestamp)
 }
 
@@ -37,3 +46,46 @@ func (n nodesByNewestCreationTime) Less(i, j int) bool {
 func (n nodesByNewestCreationTime) Swap(i, j int) {
 	n[i], n[j] = n[j], n[i]
 }
+
+// nodesByStableHash Sort functions for sorting by a hash of the node name
+// the order of two nodes never changes, so adding or removing a node doesn't change which of the other nodes are chosen
+type nodesByStableHash []nodeIndexBundle
+
+func (n nodesByStableHash) Len() int {
+	return len(n)
+}
+
+func (n nodesByStableHash) Less(i, j int) bool {
+	hashI, hashJ := nodeNameHash(n[i].node), nodeNameHash(n[j].node)
+	if hashI == hashJ {
+		return n[i].node.Name < n[j].node.Name
+	}
+	return hashI < hashJ
+}
+
+func (n nodesByStableHash) Swap(i, j int) {
+	n[i], n[j] = n[j], n[i]
+}
+
+// nodeNameHash returns the FNV-1a hash of the node name
+func nodeNameHash(node *v1.Node) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(node.Name))
+	return hash.Sum32()
+}
+
+// sortNodesForTermination returns the nodes with their indices in the order they are chosen to be tainted by the
+// node selection method, oldest first by default
+func sortNodesForTermination(nodes []*v1.Node, method string) []nodeIndexBundle {
+	bundles := make([]nodeIndexBundle, 0, len(nodes))
+	for i, node := range nodes {
+		bundles = append(bundles, nodeIndexBundle{node, i})
+	}
+	switch method {
+	case NodeSelectionMethodStable:
+		sort.Sort(nodesByStableHash(bundles))
+	default:
+		sort.Sort(nodesByOldestCreationTime(bundles))
+	}
+	return bundles
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"fmt"
 	"math/rand"
 	"sort"
 	"testing"
@@ -121,3 +122,59 @@ func shuffleNewest(nodes nodesByNewestCreationTime) {
 		nodes[i].index, nodes[j].index = nodes[j].index, nodes[i].index
 	}
 }
+
+func TestSortNodesForTerminationStable(t *testing.T) {
+	created := time.Date(2018, time.January, 1, 1, 0, 0, 0, time.UTC)
+	nodes := make([]*v1.Node, 0, 10)
+	for i := 0; i < 10; i++ {
+		nodes = append(nodes, test.BuildTestNode(test.NodeOpts{
+			Name:     fmt.Sprintf("node-%v", i),
+			Creation: created,
+		}))
+	}
+	selected := func(nodes []*v1.Node, n int) []string {
+		names := make([]string, 0, n)
+		for _, bundle := range sortNodesForTermination(nodes, NodeSelectionMethodStable)[:n] {
+			names = append(names, bundle.node.Name)
+		}
+		return names
+	}
+
+	// two scans with the same nodes, listed in a different order, choose the same nodes
+	first := selected(nodes, 3)
+	shuffled := make([]*v1.Node, len(nodes))
+	copy(shuffled, nodes)
+	rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	assert.Equal(t, first, selected(shuffled, 3))
+
+	// removing a node that wasn't chosen doesn't change the nodes chosen
+	var remaining []*v1.Node
+	for _, node := range nodes {
+		if node.Name != selected(nodes, 10)[9] {
+			remaining = append(remaining, node)
+		}
+	}
+	assert.Equal(t, first, selected(remaining, 3))
+
+	// the indices are of the nodes passed in
+	for _, bundle := range sortNodesForTermination(shuffled, NodeSelectionMethodStable) {
+		assert.Equal(t, shuffled[bundle.index], bundle.node)
+	}
+}
+
+func TestSortNodesForTerminationOldestTies(t *testing.T) {
+	created := time.Date(2018, time.January, 1, 1, 0, 0, 0, time.UTC)
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "c", Creation: created}),
+		test.BuildTestNode(test.NodeOpts{Name: "a", Creation: created}),
+		test.BuildTestNode(test.NodeOpts{Name: "newest", Creation: created.Add(time.Hour)}),
+		test.BuildTestNode(test.NodeOpts{Name: "b", Creation: created}),
+	}
+
+	// nodes created at the same time are chosen by name
+	var names []string
+	for _, bundle := range sortNodesForTermination(nodes, NodeSelectionMethodOldest) {
+		names = append(names, bundle.node.Name)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "newest"}, names)
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// NodeGroupResource is the cluster scoped custom resource whose status reflects the node group of the same name, see
+// docs/deployment/nodegroup-crd.yaml
+var NodeGroupResource = schema.GroupVersionResource{
+	Group:    "escalator.atlassian.com",
+	Version:  "v1alpha1",
+	Resource: "nodegroups",
+}
+
+// The last actions of the node group status
+const (
+	nodeGroupActionScaleUp   = "scale_up"
+	nodeGroupActionScaleDown = "scale_down"
+)
+
+// nodeGroupStatus is what the controller last saw and did for a node group, written to the status of its custom
+// resource at the end of every scan
+type nodeGroupStatus struct {
+	// scanned is whether the node group has been scanned, node groups that haven't have no status to write yet
+	scanned     bool
+	lastScan    time.Time
+	cpuPercent  float64
+	memPercent  float64
+	lastError   string
+	lastAction  string
+	actionNodes int
+	lastActed   time.Time
+}
+
+// statusFor returns the status of the node group, creating it if it doesn't exist yet
+func (c *Controller) statusFor(nodegroup string) *nodeGroupStatus {
+	if c.statuses == nil {
+		c.statuses = make(map[string]*nodeGroupStatus)
+	}
+	status, ok := c.statuses[nodegroup]
+	if !ok {
+		status = &nodeGroupStatus{}
+		c.statuses[nodegroup] = status
+	}
+	return status
+}
+
+// recordStatusUtilization records the cpu and memory utilization of the node group calculated by the scan
+func (c *Controller) recordStatusUtilization(nodegroup string, cpuPercent float64, memPercent float64) {
+	status := c.statusFor(nodegroup)
+	status.cpuPercent = cpuPercent
+	status.memPercent = memPercent
+}
+
+// recordStatusAction records a scale action that changed the number of untainted nodes of the node group
+func (c *Controller) recordStatusAction(nodegroup string, action string, nodes int) {
+	status := c.statusFor(nodegroup)
+	status.lastAction = action
+	status.actionNodes = nodes
+	status.lastActed = c.clock().Now()
+}
+
+// recordStatusScan records the scan of the node group and its error, clearing the error of an earlier scan if nil
+func (c *Controller) recordStatusScan(nodegroup string, err error) {
+	status := c.statusFor(nodegroup)
+	status.scanned = true
+	status.lastScan = c.clock().Now()
+	status.lastError = ""
+	if err != nil {
+		status.lastError = err.Error()
+	}
+}
+
+// updateNodeGroupStatuses writes the status of every scanned node group to the status subresource of the custom
+// resource of the same name. Node groups without a custom resource, including when the custom resource definition
+// isn't installed, are skipped, so the resources only need to exist for the node groups that should be reflected.
+// Failing to write a status is logged and retried at the end of the next scan
+func (c *Controller) updateNodeGroupStatuses() {
+	if c.Opts.StatusClient == nil {
+		return
+	}
+	resources := c.Opts.StatusClient.Resource(NodeGroupResource)
+	for _, name := range c.nodeGroupNames() {
+		state, ok := c.nodeGroups[name]
+		status, scanned := c.statuses[name]
+		if !ok || !scanned || !status.scanned {
+			continue
+		}
+
+		resource, err := resources.Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			log.WithField("nodegroup", name).Debugf("No %v custom resource for the node group. Not updating its status", NodeGroupResource.GroupResource())
+			continue
+		}
+		if err != nil {
+			log.WithField("nodegroup", name).WithError(err).Warning("Failed to get the node group custom resource to update its status")
+			continue
+		}
+
+		nodes, err := state.Nodes.List()
+		if err != nil {
+			log.WithField("nodegroup", name).WithError(err).Warning("Failed to list nodes for the node group custom resource status")
+			continue
+		}
+		var targetSize int64
+		if cloudProviderNodeGroup, ok := getCloudProviderNodeGroup(c.cloudProvider, state.Opts); ok {
+			targetSize = cloudProviderNodeGroup.TargetSize()
+		}
+
+		resource.Object["status"] = status.object(int64(len(nodes)), targetSize)
+		if _, err := resources.UpdateStatus(resource, metav1.UpdateOptions{}); err != nil {
+			log.WithField("nodegroup", name).WithError(err).Warning("Failed to update the status of the node group custom resource")
+		}
+	}
+}
+
+// object returns the status as the status field of the custom resource
+func (s *nodeGroupStatus) object(nodes int64, targetSize int64) map[string]interface{} {
+	status := map[string]interface{}{
+		"nodes":         nodes,
+		"targetSize":    targetSize,
+		"cpuPercent":    s.cpuPercent,
+		"memoryPercent": s.memPercent,
+		"lastScanTime":  s.lastScan.UTC().Format(time.RFC3339),
+	}
+	if len(s.lastAction) > 0 {
+		status["lastAction"] = s.lastAction
+		status["lastActionNodes"] = int64(s.actionNodes)
+		status["lastActionTime"] = s.lastActed.UTC().Format(time.RFC3339)
+	}
+	if len(s.lastError) > 0 {
+		status["lastError"] = s.lastError
+	}
+	return status
+}
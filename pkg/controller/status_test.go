@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestUpdateNodeGroupStatuses(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{
+		{Name: "default", CloudProviderGroupName: "default"},
+		{Name: "unreflected", CloudProviderGroupName: "unreflected", LabelKey: "customer", LabelValue: "unreflected"},
+		{Name: "unscanned", CloudProviderGroupName: "unscanned", LabelKey: "customer", LabelValue: "unscanned"},
+	}
+	nodes := buildTestNodes(3, 1000, 1000)
+	client, opts := buildTestClient(nodes, nil, nodeGroups, ListerOptions{})
+
+	resource := func(name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "escalator.atlassian.com/v1alpha1",
+			"kind":       "NodeGroup",
+			"metadata":   map[string]interface{}{"name": name},
+		}}
+	}
+	statusClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), resource("default"), resource("unscanned"))
+	opts.StatusClient = statusClient
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testCloudProvider.RegisterNodeGroup(test.NewNodeGroup("default", 0, 10, 4))
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		cloudProvider: testCloudProvider,
+		nodeGroups: BuildNodeGroupsState(nodeGroupsStateOpts{
+			nodeGroups: nodeGroups,
+			client:     *client,
+		}),
+	}
+
+	controller.recordStatusUtilization("default", 72.5, 40)
+	controller.recordScaleUp("default", 0, 1)
+	controller.recordStatusScan("default", errors.New("no nodes remaining"))
+	controller.recordStatusScan("unreflected", nil)
+	controller.updateNodeGroupStatuses()
+
+	updated, err := statusClient.Resource(NodeGroupResource).Get("default", metav1.GetOptions{})
+	require.NoError(t, err)
+	status, ok := updated.Object["status"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, int64(3), status["nodes"])
+	assert.Equal(t, int64(4), status["targetSize"])
+	assert.Equal(t, 72.5, status["cpuPercent"])
+	assert.Equal(t, float64(40), status["memoryPercent"])
+	assert.Equal(t, nodeGroupActionScaleUp, status["lastAction"])
+	assert.Equal(t, int64(1), status["lastActionNodes"])
+	assert.Equal(t, "no nodes remaining", status["lastError"])
+	assert.NotEmpty(t, status["lastScanTime"])
+
+	// node groups that haven't been scanned have no status yet
+	unscanned, err := statusClient.Resource(NodeGroupResource).Get("unscanned", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, unscanned.Object, "status")
+
+	// a successful scan clears the error
+	controller.recordStatusScan("default", nil)
+	controller.updateNodeGroupStatuses()
+	updated, err = statusClient.Resource(NodeGroupResource).Get("default", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, updated.Object["status"], "lastError")
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// nodeGroupSummary is the scale actions a node group has performed since the controller started
+type nodeGroupSummary struct {
+	NodeGroup string
+	// ScaleUps is the number of scale ups that untainted or added nodes
+	ScaleUps int
+	// ScaleDowns is the number of scale downs that tainted nodes
+	ScaleDowns int
+	// NodesAdded is the number of nodes added to the cloud provider node group
+	NodesAdded int
+	// NodesUntainted is the number of tainted nodes brought back into service by scale ups
+	NodesUntainted int
+	// NodesTainted is the number of nodes tainted by scale downs
+	NodesTainted int
+	// NodesRemoved is the number of nodes terminated in the cloud provider and deleted from kubernetes
+	NodesRemoved int
+}
+
+// summaryFor returns the summary of the node group, creating it if it doesn't exist yet
+// summaries are kept by name so node groups that are no longer auto discovered are still included
+func (c *Controller) summaryFor(nodegroup string) *nodeGroupSummary {
+	if c.summaries == nil {
+		c.summaries = make(map[string]*nodeGroupSummary)
+	}
+	summary, ok := c.summaries[nodegroup]
+	if !ok {
+		summary = &nodeGroupSummary{NodeGroup: nodegroup}
+		c.summaries[nodegroup] = summary
+	}
+	return summary
+}
+
+// recordScaleUp adds a scale up that untainted or added nodes to the summary and status of the node group
+// and reports it to the metrics sinks and the event stream
+func (c *Controller) recordScaleUp(nodegroup string, untainted int, added int) {
+	if untainted <= 0 && added <= 0 {
+		return
+	}
+	summary := c.summaryFor(nodegroup)
+	summary.ScaleUps++
+	summary.NodesUntainted += untainted
+	summary.NodesAdded += added
+	c.recordStatusAction(nodegroup, nodeGroupActionScaleUp, untainted+added)
+	c.recordScaleEvent(nodegroup, nodeGroupActionScaleUp, untainted+added)
+	c.Opts.EventStream.ScaleUp(nodegroup, untainted+added)
+	for _, sink := range c.Opts.MetricsSinks {
+		sink.ScaleUp(nodegroup, untainted+added)
+	}
+}
+
+// recordScaleDown adds a scale down that tainted nodes to the summary and status of the node group
+// and reports it to the metrics sinks and the event stream
+func (c *Controller) recordScaleDown(nodegroup string, tainted int) {
+	if tainted <= 0 {
+		return
+	}
+	summary := c.summaryFor(nodegroup)
+	summary.ScaleDowns++
+	summary.NodesTainted += tainted
+	c.recordStatusAction(nodegroup, nodeGroupActionScaleDown, tainted)
+	c.recordScaleEvent(nodegroup, nodeGroupActionScaleDown, tainted)
+	c.Opts.EventStream.ScaleDown(nodegroup, tainted)
+	for _, sink := range c.Opts.MetricsSinks {
+		sink.ScaleDown(nodegroup, tainted)
+	}
+}
+
+// recordNodesRemoved adds nodes that were deleted to the summary of the node group
+func (c *Controller) recordNodesRemoved(nodegroup string, removed int) {
+	c.summaryFor(nodegroup).NodesRemoved += removed
+}
+
+// summary returns the summary of every node group, in the order they are scanned
+// followed by any node groups that are no longer auto discovered, sorted by name
+func (c *Controller) summary() []nodeGroupSummary {
+	names := c.nodeGroupNames()
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	var removed []string
+	for name := range c.summaries {
+		if !seen[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+
+	summaries := make([]nodeGroupSummary, 0, len(names)+len(removed))
+	for _, name := range append(names, removed...) {
+		if summary, ok := c.summaries[name]; ok {
+			summaries = append(summaries, *summary)
+		} else {
+			summaries = append(summaries, nodeGroupSummary{NodeGroup: name})
+		}
+	}
+	return summaries
+}
+
+// logSummary logs the summary of every node group and the totals across all node groups
+func (c *Controller) logSummary() {
+	total := nodeGroupSummary{}
+	for _, summary := range c.summary() {
+		log.WithFields(summaryFields(summary)).WithField("nodegroup", summary.NodeGroup).Info("Node group summary")
+		total.ScaleUps += summary.ScaleUps
+		total.ScaleDowns += summary.ScaleDowns
+		total.NodesAdded += summary.NodesAdded
+		total.NodesUntainted += summary.NodesUntainted
+		total.NodesTainted += summary.NodesTainted
+		total.NodesRemoved += summary.NodesRemoved
+	}
+	log.WithFields(summaryFields(total)).Info("Summary of all node groups")
+}
+
+// summaryFields returns the summary as structured log fields
+func summaryFields(summary nodeGroupSummary) log.Fields {
+	return log.Fields{
+		"scale_ups":       summary.ScaleUps,
+		"scale_downs":     summary.ScaleDowns,
+		"nodes_added":     summary.NodesAdded,
+		"nodes_untainted": summary.NodesUntainted,
+		"nodes_tainted":   summary.NodesTainted,
+		"nodes_removed":   summary.NodesRemoved,
+	}
+}
@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/eventstream"
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControllerSummary(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		ScaleUpCoolDownPeriod:              "1m",
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(10, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		stopChan:      nil,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	// node groups without any scale actions are included
+	assert.Equal(t, []nodeGroupSummary{{NodeGroup: "default"}}, controller.summary())
+
+	delta, err := controller.scaleNodeGroup("default", nodeGroupsState["default"])
+	require.NoError(t, err)
+	require.True(t, delta > 0)
+
+	controller.recordScaleDown("default", 2)
+	controller.recordNodesRemoved("default", 2)
+	// node groups that are no longer scanned, e.g. no longer auto discovered, are kept after the scanned node groups
+	controller.recordScaleDown("removed", 1)
+
+	assert.Equal(t, []nodeGroupSummary{
+		{
+			NodeGroup:    "default",
+			ScaleUps:     1,
+			ScaleDowns:   1,
+			NodesAdded:   delta,
+			NodesTainted: 2,
+			NodesRemoved: 2,
+		},
+		{
+			NodeGroup:    "removed",
+			ScaleDowns:   1,
+			NodesTainted: 1,
+		},
+	}, controller.summary())
+}
+
+// recordingSink is a metrics sink that keeps everything reported to it
+type recordingSink struct {
+	scaleUps    map[string]int
+	scaleDowns  map[string]int
+	utilization map[string][2]float64
+	flushes     int
+}
+
+func (s *recordingSink) ScaleUp(nodegroup string, nodes int) {
+	s.scaleUps[nodegroup] += nodes
+}
+
+func (s *recordingSink) ScaleDown(nodegroup string, nodes int) {
+	s.scaleDowns[nodegroup] += nodes
+}
+
+func (s *recordingSink) Utilization(nodegroup string, cpuPercent float64, memPercent float64) {
+	s.utilization[nodegroup] = [2]float64{cpuPercent, memPercent}
+}
+
+func (s *recordingSink) Flush() error {
+	s.flushes++
+	return nil
+}
+
+func TestControllerMetricsSinks(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		ScaleUpCoolDownPeriod:              "1m",
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(10, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+	sink := &recordingSink{
+		scaleUps:    make(map[string]int),
+		scaleDowns:  make(map[string]int),
+		utilization: make(map[string][2]float64),
+	}
+	opts.MetricsSinks = []metrics.Sink{sink}
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	controller := &Controller{
+		Client: client,
+		Opts:   opts,
+		nodeGroups: BuildNodeGroupsState(nodeGroupsStateOpts{
+			nodeGroups: nodeGroups,
+			client:     *client,
+		}),
+		cloudProvider: testCloudProvider,
+	}
+
+	require.NoError(t, controller.RunOnce())
+
+	assert.True(t, sink.scaleUps["default"] > 0)
+	assert.Equal(t, [2]float64{100, 100}, sink.utilization["default"])
+	assert.Equal(t, 1, sink.flushes)
+
+	controller.recordScaleDown("default", 2)
+	assert.Equal(t, 2, sink.scaleDowns["default"])
+}
+
+func TestControllerEventStream(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{{
+		Name:                               "default",
+		CloudProviderGroupName:             "default",
+		MinNodes:                           1,
+		MaxNodes:                           10,
+		ScaleUpThresholdPercent:            70,
+		TaintLowerCapacityThresholdPercent: 40,
+		TaintUpperCapacityThresholdPercent: 60,
+		ScaleUpCoolDownPeriod:              "1m",
+	}}
+	nodes := buildTestNodes(2, 1000, 1000)
+	pods := buildTestPods(10, 200, 200)
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+
+	var buf bytes.Buffer
+	opts.EventStream = eventstream.New(&buf)
+	events := func() []eventstream.Event {
+		var events []eventstream.Event
+		decoder := json.NewDecoder(&buf)
+		for decoder.More() {
+			var event eventstream.Event
+			require.NoError(t, decoder.Decode(&event))
+			events = append(events, event)
+		}
+		return events
+	}
+
+	testCloudProvider := test.NewCloudProvider(1)
+	testNodeGroup := test.NewNodeGroup("default", 1, 10, int64(len(nodes)))
+	testCloudProvider.RegisterNodeGroup(testNodeGroup)
+
+	nodeGroupsState := BuildNodeGroupsState(nodeGroupsStateOpts{
+		nodeGroups: nodeGroups,
+		client:     *client,
+	})
+	controller := &Controller{
+		Client:        client,
+		Opts:          opts,
+		nodeGroups:    nodeGroupsState,
+		cloudProvider: testCloudProvider,
+	}
+
+	require.NoError(t, controller.RunOnce())
+	scaleUps := events()
+	require.Len(t, scaleUps, 1)
+	assert.Equal(t, eventstream.EventScaleUp, scaleUps[0].Type)
+	assert.Equal(t, eventstream.SchemaVersion, scaleUps[0].SchemaVersion)
+	assert.Equal(t, "default", scaleUps[0].NodeGroup)
+	assert.True(t, scaleUps[0].Count > 0)
+
+	require.NoError(t, k8s.BeginTaintFailSafe(1))
+	tainted := controller.taintOldestN(nodes, nodeGroupsState["default"], 1)
+	require.NoError(t, k8s.EndTaintFailSafe(len(tainted)))
+	controller.recordScaleDown("default", len(tainted))
+	assert.Equal(t, []eventstream.Event{
+		{Type: eventstream.EventTaint, NodeGroup: "default", Count: 1, Nodes: []string{nodes[tainted[0]].Name}},
+		{Type: eventstream.EventScaleDown, NodeGroup: "default", Count: 1},
+	}, withoutVersionAndTime(events()))
+}
+
+// withoutVersionAndTime clears the schema version and time of the events, so they can be compared
+func withoutVersionAndTime(events []eventstream.Event) []eventstream.Event {
+	for i := range events {
+		events[i].SchemaVersion = 0
+		events[i].Time = time.Time{}
+	}
+	return events
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atlassian/escalator/pkg/k8s"
+	"github.com/atlassian/escalator/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The reasons a pending pod can't be scheduled onto any node group, the reason label of the unsatisfiable pending pods
+// metric. They are in the order the scheduler checks them
+const (
+	// unsatisfiableReasonNoNodeGroup the pod isn't selected by the pod selector of any node group
+	unsatisfiableReasonNoNodeGroup = "no_node_group"
+	// unsatisfiableReasonNodeLabels the node selector or required node affinity of the pod doesn't match any node
+	unsatisfiableReasonNodeLabels = "node_labels"
+	// unsatisfiableReasonTaints the pod doesn't tolerate the taints of any node whose labels it matches
+	unsatisfiableReasonTaints = "taints"
+	// unsatisfiableReasonResources the pod requests more resources than the allocatable of any node it can run on
+	unsatisfiableReasonResources = "resources"
+)
+
+// unsatisfiableReasons are the reasons of the unsatisfiable pending pods metric, reset every scan
+var unsatisfiableReasons = []string{
+	unsatisfiableReasonNoNodeGroup,
+	unsatisfiableReasonNodeLabels,
+	unsatisfiableReasonTaints,
+	unsatisfiableReasonResources,
+}
+
+// reportUnsatisfiablePendingPods finds the pending pods that no node group can ever schedule, e.g. because they request
+// more than the largest node or select labels no node has. Adding more of the same nodes won't help these pods, they
+// need a new node group or larger instances. A warning listing them and why is logged, and the count of each reason
+// is set on the unsatisfiable pending pods metric
+func (c *Controller) reportUnsatisfiablePendingPods() {
+	if c.Client == nil || c.Client.allPodLister == nil {
+		return
+	}
+	pods, err := c.Client.allPodLister.List(labels.Everything())
+	if err != nil {
+		log.WithError(err).Warning("Failed to list pods for the unsatisfiable pending pods check")
+		return
+	}
+
+	// the node groups each pod is selected by
+	nodeGroupsOfPod := make(map[types.UID][]*NodeGroupState)
+	nodesOfNodeGroup := make(map[*NodeGroupState][]*v1.Node)
+	for _, name := range c.nodeGroupNames() {
+		nodeGroup, ok := c.nodeGroups[name]
+		if !ok {
+			continue
+		}
+		nodeGroupPods, err := nodeGroup.Pods.List()
+		if err != nil {
+			log.WithField("nodegroup", name).WithError(err).Warning("Failed to list pods for the unsatisfiable pending pods check")
+			return
+		}
+		nodes, err := nodeGroup.Nodes.List()
+		if err != nil {
+			log.WithField("nodegroup", name).WithError(err).Warning("Failed to list nodes for the unsatisfiable pending pods check")
+			return
+		}
+		nodesOfNodeGroup[nodeGroup] = nodes
+		for _, pod := range nodeGroupPods {
+			nodeGroupsOfPod[pod.UID] = append(nodeGroupsOfPod[pod.UID], nodeGroup)
+		}
+	}
+
+	counts := make(map[string]int, len(unsatisfiableReasons))
+	var unsatisfiable []string
+	for _, pod := range pods {
+		if len(pod.Spec.NodeName) > 0 || k8s.PodIsTerminated(pod) || k8s.PodIsDaemonSet(pod) {
+			continue
+		}
+		reason := unsatisfiableReasonNoNodeGroup
+		for _, nodeGroup := range nodeGroupsOfPod[pod.UID] {
+			reason = podUnsatisfiableReason(pod, nodesOfNodeGroup[nodeGroup], nodeGroup.Opts)
+			if len(reason) == 0 {
+				break
+			}
+		}
+		if len(reason) == 0 {
+			continue
+		}
+		counts[reason]++
+		unsatisfiable = append(unsatisfiable, fmt.Sprintf("%v/%v (%v)", pod.Namespace, pod.Name, reason))
+	}
+
+	for _, reason := range unsatisfiableReasons {
+		metrics.UnsatisfiablePendingPods.WithLabelValues(reason).Set(float64(counts[reason]))
+	}
+	if len(unsatisfiable) > 0 {
+		log.Warningf("%v pending pods can't be scheduled onto any node group and need a new node group or larger instances: %v", len(unsatisfiable), strings.Join(unsatisfiable, ", "))
+	}
+}
+
+// podUnsatisfiableReason returns why the pending pod can't be scheduled onto any of the nodes of the node group, or an
+// empty string if it fits one of them. The reason is from the node the pod got furthest on in the order the scheduler
+// checks them. Pods always fit a node group without nodes, as the size of its nodes isn't known
+func podUnsatisfiableReason(pod *v1.Pod, nodes []*v1.Node, opts NodeGroupOptions) string {
+	if len(nodes) == 0 {
+		return ""
+	}
+	memRequest, cpuRequest := k8s.CalculatePodRequests(pod)
+	memReserved, cpuReserved := opts.NodeResourceReservation.Quantities()
+
+	stage := 0
+	for _, node := range nodes {
+		if !k8s.PodMatchesNodeLabels(pod, node.Labels) {
+			continue
+		}
+		if stage < 1 {
+			stage = 1
+		}
+		if taints := k8s.GetExternalTaints(node); len(taints) > 0 && !k8s.PodToleratesTaints(pod, taints) {
+			continue
+		}
+		stage = 2
+		memAllocatable, cpuAllocatable := k8s.NodeAllocatableLessReserved(node, memReserved, cpuReserved)
+		if memRequest.Cmp(memAllocatable) > 0 || cpuRequest.Cmp(cpuAllocatable) > 0 || !k8s.NodeFitsExtendedResources(pod, node) {
+			continue
+		}
+		return ""
+	}
+	return []string{unsatisfiableReasonNodeLabels, unsatisfiableReasonTaints, unsatisfiableReasonResources}[stage]
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/metrics"
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestPodUnsatisfiableReason(t *testing.T) {
+	gpuTaint := v1.Taint{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}
+	small := test.BuildTestNode(test.NodeOpts{Name: "small", CPU: 1000, Mem: 1000, LabelKey: "instance-type", LabelValue: "m5.large"})
+	gpu := test.BuildTestNode(test.NodeOpts{Name: "gpu", CPU: 4000, Mem: 4000, LabelKey: "instance-type", LabelValue: "p3.2xlarge"})
+	gpu.Spec.Taints = []v1.Taint{gpuTaint}
+	gpu.Status.Allocatable["nvidia.com/gpu"] = resource.MustParse("1")
+	nodes := []*v1.Node{small, gpu}
+
+	tolerating := func(pod *v1.Pod) *v1.Pod {
+		pod.Spec.Tolerations = []v1.Toleration{{Key: "dedicated", Operator: v1.TolerationOpExists}}
+		return pod
+	}
+	requestingGPUs := func(gpus string, pod *v1.Pod) *v1.Pod {
+		pod.Spec.Containers[0].Resources.Requests["nvidia.com/gpu"] = resource.MustParse(gpus)
+		return pod
+	}
+
+	tests := []struct {
+		name  string
+		pod   *v1.Pod
+		nodes []*v1.Node
+		want  string
+	}{
+		{
+			"fits",
+			test.BuildTestPod(test.PodOpts{Name: "fits", CPU: []int64{500}, Mem: []int64{500}}),
+			nodes,
+			"",
+		},
+		{
+			"no nodes",
+			test.BuildTestPod(test.PodOpts{Name: "no-nodes", CPU: []int64{8000}, Mem: []int64{500}}),
+			nil,
+			"",
+		},
+		{
+			"no matching labels",
+			test.BuildTestPod(test.PodOpts{Name: "labels", CPU: []int64{500}, Mem: []int64{500}, NodeSelectorKey: "instance-type", NodeSelectorValue: "c5.large"}),
+			nodes,
+			unsatisfiableReasonNodeLabels,
+		},
+		{
+			"doesn't tolerate taints",
+			test.BuildTestPod(test.PodOpts{Name: "taints", CPU: []int64{500}, Mem: []int64{500}, NodeSelectorKey: "instance-type", NodeSelectorValue: "p3.2xlarge"}),
+			nodes,
+			unsatisfiableReasonTaints,
+		},
+		{
+			"too big for any node",
+			test.BuildTestPod(test.PodOpts{Name: "too-big", CPU: []int64{2000}, Mem: []int64{500}}),
+			nodes,
+			unsatisfiableReasonResources,
+		},
+		{
+			"too big for the untainted node, fits the tainted node it tolerates",
+			tolerating(test.BuildTestPod(test.PodOpts{Name: "tolerating", CPU: []int64{2000}, Mem: []int64{500}})),
+			nodes,
+			"",
+		},
+		{
+			"too many gpus",
+			requestingGPUs("2", tolerating(test.BuildTestPod(test.PodOpts{Name: "gpus", CPU: []int64{500}, Mem: []int64{500}}))),
+			nodes,
+			unsatisfiableReasonResources,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, podUnsatisfiableReason(tt.pod, tt.nodes, NodeGroupOptions{}))
+		})
+	}
+}
+
+func TestControllerReportUnsatisfiablePendingPods(t *testing.T) {
+	nodeGroups := []NodeGroupOptions{
+		{Name: "default", CloudProviderGroupName: "default"},
+		{Name: "gpu", CloudProviderGroupName: "gpu", LabelKey: "customer", LabelValue: "gpu"},
+	}
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "default", CPU: 1000, Mem: 1000}),
+		test.BuildTestNode(test.NodeOpts{Name: "gpu", CPU: 4000, Mem: 4000, LabelKey: "customer", LabelValue: "gpu"}),
+	}
+	pods := []*v1.Pod{
+		test.BuildTestPod(test.PodOpts{Name: "fits", CPU: []int64{500}, Mem: []int64{500}}),
+		test.BuildTestPod(test.PodOpts{Name: "scheduled", CPU: []int64{8000}, Mem: []int64{500}, NodeName: "default"}),
+		test.BuildTestPod(test.PodOpts{Name: "too-big", CPU: []int64{2000}, Mem: []int64{500}}),
+		test.BuildTestPod(test.PodOpts{Name: "too-big-gpu", CPU: []int64{8000}, Mem: []int64{500}, NodeSelectorKey: "customer", NodeSelectorValue: "gpu"}),
+		test.BuildTestPod(test.PodOpts{Name: "unmanaged", CPU: []int64{500}, Mem: []int64{500}, NodeSelectorKey: "customer", NodeSelectorValue: "other"}),
+		test.BuildTestPod(test.PodOpts{Name: "completed", CPU: []int64{8000}, Mem: []int64{500}, Phase: v1.PodSucceeded}),
+	}
+	client, opts := buildTestClient(nodes, pods, nodeGroups, ListerOptions{})
+	controller := &Controller{
+		Client: client,
+		Opts:   opts,
+		nodeGroups: BuildNodeGroupsState(nodeGroupsStateOpts{
+			nodeGroups: nodeGroups,
+			client:     *client,
+		}),
+	}
+
+	controller.reportUnsatisfiablePendingPods()
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.UnsatisfiablePendingPods.WithLabelValues(unsatisfiableReasonNoNodeGroup)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.UnsatisfiablePendingPods.WithLabelValues(unsatisfiableReasonNodeLabels)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.UnsatisfiablePendingPods.WithLabelValues(unsatisfiableReasonTaints)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.UnsatisfiablePendingPods.WithLabelValues(unsatisfiableReasonResources)))
+}
@@ -2,22 +2,43 @@ package controller
 
 import (
 	"math"
+	"sort"
+	"time"
 
+	"github.com/atlassian/escalator/pkg/k8s"
 	"github.com/pkg/errors"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 )
 
+// nodeFractionTolerance is the largest fraction of a node over a whole number of nodes that is treated as float64
+// rounding error of the percentages rather than a need for another node
+const nodeFractionTolerance = 1e-9
+
+// ceilNodes rounds the number of nodes needed up to a whole number of nodes, ignoring rounding error
+// The percentages are calculated from milli unit requests and capacities that divide exactly into a whole number of
+// nodes, e.g. 28 pods requesting 250m on 1000m nodes, but float64 can't represent the result exactly and math.Ceil
+// would otherwise round 5.000000000000001 nodes up to 6
+func ceilNodes(nodes float64) float64 {
+	return math.Ceil(nodes - nodeFractionTolerance)
+}
+
 // calcScaleUpDelta determines the amount of nodes to scale up
 func calcScaleUpDelta(allNodes []*v1.Node, cpuPercent float64, memPercent float64, nodeGroup *NodeGroupState) (int, error) {
 	nodeCount := float64(len(allNodes))
 	scaleUpThresholdPercent := float64(nodeGroup.Opts.ScaleUpThresholdPercent)
 
+	// a weighted node group needs enough nodes to bring the blended utilization back below the threshold
+	if nodeGroup.Opts.UtilizationWeighted() {
+		cpuPercent = calcUtilizationPercent(cpuPercent, memPercent, nodeGroup.Opts)
+		memPercent = cpuPercent
+	}
+
 	percentageNeededCPU := (cpuPercent - scaleUpThresholdPercent) / scaleUpThresholdPercent
 	percentageNeededMem := (memPercent - scaleUpThresholdPercent) / scaleUpThresholdPercent
 
-	nodesNeededCPU := math.Ceil(nodeCount * (percentageNeededCPU))
-	nodesNeededMem := math.Ceil(nodeCount * (percentageNeededMem))
+	nodesNeededCPU := ceilNodes(nodeCount * (percentageNeededCPU))
+	nodesNeededMem := ceilNodes(nodeCount * (percentageNeededMem))
 
 	// Determine the delta based on whichever is higher (cpu or mem)
 	delta := int(math.Max(nodesNeededCPU, nodesNeededMem))
@@ -27,6 +48,317 @@ func calcScaleUpDelta(allNodes []*v1.Node, cpuPercent float64, memPercent float6
 	return delta, nil
 }
 
+// calcScaleUpMinNodes determines the amount of nodes that provide at least the minimum cpu and memory of a scale up
+// the capacity of a new node is assumed to be the average capacity of the existing nodes
+func calcScaleUpMinNodes(nodeCount int, cpuCapacity, memCapacity, minCPU, minMem resource.Quantity) int {
+	if nodeCount == 0 {
+		return 0
+	}
+	var nodesNeededCPU, nodesNeededMem float64
+	if minCPU.Sign() > 0 && cpuCapacity.Sign() > 0 {
+		nodesNeededCPU = ceilNodes(float64(minCPU.MilliValue()) * float64(nodeCount) / float64(cpuCapacity.MilliValue()))
+	}
+	if minMem.Sign() > 0 && memCapacity.Sign() > 0 {
+		nodesNeededMem = ceilNodes(float64(minMem.Value()) * float64(nodeCount) / float64(memCapacity.Value()))
+	}
+	return int(math.Max(nodesNeededCPU, nodesNeededMem))
+}
+
+// calcUtilizationPercent returns the utilization the node group scales on, the cpu_weight and memory_weight blend of the
+// cpu and memory utilization if set, otherwise the higher of the two
+func calcUtilizationPercent(cpuPercent float64, memPercent float64, opts NodeGroupOptions) float64 {
+	if !opts.UtilizationWeighted() {
+		return math.Max(cpuPercent, memPercent)
+	}
+	return opts.CPUWeight*cpuPercent + opts.MemoryWeight*memPercent
+}
+
+// calcHeadroomPercent returns the percentage points between the utilization and the nearest scaling threshold
+// positive when the nearest is scale_up_threshold_percent, negative when it is taint_upper_capacity_threshold_percent
+// and 0 once the utilization has passed either threshold, as the node group is already scaling
+func calcHeadroomPercent(percent float64, opts NodeGroupOptions) float64 {
+	scaleUp := float64(opts.ScaleUpThresholdPercent) - percent
+	scaleDown := percent - float64(opts.TaintUpperCapacityThresholdPercent)
+	switch {
+	case scaleUp <= 0 || scaleDown <= 0:
+		return 0
+	case scaleUp <= scaleDown:
+		return scaleUp
+	default:
+		return -scaleDown
+	}
+}
+
+// calcScaleUpRamp returns the nodes to add this scan when only the ramp fraction of the nodes needed is added each scan
+// at least one node is always added, and all of the nodes if the ramp is 0
+func calcScaleUpRamp(nodesNeeded int, ramp float64) int {
+	if ramp <= 0 || nodesNeeded <= 0 {
+		return nodesNeeded
+	}
+	return int(math.Max(ceilNodes(float64(nodesNeeded)*ramp), 1))
+}
+
+// calcScaleUpSoftCap returns the nodes to add this scan when the scale up slows down above the soft cap percent of max
+// nodes, from the target size of the node group. The nodes that take the target size up to the soft cap are added in
+// full. Each node above the soft cap is only added in proportion to how much room is left before max nodes where it
+// would be added, so the part above the soft cap is reduced by the average room left across it, rounded up and at least
+// one node, and the scale up slows as the node group approaches max nodes. Nodes that would go over max nodes are left
+// to be clamped by the scale up, as is everything when the target size is already at max nodes
+func calcScaleUpSoftCap(nodesNeeded int, targetSize int, maxNodes int, softCapPercent float64) int {
+	softCap := float64(maxNodes) * softCapPercent / 100
+	if softCapPercent <= 0 || softCap >= float64(maxNodes) || nodesNeeded <= 0 || float64(targetSize+nodesNeeded) <= softCap || targetSize >= maxNodes {
+		return nodesNeeded
+	}
+	// the nodes up to the soft cap, then the nodes between the soft cap, or target size above it, and max nodes
+	start := math.Max(float64(targetSize), softCap)
+	below := start - float64(targetSize)
+	above := math.Min(float64(targetSize+nodesNeeded), float64(maxNodes)) - start
+	room := (float64(maxNodes) - start - above/2) / (float64(maxNodes) - softCap)
+	return int(math.Min(ceilNodes(below)+math.Max(ceilNodes(above*room), 1), float64(nodesNeeded)))
+}
+
+// calcAntiAffinityNodesNeeded returns the number of unscheduled pods that can't share a node with another unscheduled
+// pod because of required pod anti-affinity. Each of them needs its own node, which the aggregate resource requests
+// don't account for
+func calcAntiAffinityNodesNeeded(pods []*v1.Pod) int {
+	unscheduled := make([]*v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if len(pod.Spec.NodeName) == 0 && !k8s.PodIsTerminated(pod) {
+			unscheduled = append(unscheduled, pod)
+		}
+	}
+
+	conflicting := make(map[int]bool)
+	for i, pod := range unscheduled {
+		for j, other := range unscheduled {
+			if i == j {
+				continue
+			}
+			if k8s.PodAntiAffinityMatches(pod, other) {
+				conflicting[i] = true
+				conflicting[j] = true
+			}
+		}
+	}
+	return len(conflicting)
+}
+
+// filterPodsMatchingNodes removes unscheduled pods that don't match any of the nodes, as adding more of the same nodes
+// would never allow them to be scheduled. A pod matches a node when its node selector and required node affinity match
+// the labels of the node, and the node has the extended resources, such as GPUs, and hugepages the pod requests
+// Scheduled pods are always kept. Returns the kept pods and the number of pods removed
+func filterPodsMatchingNodes(pods []*v1.Pod, nodes []*v1.Node) ([]*v1.Pod, int) {
+	if len(nodes) == 0 {
+		return pods, 0
+	}
+
+	filtered := make([]*v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if len(pod.Spec.NodeName) > 0 {
+			filtered = append(filtered, pod)
+			continue
+		}
+		for _, node := range nodes {
+			if k8s.PodMatchesNodeLabels(pod, node.Labels) && k8s.NodeFitsExtendedResources(pod, node) {
+				filtered = append(filtered, pod)
+				break
+			}
+		}
+	}
+	return filtered, len(pods) - len(filtered)
+}
+
+// filterPendingPodsFittingNodes separates unscheduled pods that fit in the free capacity of one of the nodes, as they're
+// pending for something other than capacity and adding nodes wouldn't schedule them any sooner. A pod fits a
+// schedulable Ready node when it matches the node's labels and extended resources, tolerates its external taints, and
+// its requests fit in the allocatable less reserved that the pods scheduled onto the node leave free. A removed pod
+// takes the free capacity it fits in, so two pods can't fit in the same space. This is best effort, it doesn't check
+// everything the scheduler does, such as pod affinity and host ports. Scheduled pods are always kept. Returns the kept
+// pods and the pods that fit
+func filterPendingPodsFittingNodes(pods []*v1.Pod, nodes []*v1.Node, memReserved, cpuReserved resource.Quantity) ([]*v1.Pod, []*v1.Pod) {
+	type freeCapacity struct {
+		node *v1.Node
+		mem  resource.Quantity
+		cpu  resource.Quantity
+	}
+	free := make([]*freeCapacity, 0, len(nodes))
+	freeByName := make(map[string]*freeCapacity, len(nodes))
+	for _, node := range nodes {
+		if node.Spec.Unschedulable || !k8s.NodeIsReady(node) {
+			continue
+		}
+		mem, cpu := k8s.NodeAllocatableLessReserved(node, memReserved, cpuReserved)
+		capacity := &freeCapacity{node: node, mem: mem, cpu: cpu}
+		free = append(free, capacity)
+		freeByName[node.Name] = capacity
+	}
+	if len(free) == 0 {
+		return pods, nil
+	}
+	for _, pod := range pods {
+		capacity, ok := freeByName[pod.Spec.NodeName]
+		if !ok || k8s.PodIsTerminated(pod) {
+			continue
+		}
+		mem, cpu := k8s.CalculatePodRequests(pod)
+		capacity.mem.Sub(mem)
+		capacity.cpu.Sub(cpu)
+	}
+
+	filtered := make([]*v1.Pod, 0, len(pods))
+	var fitting []*v1.Pod
+	for _, pod := range pods {
+		if len(pod.Spec.NodeName) > 0 {
+			filtered = append(filtered, pod)
+			continue
+		}
+		mem, cpu := k8s.CalculatePodRequests(pod)
+		fits := false
+		for _, capacity := range free {
+			if !k8s.PodMatchesNodeLabels(pod, capacity.node.Labels) || !k8s.NodeFitsExtendedResources(pod, capacity.node) {
+				continue
+			}
+			if taints := k8s.GetExternalTaints(capacity.node); len(taints) > 0 && !k8s.PodToleratesTaints(pod, taints) {
+				continue
+			}
+			if mem.Cmp(capacity.mem) > 0 || cpu.Cmp(capacity.cpu) > 0 {
+				continue
+			}
+			capacity.mem.Sub(mem)
+			capacity.cpu.Sub(cpu)
+			fits = true
+			break
+		}
+		if fits {
+			fitting = append(fitting, pod)
+		} else {
+			filtered = append(filtered, pod)
+		}
+	}
+	return filtered, fitting
+}
+
+// filterPodsDemandingCapacity removes unscheduled pods that aren't in any of the phases, as they shouldn't cause the
+// node group to scale up. Scheduled pods are always kept. Returns the kept pods and the number of pods removed
+func filterPodsDemandingCapacity(pods []*v1.Pod, phases []string) ([]*v1.Pod, int) {
+	filtered := make([]*v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if len(pod.Spec.NodeName) > 0 || podInPhases(pod, phases) {
+			filtered = append(filtered, pod)
+		}
+	}
+	return filtered, len(pods) - len(filtered)
+}
+
+// podInPhases returns whether the unscheduled pod is in any of the scale_up_pod_phases
+func podInPhases(pod *v1.Pod, phases []string) bool {
+	for _, phase := range phases {
+		switch phase {
+		case ScaleUpPodPhasePending:
+			if pod.Status.Phase == v1.PodPending || pod.Status.Phase == "" {
+				return true
+			}
+		case ScaleUpPodPhaseUnschedulable:
+			if k8s.PodIsUnschedulable(pod) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nodeNames returns the names of the nodes
+func nodeNames(nodes []*v1.Node) []string {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	return names
+}
+
+// filterExternalDeletionNodes separates the nodes marked for deletion by another tool with any of the taint keys from
+// the rest of the nodes
+func filterExternalDeletionNodes(nodes []*v1.Node, taintKeys []string) (remaining []*v1.Node, marked []*v1.Node) {
+	if len(taintKeys) == 0 {
+		return nodes, nil
+	}
+	remaining = make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if k8s.HasAnyTaintKey(node, taintKeys) {
+			marked = append(marked, node)
+		} else {
+			remaining = append(remaining, node)
+		}
+	}
+	return remaining, marked
+}
+
+// filterExternallyTaintedNodes removes nodes with a NoSchedule or NoExecute taint that wasn't applied by escalator and
+// isn't tolerated by any of the unscheduled pods, as none of the pending pods can be scheduled onto them
+// Pods scheduled onto the removed nodes are also removed, as they don't need capacity on the remaining nodes
+func filterExternallyTaintedNodes(nodes []*v1.Node, pods []*v1.Pod) ([]*v1.Node, []*v1.Pod) {
+	unscheduled := make([]*v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if len(pod.Spec.NodeName) == 0 {
+			unscheduled = append(unscheduled, pod)
+		}
+	}
+
+	filteredNodes := make([]*v1.Node, 0, len(nodes))
+	removed := make(map[string]bool)
+	for _, node := range nodes {
+		taints := k8s.GetExternalTaints(node)
+		usable := len(taints) == 0
+		for _, pod := range unscheduled {
+			if usable {
+				break
+			}
+			usable = k8s.PodToleratesTaints(pod, taints)
+		}
+		if usable {
+			filteredNodes = append(filteredNodes, node)
+		} else {
+			removed[node.Name] = true
+		}
+	}
+	if len(removed) == 0 {
+		return filteredNodes, pods
+	}
+
+	filteredPods := make([]*v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if !removed[pod.Spec.NodeName] {
+			filteredPods = append(filteredPods, pod)
+		}
+	}
+	return filteredNodes, filteredPods
+}
+
+// filterCrashLoopingPods removes the pods that have had a container in CrashLoopBackOff for at least the duration at
+// now, as their requests hold capacity without doing any work, and returns the number of pods removed
+func filterCrashLoopingPods(pods []*v1.Pod, after time.Duration, now time.Time) ([]*v1.Pod, int) {
+	filtered := make([]*v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if since, ok := k8s.PodCrashLoopingSince(pod); ok && now.Sub(since) >= after {
+			continue
+		}
+		filtered = append(filtered, pod)
+	}
+	return filtered, len(pods) - len(filtered)
+}
+
+// filterMemoryPressureNodes removes nodes with the MemoryPressure condition, as they have no room for more pods
+// and returns the number of nodes removed. The pods on the removed nodes are kept so their requests still count
+func filterMemoryPressureNodes(nodes []*v1.Node) ([]*v1.Node, int) {
+	filtered := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if !k8s.NodeHasMemoryPressure(node) {
+			filtered = append(filtered, node)
+		}
+	}
+	return filtered, len(nodes) - len(filtered)
+}
+
 // calcPercentUsage helper works out the percentage of cpu and mem for request/capacity
 func calcPercentUsage(cpuRequest, memRequest, cpuCapacity, memCapacity resource.Quantity) (float64, float64, error) {
 	if cpuCapacity.MilliValue() == 0 || memCapacity.MilliValue() == 0 {
@@ -37,3 +369,88 @@ func calcPercentUsage(cpuRequest, memRequest, cpuCapacity, memCapacity resource.
 	memPercent := float64(memRequest.MilliValue()) / float64(memCapacity.MilliValue()) * 100
 	return cpuPercent, memPercent, nil
 }
+
+// overcommit returns the quantity multiplied by the overcommit ratio
+func overcommit(quantity resource.Quantity, ratio float64) resource.Quantity {
+	return *resource.NewMilliQuantity(int64(float64(quantity.MilliValue())*ratio), quantity.Format)
+}
+
+// calcBinPackPercentUsage works out the percentage of cpu and mem by simulating packing the pods onto the nodes
+// Pods are placed first fit decreasing, largest first, onto the nodes. The percentage is the allocatable capacity of
+// the nodes that received at least one pod, plus the requests of any pods that did not fit onto any node, over the
+// capacity of all the nodes. Unlike calcPercentUsage this accounts for capacity that is fragmented across nodes
+// Pods that don't request memory or cpu are packed with the default memory or cpu request. The reserved memory and cpu
+// are subtracted from the allocatable capacity of each node, which is then multiplied by the memory and cpu overcommit
+// ratios
+func calcBinPackPercentUsage(pods []*v1.Pod, nodes []*v1.Node, memDefault, cpuDefault, memReserved, cpuReserved resource.Quantity, memRatio, cpuRatio float64) (float64, float64, error) {
+	memCapacity, cpuCapacity, err := k8s.CalculateNodesCapacityTotalLessReserved(nodes, memReserved, cpuReserved)
+	if err != nil {
+		return 0, 0, err
+	}
+	memCapacity, cpuCapacity = overcommit(memCapacity, memRatio), overcommit(cpuCapacity, cpuRatio)
+	if cpuCapacity.MilliValue() == 0 || memCapacity.MilliValue() == 0 {
+		return 0, 0, errors.New("cannot divide by zero in percent calculation")
+	}
+
+	type resources struct {
+		cpu int64
+		mem int64
+	}
+
+	requests := make([]resources, 0, len(pods))
+	for _, pod := range pods {
+		if k8s.PodIsTerminated(pod) {
+			continue
+		}
+		mem, cpu := k8s.CalculatePodRequestsOrDefault(pod, memDefault, cpuDefault)
+		requests = append(requests, resources{cpu.MilliValue(), mem.MilliValue()})
+	}
+
+	// sort by the largest share of the node group capacity the pod requests of either resource
+	share := func(r resources) float64 {
+		return math.Max(float64(r.cpu)/float64(cpuCapacity.MilliValue()), float64(r.mem)/float64(memCapacity.MilliValue()))
+	}
+	sort.SliceStable(requests, func(i, j int) bool {
+		return share(requests[i]) > share(requests[j])
+	})
+
+	allocatable := make([]resources, len(nodes))
+	for i, node := range nodes {
+		mem, cpu := k8s.NodeAllocatableLessReserved(node, memReserved, cpuReserved)
+		mem, cpu = overcommit(mem, memRatio), overcommit(cpu, cpuRatio)
+		allocatable[i] = resources{cpu.MilliValue(), mem.MilliValue()}
+	}
+	free := make([]resources, len(nodes))
+	copy(free, allocatable)
+	used := make([]bool, len(nodes))
+
+	var unplaced resources
+	for _, request := range requests {
+		placed := false
+		for i := range free {
+			if free[i].cpu >= request.cpu && free[i].mem >= request.mem {
+				free[i].cpu -= request.cpu
+				free[i].mem -= request.mem
+				used[i] = true
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			unplaced.cpu += request.cpu
+			unplaced.mem += request.mem
+		}
+	}
+
+	occupied := unplaced
+	for i := range nodes {
+		if used[i] {
+			occupied.cpu += allocatable[i].cpu
+			occupied.mem += allocatable[i].mem
+		}
+	}
+
+	cpuPercent := float64(occupied.cpu) / float64(cpuCapacity.MilliValue()) * 100
+	memPercent := float64(occupied.mem) / float64(memCapacity.MilliValue()) * 100
+	return cpuPercent, memPercent, nil
+}
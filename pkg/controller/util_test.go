@@ -2,6 +2,7 @@ package controller
 
 import (
 	"testing"
+	"time"
 
 	"github.com/atlassian/escalator/pkg/k8s"
 	"github.com/atlassian/escalator/pkg/test"
@@ -10,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestCalcScaleUpDeltaBelowThreshold(t *testing.T) {
@@ -198,6 +200,387 @@ func calculatePercentageUsage(pods []*v1.Pod, nodes []*v1.Node) (float64, float6
 	return calcPercentUsage(cpuRequest, memRequest, cpuCapacity, memCapacity)
 }
 
+func TestCalcScaleUpDeltaMilliCPU(t *testing.T) {
+	// many pods requesting small millicpu values, so the percentages are fractional
+	for _, nodeCount := range []int{1, 3, 5, 7, 10, 25} {
+		for _, threshold := range []int{50, 60, 70, 75, 80, 90} {
+			for podCount := 1; podCount <= 200; podCount++ {
+				pods := test.BuildTestPods(podCount, test.PodOpts{
+					CPU: []int64{250},
+					Mem: []int64{1},
+				})
+				nodes := test.BuildTestNodes(nodeCount, test.NodeOpts{
+					CPU: 1000,
+					Mem: 1000000,
+				})
+				memRequest, cpuRequest, err := k8s.CalculatePodsRequestsTotal(pods)
+				require.NoError(t, err)
+				memCapacity, cpuCapacity, err := k8s.CalculateNodesCapacityTotal(nodes)
+				require.NoError(t, err)
+				cpuPercent, memPercent, err := calcPercentUsage(cpuRequest, memRequest, cpuCapacity, memCapacity)
+				require.NoError(t, err)
+				if cpuPercent <= float64(threshold) {
+					continue
+				}
+
+				// the nodes needed to bring the utilization to the threshold, in integer milli cpu
+				requested := int64(podCount) * 250 * 100
+				perNode := int64(1000 * threshold)
+				want := int((requested+perNode-1)/perNode) - nodeCount
+
+				got, err := calcScaleUpDelta(nodes, cpuPercent, memPercent, &NodeGroupState{
+					Opts: NodeGroupOptions{ScaleUpThresholdPercent: threshold},
+				})
+				require.NoError(t, err)
+				assert.Equal(t, want, got, "%v pods of 250m on %v nodes of 1000m with a threshold of %v%%", podCount, nodeCount, threshold)
+			}
+		}
+	}
+}
+
+func TestCalcScaleUpMinNodes(t *testing.T) {
+	cpuCapacity, memCapacity := resource.MustParse("16"), resource.MustParse("64Gi")
+
+	// 4 nodes of 4 cpu and 16Gi
+	assert.Equal(t, 8, calcScaleUpMinNodes(4, cpuCapacity, memCapacity, resource.MustParse("32"), resource.Quantity{}))
+	assert.Equal(t, 4, calcScaleUpMinNodes(4, cpuCapacity, memCapacity, resource.Quantity{}, resource.MustParse("64Gi")))
+	assert.Equal(t, 3, calcScaleUpMinNodes(4, cpuCapacity, memCapacity, resource.MustParse("10"), resource.MustParse("20Gi")))
+	assert.Equal(t, 2, calcScaleUpMinNodes(4, cpuCapacity, memCapacity, resource.MustParse("500m"), resource.MustParse("20Gi")))
+	assert.Equal(t, 0, calcScaleUpMinNodes(4, cpuCapacity, memCapacity, resource.Quantity{}, resource.Quantity{}))
+
+	// the capacity of a node isn't known without any nodes
+	assert.Equal(t, 0, calcScaleUpMinNodes(0, resource.Quantity{}, resource.Quantity{}, resource.MustParse("32"), resource.MustParse("64Gi")))
+}
+
+func TestCalcUtilizationPercent(t *testing.T) {
+	tests := []struct {
+		name         string
+		cpuWeight    float64
+		memoryWeight float64
+		cpuPercent   float64
+		memPercent   float64
+		want         float64
+	}{
+		{"unweighted uses cpu when higher", 0, 0, 80, 40, 80},
+		{"unweighted uses memory when higher", 0, 0, 40, 80, 80},
+		{"equal weights", 0.5, 0.5, 80, 40, 60},
+		{"cpu weighted", 0.75, 0.25, 80, 40, 70},
+		{"memory weighted", 0.25, 0.75, 80, 40, 50},
+		{"cpu only", 1, 0, 40, 80, 40},
+		{"memory only", 0, 1, 80, 40, 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NodeGroupOptions{CPUWeight: tt.cpuWeight, MemoryWeight: tt.memoryWeight}
+			assert.InDelta(t, tt.want, calcUtilizationPercent(tt.cpuPercent, tt.memPercent, opts), 1e-9)
+		})
+	}
+}
+
+func TestCalcScaleUpDeltaWeighted(t *testing.T) {
+	nodes := test.BuildTestNodes(10, test.NodeOpts{CPU: 1000, Mem: 1000})
+	tests := []struct {
+		name         string
+		cpuWeight    float64
+		memoryWeight float64
+		want         int
+	}{
+		// 100% cpu and 60% memory with a threshold of 50%
+		{"unweighted", 0, 0, 10},
+		{"equal weights", 0.5, 0.5, 6},
+		{"memory weighted", 0.25, 0.75, 4},
+		{"memory only", 0, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := calcScaleUpDelta(nodes, 100, 60, &NodeGroupState{
+				Opts: NodeGroupOptions{ScaleUpThresholdPercent: 50, CPUWeight: tt.cpuWeight, MemoryWeight: tt.memoryWeight},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCalcHeadroomPercent(t *testing.T) {
+	opts := NodeGroupOptions{
+		TaintLowerCapacityThresholdPercent: 30,
+		TaintUpperCapacityThresholdPercent: 40,
+		ScaleUpThresholdPercent:            70,
+	}
+	tests := []struct {
+		name    string
+		percent float64
+		want    float64
+	}{
+		{"nearest the scale up threshold", 60, 10},
+		{"nearest the scale down threshold", 45, -5},
+		{"halfway between the thresholds", 55, 15},
+		{"at the scale up threshold", 70, 0},
+		{"above the scale up threshold", 90, 0},
+		{"at the scale down threshold", 40, 0},
+		{"below the scale down threshold", 10, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, calcHeadroomPercent(tt.percent, opts))
+		})
+	}
+}
+
+func TestCalcScaleUpRamp(t *testing.T) {
+	tests := []struct {
+		name        string
+		nodesNeeded int
+		ramp        float64
+		want        int
+	}{
+		{"disabled", 40, 0, 40},
+		{"quarter of the nodes", 40, 0.25, 10},
+		{"rounds up", 41, 0.25, 11},
+		{"at least one node", 2, 0.1, 1},
+		{"all of the nodes", 40, 1, 40},
+		{"no nodes needed", 0, 0.25, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, calcScaleUpRamp(tt.nodesNeeded, tt.ramp))
+		})
+	}
+}
+
+func TestCalcScaleUpSoftCap(t *testing.T) {
+	tests := []struct {
+		name           string
+		nodesNeeded    int
+		targetSize     int
+		maxNodes       int
+		softCapPercent float64
+		want           int
+	}{
+		{"disabled", 20, 90, 100, 0, 20},
+		{"below the soft cap", 20, 50, 100, 80, 20},
+		{"up to the soft cap", 20, 60, 100, 80, 20},
+		// 10 nodes up to the soft cap, then 10 nodes with an average of 75% room left
+		{"across the soft cap", 20, 70, 100, 80, 18},
+		{"just below the soft cap to max", 21, 79, 100, 80, 11},
+		{"from the soft cap to max", 20, 80, 100, 80, 10},
+		{"just above the soft cap", 10, 81, 100, 80, 7},
+		// only the 10 nodes up to max are slowed, with an average of 25% room left
+		{"half way between the soft cap and max", 20, 90, 100, 80, 3},
+		{"rounds up", 5, 90, 100, 80, 2},
+		{"at least one node", 20, 99, 100, 80, 1},
+		{"at max", 20, 100, 100, 80, 20},
+		{"soft cap of max", 20, 90, 100, 100, 20},
+		{"fractional soft cap", 2, 7, 10, 85, 2},
+		{"no nodes needed", 0, 90, 100, 80, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, calcScaleUpSoftCap(tt.nodesNeeded, tt.targetSize, tt.maxNodes, tt.softCapPercent))
+		})
+	}
+}
+
+func TestCalcAntiAffinityNodesNeeded(t *testing.T) {
+	antiAffinity := func(name string, app string) *v1.Pod {
+		pod := test.BuildTestPod(test.PodOpts{Name: name})
+		pod.Labels = map[string]string{"app": app}
+		pod.Spec.Affinity = &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+				TopologyKey:   k8s.HostnameTopologyKey,
+			}},
+		}}
+		return pod
+	}
+
+	db := []*v1.Pod{antiAffinity("db-1", "db"), antiAffinity("db-2", "db"), antiAffinity("db-3", "db")}
+	cache := antiAffinity("cache-1", "cache")
+	plain := test.BuildTestPod(test.PodOpts{Name: "plain"})
+
+	// a single pod only conflicting with its own labels fits onto any node
+	assert.Equal(t, 0, calcAntiAffinityNodesNeeded([]*v1.Pod{cache, plain}))
+	assert.Equal(t, 3, calcAntiAffinityNodesNeeded(append([]*v1.Pod{cache, plain}, db...)))
+
+	// scheduled pods already have a node
+	scheduled := antiAffinity("db-4", "db")
+	scheduled.Spec.NodeName = "n1"
+	assert.Equal(t, 0, calcAntiAffinityNodesNeeded([]*v1.Pod{db[0], scheduled}))
+
+	// anti-affinity across zones doesn't need distinct nodes
+	zonal := []*v1.Pod{antiAffinity("zonal-1", "zonal"), antiAffinity("zonal-2", "zonal")}
+	for _, pod := range zonal {
+		pod.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0].TopologyKey = "failure-domain.beta.kubernetes.io/zone"
+	}
+	assert.Equal(t, 0, calcAntiAffinityNodesNeeded(zonal))
+}
+
+func TestFilterPodsMatchingNodes(t *testing.T) {
+	nodes := []*v1.Node{
+		test.BuildTestNode(test.NodeOpts{Name: "n1", LabelKey: "instance-type", LabelValue: "m5.large"}),
+		test.BuildTestNode(test.NodeOpts{Name: "n2", LabelKey: "instance-type", LabelValue: "m5.xlarge"}),
+	}
+	matching := test.BuildTestPod(test.PodOpts{Name: "matching", NodeAffinityKey: "instance-type", NodeAffinityValue: "m5.xlarge"})
+	notMatching := test.BuildTestPod(test.PodOpts{Name: "not-matching", NodeAffinityKey: "instance-type", NodeAffinityValue: "p3.2xlarge"})
+	scheduled := test.BuildTestPod(test.PodOpts{Name: "scheduled", NodeSelectorKey: "instance-type", NodeSelectorValue: "p3.2xlarge", NodeName: "n1"})
+
+	pods, removed := filterPodsMatchingNodes([]*v1.Pod{matching, notMatching, scheduled}, nodes)
+	assert.Equal(t, []*v1.Pod{matching, scheduled}, pods)
+	assert.Equal(t, 1, removed)
+
+	// without any nodes there are no labels to match against
+	pods, removed = filterPodsMatchingNodes([]*v1.Pod{matching, notMatching}, nil)
+	assert.Equal(t, []*v1.Pod{matching, notMatching}, pods)
+	assert.Equal(t, 0, removed)
+
+	// the pod must also fit the extended resources of a matching node
+	hugepages := test.BuildTestPod(test.PodOpts{Name: "hugepages", CPU: []int64{500}, Mem: []int64{10}, NodeAffinityKey: "instance-type", NodeAffinityValue: "m5.xlarge"})
+	hugepages.Spec.Containers[0].Resources.Requests["hugepages-2Mi"] = resource.MustParse("512Mi")
+	pods, removed = filterPodsMatchingNodes([]*v1.Pod{matching, hugepages}, nodes)
+	assert.Equal(t, []*v1.Pod{matching}, pods)
+	assert.Equal(t, 1, removed)
+
+	nodes[1].Status.Allocatable["hugepages-2Mi"] = resource.MustParse("1Gi")
+	pods, removed = filterPodsMatchingNodes([]*v1.Pod{matching, hugepages}, nodes)
+	assert.Equal(t, []*v1.Pod{matching, hugepages}, pods)
+	assert.Equal(t, 0, removed)
+}
+
+func TestFilterPendingPodsFittingNodes(t *testing.T) {
+	gpuTaint := v1.Taint{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}
+	small := test.BuildTestNode(test.NodeOpts{Name: "small", CPU: 1000, Mem: 1000, LabelKey: "instance-type", LabelValue: "m5.large"})
+	tainted := test.BuildTestNode(test.NodeOpts{Name: "tainted", CPU: 4000, Mem: 4000, LabelKey: "instance-type", LabelValue: "p3.2xlarge"})
+	tainted.Spec.Taints = []v1.Taint{gpuTaint}
+	cordoned := test.BuildTestNode(test.NodeOpts{Name: "cordoned", CPU: 4000, Mem: 4000, LabelKey: "instance-type", LabelValue: "m5.large"})
+	cordoned.Spec.Unschedulable = true
+	nodes := []*v1.Node{small, tainted, cordoned}
+
+	scheduled := test.BuildTestPod(test.PodOpts{Name: "scheduled", CPU: []int64{600}, Mem: []int64{600}, NodeName: "small"})
+	fits := test.BuildTestPod(test.PodOpts{Name: "fits", CPU: []int64{300}, Mem: []int64{300}})
+	tooBig := test.BuildTestPod(test.PodOpts{Name: "too-big", CPU: []int64{500}, Mem: []int64{300}})
+	wrongLabels := test.BuildTestPod(test.PodOpts{Name: "wrong-labels", CPU: []int64{100}, Mem: []int64{100}, NodeSelectorKey: "instance-type", NodeSelectorValue: "c5.large"})
+	tolerating := test.BuildTestPod(test.PodOpts{Name: "tolerating", CPU: []int64{2000}, Mem: []int64{300}})
+	tolerating.Spec.Tolerations = []v1.Toleration{{Key: "dedicated", Operator: v1.TolerationOpExists}}
+
+	// the pod that doesn't fit the 400m left on the small node, doesn't match its labels or only fits the cordoned
+	// node are kept. The pod tolerating the taint fits the tainted node
+	pods, fitting := filterPendingPodsFittingNodes([]*v1.Pod{scheduled, fits, tooBig, wrongLabels, tolerating}, nodes, resource.Quantity{}, resource.Quantity{})
+	assert.Equal(t, []*v1.Pod{scheduled, tooBig, wrongLabels}, pods)
+	assert.Equal(t, []*v1.Pod{fits, tolerating}, fitting)
+
+	// the second pod doesn't fit in the capacity the first took
+	fitsToo := test.BuildTestPod(test.PodOpts{Name: "fits-too", CPU: []int64{300}, Mem: []int64{300}})
+	pods, fitting = filterPendingPodsFittingNodes([]*v1.Pod{scheduled, fits, fitsToo}, []*v1.Node{small}, resource.Quantity{}, resource.Quantity{})
+	assert.Equal(t, []*v1.Pod{scheduled, fitsToo}, pods)
+	assert.Equal(t, []*v1.Pod{fits}, fitting)
+
+	// the reserved resources aren't free
+	pods, fitting = filterPendingPodsFittingNodes([]*v1.Pod{scheduled, fits}, []*v1.Node{small}, resource.MustParse("200"), resource.MustParse("200m"))
+	assert.Equal(t, []*v1.Pod{scheduled, fits}, pods)
+	assert.Empty(t, fitting)
+
+	// nothing fits without nodes
+	pods, fitting = filterPendingPodsFittingNodes([]*v1.Pod{fits}, nil, resource.Quantity{}, resource.Quantity{})
+	assert.Equal(t, []*v1.Pod{fits}, pods)
+	assert.Empty(t, fitting)
+}
+
+func TestFilterPodsDemandingCapacity(t *testing.T) {
+	pending := test.BuildTestPod(test.PodOpts{Name: "pending", Phase: v1.PodPending})
+	unschedulable := test.BuildTestPod(test.PodOpts{Name: "unschedulable", Phase: v1.PodPending})
+	unschedulable.Status.Conditions = []v1.PodCondition{{
+		Type:   v1.PodScheduled,
+		Status: v1.ConditionFalse,
+		Reason: v1.PodReasonUnschedulable,
+	}}
+	scheduled := test.BuildTestPod(test.PodOpts{Name: "scheduled", NodeName: "n1", Phase: v1.PodRunning})
+	pods := []*v1.Pod{pending, unschedulable, scheduled}
+
+	// every pending pod demands capacity by default
+	filtered, removed := filterPodsDemandingCapacity(pods, DefaultScaleUpPodPhases)
+	assert.Equal(t, pods, filtered)
+	assert.Equal(t, 0, removed)
+
+	// only the pods the scheduler couldn't place
+	filtered, removed = filterPodsDemandingCapacity(pods, []string{ScaleUpPodPhaseUnschedulable})
+	assert.Equal(t, []*v1.Pod{unschedulable, scheduled}, filtered)
+	assert.Equal(t, 1, removed)
+
+	// unscheduled pods that have terminated aren't pending
+	failed := test.BuildTestPod(test.PodOpts{Name: "failed", Phase: v1.PodFailed})
+	filtered, removed = filterPodsDemandingCapacity([]*v1.Pod{failed, scheduled}, []string{ScaleUpPodPhasePending})
+	assert.Equal(t, []*v1.Pod{scheduled}, filtered)
+	assert.Equal(t, 1, removed)
+}
+
+// crashLooping makes the pod's container wait in CrashLoopBackOff, having stopped being ready at the time
+func crashLooping(pod *v1.Pod, notReady time.Time) *v1.Pod {
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+		State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: k8s.CrashLoopBackOffReason}},
+	}}
+	pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse, LastTransitionTime: metav1.NewTime(notReady)}}
+	return pod
+}
+
+func TestFilterCrashLoopingPods(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	pods := buildTestPods(3, 100, 100)
+	crashLooping(pods[1], now.Add(-time.Hour))
+	crashLooping(pods[2], now.Add(-time.Minute))
+
+	filtered, removed := filterCrashLoopingPods(pods, 30*time.Minute, now)
+	assert.Equal(t, []*v1.Pod{pods[0], pods[2]}, filtered)
+	assert.Equal(t, 1, removed)
+
+	filtered, removed = filterCrashLoopingPods(pods, time.Minute, now)
+	assert.Equal(t, []*v1.Pod{pods[0]}, filtered)
+	assert.Equal(t, 2, removed)
+}
+
+func TestFilterExternalDeletionNodes(t *testing.T) {
+	nodes := buildTestNodes(3, 1000, 1000)
+	nodes[1].Spec.Taints = []v1.Taint{{Key: "ToBeDeletedByClusterAutoscaler", Value: "1700000000", Effect: v1.TaintEffectNoSchedule}}
+
+	remaining, marked := filterExternalDeletionNodes(nodes, nil)
+	assert.Equal(t, nodes, remaining)
+	assert.Empty(t, marked)
+
+	remaining, marked = filterExternalDeletionNodes(nodes, []string{"ToBeDeletedByClusterAutoscaler"})
+	assert.Equal(t, []*v1.Node{nodes[0], nodes[2]}, remaining)
+	assert.Equal(t, []*v1.Node{nodes[1]}, marked)
+}
+
+func TestFilterExternallyTaintedNodes(t *testing.T) {
+	gpuTaint := v1.Taint{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}
+	usable := test.BuildTestNode(test.NodeOpts{Name: "usable"})
+	preferred := test.BuildTestNode(test.NodeOpts{Name: "preferred"})
+	preferred.Spec.Taints = []v1.Taint{{Key: "dedicated", Effect: v1.TaintEffectPreferNoSchedule}}
+	gpu := test.BuildTestNode(test.NodeOpts{Name: "gpu"})
+	gpu.Spec.Taints = []v1.Taint{gpuTaint}
+	nodes := []*v1.Node{usable, preferred, gpu}
+
+	running := test.BuildTestPod(test.PodOpts{Name: "running", NodeName: "usable"})
+	runningOnGPU := test.BuildTestPod(test.PodOpts{Name: "running-gpu", NodeName: "gpu"})
+	pending := test.BuildTestPod(test.PodOpts{Name: "pending"})
+
+	filteredNodes, filteredPods := filterExternallyTaintedNodes(nodes, []*v1.Pod{running, runningOnGPU, pending})
+	assert.Equal(t, []*v1.Node{usable, preferred}, filteredNodes)
+	assert.Equal(t, []*v1.Pod{running, pending}, filteredPods)
+
+	// the node is kept when a pending pod tolerates its taints
+	tolerating := test.BuildTestPod(test.PodOpts{Name: "tolerating"})
+	tolerating.Spec.Tolerations = []v1.Toleration{{Key: "dedicated", Operator: v1.TolerationOpExists}}
+	filteredNodes, filteredPods = filterExternallyTaintedNodes(nodes, []*v1.Pod{running, runningOnGPU, pending, tolerating})
+	assert.Equal(t, nodes, filteredNodes)
+	assert.Equal(t, []*v1.Pod{running, runningOnGPU, pending, tolerating}, filteredPods)
+
+	// the escalator taint isn't an external taint
+	tainted := test.BuildTestNode(test.NodeOpts{Name: "tainted", Tainted: true})
+	filteredNodes, _ = filterExternallyTaintedNodes([]*v1.Node{tainted}, nil)
+	assert.Equal(t, []*v1.Node{tainted}, filteredNodes)
+}
+
 func TestCalcPercentUsage(t *testing.T) {
 	type args struct {
 		cpuRequest  resource.Quantity
@@ -274,3 +657,141 @@ func TestCalcPercentUsage(t *testing.T) {
 		})
 	}
 }
+
+func TestCalcBinPackPercentUsage(t *testing.T) {
+	tests := []struct {
+		name        string
+		pods        []*v1.Pod
+		nodes       []*v1.Node
+		memReserved resource.Quantity
+		cpuReserved resource.Quantity
+		expectedCPU float64
+		expectedMem float64
+		err         error
+	}{
+		{
+			"pods packed onto fewer nodes",
+			test.BuildTestPods(4, test.PodOpts{
+				CPU: []int64{250},
+				Mem: []int64{250},
+			}),
+			test.BuildTestNodes(4, test.NodeOpts{
+				CPU: 1000,
+				Mem: 1000,
+			}),
+			resource.Quantity{},
+			resource.Quantity{},
+			25,
+			25,
+			nil,
+		},
+		{
+			"fragmented pods that do not fit on any node",
+			test.BuildTestPods(3, test.PodOpts{
+				CPU: []int64{600},
+				Mem: []int64{100},
+			}),
+			test.BuildTestNodes(2, test.NodeOpts{
+				CPU: 1000,
+				Mem: 1000,
+			}),
+			resource.Quantity{},
+			resource.Quantity{},
+			130,
+			105,
+			nil,
+		},
+		{
+			"terminated pods are ignored",
+			test.BuildTestPods(2, test.PodOpts{
+				CPU:   []int64{500},
+				Mem:   []int64{500},
+				Phase: v1.PodSucceeded,
+			}),
+			test.BuildTestNodes(2, test.NodeOpts{
+				CPU: 1000,
+				Mem: 1000,
+			}),
+			resource.Quantity{},
+			resource.Quantity{},
+			0,
+			0,
+			nil,
+		},
+		{
+			"reservation subtracted from each node",
+			test.BuildTestPods(2, test.PodOpts{
+				CPU: []int64{500},
+				Mem: []int64{500},
+			}),
+			test.BuildTestNodes(2, test.NodeOpts{
+				CPU: 1000,
+				Mem: 1000,
+			}),
+			*resource.NewQuantity(500, resource.DecimalSI),
+			*resource.NewMilliQuantity(500, resource.DecimalSI),
+			100,
+			100,
+			nil,
+		},
+		{
+			"divide by zero test",
+			test.BuildTestPods(1, test.PodOpts{
+				CPU: []int64{500},
+				Mem: []int64{500},
+			}),
+			nil,
+			resource.Quantity{},
+			resource.Quantity{},
+			0,
+			0,
+			errors.New("cannot divide by zero in percent calculation"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cpu, mem, err := calcBinPackPercentUsage(tt.pods, tt.nodes, resource.Quantity{}, resource.Quantity{}, tt.memReserved, tt.cpuReserved, 1, 1)
+			if tt.err == nil {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, tt.err, err.Error())
+			}
+			assert.InDelta(t, tt.expectedCPU, cpu, 0.001)
+			assert.InDelta(t, tt.expectedMem, mem, 0.001)
+		})
+	}
+}
+
+func TestCalcBinPackPercentUsageOvercommit(t *testing.T) {
+	pods := test.BuildTestPods(4, test.PodOpts{
+		CPU: []int64{500},
+		Mem: []int64{500},
+	})
+	nodes := test.BuildTestNodes(2, test.NodeOpts{
+		CPU: 1000,
+		Mem: 1000,
+	})
+
+	cpu, mem, err := calcBinPackPercentUsage(pods, nodes, resource.Quantity{}, resource.Quantity{}, resource.Quantity{}, resource.Quantity{}, 1, 1)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, cpu, 0.001)
+	assert.InDelta(t, 100, mem, 0.001)
+
+	// with double the cpu all the pods fit onto one node by cpu, but still need both nodes for memory
+	cpu, mem, err = calcBinPackPercentUsage(pods, nodes, resource.Quantity{}, resource.Quantity{}, resource.Quantity{}, resource.Quantity{}, 1, 2)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, cpu, 0.001)
+	assert.InDelta(t, 100, mem, 0.001)
+
+	cpu, mem, err = calcBinPackPercentUsage(pods, nodes, resource.Quantity{}, resource.Quantity{}, resource.Quantity{}, resource.Quantity{}, 2, 2)
+	require.NoError(t, err)
+	assert.InDelta(t, 50, cpu, 0.001)
+	assert.InDelta(t, 50, mem, 0.001)
+}
+
+func TestOvercommit(t *testing.T) {
+	cpu := overcommit(*resource.NewMilliQuantity(1000, resource.DecimalSI), 1.5)
+	assert.Equal(t, int64(1500), cpu.MilliValue())
+	mem := overcommit(resource.MustParse("8Gi"), 0.5)
+	assert.Equal(t, int64(4*1024*1024*1024), mem.Value())
+}
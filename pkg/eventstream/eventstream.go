@@ -0,0 +1,99 @@
+package eventstream
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SchemaVersion is the version of the schema of the events. It is incremented whenever a field is renamed, removed or
+// changes meaning, new fields can be added without changing it
+const SchemaVersion = 1
+
+const (
+	// EventScaleUp is emitted when a node group untaints or adds nodes
+	EventScaleUp = "scale_up"
+	// EventScaleDown is emitted when a node group taints nodes to remove them
+	EventScaleDown = "scale_down"
+	// EventTaint is emitted with the nodes tainted by a scale down
+	EventTaint = "taint"
+	// EventDrain is emitted when the pods of a node start being evicted before it is terminated
+	EventDrain = "drain"
+	// EventDelete is emitted when nodes are terminated in the cloud provider
+	EventDelete = "delete"
+	// EventError is emitted when the scan of a node group fails
+	EventError = "error"
+)
+
+// Event is a single line of the stream
+type Event struct {
+	SchemaVersion int       `json:"schema_version"`
+	Type          string    `json:"type"`
+	Time          time.Time `json:"time"`
+	NodeGroup     string    `json:"nodegroup"`
+	// Count is the number of nodes scaled, tainted or deleted, or the number of pods drained from the node
+	Count  int      `json:"count,omitempty"`
+	Nodes  []string `json:"nodes,omitempty"`
+	Reason string   `json:"reason,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Stream writes an Event as a line of JSON for every scale decision and action, for other tools to consume live
+// It is separate from the logging, so the events are written whatever the level or format of the logs.
+// A nil Stream discards every event
+type Stream struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// New creates a stream writing the events to w
+func New(w io.Writer) *Stream {
+	return &Stream{encoder: json.NewEncoder(w)}
+}
+
+// ScaleUp emits that count nodes were untainted or added to the node group
+func (s *Stream) ScaleUp(nodegroup string, count int) {
+	s.emit(Event{Type: EventScaleUp, NodeGroup: nodegroup, Count: count})
+}
+
+// ScaleDown emits that count nodes of the node group were tainted to remove them
+func (s *Stream) ScaleDown(nodegroup string, count int) {
+	s.emit(Event{Type: EventScaleDown, NodeGroup: nodegroup, Count: count})
+}
+
+// Taint emits the names of the nodes of the node group tainted by a scale down
+func (s *Stream) Taint(nodegroup string, nodes []string) {
+	s.emit(Event{Type: EventTaint, NodeGroup: nodegroup, Count: len(nodes), Nodes: nodes})
+}
+
+// Drain emits that pods pods started being evicted from the node
+func (s *Stream) Drain(nodegroup string, node string, pods int) {
+	s.emit(Event{Type: EventDrain, NodeGroup: nodegroup, Count: pods, Nodes: []string{node}})
+}
+
+// Delete emits the names of the nodes terminated in the cloud provider and why they were
+func (s *Stream) Delete(nodegroup string, nodes []string, reason string) {
+	s.emit(Event{Type: EventDelete, NodeGroup: nodegroup, Count: len(nodes), Nodes: nodes, Reason: reason})
+}
+
+// Error emits the error of the scan of the node group
+func (s *Stream) Error(nodegroup string, err error) {
+	s.emit(Event{Type: EventError, NodeGroup: nodegroup, Error: err.Error()})
+}
+
+// emit writes the event with the schema version and the current time
+func (s *Stream) emit(event Event) {
+	if s == nil {
+		return
+	}
+	event.SchemaVersion = SchemaVersion
+	event.Time = time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.encoder.Encode(event); err != nil {
+		log.WithError(err).Warningf("Failed to write %v event to the event stream", event.Type)
+	}
+}
@@ -0,0 +1,64 @@
+package eventstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeEvents(t *testing.T, data []byte) []map[string]interface{} {
+	var events []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var event map[string]interface{}
+		require.NoError(t, decoder.Decode(&event))
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestStream(t *testing.T) {
+	var buf bytes.Buffer
+	stream := New(&buf)
+
+	stream.ScaleUp("shared", 2)
+	stream.ScaleDown("shared", 1)
+	stream.Taint("shared", []string{"n1"})
+	stream.Drain("shared", "n1", 3)
+	stream.Delete("shared", []string{"n1"}, "tainted node passed hard_delete_grace_period")
+	stream.Error("shared", errors.New("failed to list nodes"))
+
+	// every event is a single line
+	assert.Equal(t, 6, bytes.Count(buf.Bytes(), []byte("\n")))
+	events := decodeEvents(t, buf.Bytes())
+	require.Len(t, events, 6)
+	for i, eventType := range []string{EventScaleUp, EventScaleDown, EventTaint, EventDrain, EventDelete, EventError} {
+		assert.Equal(t, eventType, events[i]["type"])
+		assert.Equal(t, float64(SchemaVersion), events[i]["schema_version"])
+		assert.Equal(t, "shared", events[i]["nodegroup"])
+		assert.NotEmpty(t, events[i]["time"])
+	}
+
+	assert.Equal(t, float64(2), events[0]["count"])
+	assert.Nil(t, events[0]["nodes"])
+	assert.Equal(t, []interface{}{"n1"}, events[2]["nodes"])
+	assert.Equal(t, float64(3), events[3]["count"])
+	assert.Equal(t, []interface{}{"n1"}, events[3]["nodes"])
+	assert.Equal(t, "tainted node passed hard_delete_grace_period", events[4]["reason"])
+	assert.Equal(t, "failed to list nodes", events[5]["error"])
+	assert.Nil(t, events[5]["count"])
+}
+
+func TestStreamNil(t *testing.T) {
+	var stream *Stream
+	stream.ScaleUp("shared", 1)
+	stream.ScaleDown("shared", 1)
+	stream.Taint("shared", nil)
+	stream.Drain("shared", "n1", 1)
+	stream.Delete("shared", nil, "")
+	stream.Error("shared", errors.New("failed"))
+}
@@ -5,9 +5,13 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
+	appsv1lister "k8s.io/client-go/listers/apps/v1"
+	batchv1beta1lister "k8s.io/client-go/listers/batch/v1beta1"
 	v1lister "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 )
@@ -58,6 +62,138 @@ func NewCacheNodeWatcher(client kubernetes.Interface, stop <-chan struct{}) (v1l
 	return nodeLister, nodeController.HasSynced
 }
 
+// NewCacheCronJobWatcher creates a new IndexerInformer for watching CronJobs from cache
+func NewCacheCronJobWatcher(client kubernetes.Interface, stop <-chan struct{}) (batchv1beta1lister.CronJobLister, cache.InformerSynced) {
+	cronJobsListWatch := cache.NewListWatchFromClient(
+		client.BatchV1beta1().RESTClient(),
+		"cronjobs",
+		v1.NamespaceAll,
+		fields.Everything(),
+	)
+	cronJobIndexer, cronJobController := cache.NewIndexerInformer(
+		cronJobsListWatch,
+		&batchv1beta1.CronJob{},
+		1*time.Hour,
+		cache.ResourceEventHandlerFuncs{},
+		cache.Indexers{
+			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+		},
+	)
+	cronJobLister := batchv1beta1lister.NewCronJobLister(cronJobIndexer)
+	go cronJobController.Run(stop)
+	return cronJobLister, cronJobController.HasSynced
+}
+
+// NewCachePersistentVolumeClaimWatcher creates a new IndexerInformer for watching persistent volume claims from cache
+func NewCachePersistentVolumeClaimWatcher(client kubernetes.Interface, stop <-chan struct{}) (v1lister.PersistentVolumeClaimLister, cache.InformerSynced) {
+	claimsListWatch := cache.NewListWatchFromClient(
+		client.CoreV1().RESTClient(),
+		"persistentvolumeclaims",
+		v1.NamespaceAll,
+		fields.Everything(),
+	)
+	claimIndexer, claimController := cache.NewIndexerInformer(
+		claimsListWatch,
+		&v1.PersistentVolumeClaim{},
+		1*time.Hour,
+		cache.ResourceEventHandlerFuncs{},
+		cache.Indexers{
+			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+		},
+	)
+	claimLister := v1lister.NewPersistentVolumeClaimLister(claimIndexer)
+	go claimController.Run(stop)
+	return claimLister, claimController.HasSynced
+}
+
+// NewCachePersistentVolumeWatcher creates a new IndexerInformer for watching persistent volumes from cache
+func NewCachePersistentVolumeWatcher(client kubernetes.Interface, stop <-chan struct{}) (v1lister.PersistentVolumeLister, cache.InformerSynced) {
+	volumesListWatch := cache.NewListWatchFromClient(
+		client.CoreV1().RESTClient(),
+		"persistentvolumes",
+		v1.NamespaceAll,
+		fields.Everything(),
+	)
+	volumeIndexer, volumeController := cache.NewIndexerInformer(
+		volumesListWatch,
+		&v1.PersistentVolume{},
+		1*time.Hour,
+		cache.ResourceEventHandlerFuncs{},
+		cache.Indexers{
+			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+		},
+	)
+	volumeLister := v1lister.NewPersistentVolumeLister(volumeIndexer)
+	go volumeController.Run(stop)
+	return volumeLister, volumeController.HasSynced
+}
+
+// NewCacheReplicaSetWatcher creates a new IndexerInformer for watching replicasets from cache
+func NewCacheReplicaSetWatcher(client kubernetes.Interface, stop <-chan struct{}) (appsv1lister.ReplicaSetLister, cache.InformerSynced) {
+	replicaSetsListWatch := cache.NewListWatchFromClient(
+		client.AppsV1().RESTClient(),
+		"replicasets",
+		v1.NamespaceAll,
+		fields.Everything(),
+	)
+	replicaSetIndexer, replicaSetController := cache.NewIndexerInformer(
+		replicaSetsListWatch,
+		&appsv1.ReplicaSet{},
+		1*time.Hour,
+		cache.ResourceEventHandlerFuncs{},
+		cache.Indexers{
+			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+		},
+	)
+	replicaSetLister := appsv1lister.NewReplicaSetLister(replicaSetIndexer)
+	go replicaSetController.Run(stop)
+	return replicaSetLister, replicaSetController.HasSynced
+}
+
+// NewCacheDeploymentWatcher creates a new IndexerInformer for watching deployments from cache
+func NewCacheDeploymentWatcher(client kubernetes.Interface, stop <-chan struct{}) (appsv1lister.DeploymentLister, cache.InformerSynced) {
+	deploymentsListWatch := cache.NewListWatchFromClient(
+		client.AppsV1().RESTClient(),
+		"deployments",
+		v1.NamespaceAll,
+		fields.Everything(),
+	)
+	deploymentIndexer, deploymentController := cache.NewIndexerInformer(
+		deploymentsListWatch,
+		&appsv1.Deployment{},
+		1*time.Hour,
+		cache.ResourceEventHandlerFuncs{},
+		cache.Indexers{
+			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+		},
+	)
+	deploymentLister := appsv1lister.NewDeploymentLister(deploymentIndexer)
+	go deploymentController.Run(stop)
+	return deploymentLister, deploymentController.HasSynced
+}
+
+// NewCacheStatefulSetWatcher creates a new IndexerInformer for watching statefulsets from cache
+func NewCacheStatefulSetWatcher(client kubernetes.Interface, stop <-chan struct{}) (appsv1lister.StatefulSetLister, cache.InformerSynced) {
+	statefulSetsListWatch := cache.NewListWatchFromClient(
+		client.AppsV1().RESTClient(),
+		"statefulsets",
+		v1.NamespaceAll,
+		fields.Everything(),
+	)
+	statefulSetIndexer, statefulSetController := cache.NewIndexerInformer(
+		statefulSetsListWatch,
+		&appsv1.StatefulSet{},
+		1*time.Hour,
+		cache.ResourceEventHandlerFuncs{},
+		cache.Indexers{
+			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+		},
+	)
+	statefulSetLister := appsv1lister.NewStatefulSetLister(statefulSetIndexer)
+	go statefulSetController.Run(stop)
+	return statefulSetLister, statefulSetController.HasSynced
+}
+
 // WaitForSync wait for the cache sync for all the registered listers
 // it will try <tries> times and return the result
 func WaitForSync(tries int, stopChan <-chan struct{}, informers ...cache.InformerSynced) bool {
@@ -2,6 +2,7 @@ package k8s
 
 import (
 	"github.com/pkg/errors"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -38,3 +39,24 @@ func NewInClusterClient() (*kubernetes.Clientset, error) {
 	}
 	return clientset, nil
 }
+
+// NewDynamicClient returns a new dynamic client for custom resources using a kubeconfig file if set
+// Otherwise for running inside the cluster
+func NewDynamicClient(kubeconfig string) (dynamic.Interface, error) {
+	var config *rest.Config
+	var err error
+	if len(kubeconfig) > 0 {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, errors.Errorf("Failed to create dynamic client config: %v", err)
+	}
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Errorf("Failed to create dynamic client: %v", err)
+	}
+	return client, nil
+}
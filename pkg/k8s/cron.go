@@ -0,0 +1,43 @@
+package k8s
+
+import (
+	"time"
+
+	"github.com/robfig/cron"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	batchv1beta1lister "k8s.io/client-go/listers/batch/v1beta1"
+)
+
+// ParseCronSchedule parses the schedule of a CronJob with the parser of the CronJob controller, so a schedule is
+// accepted and fires at the same times as it does for the controller: five fields of minute, hour, day of month, month
+// and day of week, or a descriptor like @hourly or @every 1h
+func ParseCronSchedule(schedule string) (cron.Schedule, error) {
+	return cron.ParseStandard(schedule)
+}
+
+// CronJobNextSchedule returns the first time after t the CronJob is scheduled to create a job, looked up through the
+// lister. The schedule is in UTC, the time zone the CronJob controller normally runs in. Returns the zero time if the CronJob
+// doesn't exist or is suspended, and an error if it can't be looked up or its schedule can't be parsed
+func CronJobNextSchedule(lister batchv1beta1lister.CronJobLister, namespace string, name string, t time.Time) (time.Time, error) {
+	cronJob, err := lister.CronJobs(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if CronJobSuspended(cronJob) {
+		return time.Time{}, nil
+	}
+	schedule, err := ParseCronSchedule(cronJob.Spec.Schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return schedule.Next(t.UTC()), nil
+}
+
+// CronJobSuspended returns whether the CronJob is suspended, in which case it doesn't create any jobs
+func CronJobSuspended(cronJob *batchv1beta1.CronJob) bool {
+	return cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend
+}
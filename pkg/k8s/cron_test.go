@@ -0,0 +1,119 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The schedules are parsed by the parser of the CronJob controller, these cases pin the behaviour pre-warming relies
+// on so a change of the parser's revision that changes it is noticed
+
+func TestParseCronScheduleInvalid(t *testing.T) {
+	for _, schedule := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		// the CronJob controller only accepts 0 to 6 for the day of the week
+		"* * * * 7",
+		"5-1 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"@fortnightly",
+	} {
+		t.Run(schedule, func(t *testing.T) {
+			_, err := ParseCronSchedule(schedule)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// a wednesday
+	from := time.Date(2019, time.January, 2, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		schedule string
+		want     time.Time
+	}{
+		{"* * * * *", time.Date(2019, time.January, 2, 10, 31, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2019, time.January, 2, 11, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2019, time.January, 2, 11, 0, 0, 0, time.UTC)},
+		{"@every 1h", time.Date(2019, time.January, 2, 11, 30, 15, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2019, time.January, 3, 10, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2019, time.January, 2, 10, 45, 0, 0, time.UTC)},
+		// N/step runs from N to the end of the range
+		{"5/20 * * * *", time.Date(2019, time.January, 2, 10, 45, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2019, time.January, 2, 13, 0, 0, 0, time.UTC)},
+		{"0 8,12 * * *", time.Date(2019, time.January, 2, 12, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2019, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * MON-FRI", time.Date(2019, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2019, time.January, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2019, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		// ? is the same as * in any field
+		{"0 0 1 jun ?", time.Date(2019, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		{"? * * * *", time.Date(2019, time.January, 2, 10, 31, 0, 0, time.UTC)},
+		// either of the day of month and the day of week match when both are set
+		{"0 0 15 * sat", time.Date(2019, time.January, 5, 0, 0, 0, 0, time.UTC)},
+		// both have to match when either is *, including * with a step
+		{"0 0 */10 * sat", time.Date(2019, time.May, 11, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// never fires
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			schedule, err := ParseCronSchedule(tt.schedule)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, schedule.Next(from))
+		})
+	}
+}
+
+func TestCronJobNextSchedule(t *testing.T) {
+	suspended := true
+	cronJob := func(name string, schedule string, suspend *bool) *batchv1beta1.CronJob {
+		return &batchv1beta1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "batch"},
+			Spec:       batchv1beta1.CronJobSpec{Schedule: schedule, Suspend: suspend},
+		}
+	}
+	lister := test.NewTestCronJobLister(
+		cronJob("hourly", "0 * * * *", nil),
+		cronJob("suspended", "0 * * * *", &suspended),
+		cronJob("invalid", "every hour", nil),
+	)
+	from := time.Date(2019, time.January, 2, 10, 30, 0, 0, time.UTC)
+
+	next, err := CronJobNextSchedule(lister, "batch", "hourly", from)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2019, time.January, 2, 11, 0, 0, 0, time.UTC), next)
+
+	// the schedule is in UTC whatever the location of the time
+	next, err = CronJobNextSchedule(lister, "batch", "hourly", from.In(time.FixedZone("UTC+5:30", 5*60*60+30*60)))
+	require.NoError(t, err)
+	assert.True(t, time.Date(2019, time.January, 2, 11, 0, 0, 0, time.UTC).Equal(next))
+
+	next, err = CronJobNextSchedule(lister, "batch", "suspended", from)
+	require.NoError(t, err)
+	assert.True(t, next.IsZero())
+
+	next, err = CronJobNextSchedule(lister, "batch", "missing", from)
+	require.NoError(t, err)
+	assert.True(t, next.IsZero())
+
+	next, err = CronJobNextSchedule(lister, "other", "hourly", from)
+	require.NoError(t, err)
+	assert.True(t, next.IsZero())
+
+	_, err = CronJobNextSchedule(lister, "batch", "invalid", from)
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package k8s
+
+import (
+	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/pkg/scheduler/cache"
+)
+
+// NodePodsToDrain returns the pods that need to be evicted from the node before it is terminated
+// daemonset, static and terminated pods are excluded. Returns false if the node is not in the nodeinfo map
+func NodePodsToDrain(node *v1.Node, nodeInfoMap map[string]*cache.NodeInfo) ([]*v1.Pod, bool) {
+	nodeInfo, ok := nodeInfoMap[node.Name]
+	if !ok {
+		return nil, false
+	}
+
+	var pods []*v1.Pod
+	for _, pod := range nodeInfo.Pods() {
+		if !PodIsDaemonSet(pod) && !PodIsStatic(pod) && !PodIsTerminated(pod) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, true
+}
+
+// EvictPod evicts the pod through the eviction API, honouring the pod's termination grace period
+func EvictPod(pod *v1.Pod, client kubernetes.Interface) error {
+	eviction := &policy.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+		DeleteOptions: &metav1.DeleteOptions{
+			GracePeriodSeconds: pod.Spec.TerminationGracePeriodSeconds,
+		},
+	}
+	return client.CoreV1().Pods(pod.Namespace).Evict(eviction)
+}
+
+// PodsTerminationGracePeriodSeconds returns the longest termination grace period of the pods
+// pods without a grace period use the Kubernetes default
+func PodsTerminationGracePeriodSeconds(pods []*v1.Pod) int64 {
+	var longest int64
+	for _, pod := range pods {
+		gracePeriod := int64(v1.DefaultTerminationGracePeriodSeconds)
+		if pod.Spec.TerminationGracePeriodSeconds != nil {
+			gracePeriod = *pod.Spec.TerminationGracePeriodSeconds
+		}
+		if gracePeriod > longest {
+			longest = gracePeriod
+		}
+	}
+	return longest
+}
@@ -0,0 +1,59 @@
+package k8s
+
+import (
+	"k8s.io/api/core/v1"
+	v1lister "k8s.io/client-go/listers/core/v1"
+)
+
+// ForceScaleDownAnnotation is the node annotation that lets a node hosting pods with local storage, or replicas
+// protected by the spread of their workload, be chosen for scale down when the node group protects them. The value
+// must be "true"
+const ForceScaleDownAnnotation = "escalator.atlassian.com/force-scale-down"
+
+// NodeIsForcedScaleDown returns whether the node has the ForceScaleDownAnnotation set to "true"
+func NodeIsForcedScaleDown(node *v1.Node) bool {
+	return node.ObjectMeta.Annotations[ForceScaleDownAnnotation] == "true"
+}
+
+// PodLocalStorageVolumes returns the names of the pod's volumes whose data is lost when the node is terminated
+// hostPath volumes, emptyDir volumes with a medium, and persistent volume claims bound to local persistent volumes,
+// which are looked up through the listers. Returns an error if a claim or its volume can't be looked up
+func PodLocalStorageVolumes(claims v1lister.PersistentVolumeClaimLister, persistentVolumes v1lister.PersistentVolumeLister, pod *v1.Pod) ([]string, error) {
+	var volumes []string
+	for _, volume := range pod.Spec.Volumes {
+		switch {
+		case volume.HostPath != nil:
+			volumes = append(volumes, volume.Name)
+		case volume.EmptyDir != nil:
+			if volume.EmptyDir.Medium != v1.StorageMediumDefault {
+				volumes = append(volumes, volume.Name)
+			}
+		case volume.PersistentVolumeClaim != nil:
+			local, err := claimIsLocal(claims, persistentVolumes, pod.Namespace, volume.PersistentVolumeClaim.ClaimName)
+			if err != nil {
+				return volumes, err
+			}
+			if local {
+				volumes = append(volumes, volume.Name)
+			}
+		}
+	}
+	return volumes, nil
+}
+
+// claimIsLocal returns whether the persistent volume claim is bound to a local persistent volume
+// claims that aren't bound yet don't hold any data
+func claimIsLocal(claims v1lister.PersistentVolumeClaimLister, persistentVolumes v1lister.PersistentVolumeLister, namespace string, name string) (bool, error) {
+	claim, err := claims.PersistentVolumeClaims(namespace).Get(name)
+	if err != nil {
+		return false, err
+	}
+	if len(claim.Spec.VolumeName) == 0 {
+		return false, nil
+	}
+	volume, err := persistentVolumes.Get(claim.Spec.VolumeName)
+	if err != nil {
+		return false, err
+	}
+	return volume.Spec.Local != nil, nil
+}
@@ -0,0 +1,96 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodLocalStorageVolumes(t *testing.T) {
+	claims := test.NewTestPersistentVolumeClaimLister(
+		&v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "local-claim", Namespace: "default"},
+			Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "local-volume"},
+		},
+		&v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "ebs-claim", Namespace: "default"},
+			Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "ebs-volume"},
+		},
+		&v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "unbound-claim", Namespace: "default"},
+		},
+	)
+	persistentVolumes := test.NewTestPersistentVolumeLister(
+		&v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "local-volume"},
+			Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{
+				Local: &v1.LocalVolumeSource{Path: "/mnt/disks/ssd1"},
+			}},
+		},
+		&v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "ebs-volume"},
+			Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{
+				AWSElasticBlockStore: &v1.AWSElasticBlockStoreVolumeSource{VolumeID: "vol-1"},
+			}},
+		},
+	)
+	claim := func(name string, claimName string) v1.Volume {
+		return v1.Volume{Name: name, VolumeSource: v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+		}}
+	}
+
+	tests := []struct {
+		name    string
+		volumes []v1.Volume
+		want    []string
+		wantErr bool
+	}{
+		{"no volumes", nil, nil, false},
+		{
+			"host path and empty dir",
+			[]v1.Volume{
+				{Name: "logs", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/log"}}},
+				{Name: "scratch", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{Medium: v1.StorageMediumMemory}}},
+				// an emptyDir without a medium is scratch space on the node's disk
+				{Name: "tmp", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+				{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{}}},
+			},
+			[]string{"logs", "scratch"},
+			false,
+		},
+		{
+			"persistent volume claims",
+			[]v1.Volume{claim("data", "local-claim"), claim("ebs", "ebs-claim"), claim("unbound", "unbound-claim")},
+			[]string{"data"},
+			false,
+		},
+		{"missing claim", []v1.Volume{claim("missing", "missing-claim")}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := test.BuildTestPod(test.PodOpts{Name: "pod", Namespace: "default"})
+			pod.Spec.Volumes = tt.volumes
+			got, err := PodLocalStorageVolumes(claims, persistentVolumes, pod)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNodeIsForcedScaleDown(t *testing.T) {
+	node := test.BuildTestNode(test.NodeOpts{Name: "node"})
+	assert.False(t, NodeIsForcedScaleDown(node))
+	node.Annotations = map[string]string{ForceScaleDownAnnotation: "false"}
+	assert.False(t, NodeIsForcedScaleDown(node))
+	node.Annotations = map[string]string{ForceScaleDownAnnotation: "true"}
+	assert.True(t, NodeIsForcedScaleDown(node))
+}
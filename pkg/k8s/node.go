@@ -1,8 +1,14 @@
 package k8s
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -22,3 +28,126 @@ func DeleteNodes(nodes []*v1.Node, client kubernetes.Interface) error {
 	}
 	return nil
 }
+
+// NodeIsReady returns if the node has the Ready condition set to true
+func NodeIsReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// NodeHasMemoryPressure returns whether the node has the MemoryPressure condition, i.e. the kubelet is evicting pods
+// to reclaim memory
+func NodeHasMemoryPressure(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeMemoryPressure {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// CordonNode marks the node as unschedulable
+// returns the most recent update of the node that is successful
+func CordonNode(node *v1.Node, client kubernetes.Interface) (*v1.Node, error) {
+	// fetch the latest version of the node to avoid conflict
+	updatedNode, err := client.CoreV1().Nodes().Get(node.Name, v12.GetOptions{})
+	if err != nil || updatedNode == nil {
+		return node, fmt.Errorf("failed to get node %v: %v", node.Name, err)
+	}
+
+	if updatedNode.Spec.Unschedulable {
+		log.Debugf("node %v is already cordoned", updatedNode.Name)
+		return updatedNode, nil
+	}
+
+	updatedNode.Spec.Unschedulable = true
+	cordonedNode, err := client.CoreV1().Nodes().Update(updatedNode)
+	if err != nil || cordonedNode == nil {
+		return updatedNode, fmt.Errorf("failed to update node %v after cordoning: %v", updatedNode.Name, err)
+	}
+
+	log.Infof("Successfully cordoned node %v", cordonedNode.Name)
+	return cordonedNode, nil
+}
+
+// AnnotateNode sets the annotation of the node to the value
+// returns the most recent update of the node that is successful
+func AnnotateNode(node *v1.Node, key string, value string, client kubernetes.Interface) (*v1.Node, error) {
+	// fetch the latest version of the node to avoid conflict
+	updatedNode, err := client.CoreV1().Nodes().Get(node.Name, v12.GetOptions{})
+	if err != nil || updatedNode == nil {
+		return node, fmt.Errorf("failed to get node %v: %v", node.Name, err)
+	}
+
+	if updatedNode.Annotations == nil {
+		updatedNode.Annotations = make(map[string]string)
+	}
+	updatedNode.Annotations[key] = value
+	annotatedNode, err := client.CoreV1().Nodes().Update(updatedNode)
+	if err != nil || annotatedNode == nil {
+		return updatedNode, fmt.Errorf("failed to update node %v after annotating: %v", updatedNode.Name, err)
+	}
+	return annotatedNode, nil
+}
+
+// ShutdownStartedAnnotation is the node annotation recording when escalator started waiting for the node to shut down
+// gracefully before terminating it, as a unix timestamp
+const ShutdownStartedAnnotation = "escalator.atlassian.com/shutdown-started"
+
+// GetShutdownStartedTime returns the time escalator started waiting for the node to shut down
+// result will be nil if the node isn't shutting down
+func GetShutdownStartedTime(node *v1.Node) (*time.Time, error) {
+	value, ok := node.ObjectMeta.Annotations[ShutdownStartedAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	result := time.Unix(timestamp, 0)
+	return &result, nil
+}
+
+// ListNodePods lists every pod on the node from the api server, including the terminated pods
+func ListNodePods(node *v1.Node, client kubernetes.Interface) ([]*v1.Pod, error) {
+	podList, err := client.CoreV1().Pods(v1.NamespaceAll).List(v12.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of node %v: %v", node.Name, err)
+	}
+	pods := make([]*v1.Pod, 0, len(podList.Items))
+	for i := range podList.Items {
+		pods = append(pods, &podList.Items[i])
+	}
+	return pods, nil
+}
+
+// UncordonNode marks the node as schedulable
+// returns the most recent update of the node that is successful
+func UncordonNode(node *v1.Node, client kubernetes.Interface) (*v1.Node, error) {
+	// fetch the latest version of the node to avoid conflict
+	updatedNode, err := client.CoreV1().Nodes().Get(node.Name, v12.GetOptions{})
+	if err != nil || updatedNode == nil {
+		return node, fmt.Errorf("failed to get node %v: %v", node.Name, err)
+	}
+
+	if !updatedNode.Spec.Unschedulable {
+		log.Debugf("node %v is already uncordoned", updatedNode.Name)
+		return updatedNode, nil
+	}
+
+	updatedNode.Spec.Unschedulable = false
+	uncordonedNode, err := client.CoreV1().Nodes().Update(updatedNode)
+	if err != nil || uncordonedNode == nil {
+		return updatedNode, fmt.Errorf("failed to update node %v after uncordoning: %v", updatedNode.Name, err)
+	}
+
+	log.Infof("Successfully uncordoned node %v", uncordonedNode.Name)
+	return uncordonedNode, nil
+}
@@ -39,13 +39,13 @@ func CreateNodeNameToInfoMap(pods []*v1.Pod, nodes []*v1.Node) map[string]*cache
 	return nodeNameToNodeInfo
 }
 
-// NodeEmpty returns if the node is empty of pods, except for daemonsets
+// NodeEmpty returns if the node is empty of pods, except for daemonsets and terminated pods
 func NodeEmpty(node *v1.Node, nodeInfoMap map[string]*cache.NodeInfo) bool {
 	nodePodsRemaining, ok := NodePodsRemaining(node, nodeInfoMap)
 	return ok && nodePodsRemaining == 0
 }
 
-// NodeEmpty returns the number of pods on the node, except for daemonset pods
+// NodePodsRemaining returns the number of pods on the node, except for daemonset and terminated pods
 func NodePodsRemaining(node *v1.Node, nodeInfoMap map[string]*cache.NodeInfo) (int, bool) {
 	nodeInfo, ok := nodeInfoMap[node.Name]
 	if !ok {
@@ -53,14 +53,31 @@ func NodePodsRemaining(node *v1.Node, nodeInfoMap map[string]*cache.NodeInfo) (i
 		return 0, false
 	}
 
-	// check all the pods and make sure they're daemonsets
+	// check all the pods and make sure they're daemonsets or have terminated
 	// otherwise there are sacred pods still on the node
 	pods := 0
 	for _, pod := range nodeInfo.Pods() {
-		if !PodIsDaemonSet(pod) {
+		if !PodIsDaemonSet(pod) && !PodIsTerminated(pod) {
 			pods++
 		}
 	}
 
 	return pods, true
 }
+
+// NodeOnlyCompletedJobs returns if the only pods that ran on the node, except for daemonsets, are jobs that have
+// terminated. The pods must include the terminated pods, which the pod watcher doesn't watch. Nodes with no pods other
+// than daemonsets didn't run any jobs and are not counted
+func NodeOnlyCompletedJobs(node *v1.Node, pods []*v1.Pod) bool {
+	jobs := 0
+	for _, pod := range pods {
+		if pod.Spec.NodeName != node.Name || PodIsDaemonSet(pod) {
+			continue
+		}
+		if !PodIsJob(pod) || !PodIsTerminated(pod) {
+			return false
+		}
+		jobs++
+	}
+	return jobs > 0
+}
@@ -155,6 +155,22 @@ func TestNodeEmpty(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"node with just completed pods",
+			args{
+				[]*v1.Node{
+					test.BuildTestNode(test.NodeOpts{Name: "node-1"}),
+				},
+				[]*v1.Pod{
+					test.BuildTestPod(test.PodOpts{NodeName: "node-1", Phase: v1.PodSucceeded}),
+					test.BuildTestPod(test.PodOpts{NodeName: "node-1", Phase: v1.PodSucceeded}),
+					test.BuildTestPod(test.PodOpts{NodeName: "node-1", Phase: v1.PodFailed}),
+				},
+				"node-1",
+				false,
+			},
+			true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -291,3 +307,32 @@ func TestNodePodsRemaining(t *testing.T) {
 	}
 
 }
+
+func TestNodeOnlyCompletedJobs(t *testing.T) {
+	node := test.BuildTestNode(test.NodeOpts{Name: "node-1"})
+	completedJob := test.BuildTestPod(test.PodOpts{Name: "completed", NodeName: "node-1", Owner: "Job", Phase: v1.PodSucceeded})
+	failedJob := test.BuildTestPod(test.PodOpts{Name: "failed", NodeName: "node-1", Owner: "Job", Phase: v1.PodFailed})
+	runningJob := test.BuildTestPod(test.PodOpts{Name: "running", NodeName: "node-1", Owner: "Job", Phase: v1.PodRunning})
+	completedPod := test.BuildTestPod(test.PodOpts{Name: "completed-pod", NodeName: "node-1", Phase: v1.PodSucceeded})
+	daemonset := test.BuildTestPod(test.PodOpts{Name: "daemonset", NodeName: "node-1", Owner: "DaemonSet", Phase: v1.PodRunning})
+	otherNode := test.BuildTestPod(test.PodOpts{Name: "other", NodeName: "node-2", Phase: v1.PodRunning})
+
+	tests := []struct {
+		name string
+		pods []*v1.Pod
+		want bool
+	}{
+		{"no pods", nil, false},
+		{"only daemonsets", []*v1.Pod{daemonset}, false},
+		{"completed jobs", []*v1.Pod{completedJob, failedJob}, true},
+		{"completed jobs and daemonsets", []*v1.Pod{completedJob, daemonset}, true},
+		{"completed jobs and pods of other nodes", []*v1.Pod{completedJob, otherNode}, true},
+		{"running job", []*v1.Pod{completedJob, runningJob}, false},
+		{"completed pod not owned by a job", []*v1.Pod{completedJob, completedPod}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NodeOnlyCompletedJobs(node, tt.pods))
+		})
+	}
+}
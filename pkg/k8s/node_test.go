@@ -0,0 +1,52 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+)
+
+func TestNodeIsReady(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []v1.NodeCondition
+		want       bool
+	}{
+		{"no conditions", nil, false},
+		{"ready", []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}, true},
+		{"not ready", []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}, false},
+		{"unknown", []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionUnknown}}, false},
+		{"other conditions only", []v1.NodeCondition{{Type: v1.NodeDiskPressure, Status: v1.ConditionTrue}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := test.BuildTestNode(test.NodeOpts{Name: "node-1"})
+			node.Status.Conditions = tt.conditions
+			assert.Equal(t, tt.want, NodeIsReady(node))
+		})
+	}
+}
+
+func TestNodeHasMemoryPressure(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []v1.NodeCondition
+		want       bool
+	}{
+		{"no conditions", nil, false},
+		{"memory pressure", []v1.NodeCondition{{Type: v1.NodeMemoryPressure, Status: v1.ConditionTrue}}, true},
+		{"no memory pressure", []v1.NodeCondition{{Type: v1.NodeMemoryPressure, Status: v1.ConditionFalse}}, false},
+		{"other conditions only", []v1.NodeCondition{{Type: v1.NodeDiskPressure, Status: v1.ConditionTrue}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := test.BuildTestNode(test.NodeOpts{Name: "node-1"})
+			node.Status.Conditions = tt.conditions
+			assert.Equal(t, tt.want, NodeHasMemoryPressure(node))
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package k8s
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ZoneLabel is the well known node label of the zone of the node
+const ZoneLabel = "topology.kubernetes.io/zone"
+
+// ZoneLabelBeta is the deprecated node label of the zone of the node, set by older versions of Kubernetes
+const ZoneLabelBeta = "failure-domain.beta.kubernetes.io/zone"
+
+// PodReplicaWorkload returns the ReplicaSet or StatefulSet controlling the pod as kind/namespace/name, and whether it
+// has one. The pods of a Deployment are replicas of its ReplicaSets
+func PodReplicaWorkload(pod *v1.Pod) (string, bool) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || (owner.Kind != "ReplicaSet" && owner.Kind != "StatefulSet") {
+		return "", false
+	}
+	return fmt.Sprintf("%v/%v/%v", owner.Kind, pod.Namespace, owner.Name), true
+}
+
+// NodeZone returns the zone of the node from its zone label, or empty if it doesn't have one
+func NodeZone(node *v1.Node) string {
+	if zone, ok := node.Labels[ZoneLabel]; ok {
+		return zone
+	}
+	return node.Labels[ZoneLabelBeta]
+}
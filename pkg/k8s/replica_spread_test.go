@@ -0,0 +1,45 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+)
+
+func TestPodReplicaWorkload(t *testing.T) {
+	tests := []struct {
+		name   string
+		owners []string
+		want   string
+		wantOk bool
+	}{
+		{"replicaset", []string{"ReplicaSet", "web-1234"}, "ReplicaSet/default/web-1234", true},
+		{"statefulset", []string{"StatefulSet", "db"}, "StatefulSet/default/db", true},
+		{"job", []string{"Job", "batch"}, "", false},
+		{"no controller", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := test.BuildTestPod(test.PodOpts{Name: "pod", Namespace: "default"})
+			if len(tt.owners) > 0 {
+				pod.OwnerReferences = controlledBy(tt.owners[0], tt.owners[1])
+			}
+			got, ok := PodReplicaWorkload(pod)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantOk, ok)
+		})
+	}
+}
+
+func TestNodeZone(t *testing.T) {
+	node := func(labels map[string]string) *v1.Node {
+		node := test.BuildTestNode(test.NodeOpts{Name: "node"})
+		node.Labels = labels
+		return node
+	}
+	assert.Equal(t, "zone-a", NodeZone(node(map[string]string{ZoneLabel: "zone-a", ZoneLabelBeta: "zone-b"})))
+	assert.Equal(t, "zone-b", NodeZone(node(map[string]string{ZoneLabelBeta: "zone-b"})))
+	assert.Equal(t, "", NodeZone(node(nil)))
+}
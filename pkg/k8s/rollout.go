@@ -0,0 +1,95 @@
+package k8s
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1lister "k8s.io/client-go/listers/apps/v1"
+)
+
+// PodWorkloadRollingOut returns the Deployment or StatefulSet controlling the pod as kind/namespace/name, and whether
+// it is part way through a rollout. The workload is looked up through the listers, through the ReplicaSet for pods of
+// a Deployment. Pods without a controlling Deployment or StatefulSet are never rolling out
+// Returns an error if the workload can't be looked up. A workload that no longer exists isn't rolling out
+func PodWorkloadRollingOut(replicaSets appsv1lister.ReplicaSetLister, deployments appsv1lister.DeploymentLister, statefulSets appsv1lister.StatefulSetLister, pod *v1.Pod) (string, bool, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "", false, nil
+	}
+
+	switch owner.Kind {
+	case "ReplicaSet":
+		replicaSet, err := replicaSets.ReplicaSets(pod.Namespace).Get(owner.Name)
+		if apierrors.IsNotFound(err) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		owner = metav1.GetControllerOf(replicaSet)
+		if owner == nil || owner.Kind != "Deployment" {
+			return "", false, nil
+		}
+		workload := fmt.Sprintf("Deployment/%v/%v", pod.Namespace, owner.Name)
+		deployment, err := deployments.Deployments(pod.Namespace).Get(owner.Name)
+		if apierrors.IsNotFound(err) {
+			return workload, false, nil
+		}
+		if err != nil {
+			return workload, false, err
+		}
+		return workload, DeploymentRollingOut(deployment), nil
+	case "StatefulSet":
+		workload := fmt.Sprintf("StatefulSet/%v/%v", pod.Namespace, owner.Name)
+		statefulSet, err := statefulSets.StatefulSets(pod.Namespace).Get(owner.Name)
+		if apierrors.IsNotFound(err) {
+			return workload, false, nil
+		}
+		if err != nil {
+			return workload, false, err
+		}
+		return workload, StatefulSetRollingOut(statefulSet), nil
+	}
+	return "", false, nil
+}
+
+// DeploymentRollingOut returns whether the deployment is part way through a rollout, the same way as
+// kubectl rollout status: its latest spec hasn't been observed, or not every replica is updated and available yet
+// Paused deployments aren't rolling out, as they won't make any progress until resumed
+func DeploymentRollingOut(deployment *appsv1.Deployment) bool {
+	if deployment.Spec.Paused {
+		return false
+	}
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return true
+	}
+	if deployment.Spec.Replicas != nil && deployment.Status.UpdatedReplicas < *deployment.Spec.Replicas {
+		return true
+	}
+	return deployment.Status.Replicas > deployment.Status.UpdatedReplicas ||
+		deployment.Status.AvailableReplicas < deployment.Status.UpdatedReplicas
+}
+
+// StatefulSetRollingOut returns whether the statefulset is part way through a rolling update: its latest spec hasn't
+// been observed, or fewer replicas than expected by the partition are updated. Statefulsets with the OnDelete update
+// strategy are never rolling out, as their pods are only updated once something else deletes them
+func StatefulSetRollingOut(statefulSet *appsv1.StatefulSet) bool {
+	if statefulSet.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return false
+	}
+	if statefulSet.Generation > statefulSet.Status.ObservedGeneration {
+		return true
+	}
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	var partition int32
+	if rollingUpdate := statefulSet.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.Partition != nil {
+		partition = *rollingUpdate.Partition
+	}
+	return statefulSet.Status.UpdatedReplicas < replicas-partition
+}
@@ -0,0 +1,205 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+// controlledBy returns an owner reference of the controller of an object
+func controlledBy(kind string, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+}
+
+func TestDeploymentRollingOut(t *testing.T) {
+	tests := []struct {
+		name       string
+		deployment appsv1.Deployment
+		want       bool
+	}{
+		{
+			"rolled out",
+			appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(3)},
+				Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3},
+			},
+			false,
+		},
+		{
+			"spec not observed",
+			appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(3)},
+				Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3},
+			},
+			true,
+		},
+		{
+			"replicas not updated",
+			appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(3)},
+				Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 2, AvailableReplicas: 2},
+			},
+			true,
+		},
+		{
+			"old replicas terminating",
+			appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(3)},
+				Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 3, AvailableReplicas: 3},
+			},
+			true,
+		},
+		{
+			"updated replicas not available",
+			appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(3)},
+				Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 1},
+			},
+			true,
+		},
+		{
+			"paused",
+			appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(3), Paused: true},
+				Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 1, AvailableReplicas: 3},
+			},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, DeploymentRollingOut(&tt.deployment))
+		})
+	}
+}
+
+func TestStatefulSetRollingOut(t *testing.T) {
+	rollingUpdate := func(partition int32) appsv1.StatefulSetUpdateStrategy {
+		return appsv1.StatefulSetUpdateStrategy{
+			Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: int32Ptr(partition)},
+		}
+	}
+	tests := []struct {
+		name        string
+		statefulSet appsv1.StatefulSet
+		want        bool
+	}{
+		{
+			"rolled out",
+			appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(3), UpdateStrategy: rollingUpdate(0)},
+				Status:     appsv1.StatefulSetStatus{ObservedGeneration: 2, UpdatedReplicas: 3},
+			},
+			false,
+		},
+		{
+			"replicas not updated",
+			appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(3), UpdateStrategy: rollingUpdate(0)},
+				Status:     appsv1.StatefulSetStatus{ObservedGeneration: 2, UpdatedReplicas: 1},
+			},
+			true,
+		},
+		{
+			"partition rolled out",
+			appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(3), UpdateStrategy: rollingUpdate(2)},
+				Status:     appsv1.StatefulSetStatus{ObservedGeneration: 2, UpdatedReplicas: 1},
+			},
+			false,
+		},
+		{
+			"spec not observed",
+			appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(3), UpdateStrategy: rollingUpdate(0)},
+				Status:     appsv1.StatefulSetStatus{ObservedGeneration: 2, UpdatedReplicas: 3},
+			},
+			true,
+		},
+		{
+			"on delete",
+			appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas:       int32Ptr(3),
+					UpdateStrategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType},
+				},
+				Status: appsv1.StatefulSetStatus{ObservedGeneration: 2},
+			},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, StatefulSetRollingOut(&tt.statefulSet))
+		})
+	}
+}
+
+func TestPodWorkloadRollingOut(t *testing.T) {
+	replicaSets := test.NewTestReplicaSetLister(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-1234",
+			Namespace:       "default",
+			OwnerReferences: controlledBy("Deployment", "web"),
+		}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "bare", Namespace: "default"}},
+	)
+	deployments := test.NewTestDeploymentLister(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(2)},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1},
+	})
+	statefulSets := test.NewTestStatefulSetLister(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", Generation: 1},
+		Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(1)},
+		Status:     appsv1.StatefulSetStatus{ObservedGeneration: 1, UpdatedReplicas: 1},
+	})
+	pod := func(owners []metav1.OwnerReference) *v1.Pod {
+		pod := test.BuildTestPod(test.PodOpts{Name: "pod", Namespace: "default"})
+		pod.OwnerReferences = owners
+		return pod
+	}
+
+	tests := []struct {
+		name       string
+		pod        *v1.Pod
+		workload   string
+		rollingOut bool
+	}{
+		{"no owner", pod(nil), "", false},
+		{"deployment rolling out", pod(controlledBy("ReplicaSet", "web-1234")), "Deployment/default/web", true},
+		{"statefulset rolled out", pod(controlledBy("StatefulSet", "db")), "StatefulSet/default/db", false},
+		{"replicaset without a deployment", pod(controlledBy("ReplicaSet", "bare")), "", false},
+		{"deleted replicaset", pod(controlledBy("ReplicaSet", "deleted")), "", false},
+		{"job", pod(controlledBy("Job", "backup")), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workload, rollingOut, err := PodWorkloadRollingOut(replicaSets, deployments, statefulSets, tt.pod)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.workload, workload)
+			assert.Equal(t, tt.rollingOut, rollingOut)
+		})
+	}
+}
@@ -61,9 +61,9 @@ func EndTaintFailSafe(actualTainted int) error {
 	return nil
 }
 
-// AddToBeRemovedTaint takes a k8s node and adds the ToBeRemovedByAutoscaler taint to the node
+// AddToBeRemovedTaint takes a k8s node and adds the ToBeRemovedByAutoscaler taint to the node, tainted at now
 // returns the most recent update of the node that is successful
-func AddToBeRemovedTaint(node *apiv1.Node, client kubernetes.Interface) (*apiv1.Node, error) {
+func AddToBeRemovedTaint(node *apiv1.Node, client kubernetes.Interface, now time.Time) (*apiv1.Node, error) {
 	if tainted > targetTaints {
 		log.Warning("Taint count exceeds the target set by the lock")
 	}
@@ -95,7 +95,7 @@ func AddToBeRemovedTaint(node *apiv1.Node, client kubernetes.Interface) (*apiv1.
 
 	updatedNode.Spec.Taints = append(updatedNode.Spec.Taints, apiv1.Taint{
 		Key:    ToBeRemovedByAutoscalerKey,
-		Value:  fmt.Sprint(time.Now().Unix()),
+		Value:  fmt.Sprint(now.Unix()),
 		Effect: apiv1.TaintEffectNoSchedule,
 	})
 
@@ -120,6 +120,49 @@ func GetToBeRemovedTaint(node *apiv1.Node) (apiv1.Taint, bool) {
 	return apiv1.Taint{}, false
 }
 
+// GetExternalTaints returns the NoSchedule and NoExecute taints of the node that weren't applied by escalator
+func GetExternalTaints(node *apiv1.Node) []apiv1.Taint {
+	var taints []apiv1.Taint
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == ToBeRemovedByAutoscalerKey {
+			continue
+		}
+		if taint.Effect == apiv1.TaintEffectNoSchedule || taint.Effect == apiv1.TaintEffectNoExecute {
+			taints = append(taints, taint)
+		}
+	}
+	return taints
+}
+
+// HasAnyTaintKey returns whether the node has a taint with any of the keys, whatever its value and effect
+func HasAnyTaintKey(node *apiv1.Node, keys []string) bool {
+	for _, taint := range node.Spec.Taints {
+		for _, key := range keys {
+			if taint.Key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PodToleratesTaints returns whether the pod has a toleration for every one of the taints
+func PodToleratesTaints(pod *apiv1.Pod, taints []apiv1.Taint) bool {
+	for i := range taints {
+		tolerated := false
+		for j := range pod.Spec.Tolerations {
+			if pod.Spec.Tolerations[j].ToleratesTaint(&taints[i]) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
 // GetToBeRemovedTime returns the time the node was tainted
 // result will be nil if does not exist
 func GetToBeRemovedTime(node *apiv1.Node) (*time.Time, error) {
@@ -46,7 +46,7 @@ func getStringFromChan(c chan string) string {
 func TestAddToBeRemovedTaint(t *testing.T) {
 	node := test.BuildTestNode(test.NodeOpts{})
 	fakeClient, updatedNodes := buildFakeClientAndUpdateChannel(node)
-	updated, err := AddToBeRemovedTaint(node, fakeClient)
+	updated, err := AddToBeRemovedTaint(node, fakeClient, time.Now())
 
 	assert.NoError(t, err)
 	assert.Equal(t, updated.Name, getStringFromChan(updatedNodes))
@@ -59,7 +59,7 @@ func TestAddToBeRemovedTaint_AlreadyExists(t *testing.T) {
 	fakeClient, updatedNodes := buildFakeClientAndUpdateChannel(node)
 
 	// Add the taint
-	updated, err := AddToBeRemovedTaint(node, fakeClient)
+	updated, err := AddToBeRemovedTaint(node, fakeClient, time.Now())
 	assert.NoError(t, err)
 	assert.Equal(t, updated.Name, getStringFromChan(updatedNodes))
 
@@ -67,7 +67,7 @@ func TestAddToBeRemovedTaint_AlreadyExists(t *testing.T) {
 	fakeClient, updatedNodes = buildFakeClientAndUpdateChannel(updated)
 
 	// Add the taint again on the updated node
-	_, err = AddToBeRemovedTaint(updated, fakeClient)
+	_, err = AddToBeRemovedTaint(updated, fakeClient, time.Now())
 	assert.NoError(t, err)
 	// Ensure the taint is not added again
 	assert.Equal(t, "nothing returned", getStringFromChan(updatedNodes))
@@ -76,7 +76,7 @@ func TestAddToBeRemovedTaint_AlreadyExists(t *testing.T) {
 func TestGetToBeRemovedTaint(t *testing.T) {
 	node := test.BuildTestNode(test.NodeOpts{})
 	fakeClient, updatedNodes := buildFakeClientAndUpdateChannel(node)
-	updated, err := AddToBeRemovedTaint(node, fakeClient)
+	updated, err := AddToBeRemovedTaint(node, fakeClient, time.Now())
 
 	assert.NoError(t, err)
 	assert.Equal(t, updated.Name, getStringFromChan(updatedNodes))
@@ -86,6 +86,50 @@ func TestGetToBeRemovedTaint(t *testing.T) {
 	assert.Equal(t, apiv1.TaintEffectNoSchedule, taint.Effect)
 }
 
+func TestGetExternalTaints(t *testing.T) {
+	node := test.BuildTestNode(test.NodeOpts{Tainted: true})
+	assert.Empty(t, GetExternalTaints(node))
+
+	node.Spec.Taints = append(node.Spec.Taints,
+		apiv1.Taint{Key: "dedicated", Value: "gpu", Effect: apiv1.TaintEffectNoSchedule},
+		apiv1.Taint{Key: "maintenance", Effect: apiv1.TaintEffectNoExecute},
+		apiv1.Taint{Key: "preferred", Effect: apiv1.TaintEffectPreferNoSchedule},
+	)
+	taints := GetExternalTaints(node)
+	assert.Len(t, taints, 2)
+	assert.Equal(t, "dedicated", taints[0].Key)
+	assert.Equal(t, "maintenance", taints[1].Key)
+}
+
+func TestHasAnyTaintKey(t *testing.T) {
+	node := test.BuildTestNode(test.NodeOpts{Tainted: true})
+	keys := []string{"ToBeDeletedByClusterAutoscaler", "example.com/deleting"}
+	assert.False(t, HasAnyTaintKey(node, keys))
+	assert.False(t, HasAnyTaintKey(node, nil))
+
+	node.Spec.Taints = append(node.Spec.Taints, apiv1.Taint{Key: "example.com/deleting", Value: "1", Effect: apiv1.TaintEffectPreferNoSchedule})
+	assert.True(t, HasAnyTaintKey(node, keys))
+	assert.True(t, HasAnyTaintKey(node, []string{ToBeRemovedByAutoscalerKey}))
+}
+
+func TestPodToleratesTaints(t *testing.T) {
+	taints := []apiv1.Taint{
+		{Key: "dedicated", Value: "gpu", Effect: apiv1.TaintEffectNoSchedule},
+		{Key: "maintenance", Effect: apiv1.TaintEffectNoExecute},
+	}
+	pod := test.BuildTestPod(test.PodOpts{})
+	assert.True(t, PodToleratesTaints(pod, nil))
+	assert.False(t, PodToleratesTaints(pod, taints))
+
+	pod.Spec.Tolerations = []apiv1.Toleration{
+		{Key: "dedicated", Operator: apiv1.TolerationOpEqual, Value: "gpu", Effect: apiv1.TaintEffectNoSchedule},
+	}
+	assert.False(t, PodToleratesTaints(pod, taints))
+
+	pod.Spec.Tolerations = append(pod.Spec.Tolerations, apiv1.Toleration{Key: "maintenance", Operator: apiv1.TolerationOpExists})
+	assert.True(t, PodToleratesTaints(pod, taints))
+}
+
 func TestGetToBeRemovedTime(t *testing.T) {
 	node := test.BuildTestNode(test.NodeOpts{})
 
@@ -98,7 +142,7 @@ func TestGetToBeRemovedTime(t *testing.T) {
 	fakeClient, updatedNodes := buildFakeClientAndUpdateChannel(node)
 
 	// Add the taint to the node
-	updated, err := AddToBeRemovedTaint(node, fakeClient)
+	updated, err := AddToBeRemovedTaint(node, fakeClient, time.Now())
 	assert.NoError(t, err)
 	assert.Equal(t, updated.Name, getStringFromChan(updatedNodes))
 	_, ok := GetToBeRemovedTaint(updated)
@@ -129,7 +173,7 @@ func TestDeleteToBeRemovedTaint(t *testing.T) {
 	node := test.BuildTestNode(test.NodeOpts{})
 	fakeClient, updatedNodes := buildFakeClientAndUpdateChannel(node)
 
-	updated, err := AddToBeRemovedTaint(node, fakeClient)
+	updated, err := AddToBeRemovedTaint(node, fakeClient, time.Now())
 	assert.NoError(t, err)
 	assert.Equal(t, updated.Name, getStringFromChan(updatedNodes))
 
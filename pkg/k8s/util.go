@@ -1,8 +1,13 @@
 package k8s
 
 import (
+	"time"
+
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	v1helper "k8s.io/kubernetes/pkg/apis/core/v1/helper"
 )
 
 // PodIsDaemonSet returns if the pod is a daemonset or not
@@ -15,22 +20,272 @@ func PodIsDaemonSet(pod *v1.Pod) bool {
 	return false
 }
 
+// PodIsJob returns if the pod is owned by a job or not
+func PodIsJob(pod *v1.Pod) bool {
+	for _, ownerReference := range pod.ObjectMeta.OwnerReferences {
+		if ownerReference.Kind == "Job" {
+			return true
+		}
+	}
+	return false
+}
+
 // PodIsStatic returns if the pod is static or not
 func PodIsStatic(pod *v1.Pod) bool {
 	configSource, ok := pod.ObjectMeta.Annotations["kubernetes.io/config.source"]
 	return ok && configSource == "file"
 }
 
-// CalculatePodsRequestsTotal returns the total capacity of all pods
+// PodIsTerminated returns if the pod is in a terminal phase (Succeeded or Failed)
+// terminated pods no longer consume node resources so are not counted towards requests
+func PodIsTerminated(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
+
+// ExpectedDurationAnnotation is the pod annotation for how long the pod is expected to run for, as a duration such as 2h
+// it is a best effort hint used to avoid tainting nodes running pods that are expected to run for a long time
+const ExpectedDurationAnnotation = "escalator.atlassian.com/expected-duration"
+
+// PodIsUnschedulable returns whether the scheduler has marked the pod as unschedulable
+func PodIsUnschedulable(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled {
+			return condition.Status == v1.ConditionFalse && condition.Reason == v1.PodReasonUnschedulable
+		}
+	}
+	return false
+}
+
+// PodIsReady returns whether the pod has the Ready condition
+func PodIsReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// CrashLoopBackOffReason is the reason of a container waiting to be restarted after repeatedly crashing
+const CrashLoopBackOffReason = "CrashLoopBackOff"
+
+// PodCrashLoopingSince returns when the pod stopped being Ready if any of its containers are waiting to be restarted in
+// CrashLoopBackOff. Pods that have never been Ready are timed from when they started, or were created if they haven't
+// started. Returns false if none of the containers are in CrashLoopBackOff
+func PodCrashLoopingSince(pod *v1.Pod) (time.Time, bool) {
+	crashLooping := false
+	for _, statuses := range [][]v1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.State.Waiting != nil && status.State.Waiting.Reason == CrashLoopBackOffReason {
+				crashLooping = true
+			}
+		}
+	}
+	if !crashLooping {
+		return time.Time{}, false
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady && condition.Status != v1.ConditionTrue && !condition.LastTransitionTime.IsZero() {
+			return condition.LastTransitionTime.Time, true
+		}
+	}
+	if pod.Status.StartTime != nil {
+		return pod.Status.StartTime.Time, true
+	}
+	return pod.ObjectMeta.CreationTimestamp.Time, true
+}
+
+// PodExpectedEndTime returns when the pod is expected to finish, from its start time and ExpectedDurationAnnotation
+// returns false if the pod doesn't have the annotation or it isn't a valid duration
+func PodExpectedEndTime(pod *v1.Pod) (time.Time, bool) {
+	value, ok := pod.ObjectMeta.Annotations[ExpectedDurationAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	expectedDuration, err := time.ParseDuration(value)
+	if err != nil || expectedDuration <= 0 {
+		return time.Time{}, false
+	}
+
+	// pods that haven't started yet are timed from when they were created
+	start := pod.ObjectMeta.CreationTimestamp.Time
+	if pod.Status.StartTime != nil {
+		start = pod.Status.StartTime.Time
+	}
+	return start.Add(expectedDuration), true
+}
+
+// PodMatchesNodeLabels returns if the pod's node selector and required node affinity allow it to be scheduled onto a
+// node with the given labels
+func PodMatchesNodeLabels(pod *v1.Pod, nodeLabels map[string]string) bool {
+	for key, value := range pod.Spec.NodeSelector {
+		if nodeValue, ok := nodeLabels[key]; !ok || nodeValue != value {
+			return false
+		}
+	}
+
+	affinity := pod.Spec.Affinity
+	if affinity != nil && affinity.NodeAffinity != nil && affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+		return v1helper.MatchNodeSelectorTerms(terms, labels.Set(nodeLabels), nil)
+	}
+
+	return true
+}
+
+// PodExtendedResourceRequests returns the extended resources, such as GPUs, and hugepages requested by the pod
+// calculated the same way as the cpu and memory requests by CalculatePodRequests. Extended resources can be set as
+// only a limit, in which case the request is the limit
+func PodExtendedResourceRequests(pod *v1.Pod) v1.ResourceList {
+	requests := v1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		for name, quantity := range containerExtendedResourceRequests(container) {
+			total := requests[name]
+			total.Add(quantity)
+			requests[name] = total
+		}
+	}
+	for _, container := range pod.Spec.InitContainers {
+		for name, quantity := range containerExtendedResourceRequests(container) {
+			if total, ok := requests[name]; !ok || quantity.Cmp(total) > 0 {
+				requests[name] = quantity
+			}
+		}
+	}
+	return requests
+}
+
+// containerExtendedResourceRequests returns the extended resources and hugepages requested by the container
+func containerExtendedResourceRequests(container v1.Container) v1.ResourceList {
+	requests := v1.ResourceList{}
+	for _, list := range []v1.ResourceList{container.Resources.Limits, container.Resources.Requests} {
+		for name, quantity := range list {
+			if v1helper.IsExtendedResourceName(name) || v1helper.IsHugePageResourceName(name) {
+				requests[name] = quantity
+			}
+		}
+	}
+	return requests
+}
+
+// NodeFitsExtendedResources returns if the allocatable of the node has at least the extended resources and hugepages
+// requested by the pod, ignoring what is already used by other pods. Adding more of the same node would never allow a
+// pod that doesn't fit to be scheduled
+func NodeFitsExtendedResources(pod *v1.Pod, node *v1.Node) bool {
+	for name, request := range PodExtendedResourceRequests(pod) {
+		if request.IsZero() {
+			continue
+		}
+		allocatable, ok := node.Status.Allocatable[name]
+		if !ok {
+			allocatable = node.Status.Capacity[name]
+		}
+		if allocatable.Cmp(request) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// HostnameTopologyKey is the topology key of pod anti-affinity terms that spread pods across nodes
+const HostnameTopologyKey = "kubernetes.io/hostname"
+
+// PodAntiAffinityMatches returns if the pod's required pod anti-affinity stops it from being scheduled onto the same
+// node as the other pod. Only terms with the HostnameTopologyKey are considered
+func PodAntiAffinityMatches(pod *v1.Pod, other *v1.Pod) bool {
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.PodAntiAffinity == nil {
+		return false
+	}
+
+	for _, term := range affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+		if term.TopologyKey != HostnameTopologyKey {
+			continue
+		}
+		namespaces := term.Namespaces
+		if len(namespaces) == 0 {
+			namespaces = []string{pod.Namespace}
+		}
+		if !stringInSlice(other.Namespace, namespaces) {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+		if err != nil {
+			continue
+		}
+		if selector.Matches(labels.Set(other.Labels)) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringInSlice returns if the string is in the slice
+func stringInSlice(s string, slice []string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// CalculatePodRequests returns the effective memory and cpu requests of the pod, the same as the kubernetes scheduler
+// the init containers run one at a time before the containers, so each resource is the larger of the sum of the
+// containers' requests and the largest request of any init container
+func CalculatePodRequests(pod *v1.Pod) (resource.Quantity, resource.Quantity) {
+	var memoryRequest resource.Quantity
+	var cpuRequest resource.Quantity
+
+	for _, container := range pod.Spec.Containers {
+		memoryRequest.Add(*container.Resources.Requests.Memory())
+		cpuRequest.Add(*container.Resources.Requests.Cpu())
+	}
+
+	for _, container := range pod.Spec.InitContainers {
+		if initMemory := container.Resources.Requests.Memory(); initMemory.Cmp(memoryRequest) > 0 {
+			memoryRequest = *initMemory
+		}
+		if initCPU := container.Resources.Requests.Cpu(); initCPU.Cmp(cpuRequest) > 0 {
+			cpuRequest = *initCPU
+		}
+	}
+
+	return memoryRequest, cpuRequest
+}
+
+// CalculatePodRequestsOrDefault returns the effective memory and cpu requests of the pod, using the default memory or
+// cpu request for a resource the pod doesn't request
+func CalculatePodRequestsOrDefault(pod *v1.Pod, defaultMemory, defaultCPU resource.Quantity) (resource.Quantity, resource.Quantity) {
+	memoryRequest, cpuRequest := CalculatePodRequests(pod)
+	if memoryRequest.IsZero() && !defaultMemory.IsZero() {
+		memoryRequest = defaultMemory
+	}
+	if cpuRequest.IsZero() && !defaultCPU.IsZero() {
+		cpuRequest = defaultCPU
+	}
+	return memoryRequest, cpuRequest
+}
+
+// CalculatePodsRequestsTotal returns the total capacity of all pods, excluding terminated pods
 func CalculatePodsRequestsTotal(pods []*v1.Pod) (resource.Quantity, resource.Quantity, error) {
+	return CalculatePodsRequestsTotalOrDefault(pods, resource.Quantity{}, resource.Quantity{})
+}
+
+// CalculatePodsRequestsTotalOrDefault returns the total capacity of all pods, excluding terminated pods, using the
+// default memory or cpu request for each pod that doesn't request the resource
+func CalculatePodsRequestsTotalOrDefault(pods []*v1.Pod, defaultMemory, defaultCPU resource.Quantity) (resource.Quantity, resource.Quantity, error) {
 	var memoryRequest resource.Quantity
 	var cpuRequests resource.Quantity
 
 	for _, pod := range pods {
-		for _, container := range pod.Spec.Containers {
-			memoryRequest.Add(*container.Resources.Requests.Memory())
-			cpuRequests.Add(*container.Resources.Requests.Cpu())
+		if PodIsTerminated(pod) {
+			continue
 		}
+		memory, cpu := CalculatePodRequestsOrDefault(pod, defaultMemory, defaultCPU)
+		memoryRequest.Add(memory)
+		cpuRequests.Add(cpu)
 	}
 
 	return memoryRequest, cpuRequests, nil
@@ -38,13 +293,42 @@ func CalculatePodsRequestsTotal(pods []*v1.Pod) (resource.Quantity, resource.Qua
 
 // CalculateNodesCapacityTotal calculates the total Allocatable node capacity for all nodes
 func CalculateNodesCapacityTotal(nodes []*v1.Node) (resource.Quantity, resource.Quantity, error) {
+	return CalculateNodesCapacityTotalLessReserved(nodes, resource.Quantity{}, resource.Quantity{})
+}
+
+// CalculateNodesCapacityTotalLessReserved calculates the total Allocatable node capacity for all nodes, after
+// subtracting the reserved memory and cpu from each node
+func CalculateNodesCapacityTotalLessReserved(nodes []*v1.Node, memoryReserved, cpuReserved resource.Quantity) (resource.Quantity, resource.Quantity, error) {
 	var memoryCapacity resource.Quantity
 	var cpuCapacity resource.Quantity
 
 	for _, node := range nodes {
-		memoryCapacity.Add(*node.Status.Allocatable.Memory())
-		cpuCapacity.Add(*node.Status.Allocatable.Cpu())
+		memory, cpu := NodeAllocatableLessReserved(node, memoryReserved, cpuReserved)
+		memoryCapacity.Add(memory)
+		cpuCapacity.Add(cpu)
 	}
 
 	return memoryCapacity, cpuCapacity, nil
 }
+
+// NodeAllocatableLessReserved returns the Allocatable memory and cpu of the node after subtracting the reserved memory
+// and cpu. Neither is reduced below zero
+func NodeAllocatableLessReserved(node *v1.Node, memoryReserved, cpuReserved resource.Quantity) (resource.Quantity, resource.Quantity) {
+	memory := node.Status.Allocatable.Memory().DeepCopy()
+	if !memoryReserved.IsZero() {
+		memory.Sub(memoryReserved)
+		if memory.Sign() < 0 {
+			memory = *resource.NewQuantity(0, memory.Format)
+		}
+	}
+
+	cpu := node.Status.Allocatable.Cpu().DeepCopy()
+	if !cpuReserved.IsZero() {
+		cpu.Sub(cpuReserved)
+		if cpu.Sign() < 0 {
+			cpu = *resource.NewQuantity(0, cpu.Format)
+		}
+	}
+
+	return memory, cpu
+}
@@ -2,6 +2,7 @@ package k8s_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/atlassian/escalator/pkg/k8s"
 	"github.com/atlassian/escalator/pkg/test"
@@ -9,6 +10,7 @@ import (
 
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestPodIsDaemonSet(t *testing.T) {
@@ -21,6 +23,16 @@ func TestPodIsDaemonSet(t *testing.T) {
 	assert.False(t, k8s.PodIsDaemonSet(pod))
 }
 
+func TestPodIsJob(t *testing.T) {
+	job := test.BuildTestPod(test.PodOpts{
+		Owner: "Job",
+	})
+	pod := test.BuildTestPod(test.PodOpts{})
+
+	assert.True(t, k8s.PodIsJob(job))
+	assert.False(t, k8s.PodIsJob(pod))
+}
+
 func TestPodIsStatic(t *testing.T) {
 	staticPod := test.BuildTestPod(test.PodOpts{})
 	staticPod.ObjectMeta.Annotations = make(map[string]string)
@@ -31,6 +43,206 @@ func TestPodIsStatic(t *testing.T) {
 	assert.False(t, k8s.PodIsStatic(pod))
 }
 
+func TestPodIsTerminated(t *testing.T) {
+	tests := []struct {
+		phase v1.PodPhase
+		want  bool
+	}{
+		{v1.PodPending, false},
+		{v1.PodRunning, false},
+		{v1.PodUnknown, false},
+		{v1.PodSucceeded, true},
+		{v1.PodFailed, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.phase), func(t *testing.T) {
+			pod := test.BuildTestPod(test.PodOpts{Phase: tt.phase})
+			assert.Equal(t, tt.want, k8s.PodIsTerminated(pod))
+		})
+	}
+}
+
+func TestPodIsUnschedulable(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []v1.PodCondition
+		want       bool
+	}{
+		{"no conditions", nil, false},
+		{"unschedulable", []v1.PodCondition{{Type: v1.PodScheduled, Status: v1.ConditionFalse, Reason: v1.PodReasonUnschedulable}}, true},
+		{"scheduled", []v1.PodCondition{{Type: v1.PodScheduled, Status: v1.ConditionTrue}}, false},
+		{"other condition", []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse, Reason: v1.PodReasonUnschedulable}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := test.BuildTestPod(test.PodOpts{})
+			pod.Status.Conditions = tt.conditions
+			assert.Equal(t, tt.want, k8s.PodIsUnschedulable(pod))
+		})
+	}
+}
+
+func TestPodIsReady(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []v1.PodCondition
+		want       bool
+	}{
+		{"no conditions", nil, false},
+		{"ready", []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}, true},
+		{"not ready", []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse}}, false},
+		{"other condition", []v1.PodCondition{{Type: v1.PodScheduled, Status: v1.ConditionTrue}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := test.BuildTestPod(test.PodOpts{})
+			pod.Status.Conditions = tt.conditions
+			assert.Equal(t, tt.want, k8s.PodIsReady(pod))
+		})
+	}
+}
+
+func TestPodExpectedEndTime(t *testing.T) {
+	created := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	started := created.Add(time.Minute)
+
+	pod := test.BuildTestPod(test.PodOpts{})
+	pod.CreationTimestamp = metav1.NewTime(created)
+	_, ok := k8s.PodExpectedEndTime(pod)
+	assert.False(t, ok)
+
+	pod.Annotations = map[string]string{k8s.ExpectedDurationAnnotation: "forever"}
+	_, ok = k8s.PodExpectedEndTime(pod)
+	assert.False(t, ok)
+
+	// pods that haven't started are timed from their creation
+	pod.Annotations[k8s.ExpectedDurationAnnotation] = "2h"
+	end, ok := k8s.PodExpectedEndTime(pod)
+	assert.True(t, ok)
+	assert.Equal(t, created.Add(2*time.Hour), end)
+
+	startTime := metav1.NewTime(started)
+	pod.Status.StartTime = &startTime
+	end, ok = k8s.PodExpectedEndTime(pod)
+	assert.True(t, ok)
+	assert.Equal(t, started.Add(2*time.Hour), end)
+}
+
+func TestPodCrashLoopingSince(t *testing.T) {
+	created := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	started := created.Add(time.Minute)
+	notReady := created.Add(time.Hour)
+
+	pod := test.BuildTestPod(test.PodOpts{CPU: []int64{100}, Mem: []int64{100}})
+	pod.CreationTimestamp = metav1.NewTime(created)
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+		State: v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+	}}
+	_, ok := k8s.PodCrashLoopingSince(pod)
+	assert.False(t, ok)
+
+	pod.Status.ContainerStatuses[0].State = v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}}
+	_, ok = k8s.PodCrashLoopingSince(pod)
+	assert.False(t, ok)
+
+	// pods that haven't started are timed from their creation
+	pod.Status.ContainerStatuses[0].State = v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: k8s.CrashLoopBackOffReason}}
+	since, ok := k8s.PodCrashLoopingSince(pod)
+	assert.True(t, ok)
+	assert.Equal(t, created, since)
+
+	startTime := metav1.NewTime(started)
+	pod.Status.StartTime = &startTime
+	since, ok = k8s.PodCrashLoopingSince(pod)
+	assert.True(t, ok)
+	assert.Equal(t, started, since)
+
+	pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse, LastTransitionTime: metav1.NewTime(notReady)}}
+	since, ok = k8s.PodCrashLoopingSince(pod)
+	assert.True(t, ok)
+	assert.Equal(t, notReady, since)
+
+	// crash looping init containers also count
+	pod.Status.ContainerStatuses[0].State = v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "PodInitializing"}}
+	pod.Status.InitContainerStatuses = []v1.ContainerStatus{{
+		State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: k8s.CrashLoopBackOffReason}},
+	}}
+	_, ok = k8s.PodCrashLoopingSince(pod)
+	assert.True(t, ok)
+}
+
+func TestPodAntiAffinityMatches(t *testing.T) {
+	pod := test.BuildTestPod(test.PodOpts{Name: "db-1", Namespace: "default"})
+	pod.Spec.Affinity = &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			TopologyKey:   k8s.HostnameTopologyKey,
+		}},
+	}}
+	db := test.BuildTestPod(test.PodOpts{Name: "db-2", Namespace: "default"})
+	db.Labels = map[string]string{"app": "db"}
+	web := test.BuildTestPod(test.PodOpts{Name: "web", Namespace: "default"})
+	web.Labels = map[string]string{"app": "web"}
+	otherNamespace := test.BuildTestPod(test.PodOpts{Name: "db-3", Namespace: "other"})
+	otherNamespace.Labels = map[string]string{"app": "db"}
+
+	assert.True(t, k8s.PodAntiAffinityMatches(pod, db))
+	assert.False(t, k8s.PodAntiAffinityMatches(pod, web))
+	// terms without namespaces only apply to the namespace of the pod
+	assert.False(t, k8s.PodAntiAffinityMatches(pod, otherNamespace))
+	// pods without anti-affinity don't conflict with anything
+	assert.False(t, k8s.PodAntiAffinityMatches(db, pod))
+}
+
+func TestPodMatchesNodeLabels(t *testing.T) {
+	nodeLabels := map[string]string{
+		"customer":      "shared",
+		"instance-type": "m5.large",
+	}
+
+	tests := []struct {
+		name string
+		pod  *v1.Pod
+		want bool
+	}{
+		{
+			"no selector or affinity",
+			test.BuildTestPod(test.PodOpts{}),
+			true,
+		},
+		{
+			"matching node selector",
+			test.BuildTestPod(test.PodOpts{NodeSelectorKey: "instance-type", NodeSelectorValue: "m5.large"}),
+			true,
+		},
+		{
+			"node selector with a different value",
+			test.BuildTestPod(test.PodOpts{NodeSelectorKey: "instance-type", NodeSelectorValue: "p3.2xlarge"}),
+			false,
+		},
+		{
+			"node selector with a missing label",
+			test.BuildTestPod(test.PodOpts{NodeSelectorKey: "gpu", NodeSelectorValue: ""}),
+			false,
+		},
+		{
+			"matching node affinity",
+			test.BuildTestPod(test.PodOpts{NodeAffinityKey: "instance-type", NodeAffinityValue: "m5.large"}),
+			true,
+		},
+		{
+			"node affinity not matching",
+			test.BuildTestPod(test.PodOpts{NodeAffinityKey: "instance-type", NodeAffinityValue: "p3.2xlarge"}),
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, k8s.PodMatchesNodeLabels(tt.pod, nodeLabels))
+		})
+	}
+}
+
 func TestCalculatePodsRequestTotal(t *testing.T) {
 	p1 := test.BuildTestPod(test.PodOpts{
 		CPU: []int64{1000},
@@ -60,6 +272,16 @@ func TestCalculatePodsRequestTotal(t *testing.T) {
 		CPU: []int64{22, 60, 430, 1000},
 		Mem: []int64{225, 100, 430, 1000},
 	})
+	succeeded := test.BuildTestPod(test.PodOpts{
+		CPU:   []int64{1000},
+		Mem:   []int64{1000},
+		Phase: v1.PodSucceeded,
+	})
+	failed := test.BuildTestPod(test.PodOpts{
+		CPU:   []int64{1000},
+		Mem:   []int64{1000},
+		Phase: v1.PodFailed,
+	})
 
 	type args struct {
 		pods []*v1.Pod
@@ -134,6 +356,14 @@ func TestCalculatePodsRequestTotal(t *testing.T) {
 			*resource.NewQuantity(2055, resource.DecimalSI),
 			*resource.NewMilliQuantity(2112, resource.DecimalSI),
 		},
+		{
+			"test terminated pods are excluded",
+			args{
+				[]*v1.Pod{p1, succeeded, failed},
+			},
+			*resource.NewQuantity(1000, resource.DecimalSI),
+			*resource.NewMilliQuantity(1000, resource.DecimalSI),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -145,6 +375,82 @@ func TestCalculatePodsRequestTotal(t *testing.T) {
 	}
 }
 
+func TestCalculatePodRequestsInitContainers(t *testing.T) {
+	initContainer := func(cpu int64, mem int64) v1.Container {
+		return v1.Container{
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceCPU:    *resource.NewMilliQuantity(cpu, resource.DecimalSI),
+					v1.ResourceMemory: *resource.NewQuantity(mem, resource.DecimalSI),
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		initContainers []v1.Container
+		mem            int64
+		cpu            int64
+	}{
+		{"no init containers", nil, 600, 300},
+		// the init container runs on its own before the containers, so it isn't added to them
+		{"smaller init container", []v1.Container{initContainer(100, 100)}, 600, 300},
+		{"large init container", []v1.Container{initContainer(4000, 8000)}, 8000, 4000},
+		// each resource is the larger of the containers and the largest init container, independently
+		{"init containers larger in one resource", []v1.Container{initContainer(1000, 100), initContainer(200, 700)}, 700, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := test.BuildTestPod(test.PodOpts{
+				CPU: []int64{100, 200},
+				Mem: []int64{200, 400},
+			})
+			pod.Spec.InitContainers = tt.initContainers
+
+			mem, cpu := k8s.CalculatePodRequests(pod)
+			assert.Equal(t, tt.mem, mem.Value())
+			assert.Equal(t, tt.cpu, cpu.MilliValue())
+		})
+	}
+}
+
+func TestCalculatePodRequestsOrDefault(t *testing.T) {
+	defaultMemory := *resource.NewQuantity(500, resource.DecimalSI)
+	defaultCPU := *resource.NewMilliQuantity(250, resource.DecimalSI)
+
+	withoutRequests := test.BuildTestPod(test.PodOpts{})
+	withoutRequests.Spec.Containers = []v1.Container{{}}
+	withRequests := test.BuildTestPod(test.PodOpts{CPU: []int64{100}, Mem: []int64{200}})
+	cpuOnly := test.BuildTestPod(test.PodOpts{})
+	cpuOnly.Spec.Containers = []v1.Container{{Resources: v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: *resource.NewMilliQuantity(100, resource.DecimalSI)},
+	}}}
+
+	tests := []struct {
+		name string
+		pod  *v1.Pod
+		mem  int64
+		cpu  int64
+	}{
+		{"pod without requests", withoutRequests, 500, 250},
+		{"pod with requests", withRequests, 200, 100},
+		{"pod only requesting cpu", cpuOnly, 500, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem, cpu := k8s.CalculatePodRequestsOrDefault(tt.pod, defaultMemory, defaultCPU)
+			assert.Equal(t, tt.mem, mem.Value())
+			assert.Equal(t, tt.cpu, cpu.MilliValue())
+		})
+	}
+
+	mem, cpu, err := k8s.CalculatePodsRequestsTotalOrDefault([]*v1.Pod{withoutRequests, withRequests, cpuOnly}, defaultMemory, defaultCPU)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1200), mem.Value())
+	assert.Equal(t, int64(450), cpu.MilliValue())
+}
+
 func TestCalculateNodesCapacityTotal(t *testing.T) {
 	n1 := test.BuildTestNode(test.NodeOpts{
 		CPU: 1000,
@@ -242,3 +548,95 @@ func TestCalculateNodesCapacityTotal(t *testing.T) {
 		})
 	}
 }
+
+func TestCalculateNodesCapacityTotalLessReserved(t *testing.T) {
+	n1 := test.BuildTestNode(test.NodeOpts{
+		CPU: 1000,
+		Mem: 1000,
+	})
+	n2 := test.BuildTestNode(test.NodeOpts{
+		CPU: 300,
+		Mem: 800,
+	})
+
+	tests := []struct {
+		name        string
+		nodes       []*v1.Node
+		memReserved resource.Quantity
+		cpuReserved resource.Quantity
+		mem         int64
+		cpu         int64
+	}{
+		{
+			"no reservation",
+			[]*v1.Node{n1, n2},
+			resource.Quantity{},
+			resource.Quantity{},
+			1800,
+			1300,
+		},
+		{
+			"reservation subtracted from each node",
+			[]*v1.Node{n1, n2},
+			*resource.NewQuantity(200, resource.DecimalSI),
+			*resource.NewMilliQuantity(100, resource.DecimalSI),
+			1400,
+			1100,
+		},
+		{
+			"reservation larger than the node is clamped to zero",
+			[]*v1.Node{n1, n2},
+			*resource.NewQuantity(900, resource.DecimalSI),
+			*resource.NewMilliQuantity(500, resource.DecimalSI),
+			100,
+			500,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem, cpu, err := k8s.CalculateNodesCapacityTotalLessReserved(tt.nodes, tt.memReserved, tt.cpuReserved)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.mem, mem.Value())
+			assert.Equal(t, tt.cpu, cpu.MilliValue())
+		})
+	}
+}
+
+func TestPodExtendedResourceRequests(t *testing.T) {
+	pod := test.BuildTestPod(test.PodOpts{Name: "gpu", CPU: []int64{500, 500}, Mem: []int64{10, 10}})
+	pod.Spec.Containers[0].Resources.Limits = v1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")}
+	pod.Spec.Containers[1].Resources.Requests["nvidia.com/gpu"] = resource.MustParse("2")
+	pod.Spec.Containers[1].Resources.Requests["hugepages-2Mi"] = resource.MustParse("256Mi")
+	pod.Spec.InitContainers = []v1.Container{{
+		Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{"hugepages-2Mi": resource.MustParse("512Mi")},
+		},
+	}}
+
+	requests := k8s.PodExtendedResourceRequests(pod)
+	// cpu and memory aren't extended resources
+	assert.Len(t, requests, 2)
+	gpu := requests["nvidia.com/gpu"]
+	assert.Equal(t, int64(3), gpu.Value())
+	hugepages := requests["hugepages-2Mi"]
+	maxInit := resource.MustParse("512Mi")
+	assert.Equal(t, maxInit.Value(), hugepages.Value())
+}
+
+func TestNodeFitsExtendedResources(t *testing.T) {
+	pod := test.BuildTestPod(test.PodOpts{Name: "gpu", CPU: []int64{500}, Mem: []int64{10}})
+	pod.Spec.Containers[0].Resources.Requests["nvidia.com/gpu"] = resource.MustParse("2")
+
+	node := test.BuildTestNode(test.NodeOpts{Name: "n1", CPU: 1000, Mem: 1000})
+	assert.False(t, k8s.NodeFitsExtendedResources(pod, node))
+
+	node.Status.Allocatable["nvidia.com/gpu"] = resource.MustParse("1")
+	assert.False(t, k8s.NodeFitsExtendedResources(pod, node))
+
+	node.Status.Allocatable["nvidia.com/gpu"] = resource.MustParse("4")
+	assert.True(t, k8s.NodeFitsExtendedResources(pod, node))
+
+	// pods without extended resources fit any node
+	plain := test.BuildTestPod(test.PodOpts{Name: "plain", CPU: []int64{500}, Mem: []int64{10}})
+	assert.True(t, k8s.NodeFitsExtendedResources(plain, test.BuildTestNode(test.NodeOpts{Name: "n2"})))
+}
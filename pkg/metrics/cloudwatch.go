@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+)
+
+// cloudWatchMaxMetricData is the maximum number of metric data CloudWatch accepts in a single PutMetricData call
+const cloudWatchMaxMetricData = 20
+
+// CloudWatchSink publishes the scale decisions and utilization of every node group as CloudWatch custom metrics
+// each metric has a NodeGroup dimension. It is not safe for concurrent use
+type CloudWatchSink struct {
+	client    cloudwatchiface.CloudWatchAPI
+	namespace string
+	data      []*cloudwatch.MetricDatum
+}
+
+// NewCloudWatchSink creates a sink publishing to the CloudWatch namespace with the client
+func NewCloudWatchSink(client cloudwatchiface.CloudWatchAPI, namespace string) *CloudWatchSink {
+	return &CloudWatchSink{
+		client:    client,
+		namespace: namespace,
+	}
+}
+
+// ScaleUp records the ScaleUpNodes metric
+func (s *CloudWatchSink) ScaleUp(nodegroup string, nodes int) {
+	s.record(nodegroup, "ScaleUpNodes", float64(nodes), cloudwatch.StandardUnitCount)
+}
+
+// ScaleDown records the ScaleDownNodes metric
+func (s *CloudWatchSink) ScaleDown(nodegroup string, nodes int) {
+	s.record(nodegroup, "ScaleDownNodes", float64(nodes), cloudwatch.StandardUnitCount)
+}
+
+// Utilization records the CPUUtilization and MemoryUtilization metrics
+func (s *CloudWatchSink) Utilization(nodegroup string, cpuPercent float64, memPercent float64) {
+	s.record(nodegroup, "CPUUtilization", cpuPercent, cloudwatch.StandardUnitPercent)
+	s.record(nodegroup, "MemoryUtilization", memPercent, cloudwatch.StandardUnitPercent)
+}
+
+// Flush publishes the recorded metrics in batches of up to cloudWatchMaxMetricData
+// the recorded metrics are dropped even if publishing fails, so the next flush doesn't publish stale values
+func (s *CloudWatchSink) Flush() error {
+	data := s.data
+	s.data = nil
+	for len(data) > 0 {
+		n := len(data)
+		if n > cloudWatchMaxMetricData {
+			n = cloudWatchMaxMetricData
+		}
+		_, err := s.client.PutMetricData(&cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(s.namespace),
+			MetricData: data[:n],
+		})
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// record adds a metric datum of the node group, timestamped now
+func (s *CloudWatchSink) record(nodegroup string, name string, value float64, unit string) {
+	s.data = append(s.data, &cloudwatch.MetricDatum{
+		MetricName: aws.String(name),
+		Dimensions: []*cloudwatch.Dimension{{
+			Name:  aws.String("NodeGroup"),
+			Value: aws.String(nodegroup),
+		}},
+		Timestamp: aws.Time(time.Now()),
+		Unit:      aws.String(unit),
+		Value:     aws.Float64(value),
+	})
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/atlassian/escalator/pkg/test"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudWatchSink(t *testing.T) {
+	client := &test.MockCloudWatchService{}
+	sink := NewCloudWatchSink(client, "Escalator")
+
+	sink.ScaleUp("default", 3)
+	sink.ScaleDown("default", 2)
+	sink.Utilization("default", 45.5, 60)
+	require.NoError(t, sink.Flush())
+
+	require.Len(t, client.PutMetricDataInputs, 1)
+	input := client.PutMetricDataInputs[0]
+	assert.Equal(t, "Escalator", aws.StringValue(input.Namespace))
+
+	values := make(map[string]float64)
+	for _, datum := range input.MetricData {
+		require.Len(t, datum.Dimensions, 1)
+		assert.Equal(t, "NodeGroup", aws.StringValue(datum.Dimensions[0].Name))
+		assert.Equal(t, "default", aws.StringValue(datum.Dimensions[0].Value))
+		values[aws.StringValue(datum.MetricName)] = aws.Float64Value(datum.Value)
+	}
+	assert.Equal(t, map[string]float64{
+		"ScaleUpNodes":      3,
+		"ScaleDownNodes":    2,
+		"CPUUtilization":    45.5,
+		"MemoryUtilization": 60,
+	}, values)
+
+	// nothing is published when nothing was recorded since the last flush
+	require.NoError(t, sink.Flush())
+	assert.Len(t, client.PutMetricDataInputs, 1)
+}
+
+func TestCloudWatchSinkFlushBatches(t *testing.T) {
+	client := &test.MockCloudWatchService{}
+	sink := NewCloudWatchSink(client, "Escalator")
+
+	for i := 0; i < 25; i++ {
+		sink.Utilization("default", 50, 50)
+	}
+	require.NoError(t, sink.Flush())
+
+	require.Len(t, client.PutMetricDataInputs, 3)
+	assert.Len(t, client.PutMetricDataInputs[0].MetricData, cloudWatchMaxMetricData)
+	assert.Len(t, client.PutMetricDataInputs[1].MetricData, cloudWatchMaxMetricData)
+	assert.Len(t, client.PutMetricDataInputs[2].MetricData, 10)
+}
+
+func TestCloudWatchSinkFlushError(t *testing.T) {
+	client := &test.MockCloudWatchService{PutMetricDataErr: errors.New("throttled")}
+	sink := NewCloudWatchSink(client, "Escalator")
+
+	sink.ScaleUp("default", 1)
+	assert.Error(t, sink.Flush())
+
+	// the failed metrics are dropped rather than published late
+	client.PutMetricDataErr = nil
+	require.NoError(t, sink.Flush())
+	assert.Len(t, client.PutMetricDataInputs, 1)
+}
@@ -16,6 +16,46 @@ var (
 		Namespace: NAMESPACE,
 		Help:      "Number of times the controller has checked for cluster state",
 	})
+	// Paused indicates if all scaling is paused
+	Paused = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "paused",
+		Namespace: NAMESPACE,
+		Help:      "indicates if all scaling is paused",
+	})
+	// APIHealthy indicates if the kubernetes API server was reachable at the start of the last scan
+	APIHealthy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "api_healthy",
+		Namespace: NAMESPACE,
+		Help:      "indicates if the kubernetes API server was reachable at the start of the last scan",
+	})
+	// CloudProviderHealthy indicates if the cloud provider credentials passed the startup permission check and the cloud
+	// provider refreshed successfully at the start of the last scan
+	CloudProviderHealthy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "cloud_provider_healthy",
+		Namespace: NAMESPACE,
+		Help:      "indicates if the cloud provider credentials have the required permissions and the cloud provider refreshed successfully in the last scan",
+	})
+	// UnsatisfiablePendingPods pending pods that no node group can schedule, by the reason they can't be scheduled
+	UnsatisfiablePendingPods = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "unsatisfiable_pending_pods",
+			Namespace: NAMESPACE,
+			Help:      "pending pods that no node group can schedule, by the reason they can't be scheduled",
+		},
+		[]string{"reason"},
+	)
+	// ConfigReloadFailures is the number of times reloading the node group config failed and the existing config was kept
+	ConfigReloadFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:      "config_reload_failures_total",
+		Namespace: NAMESPACE,
+		Help:      "Number of times reloading the node group config failed and the existing config was kept",
+	})
+	// ScanTimeouts is the number of scans that passed the scan timeout and were aborted
+	ScanTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:      "scan_timeouts_total",
+		Namespace: NAMESPACE,
+		Help:      "Number of scans that passed the scan timeout and were aborted",
+	})
 	// NodeGroupNodesUntainted nodes considered by specific node groups that are untainted
 	NodeGroupNodesUntainted = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -34,6 +74,33 @@ var (
 		},
 		[]string{"node_group"},
 	)
+	// NodeGroupNodesExternallyTainted untainted nodes excluded from the capacity of specific node groups as they are tainted by something other than escalator
+	NodeGroupNodesExternallyTainted = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_externally_tainted_nodes",
+			Namespace: NAMESPACE,
+			Help:      "untainted nodes excluded from the capacity of specific node groups as they are tainted by something other than escalator",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupNodesExternalDeletion nodes of specific node groups marked for deletion by another tool with one of the external deletion taints
+	NodeGroupNodesExternalDeletion = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_external_deletion_nodes",
+			Namespace: NAMESPACE,
+			Help:      "nodes of specific node groups marked for deletion by another tool with one of the external deletion taints",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupNodesMemoryPressure untainted nodes of specific node groups with the MemoryPressure condition
+	NodeGroupNodesMemoryPressure = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_memory_pressure_nodes",
+			Namespace: NAMESPACE,
+			Help:      "untainted nodes of specific node groups with the MemoryPressure condition",
+		},
+		[]string{"node_group"},
+	)
 	// NodeGroupNodes nodes considered by specific node groups
 	NodeGroupNodesCordoned = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -61,6 +128,15 @@ var (
 		},
 		[]string{"node_group"},
 	)
+	// NodeGroupPodsCrashLoopingDiscounted pods of specific node groups left out of the requests as they have been crash looping for longer than discount_crash_looping_pods_after
+	NodeGroupPodsCrashLoopingDiscounted = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_crash_looping_pods_discounted",
+			Namespace: NAMESPACE,
+			Help:      "pods of specific node groups left out of the requests as they have been crash looping for longer than discount_crash_looping_pods_after",
+		},
+		[]string{"node_group"},
+	)
 	// NodeGroupsPodEvicted pods evicted during a scale down
 	NodeGroupPodsEvicted = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -70,6 +146,179 @@ var (
 		},
 		[]string{"node_group"},
 	)
+	// NodeGroupPartialDeletions deletes where the cloud provider only terminated some of the nodes
+	NodeGroupPartialDeletions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "node_group_partial_deletions",
+			Namespace: NAMESPACE,
+			Help:      "deletes where the cloud provider only terminated some of the nodes",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupPreTerminationWebhookFailures calls to the pre-termination webhook that failed or timed out
+	NodeGroupPreTerminationWebhookFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "node_group_pre_termination_webhook_failures",
+			Namespace: NAMESPACE,
+			Help:      "calls to the pre-termination webhook that failed or timed out",
+		},
+		[]string{"node_group", "failure_policy"},
+	)
+	// NodeDrainPodsRemaining pods remaining on a node being drained before it is terminated
+	NodeDrainPodsRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_drain_pods_remaining",
+			Namespace: NAMESPACE,
+			Help:      "pods remaining on a node being drained before it is terminated",
+		},
+		[]string{"node_group", "node"},
+	)
+	// NodeGroupOrphanNodesDeleted orphaned nodes deleted from kubernetes
+	NodeGroupOrphanNodesDeleted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "node_group_orphan_nodes_deleted",
+			Namespace: NAMESPACE,
+			Help:      "orphaned nodes, whose cloud provider instance no longer exists, deleted from kubernetes",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupLabelMismatchNodes nodes in the cloud provider node group without the node group label
+	NodeGroupLabelMismatchNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_label_mismatch_nodes",
+			Namespace: NAMESPACE,
+			Help:      "nodes in the cloud provider node group that are missing the node group label",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupScaleDownClamped scale downs clamped by max_scale_down_fraction
+	NodeGroupScaleDownClamped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "node_group_scale_down_clamped",
+			Namespace: NAMESPACE,
+			Help:      "scale downs clamped by max_scale_down_fraction",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupLocalStorageProtectedNodes nodes not tainted by the last scale down because they host pods with local storage
+	NodeGroupLocalStorageProtectedNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_local_storage_protected_nodes",
+			Namespace: NAMESPACE,
+			Help:      "nodes not tainted by the last scale down because they host pods with local storage",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupRolloutDeferredNodes nodes not tainted by the last scale down because they host pods of a workload part way through a rollout
+	NodeGroupRolloutDeferredNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_rollout_deferred_nodes",
+			Namespace: NAMESPACE,
+			Help:      "nodes not tainted by the last scale down because they host pods of a workload part way through a rollout",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupReplicaSpreadProtectedNodes nodes not tainted by the last scale down because it would leave a workload's replicas unsafely spread
+	NodeGroupReplicaSpreadProtectedNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_replica_spread_protected_nodes",
+			Namespace: NAMESPACE,
+			Help:      "nodes not tainted by the last scale down because it would leave a workload's replicas unsafely spread",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupScanBackoff scans skipped between each scan of the node group whilst it takes no action
+	NodeGroupScanBackoff = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_scan_backoff",
+			Namespace: NAMESPACE,
+			Help:      "scans skipped between each scan of the node group whilst it takes no action",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupFlapping indicates the node group changed between scaling up and scaling down at least
+	// flap_detection_threshold times within the flap_detection_window
+	NodeGroupFlapping = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "nodegroup_flapping",
+			Namespace: NAMESPACE,
+			Help:      "indicates the node group changed between scaling up and scaling down at least flap_detection_threshold times within the flap_detection_window",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupScaleDownBlocked indicates a scale down was suppressed in the last scan, by reason
+	NodeGroupScaleDownBlocked = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_scale_down_blocked",
+			Namespace: NAMESPACE,
+			Help:      "indicates a scale down was suppressed in the last scan, by reason",
+		},
+		[]string{"node_group", "reason"},
+	)
+	// NodeGroupCapacityUnavailable nodes the cloud provider failed to create after the last scale up
+	NodeGroupCapacityUnavailable = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "nodegroup_capacity_unavailable",
+			Namespace: NAMESPACE,
+			Help:      "nodes the cloud provider failed to create after the last scale up",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupMinNodesWasteful the estimated idle nodes kept by min_nodes once the demand of the node group has needed
+	// fewer nodes than min_nodes for longer than the min nodes waste grace period
+	NodeGroupMinNodesWasteful = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "nodegroup_min_nodes_wasteful",
+			Namespace: NAMESPACE,
+			Help:      "the estimated idle nodes kept by min_nodes once the demand has needed fewer nodes than min_nodes for longer than the min nodes waste grace period",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupSaturated whether scale ups of the node group have been blocked by max_nodes for longer than the saturation grace period
+	NodeGroupSaturated = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "nodegroup_saturated",
+			Namespace: NAMESPACE,
+			Help:      "whether scale ups of the node group have been blocked by max_nodes for longer than the saturation grace period",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupEmergencyScaleUps scale ups for pods pending longer than the emergency pending timeout
+	NodeGroupEmergencyScaleUps = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "node_group_emergency_scale_ups",
+			Namespace: NAMESPACE,
+			Help:      "scale ups for pods pending longer than the emergency pending timeout",
+		},
+		[]string{"node_group"},
+	)
+	// ScaleActions scale actions taken by specific node groups by direction and the dominant reason they were taken
+	ScaleActions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "scale_action_total",
+			Namespace: NAMESPACE,
+			Help:      "scale actions taken by specific node groups by direction and the dominant reason they were taken",
+		},
+		[]string{"node_group", "direction", "reason"},
+	)
+	// NodeGroupSizeDivergenceSkips scans skipped because the cloud provider node group reported too few instances
+	NodeGroupSizeDivergenceSkips = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "node_group_size_divergence_skips",
+			Namespace: NAMESPACE,
+			Help:      "scans skipped because the cloud provider node group reported too few instances",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupFrozen indicates if scale actions of the node group are frozen
+	NodeGroupFrozen = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "nodegroup_frozen",
+			Namespace: NAMESPACE,
+			Help:      "indicates if scale actions of the node group are frozen",
+		},
+		[]string{"node_group"},
+	)
 	// NodeGroupsMemPercent percentage of util of memory
 	NodeGroupsMemPercent = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -88,6 +337,60 @@ var (
 		},
 		[]string{"node_group"},
 	)
+	// NodeGroupsMemPercentSmoothed percentage of util of memory smoothed across scans
+	NodeGroupsMemPercentSmoothed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_mem_percent_smoothed",
+			Namespace: NAMESPACE,
+			Help:      "percentage of util of memory smoothed across scans",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupsCPUPercentSmoothed percentage of util of cpu smoothed across scans
+	NodeGroupsCPUPercentSmoothed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_cpu_percent_smoothed",
+			Namespace: NAMESPACE,
+			Help:      "percentage of util of cpu smoothed across scans",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupHeadroomPercent percentage points between the utilization and the nearest scaling threshold
+	NodeGroupHeadroomPercent = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_headroom_percent",
+			Namespace: NAMESPACE,
+			Help:      "percentage points between the utilization and the nearest scaling threshold, positive when the nearest threshold is the scale up threshold and negative when it is the scale down threshold",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupQueueLength approximate number of messages in the queue a node group scales on
+	NodeGroupQueueLength = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_queue_length",
+			Namespace: NAMESPACE,
+			Help:      "approximate number of messages in the queue a node group scales on",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupCronJobPreWarmNodes untainted nodes a node group is pre-warmed to ahead of a CronJob
+	NodeGroupCronJobPreWarmNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_cron_job_pre_warm_nodes",
+			Namespace: NAMESPACE,
+			Help:      "untainted nodes a node group is pre-warmed to ahead of a CronJob, 0 if none is scheduled within the lead time",
+		},
+		[]string{"node_group"},
+	)
+	// MetricSourceHealthy whether the last read of a metric source a node group scales on succeeded, by source
+	MetricSourceHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "metric_source_healthy",
+			Namespace: NAMESPACE,
+			Help:      "whether the last read of a metric source a node group scales on succeeded, by source",
+		},
+		[]string{"node_group", "source"},
+	)
 	// NodeGroupMemRequest byte value of node request mem
 	NodeGroupMemRequest = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -124,6 +427,24 @@ var (
 		},
 		[]string{"node_group"},
 	)
+	// NodeGroupMemCapacityEffective byte value of node capacity mem multiplied by the memory overcommit ratio
+	NodeGroupMemCapacityEffective = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_mem_capacity_effective",
+			Namespace: NAMESPACE,
+			Help:      "byte value of node capacity mem multiplied by the memory overcommit ratio",
+		},
+		[]string{"node_group"},
+	)
+	// NodeGroupCPUCapacityEffective milli value of node capacity cpu multiplied by the cpu overcommit ratio
+	NodeGroupCPUCapacityEffective = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_group_cpu_capacity_effective",
+			Namespace: NAMESPACE,
+			Help:      "milli value of node capacity cpu multiplied by the cpu overcommit ratio",
+		},
+		[]string{"node_group"},
+	)
 	// NodeGroupTaintEvent indicates a scale down event
 	NodeGroupTaintEvent = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -229,18 +550,55 @@ var (
 
 func init() {
 	prometheus.MustRegister(RunCount)
+	prometheus.MustRegister(Paused)
+	prometheus.MustRegister(APIHealthy)
+	prometheus.MustRegister(CloudProviderHealthy)
+	prometheus.MustRegister(ConfigReloadFailures)
+	prometheus.MustRegister(ScanTimeouts)
+	prometheus.MustRegister(UnsatisfiablePendingPods)
 	prometheus.MustRegister(NodeGroupNodes)
 	prometheus.MustRegister(NodeGroupNodesCordoned)
 	prometheus.MustRegister(NodeGroupNodesUntainted)
 	prometheus.MustRegister(NodeGroupNodesTainted)
+	prometheus.MustRegister(NodeGroupNodesExternallyTainted)
+	prometheus.MustRegister(NodeGroupNodesExternalDeletion)
+	prometheus.MustRegister(NodeGroupNodesMemoryPressure)
 	prometheus.MustRegister(NodeGroupPods)
+	prometheus.MustRegister(NodeGroupPodsCrashLoopingDiscounted)
 	prometheus.MustRegister(NodeGroupPodsEvicted)
+	prometheus.MustRegister(NodeGroupPartialDeletions)
+	prometheus.MustRegister(NodeGroupPreTerminationWebhookFailures)
+	prometheus.MustRegister(NodeDrainPodsRemaining)
+	prometheus.MustRegister(NodeGroupOrphanNodesDeleted)
+	prometheus.MustRegister(NodeGroupLabelMismatchNodes)
+	prometheus.MustRegister(NodeGroupScaleDownClamped)
+	prometheus.MustRegister(NodeGroupLocalStorageProtectedNodes)
+	prometheus.MustRegister(NodeGroupRolloutDeferredNodes)
+	prometheus.MustRegister(NodeGroupReplicaSpreadProtectedNodes)
+	prometheus.MustRegister(NodeGroupScanBackoff)
+	prometheus.MustRegister(NodeGroupFlapping)
+	prometheus.MustRegister(NodeGroupScaleDownBlocked)
+	prometheus.MustRegister(NodeGroupCapacityUnavailable)
+	prometheus.MustRegister(NodeGroupSaturated)
+	prometheus.MustRegister(NodeGroupMinNodesWasteful)
+	prometheus.MustRegister(NodeGroupEmergencyScaleUps)
+	prometheus.MustRegister(ScaleActions)
+	prometheus.MustRegister(NodeGroupSizeDivergenceSkips)
+	prometheus.MustRegister(NodeGroupFrozen)
 	prometheus.MustRegister(NodeGroupsMemPercent)
 	prometheus.MustRegister(NodeGroupsCPUPercent)
+	prometheus.MustRegister(NodeGroupsMemPercentSmoothed)
+	prometheus.MustRegister(NodeGroupsCPUPercentSmoothed)
+	prometheus.MustRegister(NodeGroupHeadroomPercent)
+	prometheus.MustRegister(NodeGroupQueueLength)
+	prometheus.MustRegister(NodeGroupCronJobPreWarmNodes)
+	prometheus.MustRegister(MetricSourceHealthy)
 	prometheus.MustRegister(NodeGroupCPURequest)
 	prometheus.MustRegister(NodeGroupMemRequest)
 	prometheus.MustRegister(NodeGroupCPUCapacity)
 	prometheus.MustRegister(NodeGroupMemCapacity)
+	prometheus.MustRegister(NodeGroupCPUCapacityEffective)
+	prometheus.MustRegister(NodeGroupMemCapacityEffective)
 	prometheus.MustRegister(NodeGroupTaintEvent)
 	prometheus.MustRegister(NodeGroupUntaintEvent)
 	prometheus.MustRegister(NodeGroupScaleLock)
@@ -254,8 +612,21 @@ func init() {
 	prometheus.MustRegister(CloudProviderSize)
 }
 
-// Start starts the metrics endpoint on a new thread
-func Start(addr string) {
+// Start starts the metrics endpoint on a new thread, served over HTTPS if tlsOpts are enabled
+// returns an error if the TLS certificates can't be loaded
+func Start(addr string, tlsOpts TLSOpts) error {
 	http.Handle("/metrics", promhttp.Handler())
-	go http.ListenAndServe(addr, nil)
+	if !tlsOpts.Enabled() {
+		go http.ListenAndServe(addr, nil)
+		return nil
+	}
+
+	config, err := tlsOpts.tlsConfig()
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Addr: addr, TLSConfig: config}
+	// the certificates are already in the TLS config
+	go server.ListenAndServeTLS("", "")
+	return nil
 }
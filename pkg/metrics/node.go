@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// GranularityNodeGroup only exposes node group level metrics
+	GranularityNodeGroup = "nodegroup"
+	// GranularityNode also exposes node level metrics, with a series for every node
+	GranularityNode = "node"
+)
+
+// Node level metrics have a series for every node, so they are only registered when enabled with RegisterNodeMetrics
+var (
+	// NodeCPUPercent percentage of the cpu allocatable of a node requested by its pods
+	NodeCPUPercent = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_cpu_percent",
+			Namespace: NAMESPACE,
+			Help:      "percentage of the cpu allocatable of a node requested by its pods",
+		},
+		[]string{"node_group", "node"},
+	)
+	// NodeMemPercent percentage of the memory allocatable of a node requested by its pods
+	NodeMemPercent = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_mem_percent",
+			Namespace: NAMESPACE,
+			Help:      "percentage of the memory allocatable of a node requested by its pods",
+		},
+		[]string{"node_group", "node"},
+	)
+	// NodePods pods running on a node, excluding terminated pods
+	NodePods = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_pods",
+			Namespace: NAMESPACE,
+			Help:      "pods running on a node, excluding terminated pods",
+		},
+		[]string{"node_group", "node"},
+	)
+	// NodeInstanceInfo the metadata of the cloud provider instance backing a node, always 1
+	NodeInstanceInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "node_instance_info",
+			Namespace: NAMESPACE,
+			Help:      "the metadata of the cloud provider instance backing a node, always 1",
+		},
+		[]string{"node_group", "node", "instance_type", "availability_zone"},
+	)
+)
+
+var nodeMetrics = []*prometheus.GaugeVec{
+	NodeCPUPercent,
+	NodeMemPercent,
+	NodePods,
+}
+
+// RegisterNodeMetrics registers the node level metrics so they are exposed
+func RegisterNodeMetrics() {
+	for _, metric := range nodeMetrics {
+		prometheus.MustRegister(metric)
+	}
+	prometheus.MustRegister(NodeInstanceInfo)
+}
+
+// DeleteNodeMetrics deletes the node level metrics of a node that is no longer in the node group
+func DeleteNodeMetrics(nodeGroup string, node string) {
+	for _, metric := range nodeMetrics {
+		metric.DeleteLabelValues(nodeGroup, node)
+	}
+}
+
+// DeleteNodeInstanceInfo deletes the instance info metric of a node that is no longer in the node group, or whose
+// instance metadata has changed
+func DeleteNodeInstanceInfo(nodeGroup string, node string, instanceType string, availabilityZone string) {
+	NodeInstanceInfo.DeleteLabelValues(nodeGroup, node, instanceType, availabilityZone)
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	log "github.com/sirupsen/logrus"
+)
+
+// StartPush pushes all registered metrics to the Prometheus Pushgateway at url every interval on a new thread
+// push failures are logged and retried on the next interval. Pushing stops when stopChan is closed or the returned
+// function is called, which also pushes the metrics a final time so the last scan isn't lost on shutdown
+func StartPush(url string, job string, interval time.Duration, stopChan <-chan struct{}) func() {
+	pusher := push.New(url, job).Gatherer(prometheus.DefaultGatherer)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				pushMetrics(pusher, url)
+			case <-stopChan:
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+			pushMetrics(pusher, url)
+		})
+	}
+}
+
+// pushMetrics pushes the metrics once, logging any failure
+func pushMetrics(pusher *push.Pusher, url string) {
+	if err := pusher.Push(); err != nil {
+		log.WithError(err).Warnf("Failed to push metrics to pushgateway %v", url)
+		return
+	}
+	log.Debugf("Pushed metrics to pushgateway %v", url)
+}
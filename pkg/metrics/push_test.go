@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartPush(t *testing.T) {
+	pushed := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushed <- r.Method + " " + r.URL.Path
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	StartPush(server.URL, "escalator", 10*time.Millisecond, stopChan)
+
+	select {
+	case request := <-pushed:
+		assert.True(t, strings.HasPrefix(request, http.MethodPut+" /metrics/job/escalator"), request)
+	case <-time.After(5 * time.Second):
+		t.Fatal("metrics were not pushed")
+	}
+}
+
+func TestStartPushFailure(t *testing.T) {
+	requests := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	StartPush(server.URL, "escalator", 10*time.Millisecond, stopChan)
+
+	// failures are logged and the push is retried on the next interval
+	for i := 0; i < 2; i++ {
+		select {
+		case <-requests:
+		case <-time.After(5 * time.Second):
+			t.Fatal("metrics push was not retried")
+		}
+	}
+}
+
+func TestStartPushFinalPush(t *testing.T) {
+	pushed := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushed <- struct{}{}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	// the interval is too long to push before stopping, and the stop channel is already closed
+	stopChan := make(chan struct{})
+	close(stopChan)
+	stop := StartPush(server.URL, "escalator", time.Hour, stopChan)
+	stop()
+	// stopping again doesn't push again
+	stop()
+
+	assert.Len(t, pushed, 1)
+}
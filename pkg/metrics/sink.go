@@ -0,0 +1,21 @@
+package metrics
+
+const (
+	// SinkPrometheus is the Prometheus metrics served on /metrics. It is always enabled
+	SinkPrometheus = "prometheus"
+	// SinkCloudWatch publishes the scale decisions and utilization of every node group as CloudWatch custom metrics
+	SinkCloudWatch = "cloudwatch"
+)
+
+// Sink receives the scale decisions and utilization of every node group, in addition to the Prometheus metrics
+// values are recorded during a scan and published when the scan finishes
+type Sink interface {
+	// ScaleUp records a scale up of the node group that untainted or added nodes
+	ScaleUp(nodegroup string, nodes int)
+	// ScaleDown records a scale down of the node group that tainted nodes
+	ScaleDown(nodegroup string, nodes int)
+	// Utilization records the cpu and memory utilization percentage of the node group
+	Utilization(nodegroup string, cpuPercent float64, memPercent float64)
+	// Flush publishes the values recorded since the last flush
+	Flush() error
+}
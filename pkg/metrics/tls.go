@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSOpts configures serving the metrics endpoint over HTTPS
+type TLSOpts struct {
+	// CertFile and KeyFile are the PEM files of the serving certificate and its key. Served over HTTP if empty
+	CertFile string
+	KeyFile  string
+	// CAFile is a PEM file of the certificate authorities client certificates must be signed by. Client certificates
+	// are not required if empty
+	CAFile string
+}
+
+// Enabled returns whether the metrics endpoint is served over HTTPS
+func (o TLSOpts) Enabled() bool {
+	return len(o.CertFile) > 0 || len(o.KeyFile) > 0
+}
+
+// tlsConfig loads the certificates of the options into a TLS config
+// returns an error if the certificate or key is missing, or any of the files can't be loaded
+func (o TLSOpts) tlsConfig() (*tls.Config, error) {
+	if len(o.CertFile) == 0 || len(o.KeyFile) == 0 {
+		return nil, errors.New("both the tls cert file and key file must be set")
+	}
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tls cert file %v and key file %v: %v", o.CertFile, o.KeyFile, err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if len(o.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls ca file %v: %v", o.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tls ca file %v", o.CAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
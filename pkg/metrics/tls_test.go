@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a certificate and its key, signed by parent or self signed if parent is nil
+type testCert struct {
+	cert *x509.Certificate
+	der  []byte
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, der: der, key: key}
+}
+
+// write writes the certificate and key as PEM files into dir, returning their paths
+func (c *testCert) write(t *testing.T, dir string, name string) (string, string) {
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600))
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestTLSOptsTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "escalator-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "ca", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := newTestCert(t, "escalator", ca).write(t, dir, "escalator")
+	notPEM := filepath.Join(dir, "not.pem")
+	require.NoError(t, ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600))
+
+	assert.False(t, TLSOpts{}.Enabled())
+	assert.True(t, TLSOpts{CertFile: certFile}.Enabled())
+
+	tests := []struct {
+		name    string
+		opts    TLSOpts
+		mTLS    bool
+		wantErr bool
+	}{
+		{"cert and key", TLSOpts{CertFile: certFile, KeyFile: keyFile}, false, false},
+		{"client certificates", TLSOpts{CertFile: certFile, KeyFile: keyFile, CAFile: caFile}, true, false},
+		{"missing key", TLSOpts{CertFile: certFile}, false, true},
+		{"missing cert file", TLSOpts{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile}, false, true},
+		{"missing ca file", TLSOpts{CertFile: certFile, KeyFile: keyFile, CAFile: filepath.Join(dir, "missing.crt")}, false, true},
+		{"ca file without certificates", TLSOpts{CertFile: certFile, KeyFile: keyFile, CAFile: notPEM}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := tt.opts.tlsConfig()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, config.Certificates, 1)
+			assert.Equal(t, tt.mTLS, config.ClientAuth == tls.RequireAndVerifyClientCert)
+		})
+	}
+}
+
+func TestTLSOptsClientCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "escalator-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "ca", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := newTestCert(t, "escalator", ca).write(t, dir, "escalator")
+	config, err := TLSOpts{CertFile: certFile, KeyFile: keyFile, CAFile: caFile}.tlsConfig()
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certificates ...tls.Certificate) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: certificates,
+		}}}
+		resp, err := client.Get(server.URL + "/metrics")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// clients must present a certificate signed by the ca
+	assert.NoError(t, get(newTestCert(t, "prometheus", ca).tlsCertificate()))
+	assert.Error(t, get())
+	assert.Error(t, get(newTestCert(t, "untrusted", newTestCert(t, "other-ca", nil)).tlsCertificate()))
+}
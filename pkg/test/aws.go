@@ -1,11 +1,16 @@
 package test
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
 )
 
 type MockAutoscalingService struct {
@@ -20,6 +25,13 @@ type MockAutoscalingService struct {
 
 	TerminateInstanceInAutoScalingGroupOutput *autoscaling.TerminateInstanceInAutoScalingGroupOutput
 	TerminateInstanceInAutoScalingGroupErr    error
+	// TerminateInstanceInAutoScalingGroupErrs are the errors terminating the instances with the IDs, in place of
+	// TerminateInstanceInAutoScalingGroupErr
+	TerminateInstanceInAutoScalingGroupErrs map[string]error
+
+	// SetInstanceProtectionInputs records the inputs of every SetInstanceProtection call
+	SetInstanceProtectionInputs []*autoscaling.SetInstanceProtectionInput
+	SetInstanceProtectionErr    error
 }
 
 func (m MockAutoscalingService) DescribeAutoScalingGroups(*autoscaling.DescribeAutoScalingGroupsInput) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
@@ -30,10 +42,18 @@ func (m MockAutoscalingService) SetDesiredCapacity(*autoscaling.SetDesiredCapaci
 	return m.SetDesiredCapacityOutput, m.SetDesiredCapacityErr
 }
 
-func (m MockAutoscalingService) TerminateInstanceInAutoScalingGroup(*autoscaling.TerminateInstanceInAutoScalingGroupInput) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error) {
+func (m MockAutoscalingService) TerminateInstanceInAutoScalingGroup(input *autoscaling.TerminateInstanceInAutoScalingGroupInput) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error) {
+	if err, ok := m.TerminateInstanceInAutoScalingGroupErrs[aws.StringValue(input.InstanceId)]; ok {
+		return nil, err
+	}
 	return m.TerminateInstanceInAutoScalingGroupOutput, m.TerminateInstanceInAutoScalingGroupErr
 }
 
+func (m *MockAutoscalingService) SetInstanceProtection(input *autoscaling.SetInstanceProtectionInput) (*autoscaling.SetInstanceProtectionOutput, error) {
+	m.SetInstanceProtectionInputs = append(m.SetInstanceProtectionInputs, input)
+	return &autoscaling.SetInstanceProtectionOutput{}, m.SetInstanceProtectionErr
+}
+
 type MockEc2Service struct {
 	ec2iface.EC2API
 	*client.Client
@@ -45,3 +65,29 @@ type MockEc2Service struct {
 func (m MockEc2Service) DescribeInstances(*ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
 	return m.DescribeInstancesOutput, m.DescribeInstancesErr
 }
+
+type MockSQSService struct {
+	sqsiface.SQSAPI
+	*client.Client
+
+	GetQueueAttributesOutput *sqs.GetQueueAttributesOutput
+	GetQueueAttributesErr    error
+}
+
+func (m MockSQSService) GetQueueAttributes(*sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error) {
+	return m.GetQueueAttributesOutput, m.GetQueueAttributesErr
+}
+
+type MockCloudWatchService struct {
+	cloudwatchiface.CloudWatchAPI
+	*client.Client
+
+	PutMetricDataInputs []*cloudwatch.PutMetricDataInput
+	PutMetricDataOutput *cloudwatch.PutMetricDataOutput
+	PutMetricDataErr    error
+}
+
+func (m *MockCloudWatchService) PutMetricData(input *cloudwatch.PutMetricDataInput) (*cloudwatch.PutMetricDataOutput, error) {
+	m.PutMetricDataInputs = append(m.PutMetricDataInputs, input)
+	return m.PutMetricDataOutput, m.PutMetricDataErr
+}
@@ -9,6 +9,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
 	core "k8s.io/client-go/testing"
 )
@@ -128,6 +129,12 @@ func BuildTestNode(opts NodeOpts) *apiv1.Node {
 			Capacity: apiv1.ResourceList{
 				apiv1.ResourcePods: *resource.NewQuantity(100, resource.DecimalSI),
 			},
+			Conditions: []apiv1.NodeCondition{
+				{
+					Type:   apiv1.NodeReady,
+					Status: apiv1.ConditionTrue,
+				},
+			},
 		},
 	}
 
@@ -168,6 +175,7 @@ type PodOpts struct {
 	NodeAffinityKey   string
 	NodeAffinityValue string
 	NodeName          string
+	Phase             apiv1.PodPhase
 }
 
 // BuildTestPod builds a pod for testing
@@ -204,7 +212,8 @@ func BuildTestPod(opts PodOpts) *apiv1.Pod {
 						0: {
 							MatchExpressions: []apiv1.NodeSelectorRequirement{
 								{
-									Key: opts.NodeAffinityKey,
+									Key:      opts.NodeAffinityKey,
+									Operator: apiv1.NodeSelectorOpIn,
 									Values: []string{
 										0: opts.NodeAffinityValue,
 									},
@@ -221,6 +230,7 @@ func BuildTestPod(opts PodOpts) *apiv1.Pod {
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace:       opts.Namespace,
 			Name:            opts.Name,
+			UID:             types.UID(fmt.Sprintf("%s/%s", opts.Namespace, opts.Name)),
 			SelfLink:        fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", opts.Namespace, opts.Name),
 			OwnerReferences: owners,
 		},
@@ -235,6 +245,10 @@ func BuildTestPod(opts PodOpts) *apiv1.Pod {
 		pod.Spec.NodeName = opts.NodeName
 	}
 
+	if len(opts.Phase) > 0 {
+		pod.Status.Phase = opts.Phase
+	}
+
 	for i := range containers {
 		if opts.CPU[i] >= 0 {
 			pod.Spec.Containers[i].Resources.Requests[apiv1.ResourceCPU] = *resource.NewMilliQuantity(opts.CPU[i], resource.DecimalSI)
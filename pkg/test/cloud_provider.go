@@ -1,6 +1,7 @@
 package test
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/atlassian/escalator/pkg/cloudprovider"
@@ -11,12 +12,14 @@ const ProviderName = "test"
 
 // cloudProvider implements the CloudProvider interface
 type CloudProvider struct {
-	nodeGroups map[string]*NodeGroup
+	nodeGroups   map[string]*NodeGroup
+	tags         map[string]map[string]string
+	queueLengths map[string]int64
 }
 
 func NewCloudProvider(nodeGroupSize int) *CloudProvider {
 	nodeGroups := make(map[string]*NodeGroup, nodeGroupSize)
-	return &CloudProvider{nodeGroups}
+	return &CloudProvider{nodeGroups, make(map[string]map[string]string), make(map[string]int64)}
 }
 
 func (c *CloudProvider) Name() string {
@@ -49,6 +52,41 @@ func (c *CloudProvider) RegisterNodeGroup(nodeGroup *NodeGroup) {
 	c.nodeGroups[nodeGroup.id] = nodeGroup
 }
 
+// RegisterNodeGroupWithTags registers the node group so it can be found by DiscoverNodeGroups
+func (c *CloudProvider) RegisterNodeGroupWithTags(nodeGroup *NodeGroup, tags map[string]string) {
+	c.nodeGroups[nodeGroup.id] = nodeGroup
+	c.tags[nodeGroup.id] = tags
+}
+
+// UnregisterNodeGroup removes the node group, as if it was deleted from the cloud provider
+func (c *CloudProvider) UnregisterNodeGroup(id string) {
+	delete(c.nodeGroups, id)
+	delete(c.tags, id)
+}
+
+func (c *CloudProvider) DiscoverNodeGroups(tags map[string]string) ([]cloudprovider.DiscoveredNodeGroup, error) {
+	var discovered []cloudprovider.DiscoveredNodeGroup
+	for id, nodeGroupTags := range c.tags {
+		if cloudprovider.HasTags(nodeGroupTags, tags) {
+			discovered = append(discovered, cloudprovider.DiscoveredNodeGroup{ID: id, Tags: nodeGroupTags})
+		}
+	}
+	return discovered, nil
+}
+
+// SetQueueLength sets the length returned by QueueLength for the queue
+func (c *CloudProvider) SetQueueLength(queueURL string, length int64) {
+	c.queueLengths[queueURL] = length
+}
+
+func (c *CloudProvider) QueueLength(queueURL string) (int64, error) {
+	length, ok := c.queueLengths[queueURL]
+	if !ok {
+		return 0, fmt.Errorf("queue %v does not exist", queueURL)
+	}
+	return length, nil
+}
+
 func (c *CloudProvider) GetInstance(node *v1.Node) (cloudprovider.Instance, error) {
 	return Instance{}, nil
 }
@@ -71,15 +109,22 @@ type NodeGroup struct {
 	maxSize    int64
 	actualSize int64
 	targetSize int64
+	metadata   map[string]cloudprovider.InstanceMetadata
+	// deleteFailures are the errors returned when deleting the nodes with the names
+	deleteFailures map[string]error
+	// increaseFailure is the error returned when increasing the size, nil if it succeeds
+	increaseFailure error
+	// notOwned are the names of the nodes that don't belong to the node group, every other node does
+	notOwned map[string]bool
 }
 
 func NewNodeGroup(id string, minSize int64, maxSize int64, targetSize int64) *NodeGroup {
 	return &NodeGroup{
-		id,
-		minSize,
-		maxSize,
-		targetSize,
-		targetSize,
+		id:         id,
+		minSize:    minSize,
+		maxSize:    maxSize,
+		actualSize: targetSize,
+		targetSize: targetSize,
 	}
 }
 
@@ -107,21 +152,64 @@ func (n *NodeGroup) Size() int64 {
 	return n.actualSize
 }
 
+// SetActualSize sets the size of the node group without changing the target size, e.g. to simulate a capacity shortage
+func (n *NodeGroup) SetActualSize(size int64) {
+	n.actualSize = size
+}
+
 func (n *NodeGroup) IncreaseSize(delta int64) error {
+	if n.increaseFailure != nil {
+		return n.increaseFailure
+	}
 	return n.setDesiredSize(n.targetSize + delta)
 }
 
+// SetIncreaseFailure makes increasing the size fail with the error, a nil error increases the size again
+func (n *NodeGroup) SetIncreaseFailure(err error) {
+	n.increaseFailure = err
+}
+
+// SetDeleteFailure makes deleting the node with the name fail with the error, the other nodes are still deleted
+// a nil error deletes the node again
+func (n *NodeGroup) SetDeleteFailure(node string, err error) {
+	if n.deleteFailures == nil {
+		n.deleteFailures = make(map[string]error)
+	}
+	n.deleteFailures[node] = err
+}
+
 func (n *NodeGroup) DeleteNodes(nodes ...*v1.Node) error {
-	for range nodes {
+	var deleted, failed []*v1.Node
+	var deleteErr error
+	for _, node := range nodes {
+		if err := n.deleteFailures[node.Name]; err != nil {
+			failed = append(failed, node)
+			deleteErr = err
+			continue
+		}
 		// Here we would normally tell the actual provider (AWS etc.) to terminate the instance and also decrement the
 		// desired capacity, but we just decrement the internal size to reflect the remote change
 		n.setDesiredSize(n.targetSize - 1)
+		deleted = append(deleted, node)
+	}
+	if deleteErr != nil && len(deleted) > 0 {
+		return &cloudprovider.PartialDeletionError{Deleted: deleted, Failed: failed, Err: deleteErr}
+	}
+	return deleteErr
+}
+
+// SetNotOwned makes the nodes with the names not belong to the node group
+func (n *NodeGroup) SetNotOwned(nodes ...string) {
+	if n.notOwned == nil {
+		n.notOwned = make(map[string]bool)
+	}
+	for _, node := range nodes {
+		n.notOwned[node] = true
 	}
-	return nil
 }
 
 func (n *NodeGroup) Belongs(node *v1.Node) bool {
-	return false
+	return !n.notOwned[node.Name]
 }
 
 func (n *NodeGroup) DecreaseTargetSize(delta int64) error {
@@ -132,6 +220,19 @@ func (n *NodeGroup) Nodes() []string {
 	return nil
 }
 
+// SetInstanceMetadata sets the instance metadata returned for the node with the name
+func (n *NodeGroup) SetInstanceMetadata(node string, metadata cloudprovider.InstanceMetadata) {
+	if n.metadata == nil {
+		n.metadata = make(map[string]cloudprovider.InstanceMetadata)
+	}
+	n.metadata[node] = metadata
+}
+
+func (n *NodeGroup) InstanceMetadata(node *v1.Node) (cloudprovider.InstanceMetadata, bool) {
+	metadata, ok := n.metadata[node.Name]
+	return metadata, ok
+}
+
 func (n *NodeGroup) setDesiredSize(newSize int64) error {
 	// This is where we would tell the actual provider (AWS etc.) to change the scaling group desired size
 	// but we just update the internal target size of the node group to reflect the remote change
@@ -0,0 +1,74 @@
+package test
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	"k8s.io/api/core/v1"
+	appsv1lister "k8s.io/client-go/listers/apps/v1"
+	batchv1beta1lister "k8s.io/client-go/listers/batch/v1beta1"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newIndexer returns an indexer of the objects by namespace and name, the store of a cached lister
+func newIndexer(objects ...interface{}) cache.Indexer {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, object := range objects {
+		indexer.Add(object)
+	}
+	return indexer
+}
+
+// NewTestCronJobLister creates a CronJob lister of the CronJobs
+func NewTestCronJobLister(cronJobs ...*batchv1beta1.CronJob) batchv1beta1lister.CronJobLister {
+	objects := make([]interface{}, 0, len(cronJobs))
+	for _, cronJob := range cronJobs {
+		objects = append(objects, cronJob)
+	}
+	return batchv1beta1lister.NewCronJobLister(newIndexer(objects...))
+}
+
+// NewTestPersistentVolumeClaimLister creates a persistent volume claim lister of the claims
+func NewTestPersistentVolumeClaimLister(claims ...*v1.PersistentVolumeClaim) v1lister.PersistentVolumeClaimLister {
+	objects := make([]interface{}, 0, len(claims))
+	for _, claim := range claims {
+		objects = append(objects, claim)
+	}
+	return v1lister.NewPersistentVolumeClaimLister(newIndexer(objects...))
+}
+
+// NewTestPersistentVolumeLister creates a persistent volume lister of the volumes
+func NewTestPersistentVolumeLister(volumes ...*v1.PersistentVolume) v1lister.PersistentVolumeLister {
+	objects := make([]interface{}, 0, len(volumes))
+	for _, volume := range volumes {
+		objects = append(objects, volume)
+	}
+	return v1lister.NewPersistentVolumeLister(newIndexer(objects...))
+}
+
+// NewTestReplicaSetLister creates a ReplicaSet lister of the ReplicaSets
+func NewTestReplicaSetLister(replicaSets ...*appsv1.ReplicaSet) appsv1lister.ReplicaSetLister {
+	objects := make([]interface{}, 0, len(replicaSets))
+	for _, replicaSet := range replicaSets {
+		objects = append(objects, replicaSet)
+	}
+	return appsv1lister.NewReplicaSetLister(newIndexer(objects...))
+}
+
+// NewTestDeploymentLister creates a Deployment lister of the Deployments
+func NewTestDeploymentLister(deployments ...*appsv1.Deployment) appsv1lister.DeploymentLister {
+	objects := make([]interface{}, 0, len(deployments))
+	for _, deployment := range deployments {
+		objects = append(objects, deployment)
+	}
+	return appsv1lister.NewDeploymentLister(newIndexer(objects...))
+}
+
+// NewTestStatefulSetLister creates a StatefulSet lister of the StatefulSets
+func NewTestStatefulSetLister(statefulSets ...*appsv1.StatefulSet) appsv1lister.StatefulSetLister {
+	objects := make([]interface{}, 0, len(statefulSets))
+	for _, statefulSet := range statefulSets {
+		objects = append(objects, statefulSet)
+	}
+	return appsv1lister.NewStatefulSetLister(newIndexer(objects...))
+}
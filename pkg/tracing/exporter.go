@@ -0,0 +1,406 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	duration "time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultEndpoint is the OTLP/HTTP traces endpoint of a collector on the same host
+	defaultEndpoint = "http://localhost:4318/v1/traces"
+	// defaultTimeout is how long an export can take before it is abandoned
+	defaultTimeout = 10 * duration.Second
+	// defaultServiceName is the service.name resource attribute if OTEL_SERVICE_NAME isn't set
+	defaultServiceName = "escalator"
+	// exportInterval is how often the finished spans are exported, the default OTEL_BSP_SCHEDULE_DELAY
+	exportInterval = 5 * duration.Second
+	// maxBatchSize is the most spans exported in one request, the default OTEL_BSP_MAX_EXPORT_BATCH_SIZE
+	maxBatchSize = 512
+	// maxQueueSize is the most finished spans waiting to be exported, further spans are dropped. The default
+	// OTEL_BSP_MAX_QUEUE_SIZE
+	maxQueueSize = 2048
+	// protocolJSON is the only OTLP protocol supported, OTLP/HTTP with JSON encoded bodies
+	protocolJSON = "http/json"
+)
+
+// getenv is how the exporter reads its environment variables
+var getenv = os.Getenv
+
+// config is the exporter configuration read from the standard OpenTelemetry environment variables
+type config struct {
+	endpoint string
+	headers  map[string]string
+	timeout  duration.Duration
+	resource []Attribute
+}
+
+// configFromEnv reads the exporter configuration. The traces specific variables, e.g.
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, take precedence over the general ones, e.g. OTEL_EXPORTER_OTLP_ENDPOINT, which
+// the /v1/traces path is appended to. Only the http/json protocol is supported, any other protocol is an error so
+// that tracing fails to start rather than exporting in an encoding the collector doesn't expect
+func configFromEnv(getenv func(string) string) (config, error) {
+	c := config{endpoint: defaultEndpoint, timeout: defaultTimeout, headers: map[string]string{}}
+
+	protocol := firstEnv(getenv, "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL")
+	if len(protocol) > 0 && protocol != protocolJSON {
+		return c, fmt.Errorf("OTLP protocol %q isn't supported, only %v is supported", protocol, protocolJSON)
+	}
+
+	if endpoint := getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); len(endpoint) > 0 {
+		c.endpoint = endpoint
+	} else if endpoint := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); len(endpoint) > 0 {
+		c.endpoint = strings.TrimRight(endpoint, "/") + "/v1/traces"
+	}
+	if parsed, err := url.Parse(c.endpoint); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+		return c, fmt.Errorf("OTLP endpoint %q must be a http or https URL", c.endpoint)
+	}
+
+	for _, variable := range []string{"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TRACES_HEADERS"} {
+		headers, err := parseKeyValues(getenv(variable))
+		if err != nil {
+			return c, fmt.Errorf("failed to parse %v: %v", variable, err)
+		}
+		for key, value := range headers {
+			c.headers[key] = value
+		}
+	}
+
+	if timeout := firstEnv(getenv, "OTEL_EXPORTER_OTLP_TRACES_TIMEOUT", "OTEL_EXPORTER_OTLP_TIMEOUT"); len(timeout) > 0 {
+		milliseconds, err := strconv.Atoi(timeout)
+		if err != nil || milliseconds <= 0 {
+			return c, fmt.Errorf("OTLP timeout %q must be a positive number of milliseconds", timeout)
+		}
+		c.timeout = duration.Duration(milliseconds) * duration.Millisecond
+	}
+
+	resource, err := parseKeyValues(getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return c, fmt.Errorf("failed to parse OTEL_RESOURCE_ATTRIBUTES: %v", err)
+	}
+	if name := getenv("OTEL_SERVICE_NAME"); len(name) > 0 {
+		resource["service.name"] = name
+	} else if _, ok := resource["service.name"]; !ok {
+		resource["service.name"] = defaultServiceName
+	}
+	resource["telemetry.sdk.name"] = TracerName
+	resource["telemetry.sdk.language"] = "go"
+	for _, key := range sortedKeys(resource) {
+		c.resource = append(c.resource, String(key, resource[key]))
+	}
+	return c, nil
+}
+
+// firstEnv returns the value of the first of the variables that is set
+func firstEnv(getenv func(string) string, variables ...string) string {
+	for _, variable := range variables {
+		if value := getenv(variable); len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseKeyValues parses a comma separated list of key=value pairs with URL encoded values, the format of
+// OTEL_EXPORTER_OTLP_HEADERS and OTEL_RESOURCE_ATTRIBUTES
+func parseKeyValues(list string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(list, ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || len(key) == 0 {
+			return nil, fmt.Errorf("%q isn't a key=value pair", pair)
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("value of %v isn't URL encoded: %v", key, err)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// exporter batches finished spans and exports them to the OTLP/HTTP endpoint in the background
+type exporter struct {
+	config config
+	client *http.Client
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+
+	flush   chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// newExporter starts an exporter that exports every exportInterval, or as soon as a full batch is waiting
+func newExporter(c config) *exporter {
+	e := &exporter{
+		config:  c,
+		client:  &http.Client{Timeout: c.timeout},
+		flush:   make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// enqueue queues a finished span to be exported, dropping it if the queue is full
+func (e *exporter) enqueue(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queue) >= maxQueueSize {
+		e.dropped++
+		return
+	}
+	e.queue = append(e.queue, span)
+	if len(e.queue) >= maxBatchSize {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run exports the queued spans until the exporter is shut down
+func (e *exporter) run() {
+	defer close(e.stopped)
+	ticker := duration.NewTicker(exportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.flush:
+		case <-e.stop:
+			return
+		}
+		e.exportQueued(context.Background())
+	}
+}
+
+// shutdown stops the background exports and exports the remaining spans, giving up once the context is done
+func (e *exporter) shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.stop) })
+	select {
+	case <-e.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return e.exportQueued(ctx)
+}
+
+// exportQueued exports the queued spans in batches of at most maxBatchSize. A failed batch is logged and dropped,
+// the same as the OpenTelemetry batch span processor
+func (e *exporter) exportQueued(ctx context.Context) error {
+	e.mu.Lock()
+	spans := e.queue
+	dropped := e.dropped
+	e.queue = nil
+	e.dropped = 0
+	e.mu.Unlock()
+	if dropped > 0 {
+		log.Warningf("Dropped %v spans as the tracing export queue was full", dropped)
+	}
+
+	var lastErr error
+	for len(spans) > 0 {
+		batch := spans
+		if len(batch) > maxBatchSize {
+			batch = batch[:maxBatchSize]
+		}
+		spans = spans[len(batch):]
+		if err := e.export(ctx, batch); err != nil {
+			log.WithError(err).Warningf("Failed to export %v spans", len(batch))
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// export sends a batch of spans to the endpoint as an OTLP ExportTraceServiceRequest
+func (e *exporter) export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.config.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.config.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("OTLP endpoint %v responded with %v", e.config.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// The OTLP/JSON encoding of an ExportTraceServiceRequest, see
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+// Ids are hex encoded and 64 bit integers are strings
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+const (
+	// otlpSpanKindInternal is SPAN_KIND_INTERNAL, every escalator span is an internal operation of a scan
+	otlpSpanKindInternal = 1
+	// otlpStatusCodeError is STATUS_CODE_ERROR
+	otlpStatusCodeError = 2
+)
+
+// request returns the export request of the spans
+func (e *exporter) request(spans []*Span) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		encoded = append(encoded, encodeSpan(span))
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: encodeAttributes(e.config.resource)},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: TracerName}, Spans: encoded}},
+	}}}
+}
+
+// encodeSpan returns the OTLP/JSON encoding of a finished span. An error is recorded as the span's status and as an
+// exception event
+func encodeSpan(span *Span) otlpSpan {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	encoded := otlpSpan{
+		TraceID:           hex.EncodeToString(span.traceID[:]),
+		SpanID:            hex.EncodeToString(span.spanID[:]),
+		Name:              span.name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+		Attributes:        encodeAttributes(span.attributes),
+	}
+	if span.parentID != [8]byte{} {
+		encoded.ParentSpanID = hex.EncodeToString(span.parentID[:])
+	}
+	if span.err != nil {
+		encoded.Status = otlpStatus{Code: otlpStatusCodeError, Message: span.err.Error()}
+		encoded.Events = []otlpEvent{{
+			TimeUnixNano: encoded.EndTimeUnixNano,
+			Name:         "exception",
+			Attributes:   encodeAttributes([]Attribute{String("exception.message", span.err.Error())}),
+		}}
+	}
+	return encoded
+}
+
+// encodeAttributes returns the OTLP/JSON encoding of the attributes, values of unsupported types are formatted as
+// strings
+func encodeAttributes(attributes []Attribute) []otlpKeyValue {
+	encoded := make([]otlpKeyValue, 0, len(attributes))
+	for _, attribute := range attributes {
+		var value otlpValue
+		switch v := attribute.Value.(type) {
+		case bool:
+			value.BoolValue = &v
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case string:
+			value.StringValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		encoded = append(encoded, otlpKeyValue{Key: attribute.Key, Value: value})
+	}
+	return encoded
+}
+
+// sortedKeys returns the keys of the map in order, so the resource attributes are always encoded the same way
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	duration "time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    config
+		wantErr bool
+	}{
+		{
+			"defaults",
+			map[string]string{},
+			config{
+				endpoint: defaultEndpoint,
+				headers:  map[string]string{},
+				timeout:  defaultTimeout,
+				resource: []Attribute{
+					String("service.name", defaultServiceName),
+					String("telemetry.sdk.language", "go"),
+					String("telemetry.sdk.name", TracerName),
+				},
+			},
+			false,
+		},
+		{
+			"general variables",
+			map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "https://collector:4318/",
+				"OTEL_EXPORTER_OTLP_HEADERS":  "api-key=secret, x-tenant = team%2Fa",
+				"OTEL_EXPORTER_OTLP_TIMEOUT":  "2500",
+				"OTEL_EXPORTER_OTLP_PROTOCOL": "http/json",
+				"OTEL_RESOURCE_ATTRIBUTES":    "service.name=from-resource,deployment.environment=prod",
+			},
+			config{
+				endpoint: "https://collector:4318/v1/traces",
+				headers:  map[string]string{"api-key": "secret", "x-tenant": "team/a"},
+				timeout:  2500 * duration.Millisecond,
+				resource: []Attribute{
+					String("deployment.environment", "prod"),
+					String("service.name", "from-resource"),
+					String("telemetry.sdk.language", "go"),
+					String("telemetry.sdk.name", TracerName),
+				},
+			},
+			false,
+		},
+		{
+			"traces variables take precedence",
+			map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":        "https://collector:4318",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://traces:4318/custom",
+				"OTEL_EXPORTER_OTLP_HEADERS":         "api-key=general,x-general=1",
+				"OTEL_EXPORTER_OTLP_TRACES_HEADERS":  "api-key=traces",
+				"OTEL_EXPORTER_OTLP_TIMEOUT":         "2500",
+				"OTEL_EXPORTER_OTLP_TRACES_TIMEOUT":  "500",
+				"OTEL_SERVICE_NAME":                  "escalator-prod",
+				"OTEL_RESOURCE_ATTRIBUTES":           "service.name=from-resource",
+			},
+			config{
+				endpoint: "http://traces:4318/custom",
+				headers:  map[string]string{"api-key": "traces", "x-general": "1"},
+				timeout:  500 * duration.Millisecond,
+				resource: []Attribute{
+					String("service.name", "escalator-prod"),
+					String("telemetry.sdk.language", "go"),
+					String("telemetry.sdk.name", TracerName),
+				},
+			},
+			false,
+		},
+		{"unsupported protocol", map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf"}, config{}, true},
+		{"unsupported traces protocol", map[string]string{"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "grpc"}, config{}, true},
+		{"endpoint without scheme", map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "collector:4318"}, config{}, true},
+		{"invalid headers", map[string]string{"OTEL_EXPORTER_OTLP_HEADERS": "api-key"}, config{}, true},
+		{"invalid header encoding", map[string]string{"OTEL_EXPORTER_OTLP_HEADERS": "api-key=%zz"}, config{}, true},
+		{"invalid timeout", map[string]string{"OTEL_EXPORTER_OTLP_TIMEOUT": "10s"}, config{}, true},
+		{"negative timeout", map[string]string{"OTEL_EXPORTER_OTLP_TIMEOUT": "-1"}, config{}, true},
+		{"invalid resource attributes", map[string]string{"OTEL_RESOURCE_ATTRIBUTES": "=value"}, config{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := configFromEnv(func(key string) string { return tt.env[key] })
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExporterBatches(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	e := newExporter(config{endpoint: server.URL, timeout: defaultTimeout})
+	for i := 0; i < maxQueueSize+10; i++ {
+		e.enqueue(&Span{exporter: e, name: "span"})
+	}
+	require.NoError(t, e.shutdown(context.Background()))
+
+	// the spans over the queue size are dropped and the rest are exported in batches of at most maxBatchSize
+	assert.Len(t, c.spans(), maxQueueSize)
+	for _, request := range c.requests {
+		assert.True(t, len(request.ResourceSpans[0].ScopeSpans[0].Spans) <= maxBatchSize)
+	}
+	// shutting down again has nothing left to export
+	assert.NoError(t, e.shutdown(context.Background()))
+}
+
+func TestExporterErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	e := newExporter(config{endpoint: server.URL, timeout: defaultTimeout})
+	e.enqueue(&Span{exporter: e, name: "span"})
+	assert.Error(t, e.shutdown(context.Background()))
+}
+
+func TestExporterShutdownContextDone(t *testing.T) {
+	e := &exporter{stop: make(chan struct{}), stopped: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, e.shutdown(ctx))
+}
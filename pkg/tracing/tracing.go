@@ -0,0 +1,169 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	duration "time"
+
+	time "github.com/stephanos/clock"
+)
+
+// TracerName is the instrumentation scope of all escalator spans
+const TracerName = "github.com/atlassian/escalator"
+
+// Attribute is a key and value recorded on a span. The value is a string, bool, int or int64
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key string, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an int attribute
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+// Int64 returns an int64 attribute
+func Int64(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a bool attribute
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is a timed operation of a trace. A nil span is a no-op, which is what StartSpan returns whilst tracing isn't
+// started, so callers never need to check whether tracing is enabled
+type Span struct {
+	exporter *exporter
+	name     string
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	start    duration.Time
+
+	mu         sync.Mutex
+	attributes []Attribute
+	end        duration.Time
+	err        error
+	ended      bool
+}
+
+// SetAttributes records attributes on the span, replacing any earlier value of the same key
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attribute := range attributes {
+		replaced := false
+		for i := range s.attributes {
+			if s.attributes[i].Key == attribute.Key {
+				s.attributes[i] = attribute
+				replaced = true
+			}
+		}
+		if !replaced {
+			s.attributes = append(s.attributes, attribute)
+		}
+	}
+}
+
+// spanKey is the context key of the span a context carries
+type spanKey struct{}
+
+// active is the exporter spans are sent to, nil until Start is called
+var active struct {
+	sync.RWMutex
+	exporter *exporter
+}
+
+// Start exports spans over OTLP/HTTP until the returned function is called, which flushes the remaining spans. The
+// exporter is configured through the standard OTEL_EXPORTER_OTLP_* and OTEL_SERVICE_NAME environment variables.
+// If Start is never called, all spans are no-ops
+func Start(ctx context.Context) (func(context.Context) error, error) {
+	config, err := configFromEnv(getenv)
+	if err != nil {
+		return nil, err
+	}
+	e := newExporter(config)
+	active.Lock()
+	active.exporter = e
+	active.Unlock()
+	return func(ctx context.Context) error {
+		active.Lock()
+		if active.exporter == e {
+			active.exporter = nil
+		}
+		active.Unlock()
+		return e.shutdown(ctx)
+	}, nil
+}
+
+// StartSpan starts a span, a child of the span carried by the context if there is one. A nil context is treated as
+// context.Background(). The span is nil, a no-op, whilst tracing isn't started
+func StartSpan(ctx context.Context, name string, attributes ...Attribute) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	active.RLock()
+	e := active.exporter
+	active.RUnlock()
+	if e == nil {
+		return ctx, nil
+	}
+
+	span := &Span{exporter: e, name: name, start: time.Now()}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+	} else {
+		randomID(span.traceID[:])
+	}
+	randomID(span.spanID[:])
+	span.SetAttributes(attributes...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// EndSpan records the error on the span, if any, and ends it. Ending a span more than once has no effect
+func EndSpan(span *Span, err error) {
+	if span == nil {
+		return
+	}
+	span.mu.Lock()
+	if span.ended {
+		span.mu.Unlock()
+		return
+	}
+	span.ended = true
+	span.end = time.Now()
+	span.err = err
+	span.mu.Unlock()
+	span.exporter.enqueue(span)
+}
+
+// randomID fills the id with random bytes. A trace or span id that is all zeros is invalid, so it is never returned
+func randomID(id []byte) {
+	for {
+		if _, err := rand.Read(id); err != nil {
+			// crypto/rand only fails if the system has no source of randomness, fall back to the time so ids are
+			// still set
+			now := time.Now().UnixNano()
+			for i := range id {
+				id[i] = byte(now >> uint(8*(i%8)))
+			}
+		}
+		for _, b := range id {
+			if b != 0 {
+				return
+			}
+		}
+	}
+}
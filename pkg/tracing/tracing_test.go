@@ -0,0 +1,158 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collector is an OTLP/HTTP endpoint that records the export requests it receives
+type collector struct {
+	mu       sync.Mutex
+	requests []otlpRequest
+	headers  []http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var request otlpRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, request)
+	c.headers = append(c.headers, r.Header)
+}
+
+// spans returns every span received, in the order they were exported
+func (c *collector) spans() []otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var spans []otlpSpan
+	for _, request := range c.requests {
+		for _, resourceSpans := range request.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				spans = append(spans, scopeSpans.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+// withEnv replaces the environment variables the exporter reads until the returned function is called
+func withEnv(env map[string]string) func() {
+	original := getenv
+	getenv = func(key string) string { return env[key] }
+	return func() { getenv = original }
+}
+
+func attributeValue(attributes []otlpKeyValue, key string) *otlpValue {
+	for _, attribute := range attributes {
+		if attribute.Key == key {
+			value := attribute.Value
+			return &value
+		}
+	}
+	return nil
+}
+
+func TestStartSpanNotStarted(t *testing.T) {
+	ctx, span := StartSpan(context.Background(), "NotStarted", String("nodegroup", "default"))
+	assert.Nil(t, span)
+	assert.NotNil(t, ctx)
+
+	// a nil span is a no-op
+	span.SetAttributes(String("decision", "scale_up"))
+	EndSpan(span, errors.New("failed"))
+
+	_, span = StartSpan(nil, "NilContext")
+	assert.Nil(t, span)
+}
+
+func TestStartExportsSpans(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+	defer withEnv(map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": server.URL,
+		"OTEL_EXPORTER_OTLP_HEADERS":  "authorization=Bearer%20token",
+		"OTEL_SERVICE_NAME":           "escalator-test",
+	})()
+
+	shutdown, err := Start(context.Background())
+	require.NoError(t, err)
+
+	ctx, parent := StartSpan(context.Background(), "ScaleNodeGroup", String("nodegroup", "default"))
+	require.NotNil(t, parent)
+	_, child := StartSpan(ctx, "CloudProviderIncreaseSize", Int64("delta", 2), Bool("retried", false))
+	EndSpan(child, errors.New("increase failed"))
+	parent.SetAttributes(String("decision", "scale_up"), String("decision", "locked"))
+	EndSpan(parent, nil)
+	// ending twice has no effect
+	EndSpan(parent, errors.New("ignored"))
+
+	require.NoError(t, shutdown(context.Background()))
+
+	// spans started after the shutdown are no-ops
+	_, span := StartSpan(context.Background(), "AfterShutdown")
+	assert.Nil(t, span)
+
+	spans := c.spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "Bearer token", c.headers[0].Get("Authorization"))
+	assert.Equal(t, "application/json", c.headers[0].Get("Content-Type"))
+
+	resource := c.requests[0].ResourceSpans[0].Resource.Attributes
+	require.NotNil(t, attributeValue(resource, "service.name"))
+	assert.Equal(t, "escalator-test", *attributeValue(resource, "service.name").StringValue)
+	assert.Equal(t, TracerName, c.requests[0].ResourceSpans[0].ScopeSpans[0].Scope.Name)
+
+	exportedChild, exportedParent := spans[0], spans[1]
+	assert.Equal(t, "CloudProviderIncreaseSize", exportedChild.Name)
+	assert.Equal(t, "ScaleNodeGroup", exportedParent.Name)
+	assert.Len(t, exportedParent.TraceID, 32)
+	assert.Len(t, exportedParent.SpanID, 16)
+	assert.Empty(t, exportedParent.ParentSpanID)
+	assert.Equal(t, exportedParent.TraceID, exportedChild.TraceID)
+	assert.Equal(t, exportedParent.SpanID, exportedChild.ParentSpanID)
+	assert.Equal(t, otlpSpanKindInternal, exportedParent.Kind)
+
+	assert.Equal(t, otlpStatusCodeError, exportedChild.Status.Code)
+	assert.Equal(t, "increase failed", exportedChild.Status.Message)
+	require.Len(t, exportedChild.Events, 1)
+	assert.Equal(t, "exception", exportedChild.Events[0].Name)
+	require.NotNil(t, attributeValue(exportedChild.Attributes, "delta"))
+	assert.Equal(t, "2", *attributeValue(exportedChild.Attributes, "delta").IntValue)
+	require.NotNil(t, attributeValue(exportedChild.Attributes, "retried"))
+	assert.False(t, *attributeValue(exportedChild.Attributes, "retried").BoolValue)
+
+	assert.Equal(t, otlpStatus{}, exportedParent.Status)
+	assert.Empty(t, exportedParent.Events)
+	assert.Len(t, exportedParent.Attributes, 2)
+	require.NotNil(t, attributeValue(exportedParent.Attributes, "decision"))
+	assert.Equal(t, "locked", *attributeValue(exportedParent.Attributes, "decision").StringValue)
+}
+
+func TestStartInvalidConfig(t *testing.T) {
+	defer withEnv(map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"})()
+
+	_, err := Start(context.Background())
+	assert.Error(t, err)
+
+	_, span := StartSpan(context.Background(), "NotStarted")
+	assert.Nil(t, span)
+}